@@ -0,0 +1,333 @@
+package adminpb
+
+// Service is the full name of the Admin service; its methods are served at
+// "/" + Service + "/" + method.
+const Service = "nvelox.admin.v1.Admin"
+
+// Message is implemented by all messages.
+type Message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+type ListBackendsRequest struct{}
+
+func (m *ListBackendsRequest) Marshal() []byte { return nil }
+
+func (m *ListBackendsRequest) Unmarshal(b []byte) error {
+	*m = ListBackendsRequest{}
+	return parse(b, func(field) error { return nil })
+}
+
+type ListBackendsResponse struct {
+	Backends []*Backend
+}
+
+func (m *ListBackendsResponse) Marshal() []byte {
+	var b []byte
+	for _, be := range m.Backends {
+		b = appendMessage(b, 1, be.Marshal())
+	}
+	return b
+}
+
+func (m *ListBackendsResponse) Unmarshal(b []byte) error {
+	*m = ListBackendsResponse{}
+	return parse(b, func(f field) error {
+		if f.num == 1 && f.wire == wireBytes {
+			be := &Backend{}
+			if err := be.Unmarshal(f.data); err != nil {
+				return err
+			}
+			m.Backends = append(m.Backends, be)
+		}
+		return nil
+	})
+}
+
+type Backend struct {
+	Name      string
+	Balance   string
+	Servers   []*Server
+	Available bool
+	Reason    string
+}
+
+func (m *Backend) Marshal() []byte {
+	b := appendString(nil, 1, m.Name)
+	b = appendString(b, 2, m.Balance)
+	for _, s := range m.Servers {
+		b = appendMessage(b, 3, s.Marshal())
+	}
+	b = appendBool(b, 4, m.Available)
+	return appendString(b, 5, m.Reason)
+}
+
+func (m *Backend) Unmarshal(b []byte) error {
+	*m = Backend{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Name = f.str()
+		case 2:
+			m.Balance = f.str()
+		case 3:
+			if f.wire == wireBytes {
+				s := &Server{}
+				if err := s.Unmarshal(f.data); err != nil {
+					return err
+				}
+				m.Servers = append(m.Servers, s)
+			}
+		case 4:
+			m.Available = f.bool()
+		case 5:
+			m.Reason = f.str()
+		}
+		return nil
+	})
+}
+
+type Server struct {
+	Backend  string
+	Address  string
+	Healthy  bool
+	Weight   int32
+	Backup   bool
+	Disabled bool
+}
+
+func (m *Server) Marshal() []byte {
+	b := appendString(nil, 1, m.Backend)
+	b = appendString(b, 2, m.Address)
+	b = appendBool(b, 3, m.Healthy)
+	b = appendInt32(b, 4, m.Weight)
+	b = appendBool(b, 5, m.Backup)
+	return appendBool(b, 6, m.Disabled)
+}
+
+func (m *Server) Unmarshal(b []byte) error {
+	*m = Server{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Backend = f.str()
+		case 2:
+			m.Address = f.str()
+		case 3:
+			m.Healthy = f.bool()
+		case 4:
+			m.Weight = f.int32()
+		case 5:
+			m.Backup = f.bool()
+		case 6:
+			m.Disabled = f.bool()
+		}
+		return nil
+	})
+}
+
+type SetServerEnabledRequest struct {
+	Backend string
+	Server  string
+	Enabled bool
+}
+
+func (m *SetServerEnabledRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Backend)
+	b = appendString(b, 2, m.Server)
+	return appendBool(b, 3, m.Enabled)
+}
+
+func (m *SetServerEnabledRequest) Unmarshal(b []byte) error {
+	*m = SetServerEnabledRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Backend = f.str()
+		case 2:
+			m.Server = f.str()
+		case 3:
+			m.Enabled = f.bool()
+		}
+		return nil
+	})
+}
+
+type SetWeightRequest struct {
+	Backend string
+	Server  string
+	Weight  int32
+	Persist bool
+}
+
+func (m *SetWeightRequest) Marshal() []byte {
+	b := appendString(nil, 1, m.Backend)
+	b = appendString(b, 2, m.Server)
+	b = appendInt32(b, 3, m.Weight)
+	return appendBool(b, 4, m.Persist)
+}
+
+func (m *SetWeightRequest) Unmarshal(b []byte) error {
+	*m = SetWeightRequest{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Backend = f.str()
+		case 2:
+			m.Server = f.str()
+		case 3:
+			m.Weight = f.int32()
+		case 4:
+			m.Persist = f.bool()
+		}
+		return nil
+	})
+}
+
+type ReloadRequest struct{}
+
+func (m *ReloadRequest) Marshal() []byte { return nil }
+
+func (m *ReloadRequest) Unmarshal(b []byte) error {
+	*m = ReloadRequest{}
+	return parse(b, func(field) error { return nil })
+}
+
+type ReloadResponse struct {
+	Changes []*Change
+}
+
+func (m *ReloadResponse) Marshal() []byte {
+	var b []byte
+	for _, c := range m.Changes {
+		b = appendMessage(b, 1, c.Marshal())
+	}
+	return b
+}
+
+func (m *ReloadResponse) Unmarshal(b []byte) error {
+	*m = ReloadResponse{}
+	return parse(b, func(f field) error {
+		if f.num == 1 && f.wire == wireBytes {
+			c := &Change{}
+			if err := c.Unmarshal(f.data); err != nil {
+				return err
+			}
+			m.Changes = append(m.Changes, c)
+		}
+		return nil
+	})
+}
+
+type Change struct {
+	Kind   string
+	Name   string
+	Action string
+}
+
+func (m *Change) Marshal() []byte {
+	b := appendString(nil, 1, m.Kind)
+	b = appendString(b, 2, m.Name)
+	return appendString(b, 3, m.Action)
+}
+
+func (m *Change) Unmarshal(b []byte) error {
+	*m = Change{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Kind = f.str()
+		case 2:
+			m.Name = f.str()
+		case 3:
+			m.Action = f.str()
+		}
+		return nil
+	})
+}
+
+type WatchStatsRequest struct {
+	IntervalSeconds uint32
+}
+
+func (m *WatchStatsRequest) Marshal() []byte {
+	return appendVarint(nil, 1, uint64(m.IntervalSeconds))
+}
+
+func (m *WatchStatsRequest) Unmarshal(b []byte) error {
+	*m = WatchStatsRequest{}
+	return parse(b, func(f field) error {
+		if f.num == 1 && f.wire == wireVarint {
+			m.IntervalSeconds = uint32(f.v)
+		}
+		return nil
+	})
+}
+
+type Stats struct {
+	SinceUnix   int64
+	Connections int64
+	Backends    []*BackendTraffic
+}
+
+func (m *Stats) Marshal() []byte {
+	b := appendInt64(nil, 1, m.SinceUnix)
+	b = appendInt64(b, 2, m.Connections)
+	for _, t := range m.Backends {
+		b = appendMessage(b, 3, t.Marshal())
+	}
+	return b
+}
+
+func (m *Stats) Unmarshal(b []byte) error {
+	*m = Stats{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.SinceUnix = f.int64()
+		case 2:
+			m.Connections = f.int64()
+		case 3:
+			if f.wire == wireBytes {
+				t := &BackendTraffic{}
+				if err := t.Unmarshal(f.data); err != nil {
+					return err
+				}
+				m.Backends = append(m.Backends, t)
+			}
+		}
+		return nil
+	})
+}
+
+type BackendTraffic struct {
+	Name        string
+	Connections int64
+	BytesIn     int64
+	BytesOut    int64
+}
+
+func (m *BackendTraffic) Marshal() []byte {
+	b := appendString(nil, 1, m.Name)
+	b = appendInt64(b, 2, m.Connections)
+	b = appendInt64(b, 3, m.BytesIn)
+	return appendInt64(b, 4, m.BytesOut)
+}
+
+func (m *BackendTraffic) Unmarshal(b []byte) error {
+	*m = BackendTraffic{}
+	return parse(b, func(f field) error {
+		switch f.num {
+		case 1:
+			m.Name = f.str()
+		case 2:
+			m.Connections = f.int64()
+		case 3:
+			m.BytesIn = f.int64()
+		case 4:
+			m.BytesOut = f.int64()
+		}
+		return nil
+	})
+}
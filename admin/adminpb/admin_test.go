@@ -0,0 +1,48 @@
+package adminpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	in := &ListBackendsResponse{Backends: []*Backend{{
+		Name:      "web",
+		Balance:   "leastconn",
+		Available: true,
+		Servers: []*Server{
+			{Backend: "web", Address: "10.0.0.1:80", Healthy: true, Weight: 256},
+			{Backend: "web", Address: "10.0.0.2:80", Weight: -1, Backup: true, Disabled: true},
+		},
+	}}}
+	var out ListBackendsResponse
+	if err := out.Unmarshal(in.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, in) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	// As protoc encodes SetWeightRequest{backend: "web", server: "a", weight: 3}
+	m := &SetWeightRequest{Backend: "web", Server: "a", Weight: 3}
+	want := []byte{0x0a, 3, 'w', 'e', 'b', 0x12, 1, 'a', 0x18, 3}
+	if got := m.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("Marshal = %x, want %x", got, want)
+	}
+
+	// Unknown fields of every wire type are skipped
+	data := append([]byte{0x28, 7, 0x31, 1, 2, 3, 4, 5, 6, 7, 8, 0x3a, 2, 'x', 'y', 0x45, 1, 2, 3, 4}, want...)
+	var got SetWeightRequest
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if got != *m {
+		t.Errorf("Unmarshal = %+v, want %+v", got, *m)
+	}
+	if err := got.Unmarshal([]byte{0x0a, 5, 'w'}); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
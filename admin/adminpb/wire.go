@@ -0,0 +1,137 @@
+// Package adminpb holds the messages of proto/nvelox/admin/v1/admin.proto
+// with their protobuf wire encoding, written by hand to keep nvelox free of
+// a protobuf runtime. Unknown fields are skipped when decoding, as the
+// protobuf rules require, so peers built from newer revisions of the file
+// interoperate.
+package adminpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireBytes  = 2
+	wireI32    = 5
+)
+
+var errTruncated = errors.New("adminpb: truncated message")
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendMessage(b []byte, field int, m []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(m)))
+	return append(b, m...)
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendVarint(b, field, 1)
+}
+
+// appendInt32 encodes an int32 field; negative values take ten bytes, as
+// they are sign-extended to 64 bits.
+func appendInt32(b []byte, field int, v int32) []byte {
+	return appendVarint(b, field, uint64(int64(v)))
+}
+
+func appendInt64(b []byte, field int, v int64) []byte {
+	return appendVarint(b, field, uint64(v))
+}
+
+// field is one decoded field: v holds varints, data the bytes of
+// length-delimited fields.
+type field struct {
+	num  int
+	wire int
+	v    uint64
+	data []byte
+}
+
+// parse calls fn with each field of a message, skipping fixed-size fields.
+func parse(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := field{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return errTruncated
+			}
+			f.data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case wireI64, wireI32:
+			size := 8
+			if f.wire == wireI32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errTruncated
+			}
+			b = b[size:]
+			continue
+		default:
+			return fmt.Errorf("adminpb: unsupported wire type %d", f.wire)
+		}
+		if f.num == 0 {
+			return errors.New("adminpb: invalid field number 0")
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// str returns a string field, "" for a field of another wire type.
+func (f field) str() string {
+	if f.wire != wireBytes {
+		return ""
+	}
+	return string(f.data)
+}
+
+func (f field) bool() bool   { return f.wire == wireVarint && f.v != 0 }
+func (f field) int32() int32 { return int32(f.int64()) }
+func (f field) int64() int64 {
+	if f.wire != wireVarint {
+		return 0
+	}
+	return int64(f.v)
+}
@@ -0,0 +1,364 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nvelox/admin/adminpb"
+	"nvelox/adminclient"
+	"nvelox/config"
+	"nvelox/core"
+	"nvelox/core/logging"
+	"nvelox/lb"
+)
+
+const (
+	// maxGRPCMessage bounds request messages, as gRPC servers do by default.
+	maxGRPCMessage = 4 << 20
+	// defaultStatsWatch is the WatchStats interval when the request sets none.
+	defaultStatsWatch = 10 * time.Second
+)
+
+// gRPC status codes answered by the API.
+const (
+	codeOK                 = 0
+	codeInvalidArgument    = 3
+	codeNotFound           = 5
+	codeResourceExhausted  = 8
+	codeFailedPrecondition = 9
+	codeUnimplemented      = 12
+	codeInternal           = 13
+	codeUnauthenticated    = 16
+)
+
+// grpcError is a call failure with its gRPC status code.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// StartGRPC serves the gRPC control-plane API on cfg.Bind in the background,
+// over TLS when cfg has a certificate and over plain HTTP/2 otherwise. It
+// returns the bound address.
+func (s *Server) StartGRPC(cfg config.GRPCConfig) (net.Addr, error) {
+	var protocols http.Protocols
+	var tlsConfig *tls.Config
+	if cfg.Cert.IsZero() {
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		cert, err := tls.X509KeyPair([]byte(cfg.Cert.Value()), []byte(cfg.Key.Value()))
+		if err != nil {
+			return nil, err
+		}
+		protocols.SetHTTP2(true)
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	l, err := s.listen(cfg.Bind)
+	if err != nil {
+		return nil, err
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[string]net.Listener)
+	}
+	s.listeners[cfg.Bind] = l
+
+	// Streams end with the server rather than holding up its shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Handler:     s.GRPCHandler(cfg.Token.Value()),
+		Protocols:   &protocols,
+		TLSConfig:   tlsConfig,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		ErrorLog:    log.New(logging.Writer("admin", logging.ErrorLevel), "", 0),
+	}
+	srv.RegisterOnShutdown(cancel)
+	s.grpcSrv = srv
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("[ADMIN] gRPC server stopped: %v", err)
+		}
+	}()
+	logging.Info("[ADMIN] gRPC API listening on %s", l.Addr())
+	return l.Addr(), nil
+}
+
+// ShutdownGRPC stops the gRPC server, ending open streams.
+func (s *Server) ShutdownGRPC(ctx context.Context) error {
+	if s.grpcSrv == nil {
+		return nil
+	}
+	return s.grpcSrv.Shutdown(ctx)
+}
+
+// GRPCHandler returns the handler serving the Admin service to callers
+// presenting token.
+func (s *Server) GRPCHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		err := s.grpcCall(w, r, token)
+
+		code, msg := codeOK, ""
+		if err != nil {
+			var gerr *grpcError
+			if !errors.As(err, &gerr) {
+				gerr = &grpcError{code: codeInternal, msg: err.Error()}
+			}
+			code, msg = gerr.code, gerr.msg
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+		if msg != "" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", percentEncode(msg))
+		}
+	})
+}
+
+func (s *Server) grpcCall(w http.ResponseWriter, r *http.Request, token string) error {
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+		return grpcErrorf(codeUnauthenticated, "missing or invalid bearer token")
+	}
+	method, ok := strings.CutPrefix(r.URL.Path, "/"+adminpb.Service+"/")
+	if !ok {
+		return grpcErrorf(codeUnimplemented, "unknown service in %s", r.URL.Path)
+	}
+
+	m, ok := grpcMethods[method]
+	if !ok {
+		return grpcErrorf(codeUnimplemented, "unknown method %s", method)
+	}
+	if !m.readOnly {
+		if err := s.Engine.CheckFrozen("gRPC "+method, "gRPC client "+r.RemoteAddr); err != nil {
+			return engineGRPCError(err)
+		}
+	}
+	return m.call(s, w, r)
+}
+
+// grpcMethod is a method of the Admin service. Every method is refused while
+// the configuration is frozen unless marked readOnly.
+type grpcMethod struct {
+	readOnly bool
+	call     func(s *Server, w http.ResponseWriter, r *http.Request) error
+}
+
+var grpcMethods = map[string]grpcMethod{
+	"ListBackends":     {readOnly: true, call: (*Server).grpcListBackends},
+	"SetServerEnabled": {call: (*Server).grpcSetServerEnabled},
+	"SetWeight":        {call: (*Server).grpcSetWeight},
+	"Reload":           {call: (*Server).grpcReload},
+	"WatchStats":       {readOnly: true, call: (*Server).grpcWatchStats},
+}
+
+func (s *Server) grpcListBackends(w http.ResponseWriter, r *http.Request) error {
+	if err := readGRPC(r.Body, &adminpb.ListBackendsRequest{}); err != nil {
+		return err
+	}
+	resp := &adminpb.ListBackendsResponse{}
+	for _, be := range s.backends() {
+		resp.Backends = append(resp.Backends, toPBBackend(be))
+	}
+	return writeGRPC(w, resp)
+}
+
+func (s *Server) grpcSetServerEnabled(w http.ResponseWriter, r *http.Request) error {
+	var req adminpb.SetServerEnabledRequest
+	if err := readGRPC(r.Body, &req); err != nil {
+		return err
+	}
+	if err := s.Engine.SetDisabled(req.Backend, req.Server, !req.Enabled); err != nil {
+		return engineGRPCError(err)
+	}
+	return writeGRPC(w, s.pbServer(req.Backend, req.Server))
+}
+
+func (s *Server) grpcSetWeight(w http.ResponseWriter, r *http.Request) error {
+	var req adminpb.SetWeightRequest
+	if err := readGRPC(r.Body, &req); err != nil {
+		return err
+	}
+	if err := s.Engine.SetWeight(req.Backend, req.Server, int(req.Weight), req.Persist); err != nil {
+		return engineGRPCError(err)
+	}
+	return writeGRPC(w, s.pbServer(req.Backend, req.Server))
+}
+
+func (s *Server) grpcReload(w http.ResponseWriter, r *http.Request) error {
+	if err := readGRPC(r.Body, &adminpb.ReloadRequest{}); err != nil {
+		return err
+	}
+	if s.Reload == nil {
+		return grpcErrorf(codeFailedPrecondition, "no configuration file to reload")
+	}
+	changes, err := s.Reload()
+	if err != nil {
+		return grpcErrorf(codeFailedPrecondition, "keeping current configuration: %v", err)
+	}
+	resp := &adminpb.ReloadResponse{}
+	for _, c := range changes {
+		resp.Changes = append(resp.Changes, &adminpb.Change{Kind: c.Kind, Name: c.Name, Action: c.Action})
+	}
+	return writeGRPC(w, resp)
+}
+
+// grpcWatchStats streams the stats every interval until the client leaves.
+func (s *Server) grpcWatchStats(w http.ResponseWriter, r *http.Request) error {
+	var req adminpb.WatchStatsRequest
+	if err := readGRPC(r.Body, &req); err != nil {
+		return err
+	}
+	interval := defaultStatsWatch
+	if req.IntervalSeconds > 0 {
+		interval = time.Duration(req.IntervalSeconds) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := writeGRPC(w, s.pbStats()); err != nil {
+			return err
+		}
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// readGRPC reads the single length-prefixed message of a unary request.
+func readGRPC(body io.Reader, m adminpb.Message) error {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return grpcErrorf(codeInvalidArgument, "reading request: %v", err)
+	}
+	if prefix[0] != 0 {
+		return grpcErrorf(codeUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessage {
+		return grpcErrorf(codeResourceExhausted, "request of %d bytes exceeds %d", size, maxGRPCMessage)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return grpcErrorf(codeInvalidArgument, "reading request: %v", err)
+	}
+	if err := m.Unmarshal(data); err != nil {
+		return grpcErrorf(codeInvalidArgument, "%v", err)
+	}
+	return nil
+}
+
+// writeGRPC sends a length-prefixed message and flushes it to the client.
+func writeGRPC(w http.ResponseWriter, m adminpb.Message) error {
+	data := m.Marshal()
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	if _, err := w.Write(append(frame, data...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// engineGRPCError maps engine errors to gRPC status codes, as
+// writeEngineError does to HTTP statuses.
+func engineGRPCError(err error) error {
+	code := codeFailedPrecondition
+	switch {
+	case errors.Is(err, core.ErrUnknownBackend), errors.Is(err, lb.ErrUnknownServer):
+		code = codeNotFound
+	case errors.Is(err, lb.ErrInvalidWeight):
+		code = codeInvalidArgument
+	}
+	return &grpcError{code: code, msg: err.Error()}
+}
+
+// pbServer returns the current state of a server.
+func (s *Server) pbServer(backend, server string) *adminpb.Server {
+	for _, be := range s.backends() {
+		if be.Name != backend {
+			continue
+		}
+		for _, srv := range toPBBackend(be).Servers {
+			if srv.Address == server {
+				return srv
+			}
+		}
+	}
+	return &adminpb.Server{Backend: backend, Address: server}
+}
+
+func (s *Server) pbStats() *adminpb.Stats {
+	st := s.Engine.Stats()
+	out := &adminpb.Stats{SinceUnix: st.Since.Unix(), Connections: st.Connections}
+	names := make([]string, 0, len(st.Backends))
+	for name := range st.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b := st.Backends[name]
+		out.Backends = append(out.Backends, &adminpb.BackendTraffic{
+			Name:        name,
+			Connections: b.Connections,
+			BytesIn:     b.BytesIn,
+			BytesOut:    b.BytesOut,
+		})
+	}
+	return out
+}
+
+// percentEncode escapes a grpc-message value as the gRPC protocol asks.
+func percentEncode(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func toPBBackend(be adminclient.Backend) *adminpb.Backend {
+	out := &adminpb.Backend{Name: be.Name, Balance: be.Balance, Available: be.Available, Reason: be.Reason}
+	for _, srv := range be.Servers {
+		out.Servers = append(out.Servers, &adminpb.Server{
+			Backend:  be.Name,
+			Address:  srv.Address,
+			Healthy:  srv.Healthy,
+			Weight:   int32(srv.Weight),
+			Backup:   srv.Backup,
+			Disabled: srv.Disabled,
+		})
+	}
+	return out
+}
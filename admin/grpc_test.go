@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"nvelox/admin/adminpb"
+	"nvelox/config"
+	"nvelox/core"
+	"nvelox/lb"
+)
+
+const testGRPCToken = "0123456789abcdef"
+
+// grpcClient calls the API over plain HTTP/2.
+type grpcClient struct {
+	t      *testing.T
+	base   string
+	token  string
+	client *http.Client
+}
+
+func newGRPCClient(t *testing.T, addr string) *grpcClient {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &grpcClient{
+		t:      t,
+		base:   "http://" + addr + "/" + adminpb.Service + "/",
+		token:  testGRPCToken,
+		client: &http.Client{Transport: &http.Transport{Protocols: &protocols}},
+	}
+}
+
+// call sends req to method and returns the response body and grpc-status.
+func (c *grpcClient) call(ctx context.Context, method string, req adminpb.Message) (io.ReadCloser, *http.Response) {
+	c.t.Helper()
+	data := req.Marshal()
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.base+method, bytes.NewReader(append(frame, data...)))
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(r)
+	if err != nil {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	return resp.Body, resp
+}
+
+// unary calls method, decoding the response into out, and returns the
+// grpc-status.
+func (c *grpcClient) unary(method string, req, out adminpb.Message) string {
+	c.t.Helper()
+	body, resp := c.call(context.Background(), method, req)
+	defer body.Close()
+	if err := readMessage(body, out); err != nil && !errors.Is(err, io.EOF) {
+		c.t.Fatalf("%s: %v", method, err)
+	}
+	io.Copy(io.Discard, body)
+	return resp.Trailer.Get("Grpc-Status")
+}
+
+func readMessage(r io.Reader, m adminpb.Message) error {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return m.Unmarshal(data)
+}
+
+func TestGRPC(t *testing.T) {
+	_, engine := newTestServer(t)
+	engine.Balancers["web"] = lb.NewPool("roundrobin", []lb.Server{
+		{Address: "10.0.0.1:80", Weight: lb.DefaultWeight},
+		{Address: "10.0.0.2:80", Weight: lb.DefaultWeight},
+	})
+	engine.Backends["web"] = &engine.CurrentConfig().Backends[0]
+
+	srv := NewServer(engine, "v-test")
+	reloads := 0
+	srv.Reload = func() ([]core.Change, error) {
+		reloads++
+		return []core.Change{{Kind: "backend", Name: "web", Action: "updated"}}, nil
+	}
+	addr, err := srv.StartGRPC(config.GRPCConfig{Bind: "127.0.0.1:0", Token: config.Secret{Ref: testGRPCToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.ShutdownGRPC(context.Background())
+	c := newGRPCClient(t, addr.String())
+
+	var server adminpb.Server
+	if code := c.unary("SetServerEnabled", &adminpb.SetServerEnabledRequest{Backend: "web", Server: "10.0.0.1:80"}, &server); code != "0" {
+		t.Fatalf("SetServerEnabled: status %s", code)
+	}
+	if !server.Disabled || server.Address != "10.0.0.1:80" {
+		t.Errorf("SetServerEnabled returned %+v", server)
+	}
+	if code := c.unary("SetWeight", &adminpb.SetWeightRequest{Backend: "web", Server: "10.0.0.2:80", Weight: 7}, &server); code != "0" {
+		t.Fatalf("SetWeight: status %s", code)
+	}
+	if server.Weight != 7 {
+		t.Errorf("SetWeight returned %+v", server)
+	}
+
+	var list adminpb.ListBackendsResponse
+	if code := c.unary("ListBackends", &adminpb.ListBackendsRequest{}, &list); code != "0" {
+		t.Fatalf("ListBackends: status %s", code)
+	}
+	if len(list.Backends) != 1 || len(list.Backends[0].Servers) != 2 || !list.Backends[0].Servers[0].Disabled {
+		t.Errorf("ListBackends returned %+v", list.Backends)
+	}
+
+	var reload adminpb.ReloadResponse
+	if code := c.unary("Reload", &adminpb.ReloadRequest{}, &reload); code != "0" || reloads != 1 {
+		t.Fatalf("Reload: status %s after %d reloads", code, reloads)
+	}
+	if len(reload.Changes) != 1 || reload.Changes[0].Name != "web" {
+		t.Errorf("Reload returned %+v", reload.Changes)
+	}
+
+	for _, tc := range []struct {
+		method string
+		req    adminpb.Message
+		code   string
+	}{
+		{"SetWeight", &adminpb.SetWeightRequest{Backend: "api", Server: "10.0.0.1:80", Weight: 1}, "5"},
+		{"SetWeight", &adminpb.SetWeightRequest{Backend: "web", Server: "10.0.0.1:80", Weight: 999}, "3"},
+		{"SetServerEnabled", &adminpb.SetServerEnabledRequest{Backend: "web", Server: "10.0.0.9:80"}, "5"},
+		{"Frobnicate", &adminpb.ListBackendsRequest{}, "12"},
+	} {
+		if code := c.unary(tc.method, tc.req, &server); code != tc.code {
+			t.Errorf("%s %+v: status %s, want %s", tc.method, tc.req, code, tc.code)
+		}
+	}
+
+	// A frozen configuration refuses every method not marked read-only
+	engine.SetFrozen(true, "test")
+	for method, m := range grpcMethods {
+		if !m.readOnly {
+			if code := c.unary(method, &adminpb.ListBackendsRequest{}, &server); code != "9" {
+				t.Errorf("%s while frozen: status %s, want 9", method, code)
+			}
+		}
+	}
+	if code := c.unary("ListBackends", &adminpb.ListBackendsRequest{}, &list); code != "0" {
+		t.Errorf("ListBackends while frozen: status %s", code)
+	}
+	engine.SetFrozen(false, "test")
+
+	c.token = "wrong"
+	if code := c.unary("ListBackends", &adminpb.ListBackendsRequest{}, &list); code != "16" {
+		t.Errorf("wrong token: status %s, want 16", code)
+	}
+	c.token = testGRPCToken
+
+	// A stream sends the counters at once and ends with the call
+	ctx, cancel := context.WithCancel(context.Background())
+	body, _ := c.call(ctx, "WatchStats", &adminpb.WatchStatsRequest{IntervalSeconds: 1})
+	defer body.Close()
+	for i := 0; i < 2; i++ {
+		var stats adminpb.Stats
+		if err := readMessage(body, &stats); err != nil {
+			t.Fatalf("WatchStats message %d: %v", i, err)
+		}
+		if stats.SinceUnix == 0 {
+			t.Errorf("WatchStats message %d: %+v", i, stats)
+		}
+	}
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.ShutdownGRPC(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown blocked")
+	}
+}
+
+func TestGRPC_RejectsPlainHTTP(t *testing.T) {
+	_, engine := newTestServer(t)
+	srv := NewServer(engine, "v-test")
+	addr, err := srv.StartGRPC(config.GRPCConfig{Bind: "127.0.0.1:0", Token: config.Secret{Ref: testGRPCToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.ShutdownGRPC(context.Background())
+	resp, err := http.Post("http://"+addr.String()+"/"+adminpb.Service+"/ListBackends", "application/grpc", nil)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("HTTP/1.1 request: %s", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"nvelox/adminclient"
+	"nvelox/config"
+)
+
+// apiVersion is the version of the admin API contract (not the binary).
+const apiVersion = "v1"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	bindsType   = reflect.TypeOf(config.Binds{})
+	sourcesType = reflect.TypeOf(config.Sources{})
+	secretType  = reflect.TypeOf(config.Secret{})
+)
+
+// Spec builds the OpenAPI 3 document from the route table, so the published
+// contract cannot drift from the handlers.
+func (s *Server) Spec() map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]any{}
+
+	errRef := schemaRef(reflect.TypeOf(adminclient.Error{}), schemas)
+
+	for _, rt := range s.routes {
+		op := map[string]any{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": schemaRef(reflect.TypeOf(rt.Response), schemas)},
+					},
+				},
+				"default": map[string]any{
+					"description": "Error",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": errRef},
+					},
+				},
+			},
+		}
+		if params := pathParams(rt.Path); len(params) > 0 || len(rt.Query) > 0 {
+			for _, p := range rt.Query {
+				params = append(params, map[string]any{
+					"name":        p.Name,
+					"in":          "query",
+					"description": p.Description,
+					"schema":      map[string]any{"type": p.Type},
+				})
+			}
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaRef(reflect.TypeOf(rt.Request), schemas)},
+				},
+			}
+		}
+
+		item, _ := paths[rt.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "nvelox admin API",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		// The token is only required when admin.token is set
+		"security": []any{map[string]any{}, map[string]any{"bearer": []any{}}},
+	}
+}
+
+// pathParams declares the {name} segments of a path pattern.
+func pathParams(path string) []any {
+	params := make([]any, 0)
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, map[string]any{
+				"name":     strings.Trim(seg, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return params
+}
+
+// operationID derives a stable identifier such as "getApiV1Status".
+func operationID(rt route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.Method))
+	for _, part := range strings.FieldsFunc(rt.Path, func(r rune) bool { return r == '/' || r == '.' || r == '{' || r == '}' || r == '_' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaRef returns an inline schema for t, registering named structs as components.
+func schemaRef(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == secretType:
+		return map[string]any{"type": "string"}
+	case t == bindsType || t == sourcesType:
+		// A single address is written as a plain string
+		str := map[string]any{"type": "string"}
+		return map[string]any{"oneOf": []any{str, map[string]any{"type": "array", "items": str}}}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // Reserve to stop recursion
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.Interface:
+		return map[string]any{}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		tag := f.Tag.Get("json")
+		if tag == "" {
+			// Config types only carry yaml tags; the state endpoint accepts those names.
+			tag = f.Tag.Get("yaml")
+		}
+		if tag != "" {
+			if tag == "-" {
+				continue
+			}
+			name = strings.Split(tag, ",")[0]
+		}
+		props[name] = schemaRef(f.Type, schemas)
+	}
+	return map[string]any{"type": "object", "properties": props}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"nvelox/config"
+	"nvelox/core"
+)
+
+var update = flag.Bool("update", false, "rewrite docs/openapi.json from the route table")
+
+const specPath = "../docs/openapi.json"
+
+// TestSpecUpToDate keeps the published OpenAPI document in sync with the code.
+// Regenerate with: go test ./admin -run TestSpecUpToDate -update
+func TestSpecUpToDate(t *testing.T) {
+	srv := NewServer(core.NewEngine(&config.Config{}), "")
+	got, err := json.MarshalIndent(srv.Spec(), "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal spec: %v", err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile(specPath, got, 0644); err != nil {
+			t.Fatalf("failed to write spec: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(specPath)
+	if err != nil {
+		t.Fatalf("failed to read spec: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is stale; regenerate with -update", specPath)
+	}
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	srv := NewServer(core.NewEngine(&config.Config{}), "")
+	paths := srv.Spec()["paths"].(map[string]any)
+	for _, rt := range srv.routes {
+		if _, ok := paths[rt.Path]; !ok {
+			t.Errorf("route %s %s missing from spec", rt.Method, rt.Path)
+		}
+	}
+}
@@ -0,0 +1,1116 @@
+// Package admin serves the nvelox runtime admin API over HTTP.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"nvelox/adminclient"
+	"nvelox/config"
+	"nvelox/core"
+	"nvelox/core/health"
+	"nvelox/core/logging"
+	"nvelox/lb"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMemoryLimit  = 10
+	defaultDrainTimeout = 30 * time.Second
+	defaultLevelRevert  = 15 * time.Minute
+	maxStateBody        = 4 << 20
+)
+
+// Server exposes engine state and operations.
+type Server struct {
+	Engine  *core.Engine
+	Version string
+
+	// Inherited holds listening sockets passed by the process this one
+	// replaces, by "tcp://host:port" address; Start and StartMonitor serve
+	// the one of their address instead of binding.
+	Inherited map[string]*os.File
+
+	// Reload re-reads the configuration file and applies it, for the gRPC
+	// Reload call; nil when there is no file to reload.
+	Reload func() ([]core.Change, error)
+
+	// Token, when set, is the bearer token every caller of Handler must
+	// present. The monitoring routes of MonitorHandler stay open.
+	Token string
+
+	started    time.Time
+	routes     []route
+	httpSrv    *http.Server
+	monitorSrv *http.Server
+	grpcSrv    *http.Server
+	listeners  map[string]net.Listener // by configured address, see ListenerFiles
+	socket     *controlSocket
+}
+
+// route describes one endpoint; the table drives both the mux and the OpenAPI document.
+type route struct {
+	Method   string
+	Path     string
+	Summary  string
+	Query    []param
+	Request  any  // zero value of the JSON request body type, nil if none
+	Response any  // zero value of the JSON response body type
+	Monitor  bool // read-only, also served on the monitoring listener
+	Unfrozen bool // a change still served while the configuration is frozen
+	handle   http.HandlerFunc
+}
+
+type param struct {
+	Name        string
+	Type        string // OpenAPI primitive type
+	Description string
+}
+
+func NewServer(engine *core.Engine, version string) *Server {
+	s := &Server{
+		Engine:  engine,
+		Version: version,
+		started: time.Now(),
+	}
+	s.routes = []route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/status",
+			Summary:  "Instance status",
+			Response: adminclient.Status{},
+			Monitor:  true,
+			handle:   s.handleStatus,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/healthz",
+			Summary:  "Liveness probe; 200 as long as the process serves requests",
+			Response: adminclient.Health{},
+			Monitor:  true,
+			handle:   s.handleHealthz,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/ready",
+			Summary:  "Readiness probe; 503 while draining",
+			Response: adminclient.Readiness{},
+			Monitor:  true,
+			handle:   s.handleReady,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/api/v1/drain",
+			Summary: "Refuse new connections and wait for existing ones to finish (Kubernetes preStop)",
+			Query: []param{
+				{Name: "timeout", Type: "string", Description: "Maximum wait as a duration, default 30s"},
+			},
+			Response: adminclient.DrainResult{},
+			Unfrozen: true,
+			handle:   s.handleDrain,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/backends",
+			Summary:  "List backends with per-server health",
+			Response: []adminclient.Backend{},
+			Monitor:  true,
+			handle:   s.handleBackends,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/backends/{name}/servers/{server}/weight",
+			Summary:  "Set a server weight (0-256, 0 drains), optionally persisted",
+			Request:  adminclient.WeightRequest{},
+			Response: adminclient.Server{},
+			handle:   s.handleSetWeight,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/backends/{name}/servers/{server}/state",
+			Summary:  "Put a server in the ready, drain or maint state until the next restart",
+			Request:  adminclient.ServerStateRequest{},
+			Response: adminclient.Server{},
+			handle:   s.handleSetServerState,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/hints",
+			Summary:  "Stream server weight and health hints as NDJSON, one result line per hint",
+			Request:  adminclient.Hint{},
+			Response: adminclient.HintResult{},
+			handle:   s.handleHints,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/backends/{name}/rebalance",
+			Summary:  "Connection distribution of a backend and the connections to close to even it out",
+			Response: adminclient.RebalancePlan{},
+			handle:   s.handleRebalance,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/api/v1/connections/memory",
+			Summary: "Connections holding the most buffered bytes",
+			Query: []param{
+				{Name: "limit", Type: "integer", Description: "Maximum number of connections to return"},
+			},
+			Response: []adminclient.ConnMemory{},
+			handle:   s.handleMemory,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/shedding",
+			Summary:  "Load shedding state and rejected connections per listener",
+			Response: adminclient.Shedding{},
+			Monitor:  true,
+			handle:   s.handleShedding,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/listeners/queues",
+			Summary:  "Kernel accept queues of the TCP listeners and the connections dropped before being accepted",
+			Response: adminclient.AcceptQueues{},
+			Monitor:  true,
+			handle:   s.handleAcceptQueues,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/stats",
+			Summary:  "Cumulative connection, per-backend byte, ClientHello inspection and backpressure counters",
+			Response: adminclient.Stats{},
+			Monitor:  true,
+			handle:   s.handleStats,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/logging",
+			Summary:  "Log levels in effect",
+			Response: adminclient.LogLevels{},
+			handle:   s.handleGetLogging,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/logging",
+			Summary:  "Change the global or per-component log level, reverted after a duration",
+			Request:  adminclient.LogLevelRequest{},
+			Response: adminclient.LogLevels{},
+			handle:   s.handleSetLogging,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/api/v1/logging",
+			Summary:  "Revert a temporary log level change now",
+			Response: adminclient.LogLevels{},
+			handle:   s.handleResetLogging,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/state",
+			Summary:  "Currently applied listeners and backends",
+			Response: adminclient.State{},
+			handle:   s.handleGetState,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/state",
+			Summary:  "Converge to the given listeners and backends (JSON or YAML body)",
+			Request:  adminclient.State{},
+			Response: adminclient.ApplyResult{},
+			handle:   s.handlePutState,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/listeners",
+			Summary:  "Start a listener, port ranges included, without a restart (JSON or YAML body)",
+			Request:  config.Listener{},
+			Response: adminclient.ApplyResult{},
+			handle:   s.handleAddListener,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/api/v1/listeners/{name}",
+			Summary:  "Stop a listener, letting its open connections finish",
+			Response: adminclient.ApplyResult{},
+			handle:   s.handleRemoveListener,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/listeners/{name}/backend",
+			Summary:  "Point a listener at another backend, draining existing connections",
+			Request:  adminclient.SwapRequest{},
+			Response: adminclient.Swap{},
+			handle:   s.handleSwapBackend,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/listeners/swap",
+			Summary:  "Exchange the backends of two listeners atomically",
+			Request:  adminclient.SwapListenersRequest{},
+			Response: []adminclient.Swap{},
+			handle:   s.handleSwapListeners,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/drains",
+			Summary:  "Backend drains left by swaps and server drains from weight 0, with connections remaining",
+			Response: []adminclient.Drain{},
+			Monitor:  true,
+			handle:   s.handleDrains,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/drains/{id}/accelerate",
+			Summary:  "Close the remaining connections of a drain now",
+			Response: adminclient.DrainAccelerated{},
+			handle:   s.handleAccelerateDrain,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/api/v1/drains/{id}",
+			Summary:  "Cancel a drain: connections finish on their own, a drained server gets its weight back",
+			Response: []adminclient.Drain{},
+			handle:   s.handleCancelDrain,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/listeners/{name}/trace",
+			Summary:  "Turn connection lifecycle tracing of a listener on or off until the next reload",
+			Request:  adminclient.TraceRequest{},
+			Response: adminclient.Trace{},
+			handle:   s.handleSetTrace,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/freeze",
+			Summary:  "Whether the configuration is frozen",
+			Response: adminclient.Freeze{},
+			Monitor:  true,
+			handle:   s.handleGetFreeze,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/freeze",
+			Summary:  "Freeze the configuration, refusing every change and reload until thawed, or thaw it",
+			Request:  adminclient.FreezeRequest{},
+			Response: adminclient.Freeze{},
+			Unfrozen: true,
+			handle:   s.handleSetFreeze,
+		},
+	}
+	return s
+}
+
+// Handler returns the HTTP handler serving all admin routes and the OpenAPI document.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes {
+		handle := rt.handle
+		if rt.Method != http.MethodGet && !rt.Unfrozen {
+			handle = s.unlessFrozen(handle)
+		}
+		mux.HandleFunc(rt.Method+" "+rt.Path, handle)
+	}
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Spec())
+	})
+	if s.Token == "" {
+		return mux
+	}
+	return s.authorized(mux)
+}
+
+// authorized refuses callers not presenting Token as a bearer token.
+func (s *Server) authorized(next http.Handler) http.Handler {
+	want := []byte("Bearer " + s.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unlessFrozen refuses a change while the configuration is frozen.
+func (s *Server) unlessFrozen(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Engine.CheckFrozen(r.Method+" "+r.URL.Path, "admin API client "+r.RemoteAddr); err != nil {
+			writeEngineError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// MonitorHandler returns the HTTP handler serving only the read-only
+// monitoring routes: health, readiness, status and counters.
+func (s *Server) MonitorHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes {
+		if rt.Monitor {
+			mux.HandleFunc(rt.Method+" "+rt.Path, rt.handle)
+		}
+	}
+	return mux
+}
+
+// Start listens on addr and serves in the background. It returns the bound address.
+func (s *Server) Start(addr string) (net.Addr, error) {
+	srv, bound, err := s.serve(addr, s.Handler(), "API")
+	if err != nil {
+		return nil, err
+	}
+	s.httpSrv = srv
+	return bound, nil
+}
+
+// StartMonitor serves MonitorHandler on addr in the background, separately
+// from the API so it can start before and stop after everything else.
+func (s *Server) StartMonitor(addr string) (net.Addr, error) {
+	srv, bound, err := s.serve(addr, s.MonitorHandler(), "monitoring")
+	if err != nil {
+		return nil, err
+	}
+	s.monitorSrv = srv
+	return bound, nil
+}
+
+func (s *Server) serve(addr string, h http.Handler, what string) (*http.Server, net.Addr, error) {
+	l, err := s.listen(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[string]net.Listener)
+	}
+	s.listeners[addr] = l
+	srv := &http.Server{
+		Handler:  h,
+		ErrorLog: log.New(logging.Writer("admin", logging.ErrorLevel), "", 0),
+	}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Error("[ADMIN] %s server stopped: %v", what, err)
+		}
+	}()
+	logging.Info("[ADMIN] %s listening on %s", what, l.Addr())
+	return srv, l.Addr(), nil
+}
+
+// listen binds addr, or takes the inherited socket for it.
+func (s *Server) listen(addr string) (net.Listener, error) {
+	key := "tcp://" + addr
+	f, ok := s.Inherited[key]
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	delete(s.Inherited, key)
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// ListenerFiles duplicates the listening sockets of the API, monitoring and
+// gRPC servers, by "tcp://host:port" address, to pass them to a process
+// replacing this one. The caller closes the files.
+func (s *Server) ListenerFiles() (map[string]*os.File, error) {
+	files := make(map[string]*os.File, len(s.listeners))
+	for addr, l := range s.listeners {
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files["tcp://"+addr] = f
+	}
+	return files, nil
+}
+
+// Shutdown stops the API server, waiting for in-flight requests.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpSrv == nil {
+		return nil
+	}
+	return s.httpSrv.Shutdown(ctx)
+}
+
+// ShutdownMonitor stops the monitoring server, waiting for in-flight requests.
+func (s *Server) ShutdownMonitor(ctx context.Context) error {
+	if s.monitorSrv == nil {
+		return nil
+	}
+	return s.monitorSrv.Shutdown(ctx)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	frozen, _ := s.Engine.Frozen()
+	writeJSON(w, http.StatusOK, adminclient.Status{
+		Version:   s.Version,
+		StartedAt: s.started,
+		Uptime:    time.Since(s.started).Round(time.Second).String(),
+		Listeners: s.Engine.ListenerCount(),
+		Backends:  len(s.Engine.CurrentConfig().Backends),
+		Drains:    s.drains(),
+		Frozen:    frozen,
+	})
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, adminclient.Health{
+		Status:   "ok",
+		Draining: s.Engine.Draining(),
+		Uptime:   time.Since(s.started).Round(time.Second).String(),
+	})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	draining := s.Engine.Draining()
+	status := http.StatusOK
+	if draining {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, adminclient.Readiness{Ready: !draining, Draining: draining})
+}
+
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultDrainTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "timeout must be a non-negative duration")
+			return
+		}
+		timeout = d
+	}
+
+	start := time.Now()
+	s.Engine.Drain()
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	remaining := s.Engine.WaitDrained(ctx)
+
+	logging.Info("[ADMIN] drain finished with %d connections remaining", remaining)
+	writeJSON(w, http.StatusOK, adminclient.DrainResult{
+		Drained:   remaining == 0,
+		Remaining: remaining,
+		Elapsed:   time.Since(start).Round(time.Millisecond).String(),
+	})
+}
+
+func (s *Server) handleBackends(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backends())
+}
+
+// backends returns the backends and the state of their servers, by name.
+func (s *Server) backends() []adminclient.Backend {
+	backends := s.Engine.CurrentConfig().Backends
+	out := make([]adminclient.Backend, 0, len(backends))
+	for _, be := range backends {
+		health := s.Engine.HealthStatus(be.Name)
+		history := s.Engine.HealthHistory(be.Name)
+		portsDown := s.Engine.PortsDown(be.Name)
+		resolved := s.Engine.ResolvedServers(be.Name)
+
+		servers := make([]adminclient.Server, 0, len(be.Servers))
+		for _, srv := range be.Servers {
+			healthy, probed := health[srv.Address]
+			if addrs, ok := resolved[srv.Address]; ok {
+				// Up while any of its addresses is
+				healthy, probed = false, false
+				for _, addr := range addrs {
+					h, p := health[addr]
+					healthy, probed = healthy || h || !p, true
+				}
+			}
+			servers = append(servers, adminclient.Server{
+				Address:   srv.Address,
+				Healthy:   healthy || !probed,
+				Weight:    s.Engine.ServerWeight(be.Name, srv.Address),
+				Backup:    srv.Backup,
+				Disabled:  srv.Disabled || s.Engine.ServerDisabled(be.Name, srv.Address),
+				State:     s.Engine.ServerState(be.Name, srv.Address),
+				Health:    toServerHealth(history, srv.Address),
+				PortsDown: portsDown[srv.Address],
+				Resolved:  resolved[srv.Address],
+			})
+		}
+		reason := s.Engine.DependencyDown(be.Name)
+		out = append(out, adminclient.Backend{
+			Name:      be.Name,
+			Balance:   be.Balance,
+			Servers:   servers,
+			Available: reason == "",
+			Reason:    reason,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func toServerHealth(history map[string]health.History, addr string) *adminclient.ServerHealth {
+	h, ok := history[addr]
+	if !ok {
+		return nil
+	}
+	return &adminclient.ServerHealth{
+		Since:           h.Since,
+		SinceSeconds:    h.InState.Seconds(),
+		Failures:        h.Failures,
+		Recoveries:      h.Recoveries,
+		DowntimeSeconds: h.Downtime.Seconds(),
+		UptimeSeconds:   h.Uptime.Seconds(),
+		MTTRSeconds:     h.MTTR.Seconds(),
+		MTBFSeconds:     h.MTBF.Seconds(),
+	}
+}
+
+func (s *Server) handleSetWeight(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.WeightRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	backend, server := r.PathValue("name"), r.PathValue("server")
+	if err := s.Engine.SetWeight(backend, server, req.Weight, req.Persist); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	healthy, probed := s.Engine.HealthStatus(backend)[server]
+	writeJSON(w, http.StatusOK, adminclient.Server{
+		Address: server,
+		Healthy: healthy || !probed,
+		Weight:  s.Engine.ServerWeight(backend, server),
+	})
+}
+
+func (s *Server) handleSetServerState(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.ServerStateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	backend, server := r.PathValue("name"), r.PathValue("server")
+	if err := s.Engine.SetServerState(backend, server, req.State); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+
+	healthy, probed := s.Engine.HealthStatus(backend)[server]
+	state := s.Engine.ServerState(backend, server)
+	writeJSON(w, http.StatusOK, adminclient.Server{
+		Address:  server,
+		Healthy:  healthy || !probed,
+		Weight:   s.Engine.ServerWeight(backend, server),
+		Disabled: state != config.ServerReady,
+		State:    state,
+	})
+}
+
+// handleHints applies the hints of a request body that stays open for as long
+// as the controller pushes them, answering each on the response stream as
+// soon as it is applied. The request body is read while the response is
+// written, which HTTP/1 clients must be willing to do. The freeze is checked
+// for every hint, as the stream may have opened before it.
+func (s *Server) handleHints(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	dec := json.NewDecoder(r.Body)
+	enc := json.NewEncoder(w)
+	for seq := 1; ; seq++ {
+		var h adminclient.Hint
+		err := dec.Decode(&h)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		res := adminclient.HintResult{Seq: seq}
+		if err != nil {
+			res.Error = "invalid hint: " + err.Error()
+		} else if err := s.applyHint(h, "admin API client "+r.RemoteAddr); err != nil {
+			res.Error = err.Error()
+		}
+		if enc.Encode(res) != nil || rc.Flush() != nil || err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) applyHint(h adminclient.Hint, by string) error {
+	if h.Weight == nil && h.Healthy == nil {
+		return errors.New("hint sets neither weight nor healthy")
+	}
+	if err := s.Engine.CheckFrozen("hint for "+h.Backend+" "+h.Server, by); err != nil {
+		return err
+	}
+	if h.Weight != nil {
+		if err := s.Engine.SetWeight(h.Backend, h.Server, *h.Weight, false); err != nil {
+			return err
+		}
+	}
+	if h.Healthy != nil {
+		return s.Engine.SetHealth(h.Backend, h.Server, *h.Healthy)
+	}
+	return nil
+}
+
+func (s *Server) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	plan, err := s.Engine.RebalancePlan(r.PathValue("name"))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	out := adminclient.RebalancePlan{
+		Backend:     plan.Backend,
+		Connections: plan.Connections,
+		Servers:     make([]adminclient.ServerLoad, 0, len(plan.Servers)),
+	}
+	for _, sl := range plan.Servers {
+		out.Servers = append(out.Servers, adminclient.ServerLoad{
+			Address:     sl.Server,
+			Weight:      sl.Weight,
+			Connections: sl.Connections,
+			FairShare:   sl.Fair,
+			Close:       sl.Close,
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	limit := defaultMemoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	consumers := s.Engine.TopMemoryConsumers(limit)
+	out := make([]adminclient.ConnMemory, 0, len(consumers))
+	for _, c := range consumers {
+		out = append(out, adminclient.ConnMemory{Listener: c.Listener, Client: c.Client, Buffered: c.Buffered})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleShedding(w http.ResponseWriter, r *http.Request) {
+	out := adminclient.Shedding{Shed: map[string]int64{}}
+	if sh := s.Engine.Shedder; sh != nil {
+		st := sh.Stats()
+		out = adminclient.Shedding{
+			Enabled: true,
+			Active:  st.Active,
+			Pressure: adminclient.Pressure{
+				CPULoad:       st.Pressure.CPULoad,
+				MemoryPercent: st.Pressure.MemoryPercent,
+				FDPercent:     st.Pressure.FDPercent,
+			},
+			Shed:  st.Shed,
+			Total: st.Total,
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleAcceptQueues(w http.ResponseWriter, r *http.Request) {
+	qs, err := s.Engine.AcceptQueues()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := adminclient.AcceptQueues{
+		Supported: qs.Supported,
+		Overflows: qs.Overflows,
+		Drops:     qs.Drops,
+		Listeners: make([]adminclient.AcceptQueue, 0, len(qs.Listeners)),
+	}
+	for _, q := range qs.Listeners {
+		out.Listeners = append(out.Listeners, adminclient.AcceptQueue(q))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	st := s.Engine.Stats()
+	out := adminclient.Stats{
+		Since:       st.Since,
+		Connections: st.Connections,
+		Backends:    make(map[string]adminclient.BackendTraffic, len(st.Backends)),
+		Hellos:      adminclient.HelloStats(st.Hellos),
+	}
+	for name, b := range st.Backends {
+		out.Backends[name] = adminclient.BackendTraffic(b)
+	}
+	if len(st.Backpressure) > 0 {
+		out.Backpressure = make(map[string]map[string]adminclient.BackpressureStats, len(st.Backpressure))
+		for listener, backends := range st.Backpressure {
+			out.Backpressure[listener] = make(map[string]adminclient.BackpressureStats, len(backends))
+			for name, b := range backends {
+				out.Backpressure[listener][name] = adminclient.BackpressureStats(b)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleGetLogging(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, toLogLevels(logging.Levels()))
+}
+
+func (s *Server) handleSetLogging(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.LogLevelRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Level == "" && len(req.Components) == 0 {
+		writeError(w, http.StatusBadRequest, "level or components is required")
+		return
+	}
+
+	var global *logging.Level
+	if req.Level != "" {
+		lvl, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		global = &lvl
+	}
+	comps := make(map[string]logging.Level, len(req.Components))
+	for name, v := range req.Components {
+		if v == "inherit" {
+			comps[name] = logging.Inherit
+			continue
+		}
+		lvl, err := logging.ParseLevel(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "component "+name+": "+err.Error())
+			return
+		}
+		comps[name] = lvl
+	}
+
+	revert := defaultLevelRevert
+	d := req.Duration
+	if d == "" {
+		d = s.Engine.CurrentConfig().Logging.LevelRevert
+	}
+	if d != "" {
+		var err error
+		if revert, err = time.ParseDuration(d); err != nil || revert < 0 {
+			writeError(w, http.StatusBadRequest, "duration must be a non-negative duration")
+			return
+		}
+	}
+
+	st := logging.SetLevels(global, comps, revert)
+	logging.Warn("[ADMIN] log levels changed to %s %v (revert after %s)", st.Level, st.Components, revert)
+	writeJSON(w, http.StatusOK, toLogLevels(st))
+}
+
+func (s *Server) handleResetLogging(w http.ResponseWriter, r *http.Request) {
+	if logging.ResetLevels() {
+		logging.Warn("[ADMIN] temporary log levels reverted")
+	}
+	writeJSON(w, http.StatusOK, toLogLevels(logging.Levels()))
+}
+
+func toLogLevels(st logging.LevelState) adminclient.LogLevels {
+	out := adminclient.LogLevels{Level: st.Level.String(), Components: make(map[string]string, len(st.Components))}
+	for name, lvl := range st.Components {
+		out.Components[name] = lvl.String()
+	}
+	if !st.RevertAt.IsZero() {
+		at := st.RevertAt
+		out.RevertAt = &at
+	}
+	return out
+}
+
+func (s *Server) handleGetState(w http.ResponseWriter, r *http.Request) {
+	cfg := s.Engine.CurrentConfig()
+	writeJSON(w, http.StatusOK, adminclient.State{Listeners: cfg.Listeners, Backends: cfg.Backends})
+}
+
+func (s *Server) handlePutState(w http.ResponseWriter, r *http.Request) {
+	// YAML is a superset of JSON, so one decoder serves both content types.
+	var state adminclient.State
+	dec := yaml.NewDecoder(http.MaxBytesReader(w, r.Body, maxStateBody))
+	dec.KnownFields(true)
+	if err := dec.Decode(&state); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid state document: "+err.Error())
+		return
+	}
+
+	for i := range state.Listeners {
+		if err := state.Listeners[i].ResolveSecrets(); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+	changes, err := s.Engine.Apply(state.Listeners, state.Backends)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, applyResult(changes))
+}
+
+func (s *Server) handleAddListener(w http.ResponseWriter, r *http.Request) {
+	var l config.Listener
+	dec := yaml.NewDecoder(http.MaxBytesReader(w, r.Body, maxStateBody))
+	dec.KnownFields(true)
+	if err := dec.Decode(&l); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid listener: "+err.Error())
+		return
+	}
+	if err := l.ResolveSecrets(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	changes, err := s.Engine.AddListener(l)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, applyResult(changes))
+}
+
+func (s *Server) handleRemoveListener(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.Engine.RemoveListener(r.PathValue("name"))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, applyResult(changes))
+}
+
+// applyResult logs and reports the changes made to the running state.
+func applyResult(changes []core.Change) adminclient.ApplyResult {
+	out := adminclient.ApplyResult{Changes: make([]adminclient.Change, 0, len(changes))}
+	for _, c := range changes {
+		logging.Info("[ADMIN] %s %s %s", c.Kind, c.Name, c.Action)
+		out.Changes = append(out.Changes, adminclient.Change{Kind: c.Kind, Name: c.Name, Action: c.Action})
+	}
+	return out
+}
+
+func (s *Server) handleSwapBackend(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.SwapRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	drain, ok := parseDrain(w, req.DrainTimeout)
+	if !ok {
+		return
+	}
+
+	sw, err := s.Engine.SwapBackend(r.PathValue("name"), req.Backend, drain)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSwap(*sw))
+}
+
+func (s *Server) handleSwapListeners(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.SwapListenersRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Listeners) != 2 {
+		writeError(w, http.StatusBadRequest, "listeners must name exactly two listeners")
+		return
+	}
+	drain, ok := parseDrain(w, req.DrainTimeout)
+	if !ok {
+		return
+	}
+
+	swaps, err := s.Engine.SwapListeners(req.Listeners[0], req.Listeners[1], drain)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	out := make([]adminclient.Swap, 0, len(swaps))
+	for _, sw := range swaps {
+		out = append(out, toSwap(sw))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleSetTrace(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.TraceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Sample < 0 || req.Sample > 1 {
+		writeError(w, http.StatusBadRequest, "sample must be between 0 and 1")
+		return
+	}
+
+	tr, err := s.Engine.SetTrace(r.PathValue("name"), req.Enabled, req.Sample)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, adminclient.Trace{Listener: tr.Listener, Enabled: tr.Enabled, Sample: tr.Sample})
+}
+
+func (s *Server) handleDrains(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.drains())
+}
+
+func (s *Server) handleAccelerateDrain(w http.ResponseWriter, r *http.Request) {
+	id, ok := drainID(w, r)
+	if !ok {
+		return
+	}
+	n, err := s.Engine.AccelerateDrain(id)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, adminclient.DrainAccelerated{Closed: n})
+}
+
+func (s *Server) handleCancelDrain(w http.ResponseWriter, r *http.Request) {
+	id, ok := drainID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Engine.CancelDrain(id); err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.drains())
+}
+
+func drainID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid drain id")
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) drains() []adminclient.Drain {
+	drains := s.Engine.Drains()
+	out := make([]adminclient.Drain, 0, len(drains))
+	for _, d := range drains {
+		ad := adminclient.Drain{
+			ID:        d.ID,
+			Kind:      d.Kind,
+			Listener:  d.Listener,
+			Backend:   d.Backend,
+			Server:    d.Server,
+			Remaining: d.Remaining,
+			Started:   d.Started,
+			Elapsed:   s.Engine.Clock.Since(d.Started).Round(time.Millisecond).String(),
+		}
+		if !d.Deadline.IsZero() {
+			deadline := d.Deadline
+			ad.Deadline = &deadline
+		}
+		out = append(out, ad)
+	}
+	return out
+}
+
+func toSwap(sw core.Swap) adminclient.Swap {
+	return adminclient.Swap{Listener: sw.Listener, Previous: sw.Previous, Backend: sw.Backend, Draining: sw.Draining}
+}
+
+func parseDrain(w http.ResponseWriter, v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		writeError(w, http.StatusBadRequest, "invalid drain_timeout")
+		return 0, false
+	}
+	return d, true
+}
+
+// readJSON decodes the request body into v, answering 400 on failure.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeEngineError maps engine errors to HTTP statuses.
+func (s *Server) handleGetFreeze(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.freeze())
+}
+
+func (s *Server) handleSetFreeze(w http.ResponseWriter, r *http.Request) {
+	var req adminclient.FreezeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	s.Engine.SetFrozen(req.Frozen, "admin API client "+r.RemoteAddr)
+	writeJSON(w, http.StatusOK, s.freeze())
+}
+
+func (s *Server) freeze() adminclient.Freeze {
+	frozen, since := s.Engine.Frozen()
+	out := adminclient.Freeze{Frozen: frozen}
+	if frozen {
+		out.Since = &since
+	}
+	return out
+}
+
+func writeEngineError(w http.ResponseWriter, err error) {
+	status := http.StatusUnprocessableEntity
+	switch {
+	case errors.Is(err, core.ErrUnknownListener), errors.Is(err, core.ErrUnknownBackend), errors.Is(err, lb.ErrUnknownServer),
+		errors.Is(err, core.ErrUnknownDrain):
+		status = http.StatusNotFound
+	case errors.Is(err, lb.ErrInvalidWeight), errors.Is(err, core.ErrInvalidServerState):
+		status = http.StatusBadRequest
+	case errors.Is(err, core.ErrListenerExists):
+		status = http.StatusConflict
+	case errors.Is(err, core.ErrFrozen):
+		status = http.StatusLocked
+	}
+	writeError(w, status, err.Error())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, adminclient.Error{Error: msg})
+}
@@ -0,0 +1,635 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/adminclient"
+	"nvelox/config"
+	"nvelox/core"
+	"nvelox/core/logging"
+	"nvelox/lb"
+)
+
+func init() {
+	logging.Init("debug", "", "")
+}
+
+func newTestServer(t *testing.T) (*adminclient.Client, *core.Engine) {
+	cfg := &config.Config{
+		Version: "2",
+		Backends: []config.Backend{
+			{Name: "web", Balance: "roundrobin", Servers: []config.Server{{Address: "10.0.0.1:80"}, {Address: "10.0.0.2:80"}}},
+		},
+	}
+	engine := core.NewEngine(cfg)
+	engine.Listeners = []*core.ListenerConfig{{Name: "l1", Protocol: "tcp", Port: 80}}
+
+	srv := NewServer(engine, "v-test")
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return adminclient.New(ts.URL), engine
+}
+
+func TestStatus(t *testing.T) {
+	client, _ := newTestServer(t)
+
+	st, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if st.Version != "v-test" || st.Listeners != 1 || st.Backends != 1 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestMonitorHandler(t *testing.T) {
+	engine := core.NewEngine(&config.Config{Version: "2"})
+	srv := NewServer(engine, "v-test")
+	ts := httptest.NewServer(srv.MonitorHandler())
+	t.Cleanup(ts.Close)
+	client := adminclient.New(ts.URL)
+	ctx := context.Background()
+
+	if _, err := client.Stats(ctx); err != nil {
+		t.Errorf("Stats on the monitoring handler: %v", err)
+	}
+	// Alive while the datapath drains, which only readiness reports
+	engine.Drain()
+	if h, err := client.Health(ctx); err != nil || h.Status != "ok" || !h.Draining {
+		t.Errorf("Health while draining = %+v, %v", h, err)
+	}
+	if _, err := client.Ready(ctx); err == nil {
+		t.Error("expected readiness to fail while draining")
+	}
+
+	// Nothing that changes state
+	var apiErr *adminclient.APIError
+	if _, err := client.Drain(ctx, time.Second); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Drain on the monitoring handler: %v", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	engine := core.NewEngine(&config.Config{Version: "2"})
+	srv := NewServer(engine, "v-test")
+	srv.Token = "0123456789abcdef"
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	client := adminclient.New(ts.URL)
+	ctx := context.Background()
+
+	var apiErr *adminclient.APIError
+	for _, token := range []string{"", "0123456789abcdeX"} {
+		client.Token = token
+		if _, err := client.Status(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: %v, want 401", token, err)
+		}
+	}
+	client.Token = srv.Token
+	if _, err := client.Status(ctx); err != nil {
+		t.Errorf("Status with the token: %v", err)
+	}
+	stream, err := client.StreamHints(ctx)
+	if err != nil {
+		t.Fatalf("StreamHints with the token: %v", err)
+	}
+	stream.Close()
+
+	// The monitoring routes stay open
+	mon := httptest.NewServer(srv.MonitorHandler())
+	t.Cleanup(mon.Close)
+	if _, err := adminclient.New(mon.URL).Health(ctx); err != nil {
+		t.Errorf("Health on the monitoring handler: %v", err)
+	}
+}
+
+func TestInheritedListeners(t *testing.T) {
+	engine := core.NewEngine(&config.Config{Version: "2"})
+	old := NewServer(engine, "v-old")
+	addr, err := old.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	files, err := old.ListenerFiles()
+	if err != nil || files["tcp://127.0.0.1:0"] == nil {
+		t.Fatalf("ListenerFiles = %v, %v", files, err)
+	}
+	old.Shutdown(context.Background())
+
+	next := NewServer(engine, "v-next")
+	next.Inherited = files
+	bound, err := next.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Start on the inherited socket failed: %v", err)
+	}
+	defer next.Shutdown(context.Background())
+	if bound.String() != addr.String() || len(files) != 0 {
+		t.Errorf("bound %s instead of the inherited %s", bound, addr)
+	}
+	st, err := adminclient.New("http://" + addr.String()).Status(context.Background())
+	if err != nil || st.Version != "v-next" {
+		t.Errorf("Status = %+v, %v", st, err)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	client, _ := newTestServer(t)
+
+	backends, err := client.Backends(context.Background())
+	if err != nil {
+		t.Fatalf("Backends failed: %v", err)
+	}
+	if len(backends) != 1 || backends[0].Name != "web" {
+		t.Fatalf("unexpected backends: %+v", backends)
+	}
+	if len(backends[0].Servers) != 2 || !backends[0].Servers[0].Healthy {
+		t.Errorf("expected 2 healthy servers, got %+v", backends[0].Servers)
+	}
+}
+
+func TestMemoryConsumers(t *testing.T) {
+	client, _ := newTestServer(t)
+
+	out, err := client.MemoryConsumers(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("MemoryConsumers failed: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected no connections, got %+v", out)
+	}
+
+	_, err = client.MemoryConsumers(context.Background(), -1)
+	if err != nil {
+		t.Fatalf("negative limit should be omitted by the client: %v", err)
+	}
+}
+
+func TestAcceptQueues(t *testing.T) {
+	client, _ := newTestServer(t)
+
+	out, err := client.AcceptQueues(context.Background())
+	if err != nil {
+		t.Fatalf("AcceptQueues failed: %v", err)
+	}
+	// l1 is not bound, so it reports no sockets where queues are supported
+	if out.Supported && (len(out.Listeners) != 1 || out.Listeners[0].Sockets != 0) {
+		t.Errorf("unexpected queues: %+v", out)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	client, _ := newTestServer(t)
+
+	resp, err := http.Get(client.BaseURL + "/api/v1/connections/memory?limit=abc")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body adminclient.Error
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusBadRequest || body.Error == "" {
+		t.Errorf("expected 400 with error body, got %d %+v", resp.StatusCode, body)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	client := adminclient.New("http://127.0.0.1:0")
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	client.BaseURL = ts.URL
+
+	_, err := client.Status(context.Background())
+	var apiErr *adminclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %v", err)
+	}
+}
+
+func TestApplyState(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+
+	state, err := client.State(ctx)
+	if err != nil {
+		t.Fatalf("State failed: %v", err)
+	}
+
+	// Re-applying the current state is a no-op
+	res, err := client.ApplyState(ctx, *state)
+	if err != nil {
+		t.Fatalf("ApplyState failed: %v", err)
+	}
+	if len(res.Changes) != 0 {
+		t.Errorf("expected no changes, got %+v", res.Changes)
+	}
+
+	state.Backends[0].Servers = []config.Server{{Address: "10.0.0.3:80"}}
+	state.Backends = append(state.Backends, config.Backend{Name: "api", Servers: []config.Server{{Address: "10.0.1.1:80"}}})
+	res, err = client.ApplyState(ctx, *state)
+	if err != nil {
+		t.Fatalf("ApplyState failed: %v", err)
+	}
+	want := []adminclient.Change{
+		{Kind: "backend", Name: "web", Action: "updated"},
+		{Kind: "backend", Name: "api", Action: "added"},
+	}
+	if len(res.Changes) != len(want) || res.Changes[0] != want[0] || res.Changes[1] != want[1] {
+		t.Errorf("changes = %+v, want %+v", res.Changes, want)
+	}
+	if got := engine.CurrentConfig().Backends; len(got) != 2 || got[0].Servers[0].Address != "10.0.0.3:80" {
+		t.Errorf("config not updated: %+v", got)
+	}
+}
+
+func TestApplyState_Invalid(t *testing.T) {
+	client, engine := newTestServer(t)
+
+	_, err := client.ApplyState(context.Background(), adminclient.State{
+		Listeners: []config.Listener{{Name: "l", Bind: config.Binds{":8080"}, DefaultBackend: "missing"}},
+	})
+	var apiErr *adminclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 APIError, got %v", err)
+	}
+	if len(engine.CurrentConfig().Backends) != 1 {
+		t.Error("failed apply changed the config")
+	}
+}
+
+func TestApplyState_JSONBody(t *testing.T) {
+	_, engine := newTestServer(t)
+	srv := NewServer(engine, "v-test")
+
+	body := `{"backends": [{"name": "web", "servers": ["10.0.0.9:80"], "send_proxy_v2": true}]}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/state", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if be := engine.CurrentConfig().Backends[0]; !be.SendsProxyV2() {
+		t.Errorf("expected snake_case JSON fields to apply, got %+v", be)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/state", strings.NewReader(`{"backendz": []}`))
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAddRemoveListener(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+	t.Cleanup(engine.Stop)
+
+	l := config.Listener{Name: "game", Bind: config.Binds{"127.0.0.1:0"}, DefaultBackend: "web"}
+	res, err := client.AddListener(ctx, l)
+	if err != nil {
+		t.Fatalf("AddListener failed: %v", err)
+	}
+	if len(res.Changes) != 1 || res.Changes[0] != (adminclient.Change{Kind: "listener", Name: "game", Action: "added"}) {
+		t.Errorf("changes = %+v", res.Changes)
+	}
+	var apiErr *adminclient.APIError
+	if _, err := client.AddListener(ctx, l); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 APIError adding it twice, got %v", err)
+	}
+
+	res, err = client.RemoveListener(ctx, "game")
+	if err != nil {
+		t.Fatalf("RemoveListener failed: %v", err)
+	}
+	if len(res.Changes) != 1 || res.Changes[0].Action != "removed" {
+		t.Errorf("changes = %+v", res.Changes)
+	}
+	if _, err := client.RemoveListener(ctx, "game"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError removing it twice, got %v", err)
+	}
+}
+
+func TestSwapBackend(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+
+	state, _ := client.State(ctx)
+	state.Backends = append(state.Backends, config.Backend{Name: "green", Servers: []config.Server{{Address: "10.0.2.1:80"}}})
+	state.Listeners = []config.Listener{{Name: "prod", Bind: config.Binds{"127.0.0.1:0"}, DefaultBackend: "web"}}
+	if _, err := engine.Apply(state.Listeners, state.Backends); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+
+	sw, err := client.SwapBackend(ctx, "prod", adminclient.SwapRequest{Backend: "green", DrainTimeout: "30s"})
+	if err != nil {
+		t.Fatalf("SwapBackend failed: %v", err)
+	}
+	if sw.Previous != "web" || sw.Backend != "green" {
+		t.Errorf("unexpected swap: %+v", sw)
+	}
+
+	_, err = client.SwapBackend(ctx, "missing", adminclient.SwapRequest{Backend: "green"})
+	var apiErr *adminclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %v", err)
+	}
+
+	_, err = client.SwapListeners(ctx, adminclient.SwapListenersRequest{Listeners: []string{"prod"}})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 APIError, got %v", err)
+	}
+}
+
+func TestSetTrace(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+
+	state, _ := client.State(ctx)
+	state.Listeners = []config.Listener{{Name: "prod", Bind: config.Binds{"127.0.0.1:0"}, DefaultBackend: "web"}}
+	if _, err := engine.Apply(state.Listeners, state.Backends); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	t.Cleanup(engine.Stop)
+
+	tr, err := client.SetTrace(ctx, "prod", adminclient.TraceRequest{Enabled: true, Sample: 0.25})
+	if err != nil {
+		t.Fatalf("SetTrace failed: %v", err)
+	}
+	if !tr.Enabled || tr.Sample != 0.25 {
+		t.Errorf("unexpected trace: %+v", tr)
+	}
+	if l := engine.CurrentConfig().Listeners[0]; !l.TraceConnections || l.TraceSample != 0.25 {
+		t.Errorf("config not updated: %+v", l)
+	}
+
+	var apiErr *adminclient.APIError
+	if _, err = client.SetTrace(ctx, "missing", adminclient.TraceRequest{Enabled: true}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %v", err)
+	}
+	if _, err = client.SetTrace(ctx, "prod", adminclient.TraceRequest{Enabled: true, Sample: 2}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 APIError, got %v", err)
+	}
+}
+
+func TestDrains(t *testing.T) {
+	client, _ := newTestServer(t)
+	ctx := context.Background()
+
+	if drains, err := client.Drains(ctx); err != nil || len(drains) != 0 {
+		t.Errorf("expected no drains, got %+v, %v", drains, err)
+	}
+	if st, err := client.Status(ctx); err != nil || st.Drains == nil || len(st.Drains) != 0 {
+		t.Errorf("expected an empty drain list in the status, got %+v, %v", st, err)
+	}
+
+	var apiErr *adminclient.APIError
+	if _, err := client.AccelerateDrain(ctx, 1); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %v", err)
+	}
+	if _, err := client.CancelDrain(ctx, 1); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %v", err)
+	}
+	resp, err := http.Post(client.BaseURL+"/api/v1/drains/x/accelerate", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d for an invalid id, want 400", resp.StatusCode)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+
+	if r, err := client.Ready(ctx); err != nil || !r.Ready {
+		t.Fatalf("expected ready before drain, got %+v, %v", r, err)
+	}
+
+	res, err := client.Drain(ctx, time.Second)
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if !res.Drained || res.Remaining != 0 {
+		t.Errorf("unexpected drain result: %+v", res)
+	}
+	if !engine.Draining() {
+		t.Error("expected engine to be draining")
+	}
+
+	_, err = client.Ready(ctx)
+	var apiErr *adminclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %v", err)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+	engine.Balancers["web"] = lb.NewBalancer("roundrobin", []string{"10.0.0.1:80", "10.0.0.2:80"})
+
+	f, err := client.SetFrozen(ctx, true)
+	if err != nil {
+		t.Fatalf("SetFrozen failed: %v", err)
+	}
+	if !f.Frozen || f.Since == nil {
+		t.Errorf("unexpected freeze: %+v", f)
+	}
+	if st, _ := client.Status(ctx); !st.Frozen {
+		t.Error("status does not report the freeze")
+	}
+
+	// Changes are refused, reads still served
+	_, err = client.SetWeight(ctx, "web", "10.0.0.1:80", adminclient.WeightRequest{Weight: 0})
+	var apiErr *adminclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusLocked {
+		t.Errorf("expected 423 while frozen, got %v", err)
+	}
+	if _, err := client.Backends(ctx); err != nil {
+		t.Errorf("Backends while frozen: %v", err)
+	}
+	if w := engine.ServerWeight("web", "10.0.0.1:80"); w != lb.DefaultWeight {
+		t.Errorf("weight changed while frozen: %d", w)
+	}
+
+	f, err = client.SetFrozen(ctx, false)
+	if err != nil || f.Frozen || f.Since != nil {
+		t.Fatalf("thaw: %+v, %v", f, err)
+	}
+	if _, err := client.SetWeight(ctx, "web", "10.0.0.1:80", adminclient.WeightRequest{Weight: 0}); err != nil {
+		t.Errorf("SetWeight after thaw: %v", err)
+	}
+}
+
+func TestSetWeight(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+	engine.Balancers["web"] = lb.NewBalancer("roundrobin", []string{"10.0.0.1:80", "10.0.0.2:80"})
+
+	srv, err := client.SetWeight(ctx, "web", "10.0.0.1:80", adminclient.WeightRequest{Weight: 0})
+	if err != nil {
+		t.Fatalf("SetWeight failed: %v", err)
+	}
+	if srv.Weight != 0 {
+		t.Errorf("weight = %d, want 0", srv.Weight)
+	}
+
+	backends, _ := client.Backends(ctx)
+	if w := backends[0].Servers[0].Weight; w != 0 {
+		t.Errorf("backends weight = %d, want 0", w)
+	}
+	if w := backends[0].Servers[1].Weight; w != lb.DefaultWeight {
+		t.Errorf("untouched weight = %d, want %d", w, lb.DefaultWeight)
+	}
+
+	var apiErr *adminclient.APIError
+	_, err = client.SetWeight(ctx, "web", "10.0.0.1:80", adminclient.WeightRequest{Weight: 300})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for out of range weight, got %v", err)
+	}
+	_, err = client.SetWeight(ctx, "web", "10.9.9.9:80", adminclient.WeightRequest{Weight: 1})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown server, got %v", err)
+	}
+}
+
+func TestSetServerState(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+	engine.Balancers["web"] = lb.NewPool("roundrobin", []lb.Server{{Address: "10.0.0.1:80"}, {Address: "10.0.0.2:80"}})
+	engine.Backends["web"] = &engine.CurrentConfig().Backends[0]
+
+	srv, err := client.SetServerState(ctx, "web", "10.0.0.1:80", adminclient.ServerStateRequest{State: "maint"})
+	if err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+	if srv.State != "maint" || !srv.Disabled {
+		t.Errorf("server = %+v, want disabled in maint", srv)
+	}
+	backends, _ := client.Backends(ctx)
+	if got := backends[0].Servers; got[0].State != "maint" || got[1].State != "ready" {
+		t.Errorf("backends states = %s, %s", got[0].State, got[1].State)
+	}
+
+	var apiErr *adminclient.APIError
+	_, err = client.SetServerState(ctx, "web", "10.0.0.1:80", adminclient.ServerStateRequest{State: "down"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown state, got %v", err)
+	}
+	_, err = client.SetServerState(ctx, "web", "10.9.9.9:80", adminclient.ServerStateRequest{State: "drain"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown server, got %v", err)
+	}
+}
+
+func TestStreamHints(t *testing.T) {
+	client, engine := newTestServer(t)
+	ctx := context.Background()
+	engine.Balancers["web"] = lb.NewBalancer("roundrobin", []string{"10.0.0.1:80", "10.0.0.2:80"})
+	engine.Backends["web"] = &engine.CurrentConfig().Backends[0]
+
+	stream, err := client.StreamHints(ctx)
+	if err != nil {
+		t.Fatalf("StreamHints failed: %v", err)
+	}
+	defer stream.Close()
+
+	weight, down := 7, false
+	hints := []adminclient.Hint{
+		{Backend: "web", Server: "10.0.0.1:80", Weight: &weight},
+		{Backend: "web", Server: "10.0.0.2:80", Healthy: &down},
+		{Backend: "web", Server: "10.9.9.9:80", Weight: &weight},
+		{Backend: "web", Server: "10.0.0.1:80"},
+	}
+	for i, h := range hints {
+		// Each result arrives while the stream stays open
+		if err := stream.Send(h); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if res.Seq != i+1 {
+			t.Errorf("seq = %d, want %d", res.Seq, i+1)
+		}
+		if failed := res.Error != ""; failed != (i >= 2) {
+			t.Errorf("hint %d: unexpected result %+v", i+1, res)
+		}
+	}
+
+	if w := engine.ServerWeight("web", "10.0.0.1:80"); w != 7 {
+		t.Errorf("weight = %d, want 7", w)
+	}
+	for i := 0; i < 4; i++ {
+		if s, _ := engine.Balancers["web"].Next(); s != "10.0.0.1:80" {
+			t.Fatalf("server marked down picked")
+		}
+	}
+
+	// A freeze applies to the stream already open
+	engine.SetFrozen(true, "test")
+	weight = 3
+	if err := stream.Send(hints[0]); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if !strings.Contains(res.Error, core.ErrFrozen.Error()) {
+		t.Errorf("hint while frozen: %+v", res)
+	}
+	if w := engine.ServerWeight("web", "10.0.0.1:80"); w != 7 {
+		t.Errorf("weight changed while frozen: %d", w)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	client, _ := newTestServer(t)
+	ctx := context.Background()
+	t.Cleanup(func() { logging.Init("debug", "", "") })
+
+	lv, err := client.SetLogLevels(ctx, adminclient.LogLevelRequest{
+		Level:      "error",
+		Components: map[string]string{"health": "debug"},
+		Duration:   "1h",
+	})
+	if err != nil {
+		t.Fatalf("SetLogLevels failed: %v", err)
+	}
+	if lv.Level != "error" || lv.Components["health"] != "debug" || lv.RevertAt == nil {
+		t.Errorf("unexpected levels: %+v", lv)
+	}
+
+	lv, err = client.ResetLogLevels(ctx)
+	if err != nil {
+		t.Fatalf("ResetLogLevels failed: %v", err)
+	}
+	if lv.Level != "debug" || len(lv.Components) != 0 || lv.RevertAt != nil {
+		t.Errorf("levels not reverted: %+v", lv)
+	}
+
+	var apiErr *adminclient.APIError
+	_, err = client.SetLogLevels(ctx, adminclient.LogLevelRequest{Level: "verbose"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown level, got %v", err)
+	}
+	_, err = client.SetLogLevels(ctx, adminclient.LogLevelRequest{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for empty request, got %v", err)
+	}
+}
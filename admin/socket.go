@@ -0,0 +1,309 @@
+package admin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+// socketIdle closes control socket connections that send no command for
+// this long.
+const socketIdle = 5 * time.Minute
+
+// socketHelp lists the control socket commands.
+const socketHelp = `show info                           version, uptime and counts
+show backends                       servers with their status and weight
+show sessions                       open TCP connections
+disable server <backend>/<server>   drain a server: no new connections
+enable server <backend>/<server>    make it ready again
+set weight <backend>/<server> <n>   change its weight, 0-256
+set server <backend>/<server> weight <n>
+                                    the same, as HAProxy spells it
+set server <backend>/<server> state <ready|drain|maint>
+                                    change its administrative state
+help                                this list
+quit                                close the connection`
+
+// controlSocket serves the runtime commands of the admin API as text over a
+// unix socket, one command per line, in the spirit of the HAProxy stats
+// socket. Each answer ends with an empty line.
+type controlSocket struct {
+	l    net.Listener
+	path string
+	info os.FileInfo // the socket file we created, see close
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	done  bool
+}
+
+// StartSocket serves the control socket at path in the background. A stale
+// socket file left at path is replaced; the socket is only accessible to
+// the user nvelox runs as.
+func (s *Server) StartSocket(path string) error {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// A process replacing this one binds path anew; ours must not remove
+	// its socket on the way out
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	info, err := os.Stat(path)
+	if err == nil {
+		err = os.Chmod(path, 0o600)
+	}
+	if err != nil {
+		l.Close()
+		os.Remove(path)
+		return err
+	}
+
+	cs := &controlSocket{l: l, path: path, info: info, conns: make(map[net.Conn]struct{})}
+	s.socket = cs
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logging.Error("[ADMIN] control socket stopped: %v", err)
+				}
+				return
+			}
+			if !cs.track(conn) {
+				conn.Close()
+				return
+			}
+			go func() {
+				defer cs.untrack(conn)
+				s.serveSocket(conn)
+			}()
+		}
+	}()
+	logging.Info("[ADMIN] control socket listening on %s", path)
+	return nil
+}
+
+// ShutdownSocket closes the control socket and its connections, and removes
+// the socket file unless another process has replaced it.
+func (s *Server) ShutdownSocket() error {
+	if s.socket == nil {
+		return nil
+	}
+	return s.socket.close()
+}
+
+func (cs *controlSocket) track(conn net.Conn) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.done {
+		return false
+	}
+	cs.conns[conn] = struct{}{}
+	return true
+}
+
+func (cs *controlSocket) untrack(conn net.Conn) {
+	cs.mu.Lock()
+	delete(cs.conns, conn)
+	cs.mu.Unlock()
+	conn.Close()
+}
+
+func (cs *controlSocket) close() error {
+	cs.mu.Lock()
+	cs.done = true
+	for conn := range cs.conns {
+		conn.Close()
+	}
+	cs.mu.Unlock()
+	err := cs.l.Close()
+	if fi, serr := os.Stat(cs.path); serr == nil && os.SameFile(fi, cs.info) {
+		os.Remove(cs.path)
+	}
+	return err
+}
+
+// serveSocket answers the commands of one connection until the client
+// closes it or quits.
+func (s *Server) serveSocket(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(socketIdle))
+		line, err := r.ReadString('\n')
+		if cmd := strings.TrimSpace(line); cmd != "" {
+			if cmd == "quit" {
+				return
+			}
+			w := bufio.NewWriter(conn)
+			if cerr := s.command(w, strings.Fields(cmd)); cerr != nil {
+				fmt.Fprintf(w, "error: %v\n", cerr)
+			}
+			w.WriteString("\n")
+			if w.Flush() != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// socketCommand is a control socket command, by its first one or two words.
+// Every command is refused while the configuration is frozen unless marked
+// readOnly.
+type socketCommand struct {
+	readOnly bool
+	run      func(s *Server, w io.Writer, args []string) error
+}
+
+var socketCommands = map[string]socketCommand{
+	"help": {readOnly: true, run: func(s *Server, w io.Writer, args []string) error {
+		fmt.Fprintln(w, socketHelp)
+		return nil
+	}},
+	"show info": {readOnly: true, run: func(s *Server, w io.Writer, args []string) error {
+		frozen, _ := s.Engine.Frozen()
+		fmt.Fprintf(w, "version: %s\nuptime: %s\nlisteners: %d\nbackends: %d\nconnections: %d\ndraining: %v\nfrozen: %v\n",
+			s.Version, time.Since(s.started).Round(time.Second), s.Engine.ListenerCount(),
+			len(s.Engine.CurrentConfig().Backends), len(s.Engine.Connections()), s.Engine.Draining(), frozen)
+		return nil
+	}},
+	"show backends": {readOnly: true, run: func(s *Server, w io.Writer, args []string) error {
+		s.showBackends(w)
+		return nil
+	}},
+	"show sessions": {readOnly: true, run: func(s *Server, w io.Writer, args []string) error {
+		s.showSessions(w)
+		return nil
+	}},
+	"disable server": {run: (*Server).setDisabled},
+	"enable server":  {run: (*Server).setDisabled},
+	"set weight": {run: func(s *Server, w io.Writer, args []string) error {
+		if len(args) != 4 {
+			return errors.New("usage: set weight <backend>/<server> <weight>")
+		}
+		return s.setWeight(args[2], args[3])
+	}},
+	"set server": {run: func(s *Server, w io.Writer, args []string) error {
+		if len(args) != 5 || args[3] != "weight" && args[3] != "state" {
+			return errors.New("usage: set server <backend>/<server> weight <weight> | state <ready|drain|maint>")
+		}
+		if args[3] == "state" {
+			backend, server, err := serverArg(args[2])
+			if err != nil {
+				return err
+			}
+			return s.Engine.SetServerState(backend, server, args[4])
+		}
+		return s.setWeight(args[2], args[4])
+	}},
+}
+
+// command runs one control socket command, writing its answer to w.
+func (s *Server) command(w io.Writer, args []string) error {
+	c, ok := socketCommands[strings.Join(args[:min(len(args), 2)], " ")]
+	if !ok {
+		return fmt.Errorf("unknown command %q, try help", strings.Join(args, " "))
+	}
+	if !c.readOnly {
+		if err := s.Engine.CheckFrozen(strings.Join(args, " "), "control socket"); err != nil {
+			return err
+		}
+	}
+	return c.run(s, w, args)
+}
+
+// setDisabled runs "disable server" and "enable server".
+func (s *Server) setDisabled(w io.Writer, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: %s server <backend>/<server>", args[0])
+	}
+	backend, server, err := serverArg(args[2])
+	if err != nil {
+		return err
+	}
+	return s.Engine.SetDisabled(backend, server, args[0] == "disable")
+}
+
+// setWeight changes the weight of a "<backend>/<server>" until the next
+// restart; weighted balancers pick it up with their next connection.
+func (s *Server) setWeight(arg, weight string) error {
+	backend, server, err := serverArg(arg)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(weight)
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", weight)
+	}
+	return s.Engine.SetWeight(backend, server, n, false)
+}
+
+// serverArg splits a "<backend>/<server>" argument.
+func serverArg(arg string) (backend, server string, err error) {
+	backend, server, ok := strings.Cut(arg, "/")
+	if !ok || backend == "" || server == "" {
+		return "", "", fmt.Errorf("expected <backend>/<server>, got %q", arg)
+	}
+	return backend, server, nil
+}
+
+func (s *Server) showBackends(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tSERVER\tSTATUS\tWEIGHT")
+	for _, be := range s.backends() {
+		for _, srv := range be.Servers {
+			status := "UP"
+			switch {
+			case srv.State == config.ServerMaint:
+				status = "MAINT"
+			case srv.State == config.ServerDrain:
+				status = "DRAIN"
+			case srv.Disabled:
+				status = "DISABLED"
+			case !srv.Healthy:
+				status = "DOWN"
+			case srv.Weight == 0:
+				status = "DRAIN"
+			}
+			if srv.Backup {
+				status += " (backup)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", be.Name, srv.Address, status, srv.Weight)
+		}
+	}
+	tw.Flush()
+}
+
+func (s *Server) showSessions(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTENER\tCLIENT\tBACKEND\tSERVER\tAGE\tIN\tOUT")
+	now := time.Now()
+	for _, c := range s.Engine.Connections() {
+		server := c.Server
+		if server == "" {
+			server = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n", c.Listener, c.Client, c.Backend, server,
+			now.Sub(c.Start).Round(time.Second), c.BytesIn, c.BytesOut)
+	}
+	tw.Flush()
+}
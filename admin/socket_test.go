@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nvelox/lb"
+)
+
+func TestControlSocket(t *testing.T) {
+	_, engine := newTestServer(t)
+	engine.Balancers["web"] = lb.NewPool("roundrobin", []lb.Server{
+		{Address: "10.0.0.1:80", Weight: lb.DefaultWeight},
+		{Address: "10.0.0.2:80", Weight: lb.DefaultWeight},
+	})
+	engine.Backends["web"] = &engine.CurrentConfig().Backends[0]
+
+	srv := NewServer(engine, "v-test")
+	path := filepath.Join(t.TempDir(), "nvelox.sock")
+	if err := srv.StartSocket(path); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	run := func(cmd string) string {
+		t.Helper()
+		if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%s: %v", cmd, err)
+			}
+			if line == "\n" {
+				return out.String()
+			}
+			out.WriteString(line)
+		}
+	}
+
+	if out := run("disable server web/10.0.0.1:80"); out != "" {
+		t.Fatalf("disable server: %q", out)
+	}
+	if out := run("set server web/10.0.0.2:80 weight 7"); out != "" {
+		t.Fatalf("set server weight: %q", out)
+	}
+	if out := run("show backends"); !strings.Contains(strings.Join(strings.Fields(out), " "), "10.0.0.2:80 UP 7") {
+		t.Errorf("show backends after set server weight:\n%s", out)
+	}
+	if out := run("set weight web/10.0.0.2:80 0"); out != "" {
+		t.Fatalf("set weight: %q", out)
+	}
+	out := run("show backends")
+	if !strings.Contains(out, "10.0.0.1:80  DRAIN") || !strings.Contains(out, "10.0.0.2:80  DRAIN") {
+		t.Errorf("show backends:\n%s", out)
+	}
+	if out := run("set server web/10.0.0.1:80 state maint"); out != "" {
+		t.Fatalf("set server state: %q", out)
+	}
+	if out := run("show backends"); !strings.Contains(out, "10.0.0.1:80  MAINT") {
+		t.Errorf("show backends after maint:\n%s", out)
+	}
+	run("enable server web/10.0.0.1:80")
+	if out := run("show backends"); !strings.Contains(out, "10.0.0.1:80  UP") {
+		t.Errorf("show backends after enable:\n%s", out)
+	}
+	if out := run("show sessions"); !strings.HasPrefix(out, "LISTENER") {
+		t.Errorf("show sessions:\n%s", out)
+	}
+	if out := run("show info"); !strings.Contains(out, "version: v-test") {
+		t.Errorf("show info:\n%s", out)
+	}
+	for _, cmd := range []string{"disable server web", "enable server api/10.0.0.1:80", "set weight web/10.0.0.1:80 999", "set server web/10.0.0.1:80 state down", "frobnicate"} {
+		if out := run(cmd); !strings.HasPrefix(out, "error: ") {
+			t.Errorf("%s: %q, want an error", cmd, out)
+		}
+	}
+
+	// A frozen configuration refuses changes but still shows them
+	engine.SetFrozen(true, "test")
+	for name, c := range socketCommands {
+		out := run(name)
+		if refused := strings.Contains(out, "configuration is frozen"); refused == c.readOnly {
+			t.Errorf("%s while frozen: %q", name, out)
+		}
+	}
+	if out := run("show info"); !strings.Contains(out, "frozen: true") {
+		t.Errorf("show info while frozen:\n%s", out)
+	}
+	engine.SetFrozen(false, "test")
+
+	if err := srv.ShutdownSocket(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("unix", path); err == nil {
+		t.Error("socket still accepting after shutdown")
+	}
+}
@@ -0,0 +1,391 @@
+// Package adminclient is a typed Go client for the nvelox admin API.
+package adminclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"nvelox/config"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// APIError is returned when the admin API answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("admin api: %d %s", e.StatusCode, e.Message)
+}
+
+// Client talks to a single nvelox admin endpoint.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token is sent as a bearer token, for an API requiring admin.token.
+	Token string
+}
+
+// New returns a client for the admin API at baseURL (e.g. "http://127.0.0.1:9000").
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Status returns instance information.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var out Status
+	if err := c.do(ctx, http.MethodGet, "/api/v1/status", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Backends lists backend pools with per-server health.
+func (c *Client) Backends(ctx context.Context) ([]Backend, error) {
+	var out []Backend
+	if err := c.do(ctx, http.MethodGet, "/api/v1/backends", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MemoryConsumers returns the connections holding the most buffered bytes.
+// A limit of 0 uses the server default.
+func (c *Client) MemoryConsumers(ctx context.Context, limit int) ([]ConnMemory, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out []ConnMemory
+	if err := c.do(ctx, http.MethodGet, "/api/v1/connections/memory", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// State returns the listeners and backends currently applied.
+func (c *Client) State(ctx context.Context) (*State, error) {
+	var out State
+	if err := c.do(ctx, http.MethodGet, "/api/v1/state", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ApplyState converges the instance to the given state and returns what changed.
+// The state is sent as YAML so config field names match the config file.
+func (c *Client) ApplyState(ctx context.Context, state State) (*ApplyResult, error) {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	var out ApplyResult
+	if err := c.do(ctx, http.MethodPut, "/api/v1/state", nil, rawBody{contentType: "application/yaml", data: data}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddListener starts a listener on the instance without a restart. Like a
+// state, it is sent as YAML so config field names match the config file.
+func (c *Client) AddListener(ctx context.Context, l config.Listener) (*ApplyResult, error) {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode listener: %w", err)
+	}
+	var out ApplyResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/listeners", nil, rawBody{contentType: "application/yaml", data: data}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveListener stops a listener; its open connections finish normally.
+func (c *Client) RemoveListener(ctx context.Context, name string) (*ApplyResult, error) {
+	var out ApplyResult
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/listeners/"+url.PathEscape(name), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SwapBackend points a listener at another backend, draining its current connections.
+func (c *Client) SwapBackend(ctx context.Context, listener string, req SwapRequest) (*Swap, error) {
+	var out Swap
+	if err := c.do(ctx, http.MethodPut, "/api/v1/listeners/"+url.PathEscape(listener)+"/backend", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetTrace turns connection tracing of a listener on or off until the next
+// reload.
+func (c *Client) SetTrace(ctx context.Context, listener string, req TraceRequest) (*Trace, error) {
+	var out Trace
+	if err := c.do(ctx, http.MethodPut, "/api/v1/listeners/"+url.PathEscape(listener)+"/trace", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SwapListeners exchanges the backends of two listeners in one step.
+func (c *Client) SwapListeners(ctx context.Context, req SwapListenersRequest) ([]Swap, error) {
+	var out []Swap
+	if err := c.do(ctx, http.MethodPost, "/api/v1/listeners/swap", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Drains lists the backend and server drains in progress.
+func (c *Client) Drains(ctx context.Context) ([]Drain, error) {
+	var out []Drain
+	if err := c.do(ctx, http.MethodGet, "/api/v1/drains", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AccelerateDrain closes the remaining connections of a drain now.
+func (c *Client) AccelerateDrain(ctx context.Context, id int) (*DrainAccelerated, error) {
+	var out DrainAccelerated
+	if err := c.do(ctx, http.MethodPost, "/api/v1/drains/"+strconv.Itoa(id)+"/accelerate", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelDrain stops a drain and returns the drains left. A drained server
+// gets its previous weight back.
+func (c *Client) CancelDrain(ctx context.Context, id int) ([]Drain, error) {
+	var out []Drain
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/drains/"+strconv.Itoa(id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Shedding returns load shedding state and counters.
+func (c *Client) Shedding(ctx context.Context) (*Shedding, error) {
+	var out Shedding
+	if err := c.do(ctx, http.MethodGet, "/api/v1/shedding", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Freeze reports whether the configuration is frozen.
+func (c *Client) Freeze(ctx context.Context) (*Freeze, error) {
+	var out Freeze
+	if err := c.do(ctx, http.MethodGet, "/api/v1/freeze", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetFrozen freezes the configuration, refusing every change until it is
+// thawed again with frozen false.
+func (c *Client) SetFrozen(ctx context.Context, frozen bool) (*Freeze, error) {
+	var out Freeze
+	if err := c.do(ctx, http.MethodPut, "/api/v1/freeze", nil, FreezeRequest{Frozen: frozen}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AcceptQueues returns the kernel accept queues of the TCP listeners.
+func (c *Client) AcceptQueues(ctx context.Context) (*AcceptQueues, error) {
+	var out AcceptQueues
+	if err := c.do(ctx, http.MethodGet, "/api/v1/listeners/queues", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Stats returns the cumulative traffic counters.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var out Stats
+	if err := c.do(ctx, http.MethodGet, "/api/v1/stats", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Health reports whether the process is alive; it succeeds while draining.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var out Health
+	if err := c.do(ctx, http.MethodGet, "/api/v1/healthz", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Ready reports whether the instance accepts traffic. A draining instance
+// answers 503, which is returned as an *APIError.
+func (c *Client) Ready(ctx context.Context) (*Readiness, error) {
+	var out Readiness
+	if err := c.do(ctx, http.MethodGet, "/api/v1/ready", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Drain stops new connections and waits up to timeout (0 uses the server
+// default) for existing ones to finish.
+func (c *Client) Drain(ctx context.Context, timeout time.Duration) (*DrainResult, error) {
+	q := url.Values{}
+	if timeout > 0 {
+		q.Set("timeout", timeout.String())
+	}
+	var out DrainResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/drain", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetWeight changes the weight of a backend server.
+func (c *Client) SetWeight(ctx context.Context, backend, server string, req WeightRequest) (*Server, error) {
+	var out Server
+	path := "/api/v1/backends/" + url.PathEscape(backend) + "/servers/" + url.PathEscape(server) + "/weight"
+	if err := c.do(ctx, http.MethodPut, path, nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetServerState puts a backend server in the ready, drain or maint state.
+func (c *Client) SetServerState(ctx context.Context, backend, server string, req ServerStateRequest) (*Server, error) {
+	var out Server
+	path := "/api/v1/backends/" + url.PathEscape(backend) + "/servers/" + url.PathEscape(server) + "/state"
+	if err := c.do(ctx, http.MethodPut, path, nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Rebalance returns the connection distribution of a backend.
+func (c *Client) Rebalance(ctx context.Context, backend string) (*RebalancePlan, error) {
+	var out RebalancePlan
+	if err := c.do(ctx, http.MethodGet, "/api/v1/backends/"+url.PathEscape(backend)+"/rebalance", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LogLevels returns the log levels in effect.
+func (c *Client) LogLevels(ctx context.Context) (*LogLevels, error) {
+	var out LogLevels
+	if err := c.do(ctx, http.MethodGet, "/api/v1/logging", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetLogLevels changes log levels, by default for logging.level_revert.
+func (c *Client) SetLogLevels(ctx context.Context, req LogLevelRequest) (*LogLevels, error) {
+	var out LogLevels
+	if err := c.do(ctx, http.MethodPut, "/api/v1/logging", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResetLogLevels reverts a temporary log level change now.
+func (c *Client) ResetLogLevels(ctx context.Context) (*LogLevels, error) {
+	var out LogLevels
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/logging", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// rawBody is a pre-encoded request body.
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// do sends a request with an optional JSON (or raw) body and decodes a JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	contentType := "application/json"
+	if raw, ok := body.(rawBody); ok {
+		contentType = raw.contentType
+		reqBody = bytes.NewReader(raw.data)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	c.authorize(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// authorize adds the bearer token to req, if the client has one.
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+}
+
+// statusError returns the APIError of a non-2xx response.
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var apiErr Error
+	data, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+		apiErr.Error = strings.TrimSpace(string(data))
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+}
@@ -0,0 +1,69 @@
+package adminclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HintStream pushes hints to an instance over one long-lived request, see
+// Client.StreamHints. Send and Recv may be used from different goroutines.
+type HintStream struct {
+	pw   *io.PipeWriter
+	enc  *json.Encoder
+	body io.ReadCloser
+	dec  *json.Decoder
+}
+
+// StreamHints opens a hints stream. It lasts until Close or until ctx is
+// done; the client timeout does not apply to it.
+func (c *Client) StreamHints(ctx context.Context) (*HintStream, error) {
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/api/v1/hints", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/x-ndjson")
+	c.authorize(req)
+
+	hc := *c.HTTPClient
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	if err := statusError(resp); err != nil {
+		pw.Close()
+		resp.Body.Close()
+		return nil, err
+	}
+	return &HintStream{pw: pw, enc: json.NewEncoder(pw), body: resp.Body, dec: json.NewDecoder(resp.Body)}, nil
+}
+
+// Send pushes a hint; its result arrives through Recv.
+func (s *HintStream) Send(h Hint) error {
+	return s.enc.Encode(h)
+}
+
+// Recv returns the result of the next hint sent, io.EOF once the stream is
+// closed and every result read.
+func (s *HintStream) Recv() (*HintResult, error) {
+	var out HintResult
+	if err := s.dec.Decode(&out); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode hint result: %w", err)
+	}
+	return &out, nil
+}
+
+// Close ends the stream. Results not read yet are discarded.
+func (s *HintStream) Close() error {
+	s.pw.Close()
+	return s.body.Close()
+}
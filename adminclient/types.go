@@ -0,0 +1,300 @@
+package adminclient
+
+import (
+	"time"
+
+	"nvelox/config"
+)
+
+// Status describes the running instance.
+type Status struct {
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+	Listeners int       `json:"listeners"`
+	Backends  int       `json:"backends"`
+	Drains    []Drain   `json:"drains"` // in progress
+	Frozen    bool      `json:"frozen"` // changes are refused, see Freeze
+}
+
+// Backend is a server pool and the health of its servers.
+type Backend struct {
+	Name      string   `json:"name"`
+	Balance   string   `json:"balance"`
+	Servers   []Server `json:"servers"`
+	Available bool     `json:"available"`        // false while a dependency is unmet
+	Reason    string   `json:"reason,omitempty"` // unmet dependency
+}
+
+// Server is a single backend server.
+type Server struct {
+	Address  string `json:"address"`
+	Healthy  bool   `json:"healthy"`
+	Weight   int    `json:"weight"` // 0 means draining
+	Backup   bool   `json:"backup,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"` // in the configuration or at runtime
+	State    string `json:"state,omitempty"`    // administrative state: ready, drain or maint
+
+	Health    *ServerHealth `json:"health,omitempty"`     // nil until probed by an active health check
+	PortsDown []int         `json:"ports_down,omitempty"` // listener ports failing their probe, for a server without a port
+	Resolved  []string      `json:"resolved,omitempty"`   // pool members of a hostname server resolved at_start or periodic
+}
+
+// ServerHealth counts the health transitions of a server since its first
+// probe. Durations are in seconds.
+type ServerHealth struct {
+	Since           time.Time `json:"since"`                    // last transition, or the first probe
+	SinceSeconds    float64   `json:"seconds_since_transition"` // time in the current state
+	Failures        int       `json:"failures"`                 // transitions to down
+	Recoveries      int       `json:"recoveries"`               // transitions back to up
+	DowntimeSeconds float64   `json:"downtime_seconds"`
+	UptimeSeconds   float64   `json:"uptime_seconds"`
+	MTTRSeconds     float64   `json:"mttr_seconds"` // mean time to recovery, 0 before the first recovery
+	MTBFSeconds     float64   `json:"mtbf_seconds"` // mean uptime between failures, 0 before the first failure
+}
+
+// WeightRequest sets the administrative weight of a server.
+type WeightRequest struct {
+	Weight  int  `json:"weight"`  // 0-256, 0 drains the server
+	Persist bool `json:"persist"` // also write to admin.weights_file or the state store
+}
+
+// ServerStateRequest sets the administrative state of a server.
+type ServerStateRequest struct {
+	State string `json:"state"` // ready, drain (no new connections) or maint (no health checks either)
+}
+
+// Hint is a weight or health change an external controller pushes for a
+// server over the hints stream. Either field may be left out.
+type Hint struct {
+	Backend string `json:"backend"`
+	Server  string `json:"server"`
+	Weight  *int   `json:"weight,omitempty"`  // 0-256, not persisted
+	Healthy *bool  `json:"healthy,omitempty"` // until the next health check change or reload
+}
+
+// HintResult answers the hint with the same sequence number, counted from 1
+// on each stream.
+type HintResult struct {
+	Seq   int    `json:"seq"`
+	Error string `json:"error,omitempty"`
+}
+
+// RebalancePlan is the connection distribution of a backend's enabled,
+// healthy primary servers and the connections to close to even it out.
+type RebalancePlan struct {
+	Backend     string       `json:"backend"`
+	Connections int          `json:"connections"`
+	Servers     []ServerLoad `json:"servers"`
+}
+
+// ServerLoad compares the open connections of a server with its share.
+type ServerLoad struct {
+	Address     string  `json:"address"`
+	Weight      int     `json:"weight"`
+	Connections int     `json:"connections"`
+	FairShare   float64 `json:"fair_share"` // connections it would hold if balanced by weight
+	Close       int     `json:"close"`      // oldest connections to close, 0 unless overloaded
+}
+
+// ConnMemory reports the buffered bytes held by a client connection.
+type ConnMemory struct {
+	Listener string `json:"listener"`
+	Client   string `json:"client"`
+	Buffered int64  `json:"buffered"`
+}
+
+// Error is the body of every non-2xx admin API response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// State is the declarative set of listeners and backends of an instance.
+type State struct {
+	Listeners []config.Listener `json:"listeners" yaml:"listeners"`
+	Backends  []config.Backend  `json:"backends" yaml:"backends"`
+}
+
+// Change is one listener or backend touched by applying a State.
+type Change struct {
+	Kind   string `json:"kind"` // listener, backend
+	Name   string `json:"name"`
+	Action string `json:"action"` // added, removed, updated
+}
+
+// ApplyResult lists the changes made by applying a State; it is empty when
+// the instance already matched.
+type ApplyResult struct {
+	Changes []Change `json:"changes"`
+}
+
+// SwapRequest points a listener at another backend.
+type SwapRequest struct {
+	Backend      string `json:"backend"`
+	DrainTimeout string `json:"drain_timeout,omitempty"` // duration; close old connections after it, empty waits for them
+}
+
+// SwapListenersRequest exchanges the backends of two listeners.
+type SwapListenersRequest struct {
+	Listeners    []string `json:"listeners"` // exactly two listener names
+	DrainTimeout string   `json:"drain_timeout,omitempty"`
+}
+
+// Swap reports a listener whose backend was switched.
+type Swap struct {
+	Listener string `json:"listener"`
+	Previous string `json:"previous"`
+	Backend  string `json:"backend"`
+	Draining int    `json:"draining"` // connections still on the previous backend
+}
+
+// TraceRequest turns connection tracing of a listener on or off.
+type TraceRequest struct {
+	Enabled bool    `json:"enabled"`
+	Sample  float64 `json:"sample,omitempty"` // fraction of connections traced, 0 keeps the current one
+}
+
+// Trace reports the connection tracing of a listener.
+type Trace struct {
+	Listener string  `json:"listener"`
+	Enabled  bool    `json:"enabled"`
+	Sample   float64 `json:"sample"`
+}
+
+// Shedding reports load shedding state and counters.
+type Shedding struct {
+	Enabled  bool             `json:"enabled"`
+	Active   bool             `json:"active"`
+	Pressure Pressure         `json:"pressure"`
+	Shed     map[string]int64 `json:"shed"` // rejected connections per listener
+	Total    int64            `json:"total"`
+}
+
+// FreezeRequest freezes the configuration, or thaws it.
+type FreezeRequest struct {
+	Frozen bool `json:"frozen"`
+}
+
+// Freeze reports whether the configuration is frozen. While it is, every
+// change through the admin interfaces is refused and reloads are skipped.
+type Freeze struct {
+	Frozen bool       `json:"frozen"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// AcceptQueues reports the kernel accept queues of the TCP listeners (linux
+// only). Overflows and Drops count since boot for the whole host.
+type AcceptQueues struct {
+	Supported bool          `json:"supported"`
+	Overflows int64         `json:"overflows"` // handshakes dropped for a full accept queue
+	Drops     int64         `json:"drops"`     // all dropped handshakes, overflows included
+	Listeners []AcceptQueue `json:"listeners"`
+}
+
+// AcceptQueue reports the accept queue of one bind address of a listener.
+type AcceptQueue struct {
+	Listener string `json:"listener"`
+	Name     string `json:"name"`
+	Addr     string `json:"addr"`
+	Sockets  int    `json:"sockets"` // one per event loop
+	Queued   int    `json:"queued"`  // established, not accepted yet
+	Backlog  int    `json:"backlog"` // queue length of each socket
+}
+
+// Stats are cumulative traffic counters, kept across restarts with
+// admin.stats_file.
+type Stats struct {
+	Since       time.Time                 `json:"since"`
+	Connections int64                     `json:"connections"`
+	Backends    map[string]BackendTraffic `json:"backends"`
+	Hellos      HelloStats                `json:"hellos"`
+	// Backpressure counts max_conn_buffer trips per listener and backend.
+	Backpressure map[string]map[string]BackpressureStats `json:"backpressure,omitempty"`
+}
+
+// BackpressureStats counts the max_conn_buffer trips of one listener on
+// connections to one backend.
+type BackpressureStats struct {
+	Stalls       int64   `json:"stalls"`        // backend reads paused for a slow client
+	StallSeconds float64 `json:"stall_seconds"` // time backend reads spent paused
+	Overflows    int64   `json:"overflows"`     // connections closed buffering for a backend not yet connected
+}
+
+// HelloStats counts the TLS ClientHellos inspection gave up on.
+type HelloStats struct {
+	Malformed  int64 `json:"malformed"`  // complete but unparsable
+	Oversized  int64 `json:"oversized"`  // larger than tls_inspect.max_bytes
+	Incomplete int64 `json:"incomplete"` // cut off by tls_inspect.timeout or the client
+}
+
+// BackendTraffic counts the closed connections of one backend and their bytes.
+type BackendTraffic struct {
+	Connections int64 `json:"connections"`
+	BytesIn     int64 `json:"bytes_in"`  // client -> backend
+	BytesOut    int64 `json:"bytes_out"` // backend -> client
+}
+
+// Pressure is the last system pressure sample.
+type Pressure struct {
+	CPULoad       float64 `json:"cpu_load"`
+	MemoryPercent float64 `json:"memory_percent"`
+	FDPercent     float64 `json:"fd_percent"`
+}
+
+// Health is the liveness of the process, independent of draining.
+type Health struct {
+	Status   string `json:"status"` // "ok"
+	Draining bool   `json:"draining"`
+	Uptime   string `json:"uptime"`
+}
+
+// Readiness tells load balancers and orchestrators whether to send traffic.
+type Readiness struct {
+	Ready    bool `json:"ready"`
+	Draining bool `json:"draining"`
+}
+
+// DrainResult reports the outcome of draining the instance.
+type DrainResult struct {
+	Drained   bool   `json:"drained"`   // all connections closed before the timeout
+	Remaining int    `json:"remaining"` // connections still open
+	Elapsed   string `json:"elapsed"`
+}
+
+// Drain reports connections being moved off a backend by a swap, or off a
+// server set to weight 0.
+type Drain struct {
+	ID        int        `json:"id"`
+	Kind      string     `json:"kind"`               // backend or server
+	Listener  string     `json:"listener,omitempty"` // backend drains
+	Backend   string     `json:"backend"`
+	Server    string     `json:"server,omitempty"` // server drains
+	Remaining int        `json:"remaining"`        // open TCP connections
+	Started   time.Time  `json:"started"`
+	Elapsed   string     `json:"elapsed"`
+	Deadline  *time.Time `json:"deadline,omitempty"` // remaining connections are closed then
+}
+
+// DrainAccelerated reports the connections closed to finish a drain now.
+type DrainAccelerated struct {
+	Closed int `json:"closed"`
+}
+
+// LogLevels is the global log level, the levels set for single components
+// (lowercased message tags such as "health") and when a temporary change
+// reverts.
+type LogLevels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+	RevertAt   *time.Time        `json:"revert_at,omitempty"`
+}
+
+// LogLevelRequest changes log levels. An empty level leaves the global level
+// as is; a component level of "inherit" makes the component follow the
+// global level again. Duration defaults to logging.level_revert; "0" keeps
+// the change.
+type LogLevelRequest struct {
+	Level      string            `json:"level,omitempty"`
+	Components map[string]string `json:"components,omitempty"`
+	Duration   string            `json:"duration,omitempty"`
+}
@@ -1,9 +1,21 @@
 package config
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
-	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,63 +25,1408 @@ type Config struct {
 	Version string        `yaml:"version"`
 	Server  ServerConfig  `yaml:"server"`
 	Logging LoggingConfig `yaml:"logging"`
-	Include string        `yaml:"include"`
+	Admin   AdminConfig   `yaml:"admin"`
+	Include Includes      `yaml:"include,omitempty"`
+
+	// IncludeQuotas cap what included files may define. Only the main file
+	// sets them.
+	IncludeQuotas []IncludeQuota `yaml:"include_quotas,omitempty"`
+
+	// ConfigDirs are directories whose configuration files are layered over
+	// the main file and its includes, see LoadOptions.Layers. Only the main
+	// file sets them.
+	ConfigDirs []string `yaml:"config_dirs,omitempty"`
+
+	// Vars are the values {{ .name }} template actions in the files expand
+	// to. Included files see the vars of the files loaded before them.
+	Vars map[string]any `yaml:"vars,omitempty"`
+
+	// WatchConfig reloads the configuration when the file or its includes change.
+	WatchConfig bool `yaml:"watch_config"`
+
+	// Strict loads the file and its includes as LoadOptions.Strict does,
+	// without the command line flag. Only the main file sets it.
+	Strict bool `yaml:"strict,omitempty"`
+
+	// Shedding rejects part of the new connections on low-priority listeners under system pressure.
+	Shedding SheddingConfig `yaml:"shedding,omitempty"`
+
+	// Hosts overrides name resolution for backend addresses (name -> IPs).
+	Hosts map[string][]string `yaml:"hosts,omitempty"`
+
+	// Defaults holds settings every listener and backend inherits unless it
+	// sets its own.
+	Defaults DefaultsConfig `yaml:"defaults,omitempty"`
+
+	// Egress restricts the addresses nvelox dials to reach backends.
+	Egress EgressConfig `yaml:"egress,omitempty"`
+
+	// Tunnel receives the tunneled datagrams of remote nvelox peers and
+	// forwards them to their servers.
+	Tunnel TunnelConfig `yaml:"tunnel,omitempty"`
+
+	// SessionEvents posts session open/close events to an external service.
+	SessionEvents SessionEventsConfig `yaml:"session_events,omitempty"`
+
+	// State selects where runtime state such as persisted weights and
+	// stats is kept.
+	State StateConfig `yaml:"state,omitempty"`
 
 	Listeners []Listener `yaml:"listeners"`
 	Backends  []Backend  `yaml:"backends"`
+
+	// Services each stand for a listener and a backend, see Service.
+	Services []Service `yaml:"services,omitempty"`
+
+	// Warnings collects non-fatal problems found while loading.
+	Warnings []string `yaml:"-"`
 }
 
 type ServerConfig struct {
-	User    string `yaml:"user"`
-	Group   string `yaml:"group"`
+	// User and Group are switched to once the listeners are bound, names or
+	// numeric ids; an empty Group uses the primary group of User.
+	User  string `yaml:"user"`
+	Group string `yaml:"group"`
+	// PidFile receives the process id and stays locked while nvelox runs,
+	// so a second instance with the same file refuses to start.
 	PidFile string `yaml:"pid_file"`
+
+	// Defaults for listener binds: Host fills binds like ":80", Port fills
+	// binds without a port ("10.0.0.1") or an empty bind.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// MaxOpenFiles raises the open files limit (RLIMIT_NOFILE) at startup;
+	// 0 keeps the limit the process was started with.
+	MaxOpenFiles int `yaml:"max_open_files,omitempty"`
+	// ExpectedConnections is the concurrent connections expected per listener,
+	// used to estimate the open files needed at startup (default 100).
+	ExpectedConnections int `yaml:"expected_connections,omitempty"`
+	// DrainTimeout is how long shutdown waits for open connections and UDP
+	// sessions before closing them (default 30s, "0" closes them at once).
+	DrainTimeout string `yaml:"drain_timeout,omitempty"`
+
+	// Engine tunes the event loops of every listener.
+	Engine EngineConfig `yaml:"engine,omitempty"`
+}
+
+// EngineConfig exposes gnet event loop options. Zero values keep the gnet
+// defaults: one event loop per CPU and the OS socket buffer sizes.
+type EngineConfig struct {
+	NumEventLoops   int  `yaml:"num_event_loops,omitempty"`   // event loops per listener block
+	EdgeTriggered   bool `yaml:"edge_triggered,omitempty"`    // edge-triggered epoll/kqueue, TCP only
+	ReadBufferSize  int  `yaml:"read_buffer_size,omitempty"`  // SO_RCVBUF in bytes
+	WriteBufferSize int  `yaml:"write_buffer_size,omitempty"` // SO_SNDBUF in bytes
+	LockOSThread    bool `yaml:"lock_os_thread,omitempty"`    // pin each event loop to an OS thread
+}
+
+func (c EngineConfig) validate() error {
+	if c.NumEventLoops < 0 || c.ReadBufferSize < 0 || c.WriteBufferSize < 0 {
+		return fmt.Errorf("num_event_loops and buffer sizes must not be negative")
+	}
+	return nil
+}
+
+// DefaultExpectedConnections is the concurrent connections per listener
+// assumed when server.expected_connections is unset.
+const DefaultExpectedConnections = 100
+
+// ExpectedConns returns ExpectedConnections or its default.
+func (s ServerConfig) ExpectedConns() int {
+	if s.ExpectedConnections == 0 {
+		return DefaultExpectedConnections
+	}
+	return s.ExpectedConnections
+}
+
+// DefaultDrainTimeout is how long shutdown waits for open connections when
+// server.drain_timeout is unset.
+const DefaultDrainTimeout = 30 * time.Second
+
+// DrainWait returns DrainTimeout or its default.
+func (s ServerConfig) DrainWait() time.Duration {
+	if s.DrainTimeout == "" {
+		return DefaultDrainTimeout
+	}
+	d, _ := time.ParseDuration(s.DrainTimeout)
+	return d
+}
+
+// defaultBind completes a listener bind address with the server host/port.
+func (s ServerConfig) defaultBind(bind string) string {
+	if bind == "" {
+		if s.Port == 0 {
+			return ""
+		}
+		return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	}
+
+	lastColon := strings.LastIndex(bind, ":")
+	if lastColon <= strings.LastIndex(bind, "]") {
+		// No port
+		if s.Port == 0 {
+			return bind
+		}
+		return bind + ":" + strconv.Itoa(s.Port)
+	}
+	if lastColon == 0 && s.Host != "" {
+		host := s.Host
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return host + bind
+	}
+	return bind
+}
+
+// SheddingConfig sets the pressure thresholds for load shedding. Shedding is
+// active while any configured threshold is reached; 0 ignores a metric.
+type SheddingConfig struct {
+	Interval       string  `yaml:"interval"`        // sampling period, duration string (default 1s)
+	CPULoad        float64 `yaml:"cpu_load"`        // 1-minute load average per CPU
+	MemoryPercent  float64 `yaml:"memory_percent"`  // system memory in use
+	FDPercent      float64 `yaml:"fd_percent"`      // open descriptors vs the process limit
+	Fraction       float64 `yaml:"fraction"`        // share of new connections rejected on low priority listeners (default 0.5)
+	NormalFraction float64 `yaml:"normal_fraction"` // share rejected on normal priority listeners
+}
+
+// Enabled reports whether any pressure threshold is set.
+func (s SheddingConfig) Enabled() bool {
+	return s.CPULoad > 0 || s.MemoryPercent > 0 || s.FDPercent > 0
+}
+
+// EgressConfig is the safelist of backend destinations. When Allow is set,
+// connections and health checks to any other address are refused, wherever
+// the address came from.
+type EgressConfig struct {
+	Allow []string `yaml:"allow,omitempty"` // CIDRs or single IPs
+}
+
+// Prefixes parses the allowlist; single IPs become host prefixes.
+func (e EgressConfig) Prefixes() ([]netip.Prefix, error) {
+	return parsePrefixes("allow", e.Allow)
+}
+
+// parsePrefixes parses a list of CIDRs and single IPs into prefixes; field
+// names the list in errors.
+func parsePrefixes(field string, list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, a := range list {
+		if p, err := netip.ParsePrefix(a); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q", field, a)
+		}
+		out = append(out, netip.PrefixFrom(ip, ip.BitLen()))
+	}
+	return out, nil
+}
+
+// Allows reports whether host may be dialed. Host names pass, they are
+// checked once resolved.
+func (e EgressConfig) Allows(host string) bool {
+	ip, err := netip.ParseAddr(host)
+	if err != nil || len(e.Allow) == 0 {
+		return true
+	}
+	prefixes, _ := e.Prefixes()
+	ip = ip.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// StateConfig selects the store for runtime state. Without a type, weights
+// and stats go to admin.weights_file and admin.stats_file.
+type StateConfig struct {
+	Type     string `yaml:"type,omitempty"`     // "memory", "file" or "redis"
+	Path     string `yaml:"path,omitempty"`     // directory of the file store
+	Address  string `yaml:"address,omitempty"`  // host:port of the redis server
+	Password Secret `yaml:"password,omitempty"` // redis AUTH password, or a reference to it
+	DB       int    `yaml:"db,omitempty"`       // redis database number
+	Prefix   string `yaml:"prefix,omitempty"`   // prepended to redis keys (default "nvelox:")
+	Timeout  string `yaml:"timeout,omitempty"`  // per redis command (default 2s)
+	// Node names this instance among those sharing a store, for state that
+	// is not shared such as traffic counters (default: the host name).
+	Node string `yaml:"node,omitempty"`
+}
+
+// Enabled reports whether a state store is configured.
+func (s StateConfig) Enabled() bool {
+	return s.Type != ""
+}
+
+func (s StateConfig) validate() error {
+	switch s.Type {
+	case "", "memory":
+	case "file":
+		if s.Path == "" {
+			return fmt.Errorf("file store requires a path")
+		}
+	case "redis":
+		if s.Address == "" {
+			return fmt.Errorf("redis store requires an address")
+		}
+		if s.DB < 0 {
+			return fmt.Errorf("db must not be negative")
+		}
+	case "bbolt":
+		return fmt.Errorf("type bbolt is not available, use file for a store without a server")
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", s.Timeout)
+		}
+	}
+	return nil
+}
+
+// SessionEventsConfig sends an event when a client session is assigned to a
+// backend server and when it ends, in batches POSTed to URL.
+type SessionEventsConfig struct {
+	URL           string      `yaml:"url"`
+	BatchSize     int         `yaml:"batch_size,omitempty"`     // events per request (default 100)
+	FlushInterval string      `yaml:"flush_interval,omitempty"` // longest wait before a partial batch is sent (default 1s)
+	QueueSize     int         `yaml:"queue_size,omitempty"`     // events buffered while the endpoint is slow (default 10000)
+	Retry         RetryConfig `yaml:"retry,omitempty"`          // per batch; unset retries 3 times
+}
+
+// Enabled reports whether session events are sent.
+func (s SessionEventsConfig) Enabled() bool {
+	return s.URL != ""
+}
+
+func (s SessionEventsConfig) validate() error {
+	if !s.Enabled() {
+		return nil
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", s.URL)
+	}
+	if s.BatchSize < 0 {
+		return fmt.Errorf("batch_size must not be negative")
+	}
+	if s.QueueSize < 0 {
+		return fmt.Errorf("queue_size must not be negative")
+	}
+	if s.FlushInterval != "" {
+		if d, err := time.ParseDuration(s.FlushInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid flush_interval %q", s.FlushInterval)
+		}
+	}
+	return validateRetry(s.Retry)
+}
+
+// AdminConfig enables the HTTP admin API.
+type AdminConfig struct {
+	Bind string `yaml:"bind"` // e.g. "127.0.0.1:9000"; empty disables the API
+
+	// Token is the bearer token callers of the HTTP API present, at least
+	// 16 bytes or a reference to it. It is required unless Bind is a
+	// loopback address.
+	Token Secret `yaml:"token,omitempty"`
+
+	// MonitorBind serves the read-only health, readiness, status and stats
+	// endpoints on a separate listener, e.g. ":9100" for monitoring systems.
+	MonitorBind string `yaml:"monitor_bind,omitempty"`
+
+	// Socket is the path of a unix control socket taking text commands such
+	// as `show backends` or `disable server web/10.0.0.3:80`.
+	Socket string `yaml:"socket,omitempty"`
+
+	// GRPC serves the control-plane API of proto/nvelox/admin/v1 over gRPC.
+	GRPC GRPCConfig `yaml:"grpc,omitempty"`
+
+	// WeightsFile stores server weights set through the API with persist,
+	// reapplied on startup.
+	WeightsFile string `yaml:"weights_file"`
+
+	// StatsFile keeps cumulative traffic counters across restarts. They are
+	// written every StatsInterval (default 1m) and on shutdown.
+	StatsFile     string `yaml:"stats_file,omitempty"`
+	StatsInterval string `yaml:"stats_interval,omitempty"`
+
+	// ResolveCacheFile keeps the addresses hostname servers resolved at_start
+	// or periodic last resolved to, so that a restart during a DNS outage
+	// still routes to them. Addresses older than ResolveCacheMaxAge (default
+	// 24h) are not used.
+	ResolveCacheFile   string `yaml:"resolve_cache_file,omitempty"`
+	ResolveCacheMaxAge string `yaml:"resolve_cache_max_age,omitempty"`
+
+	// ServerStatesFile keeps the administrative server states set at runtime
+	// (ready, drain, maint), written on every change and reapplied on
+	// startup.
+	ServerStatesFile string `yaml:"server_states_file,omitempty"`
+}
+
+// minAPIToken is the shortest admin API token accepted, HTTP or gRPC.
+const minAPIToken = 16
+
+func (a AdminConfig) validate() error {
+	if a.Bind == "" {
+		if !a.Token.IsZero() {
+			return fmt.Errorf("token requires bind")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(a.Bind)
+	if err != nil {
+		return fmt.Errorf("invalid bind %q", a.Bind)
+	}
+	if a.Token.IsZero() {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("bind %q is not a loopback address and requires a token", a.Bind)
+		}
+		return nil
+	}
+	if len(a.Token.Value()) < minAPIToken {
+		return fmt.Errorf("token must be at least %d bytes", minAPIToken)
+	}
+	return nil
+}
+
+// GRPCConfig serves the gRPC control-plane API on Bind. Callers present
+// Token as a bearer token. Without Cert and Key the API speaks HTTP/2
+// without TLS, which suits loopback and trusted networks only.
+type GRPCConfig struct {
+	Bind  string `yaml:"bind,omitempty"`
+	Token Secret `yaml:"token,omitempty"` // at least 16 bytes, or a reference to it
+	Cert  Secret `yaml:"cert,omitempty"`  // PEM, or a reference to it
+	Key   Secret `yaml:"key,omitempty"`
+}
+
+func (g GRPCConfig) validate() error {
+	if g.Bind == "" {
+		if g != (GRPCConfig{}) {
+			return fmt.Errorf("token, cert and key require bind")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(g.Bind); err != nil {
+		return fmt.Errorf("invalid bind %q", g.Bind)
+	}
+	if len(g.Token.Value()) < minAPIToken {
+		return fmt.Errorf("token must be at least %d bytes", minAPIToken)
+	}
+	if g.Cert.IsZero() != g.Key.IsZero() {
+		return fmt.Errorf("cert and key must be set together")
+	}
+	return nil
 }
 
 type LoggingConfig struct {
 	Level     string `yaml:"level"`      // debug, info, warning, error
 	AccessLog string `yaml:"access_log"` // path to access log
 	ErrorLog  string `yaml:"error_log"`  // path to error log
+
+	// LevelRevert is how long a log level change made through the admin API
+	// lasts when the request gives no duration; "0" keeps it.
+	LevelRevert string `yaml:"level_revert,omitempty"`
+
+	// AccessSinks replaces the plain access log with filtered sinks.
+	AccessSinks []AccessSinkConfig `yaml:"access_sinks,omitempty"`
+
+	// Units selects how log lines render durations and byte counts.
+	Units LogUnits `yaml:"units,omitempty"`
+}
+
+// Units of LogUnits.
+const (
+	DurationMillis  = "ms"
+	DurationMicros  = "us"
+	DurationSeconds = "s"
+	SizeBytes       = "bytes"
+	SizeHuman       = "human"
+)
+
+// LogUnits selects the units of durations and byte counts in log lines.
+// Durations always carry their unit as a suffix; the default is
+// milliseconds with microsecond resolution.
+type LogUnits struct {
+	Duration string `yaml:"duration,omitempty"` // ms (default), us or s
+	Size     string `yaml:"size,omitempty"`     // bytes (default) or human, e.g. 1.5KiB
+}
+
+func (u LogUnits) validate() error {
+	switch u.Duration {
+	case "", DurationMillis, DurationMicros, DurationSeconds:
+	default:
+		return fmt.Errorf("invalid duration unit %q (expected ms, us or s)", u.Duration)
+	}
+	switch u.Size {
+	case "", SizeBytes, SizeHuman:
+	default:
+		return fmt.Errorf("invalid size unit %q (expected bytes or human)", u.Size)
+	}
+	return nil
+}
+
+// AccessSinkConfig defines one destination of the access log pipeline.
+type AccessSinkConfig struct {
+	Type    string `yaml:"type"`    // file, syslog, webhook
+	Path    string `yaml:"path"`    // for file
+	Network string `yaml:"network"` // for syslog: udp (default) or tcp
+	Address string `yaml:"address"` // for syslog: host:port
+	Tag     string `yaml:"tag"`     // for syslog
+	URL     string `yaml:"url"`     // for webhook
+
+	Filter AccessFilterConfig `yaml:"filter,omitempty"`
+}
+
+// AccessFilterConfig selects which access entries reach a sink.
+type AccessFilterConfig struct {
+	IncludeListeners []string `yaml:"include_listeners"`
+	ExcludeListeners []string `yaml:"exclude_listeners"`
+	IncludeStatus    []string `yaml:"include_status"`
+	ExcludeStatus    []string `yaml:"exclude_status"`
+	MinBytes         int64    `yaml:"min_bytes"` // total bytes in + out
+	MaxBytes         int64    `yaml:"max_bytes"`
+}
+
+// Listener defines a frontend listener.
+type Listener struct {
+	Name           string   `yaml:"name"`
+	Bind           Binds    `yaml:"bind"`            // e.g., ":80", "*:1024-2048" or a list of them
+	Protocol       string   `yaml:"protocol"`        // "tcp", "udp", "tcp+udp", "http", "https"
+	ZeroCopy       bool     `yaml:"zero_copy"`       // Use splice for TCP
+	DefaultBackend string   `yaml:"default_backend"` // Name of the backend pool
+	MaxConnBuffer  int      `yaml:"max_conn_buffer"` // Per-connection buffered bytes ceiling, 0 = unlimited
+	TLSFingerprint bool     `yaml:"tls_fingerprint"` // Log JA3/JA4 of TLS ClientHellos
+	Priority       Priority `yaml:"priority"`        // Traffic class under overload, default normal
+
+	// TLSInspect bounds the ClientHello inspection of tls_fingerprint and
+	// capture_on_reject.
+	TLSInspect TLSInspectConfig `yaml:"tls_inspect,omitempty"`
+
+	// Interface restricts the listener to one network interface
+	// (SO_BINDTODEVICE, linux only), also for wildcard binds.
+	Interface string `yaml:"interface,omitempty"`
+
+	// ParkIdle leaves the ports of the listener on a shared poller until their
+	// first connection instead of starting event loops for them (TCP only).
+	ParkIdle bool `yaml:"park_idle,omitempty"`
+
+	// RateLimit caps new connections (TCP) or sessions (UDP) per client.
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+
+	// Timeouts override the timeouts of the backend, field by field.
+	Timeouts TimeoutsConfig `yaml:"timeouts,omitempty"`
+
+	// CaptureOnReject logs the first bytes of rejected connections (TCP).
+	CaptureOnReject CaptureConfig `yaml:"capture_on_reject,omitempty"`
+
+	// ErrorResponse is sent to TCP clients no backend could take before the
+	// connection is closed.
+	ErrorResponse ErrorResponseConfig `yaml:"error_response,omitempty"`
+
+	// AcceptProxy reads a PROXY protocol v2 header from trusted load
+	// balancers in front of the listener (TCP).
+	AcceptProxy AcceptProxyConfig `yaml:"accept_proxy,omitempty"`
+
+	// Preauth admits only clients that authenticate before their connection
+	// is proxied (TCP).
+	Preauth PreauthConfig `yaml:"preauth,omitempty"`
+
+	// Peer is the metadata passed to the nvelox instances behind the
+	// listener's proxy_v2_peer backends.
+	Peer PeerConfig `yaml:"peer,omitempty"`
+
+	// Socket sets TCP options of the listening and accepted sockets.
+	Socket SocketConfig `yaml:"socket,omitempty"`
+
+	// TraceConnections logs each state transition of a sampled fraction of
+	// the listener's TCP connections, from accept to close. The admin API
+	// toggles it at runtime.
+	TraceConnections bool    `yaml:"trace_connections,omitempty"`
+	TraceSample      float64 `yaml:"trace_sample,omitempty"` // fraction of connections traced, default 1
+
+	// TLS terminates client TLS at the listener, which then talks plain TCP
+	// to the backend. Without a cert, TLS passes through untouched.
+	TLS TLSConfig `yaml:"tls,omitempty"`
+
+	// L7 fields (Placeholder for future)
+	Routes []RouteConfig `yaml:"routes,omitempty"`
+}
+
+// Binds are the addresses a listener accepts connections on. A single address
+// may be written as a plain string.
+type Binds []string
+
+func (b *Binds) UnmarshalYAML(unmarshal func(any) error) error {
+	var addr string
+	if err := unmarshal(&addr); err == nil {
+		*b = Binds{addr}
+		return nil
+	}
+	var addrs []string
+	if err := unmarshal(&addrs); err != nil {
+		return err
+	}
+	*b = addrs
+	return nil
+}
+
+func (b Binds) MarshalYAML() (any, error) {
+	if len(b) == 1 {
+		return b[0], nil
+	}
+	return []string(b), nil
+}
+
+func (b *Binds) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		*b = Binds{addr}
+		return nil
+	}
+	var addrs []string
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return err
+	}
+	*b = addrs
+	return nil
+}
+
+func (b Binds) MarshalJSON() ([]byte, error) {
+	if len(b) == 1 {
+		return json.Marshal(b[0])
+	}
+	return json.Marshal([]string(b))
+}
+
+// Priority classes tell overload protection which traffic must survive:
+// low is shed first, high is never shed.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Valid reports whether p is a known class; empty means the default.
+func (p Priority) Valid() bool {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// RateLimitConfig allows a number of new connections per period for each
+// client key. Shared limits count the connections of every instance using
+// the same redis state store and listener name, each instance adding its
+// own to the fleet total every Sync.
+type RateLimitConfig struct {
+	Connections int       `yaml:"connections"` // per period, 0 disables the limit
+	Period      string    `yaml:"period"`      // duration string (default 1s)
+	Key         ClientKey `yaml:"key,omitempty"`
+	Shared      bool      `yaml:"shared,omitempty"`
+	Sync        string    `yaml:"sync,omitempty"` // duration string (default 100ms), shared limits only
+}
+
+// MaxCaptureBytes caps CaptureConfig.Bytes.
+const MaxCaptureBytes = 4096
+
+// CaptureConfig records what rejected connections sent: the first Bytes
+// bytes and the TLS SNI. A connection rejected before it sent anything is
+// held open for up to Wait to read them.
+type CaptureConfig struct {
+	Bytes int    `yaml:"bytes"`          // 0 disables capturing, at most MaxCaptureBytes
+	Wait  string `yaml:"wait,omitempty"` // duration string (default 1s)
+}
+
+func (c CaptureConfig) validate() error {
+	if c.Bytes < 0 || c.Bytes > MaxCaptureBytes {
+		return fmt.Errorf("bytes must be between 0 and %d", MaxCaptureBytes)
+	}
+	if c.Wait != "" {
+		if d, err := time.ParseDuration(c.Wait); err != nil || d <= 0 {
+			return fmt.Errorf("invalid wait %q", c.Wait)
+		}
+	}
+	return nil
+}
+
+// MaxErrorResponseBytes caps the payload of an ErrorResponseConfig.
+const MaxErrorResponseBytes = 4096
+
+// ErrorResponseConfig is a static payload for clients no backend could take,
+// such as an SMTP "421" line, so they see a protocol error instead of a bare
+// close. Payload is sent as is, Hex is the hex encoding of a binary payload.
+type ErrorResponseConfig struct {
+	Payload string `yaml:"payload,omitempty"`
+	Hex     string `yaml:"hex,omitempty"`
+	Delay   string `yaml:"delay,omitempty"` // duration string, waited before sending
+}
+
+// Bytes returns the decoded payload, nil when none is configured.
+func (r ErrorResponseConfig) Bytes() []byte {
+	if r.Hex != "" {
+		b, _ := hex.DecodeString(r.Hex) // validated with the configuration
+		return b
+	}
+	if r.Payload != "" {
+		return []byte(r.Payload)
+	}
+	return nil
+}
+
+func (r ErrorResponseConfig) validate() error {
+	if r.Payload != "" && r.Hex != "" {
+		return fmt.Errorf("payload and hex are mutually exclusive")
+	}
+	if _, err := hex.DecodeString(r.Hex); err != nil {
+		return fmt.Errorf("invalid hex: %v", err)
+	}
+	if n := len(r.Bytes()); n > MaxErrorResponseBytes {
+		return fmt.Errorf("payload of %d bytes exceeds %d", n, MaxErrorResponseBytes)
+	}
+	if r.Delay != "" {
+		if d, err := time.ParseDuration(r.Delay); err != nil || d < 0 {
+			return fmt.Errorf("invalid delay %q", r.Delay)
+		}
+	}
+	return nil
+}
+
+// AcceptProxyConfig trusts the load balancers at From to send a PROXY
+// protocol v2 header ahead of each connection. Their connections must start
+// with one; the client address it carries replaces theirs, and the TLVs
+// named in TLVs tag the connection. Connections from elsewhere are taken as
+// they are.
+type AcceptProxyConfig struct {
+	From []string       `yaml:"from,omitempty"` // CIDRs or single IPs
+	TLVs map[string]int `yaml:"tlvs,omitempty"` // tag name -> TLV type, e.g. vpce: 0xEA
+}
+
+// Enabled reports whether any load balancer is trusted.
+func (a AcceptProxyConfig) Enabled() bool {
+	return len(a.From) > 0
+}
+
+// Prefixes parses From.
+func (a AcceptProxyConfig) Prefixes() ([]netip.Prefix, error) {
+	return parsePrefixes("from", a.From)
+}
+
+// PeerConfig sets the tenant and routing hints a listener passes, with a
+// connection ID, to the nvelox instances behind its proxy_v2_peer backends.
+// Metadata from a trusted nvelox instance in front of the listener (see
+// accept_proxy) takes precedence: its connection ID and tenant are kept and
+// its hints win over those set here. With Route, the "backend" hint of that
+// metadata picks the backend of a connection instead of default_backend,
+// when such a backend exists.
+type PeerConfig struct {
+	Tenant string            `yaml:"tenant,omitempty"`
+	Hints  map[string]string `yaml:"hints,omitempty"`
+	Route  bool              `yaml:"route,omitempty"`
+}
+
+func (p PeerConfig) validate(acceptProxy bool) error {
+	if len(p.Tenant) > 255 {
+		return fmt.Errorf("tenant longer than 255 bytes")
+	}
+	for k, v := range p.Hints {
+		if !tagName.MatchString(k) {
+			return fmt.Errorf("invalid hint name %q (expected lowercase letters, digits and _)", k)
+		}
+		if len(k)+1+len(v) > 255 {
+			return fmt.Errorf("hint %s longer than 255 bytes", k)
+		}
+	}
+	if p.Route && !acceptProxy {
+		return fmt.Errorf("route requires accept_proxy")
+	}
+	return nil
+}
+
+// minTunnelSecret is the shortest tunnel secret accepted.
+const minTunnelSecret = 16
+
+// TunnelConfig is the peer end of backend tunnels: datagrams tunneled to
+// Bind by other nvelox instances are forwarded to their servers, subject to
+// the egress policy, and the replies tunneled back.
+type TunnelConfig struct {
+	Bind        string `yaml:"bind,omitempty"`         // UDP "host:port" or ":port"
+	Secret      Secret `yaml:"secret,omitempty"`       // shared key of at least 16 bytes, or a reference to it
+	MaxSessions int    `yaml:"max_sessions,omitempty"` // open sessions at most, 4096 when unset
+}
+
+// BackendTunnel sends the sessions of a backend through the tunnel of the
+// nvelox instance at Peer.
+type BackendTunnel struct {
+	Peer   string `yaml:"peer,omitempty"`   // "host:port" of the peer's tunnel.bind
+	Secret Secret `yaml:"secret,omitempty"` // the peer's tunnel secret
+}
+
+// Enabled reports whether the backend is tunneled.
+func (t BackendTunnel) Enabled() bool {
+	return t.Peer != ""
+}
+
+// validateTunnelSecret checks a tunnel secret; what names the tunnel in
+// errors.
+func validateTunnelSecret(what string, secret Secret) error {
+	if len(secret.Value()) < minTunnelSecret {
+		return fmt.Errorf("%s: secret must be at least %d bytes", what, minTunnelSecret)
+	}
+	return nil
+}
+
+// Defaults of PreauthConfig.
+const (
+	DefaultPreauthSkew = 30 * time.Second
+	DefaultKnockTTL    = 30 * time.Second
+)
+
+// minPreauthSecret is the shortest shared secret accepted.
+const minPreauthSecret = 16
+
+// PreauthConfig makes clients authenticate before the listener proxies their
+// connections. With only a secret, each connection starts with a preamble
+// signed with it (see package preauth). With a knock address, a client is
+// admitted for knock_ttl after connecting there, so the proxied protocol
+// stays untouched; with a secret as well, the knock has to carry the
+// preamble. Other connections are closed unanswered.
+type PreauthConfig struct {
+	Secret   Secret `yaml:"secret,omitempty"`    // shared HMAC key of at least 16 bytes, or a reference to it
+	MaxSkew  string `yaml:"max_skew,omitempty"`  // accepted clock difference of a preamble, default 30s
+	Knock    string `yaml:"knock,omitempty"`     // "host:port" or ":port" of the knock listener
+	KnockTTL string `yaml:"knock_ttl,omitempty"` // how long a knock admits its client, default 30s
+}
+
+// Enabled reports whether the listener requires authentication.
+func (p PreauthConfig) Enabled() bool {
+	return !p.Secret.IsZero() || p.Knock != ""
+}
+
+// Limits returns the accepted preamble skew and the knock lifetime.
+func (p PreauthConfig) Limits() (skew, ttl time.Duration) {
+	skew, ttl = DefaultPreauthSkew, DefaultKnockTTL
+	if d, err := time.ParseDuration(p.MaxSkew); err == nil {
+		skew = d
+	}
+	if d, err := time.ParseDuration(p.KnockTTL); err == nil {
+		ttl = d
+	}
+	return skew, ttl
+}
+
+func (p PreauthConfig) validate(binds Binds) error {
+	if !p.Secret.IsZero() && len(p.Secret.Value()) < minPreauthSecret {
+		return fmt.Errorf("secret must be at least %d bytes", minPreauthSecret)
+	}
+	if p.MaxSkew != "" {
+		if d, err := time.ParseDuration(p.MaxSkew); err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_skew %q", p.MaxSkew)
+		}
+	}
+	if p.KnockTTL != "" {
+		if p.Knock == "" {
+			return fmt.Errorf("knock_ttl requires knock")
+		}
+		if d, err := time.ParseDuration(p.KnockTTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid knock_ttl %q", p.KnockTTL)
+		}
+	}
+	if p.Knock == "" {
+		return nil
+	}
+	_, port, err := net.SplitHostPort(p.Knock)
+	if n, perr := strconv.Atoi(port); err != nil || perr != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid knock address %q", p.Knock)
+	}
+	for _, bind := range binds {
+		if _, bport, err := net.SplitHostPort(bind); err == nil && portInRange(port, bport) {
+			return fmt.Errorf("knock port %s is bound by the listener itself", port)
+		}
+	}
+	return nil
+}
+
+// portInRange reports whether port is bport, or within a "start-end" range.
+func portInRange(port, bport string) bool {
+	n, _ := strconv.Atoi(port)
+	lo, hi, ok := strings.Cut(bport, "-")
+	if !ok {
+		hi = lo
+	}
+	start, err1 := strconv.Atoi(lo)
+	end, err2 := strconv.Atoi(hi)
+	return err1 == nil && err2 == nil && n >= start && n <= end
+}
+
+var tagName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func (a AcceptProxyConfig) validate() error {
+	if _, err := a.Prefixes(); err != nil {
+		return err
+	}
+	if len(a.TLVs) > 0 && !a.Enabled() {
+		return fmt.Errorf("tlvs require from")
+	}
+	for name, typ := range a.TLVs {
+		if !tagName.MatchString(name) {
+			return fmt.Errorf("invalid tag name %q (expected lowercase letters, digits and _)", name)
+		}
+		if typ < 0 || typ > 255 {
+			return fmt.Errorf("tlv type of %s must be between 0 and 255", name)
+		}
+	}
+	return nil
+}
+
+// Defaults and ceiling of TLSInspectConfig.
+const (
+	DefaultClientHelloBytes   = 16384
+	MaxClientHelloBytes       = 65536
+	DefaultClientHelloTimeout = 5 * time.Second
+)
+
+// TLSInspectConfig bounds the buffering of ClientHellos fragmented over
+// several reads or TLS records: inspection gives up on one larger than
+// MaxBytes or still incomplete after Timeout, and the connection goes on
+// uninspected.
+type TLSInspectConfig struct {
+	MaxBytes int    `yaml:"max_bytes,omitempty"` // default 16384
+	Timeout  string `yaml:"timeout,omitempty"`   // duration string, default 5s
+}
+
+func (c TLSInspectConfig) validate() error {
+	if c.MaxBytes < 0 || c.MaxBytes > MaxClientHelloBytes {
+		return fmt.Errorf("max_bytes must be between 1 and %d", MaxClientHelloBytes)
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", c.Timeout)
+		}
+	}
+	return nil
+}
+
+// Limits returns MaxBytes and Timeout with their defaults applied.
+func (c TLSInspectConfig) Limits() (int, time.Duration) {
+	n, d := c.MaxBytes, DefaultClientHelloTimeout
+	if n == 0 {
+		n = DefaultClientHelloBytes
+	}
+	if t, err := time.ParseDuration(c.Timeout); err == nil && t > 0 {
+		d = t
+	}
+	return n, d
+}
+
+// SocketConfig sets TCP options of a listener. Unset fields keep the
+// defaults: TCP_NODELAY on, no keepalive, no linger. Durations are rounded
+// down to whole seconds.
+type SocketConfig struct {
+	NoDelay           *bool  `yaml:"nodelay,omitempty"`
+	KeepAlive         string `yaml:"keepalive,omitempty"`          // idle time before the first probe
+	KeepAliveInterval string `yaml:"keepalive_interval,omitempty"` // between probes, default keepalive/5
+	KeepAliveCount    int    `yaml:"keepalive_count,omitempty"`    // unanswered probes before reset, default 5
+	DeferAccept       string `yaml:"defer_accept,omitempty"`       // TCP_DEFER_ACCEPT, linux only
+	FastOpen          int    `yaml:"fastopen,omitempty"`           // TCP_FASTOPEN queue length, linux only
+	Linger            *int   `yaml:"linger,omitempty"`             // SO_LINGER seconds, 0 resets on close
+	Backlog           int    `yaml:"backlog,omitempty"`            // accept queue length, linux only, capped by net.core.somaxconn
+}
+
+// maxBacklog is the largest socket backlog accepted.
+const maxBacklog = 65535
+
+// Listening reports whether the options apply to the listening socket
+// only, which needs the platform support of defer_accept, fastopen and
+// backlog.
+func (s SocketConfig) Listening() bool {
+	return s.DeferAccept != "" || s.FastOpen > 0 || s.Backlog > 0
+}
+
+func (s SocketConfig) validate() error {
+	for _, f := range []struct{ name, value string }{
+		{"keepalive", s.KeepAlive},
+		{"keepalive_interval", s.KeepAliveInterval},
+		{"defer_accept", s.DeferAccept},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(f.value); err != nil || d < time.Second {
+			return fmt.Errorf("invalid %s %q (expected at least 1s)", f.name, f.value)
+		}
+	}
+	if s.KeepAlive == "" && (s.KeepAliveInterval != "" || s.KeepAliveCount != 0) {
+		return fmt.Errorf("keepalive_interval and keepalive_count require keepalive")
+	}
+	if s.KeepAliveCount < 0 {
+		return fmt.Errorf("keepalive_count must not be negative")
+	}
+	if s.FastOpen < 0 {
+		return fmt.Errorf("fastopen must not be negative")
+	}
+	if s.Linger != nil && *s.Linger < 0 {
+		return fmt.Errorf("linger must not be negative")
+	}
+	if s.Backlog < 0 || s.Backlog > maxBacklog {
+		return fmt.Errorf("backlog must be between 0 and %d", maxBacklog)
+	}
+	return nil
+}
+
+// ClientKey aggregates client addresses before counting them. Prefixes of 0
+// keep the exact address; a /24 or /64 treats a whole NAT pool or campus
+// network as one client, /56 a typical IPv6 customer allocation.
+type ClientKey struct {
+	IPv4Prefix int `yaml:"ipv4_prefix"` // 1-32
+	IPv6Prefix int `yaml:"ipv6_prefix"` // 1-128
+}
+
+func (r RateLimitConfig) validate() error {
+	if r.Connections < 0 {
+		return fmt.Errorf("connections must not be negative")
+	}
+	if r.Period != "" {
+		if d, err := time.ParseDuration(r.Period); err != nil || d <= 0 {
+			return fmt.Errorf("invalid period %q", r.Period)
+		}
+	}
+	if r.Key.IPv4Prefix < 0 || r.Key.IPv4Prefix > 32 {
+		return fmt.Errorf("ipv4_prefix must be between 1 and 32")
+	}
+	if r.Key.IPv6Prefix < 0 || r.Key.IPv6Prefix > 128 {
+		return fmt.Errorf("ipv6_prefix must be between 1 and 128")
+	}
+	if r.Sync != "" {
+		if !r.Shared {
+			return fmt.Errorf("sync requires shared")
+		}
+		if d, err := time.ParseDuration(r.Sync); err != nil || d <= 0 {
+			return fmt.Errorf("invalid sync %q", r.Sync)
+		}
+	}
+	return nil
+}
+
+// Protocols returns the transport protocols the listener binds.
+// A combined "tcp+udp" listener binds both on the same address.
+func (l Listener) Protocols() []string {
+	if l.Protocol == "tcp+udp" {
+		return []string{"tcp", "udp"}
+	}
+	return []string{l.Protocol}
+}
+
+// TLSConfig is the certificate a listener terminates TLS with.
+type TLSConfig struct {
+	Cert       Secret `yaml:"cert"` // PEM chain, or a reference to it (see Secret)
+	Key        Secret `yaml:"key"`
+	MinVersion string `yaml:"min_version,omitempty"` // "1.2" (default) or "1.3"
+	AutoCert   bool   `yaml:"auto_cert"`             // placeholder, not implemented
+}
+
+// Enabled reports whether the listener terminates TLS.
+func (t TLSConfig) Enabled() bool {
+	return !t.Cert.IsZero()
+}
+
+func (t TLSConfig) validate() error {
+	if t.Cert.IsZero() != t.Key.IsZero() {
+		return fmt.Errorf("cert and key must be set together")
+	}
+	if t.MinVersion != "" && !t.Enabled() {
+		return fmt.Errorf("min_version requires cert")
+	}
+	if t.MinVersion != "" && t.MinVersion != "1.2" && t.MinVersion != "1.3" {
+		return fmt.Errorf("min_version must be 1.2 or 1.3")
+	}
+	return nil
+}
+
+// RouteConfig placeholder
+type RouteConfig struct {
+	Match   map[string]string `yaml:"match"`
+	Backend string            `yaml:"backend"`
+}
+
+// DefaultsConfig is inherited by every listener and backend, field by
+// field: each only takes the values it leaves unset. Listener timeouts
+// still override the result for their own connections.
+type DefaultsConfig struct {
+	// Inherited by listeners
+	DefaultBackend string   `yaml:"default_backend,omitempty"`
+	Priority       Priority `yaml:"priority,omitempty"`
+
+	// Inherited by backends
+	Balance     string            `yaml:"balance,omitempty"`
+	SendProxyV2 bool              `yaml:"send_proxy_v2,omitempty"`
+	Timeouts    TimeoutsConfig    `yaml:"timeouts,omitempty"`
+	HealthCheck HealthCheckConfig `yaml:"health_check,omitempty"`
+}
+
+// Backend defines a server pool.
+type Backend struct {
+	Name        string   `yaml:"name"`
+	Balance     string   `yaml:"balance"`                 // "roundrobin", "leastconn", "random", "latency"
+	SendProxyV2 *bool    `yaml:"send_proxy_v2,omitempty"` // Send PROXY Protocol v2 header to backend, unset inherits defaults
+	Servers     []Server `yaml:"servers"`                 // Servers, or plain addresses
+
+	// ProxyV2FamilyMismatch handles IPv4/IPv6 client/listener mixes: "skip" (default), "unknown", "map"
+	ProxyV2FamilyMismatch string `yaml:"proxy_v2_family_mismatch"`
+	// ProxyV2Peer adds the connection ID, tenant and routing hints of the
+	// connection to the PROXY header, for nvelox instances as servers.
+	ProxyV2Peer bool `yaml:"proxy_v2_peer,omitempty"`
+
+	HealthCheck HealthCheckConfig `yaml:"health_check,omitempty"`
+	Retry       RetryConfig       `yaml:"retry,omitempty"`
+	Timeouts    TimeoutsConfig    `yaml:"timeouts,omitempty"`
+
+	// Weights sets initial server weights (0-256, default 1); 0 drains a server.
+	// A weight on the server entry itself takes precedence.
+	Weights map[string]int `yaml:"weights,omitempty"`
+
+	// DependsOn marks the backend down while any dependency lacks healthy servers.
+	DependsOn []BackendDependency `yaml:"depends_on,omitempty"`
+
+	// Rebalance periodically looks for servers holding far more than their
+	// share of the connections and, with Terminate, closes some of them.
+	Rebalance RebalanceConfig `yaml:"rebalance,omitempty"`
+
+	// Resolve sets when hostname servers are resolved (default on_dial).
+	Resolve ResolvePolicy `yaml:"resolve,omitempty"`
+
+	// Source is the local address connections to the servers are made from;
+	// several addresses are taken in turn, each with its own ephemeral ports.
+	Source Sources `yaml:"source,omitempty"`
+	// TOS sets the IP_TOS byte (IPv6 traffic class) of those connections.
+	TOS int `yaml:"tos,omitempty"`
+
+	// Tunnel carries the sessions of a UDP backend through a remote nvelox
+	// peer, which reaches the servers from its side.
+	Tunnel BackendTunnel `yaml:"tunnel,omitempty"`
+}
+
+// Sources are the local IPs a backend dials from. A single address may be
+// written as a plain string.
+type Sources []string
+
+func (s *Sources) UnmarshalYAML(unmarshal func(any) error) error {
+	return (*Binds)(s).UnmarshalYAML(unmarshal)
+}
+
+func (s Sources) MarshalYAML() (any, error) { return Binds(s).MarshalYAML() }
+
+func (s *Sources) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil // What an unset Sources marshals to
+		return nil
+	}
+	return (*Binds)(s).UnmarshalJSON(data)
+}
+
+func (s Sources) MarshalJSON() ([]byte, error) { return Binds(s).MarshalJSON() }
+
+// Resolve policy modes.
+const (
+	ResolveOnDial   = "on_dial"  // look the name up on every connection
+	ResolveAtStart  = "at_start" // resolve once when the backend is installed
+	ResolvePeriodic = "periodic" // resolve again every Interval
+)
+
+// ResolvePolicy controls how hostname servers become pool members. With
+// at_start and periodic each answer is a member of its own, so balancing,
+// health checks and max_conns apply per IP; on_dial keeps the name as one
+// member and leaves the choice of IP to the dialer. It is written as a plain
+// mode or as {periodic: 30s}.
+type ResolvePolicy struct {
+	Mode     string // on_dial (default), at_start, periodic
+	Interval string // duration string, periodic only
+}
+
+func (r *ResolvePolicy) UnmarshalYAML(unmarshal func(any) error) error {
+	var mode string
+	if err := unmarshal(&mode); err == nil {
+		*r = ResolvePolicy{Mode: mode}
+		return nil
+	}
+	var periodic struct {
+		Periodic string `yaml:"periodic"`
+	}
+	if err := unmarshal(&periodic); err != nil {
+		return err
+	}
+	*r = ResolvePolicy{Mode: ResolvePeriodic, Interval: periodic.Periodic}
+	return nil
+}
+
+func (r ResolvePolicy) MarshalYAML() (any, error) {
+	if r.Mode == ResolvePeriodic {
+		return map[string]string{"periodic": r.Interval}, nil
+	}
+	return r.Mode, nil
+}
+
+func (r *ResolvePolicy) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err == nil {
+		*r = ResolvePolicy{Mode: mode}
+		return nil
+	}
+	var periodic struct {
+		Periodic string `json:"periodic"`
+	}
+	if err := json.Unmarshal(data, &periodic); err != nil {
+		return err
+	}
+	*r = ResolvePolicy{Mode: ResolvePeriodic, Interval: periodic.Periodic}
+	return nil
+}
+
+func (r ResolvePolicy) MarshalJSON() ([]byte, error) {
+	v, _ := r.MarshalYAML()
+	return json.Marshal(v)
+}
+
+// Pinned reports whether servers are pool members per resolved IP.
+func (r ResolvePolicy) Pinned() bool {
+	return r.Mode == ResolveAtStart || r.Mode == ResolvePeriodic
+}
+
+// Every returns the re-resolution interval, 0 unless periodic.
+func (r ResolvePolicy) Every() time.Duration {
+	if r.Mode != ResolvePeriodic {
+		return 0
+	}
+	d, _ := time.ParseDuration(r.Interval)
+	return d
+}
+
+func (r ResolvePolicy) validate() error {
+	switch r.Mode {
+	case "", ResolveOnDial, ResolveAtStart:
+		if r.Interval != "" {
+			return fmt.Errorf("resolve interval requires periodic")
+		}
+	case ResolvePeriodic:
+		if d, err := time.ParseDuration(r.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid resolve interval %q", r.Interval)
+		}
+	default:
+		return fmt.Errorf("invalid resolve policy %q", r.Mode)
+	}
+	return nil
+}
+
+// RebalanceConfig analyzes the connection distribution of a leastconn or
+// roundrobin pool every Interval. A server is overloaded while it holds more
+// than Threshold times its weighted share of the pool's connections.
+type RebalanceConfig struct {
+	Interval  string  `yaml:"interval,omitempty"`  // duration string; empty disables rebalancing
+	Threshold float64 `yaml:"threshold,omitempty"` // default 1.5
+	MinConns  int     `yaml:"min_conns,omitempty"` // pool connections below which nothing is done (default 10)
+	Terminate bool    `yaml:"terminate,omitempty"` // close the oldest excess sessions; otherwise only log suggestions
+	MaxClose  int     `yaml:"max_close,omitempty"` // sessions closed per interval (default 10)
+}
+
+// Enabled reports whether the pool is analyzed periodically.
+func (r RebalanceConfig) Enabled() bool {
+	return r.Interval != ""
+}
+
+func (r RebalanceConfig) validate(balance string) error {
+	if !r.Enabled() {
+		return nil
+	}
+	if d, err := time.ParseDuration(r.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid rebalance interval %q", r.Interval)
+	}
+	switch balance {
+	case "", "roundrobin", "leastconn":
+	default:
+		return fmt.Errorf("rebalance needs balance leastconn or roundrobin, not %s", balance)
+	}
+	if r.Threshold != 0 && r.Threshold <= 1 {
+		return fmt.Errorf("rebalance threshold must be above 1")
+	}
+	if r.MinConns < 0 || r.MaxClose < 0 {
+		return fmt.Errorf("rebalance min_conns and max_close must not be negative")
+	}
+	return nil
+}
+
+// Server is one server of a backend pool. A plain string is shorthand for
+// an entry with only the address.
+type Server struct {
+	Address  string `yaml:"address"`
+	Weight   *int   `yaml:"weight,omitempty"`    // 0-256, default 1; 0 drains the server
+	MaxConns int    `yaml:"max_conns,omitempty"` // open connections ceiling, 0 = unlimited
+	Backup   bool   `yaml:"backup,omitempty"`    // used only while no primary server is available
+	Disabled bool   `yaml:"disabled,omitempty"`  // kept in the configuration but never selected or checked
+	State    string `yaml:"state,omitempty"`     // administrative state, see ServerStates (default "ready")
+}
+
+// Administrative states of a server, independent of its health. A draining
+// server gets no new connections but keeps its open ones and its health
+// checks; a server in maintenance is not health checked either.
+const (
+	ServerReady = "ready"
+	ServerDrain = "drain"
+	ServerMaint = "maint"
+)
+
+// ServerStates lists the administrative states a server may be put in.
+var ServerStates = []string{ServerReady, ServerDrain, ServerMaint}
+
+// UnmarshalYAML accepts both the address shorthand and the full entry. It
+// uses the callback form so that strict decoding also covers entry keys.
+func (s *Server) UnmarshalYAML(unmarshal func(any) error) error {
+	var addr string
+	if err := unmarshal(&addr); err == nil {
+		*s = Server{Address: addr}
+		return nil
+	}
+	type plain Server
+	return unmarshal((*plain)(s))
+}
+
+// SendsProxyV2 reports whether connections to the servers start with a PROXY
+// protocol v2 header.
+func (b Backend) SendsProxyV2() bool {
+	return b.SendProxyV2 != nil && *b.SendProxyV2
+}
+
+// Addresses returns the addresses of all servers, disabled ones included.
+func (b Backend) Addresses() []string {
+	out := make([]string, len(b.Servers))
+	for i, s := range b.Servers {
+		out[i] = s.Address
+	}
+	return out
+}
+
+// ServerWeights merges Weights with the weights set on server entries.
+func (b Backend) ServerWeights() map[string]int {
+	out := make(map[string]int, len(b.Weights))
+	for server, w := range b.Weights {
+		out[server] = w
+	}
+	for _, s := range b.Servers {
+		if s.Weight != nil {
+			out[s.Address] = *s.Weight
+		}
+	}
+	return out
 }
 
-// Listener defines a frontend listener.
-type Listener struct {
-	Name           string `yaml:"name"`
-	Bind           string `yaml:"bind"`            // e.g., ":80" or "*:1024-2048"
-	Protocol       string `yaml:"protocol"`        // "tcp", "udp", "http", "https"
-	ZeroCopy       bool   `yaml:"zero_copy"`       // Use splice for TCP
-	DefaultBackend string `yaml:"default_backend"` // Name of the backend pool
-
-	// L7 fields (Placeholder for future)
-	TLS    TLSConfig     `yaml:"tls,omitempty"`
-	Routes []RouteConfig `yaml:"routes,omitempty"`
+// BackendDependency requires another backend to have enough healthy servers.
+type BackendDependency struct {
+	Backend    string `yaml:"backend"`
+	MinHealthy int    `yaml:"min_healthy"` // default 1
 }
 
-// TLSConfig placeholder
-type TLSConfig struct {
-	Cert     string `yaml:"cert"`
-	Key      string `yaml:"key"`
-	AutoCert bool   `yaml:"auto_cert"`
+// TimeoutsConfig bounds the phases of a proxied connection. Values are
+// duration strings; empty or "0" means no limit, except for Connect which
+// defaults to 5s.
+type TimeoutsConfig struct {
+	Connect    string `yaml:"connect"`     // each backend dial attempt
+	ClientIdle string `yaml:"client_idle"` // nothing received from the client
+	ServerIdle string `yaml:"server_idle"` // nothing received from the backend; UDP sessions default to 60s
+	SessionMax string `yaml:"session_max"` // total connection lifetime
 }
 
-// RouteConfig placeholder
-type RouteConfig struct {
-	Match   map[string]string `yaml:"match"`
-	Backend string            `yaml:"backend"`
+// Or returns t with unset fields taken from fallback.
+func (t TimeoutsConfig) Or(fallback TimeoutsConfig) TimeoutsConfig {
+	pick := func(v, f string) string {
+		if v == "" {
+			return f
+		}
+		return v
+	}
+	return TimeoutsConfig{
+		Connect:    pick(t.Connect, fallback.Connect),
+		ClientIdle: pick(t.ClientIdle, fallback.ClientIdle),
+		ServerIdle: pick(t.ServerIdle, fallback.ServerIdle),
+		SessionMax: pick(t.SessionMax, fallback.SessionMax),
+	}
 }
 
-// Backend defines a server pool.
-type Backend struct {
-	Name        string   `yaml:"name"`
-	Balance     string   `yaml:"balance"`       // "roundrobin", "leastconn", "random"
-	SendProxyV2 bool     `yaml:"send_proxy_v2"` // Send PROXY Protocol v2 header to backend
-	Servers     []string `yaml:"servers"`       // List of server addresses
+func (t TimeoutsConfig) validate() error {
+	durations := []struct{ name, value string }{
+		{"connect", t.Connect},
+		{"client_idle", t.ClientIdle},
+		{"server_idle", t.ServerIdle},
+		{"session_max", t.SessionMax},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v < 0 {
+			return fmt.Errorf("invalid timeouts %s %q", d.name, d.value)
+		}
+	}
+	return nil
+}
 
-	HealthCheck HealthCheckConfig `yaml:"health_check,omitempty"`
+// RetryConfig controls how failed backend attempts are retried.
+type RetryConfig struct {
+	MaxRetries    int     `yaml:"max_retries"`
+	PerTryTimeout string  `yaml:"per_try_timeout"` // duration string
+	BaseBackoff   string  `yaml:"base_backoff"`    // duration string
+	MaxBackoff    string  `yaml:"max_backoff"`     // duration string
+	BudgetPercent float64 `yaml:"budget_percent"`  // max retries as % of requests, 0 = unlimited
 }
 
 type HealthCheckConfig struct {
 	Active  ActiveHealthCheck  `yaml:"active,omitempty"`
 	Passive PassiveHealthCheck `yaml:"passive,omitempty"`
+	// Off turns the health checks off, those of defaults included. It is
+	// written "health_check: off".
+	Off bool `yaml:"off,omitempty"`
+}
+
+// UnmarshalYAML accepts "off" besides the full block. It uses the callback
+// form so that strict decoding also covers the block keys.
+func (h *HealthCheckConfig) UnmarshalYAML(unmarshal func(any) error) error {
+	var off string
+	if err := unmarshal(&off); err == nil {
+		if off != "off" {
+			return fmt.Errorf("health_check must be a mapping or off, not %q", off)
+		}
+		*h = HealthCheckConfig{Off: true}
+		return nil
+	}
+	type plain HealthCheckConfig
+	return unmarshal((*plain)(h))
+}
+
+// Or returns h with unset fields taken from fallback; a check that is off
+// takes nothing.
+func (h HealthCheckConfig) Or(fallback HealthCheckConfig) HealthCheckConfig {
+	if h.Off {
+		return h
+	}
+	pick := func(v, f string) string {
+		if v == "" {
+			return f
+		}
+		return v
+	}
+	out := h
+	out.Active.Type = pick(h.Active.Type, fallback.Active.Type)
+	out.Active.Path = pick(h.Active.Path, fallback.Active.Path)
+	out.Active.Interval = pick(h.Active.Interval, fallback.Active.Interval)
+	out.Active.Timeout = pick(h.Active.Timeout, fallback.Active.Timeout)
+	if out.Passive.MaxFails == 0 {
+		out.Passive.MaxFails = fallback.Passive.MaxFails
+	}
+	return out
 }
 
 type ActiveHealthCheck struct {
@@ -83,8 +1440,38 @@ type PassiveHealthCheck struct {
 	MaxFails int `yaml:"max_fails"`
 }
 
+// LoadOptions tune how a configuration file is read.
+type LoadOptions struct {
+	// Strict rejects keys that do not map to a config field, so typos such
+	// as "defualt_backend" fail instead of being silently ignored. It also
+	// requires an explicit version.
+	Strict bool
+	// AllowUnknown lists keys tolerated in strict mode, e.g. settings of a
+	// newer release. An entry ending in "*" matches by prefix.
+	AllowUnknown []string
+	// SkipValidation returns the configuration without running Validate, for
+	// tools that report every problem instead of the first one.
+	SkipValidation bool
+	// Layers are files loaded after the main file, its includes and the
+	// files of its config_dirs, in order. Each is decoded over the
+	// configuration merged so far, so the settings it sets override earlier
+	// ones, and a listener or backend it defines replaces the one of the
+	// same name instead of being added.
+	Layers []string
+	// Overrides are applied after the files, includes and all, are merged.
+	Overrides Overrides
+}
+
 // Load reads the configuration from a file.
 func Load(path string) (*Config, error) {
+	return LoadWithOptions(path, LoadOptions{})
+}
+
+// LoadWithOptions reads the configuration from a file with the given options.
+// Files ending in .json or .toml are parsed as JSON or TOML, anything else as
+// YAML; keys are the same in every format. Included files may use any of
+// them.
+func LoadWithOptions(path string, opts LoadOptions) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -92,57 +1479,379 @@ func Load(path string) (*Config, error) {
 
 	// Load main config
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	// Templates run first, so that environment values are never parsed as
+	// template actions
+	if data, err = expandTemplate(path, data, nil); err != nil {
+		return nil, fmt.Errorf("failed to expand config file: %w", err)
+	}
+	data, missing := expandEnv(data)
+	if data, err = toYAML(path, data); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if data, err = fromV3(data, ""); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := decode(data, &cfg, opts); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if cfg.Strict && !opts.Strict {
+		// Decode again, now rejecting the keys the first pass ignored
+		opts.Strict = true
+		cfg = Config{}
+		if err := decode(data, &cfg, opts); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	cfg.Warnings = append(cfg.Warnings, missing...)
 
-	// Process Include
-	if cfg.Include != "" {
-		matches, err := filepath.Glob(cfg.Include)
+	// Process Include: each file is decoded over the configuration merged so
+	// far, so the settings it sets override earlier ones, while its
+	// listeners and backends are appended
+	files, err := cfg.Include.Files()
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]includeUsage, 0, len(files))
+	for _, match := range files {
+		if sameFile(match, path) {
+			continue // a directory include holding the main file
+		}
+		subData, err := readMerged(match, "included", &cfg)
 		if err != nil {
-			return nil, fmt.Errorf("bad include glob pattern: %w", err)
+			return nil, err
+		}
+		listeners, backends, services := cfg.Listeners, cfg.Backends, cfg.Services
+		if err := decodeMerged(subData, match, "included", &cfg, opts); err != nil {
+			return nil, err
 		}
+		usage = append(usage, newIncludeUsage(match, cfg.Listeners, cfg.Backends, cfg.Services))
+		cfg.Listeners = append(listeners, cfg.Listeners...)
+		cfg.Backends = append(backends, cfg.Backends...)
+		cfg.Services = append(services, cfg.Services...)
+	}
 
-		for _, match := range matches {
-			subData, err := os.ReadFile(match)
-			if err != nil {
-				// Warn but continue? Or fail? Nginx fails usually.
-				return nil, fmt.Errorf("failed to read included config %s: %w", match, err)
-			}
-			var subCfg Config
-			if err := yaml.Unmarshal(subData, &subCfg); err != nil {
-				return nil, fmt.Errorf("failed to parse included config %s: %w", match, err)
-			}
+	if err := checkIncludeQuotas(cfg.IncludeQuotas, usage); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyLayers(path, opts); err != nil {
+		return nil, err
+	}
+
+	if err := opts.Overrides.Apply(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Version == "" {
+		if opts.Strict {
+			return nil, fmt.Errorf("config validation failed: version is required in strict mode")
+		}
+		cfg.Version = "2"
+		cfg.Warnings = append(cfg.Warnings, "no version set, assuming version: 2")
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	if opts.SkipValidation {
+		return &cfg, nil
+	}
+	if err := Validate(&cfg); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// readMerged reads a file merged into cfg, an included one or a layer, and
+// returns it as YAML. The file is in the layout of its own version, or else
+// of the main file's.
+func readMerged(file, what string, cfg *Config) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s config %s: %w", what, file, err)
+	}
+	if data, err = expandTemplate(file, data, cfg.Vars); err != nil {
+		return nil, fmt.Errorf("failed to expand %s config %s: %w", what, file, err)
+	}
+	data, missing := expandEnv(data)
+	cfg.Warnings = append(cfg.Warnings, missing...)
+	if data, err = toYAML(file, data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s config %s: %w", what, file, err)
+	}
+	if data, err = fromV3(data, cfg.Version); err != nil {
+		return nil, fmt.Errorf("failed to parse %s config %s: %w", what, file, err)
+	}
+	return data, nil
+}
+
+// decodeMerged decodes a file read by readMerged over cfg, leaving
+// cfg.Listeners and cfg.Backends to the ones the file defines. The settings
+// only the main file sets are kept.
+func decodeMerged(data []byte, file, what string, cfg *Config, opts LoadOptions) error {
+	version, strict, include, quotas, dirs := cfg.Version, cfg.Strict, cfg.Include, cfg.IncludeQuotas, cfg.ConfigDirs
+	cfg.Listeners, cfg.Backends, cfg.Services = nil, nil, nil
+	if err := decode(data, cfg, opts); err != nil {
+		return fmt.Errorf("failed to parse %s config %s: %w", what, file, err)
+	}
+	cfg.Version, cfg.Strict = version, strict
+	if !slices.Equal(cfg.Include, include) {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("%s config %s: include is ignored, includes do not nest", what, file))
+		cfg.Include = include
+	}
+	if !slices.Equal(cfg.IncludeQuotas, quotas) {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("%s config %s: include_quotas is ignored, only the main file sets quotas", what, file))
+		cfg.IncludeQuotas = quotas
+	}
+	if !slices.Equal(cfg.ConfigDirs, dirs) {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("%s config %s: config_dirs is ignored, only the main file sets them", what, file))
+		cfg.ConfigDirs = dirs
+	}
+	return nil
+}
+
+// sameFile reports whether a and b name the same file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// unknownFieldRe matches yaml.v3 KnownFields errors.
+var unknownFieldRe = regexp.MustCompile(`field (\S+) not found in type`)
+
+func decode(data []byte, cfg *Config, opts LoadOptions) error {
+	if !opts.Strict {
+		return yaml.Unmarshal(data, cfg)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(cfg)
+	if err == nil || err == io.EOF {
+		return nil
+	}
+
+	// The document is still decoded as far as possible; drop allowlisted keys
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	remaining := make([]string, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		if m := unknownFieldRe.FindStringSubmatch(msg); m != nil && allowed(m[1], opts.AllowUnknown) {
+			continue
+		}
+		remaining = append(remaining, msg)
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+	return &yaml.TypeError{Errors: remaining}
+}
 
-			// Append lists
-			cfg.Listeners = append(cfg.Listeners, subCfg.Listeners...)
-			cfg.Backends = append(cfg.Backends, subCfg.Backends...)
+func allowed(key string, allowlist []string) bool {
+	for _, a := range allowlist {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == a {
+			return true
 		}
 	}
+	return false
+}
 
-	// Apply Defaults
+// ApplyDefaults fills in unset fields with their default values.
+func (cfg *Config) ApplyDefaults() {
+	cfg.expandServices()
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "info"
 	}
+	if cfg.Logging.LevelRevert == "" {
+		cfg.Logging.LevelRevert = "15m"
+	}
+	d := cfg.Defaults
 	for i := range cfg.Listeners {
+		if cfg.Listeners[i].DefaultBackend == "" {
+			cfg.Listeners[i].DefaultBackend = d.DefaultBackend
+		}
+		if cfg.Listeners[i].Priority == "" {
+			cfg.Listeners[i].Priority = d.Priority
+		}
+		binds := cfg.Listeners[i].Bind
+		if len(binds) == 0 {
+			binds = Binds{""}
+		}
+		cfg.Listeners[i].Bind = make(Binds, len(binds))
+		for j, bind := range binds {
+			cfg.Listeners[i].Bind[j] = cfg.Server.defaultBind(bind)
+		}
+		if knock := cfg.Listeners[i].Preauth.Knock; knock != "" {
+			cfg.Listeners[i].Preauth.Knock = ServerConfig{Host: cfg.Server.Host}.defaultBind(knock)
+		}
 		if cfg.Listeners[i].Protocol == "" {
 			cfg.Listeners[i].Protocol = "tcp"
 		}
+		if cfg.Listeners[i].Priority == "" {
+			cfg.Listeners[i].Priority = PriorityNormal
+		}
 	}
-
-	if err := validate(&cfg); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	for i := range cfg.Backends {
+		b := &cfg.Backends[i]
+		if b.Balance == "" {
+			b.Balance = d.Balance
+		}
+		if b.SendProxyV2 == nil && d.SendProxyV2 {
+			send := true
+			b.SendProxyV2 = &send
+		}
+		b.Timeouts = b.Timeouts.Or(d.Timeouts)
+		b.HealthCheck = b.HealthCheck.Or(d.HealthCheck)
+		b.Servers = expandServers(b.Servers)
 	}
+}
 
-	return &cfg, nil
+// maxInterfaceName is the longest interface name linux accepts (IFNAMSIZ-1).
+const maxInterfaceName = 15
+
+// validInterface reports whether name can be an interface name; empty means none.
+func validInterface(name string) bool {
+	if name == "" {
+		return true
+	}
+	if len(name) > maxInterfaceName || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/: \t\n")
 }
 
-func validate(cfg *Config) error {
-	if cfg.Version != "2" {
-		return fmt.Errorf("unsupported version: %s (expected '2')", cfg.Version)
+// Validate checks the semantic consistency of a configuration.
+func Validate(cfg *Config) error {
+	if cfg.Version != "2" && cfg.Version != "3" {
+		return fmt.Errorf("unsupported version: %s (expected '2' or '3')", cfg.Version)
+	}
+
+	if cfg.Server.Port < 0 || cfg.Server.Port > 65535 {
+		return fmt.Errorf("server port %d out of range", cfg.Server.Port)
+	}
+	if cfg.Server.MaxOpenFiles < 0 || cfg.Server.ExpectedConnections < 0 {
+		return fmt.Errorf("server max_open_files and expected_connections must not be negative")
+	}
+	if s := cfg.Server.DrainTimeout; s != "" {
+		if d, err := time.ParseDuration(s); err != nil || d < 0 {
+			return fmt.Errorf("server drain_timeout %q must be a non-negative duration", s)
+		}
+	}
+
+	if err := cfg.Server.Engine.validate(); err != nil {
+		return fmt.Errorf("server engine: %w", err)
+	}
+
+	if err := cfg.SessionEvents.validate(); err != nil {
+		return fmt.Errorf("session_events: %w", err)
+	}
+
+	if _, err := cfg.Egress.Prefixes(); err != nil {
+		return fmt.Errorf("egress: %w", err)
+	}
+
+	if err := cfg.State.validate(); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+
+	if err := cfg.Defaults.Timeouts.validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	if !cfg.Defaults.Priority.Valid() {
+		return fmt.Errorf("defaults: invalid priority %q", cfg.Defaults.Priority)
+	}
+	if cfg.Defaults.HealthCheck.Off {
+		return fmt.Errorf("defaults: health_check cannot be off, leave it out instead")
+	}
+
+	for name, ips := range cfg.Hosts {
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("hosts entry %s: invalid IP %q", name, ip)
+			}
+			if !cfg.Egress.Allows(ip) {
+				return fmt.Errorf("hosts entry %s: %s is not allowed by egress", name, ip)
+			}
+		}
+	}
+
+	if err := cfg.Admin.validate(); err != nil {
+		return fmt.Errorf("admin: %w", err)
+	}
+	if err := cfg.Admin.GRPC.validate(); err != nil {
+		return fmt.Errorf("admin grpc: %w", err)
+	}
+
+	if i := cfg.Admin.StatsInterval; i != "" {
+		if d, err := time.ParseDuration(i); err != nil || d <= 0 {
+			return fmt.Errorf("admin: invalid stats_interval %q", i)
+		}
+	}
+
+	if a := cfg.Admin.ResolveCacheMaxAge; a != "" {
+		if d, err := time.ParseDuration(a); err != nil || d <= 0 {
+			return fmt.Errorf("admin: invalid resolve_cache_max_age %q", a)
+		}
+	}
+
+	if r := cfg.Logging.LevelRevert; r != "" {
+		if d, err := time.ParseDuration(r); err != nil || d < 0 {
+			return fmt.Errorf("logging: invalid level_revert %q", r)
+		}
+	}
+
+	if err := cfg.Logging.Units.validate(); err != nil {
+		return fmt.Errorf("logging units: %w", err)
+	}
+
+	for i, sink := range cfg.Logging.AccessSinks {
+		switch sink.Type {
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("access sink %d: file sink requires a path", i)
+			}
+		case "syslog":
+			if sink.Address == "" {
+				return fmt.Errorf("access sink %d: syslog sink requires an address", i)
+			}
+		case "webhook":
+			if sink.URL == "" {
+				return fmt.Errorf("access sink %d: webhook sink requires a url", i)
+			}
+		default:
+			return fmt.Errorf("access sink %d: unknown type %q", i, sink.Type)
+		}
+	}
+
+	if err := validateShedding(cfg.Shedding); err != nil {
+		return fmt.Errorf("shedding: %w", err)
+	}
+
+	if cfg.Tunnel.Bind != "" {
+		if _, _, err := net.SplitHostPort(cfg.Tunnel.Bind); err != nil {
+			return fmt.Errorf("tunnel: invalid bind %q", cfg.Tunnel.Bind)
+		}
+		if cfg.Tunnel.MaxSessions < 0 {
+			return fmt.Errorf("tunnel: max_sessions must not be negative")
+		}
+		if err := validateTunnelSecret("tunnel", cfg.Tunnel.Secret); err != nil {
+			return err
+		}
 	}
 
 	backendNames := make(map[string]bool)
+	tunneled := make(map[string]bool)
 	for _, b := range cfg.Backends {
 		if b.Name == "" {
 			return fmt.Errorf("backend must have a name")
@@ -151,19 +1860,285 @@ func validate(cfg *Config) error {
 			return fmt.Errorf("duplicate backend name: %s", b.Name)
 		}
 		backendNames[b.Name] = true
+
+		switch b.ProxyV2FamilyMismatch {
+		case "", "skip", "unknown", "map":
+		default:
+			return fmt.Errorf("backend %s: invalid proxy_v2_family_mismatch %q", b.Name, b.ProxyV2FamilyMismatch)
+		}
+		if b.ProxyV2Peer && !b.SendsProxyV2() {
+			return fmt.Errorf("backend %s: proxy_v2_peer requires send_proxy_v2", b.Name)
+		}
+
+		if err := validateRetry(b.Retry); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		if err := b.Rebalance.validate(b.Balance); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		if err := b.Resolve.validate(); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		if err := b.Timeouts.validate(); err != nil {
+			return fmt.Errorf("backend %s: %w", b.Name, err)
+		}
+		if hc := b.HealthCheck; hc.Off && (hc.Active != (ActiveHealthCheck{}) || hc.Passive != (PassiveHealthCheck{})) {
+			return fmt.Errorf("backend %s: health_check off takes no other settings", b.Name)
+		}
+		for _, src := range b.Source {
+			if _, err := netip.ParseAddr(src); err != nil {
+				return fmt.Errorf("backend %s: invalid source %q", b.Name, src)
+			}
+		}
+		if b.TOS < 0 || b.TOS > 255 {
+			return fmt.Errorf("backend %s: tos must be between 0 and 255", b.Name)
+		}
+		if b.Tunnel.Enabled() {
+			host, _, err := net.SplitHostPort(b.Tunnel.Peer)
+			if err != nil {
+				return fmt.Errorf("backend %s tunnel: invalid peer %q", b.Name, b.Tunnel.Peer)
+			}
+			if err := validateTunnelSecret("backend "+b.Name+" tunnel", b.Tunnel.Secret); err != nil {
+				return err
+			}
+			if !cfg.Egress.Allows(host) {
+				return fmt.Errorf("backend %s: tunnel peer %s is not allowed by egress", b.Name, b.Tunnel.Peer)
+			}
+			tunneled[b.Name] = true
+		} else if !b.Tunnel.Secret.IsZero() {
+			return fmt.Errorf("backend %s tunnel: secret requires peer", b.Name)
+		}
+
+		addrs := b.Addresses()
+		for i, s := range b.Servers {
+			if s.Address == "" {
+				return fmt.Errorf("backend %s: server %d has no address", b.Name, i)
+			}
+			if _, ok, err := expandServer(s); ok {
+				if err == nil {
+					err = fmt.Errorf("not expanded")
+				}
+				return fmt.Errorf("backend %s: server %s: %w", b.Name, s.Address, err)
+			}
+			if slices.Contains(addrs[:i], s.Address) {
+				return fmt.Errorf("backend %s: duplicate server %s", b.Name, s.Address)
+			}
+			if s.MaxConns < 0 {
+				return fmt.Errorf("backend %s: max_conns of %s must not be negative", b.Name, s.Address)
+			}
+			if s.State != "" && !slices.Contains(ServerStates, s.State) {
+				return fmt.Errorf("backend %s: server %s: state must be one of %s", b.Name, s.Address, strings.Join(ServerStates, ", "))
+			}
+			host, _, err := net.SplitHostPort(s.Address)
+			if err != nil {
+				host = s.Address
+			}
+			// The peer of a tunnel reaches the servers under its own egress
+			if !b.Tunnel.Enabled() && !cfg.Egress.Allows(host) {
+				return fmt.Errorf("backend %s: server %s is not allowed by egress", b.Name, s.Address)
+			}
+		}
+		for server := range b.Weights {
+			if !slices.Contains(addrs, server) {
+				return fmt.Errorf("backend %s: weight for unknown server %s", b.Name, server)
+			}
+		}
+		for server, w := range b.ServerWeights() {
+			if w < 0 || w > 256 {
+				return fmt.Errorf("backend %s: weight of %s must be between 0 and 256", b.Name, server)
+			}
+		}
+	}
+
+	if err := validateDependencies(cfg.Backends, backendNames); err != nil {
+		return err
 	}
 
+	listenerNames := make(map[string]bool)
 	for _, l := range cfg.Listeners {
 		if l.Name == "" {
 			return fmt.Errorf("listener must have a name")
 		}
-		if l.Bind == "" {
+		if listenerNames[l.Name] {
+			return fmt.Errorf("duplicate listener name: %s", l.Name)
+		}
+		listenerNames[l.Name] = true
+		if len(l.Bind) == 0 {
 			return fmt.Errorf("listener %s must have a bind address", l.Name)
 		}
+		for j, bind := range l.Bind {
+			if bind == "" {
+				return fmt.Errorf("listener %s must have a bind address", l.Name)
+			}
+			if slices.Contains(l.Bind[:j], bind) {
+				return fmt.Errorf("listener %s binds %s twice", l.Name, bind)
+			}
+		}
+		switch l.Protocol {
+		case "", "tcp", "udp", "tcp+udp", "http", "https":
+		default:
+			return fmt.Errorf("listener %s has unknown protocol %q", l.Name, l.Protocol)
+		}
+		if l.MaxConnBuffer < 0 {
+			return fmt.Errorf("listener %s max_conn_buffer must not be negative", l.Name)
+		}
+		if l.ParkIdle && l.Protocol != "" && l.Protocol != "tcp" {
+			return fmt.Errorf("listener %s: park_idle requires protocol tcp", l.Name)
+		}
+		if !validInterface(l.Interface) {
+			return fmt.Errorf("listener %s has invalid interface %q", l.Name, l.Interface)
+		}
+		if l.ErrorResponse.Bytes() != nil && l.Protocol == "udp" {
+			return fmt.Errorf("listener %s: error_response requires tcp", l.Name)
+		}
+		if l.Socket != (SocketConfig{}) && l.Protocol == "udp" {
+			return fmt.Errorf("listener %s: socket requires tcp", l.Name)
+		}
+		if l.ParkIdle && cfg.Server.User != "" {
+			// Promotion binds the ports again, after privileges are dropped
+			return fmt.Errorf("listener %s: park_idle cannot be combined with server.user", l.Name)
+		}
+		if !l.Priority.Valid() {
+			return fmt.Errorf("listener %s has invalid priority %q", l.Name, l.Priority)
+		}
+		if err := l.RateLimit.validate(); err != nil {
+			return fmt.Errorf("listener %s rate_limit: %w", l.Name, err)
+		}
+		if l.RateLimit.Shared && cfg.State.Type != "redis" {
+			return fmt.Errorf("listener %s rate_limit: shared requires a redis state store", l.Name)
+		}
+		if err := l.CaptureOnReject.validate(); err != nil {
+			return fmt.Errorf("listener %s capture_on_reject: %w", l.Name, err)
+		}
+		if err := l.ErrorResponse.validate(); err != nil {
+			return fmt.Errorf("listener %s error_response: %w", l.Name, err)
+		}
+		if l.AcceptProxy.Enabled() && l.Protocol == "udp" {
+			return fmt.Errorf("listener %s: accept_proxy requires tcp", l.Name)
+		}
+		if l.Preauth.Enabled() && slices.Contains(l.Protocols(), "udp") {
+			return fmt.Errorf("listener %s: preauth requires tcp", l.Name)
+		}
+		if err := l.Preauth.validate(l.Bind); err != nil {
+			return fmt.Errorf("listener %s preauth: %w", l.Name, err)
+		}
+		if err := l.TLS.validate(); err != nil {
+			return fmt.Errorf("listener %s tls: %w", l.Name, err)
+		}
+		if l.TLS.Enabled() && slices.Contains(l.Protocols(), "udp") {
+			return fmt.Errorf("listener %s: tls requires tcp", l.Name)
+		}
+		if l.TraceConnections && l.Protocol == "udp" {
+			return fmt.Errorf("listener %s: trace_connections requires tcp", l.Name)
+		}
+		if l.TraceSample < 0 || l.TraceSample > 1 {
+			return fmt.Errorf("listener %s: trace_sample must be between 0 and 1", l.Name)
+		}
+		if err := l.AcceptProxy.validate(); err != nil {
+			return fmt.Errorf("listener %s accept_proxy: %w", l.Name, err)
+		}
+		if err := l.Peer.validate(l.AcceptProxy.Enabled()); err != nil {
+			return fmt.Errorf("listener %s peer: %w", l.Name, err)
+		}
+		if err := l.TLSInspect.validate(); err != nil {
+			return fmt.Errorf("listener %s tls_inspect: %w", l.Name, err)
+		}
+		if err := l.Socket.validate(); err != nil {
+			return fmt.Errorf("listener %s socket: %w", l.Name, err)
+		}
+		if err := l.Timeouts.validate(); err != nil {
+			return fmt.Errorf("listener %s: %w", l.Name, err)
+		}
 		if l.DefaultBackend != "" && !backendNames[l.DefaultBackend] {
 			return fmt.Errorf("listener %s references unknown backend: %s", l.Name, l.DefaultBackend)
 		}
+		if tunneled[l.DefaultBackend] && l.Protocol != "udp" {
+			return fmt.Errorf("listener %s: backend %s is tunneled, which carries udp only", l.Name, l.DefaultBackend)
+		}
+	}
+
+	return nil
+}
+
+func validateDependencies(backends []Backend, names map[string]bool) error {
+	deps := make(map[string][]string)
+	for _, b := range backends {
+		for _, d := range b.DependsOn {
+			if !names[d.Backend] {
+				return fmt.Errorf("backend %s depends on unknown backend: %s", b.Name, d.Backend)
+			}
+			if d.MinHealthy < 0 {
+				return fmt.Errorf("backend %s: min_healthy must not be negative", b.Name)
+			}
+			deps[b.Name] = append(deps[b.Name], d.Backend)
+		}
+	}
+
+	// Reject cycles, which could never become healthy
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("backend dependency cycle through %s", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, d := range deps[name] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, b := range backends {
+		if err := visit(b.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateShedding(s SheddingConfig) error {
+	if s.Interval != "" {
+		if _, err := time.ParseDuration(s.Interval); err != nil {
+			return fmt.Errorf("invalid interval %q: %w", s.Interval, err)
+		}
+	}
+	if s.CPULoad < 0 || s.MemoryPercent < 0 || s.MemoryPercent > 100 || s.FDPercent < 0 || s.FDPercent > 100 {
+		return fmt.Errorf("thresholds must be non-negative and percentages at most 100")
+	}
+	if s.Fraction < 0 || s.Fraction > 1 || s.NormalFraction < 0 || s.NormalFraction > 1 {
+		return fmt.Errorf("fractions must be between 0 and 1")
 	}
+	return nil
+}
 
+func validateRetry(r RetryConfig) error {
+	if r.MaxRetries < 0 {
+		return fmt.Errorf("retry max_retries must not be negative")
+	}
+	if r.BudgetPercent < 0 || r.BudgetPercent > 100 {
+		return fmt.Errorf("retry budget_percent must be between 0 and 100")
+	}
+	durations := []struct{ name, value string }{
+		{"per_try_timeout", r.PerTryTimeout},
+		{"base_backoff", r.BaseBackoff},
+		{"max_backoff", r.MaxBackoff},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			return fmt.Errorf("invalid retry %s %q: %w", d.name, d.value, err)
+		}
+	}
 	return nil
 }
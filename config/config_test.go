@@ -1,14 +1,20 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig_Validation(t *testing.T) {
-	// 1. Missing Version
+	// 1. Missing Version defaults to 2 with a warning, but fails in strict mode
 	cfgContent := `
 server:
   user: "nobody"
@@ -18,9 +24,15 @@ server:
 	tmp.WriteString(cfgContent)
 	tmp.Close()
 
-	_, err := Load(tmp.Name())
-	if err == nil {
-		t.Error("Expected error for missing version, got nil")
+	cfg, err := Load(tmp.Name())
+	if err != nil {
+		t.Fatalf("Expected missing version to default, got %v", err)
+	}
+	if cfg.Version != "2" || len(cfg.Warnings) != 1 {
+		t.Errorf("Expected version 2 with a warning, got %q, %v", cfg.Version, cfg.Warnings)
+	}
+	if _, err := LoadWithOptions(tmp.Name(), LoadOptions{Strict: true}); err == nil {
+		t.Error("Expected error for missing version in strict mode, got nil")
 	}
 
 	// 2. Unsupported Version
@@ -68,6 +80,9 @@ listeners:
 	if cfg.Listeners[0].Protocol != "tcp" {
 		t.Errorf("Expected default protocol 'tcp', got '%s'", cfg.Listeners[0].Protocol)
 	}
+	if cfg.Listeners[0].Priority != PriorityNormal {
+		t.Errorf("Expected default priority 'normal', got '%s'", cfg.Listeners[0].Priority)
+	}
 }
 
 func TestLoadConfig_Full(t *testing.T) {
@@ -198,3 +213,1661 @@ listeners:
 		t.Error("expected error listener unknown backend")
 	}
 }
+
+func TestListener_Protocols(t *testing.T) {
+	tests := []struct {
+		protocol string
+		want     []string
+	}{
+		{"tcp", []string{"tcp"}},
+		{"udp", []string{"udp"}},
+		{"tcp+udp", []string{"tcp", "udp"}},
+	}
+
+	for _, tt := range tests {
+		got := Listener{Protocol: tt.protocol}.Protocols()
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Protocols(%q) = %v, want %v", tt.protocol, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_Protocol(t *testing.T) {
+	cfg := &Config{Version: "2", Listeners: []Listener{{Name: "dns", Bind: Binds{":53"}, Protocol: "tcp+udp"}}}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("tcp+udp rejected: %v", err)
+	}
+	cfg.Listeners[0].Protocol = "udp+tcp"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "unknown protocol") {
+		t.Errorf("expected unknown protocol error, got %v", err)
+	}
+}
+
+func TestValidate_Egress(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			Version: "2",
+			Egress:  EgressConfig{Allow: []string{"10.0.0.0/8", "192.168.1.5"}},
+			Hosts:   map[string][]string{"db.internal": {"10.0.0.7"}},
+			Backends: []Backend{{Name: "b", Servers: []Server{
+				{Address: "10.0.0.1:80"}, {Address: "192.168.1.5"}, {Address: "db.internal:5432"},
+			}}},
+		}
+	}
+	if err := Validate(base()); err != nil {
+		t.Fatalf("valid egress config rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"bad cidr", func(c *Config) { c.Egress.Allow = append(c.Egress.Allow, "10.0.0.0/33") }, "invalid allow entry"},
+		{"server outside", func(c *Config) { c.Backends[0].Servers[0].Address = "127.0.0.1:80" }, "not allowed by egress"},
+		{"hosts outside", func(c *Config) { c.Hosts["db.internal"] = []string{"192.168.1.6"} }, "not allowed by egress"},
+	}
+	for _, tt := range tests {
+		cfg := base()
+		tt.modify(cfg)
+		if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q error, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestValidate_SessionEvents(t *testing.T) {
+	tests := []struct {
+		cfg  SessionEventsConfig
+		want string // empty when valid
+	}{
+		{SessionEventsConfig{}, ""},
+		{SessionEventsConfig{URL: "https://broker.local/sessions", BatchSize: 50, FlushInterval: "200ms"}, ""},
+		{SessionEventsConfig{URL: "broker.local/sessions"}, "invalid url"},
+		{SessionEventsConfig{URL: "http://broker.local", BatchSize: -1}, "batch_size"},
+		{SessionEventsConfig{URL: "http://broker.local", FlushInterval: "0s"}, "flush_interval"},
+		{SessionEventsConfig{URL: "http://broker.local", Retry: RetryConfig{MaxRetries: -1}}, "max_retries"},
+	}
+	for _, tt := range tests {
+		err := Validate(&Config{Version: "2", SessionEvents: tt.cfg})
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error %v", tt.cfg, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%+v: expected %q error, got %v", tt.cfg, tt.want, err)
+		}
+	}
+}
+
+func TestValidate_Rebalance(t *testing.T) {
+	tests := []struct {
+		balance string
+		cfg     RebalanceConfig
+		want    string // empty when valid
+	}{
+		{"random", RebalanceConfig{}, ""},
+		{"leastconn", RebalanceConfig{Interval: "30s", Threshold: 2, Terminate: true, MaxClose: 5}, ""},
+		{"", RebalanceConfig{Interval: "30s"}, ""},
+		{"latency", RebalanceConfig{Interval: "30s"}, "leastconn or roundrobin"},
+		{"leastconn", RebalanceConfig{Interval: "soon"}, "interval"},
+		{"leastconn", RebalanceConfig{Interval: "30s", Threshold: 0.8}, "threshold"},
+		{"leastconn", RebalanceConfig{Interval: "30s", MaxClose: -1}, "max_close"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Version: "2", Backends: []Backend{{Name: "b", Balance: tt.balance, Rebalance: tt.cfg}}}
+		err := Validate(cfg)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s %+v: unexpected error %v", tt.balance, tt.cfg, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %+v: expected %q error, got %v", tt.balance, tt.cfg, tt.want, err)
+		}
+	}
+}
+
+func TestValidate_OpenFiles(t *testing.T) {
+	cfg := &Config{Version: "2", Server: ServerConfig{MaxOpenFiles: 65536}}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := cfg.Server.ExpectedConns(); n != DefaultExpectedConnections {
+		t.Errorf("ExpectedConns() = %d, want the default", n)
+	}
+	cfg.Server.ExpectedConnections = -1
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for negative expected_connections")
+	}
+	cfg.Server.ExpectedConnections = 0
+	cfg.Server.Engine.NumEventLoops = -1
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for negative num_event_loops")
+	}
+}
+
+func TestValidate_DrainTimeout(t *testing.T) {
+	for timeout, want := range map[string]time.Duration{"": DefaultDrainTimeout, "0": 0, "2m": 2 * time.Minute} {
+		cfg := &Config{Version: "2", Server: ServerConfig{DrainTimeout: timeout}}
+		if err := Validate(cfg); err != nil {
+			t.Errorf("%q: unexpected error %v", timeout, err)
+		}
+		if d := cfg.Server.DrainWait(); d != want {
+			t.Errorf("%q: DrainWait() = %v, want %v", timeout, d, want)
+		}
+	}
+	for _, timeout := range []string{"-1s", "soon"} {
+		cfg := &Config{Version: "2", Server: ServerConfig{DrainTimeout: timeout}}
+		if err := Validate(cfg); err == nil {
+			t.Errorf("%q: expected an error", timeout)
+		}
+	}
+}
+
+func TestValidate_ParkIdle(t *testing.T) {
+	for proto, ok := range map[string]bool{"": true, "tcp": true, "udp": false, "tcp+udp": false} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000-10010"}, Protocol: proto, ParkIdle: true}}}
+		if err := Validate(cfg); (err == nil) != ok {
+			t.Errorf("protocol %q: unexpected result %v", proto, err)
+		}
+	}
+
+	// Parked ports are bound again after privileges are dropped
+	cfg := &Config{Version: "2", Server: ServerConfig{User: "nobody"}, Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, ParkIdle: true}}}
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for park_idle with server.user")
+	}
+}
+
+func TestValidate_LogUnits(t *testing.T) {
+	for units, ok := range map[LogUnits]bool{
+		{}:                              true,
+		{Duration: "us", Size: "human"}: true,
+		{Duration: "ns"}:                false,
+		{Size: "KB"}:                    false,
+	} {
+		cfg := &Config{Version: "2", Logging: LoggingConfig{Units: units}}
+		if err := Validate(cfg); (err == nil) != ok {
+			t.Errorf("%+v: unexpected result %v", units, err)
+		}
+	}
+}
+
+func TestValidate_Interface(t *testing.T) {
+	for iface, ok := range map[string]bool{"": true, "eth0": true, "bond0.100": true, "eth0:1": false, "a/b": false, "..": false, "averyveryverylongname": false} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, Interface: iface}}}
+		if err := Validate(cfg); (err == nil) != ok {
+			t.Errorf("interface %q: unexpected result %v", iface, err)
+		}
+	}
+}
+
+func TestValidate_ErrorResponse(t *testing.T) {
+	for _, c := range []struct {
+		resp  ErrorResponseConfig
+		proto string
+		ok    bool
+	}{
+		{ErrorResponseConfig{Payload: "421 busy\r\n", Delay: "1s"}, "tcp", true},
+		{ErrorResponseConfig{Hex: "0000000101"}, "", true},
+		{ErrorResponseConfig{Payload: "x", Hex: "78"}, "tcp", false},
+		{ErrorResponseConfig{Hex: "zz"}, "tcp", false},
+		{ErrorResponseConfig{Payload: strings.Repeat("x", MaxErrorResponseBytes+1)}, "tcp", false},
+		{ErrorResponseConfig{Payload: "x", Delay: "-1s"}, "tcp", false},
+		{ErrorResponseConfig{Payload: "x"}, "udp", false},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, Protocol: c.proto, ErrorResponse: c.resp}}}
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v on %q: unexpected result %v", c.resp, c.proto, err)
+		}
+	}
+	if b := (ErrorResponseConfig{Hex: "0000000101"}).Bytes(); string(b) != "\x00\x00\x00\x01\x01" {
+		t.Errorf("Bytes() = %q", b)
+	}
+}
+
+func TestValidate_Socket(t *testing.T) {
+	off, zero, negative := false, 0, -1
+	for _, c := range []struct {
+		socket SocketConfig
+		proto  string
+		ok     bool
+	}{
+		{SocketConfig{NoDelay: &off, KeepAlive: "60s", KeepAliveInterval: "10s", KeepAliveCount: 3}, "tcp", true},
+		{SocketConfig{DeferAccept: "5s", FastOpen: 256, Linger: &zero}, "tcp+udp", true},
+		{SocketConfig{KeepAlive: "500ms"}, "tcp", false},
+		{SocketConfig{KeepAliveCount: 3}, "tcp", false},
+		{SocketConfig{DeferAccept: "soon"}, "tcp", false},
+		{SocketConfig{FastOpen: -1}, "tcp", false},
+		{SocketConfig{Backlog: 4096}, "tcp", true},
+		{SocketConfig{Backlog: -1}, "tcp", false},
+		{SocketConfig{Backlog: 70000}, "tcp", false},
+		{SocketConfig{Linger: &negative}, "tcp", false},
+		{SocketConfig{NoDelay: &off}, "udp", false},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, Protocol: c.proto, Socket: c.socket}}}
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v on %q: unexpected result %v", c.socket, c.proto, err)
+		}
+	}
+}
+
+func TestValidate_BackendSource(t *testing.T) {
+	for _, c := range []struct {
+		src string
+		ok  bool
+	}{
+		{"source: 10.0.0.5\n    tos: 0x10", true},
+		{"source: [10.0.0.5, 10.0.0.6, \"2001:db8::5\"]", true},
+		{"source: egress.internal", false},
+		{"source: 10.0.0.5:4000", false},
+		{"tos: 256", false},
+	} {
+		data := "version: \"2\"\nbackends:\n  - name: b\n    servers: [\"10.0.0.1:80\"]\n    " + c.src + "\n"
+		var cfg Config
+		err := yaml.Unmarshal([]byte(data), &cfg)
+		if err == nil {
+			err = Validate(&cfg)
+		}
+		if (err == nil) != c.ok {
+			t.Errorf("%s: unexpected result %v", c.src, err)
+		}
+	}
+}
+
+func TestValidate_TLSInspect(t *testing.T) {
+	for _, c := range []struct {
+		inspect TLSInspectConfig
+		ok      bool
+	}{
+		{TLSInspectConfig{}, true},
+		{TLSInspectConfig{MaxBytes: 4096, Timeout: "2s"}, true},
+		{TLSInspectConfig{MaxBytes: MaxClientHelloBytes + 1}, false},
+		{TLSInspectConfig{Timeout: "0s"}, false},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, TLSInspect: c.inspect}}}
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c.inspect, err)
+		}
+	}
+	if n, d := (TLSInspectConfig{}).Limits(); n != DefaultClientHelloBytes || d != DefaultClientHelloTimeout {
+		t.Errorf("Limits() = %d, %v", n, d)
+	}
+}
+
+func TestValidate_AcceptProxy(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		protocol string
+		accept   AcceptProxyConfig
+		want     string
+	}{
+		{"trusted", "tcp", AcceptProxyConfig{From: []string{"10.0.0.0/8", "192.0.2.1"}, TLVs: map[string]int{"vpce": 0xEA}}, ""},
+		{"bad from", "tcp", AcceptProxyConfig{From: []string{"10.0.0.0/33"}}, "invalid from entry"},
+		{"tlvs without from", "tcp", AcceptProxyConfig{TLVs: map[string]int{"vpce": 0xEA}}, "tlvs require from"},
+		{"bad tag name", "tcp", AcceptProxyConfig{From: []string{"10.0.0.0/8"}, TLVs: map[string]int{"VPC E": 0xEA}}, "invalid tag name"},
+		{"bad tlv type", "tcp", AcceptProxyConfig{From: []string{"10.0.0.0/8"}, TLVs: map[string]int{"vpce": 256}}, "between 0 and 255"},
+		{"udp", "udp", AcceptProxyConfig{From: []string{"10.0.0.0/8"}}, "requires tcp"},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, Protocol: c.protocol, AcceptProxy: c.accept}}}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_Preauth(t *testing.T) {
+	secret := Secret{Ref: "0123456789abcdef"}
+	for _, c := range []struct {
+		name     string
+		protocol string
+		preauth  PreauthConfig
+		want     string
+	}{
+		{"preamble", "tcp", PreauthConfig{Secret: secret, MaxSkew: "1m"}, ""},
+		{"knock", "tcp", PreauthConfig{Knock: ":7000", KnockTTL: "1m"}, ""},
+		{"signed knock", "tcp", PreauthConfig{Secret: secret, Knock: "127.0.0.1:7000"}, ""},
+		{"short secret", "tcp", PreauthConfig{Secret: Secret{Ref: "hunter2"}}, "at least 16 bytes"},
+		{"bad skew", "tcp", PreauthConfig{Secret: secret, MaxSkew: "0s"}, "invalid max_skew"},
+		{"ttl without knock", "tcp", PreauthConfig{Secret: secret, KnockTTL: "1m"}, "knock_ttl requires knock"},
+		{"knock without port", "tcp", PreauthConfig{Knock: "127.0.0.1"}, "invalid knock address"},
+		{"knock on own port", "tcp", PreauthConfig{Knock: ":10000"}, "bound by the listener"},
+		{"udp", "tcp+udp", PreauthConfig{Secret: secret}, "requires tcp"},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":9990-10010"}, Protocol: c.protocol, Preauth: c.preauth}}}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_Tunnel(t *testing.T) {
+	secret := Secret{Ref: "0123456789abcdef"}
+	for _, c := range []struct {
+		name     string
+		protocol string
+		tunnel   BackendTunnel
+		endpoint TunnelConfig
+		egress   []string
+		want     string
+	}{
+		{"udp backend", "udp", BackendTunnel{Peer: "203.0.113.9:4789", Secret: secret}, TunnelConfig{}, nil, ""},
+		{"endpoint", "udp", BackendTunnel{}, TunnelConfig{Bind: ":4789", Secret: secret}, nil, ""},
+		// The servers are reached by the peer, only the peer is checked
+		{"egress", "udp", BackendTunnel{Peer: "203.0.113.9:4789", Secret: secret}, TunnelConfig{}, []string{"203.0.113.0/24"}, ""},
+		{"peer not allowed", "udp", BackendTunnel{Peer: "198.51.100.1:4789", Secret: secret}, TunnelConfig{}, []string{"203.0.113.0/24"}, "not allowed by egress"},
+		{"tcp listener", "tcp+udp", BackendTunnel{Peer: "203.0.113.9:4789", Secret: secret}, TunnelConfig{}, nil, "udp only"},
+		{"short secret", "udp", BackendTunnel{Peer: "203.0.113.9:4789", Secret: Secret{Ref: "hunter2"}}, TunnelConfig{}, nil, "at least 16 bytes"},
+		{"negative max_sessions", "udp", BackendTunnel{}, TunnelConfig{Bind: ":4789", Secret: secret, MaxSessions: -1}, nil, "max_sessions"},
+		{"peer without port", "udp", BackendTunnel{Peer: "203.0.113.9", Secret: secret}, TunnelConfig{}, nil, "invalid peer"},
+		{"secret without peer", "udp", BackendTunnel{Secret: secret}, TunnelConfig{}, nil, "requires peer"},
+		{"endpoint without secret", "udp", BackendTunnel{}, TunnelConfig{Bind: ":4789"}, nil, "at least 16 bytes"},
+	} {
+		cfg := &Config{
+			Version:   "2",
+			Egress:    EgressConfig{Allow: c.egress},
+			Tunnel:    c.endpoint,
+			Listeners: []Listener{{Name: "dns", Bind: Binds{":53"}, Protocol: c.protocol, DefaultBackend: "dns"}},
+			Backends:  []Backend{{Name: "dns", Servers: []Server{{Address: "10.1.0.53:53"}}, Tunnel: c.tunnel}},
+		}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_AdminGRPC(t *testing.T) {
+	token := Secret{Ref: "0123456789abcdef"}
+	for _, c := range []struct {
+		name string
+		grpc GRPCConfig
+		want string
+	}{
+		{"unset", GRPCConfig{}, ""},
+		{"plain", GRPCConfig{Bind: "127.0.0.1:9090", Token: token}, ""},
+		{"tls", GRPCConfig{Bind: ":9090", Token: token, Cert: Secret{Ref: "cert"}, Key: Secret{Ref: "key"}}, ""},
+		{"token without bind", GRPCConfig{Token: token}, "require bind"},
+		{"bind without port", GRPCConfig{Bind: "127.0.0.1", Token: token}, "invalid bind"},
+		{"short token", GRPCConfig{Bind: ":9090", Token: Secret{Ref: "hunter2"}}, "at least 16 bytes"},
+		{"cert without key", GRPCConfig{Bind: ":9090", Token: token, Cert: Secret{Ref: "cert"}}, "set together"},
+	} {
+		cfg := &Config{
+			Version:   "2",
+			Admin:     AdminConfig{GRPC: c.grpc},
+			Listeners: []Listener{{Name: "web", Bind: Binds{":80"}, DefaultBackend: "web"}},
+			Backends:  []Backend{{Name: "web", Servers: []Server{{Address: "10.0.0.1:80"}}}},
+		}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_AdminToken(t *testing.T) {
+	token := Secret{Ref: "0123456789abcdef"}
+	for _, c := range []struct {
+		name  string
+		admin AdminConfig
+		want  string
+	}{
+		{"unset", AdminConfig{}, ""},
+		{"loopback", AdminConfig{Bind: "127.0.0.1:9000"}, ""},
+		{"loopback v6", AdminConfig{Bind: "[::1]:9000"}, ""},
+		{"localhost", AdminConfig{Bind: "localhost:9000"}, ""},
+		{"all addresses with token", AdminConfig{Bind: ":9000", Token: token}, ""},
+		{"all addresses", AdminConfig{Bind: ":9000"}, "requires a token"},
+		{"public", AdminConfig{Bind: "10.0.0.1:9000"}, "requires a token"},
+		{"short token", AdminConfig{Bind: ":9000", Token: Secret{Ref: "hunter2"}}, "at least 16 bytes"},
+		{"token without bind", AdminConfig{Token: token}, "requires bind"},
+	} {
+		cfg := &Config{
+			Version:   "2",
+			Admin:     c.admin,
+			Listeners: []Listener{{Name: "web", Bind: Binds{":80"}, DefaultBackend: "web"}},
+			Backends:  []Backend{{Name: "web", Servers: []Server{{Address: "10.0.0.1:80"}}}},
+		}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_ListenerTLS(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		tls  TLSConfig
+		udp  bool
+		want string
+	}{
+		{"passthrough", TLSConfig{}, false, ""},
+		{"terminated", TLSConfig{Cert: Secret{Ref: "cert"}, Key: Secret{Ref: "key"}, MinVersion: "1.3"}, false, ""},
+		{"cert without key", TLSConfig{Cert: Secret{Ref: "cert"}}, false, "set together"},
+		{"min_version alone", TLSConfig{MinVersion: "1.3"}, false, "requires cert"},
+		{"old version", TLSConfig{Cert: Secret{Ref: "cert"}, Key: Secret{Ref: "key"}, MinVersion: "1.0"}, false, "1.2 or 1.3"},
+		{"udp", TLSConfig{Cert: Secret{Ref: "cert"}, Key: Secret{Ref: "key"}}, true, "requires tcp"},
+	} {
+		l := Listener{Name: "web", Bind: Binds{":443"}, DefaultBackend: "web", TLS: c.tls}
+		if c.udp {
+			l.Protocol = "udp"
+		}
+		cfg := &Config{
+			Version:   "2",
+			Listeners: []Listener{l},
+			Backends:  []Backend{{Name: "web", Servers: []Server{{Address: "10.0.0.1:80"}}}},
+		}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_ResolveCache(t *testing.T) {
+	cfg := &Config{Version: "2", Admin: AdminConfig{ResolveCacheFile: "/var/lib/nvelox/resolved.yaml", ResolveCacheMaxAge: "6h"}}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("valid resolve cache rejected: %v", err)
+	}
+	cfg.Admin.ResolveCacheMaxAge = "forever"
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "resolve_cache_max_age") {
+		t.Errorf("expected error for invalid resolve_cache_max_age, got %v", err)
+	}
+}
+
+func TestValidate_Peer(t *testing.T) {
+	send := true
+	for _, c := range []struct {
+		name    string
+		peer    PeerConfig
+		accept  AcceptProxyConfig
+		send    *bool
+		backend bool
+		want    string
+	}{
+		{"edge", PeerConfig{Tenant: "acme", Hints: map[string]string{"region": "eu"}}, AcceptProxyConfig{}, &send, true, ""},
+		{"regional", PeerConfig{Route: true}, AcceptProxyConfig{From: []string{"10.0.0.0/8"}}, nil, false, ""},
+		{"route without accept_proxy", PeerConfig{Route: true}, AcceptProxyConfig{}, nil, false, "route requires accept_proxy"},
+		{"bad hint name", PeerConfig{Hints: map[string]string{"Region": "eu"}}, AcceptProxyConfig{}, nil, false, "invalid hint name"},
+		{"long tenant", PeerConfig{Tenant: strings.Repeat("x", 256)}, AcceptProxyConfig{}, nil, false, "longer than 255"},
+		{"peer without proxy header", PeerConfig{}, AcceptProxyConfig{}, nil, true, "requires send_proxy_v2"},
+	} {
+		cfg := &Config{
+			Version:   "2",
+			Listeners: []Listener{{Name: "web", Bind: Binds{":80"}, DefaultBackend: "web", Peer: c.peer, AcceptProxy: c.accept}},
+			Backends:  []Backend{{Name: "web", Servers: []Server{{Address: "10.0.0.1:80"}}, SendProxyV2: c.send, ProxyV2Peer: c.backend}},
+		}
+		err := Validate(cfg)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: error = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidate_TraceConnections(t *testing.T) {
+	for _, c := range []struct {
+		protocol string
+		trace    bool
+		sample   float64
+		ok       bool
+	}{
+		{"tcp", true, 0, true},
+		{"tcp", true, 0.01, true},
+		{"tcp", false, 0.5, true},
+		{"tcp", true, 1.5, false},
+		{"tcp", true, -0.1, false},
+		{"udp", true, 0, false},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, Protocol: c.protocol, TraceConnections: c.trace, TraceSample: c.sample}}}
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c, err)
+		}
+	}
+}
+
+func TestValidate_CaptureOnReject(t *testing.T) {
+	for _, c := range []struct {
+		capture CaptureConfig
+		ok      bool
+	}{
+		{CaptureConfig{Bytes: 64}, true},
+		{CaptureConfig{Bytes: 64, Wait: "500ms"}, true},
+		{CaptureConfig{Bytes: MaxCaptureBytes + 1}, false},
+		{CaptureConfig{Bytes: 64, Wait: "soon"}, false},
+	} {
+		cfg := &Config{Version: "2", Listeners: []Listener{{Name: "l", Bind: Binds{":10000"}, CaptureOnReject: c.capture}}}
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v: unexpected result %v", c.capture, err)
+		}
+	}
+}
+
+func TestLoadConfig_Resolve(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "resolve.yaml")
+	os.WriteFile(path, []byte(`
+version: '2'
+backends:
+  - name: once
+    servers: ["db.internal:5432"]
+    resolve: at_start
+  - name: often
+    servers: ["db.internal:5432"]
+    resolve:
+      periodic: 30s
+  - name: dial
+    servers: ["db.internal:5432"]
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []ResolvePolicy{{Mode: ResolveAtStart}, {Mode: ResolvePeriodic, Interval: "30s"}, {}}
+	for i, w := range want {
+		if got := cfg.Backends[i].Resolve; got != w {
+			t.Errorf("backend %s: resolve = %+v, want %+v", cfg.Backends[i].Name, got, w)
+		}
+	}
+	if got := cfg.Backends[1].Resolve.Every(); got != 30*time.Second {
+		t.Errorf("Every() = %v, want 30s", got)
+	}
+
+	out, err := yaml.Marshal(cfg.Backends[1])
+	if err != nil || !strings.Contains(string(out), "resolve:\n    periodic: 30s") {
+		t.Errorf("periodic policy does not round-trip:\n%s", out)
+	}
+	if out, _ := yaml.Marshal(cfg.Backends[2]); strings.Contains(string(out), "resolve") {
+		t.Errorf("default policy should be omitted:\n%s", out)
+	}
+
+	for _, bad := range []ResolvePolicy{{Mode: "sometimes"}, {Mode: ResolvePeriodic}, {Mode: ResolvePeriodic, Interval: "-1s"}, {Mode: ResolveAtStart, Interval: "1m"}} {
+		cfg := &Config{Version: "2", Backends: []Backend{{Name: "b", Resolve: bad}}}
+		if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "resolve") {
+			t.Errorf("%+v: expected resolve error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfig_Retry(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "retry.yaml")
+	os.WriteFile(path, []byte(`
+version: '2'
+backends:
+  - name: b1
+    servers: ["10.0.0.1:80"]
+    retry:
+      max_retries: 2
+      per_try_timeout: 500ms
+      budget_percent: 20
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Backends[0].Retry.MaxRetries != 2 {
+		t.Errorf("Expected max_retries 2, got %d", cfg.Backends[0].Retry.MaxRetries)
+	}
+
+	badPath := filepath.Join(tmpDir, "bad_retry.yaml")
+	os.WriteFile(badPath, []byte(`
+version: '2'
+backends:
+  - name: b1
+    retry:
+      base_backoff: soon
+`), 0644)
+	if _, err := Load(badPath); err == nil {
+		t.Error("expected error for invalid retry duration")
+	}
+}
+
+func TestLoadConfig_Hosts(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "hosts.yaml")
+	os.WriteFile(path, []byte(`
+version: '2'
+hosts:
+  db.internal: ["10.0.0.1", "10.0.0.2"]
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.Hosts["db.internal"]) != 2 {
+		t.Errorf("Expected 2 IPs for db.internal, got %v", cfg.Hosts["db.internal"])
+	}
+
+	badPath := filepath.Join(tmpDir, "bad_hosts.yaml")
+	os.WriteFile(badPath, []byte(`
+version: '2'
+hosts:
+  db.internal: ["not-an-ip"]
+`), 0644)
+	if _, err := Load(badPath); err == nil {
+		t.Error("expected error for invalid hosts IP")
+	}
+}
+
+func TestValidate_Shedding(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			Version:   "2",
+			Listeners: []Listener{{Name: "l", Bind: Binds{":80"}, Priority: "low"}},
+			Shedding:  SheddingConfig{CPULoad: 0.9, Fraction: 0.5},
+		}
+	}
+	if err := Validate(base()); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+
+	cfg := base()
+	cfg.Listeners[0].Priority = "urgent"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for invalid priority")
+	}
+
+	cfg = base()
+	cfg.Shedding.Fraction = 1.5
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for fraction above 1")
+	}
+
+	cfg = base()
+	cfg.Shedding.Interval = "soon"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for invalid interval")
+	}
+}
+
+func TestLoadConfig_ServerDefaults(t *testing.T) {
+	cfgContent := `
+version: "2"
+server:
+  host: "127.0.0.1"
+  port: 8080
+listeners:
+  - name: "no-host"
+    bind: ":9000"
+  - name: "no-port"
+    bind: "10.0.0.1"
+  - name: "empty"
+  - name: "ipv6"
+    bind: "[::1]"
+  - name: "full"
+    bind: "10.0.0.2:81"
+`
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	os.WriteFile(path, []byte(cfgContent), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []string{"127.0.0.1:9000", "10.0.0.1:8080", "127.0.0.1:8080", "[::1]:8080", "10.0.0.2:81"}
+	for i, w := range want {
+		if got := cfg.Listeners[i].Bind; len(got) != 1 || got[0] != w {
+			t.Errorf("listener %s bind = %q, want %q", cfg.Listeners[i].Name, got, w)
+		}
+	}
+}
+
+func TestLoadConfig_MultipleBinds(t *testing.T) {
+	cfgContent := `
+version: "2"
+server:
+  port: 443
+listeners:
+  - name: "web"
+    bind: ["10.0.0.1", "[::1]:8443", "10.0.0.2:9000-9001"]
+  - name: "single"
+    bind: ":80"
+`
+	path := filepath.Join(t.TempDir(), "binds.yaml")
+	os.WriteFile(path, []byte(cfgContent), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := Binds{"10.0.0.1:443", "[::1]:8443", "10.0.0.2:9000-9001"}
+	if !slices.Equal(cfg.Listeners[0].Bind, want) {
+		t.Errorf("binds = %q, want %q", cfg.Listeners[0].Bind, want)
+	}
+
+	// A single bind is written back as a plain string
+	for _, tt := range []struct {
+		binds Binds
+		json  string
+	}{
+		{Binds{":80"}, `":80"`},
+		{want, `["10.0.0.1:443","[::1]:8443","10.0.0.2:9000-9001"]`},
+	} {
+		data, _ := json.Marshal(tt.binds)
+		if string(data) != tt.json {
+			t.Errorf("json = %s, want %s", data, tt.json)
+		}
+		var back Binds
+		if err := json.Unmarshal(data, &back); err != nil || !slices.Equal(back, tt.binds) {
+			t.Errorf("round trip of %s = %q, %v", data, back, err)
+		}
+	}
+
+	cfg.Listeners[0].Bind = append(cfg.Listeners[0].Bind, "[::1]:8443")
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "twice") {
+		t.Errorf("expected duplicate bind error, got %v", err)
+	}
+}
+
+func TestLoadConfig_Strict(t *testing.T) {
+	cfgContent := `
+version: "2"
+server:
+  host: "127.0.0.1"
+listeners:
+  - name: "web"
+    bind: ":80"
+    defualt_backend: "web"
+`
+	path := filepath.Join(t.TempDir(), "typo.yaml")
+	os.WriteFile(path, []byte(cfgContent), 0644)
+
+	if _, err := Load(path); err != nil {
+		t.Fatalf("lenient Load failed: %v", err)
+	}
+	_, err := LoadWithOptions(path, LoadOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "defualt_backend") {
+		t.Errorf("expected strict error naming the unknown key, got %v", err)
+	}
+}
+
+func TestLoadConfig_StrictOption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "strict.yaml")
+	os.WriteFile(path, []byte(`
+version: "2"
+strict: true
+include: "`+filepath.Join(dir, "conf.d")+`"
+listeners:
+  - name: "web"
+    bind: ":80"
+    default_backend: "web"
+backends:
+  - name: "web"
+    servers: ["10.0.0.1:80"]
+`), 0644)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	extra := filepath.Join(dir, "conf.d", "extra.yaml")
+	os.WriteFile(extra, []byte("backends:\n  - name: \"api\"\n    servers: [\"10.0.0.2:80\"]\n"), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("strict Load failed: %v", err)
+	}
+	if !cfg.Strict || len(cfg.Backends) != 2 {
+		t.Errorf("unexpected config: strict=%v backends=%d", cfg.Strict, len(cfg.Backends))
+	}
+
+	// A typo in an include fails without -strict-config
+	os.WriteFile(extra, []byte("backends:\n  - name: \"api\"\n    servres: [\"10.0.0.2:80\"]\n"), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "servres") {
+		t.Errorf("expected strict error naming the unknown key, got %v", err)
+	}
+
+	os.WriteFile(extra, nil, 0644)
+	os.WriteFile(path, []byte("version: \"2\"\nstrict: true\nlisteners:\n  - name: \"web\"\n    defalt_backend: \"web\"\n"), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "defalt_backend") {
+		t.Errorf("expected strict error naming the unknown key, got %v", err)
+	}
+}
+
+func TestLoadConfig_StrictAllowUnknown(t *testing.T) {
+	cfgContent := `
+version: "2"
+future_setting: true
+listeners:
+  - name: "web"
+    bind: ":80"
+    x_tuning: 1
+`
+	path := filepath.Join(t.TempDir(), "future.yaml")
+	os.WriteFile(path, []byte(cfgContent), 0644)
+
+	if _, err := LoadWithOptions(path, LoadOptions{Strict: true, AllowUnknown: []string{"future_setting"}}); err == nil {
+		t.Error("expected error for key missing from the allowlist")
+	}
+	cfg, err := LoadWithOptions(path, LoadOptions{Strict: true, AllowUnknown: []string{"future_setting", "x_*"}})
+	if err != nil {
+		t.Fatalf("allowlisted keys rejected: %v", err)
+	}
+	if cfg.Listeners[0].Bind[0] != ":80" {
+		t.Errorf("known fields not decoded: %+v", cfg.Listeners[0])
+	}
+}
+
+func TestValidate_Dependencies(t *testing.T) {
+	cfg := &Config{
+		Version: "2",
+		Backends: []Backend{
+			{Name: "app", DependsOn: []BackendDependency{{Backend: "db"}}},
+			{Name: "db"},
+		},
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("valid dependencies rejected: %v", err)
+	}
+
+	cfg.Backends[1].DependsOn = []BackendDependency{{Backend: "app"}}
+	if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+
+	cfg.Backends[1].DependsOn = []BackendDependency{{Backend: "cache"}}
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for unknown dependency")
+	}
+}
+
+func TestValidate_Weights(t *testing.T) {
+	cfg := &Config{
+		Version:  "2",
+		Backends: []Backend{{Name: "web", Servers: []Server{{Address: "s1"}}, Weights: map[string]int{"s1": 256}}},
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("valid weights rejected: %v", err)
+	}
+
+	cfg.Backends[0].Weights = map[string]int{"s1": 257}
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for weight above 256")
+	}
+
+	cfg.Backends[0].Weights = map[string]int{"s2": 1}
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for weight of unlisted server")
+	}
+}
+
+func TestLoadConfig_ServerEntries(t *testing.T) {
+	cfgContent := `
+version: "2"
+backends:
+  - name: "web"
+    servers:
+      - "10.0.0.1:80"
+      - address: "10.0.0.2:80"
+        weight: 0
+        max_conns: 100
+      - address: "10.0.0.3:80"
+        backup: true
+      - address: "10.0.0.4:80"
+        disabled: true
+      - address: "10.0.0.5:80"
+        state: maint
+`
+	path := filepath.Join(t.TempDir(), "servers.yaml")
+	os.WriteFile(path, []byte(cfgContent), 0644)
+
+	cfg, err := LoadWithOptions(path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	servers := cfg.Backends[0].Servers
+	if len(servers) != 5 || servers[0] != (Server{Address: "10.0.0.1:80"}) {
+		t.Fatalf("shorthand entry not decoded: %+v", servers)
+	}
+	if s := servers[1]; s.Weight == nil || *s.Weight != 0 || s.MaxConns != 100 {
+		t.Errorf("server 2 = %+v", s)
+	}
+	if !servers[2].Backup || !servers[3].Disabled || servers[4].State != ServerMaint {
+		t.Errorf("flags not decoded: %+v", servers[2:])
+	}
+	if w := cfg.Backends[0].ServerWeights(); len(w) != 1 || w["10.0.0.2:80"] != 0 {
+		t.Errorf("server weights = %v", w)
+	}
+
+	os.WriteFile(path, []byte(strings.Replace(cfgContent, "backup:", "bakup:", 1)), 0644)
+	if _, err := LoadWithOptions(path, LoadOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), "bakup") {
+		t.Errorf("expected strict error for unknown server key, got %v", err)
+	}
+}
+
+func TestApplyDefaults_ServerRanges(t *testing.T) {
+	weight := 5
+	cfg := &Config{Version: "2", Backends: []Backend{{Name: "web", Servers: []Server{
+		{Address: "10.0.1.0/30:8080", Weight: &weight},
+		{Address: "10.0.2.10-10.0.2.12"},
+		{Address: "[2001:db8::/127]:80"},
+		{Address: "web-1.internal:80"},
+	}}}}
+	cfg.ApplyDefaults()
+
+	want := []string{
+		"10.0.1.1:8080", "10.0.1.2:8080",
+		"10.0.2.10", "10.0.2.11", "10.0.2.12",
+		"[2001:db8::]:80", "[2001:db8::1]:80",
+		"web-1.internal:80",
+	}
+	servers := cfg.Backends[0].Servers
+	if got := cfg.Backends[0].Addresses(); !slices.Equal(got, want) {
+		t.Fatalf("expanded to %v, want %v", got, want)
+	}
+	if servers[1].Weight == nil || *servers[1].Weight != 5 || servers[2].Weight != nil {
+		t.Error("expanded servers do not keep the settings of their entry")
+	}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("expanded servers rejected: %v", err)
+	}
+}
+
+func TestValidate_Servers(t *testing.T) {
+	weight := 257
+	cases := map[string][]Server{
+		"missing address": {{MaxConns: 1}},
+		"duplicate":       {{Address: "s1"}, {Address: "s1"}},
+		"max_conns":       {{Address: "s1", MaxConns: -1}},
+		"state":           {{Address: "s1", State: "down"}},
+		"weight":          {{Address: "s1", Weight: &weight}},
+		"bad CIDR":        {{Address: "10.0.1.0/33:80"}},
+		"reversed range":  {{Address: "10.0.1.20-10.0.1.10:80"}},
+		"mixed range":     {{Address: "10.0.1.1-::1:80"}},
+		"huge CIDR":       {{Address: "10.0.0.0/8:80"}},
+	}
+	for name, servers := range cases {
+		cfg := &Config{Version: "2", Backends: []Backend{{Name: "web", Servers: servers}}}
+		if err := Validate(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestValidate_Timeouts(t *testing.T) {
+	cfg := &Config{
+		Version:   "2",
+		Listeners: []Listener{{Name: "web", Bind: Binds{":80"}, Timeouts: TimeoutsConfig{ClientIdle: "5m", SessionMax: "0"}}},
+		Backends:  []Backend{{Name: "be", Timeouts: TimeoutsConfig{Connect: "2s", ServerIdle: "30s"}}},
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("valid timeouts rejected: %v", err)
+	}
+
+	cfg.Backends[0].Timeouts.Connect = "-1s"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for negative connect timeout")
+	}
+	cfg.Backends[0].Timeouts.Connect = ""
+	cfg.Listeners[0].Timeouts.ClientIdle = "forever"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for invalid client_idle")
+	}
+
+	merged := TimeoutsConfig{ServerIdle: "5s"}.Or(TimeoutsConfig{Connect: "1s", ServerIdle: "1m"})
+	if merged != (TimeoutsConfig{Connect: "1s", ServerIdle: "5s"}) {
+		t.Errorf("Or = %+v", merged)
+	}
+}
+
+func TestValidate_RateLimit(t *testing.T) {
+	cfg := &Config{
+		Version:   "2",
+		Listeners: []Listener{{Name: "web", Bind: Binds{":80"}, RateLimit: RateLimitConfig{Connections: 10, Period: "1m", Key: ClientKey{IPv4Prefix: 24, IPv6Prefix: 56}}}},
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("valid rate limit rejected: %v", err)
+	}
+
+	cfg.Listeners[0].RateLimit.Key.IPv6Prefix = 129
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for ipv6_prefix above 128")
+	}
+
+	cfg.Listeners[0].RateLimit.Key.IPv6Prefix = 64
+	cfg.Listeners[0].RateLimit.Period = "soon"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for invalid period")
+	}
+
+	cfg.Listeners[0].RateLimit.Period = "1m"
+	cfg.Listeners[0].RateLimit.Shared = true
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for a shared limit without a redis state store")
+	}
+	cfg.State = StateConfig{Type: "redis", Address: "127.0.0.1:6379"}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("shared rate limit rejected: %v", err)
+	}
+	cfg.Listeners[0].RateLimit.Sync = "0s"
+	if err := Validate(cfg); err == nil {
+		t.Error("expected error for a zero sync")
+	}
+}
+
+func TestLoadConfig_Env(t *testing.T) {
+	t.Setenv("NVELOX_TEST_BACKEND", "10.0.0.7:8080")
+	t.Setenv("NVELOX_TEST_EMPTY", "")
+
+	path := filepath.Join(t.TempDir(), "env.yaml")
+	content := `
+version: '2'
+logging:
+  error_log: "${NVELOX_TEST_LOG_DIR:-/var/log/nvelox}/error.log"
+listeners:
+  - name: web
+    bind: ":${NVELOX_TEST_PORT:-8080}"
+    default_backend: "pool$${literal}"
+backends:
+  - name: "pool${NVELOX_TEST_EMPTY}$${literal}"
+    servers: ["${NVELOX_TEST_BACKEND}", "${NVELOX_TEST_UNSET}10.0.0.8:80"]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Logging.ErrorLog != "/var/log/nvelox/error.log" {
+		t.Errorf("error_log = %q", cfg.Logging.ErrorLog)
+	}
+	if len(cfg.Listeners[0].Bind) != 1 || cfg.Listeners[0].Bind[0] != ":8080" {
+		t.Errorf("bind = %q", cfg.Listeners[0].Bind)
+	}
+	if cfg.Backends[0].Name != "pool${literal}" {
+		t.Errorf("backend name = %q", cfg.Backends[0].Name)
+	}
+	if got := cfg.Backends[0].Servers; got[0].Address != "10.0.0.7:8080" || got[1].Address != "10.0.0.8:80" {
+		t.Errorf("servers = %v", got)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "NVELOX_TEST_UNSET") {
+		t.Errorf("warnings = %v", cfg.Warnings)
+	}
+}
+
+func TestLoadConfig_EnvNotTemplated(t *testing.T) {
+	t.Setenv("NVELOX_TEST_SECRET", "a{{b")
+	t.Setenv("NVELOX_TEST_ACTION", "{{ .port }}")
+
+	// Both files hold template actions, so both are expanded as templates
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.yaml")
+	writeFile(t, path, `version: '2'
+include: `+filepath.Join(dir, "extra.yaml")+`
+vars:
+  port: 8080
+logging:
+  error_log: "/var/log/${NVELOX_TEST_SECRET}/error.log"
+listeners:
+  - name: web
+    bind: ":{{ .port }}"
+    default_backend: pool
+`)
+	writeFile(t, filepath.Join(dir, "extra.yaml"), `logging:
+  access_log: "/var/log/${NVELOX_TEST_ACTION}/access.log"
+backends:
+  - name: pool
+    servers: ["10.0.0.1:{{ .port }}"]
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Logging.ErrorLog != "/var/log/a{{b/error.log" {
+		t.Errorf("error_log = %q", cfg.Logging.ErrorLog)
+	}
+	if cfg.Logging.AccessLog != "/var/log/{{ .port }}/access.log" {
+		t.Errorf("access_log = %q", cfg.Logging.AccessLog)
+	}
+	if cfg.Listeners[0].Bind[0] != ":8080" || cfg.Backends[0].Servers[0].Address != "10.0.0.1:8080" {
+		t.Errorf("templates not expanded: bind %v, servers %v", cfg.Listeners[0].Bind, cfg.Backends[0].Servers)
+	}
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "nvelox.json")
+	mainContent := `{
+	"version": "2",
+	"server": {"port": 8080},
+	"include": "` + filepath.Join(dir, "conf.d", "*.toml") + `",
+	"listeners": [
+		{"name": "web", "bind": ":80", "default_backend": "pool",
+		 "rate_limit": {"connections": 100, "period": "1s"}}
+	]
+}`
+	if err := os.WriteFile(mainPath, []byte(mainContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tomlContent := `
+[[backends]]
+name = "pool"
+balance = "leastconn"
+servers = ["10.0.0.1:80", "10.0.0.2:80"]
+
+[backends.health_check.active]
+interval = "5s"
+timeout = "1s"
+`
+	if err := os.WriteFile(filepath.Join(dir, "conf.d", "pool.toml"), []byte(tomlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWithOptions(mainPath, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Port != 8080 || cfg.Listeners[0].RateLimit.Connections != 100 {
+		t.Errorf("JSON values not decoded: port %d, rate limit %+v", cfg.Server.Port, cfg.Listeners[0].RateLimit)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].Balance != "leastconn" || len(cfg.Backends[0].Servers) != 2 {
+		t.Fatalf("TOML backend not decoded: %+v", cfg.Backends)
+	}
+	if cfg.Backends[0].HealthCheck.Active.Interval != "5s" {
+		t.Errorf("health check interval = %q", cfg.Backends[0].HealthCheck.Active.Interval)
+	}
+
+	// Strict mode sees unknown keys in every format
+	badPath := filepath.Join(dir, "typo.toml")
+	if err := os.WriteFile(badPath, []byte("version = \"2\"\n[server]\nprot = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadWithOptions(badPath, LoadOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+
+	brokenPath := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(brokenPath, []byte(`{"version": "2",}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(brokenPath); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected JSON syntax error, got %v", err)
+	}
+}
+
+func TestLoadConfig_IncludeMerge(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	if err := os.MkdirAll(filepath.Join(confd, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.yaml")
+	writeFile(t, path, `version: '2'
+include:
+  - `+confd+`
+  - `+filepath.Join(dir, "late-*.json")+`
+server:
+  port: 8080
+logging:
+  level: info
+  access_log: /var/log/access.log
+hosts:
+  a.internal: ["10.0.0.1"]
+listeners:
+  - name: main
+    bind: ':80'
+    default_backend: b1
+`)
+	writeFile(t, filepath.Join(confd, "10-base.yaml"), `logging:
+  level: warn
+hosts:
+  b.internal: ["10.0.0.2"]
+backends:
+  - name: b1
+    servers: ['10.0.0.1:80']
+`)
+	writeFile(t, filepath.Join(confd, "20-web.yaml"), `server:
+  port: 9090
+include: elsewhere/*.yaml
+listeners:
+  - name: web
+    bind: ':81'
+    default_backend: b1
+`)
+	writeFile(t, filepath.Join(confd, "sub", "30-api.toml"), `[logging]
+level = "debug"
+
+[[listeners]]
+name = "api"
+bind = ":82"
+default_backend = "b1"
+`)
+	writeFile(t, filepath.Join(confd, ".hidden.yaml"), "logging:\n  level: error\n")
+	writeFile(t, filepath.Join(confd, "README.txt"), "not a config file")
+	writeFile(t, filepath.Join(dir, "late-1.json"), `{"logging": {"error_log": "/var/log/error.log"}}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Logging.Level != "debug" || cfg.Logging.AccessLog != "/var/log/access.log" || cfg.Logging.ErrorLog != "/var/log/error.log" {
+		t.Errorf("unexpected logging settings: %+v", cfg.Logging)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("server port = %d, want 9090 from 20-web.yaml", cfg.Server.Port)
+	}
+	var names []string
+	for _, l := range cfg.Listeners {
+		names = append(names, l.Name)
+	}
+	if !slices.Equal(names, []string{"main", "web", "api"}) {
+		t.Errorf("listeners = %v, want main, web, api", names)
+	}
+	if len(cfg.Backends) != 1 || len(cfg.Hosts) != 2 {
+		t.Errorf("expected 1 backend and 2 hosts, got %d and %v", len(cfg.Backends), cfg.Hosts)
+	}
+	if len(cfg.Include) != 2 {
+		t.Errorf("include replaced by an included file: %v", cfg.Include)
+	}
+	if !slices.ContainsFunc(cfg.Warnings, func(w string) bool { return strings.Contains(w, "includes do not nest") }) {
+		t.Errorf("expected a warning for the nested include, got %v", cfg.Warnings)
+	}
+
+	// A directory include holding the main file does not load it twice
+	writeFile(t, path, "version: '2'\ninclude: "+dir+"\nlisteners:\n  - name: main\n    bind: ':80'\n    default_backend: b1\n")
+	os.Remove(filepath.Join(dir, "late-1.json"))
+	if _, err := Load(path); err != nil {
+		t.Errorf("Load with the main file in an included directory: %v", err)
+	}
+}
+
+func TestLoadConfig_DefaultsBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	writeFile(t, path, `version: '2'
+defaults:
+  default_backend: a
+  priority: high
+  balance: leastconn
+  send_proxy_v2: true
+  timeouts:
+    connect: 2s
+    server_idle: 5m
+  health_check:
+    active:
+      type: tcp
+      interval: 10s
+      timeout: 2s
+listeners:
+  - name: web
+    bind: ':8080'
+  - name: admin
+    bind: ':8081'
+    default_backend: b
+    priority: low
+backends:
+  - name: a
+    servers: ['10.0.0.1:80']
+  - name: b
+    balance: random
+    send_proxy_v2: false
+    timeouts:
+      connect: 5s
+    health_check:
+      active:
+        type: http
+        path: /healthz
+    servers: ['10.0.0.2:80']
+  - name: c
+    health_check: off
+    servers: ['10.0.0.3:80']
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	web, admin := cfg.Listeners[0], cfg.Listeners[1]
+	if web.DefaultBackend != "a" || web.Priority != PriorityHigh {
+		t.Errorf("listener web did not inherit the defaults: backend %s, priority %s", web.DefaultBackend, web.Priority)
+	}
+	if admin.DefaultBackend != "b" || admin.Priority != PriorityLow {
+		t.Errorf("listener admin settings overridden: backend %s, priority %s", admin.DefaultBackend, admin.Priority)
+	}
+	a, b, c := cfg.Backends[0], cfg.Backends[1], cfg.Backends[2]
+	if a.Balance != "leastconn" || !a.SendsProxyV2() || a.Timeouts.Connect != "2s" || a.HealthCheck.Active.Interval != "10s" {
+		t.Errorf("backend a did not inherit the defaults: %+v", a)
+	}
+	if b.Balance != "random" || b.SendsProxyV2() {
+		t.Errorf("backend b settings overridden: balance %s, send_proxy_v2 %v", b.Balance, b.SendsProxyV2())
+	}
+	if b.Timeouts.Connect != "5s" || b.Timeouts.ServerIdle != "5m" {
+		t.Errorf("backend b timeouts not merged field by field: %+v", b.Timeouts)
+	}
+	if hc := b.HealthCheck.Active; hc.Type != "http" || hc.Path != "/healthz" || hc.Interval != "10s" || hc.Timeout != "2s" {
+		t.Errorf("backend b health check not merged with the template: %+v", hc)
+	}
+	if hc := c.HealthCheck; !hc.Off || hc.Active != (ActiveHealthCheck{}) {
+		t.Errorf("backend c health check not off: %+v", hc)
+	}
+
+	for _, bad := range []string{
+		"version: '2'\ndefaults:\n  timeouts:\n    connect: soon\n",
+		"version: '2'\ndefaults:\n  priority: urgent\n",
+		"version: '2'\ndefaults:\n  health_check: off\n",
+	} {
+		writeFile(t, path, bad)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "defaults") {
+			t.Errorf("%q: expected defaults error, got %v", bad, err)
+		}
+	}
+	writeFile(t, path, "version: '2'\nbackends:\n  - name: a\n    health_check: on\n    servers: ['10.0.0.1:80']\n")
+	if _, err := Load(path); err == nil {
+		t.Error("health_check: on accepted")
+	}
+}
+
+func TestLoadConfig_Layers(t *testing.T) {
+	dir := t.TempDir()
+	hostd := filepath.Join(dir, "host.d")
+	if err := os.MkdirAll(hostd, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "base.yaml")
+	writeFile(t, path, `version: '2'
+config_dirs: [`+hostd+`]
+server:
+  port: 8080
+  expected_connections: 500
+backends:
+  - name: web
+    servers: ['10.0.0.1:80', '10.0.0.2:80']
+  - name: api
+    servers: ['10.0.1.1:80']
+listeners:
+  - name: web
+    bind: ':80'
+    default_backend: web
+`)
+	writeFile(t, filepath.Join(hostd, "10-local.yaml"), `server:
+  port: 9090
+config_dirs: [elsewhere]
+backends:
+  - name: web
+    servers: ['127.0.0.1:8080']
+`)
+	writeFile(t, filepath.Join(hostd, "20-local.yaml"), `listeners:
+  - name: admin
+    bind: ':81'
+    default_backend: api
+`)
+	override := filepath.Join(dir, "override.yaml")
+	writeFile(t, override, `server:
+  expected_connections: 50
+backends:
+  - name: api
+    servers: ['127.0.0.1:9090']
+`)
+
+	cfg, err := LoadWithOptions(path, LoadOptions{Layers: []string{override}})
+	if err != nil {
+		t.Fatalf("LoadWithOptions failed: %v", err)
+	}
+	if cfg.Server.Port != 9090 || cfg.Server.ExpectedConnections != 50 {
+		t.Errorf("later layers should override settings, got %+v", cfg.Server)
+	}
+	// Same names replace in place, new ones are added
+	if len(cfg.Backends) != 2 || cfg.Backends[0].Name != "web" || cfg.Backends[1].Name != "api" {
+		t.Fatalf("unexpected backends: %+v", cfg.Backends)
+	}
+	if got := cfg.Backends[0].Addresses(); !slices.Equal(got, []string{"127.0.0.1:8080"}) {
+		t.Errorf("web servers = %v", got)
+	}
+	if got := cfg.Backends[1].Addresses(); !slices.Equal(got, []string{"127.0.0.1:9090"}) {
+		t.Errorf("api servers = %v", got)
+	}
+	if len(cfg.Listeners) != 2 || cfg.Listeners[1].Name != "admin" {
+		t.Errorf("unexpected listeners: %+v", cfg.Listeners)
+	}
+	if !slices.Equal(cfg.ConfigDirs, []string{hostd}) || len(cfg.Warnings) == 0 || !strings.Contains(strings.Join(cfg.Warnings, "\n"), "config_dirs is ignored") {
+		t.Errorf("config_dirs of a layer should be ignored with a warning: %v %v", cfg.ConfigDirs, cfg.Warnings)
+	}
+
+	var files ConfigFiles
+	if main, layers := files.Split(); main != DefaultFile || layers != nil {
+		t.Errorf("Split() = %s, %v", main, layers)
+	}
+	files.Set(path)
+	files.Set(override)
+	if main, layers := files.Split(); main != path || !slices.Equal(layers, []string{override}) {
+		t.Errorf("Split() = %s, %v", main, layers)
+	}
+}
+
+func TestLoadConfig_IncludeQuotas(t *testing.T) {
+	dir := t.TempDir()
+	teams := filepath.Join(dir, "teams")
+	if err := os.MkdirAll(filepath.Join(teams, "payments"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.yaml")
+	main := func(quotas string) {
+		writeFile(t, path, "version: '2'\ninclude: "+teams+"\ninclude_quotas:\n"+quotas)
+	}
+	writeFile(t, filepath.Join(teams, "payments", "a.yaml"), `listeners:
+  - name: pay
+    bind: ':9000-9009'
+    protocol: tcp+udp
+    default_backend: pay
+backends:
+  - name: pay
+    servers: ['10.0.0.1:80']
+`)
+	writeFile(t, filepath.Join(teams, "payments", "b.yaml"), `listeners:
+  - name: pay-admin
+    bind: [':9100', ':9101']
+    default_backend: pay
+include_quotas: []
+`)
+	writeFile(t, filepath.Join(teams, "search.yaml"), `listeners:
+  - name: search
+    bind: ':9200'
+    default_backend: pay
+`)
+
+	// payments binds 2*10 + 2 ports in two listeners
+	main("  - files: " + filepath.Join(teams, "payments") + "\n    max_listeners: 2\n    max_ports: 22\n    max_backends: 1\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("quota within limits: %v", err)
+	}
+	if len(cfg.IncludeQuotas) != 1 || !slices.ContainsFunc(cfg.Warnings, func(w string) bool { return strings.Contains(w, "only the main file sets quotas") }) {
+		t.Errorf("included file changed the quotas: %v, warnings %v", cfg.IncludeQuotas, cfg.Warnings)
+	}
+
+	main("  - files: " + filepath.Join(teams, "payments") + "\n    max_ports: 21\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "the matching files define 22 ports, the limit is 21") {
+		t.Errorf("expected shared port quota error, got %v", err)
+	}
+
+	main("  - files: " + filepath.Join(teams, "*", "*.yaml") + "\n    per_file: true\n    max_listeners: 1\n    max_ports: 2\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "a.yaml defines 20 ports") {
+		t.Errorf("expected per-file port quota error, got %v", err)
+	}
+
+	main("  - files: " + filepath.Join(teams, "*.yaml") + "\n    max_listeners: 0\n    max_backends: 1\n  - files: ''\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "files is required") {
+		t.Errorf("expected error for a quota without files, got %v", err)
+	}
+}
+
+func TestLoadConfig_Template(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.yaml")
+	writeFile(t, path, `version: '2'
+include: `+filepath.Join(dir, "extra.yaml")+`
+vars:
+  backend_host: 10.0.0.1
+  base: 7000
+  shards: [a, b]
+listeners:
+{{- range $i, $shard := .shards }}
+  - name: shard-{{ $shard }}
+    bind: ":{{ add $.base $i }}"
+    default_backend: shard-{{ $shard }}
+{{- end }}
+backends:
+{{- range .shards }}
+  - name: shard-{{ . }}
+    servers: ["{{ $.backend_host }}:9000"]
+{{- end }}
+`)
+	writeFile(t, filepath.Join(dir, "extra.yaml"), `vars:
+  backend_host: 10.0.0.2
+listeners:
+{{- range seq 1 2 }}
+  - name: extra-{{ . }}
+    bind: ":{{ add $.base (add 100 .) }}"
+    default_backend: extra
+{{- end }}
+backends:
+  - name: extra
+    servers: ["{{ .backend_host }}:9000"]
+`)
+
+	cfg, err := LoadWithOptions(path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("LoadWithOptions: %v", err)
+	}
+	binds := make([]string, 0)
+	for _, l := range cfg.Listeners {
+		binds = append(binds, l.Name+"="+l.Bind[0])
+	}
+	if got, want := strings.Join(binds, " "), "shard-a=:7000 shard-b=:7001 extra-1=:7101 extra-2=:7102"; got != want {
+		t.Errorf("listeners = %s, want %s", got, want)
+	}
+	servers := make([]string, 0)
+	for _, b := range cfg.Backends {
+		servers = append(servers, b.Name+"="+b.Servers[0].Address)
+	}
+	// The included file overrides a var for itself and the files after it
+	if got, want := strings.Join(servers, " "), "shard-a=10.0.0.1:9000 shard-b=10.0.0.1:9000 extra=10.0.0.2:9000"; got != want {
+		t.Errorf("backends = %s, want %s", got, want)
+	}
+
+	// A var that is not defined fails instead of expanding to nothing
+	writeFile(t, path, `version: '2'
+vars:
+  port: 80
+listeners:
+  - name: web
+    bind: ":{{ .prot }}"
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("expected an error naming the missing var, got %v", err)
+	}
+}
+
+func TestLoadConfig_Services(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvelox.yaml")
+	writeFile(t, path, `version: '2'
+defaults:
+  health_check:
+    active:
+      timeout: 2s
+services:
+  - name: web
+    port: 8080
+    upstreams: ['10.0.0.1:80', {address: '10.0.0.2:80', weight: 2}]
+    balance: leastconn
+    health_check: /healthz
+  - name: dns
+    bind: ['127.0.0.1', '[::1]:5353']
+    port: 53
+    protocol: udp
+    upstreams: ['10.0.1.1:53']
+listeners:
+  - name: admin
+    bind: ':9000'
+    default_backend: web
+`)
+	cfg, err := LoadWithOptions(path, LoadOptions{Overrides: Overrides{"services[dns].balance=random"}})
+	if err != nil {
+		t.Fatalf("LoadWithOptions failed: %v", err)
+	}
+	if len(cfg.Services) != 0 || len(cfg.Listeners) != 3 || len(cfg.Backends) != 2 {
+		t.Fatalf("expected the services expanded, got %d services, %d listeners, %d backends", len(cfg.Services), len(cfg.Listeners), len(cfg.Backends))
+	}
+	web, dns := cfg.Listeners[1], cfg.Listeners[2]
+	if web.Name != "web" || !slices.Equal(web.Bind, Binds{":8080"}) || web.Protocol != "tcp" || web.DefaultBackend != "web" {
+		t.Errorf("web listener = %+v", web)
+	}
+	if !slices.Equal(dns.Bind, Binds{"127.0.0.1:53", "[::1]:5353"}) || dns.Protocol != "udp" {
+		t.Errorf("dns listener = %+v", dns)
+	}
+	be := cfg.Backends[0]
+	want := ActiveHealthCheck{Type: "http", Path: "/healthz", Interval: "5s", Timeout: "2s"}
+	if be.Name != "web" || be.Balance != "leastconn" || len(be.Servers) != 2 || *be.Servers[1].Weight != 2 || be.HealthCheck.Active != want {
+		t.Errorf("web backend = %+v", be)
+	}
+	if cfg.Backends[1].Balance != "random" || cfg.Backends[1].HealthCheck.Active != (ActiveHealthCheck{Timeout: "2s"}) {
+		t.Errorf("dns backend = %+v", cfg.Backends[1])
+	}
+
+	// Upstreams are server entries in version 3
+	writeFile(t, path, `version: 3
+services:
+  - name: web
+    port: 8080
+    upstreams:
+      - host: 10.0.0.1
+        port: 80
+`)
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load version 3 failed: %v", err)
+	}
+	if cfg.Backends[0].Servers[0].Address != "10.0.0.1:80" {
+		t.Errorf("version 3 upstreams = %+v", cfg.Backends[0].Servers)
+	}
+
+	// A service is its listener and backend
+	writeFile(t, path, `version: '2'
+services:
+  - name: web
+    port: 8080
+    upstreams: ['10.0.0.1:80']
+backends:
+  - name: web
+    servers: ['10.0.0.2:80']
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "duplicate backend name: web") {
+		t.Errorf("expected a duplicate backend, got %v", err)
+	}
+}
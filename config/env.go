@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// envRe matches ${NAME}, ${NAME:-default} and the escaped form $${...}.
+var envRe = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv substitutes environment variables in raw configuration data.
+// ${NAME:-default} falls back to default when NAME is unset or empty; $${...}
+// is kept literally as ${...}. Unset variables without a default expand to
+// the empty string and are returned so the caller can warn about them.
+func expandEnv(data []byte) ([]byte, []string) {
+	var missing []string
+	seen := make(map[string]bool)
+	out := envRe.ReplaceAllFunc(data, func(m []byte) []byte {
+		if m[1] == '$' {
+			return m[1:] // escaped
+		}
+		sub := envRe.FindSubmatch(m)
+		name := string(sub[1])
+		if v := os.Getenv(name); v != "" {
+			return []byte(v)
+		}
+		if sub[2] != nil {
+			return sub[3]
+		}
+		if _, ok := os.LookupEnv(name); !ok && !seen[name] {
+			seen[name] = true
+			missing = append(missing, fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return nil
+	})
+	return out, missing
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Includes are the glob patterns of the files merged into a configuration.
+// A single pattern may be written as a plain string.
+type Includes []string
+
+func (inc *Includes) UnmarshalYAML(unmarshal func(any) error) error {
+	var pattern string
+	if err := unmarshal(&pattern); err == nil {
+		*inc = nil
+		if pattern != "" {
+			*inc = Includes{pattern}
+		}
+		return nil
+	}
+	var patterns []string
+	if err := unmarshal(&patterns); err != nil {
+		return err
+	}
+	*inc = patterns
+	return nil
+}
+
+func (inc Includes) MarshalYAML() (any, error) {
+	if len(inc) == 1 {
+		return inc[0], nil
+	}
+	return []string(inc), nil
+}
+
+// Files returns the files the patterns match in load order: patterns as
+// listed, the files of each in lexical order. A matched directory stands for
+// the configuration files (.yaml, .yml, .json, .toml) anywhere below it,
+// hidden files and directories excepted. A file matched twice is loaded at
+// its first position only.
+func (inc Includes) Files() ([]string, error) {
+	seen := make(map[string]bool)
+	files := make([]string, 0)
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	for _, pattern := range inc {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad include glob pattern %q: %w", pattern, err)
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read included config %s: %w", m, err)
+			}
+			if !info.IsDir() {
+				add(m)
+				continue
+			}
+			found, err := configFilesBelow(m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read included directory %s: %w", m, err)
+			}
+			for _, f := range found {
+				add(f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// configFilesBelow returns the configuration files under dir, sorted.
+func configFilesBelow(dir string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && isConfigFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// isConfigFile reports whether path has the extension of a format Load reads.
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json", ".toml":
+		return true
+	}
+	return false
+}
+
+// IncludeQuota limits the listeners, ports and backends the included files
+// matching Files may define, so that no single team's file can exhaust the
+// instance. The files share the limits unless PerFile is set. Zero means no
+// limit.
+type IncludeQuota struct {
+	Files        string `yaml:"files"`                   // glob on the included paths, or a directory covering the files below it
+	PerFile      bool   `yaml:"per_file,omitempty"`      // apply the limits to each file on its own
+	MaxListeners int    `yaml:"max_listeners,omitempty"` // listener blocks
+	MaxPorts     int    `yaml:"max_ports,omitempty"`     // bound ports, every port of a range and protocol counted
+	MaxBackends  int    `yaml:"max_backends,omitempty"`
+}
+
+// matches reports whether the included file path falls under the quota.
+func (q IncludeQuota) matches(path string) bool {
+	if ok, _ := filepath.Match(q.Files, path); ok {
+		return true
+	}
+	dir := filepath.Clean(q.Files)
+	return strings.HasPrefix(filepath.Clean(path), dir+string(filepath.Separator))
+}
+
+// includeUsage is what one included file defines.
+type includeUsage struct {
+	file      string
+	listeners int
+	ports     int
+	backends  int
+}
+
+func newIncludeUsage(file string, listeners []Listener, backends []Backend, services []Service) includeUsage {
+	u := includeUsage{file: file, listeners: len(listeners) + len(services), backends: len(backends) + len(services)}
+	for _, l := range listeners {
+		u.ports += portCount(l)
+	}
+	for _, s := range services {
+		l, _ := s.expand(ActiveHealthCheck{})
+		u.ports += portCount(l)
+	}
+	return u
+}
+
+// portCount returns the number of ports a listener binds, as ExpandListener
+// would bind them, its knock port included.
+func portCount(l Listener) int {
+	protocols := len(l.Protocols())
+	n := 0
+	if l.Preauth.Knock != "" {
+		n++
+	}
+	if len(l.Bind) == 0 {
+		return n + protocols // the server default port
+	}
+	for _, bind := range l.Bind {
+		ports := 1
+		if i := strings.LastIndex(bind, ":"); i > strings.LastIndex(bind, "]") {
+			if lo, hi, ok := strings.Cut(bind[i+1:], "-"); ok {
+				start, err1 := strconv.Atoi(lo)
+				end, err2 := strconv.Atoi(hi)
+				if err1 == nil && err2 == nil && end >= start {
+					ports = end - start + 1
+				}
+			}
+		}
+		n += ports * protocols
+	}
+	return n
+}
+
+// checkIncludeQuotas fails for the first quota that usage exceeds.
+func checkIncludeQuotas(quotas []IncludeQuota, usage []includeUsage) error {
+	for _, q := range quotas {
+		if q.Files == "" {
+			return fmt.Errorf("include_quotas: files is required")
+		}
+		if _, err := filepath.Match(q.Files, ""); err != nil {
+			return fmt.Errorf("include_quotas: bad files pattern %q: %w", q.Files, err)
+		}
+		var total includeUsage
+		for _, u := range usage {
+			if !q.matches(u.file) {
+				continue
+			}
+			if q.PerFile {
+				if err := q.check(u, u.file+" defines"); err != nil {
+					return err
+				}
+				continue
+			}
+			total.listeners += u.listeners
+			total.ports += u.ports
+			total.backends += u.backends
+		}
+		if err := q.check(total, "the matching files define"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q IncludeQuota) check(u includeUsage, subject string) error {
+	exceeded := func(what string, n, limit int) error {
+		return fmt.Errorf("include quota %s: %s %d %s, the limit is %d", q.Files, subject, n, what, limit)
+	}
+	switch {
+	case q.MaxListeners > 0 && u.listeners > q.MaxListeners:
+		return exceeded("listeners", u.listeners, q.MaxListeners)
+	case q.MaxPorts > 0 && u.ports > q.MaxPorts:
+		return exceeded("ports", u.ports, q.MaxPorts)
+	case q.MaxBackends > 0 && u.backends > q.MaxBackends:
+		return exceeded("backends", u.backends, q.MaxBackends)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import "strings"
+
+// DefaultFile is the configuration file read when -config is not given.
+const DefaultFile = "nvelox.yaml"
+
+// ConfigFiles are the files given to -config: the main file, then the files
+// layered over it (see LoadOptions.Layers). It implements flag.Value, so the
+// flag may be repeated.
+type ConfigFiles []string
+
+func (f *ConfigFiles) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *ConfigFiles) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// Split returns the main file, DefaultFile when none was given, and the
+// files layered over it.
+func (f ConfigFiles) Split() (string, []string) {
+	if len(f) == 0 {
+		return DefaultFile, nil
+	}
+	return f[0], f[1:]
+}
+
+// layerPatterns returns the config_dirs and the layers of opts, in load
+// order, as include patterns.
+func (cfg *Config) layerPatterns(opts LoadOptions) Includes {
+	patterns := make(Includes, 0, len(cfg.ConfigDirs)+len(opts.Layers))
+	patterns = append(patterns, cfg.ConfigDirs...)
+	return append(patterns, opts.Layers...)
+}
+
+// sources returns the include patterns of every file merged into cfg after
+// the main file.
+func (cfg *Config) sources(opts LoadOptions) Includes {
+	return append(append(Includes(nil), cfg.Include...), cfg.layerPatterns(opts)...)
+}
+
+// applyLayers merges the files of config_dirs, in lexical order, and then
+// the layers of opts over cfg.
+func (cfg *Config) applyLayers(path string, opts LoadOptions) error {
+	files, err := cfg.layerPatterns(opts).Files()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if sameFile(file, path) {
+			continue // a config dir holding the main file
+		}
+		data, err := readMerged(file, "layered", cfg)
+		if err != nil {
+			return err
+		}
+		listeners, backends, services := cfg.Listeners, cfg.Backends, cfg.Services
+		if err := decodeMerged(data, file, "layered", cfg, opts); err != nil {
+			return err
+		}
+		cfg.Listeners = layerNamed(listeners, cfg.Listeners, func(l Listener) string { return l.Name })
+		cfg.Backends = layerNamed(backends, cfg.Backends, func(b Backend) string { return b.Name })
+		cfg.Services = layerNamed(services, cfg.Services, func(s Service) string { return s.Name })
+	}
+	return nil
+}
+
+// layerNamed replaces the entries of base that over has an entry of the
+// same name for, in place, and appends the others.
+func layerNamed[T any](base, over []T, name func(T) string) []T {
+	out := append([]T(nil), base...)
+	index := make(map[string]int, len(out))
+	for i, v := range out {
+		index[name(v)] = i
+	}
+	for _, v := range over {
+		if i, ok := index[name(v)]; ok {
+			out[i] = v
+			continue
+		}
+		index[name(v)] = len(out)
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides are "path=value" assignments applied on top of the loaded files,
+// as given to -set. It implements flag.Value, so the flag may be repeated.
+//
+// A path names keys as in the file, separated by dots. List entries are
+// picked by index or by their name (servers: address), and map entries by
+// key: listeners[0].bind, backends[api].servers[10.0.0.1:80].weight,
+// hosts[db.local].
+// The value is read as YAML, so lists and objects may be given in flow
+// style: listeners[web].bind=[":80", ":81"].
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ", ")
+}
+
+func (o *Overrides) Set(s string) error {
+	if _, _, ok := strings.Cut(s, "="); !ok {
+		return fmt.Errorf("%q is not path=value", s)
+	}
+	*o = append(*o, s)
+	return nil
+}
+
+// Apply assigns every override to cfg in order.
+func (o Overrides) Apply(cfg *Config) error {
+	for _, s := range o {
+		path, value, _ := strings.Cut(s, "=")
+		segs, err := parsePath(path)
+		if err != nil {
+			return fmt.Errorf("set %s: %w", path, err)
+		}
+		if err := setPath(reflect.ValueOf(cfg).Elem(), segs, value); err != nil {
+			return fmt.Errorf("set %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pathSeg is one step of an override path: a key, or an [index] when
+// indexed is set.
+type pathSeg struct {
+	name    string
+	indexed bool
+}
+
+func parsePath(path string) ([]pathSeg, error) {
+	segs := make([]pathSeg, 0)
+	rest := strings.TrimSpace(path)
+	for rest != "" {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end < 2 || len(segs) == 0 {
+				return nil, fmt.Errorf("bad index in %q", path)
+			}
+			segs = append(segs, pathSeg{name: rest[1:end], indexed: true})
+			rest = rest[end+1:]
+			continue
+		}
+		if len(segs) > 0 {
+			if rest[0] != '.' {
+				return nil, fmt.Errorf("bad path %q", path)
+			}
+			rest = rest[1:]
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("empty key in %q", path)
+		}
+		segs = append(segs, pathSeg{name: rest[:end]})
+		rest = rest[end:]
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segs, nil
+}
+
+func setPath(v reflect.Value, segs []pathSeg, value string) error {
+	if v.Kind() == reflect.Pointer && len(segs) > 0 {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), segs, value)
+	}
+	if len(segs) == 0 {
+		return decodeValue(v, value)
+	}
+
+	seg := segs[0]
+	switch {
+	case !seg.indexed && v.Kind() == reflect.Struct:
+		f, ok := fieldByKey(v, seg.name)
+		if !ok {
+			return fmt.Errorf("unknown key %q", seg.name)
+		}
+		return setPath(f, segs[1:], value)
+	case seg.indexed && v.Kind() == reflect.Slice:
+		i, err := sliceIndex(v, seg.name)
+		if err != nil {
+			return err
+		}
+		return setPath(v.Index(i), segs[1:], value)
+	case seg.indexed && v.Kind() == reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(seg.name).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			elem.Set(old)
+		}
+		if err := setPath(elem, segs[1:], value); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case seg.indexed:
+		return fmt.Errorf("[%s] used on a %s", seg.name, v.Kind())
+	default:
+		return fmt.Errorf("key %q used on a %s", seg.name, v.Kind())
+	}
+}
+
+// fieldByKey finds the struct field with the given YAML key.
+func fieldByKey(v reflect.Value, key string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == key && name != "-" {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// sliceIndex resolves a list index given as a number or as the name or
+// address of an entry.
+func sliceIndex(v reflect.Value, index string) (int, error) {
+	if i, err := strconv.Atoi(index); err == nil {
+		if i < 0 || i >= v.Len() {
+			return 0, fmt.Errorf("index %d out of range, the list has %d entries", i, v.Len())
+		}
+		return i, nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		e := reflect.Indirect(v.Index(i))
+		if e.Kind() != reflect.Struct {
+			break
+		}
+		for _, key := range []string{"name", "address"} {
+			if f, ok := fieldByKey(e, key); ok && f.Kind() == reflect.String && f.String() == index {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no entry named %q", index)
+}
+
+// decodeValue reads value as YAML into v. Values that are not valid YAML
+// on their own, such as "*:80", are taken as plain strings.
+func decodeValue(v reflect.Value, value string) error {
+	if strings.TrimSpace(value) == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	target := reflect.New(v.Type())
+	err := yaml.Unmarshal([]byte(value), target.Interface())
+	if err != nil {
+		quoted, _ := yaml.Marshal(value)
+		if yaml.Unmarshal(quoted, target.Interface()) != nil {
+			return err
+		}
+	}
+	v.Set(target.Elem())
+	return nil
+}
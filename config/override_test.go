@@ -0,0 +1,82 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOverrides_Apply(t *testing.T) {
+	cfg := &Config{
+		Listeners: []Listener{{Name: "web", Bind: Binds{":80"}}, {Name: "api", Bind: Binds{":81"}}},
+		Backends:  []Backend{{Name: "be", Servers: []Server{{Address: "10.0.0.1:80"}, {Address: "10.0.0.2:80"}}}},
+	}
+	err := Overrides{
+		"logging.level=debug",
+		"listeners[0].bind=:9090",
+		"listeners[api].bind=[\"*:81\", \":82\"]",
+		"listeners[web].priority=high",
+		"backends[be].send_proxy_v2=true",
+		"backends[be].servers[10.0.0.2:80].weight=0",
+		"backends[0].timeouts.connect=2s",
+		"hosts[db.local]=[\"10.0.0.9\"]",
+		"server.port=8080",
+	}.Apply(cfg)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if cfg.Logging.Level != "debug" || cfg.Server.Port != 8080 {
+		t.Errorf("scalars not set: level %q port %d", cfg.Logging.Level, cfg.Server.Port)
+	}
+	if !slices.Equal(cfg.Listeners[0].Bind, Binds{":9090"}) || !slices.Equal(cfg.Listeners[1].Bind, Binds{"*:81", ":82"}) {
+		t.Errorf("binds not set: %v %v", cfg.Listeners[0].Bind, cfg.Listeners[1].Bind)
+	}
+	if cfg.Listeners[0].Priority != PriorityHigh {
+		t.Errorf("priority = %q", cfg.Listeners[0].Priority)
+	}
+	be := cfg.Backends[0]
+	if !be.SendsProxyV2() || be.Servers[1].Weight == nil || *be.Servers[1].Weight != 0 || be.Timeouts.Connect != "2s" {
+		t.Errorf("backend not overridden: %+v", be)
+	}
+	if !slices.Equal(cfg.Hosts["db.local"], []string{"10.0.0.9"}) {
+		t.Errorf("hosts = %v", cfg.Hosts)
+	}
+
+	for _, bad := range []string{
+		"loging.level=debug",
+		"listeners[7].bind=:1",
+		"listeners[nope].bind=:1",
+		"logging[0]=x",
+		"server.port.x=1",
+		"server.port=eighty",
+		"listeners..bind=:1",
+	} {
+		if err := (Overrides{bad}).Apply(cfg); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestLoadConfig_Overrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nvelox.yaml")
+	writeFile(t, path, "version: '2'\nlisteners:\n  - name: web\n    bind: ':80'\n    default_backend: be\nbackends:\n  - name: be\n    servers: ['10.0.0.1:80']\n")
+
+	cfg, err := LoadWithOptions(path, LoadOptions{Overrides: Overrides{"listeners[web].bind=:9090"}})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !slices.Equal(cfg.Listeners[0].Bind, Binds{":9090"}) {
+		t.Errorf("bind = %v, want :9090", cfg.Listeners[0].Bind)
+	}
+
+	// Overrides are validated like the file itself
+	_, err = LoadWithOptions(path, LoadOptions{Overrides: Overrides{"listeners[web].default_backend=missing"}})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	if err := new(Overrides).Set("logging.level"); err == nil {
+		t.Error("expected error for an override without a value")
+	}
+}
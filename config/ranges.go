@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// MaxServerRange caps the servers one CIDR or range entry expands to.
+const MaxServerRange = 4096
+
+// expandServer expands a server entry whose host is a CIDR prefix
+// ("10.0.1.0/28:8080") or an inclusive range of IPs
+// ("10.0.1.10-10.0.1.20:8080") into one entry per address, each with the
+// settings of the original. IPv4 prefixes up to /30 leave out their network
+// and broadcast addresses. ok is false for any other entry.
+func expandServer(s Server) (servers []Server, ok bool, err error) {
+	host, port, splitErr := net.SplitHostPort(s.Address)
+	if splitErr != nil {
+		host, port = s.Address, ""
+	}
+
+	var first, last netip.Addr
+	if strings.Contains(host, "/") {
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid CIDR %q", host)
+		}
+		prefix = prefix.Masked()
+		first, last = prefix.Addr(), lastAddr(prefix)
+		if first.Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+	} else {
+		from, to, found := strings.Cut(host, "-")
+		if !found {
+			return nil, false, nil
+		}
+		if first, err = netip.ParseAddr(from); err != nil {
+			return nil, false, nil // A host name with a dash
+		}
+		if last, err = netip.ParseAddr(to); err != nil || first.Is4() != last.Is4() {
+			return nil, true, fmt.Errorf("invalid range %q", host)
+		}
+		if last.Less(first) {
+			return nil, true, fmt.Errorf("range %q ends before it starts", host)
+		}
+	}
+
+	for a := first; a.IsValid() && !last.Less(a); a = a.Next() {
+		if len(servers) == MaxServerRange {
+			return nil, true, fmt.Errorf("%s expands to more than %d servers", host, MaxServerRange)
+		}
+		entry := s
+		entry.Address = a.String()
+		if port != "" {
+			entry.Address = net.JoinHostPort(entry.Address, port)
+		}
+		servers = append(servers, entry)
+	}
+	return servers, true, nil
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// expandServers replaces the CIDR and range entries of a server list by
+// the servers they expand to. Entries that fail to expand are kept for
+// Validate to report.
+func expandServers(servers []Server) []Server {
+	out := make([]Server, 0, len(servers))
+	for _, s := range servers {
+		expanded, ok, err := expandServer(s)
+		if !ok || err != nil {
+			out = append(out, s)
+			continue
+		}
+		out = append(out, expanded...)
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// vaultTimeout bounds reading one secret from Vault.
+const vaultTimeout = 10 * time.Second
+
+var vaultClient = &http.Client{Timeout: vaultTimeout}
+
+// Secret is a configuration value that may name where a secret is kept
+// instead of holding it:
+//
+//	file:/etc/nvelox/tls.key   the contents of a file
+//	env:TLS_KEY                an environment variable
+//	vault:secret/nvelox#key    a field of a Vault secret, read with VAULT_ADDR and VAULT_TOKEN
+//
+// Any other value is the secret itself. Loading resolves references, so a
+// reload picks up a rotated secret. Only the reference is written back out:
+// dumps and the admin API never show a resolved secret.
+type Secret struct {
+	Ref   string
+	value string // resolved from Ref
+}
+
+// Value returns the secret, which is Ref itself unless Ref is a reference.
+func (s Secret) Value() string {
+	if _, _, ok := secretRef(s.Ref); !ok {
+		return s.Ref
+	}
+	return s.value
+}
+
+// IsZero reports whether the secret is unset, for omitempty.
+func (s Secret) IsZero() bool {
+	return s.Ref == ""
+}
+
+func (s *Secret) UnmarshalYAML(n *yaml.Node) error {
+	*s = Secret{}
+	return n.Decode(&s.Ref)
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.Ref, nil
+}
+
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	*s = Secret{}
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &s.Ref)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Ref)
+}
+
+// Resolve reads the secret a reference points to.
+func (s *Secret) Resolve() error {
+	scheme, target, ok := secretRef(s.Ref)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch scheme {
+	case "file":
+		var data []byte
+		data, err = os.ReadFile(target)
+		s.value = string(data)
+	case "env":
+		var found bool
+		if s.value, found = os.LookupEnv(target); !found {
+			err = fmt.Errorf("environment variable %s is not set", target)
+		}
+	case "vault":
+		s.value, err = readVault(target)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Ref, err)
+	}
+	return nil
+}
+
+// secretRef splits a reference into its scheme and target.
+func secretRef(v string) (scheme, target string, ok bool) {
+	scheme, target, ok = strings.Cut(v, ":")
+	switch scheme {
+	case "file", "env", "vault":
+		return scheme, target, ok && target != ""
+	}
+	return "", "", false
+}
+
+// readVault reads a field of a Vault secret ("path#field") through the HTTP
+// API. The path is that of the API below /v1, e.g. secret/data/nvelox for
+// the nvelox secret of a KV version 2 engine mounted at secret.
+func readVault(ref string) (string, error) {
+	path, field, _ := strings.Cut(ref, "#")
+	if field == "" {
+		return "", fmt.Errorf("missing #field")
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := body.Data
+	if inner, ok := data["data"].(map[string]any); ok {
+		data = inner // KV version 2 nests the secret
+	}
+	v, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("no field %s", field)
+	}
+	return v, nil
+}
+
+// ResolveSecrets resolves the secret references of the listener.
+func (l *Listener) ResolveSecrets() error {
+	if err := l.TLS.Cert.Resolve(); err != nil {
+		return fmt.Errorf("listener %s tls cert: %w", l.Name, err)
+	}
+	if err := l.TLS.Key.Resolve(); err != nil {
+		return fmt.Errorf("listener %s tls key: %w", l.Name, err)
+	}
+	if err := l.Preauth.Secret.Resolve(); err != nil {
+		return fmt.Errorf("listener %s preauth secret: %w", l.Name, err)
+	}
+	return nil
+}
+
+// resolveSecrets resolves every secret reference of the configuration.
+func (cfg *Config) resolveSecrets() error {
+	for i := range cfg.Listeners {
+		if err := cfg.Listeners[i].ResolveSecrets(); err != nil {
+			return err
+		}
+	}
+	for i := range cfg.Backends {
+		b := &cfg.Backends[i]
+		if err := b.Tunnel.Secret.Resolve(); err != nil {
+			return fmt.Errorf("backend %s tunnel secret: %w", b.Name, err)
+		}
+	}
+	if err := cfg.Admin.Token.Resolve(); err != nil {
+		return fmt.Errorf("admin token: %w", err)
+	}
+	if err := cfg.Admin.GRPC.Token.Resolve(); err != nil {
+		return fmt.Errorf("admin grpc token: %w", err)
+	}
+	if err := cfg.Admin.GRPC.Cert.Resolve(); err != nil {
+		return fmt.Errorf("admin grpc cert: %w", err)
+	}
+	if err := cfg.Admin.GRPC.Key.Resolve(); err != nil {
+		return fmt.Errorf("admin grpc key: %w", err)
+	}
+	if err := cfg.Tunnel.Secret.Resolve(); err != nil {
+		return fmt.Errorf("tunnel secret: %w", err)
+	}
+	if err := cfg.State.Password.Resolve(); err != nil {
+		return fmt.Errorf("state password: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import "strings"
+
+// Health check interval and timeout of services whose defaults set none.
+const (
+	serviceCheckInterval = "5s"
+	serviceCheckTimeout  = "2s"
+)
+
+// Service is the short form of the common case: one listener in front of
+// one backend, both named after the service. ApplyDefaults expands services
+// into those blocks, so a listener or backend of the same name is a
+// duplicate; settings beyond these fields need the blocks themselves.
+type Service struct {
+	Name     string `yaml:"name"`
+	Bind     Binds  `yaml:"bind,omitempty"`     // as on a listener
+	Port     int    `yaml:"port,omitempty"`     // completes binds without a port, ":port" without binds
+	Protocol string `yaml:"protocol,omitempty"` // as on a listener
+
+	Upstreams []Server `yaml:"upstreams"`         // the servers of the backend, or plain addresses
+	Balance   string   `yaml:"balance,omitempty"` // as on a backend
+
+	// HealthCheck actively checks the upstreams: "tcp", or the path of an
+	// HTTP check. Interval and timeout come from defaults, or are 5s and 2s.
+	HealthCheck string `yaml:"health_check,omitempty"`
+}
+
+// expand returns the listener and backend the service stands for; d is the
+// active health check of the defaults.
+func (s Service) expand(d ActiveHealthCheck) (Listener, Backend) {
+	port := ServerConfig{Port: s.Port}
+	binds := s.Bind
+	if len(binds) == 0 && s.Port != 0 {
+		binds = Binds{""}
+	}
+	l := Listener{Name: s.Name, Protocol: s.Protocol, DefaultBackend: s.Name}
+	for _, bind := range binds {
+		l.Bind = append(l.Bind, port.defaultBind(bind))
+	}
+
+	b := Backend{Name: s.Name, Balance: s.Balance, Servers: append([]Server(nil), s.Upstreams...)}
+	switch {
+	case s.HealthCheck == "":
+	case strings.HasPrefix(s.HealthCheck, "/"):
+		b.HealthCheck.Active = ActiveHealthCheck{Type: "http", Path: s.HealthCheck}
+	default:
+		b.HealthCheck.Active = ActiveHealthCheck{Type: s.HealthCheck}
+	}
+	if s.HealthCheck != "" && d.Interval == "" {
+		b.HealthCheck.Active.Interval = serviceCheckInterval
+	}
+	if s.HealthCheck != "" && d.Timeout == "" {
+		b.HealthCheck.Active.Timeout = serviceCheckTimeout
+	}
+	return l, b
+}
+
+// expandServices appends the listeners and backends of the services, which
+// are gone from the configuration after.
+func (cfg *Config) expandServices() {
+	for _, s := range cfg.Services {
+		l, b := s.expand(cfg.Defaults.HealthCheck.Active)
+		cfg.Listeners = append(cfg.Listeners, l)
+		cfg.Backends = append(cfg.Backends, b)
+	}
+	cfg.Services = nil
+}
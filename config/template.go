@@ -0,0 +1,67 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"regexp"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// actionRe matches a template action, trim markers included.
+var actionRe = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+
+// templateFuncs are the functions available to configuration templates,
+// besides the text/template builtins.
+var templateFuncs = template.FuncMap{
+	// seq returns the integers from start to end inclusive, to range over
+	// a block of ports: {{ range seq 7000 7099 }}.
+	"seq": func(start, end int) []int {
+		out := make([]int, 0)
+		for i := start; i <= end; i++ {
+			out = append(out, i)
+		}
+		return out
+	},
+	"add": func(a, b int) int { return a + b },
+}
+
+// expandTemplate executes data, as read from path, as a Go text/template.
+// Its data is the vars section of the file over inherited, the vars merged
+// from the files loaded before. Data without template actions is returned
+// unchanged.
+func expandTemplate(path string, data []byte, inherited map[string]any) ([]byte, error) {
+	if !bytes.Contains(data, []byte("{{")) {
+		return data, nil
+	}
+
+	// The vars themselves are plain values; read them with every action
+	// blanked out, since the template is not a valid document before it runs
+	plain, err := toYAML(path, actionRe.ReplaceAll(data, nil))
+	if err != nil {
+		return nil, fmt.Errorf("reading vars: %w", err)
+	}
+	var doc struct {
+		Vars map[string]any `yaml:"vars"`
+	}
+	if err := yaml.Unmarshal(plain, &doc); err != nil {
+		return nil, fmt.Errorf("reading vars: %w", err)
+	}
+	vars := maps.Clone(inherited)
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	maps.Copy(vars, doc.Vars)
+
+	tmpl, err := template.New(path).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,541 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version 3 of the file format restructures listeners and backends:
+//
+//   - servers are always entries with a host and an optional port, and carry
+//     their own weight instead of a backend weights map;
+//   - the connection features of listeners (rate_limit, tls_fingerprint,
+//     timeouts, capture_on_reject, error_response, accept_proxy, preauth)
+//     and the PROXY protocol of backends are listed as middleware;
+//   - listener buffer, event loop and socket settings (zero_copy,
+//     max_conn_buffer, park_idle, socket, tls_inspect) move to tuning.
+//
+// Both versions load into the same Config: version 3 documents are rewritten
+// to the version 2 layout before decoding, and MigrateV3 rewrites the other
+// way.
+
+// listenerMiddleware and listenerTuning are the version 2 listener keys
+// version 3 groups under middleware and tuning.
+var (
+	listenerMiddleware = []string{"rate_limit", "tls_fingerprint", "timeouts", "capture_on_reject", "error_response", "accept_proxy", "preauth"}
+	listenerTuning     = []string{"zero_copy", "max_conn_buffer", "park_idle", "socket", "tls_inspect"}
+)
+
+// documentVersion returns the version key of a parsed document, "" without one.
+func documentVersion(doc *yaml.Node) string {
+	if root := rootMapping(doc); root != nil {
+		if v := mapValue(root, "version"); v != nil {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// fromV3 rewrites YAML data in the version 3 layout to version 2 when its
+// version, or fallback for a file without one, is 3. Other data is returned
+// unchanged.
+func fromV3(data []byte, fallback string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return data, nil // reported by the decoder
+	}
+	version := documentVersion(&doc)
+	if version == "" {
+		version = fallback
+	}
+	root := rootMapping(&doc)
+	if version != "3" || root == nil {
+		return data, nil
+	}
+
+	for _, l := range seqItems(mapValue(root, "listeners")) {
+		if err := listenerFromV3(l); err != nil {
+			return nil, fmt.Errorf("listener %s: %w", mapString(l, "name"), err)
+		}
+	}
+	for _, b := range seqItems(mapValue(root, "backends")) {
+		if err := backendFromV3(b); err != nil {
+			return nil, fmt.Errorf("backend %s: %w", mapString(b, "name"), err)
+		}
+	}
+	for _, svc := range seqItems(mapValue(root, "services")) {
+		if err := serversFromV3(mapValue(svc, "upstreams")); err != nil {
+			return nil, fmt.Errorf("service %s: %w", mapString(svc, "name"), err)
+		}
+	}
+	if d := mapValue(root, "defaults"); d != nil && d.Kind == yaml.MappingNode {
+		if err := defaultsFromV3(d); err != nil {
+			return nil, fmt.Errorf("defaults: %w", err)
+		}
+	}
+	return yaml.Marshal(&doc)
+}
+
+func listenerFromV3(l *yaml.Node) error {
+	if l.Kind != yaml.MappingNode {
+		return nil
+	}
+	for _, k := range listenerMiddleware {
+		if mapValue(l, k) != nil {
+			return fmt.Errorf("%s is a middleware in version 3", k)
+		}
+	}
+	for _, k := range listenerTuning {
+		if mapValue(l, k) != nil {
+			return fmt.Errorf("%s belongs under tuning in version 3", k)
+		}
+	}
+
+	_, mw := mapDelete(l, "middleware")
+	stages, err := middlewareStages(mw)
+	if err != nil {
+		return err
+	}
+	for _, s := range stages {
+		switch s.name {
+		case "rate_limit", "timeouts", "capture_on_reject", "error_response", "accept_proxy", "preauth":
+			mapSet(l, s.key, s.value)
+		case "tls_fingerprint":
+			if !emptyNode(s.value) {
+				return fmt.Errorf("tls_fingerprint takes no settings")
+			}
+			mapSet(l, s.key, scalarNode("!!bool", "true"))
+		default:
+			return fmt.Errorf("unknown listener middleware %q", s.name)
+		}
+	}
+
+	_, tuning := mapDelete(l, "tuning")
+	if tuning == nil || emptyNode(tuning) {
+		return nil
+	}
+	if tuning.Kind != yaml.MappingNode {
+		return fmt.Errorf("tuning must be a mapping")
+	}
+	for i := 0; i < len(tuning.Content); i += 2 {
+		key := tuning.Content[i]
+		if !slices.Contains(listenerTuning, key.Value) {
+			return fmt.Errorf("unknown tuning key %q", key.Value)
+		}
+		mapSet(l, key, tuning.Content[i+1])
+	}
+	return nil
+}
+
+func backendFromV3(b *yaml.Node) error {
+	if b.Kind != yaml.MappingNode {
+		return nil
+	}
+	if mapValue(b, "weights") != nil {
+		return fmt.Errorf("weights are set on the server entries in version 3")
+	}
+	for _, k := range []string{"send_proxy_v2", "proxy_v2_family_mismatch", "proxy_v2_peer"} {
+		if mapValue(b, k) != nil {
+			return fmt.Errorf("%s is the proxy_v2 middleware in version 3", k)
+		}
+	}
+
+	if err := serversFromV3(mapValue(b, "servers")); err != nil {
+		return err
+	}
+
+	mwKey, mw := mapDelete(b, "middleware")
+	if mwKey == nil {
+		return nil // inherits the defaults
+	}
+	stages, err := middlewareStages(mw)
+	if err != nil {
+		return err
+	}
+	send := "false"
+	for _, s := range stages {
+		if s.name != "proxy_v2" {
+			return fmt.Errorf("unknown backend middleware %q", s.name)
+		}
+		send = "true"
+		if emptyNode(s.value) {
+			continue
+		}
+		if s.value.Kind != yaml.MappingNode {
+			return fmt.Errorf("proxy_v2 settings must be a mapping")
+		}
+		for i := 0; i < len(s.value.Content); i += 2 {
+			key := s.value.Content[i]
+			switch key.Value {
+			case "family_mismatch", "peer":
+				mapSet(b, scalarNode("!!str", "proxy_v2_"+key.Value), s.value.Content[i+1])
+			default:
+				return fmt.Errorf("unknown proxy_v2 setting %q", key.Value)
+			}
+		}
+	}
+	mapSet(b, scalarNode("!!str", "send_proxy_v2"), scalarNode("!!bool", send))
+	return nil
+}
+
+// serversFromV3 converts the server entries of a backend or the upstreams
+// of a service.
+func serversFromV3(servers *yaml.Node) error {
+	for _, s := range seqItems(servers) {
+		if s.Kind != yaml.MappingNode {
+			return fmt.Errorf("server %q: servers are entries with a host in version 3", s.Value)
+		}
+		if mapValue(s, "address") != nil {
+			return fmt.Errorf("server %s: address is host and port in version 3", mapString(s, "address"))
+		}
+		hostKey, host := mapDelete(s, "host")
+		if host == nil || host.Value == "" {
+			return fmt.Errorf("server entry without a host")
+		}
+		addr := host.Value
+		if _, port := mapDelete(s, "port"); port != nil && port.Value != "" {
+			addr = net.JoinHostPort(host.Value, port.Value)
+		}
+		hostKey.Value = "address"
+		s.Content = append([]*yaml.Node{hostKey, scalarNode("!!str", addr)}, s.Content...)
+	}
+	return nil
+}
+
+func defaultsFromV3(d *yaml.Node) error {
+	if mapValue(d, "send_proxy_v2") != nil {
+		return fmt.Errorf("send_proxy_v2 is the proxy_v2 middleware in version 3")
+	}
+	_, mw := mapDelete(d, "middleware")
+	stages, err := middlewareStages(mw)
+	if err != nil {
+		return err
+	}
+	for _, s := range stages {
+		if s.name != "proxy_v2" {
+			return fmt.Errorf("unknown backend middleware %q", s.name)
+		}
+		if !emptyNode(s.value) {
+			return fmt.Errorf("proxy_v2 settings are set per backend")
+		}
+		mapSet(d, scalarNode("!!str", "send_proxy_v2"), scalarNode("!!bool", "true"))
+	}
+	return nil
+}
+
+// stage is one entry of a middleware list: a single key naming the stage,
+// with its settings as value.
+type stage struct {
+	name  string
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+func middlewareStages(mw *yaml.Node) ([]stage, error) {
+	if mw == nil || emptyNode(mw) {
+		return nil, nil
+	}
+	if mw.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("middleware must be a list")
+	}
+	stages := make([]stage, 0, len(mw.Content))
+	seen := make(map[string]bool)
+	for _, item := range mw.Content {
+		var s stage
+		switch {
+		case item.Kind == yaml.ScalarNode:
+			s = stage{name: item.Value, key: item, value: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}}
+		case item.Kind == yaml.MappingNode && len(item.Content) == 2:
+			s = stage{name: item.Content[0].Value, key: item.Content[0], value: item.Content[1]}
+		default:
+			return nil, fmt.Errorf("middleware entries name a single stage")
+		}
+		if seen[s.name] {
+			return nil, fmt.Errorf("middleware %s is listed twice", s.name)
+		}
+		seen[s.name] = true
+		stages = append(stages, s)
+	}
+	return stages, nil
+}
+
+// MigrateV3 rewrites a version 2 configuration, as read from path in any
+// supported format, in the version 3 layout. YAML comments are kept. The
+// returned notes describe settings that could not be carried over.
+func MigrateV3(path string, data []byte) ([]byte, []string, error) {
+	data, err := toYAML(path, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	root := rootMapping(&doc)
+	if root == nil {
+		return nil, nil, fmt.Errorf("not a configuration document")
+	}
+	switch v := documentVersion(&doc); v {
+	case "3":
+		return nil, nil, fmt.Errorf("already version 3")
+	case "", "2":
+	default:
+		return nil, nil, fmt.Errorf("unsupported version: %s", v)
+	}
+
+	if v := mapValue(root, "version"); v != nil {
+		v.Tag, v.Value, v.Style = "!!int", "3", 0
+	} else {
+		root.Content = append([]*yaml.Node{scalarNode("!!str", "version"), scalarNode("!!int", "3")}, root.Content...)
+	}
+
+	defaults := mapValue(root, "defaults")
+	inherited := isTrue(mapValue(defaults, "send_proxy_v2"))
+	notes := make([]string, 0)
+	for _, l := range seqItems(mapValue(root, "listeners")) {
+		listenerToV3(l)
+	}
+	for _, b := range seqItems(mapValue(root, "backends")) {
+		notes = append(notes, backendToV3(b, inherited)...)
+	}
+	for _, svc := range seqItems(mapValue(root, "services")) {
+		serversToV3(mapValue(svc, "upstreams"), nil)
+	}
+	if defaults != nil && defaults.Kind == yaml.MappingNode {
+		if key, send := mapDelete(defaults, "send_proxy_v2"); isTrue(send) {
+			key.Value = "proxy_v2"
+			mapSet(defaults, scalarNode("!!str", "middleware"), seqNode(mappingNode(key, emptyMapping())))
+		}
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	return out.Bytes(), notes, enc.Close()
+}
+
+func listenerToV3(l *yaml.Node) {
+	if l.Kind != yaml.MappingNode {
+		return
+	}
+	mw := seqNode()
+	for _, k := range listenerMiddleware {
+		key, v := mapDelete(l, k)
+		switch {
+		case v == nil:
+		case k == "tls_fingerprint":
+			if isTrue(v) {
+				mw.Content = append(mw.Content, mappingNode(key, emptyMapping()))
+			}
+		case !emptyNode(v):
+			mw.Content = append(mw.Content, mappingNode(key, v))
+		}
+	}
+	if len(mw.Content) > 0 {
+		mapSet(l, scalarNode("!!str", "middleware"), mw)
+	}
+
+	tuning := emptyMapping()
+	tuning.Style = 0
+	for _, k := range listenerTuning {
+		if key, v := mapDelete(l, k); v != nil && v.Value != "false" && v.Value != "0" {
+			tuning.Content = append(tuning.Content, key, v)
+		}
+	}
+	if len(tuning.Content) > 0 {
+		mapSet(l, scalarNode("!!str", "tuning"), tuning)
+	}
+}
+
+// backendToV3 converts a backend entry; inherited tells whether the
+// defaults send PROXY headers.
+func backendToV3(b *yaml.Node, inherited bool) []string {
+	if b.Kind != yaml.MappingNode {
+		return nil
+	}
+	name := mapString(b, "name")
+	notes := make([]string, 0)
+
+	weights := make(map[string]*yaml.Node)
+	order := make([]string, 0)
+	if _, w := mapDelete(b, "weights"); w != nil && w.Kind == yaml.MappingNode {
+		for i := 0; i < len(w.Content); i += 2 {
+			weights[w.Content[i].Value] = w.Content[i+1]
+			order = append(order, w.Content[i].Value)
+		}
+	}
+
+	serversToV3(mapValue(b, "servers"), weights)
+	for _, server := range order {
+		if _, ok := weights[server]; ok {
+			notes = append(notes, fmt.Sprintf("backend %s: weight of %s dropped, it is not a server of the backend", name, server))
+		}
+	}
+
+	sendKey, send := mapDelete(b, "send_proxy_v2")
+	_, mismatch := mapDelete(b, "proxy_v2_family_mismatch")
+	_, peer := mapDelete(b, "proxy_v2_peer")
+	if send == nil && inherited && (mismatch != nil && mismatch.Value != "" || isTrue(peer)) {
+		// Spelled out, as version 3 sets the family handling on the middleware
+		sendKey, send = scalarNode("!!str", "send_proxy_v2"), scalarNode("!!bool", "true")
+	}
+	switch {
+	case isTrue(send):
+		settings := emptyMapping()
+		if mismatch != nil && mismatch.Value != "" {
+			settings.Style = 0
+			settings.Content = append(settings.Content, scalarNode("!!str", "family_mismatch"), mismatch)
+		}
+		if isTrue(peer) {
+			settings.Style = 0
+			settings.Content = append(settings.Content, scalarNode("!!str", "peer"), peer)
+		}
+		sendKey.Value = "proxy_v2"
+		mapSet(b, scalarNode("!!str", "middleware"), seqNode(mappingNode(sendKey, settings)))
+	case send != nil:
+		// An explicit false keeps the backend from inheriting the default
+		empty := seqNode()
+		empty.Style = yaml.FlowStyle
+		mapSet(b, scalarNode("!!str", "middleware"), empty)
+	}
+	return notes
+}
+
+// serversToV3 converts the server entries of a backend or the upstreams of
+// a service, moving the weights of the servers onto their entries.
+func serversToV3(servers *yaml.Node, weights map[string]*yaml.Node) {
+	if servers != nil {
+		servers.Style = 0 // entries read better as blocks
+	}
+	for _, s := range seqItems(servers) {
+		var addr string
+		rest := make([]*yaml.Node, 0)
+		hostKey := scalarNode("!!str", "host")
+		if s.Kind == yaml.ScalarNode {
+			addr = s.Value
+		} else if key, v := mapDelete(s, "address"); v != nil {
+			addr = v.Value
+			hostKey.HeadComment = key.HeadComment
+			rest = s.Content
+		} else {
+			rest = s.Content
+		}
+		entry := make([]*yaml.Node, 0, len(rest)+4)
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, ""
+		}
+		entry = append(entry, hostKey, scalarNode("!!str", host))
+		if port != "" {
+			if _, err := strconv.Atoi(port); err == nil {
+				entry = append(entry, scalarNode("!!str", "port"), scalarNode("!!int", port))
+			} else {
+				entry = append(entry, scalarNode("!!str", "port"), scalarNode("!!str", port))
+			}
+		}
+		entry = append(entry, rest...)
+		if w, ok := weights[addr]; ok {
+			delete(weights, addr)
+			if mapValue(&yaml.Node{Kind: yaml.MappingNode, Content: rest}, "weight") == nil {
+				entry = append(entry, scalarNode("!!str", "weight"), w)
+			}
+		}
+		*s = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: entry, HeadComment: s.HeadComment, LineComment: s.LineComment, FootComment: s.FootComment}
+	}
+}
+
+func rootMapping(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 && doc.Content[0].Kind == yaml.MappingNode {
+		return doc.Content[0]
+	}
+	return nil
+}
+
+// mapValue returns the value of key in a mapping node, nil without it.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mapString(m *yaml.Node, key string) string {
+	if v := mapValue(m, key); v != nil {
+		return v.Value
+	}
+	return ""
+}
+
+// mapDelete removes key from a mapping node and returns its key and value
+// nodes, nil without it.
+func mapDelete(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			k, v := m.Content[i], m.Content[i+1]
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return k, v
+		}
+	}
+	return nil, nil
+}
+
+// mapSet replaces the value of key in a mapping node, or appends the pair.
+func mapSet(m *yaml.Node, key, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key.Value {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, key, value)
+}
+
+func seqItems(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+func scalarNode(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+func seqNode(items ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+}
+
+func mappingNode(pairs ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: pairs}
+}
+
+// emptyMapping is written as {}.
+func emptyMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle}
+}
+
+// emptyNode reports whether n is null or an empty mapping.
+func emptyNode(n *yaml.Node) bool {
+	return n.Tag == "!!null" || (n.Kind == yaml.MappingNode && len(n.Content) == 0)
+}
+
+func isTrue(n *yaml.Node) bool {
+	if n == nil {
+		return false
+	}
+	b, err := strconv.ParseBool(n.Value)
+	return err == nil && b
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const v2Sample = `version: 2
+# Shared by every backend
+defaults:
+  send_proxy_v2: true
+listeners:
+  - name: web
+    bind: ":80"
+    tls_fingerprint: true
+    max_conn_buffer: 65536
+    rate_limit:
+      connections: 10
+      period: 1s
+    default_backend: api
+backends:
+  - name: api
+    balance: leastconn
+    proxy_v2_family_mismatch: map
+    proxy_v2_peer: true
+    servers:
+      # primary
+      - "10.0.0.1:8080"
+      - address: "10.0.0.2:8080"
+        backup: true
+      - "10.0.0.3"
+    weights:
+      "10.0.0.2:8080": 3
+  - name: plain
+    send_proxy_v2: false
+    servers: ["[::1]:9000"]
+services:
+  - name: dns
+    port: 53
+    protocol: udp
+    upstreams: ["10.0.1.1:53"]
+`
+
+const v3Sample = `version: 3
+defaults:
+  middleware: [proxy_v2]
+listeners:
+  - name: web
+    bind: ":80"
+    default_backend: api
+    middleware:
+      - rate_limit:
+          connections: 10
+          period: 1s
+      - tls_fingerprint: {}
+    tuning:
+      max_conn_buffer: 65536
+backends:
+  - name: api
+    balance: leastconn
+    servers:
+      - host: 10.0.0.1
+        port: 8080
+      - host: 10.0.0.2
+        port: 8080
+        backup: true
+        weight: 3
+      - host: 10.0.0.3
+    middleware:
+      - proxy_v2:
+          family_mismatch: map
+          peer: true
+  - name: plain
+    servers:
+      - host: "::1"
+        port: 9000
+    middleware: []
+services:
+  - name: dns
+    port: 53
+    protocol: udp
+    upstreams:
+      - host: 10.0.1.1
+        port: 53
+`
+
+func TestLoadConfig_V3(t *testing.T) {
+	dir := t.TempDir()
+	v2Path, v3Path := filepath.Join(dir, "v2.yaml"), filepath.Join(dir, "v3.yaml")
+	writeFile(t, v2Path, v2Sample)
+	writeFile(t, v3Path, v3Sample)
+
+	v2, err := LoadWithOptions(v2Path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("v2: %v", err)
+	}
+	v3, err := LoadWithOptions(v3Path, LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("v3: %v", err)
+	}
+	if v3.Version != "3" {
+		t.Errorf("version = %q, want 3", v3.Version)
+	}
+	for _, cfg := range []*Config{v2, v3} {
+		cfg.Version = ""
+		for i := range cfg.Backends {
+			cfg.Backends[i].Weights = nil
+		}
+	}
+	// The v2 weights map is a server weight in v3
+	w := 3
+	v2.Backends[0].Servers[1].Weight = &w
+	if !reflect.DeepEqual(v2, v3) {
+		t.Errorf("v3 loads differently:\n%+v\n%+v", v2, v3)
+	}
+
+	// An included file without a version follows the main file
+	writeFile(t, filepath.Join(dir, "extra.yaml"), `backends:
+  - name: extra
+    servers:
+      - host: 10.0.1.1
+        port: 80
+`)
+	writeFile(t, v3Path, v3Sample+"include: "+filepath.Join(dir, "extra.yaml")+"\n")
+	cfg, err := Load(v3Path)
+	if err != nil {
+		t.Fatalf("v3 with include: %v", err)
+	}
+	if got := cfg.Backends[2].Servers[0].Address; got != "10.0.1.1:80" {
+		t.Errorf("included server = %q", got)
+	}
+}
+
+func TestLoadConfig_V3Errors(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"flat listener key", `listeners:
+  - name: web
+    bind: ":80"
+    zero_copy: true
+`, "zero_copy belongs under tuning"},
+		{"server shorthand", `backends:
+  - name: api
+    servers: ["10.0.0.1:80"]
+`, "servers are entries with a host"},
+		{"weights map", `backends:
+  - name: api
+    servers: [{host: 10.0.0.1}]
+    weights: {"10.0.0.1": 2}
+`, "weights are set on the server entries"},
+		{"unknown middleware", `listeners:
+  - name: web
+    bind: ":80"
+    middleware: [gzip]
+`, `unknown listener middleware "gzip"`},
+		{"duplicate middleware", `listeners:
+  - name: web
+    bind: ":80"
+    middleware: [tls_fingerprint, tls_fingerprint]
+`, "listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "v3.yaml")
+			writeFile(t, path, "version: 3\n"+tt.body)
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestMigrateV3(t *testing.T) {
+	out, notes, err := MigrateV3("v2.yaml", []byte(v2Sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 0 {
+		t.Errorf("unexpected notes: %v", notes)
+	}
+	for _, want := range []string{"version: 3\n", "# Shared by every backend", "# primary", "- host: 10.0.0.2\n        port: 8080\n        backup: true\n        weight: 3", "family_mismatch: map\n          peer: true", "middleware: []", "upstreams:\n      - host: 10.0.1.1\n        port: 53"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("migrated file lacks %q:\n%s", want, out)
+		}
+	}
+
+	// The result loads like the original
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "v2.yaml"), v2Sample)
+	writeFile(t, filepath.Join(dir, "v3.yaml"), string(out))
+	v2, err := Load(filepath.Join(dir, "v2.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := LoadWithOptions(filepath.Join(dir, "v3.yaml"), LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("migrated file: %v\n%s", err, out)
+	}
+	if v3.Backends[0].Servers[1].Weight == nil || *v3.Backends[0].Servers[1].Weight != 3 || !v3.Backends[0].SendsProxyV2() || v3.Backends[1].SendsProxyV2() {
+		t.Errorf("migrated backends = %+v", v3.Backends)
+	}
+	if !reflect.DeepEqual(v2.Listeners, v3.Listeners) {
+		t.Errorf("listeners differ:\n%+v\n%+v", v2.Listeners, v3.Listeners)
+	}
+
+	if _, _, err := MigrateV3("v3.yaml", out); err == nil {
+		t.Error("expected an error migrating a version 3 file")
+	}
+}
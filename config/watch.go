@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long Watch waits for further events before reloading,
+// so an editor saving in several steps triggers a single reload.
+const watchDebounce = 200 * time.Millisecond
+
+// Watch reloads the configuration at path whenever it, one of the files it
+// includes or one of its layers changes, and passes the result to fn: the new configuration, or
+// the error that made loading it fail. cfg is the configuration currently in
+// use. The containing directories are watched rather than the files, so
+// files replaced by rename (editors, Kubernetes ConfigMaps) are picked up;
+// events that leave the contents unchanged are ignored. Watch blocks until
+// ctx is done.
+func Watch(ctx context.Context, path string, cfg *Config, opts LoadOptions, fn func(*Config, error)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	defer w.Close()
+
+	include := cfg.sources(opts)
+	if err := watchDirs(w, path, include); err != nil {
+		return err
+	}
+	last, _ := fingerprint(path, include)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			fn(nil, fmt.Errorf("config watcher: %w", err))
+		case <-debounce:
+			debounce = nil
+			// Directories may have come up below a directory include
+			watchDirs(w, path, include)
+			sum, err := fingerprint(path, include)
+			if err == nil && sum == last {
+				continue
+			}
+			last = sum
+
+			next, err := LoadWithOptions(path, opts)
+			if err != nil {
+				fn(nil, err)
+				continue
+			}
+			if sources := next.sources(opts); !slices.Equal(sources, include) {
+				include = sources
+				if err := watchDirs(w, path, include); err != nil {
+					fn(nil, err)
+				}
+				last, _ = fingerprint(path, include)
+			}
+			fn(next, nil)
+		}
+	}
+}
+
+// watchDirs adds the directories holding the config file and its includes,
+// and every directory below a directory include.
+func watchDirs(w *fsnotify.Watcher, path string, include Includes) error {
+	dirs := []string{filepath.Dir(path)}
+	files, _ := include.Files()
+	for _, f := range files {
+		dirs = append(dirs, filepath.Dir(f))
+	}
+	for _, pattern := range include {
+		if dir := filepath.Dir(pattern); !strings.ContainsAny(dir, "*?[") {
+			dirs = append(dirs, dir)
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && d.IsDir() {
+					dirs = append(dirs, p)
+				}
+				return nil
+			})
+		}
+	}
+	slices.Sort(dirs)
+	for _, dir := range slices.Compact(dirs) {
+		if err := w.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// fingerprint hashes the config file and the files matched by include.
+func fingerprint(path string, include Includes) (string, error) {
+	h := sha256.New()
+	files, err := include.Files()
+	if err != nil {
+		return "", err
+	}
+	for _, f := range append([]string{path}, files...) {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", f, len(data))
+		h.Write(data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
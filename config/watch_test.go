@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvelox.yaml")
+	include := filepath.Join(dir, "conf.d", "*.yaml")
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	writeFile(t, path, "version: '2'\ninclude: "+include+"\nbackends:\n  - name: a\n    servers: ['127.0.0.1:80']\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "b.yaml"), "backends:\n  - name: b\n    servers: ['127.0.0.1:81']\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	type result struct {
+		cfg *Config
+		err error
+	}
+	results := make(chan result, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, path, cfg, LoadOptions{}, func(c *Config, err error) {
+		results <- result{c, err}
+	})
+	time.Sleep(50 * time.Millisecond) // let the watcher register
+
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout waiting for reload")
+			return result{}
+		}
+	}
+
+	// Included file replaced by rename, as editors do
+	tmp := filepath.Join(dir, "b.tmp")
+	writeFile(t, tmp, "backends:\n  - name: b\n    servers: ['127.0.0.1:81']\n  - name: c\n    servers: ['127.0.0.1:82']\n")
+	if err := os.Rename(tmp, filepath.Join(dir, "conf.d", "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err != nil || len(r.cfg.Backends) != 3 {
+		t.Fatalf("unexpected reload result: %+v", r)
+	}
+
+	// Invalid edits are reported
+	writeFile(t, path, "version: '2'\ninclude: "+include+"\nlisteners:\n  - name: l\n    bind: ':80'\n    default_backend: missing\n")
+	if r := next(); r.err == nil {
+		t.Fatal("expected error for invalid config")
+	}
+
+	// Rewriting identical contents does not reload
+	data, _ := os.ReadFile(path)
+	writeFile(t, path, string(data))
+	select {
+	case r := <-results:
+		t.Fatalf("unexpected reload: %+v", r)
+	case <-time.After(4 * watchDebounce):
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch_IncludeDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvelox.yaml")
+	confd := filepath.Join(dir, "conf.d")
+	os.Mkdir(confd, 0755)
+	writeFile(t, path, "version: '2'\ninclude: "+confd+"\nbackends:\n  - name: a\n    servers: ['127.0.0.1:80']\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	reloads := make(chan *Config, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, path, cfg, LoadOptions{}, func(c *Config, err error) {
+		if err == nil {
+			reloads <- c
+		}
+	})
+	time.Sleep(50 * time.Millisecond) // let the watcher register
+
+	// A new subdirectory is watched before a file shows up in it
+	os.Mkdir(filepath.Join(confd, "team"), 0755)
+	time.Sleep(4 * watchDebounce)
+	writeFile(t, filepath.Join(confd, "team", "b.yaml"), "backends:\n  - name: b\n    servers: ['127.0.0.1:81']\n")
+	select {
+	case c := <-reloads:
+		if len(c.Backends) != 2 {
+			t.Errorf("expected 2 backends, got %d", len(c.Backends))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for reload")
+	}
+}
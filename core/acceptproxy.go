@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"nvelox/core/logging"
+	"nvelox/proxy"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// proxyHeaderTimeout is how long a trusted load balancer has to send the
+// PROXY header of a connection.
+const proxyHeaderTimeout = 5 * time.Second
+
+// errRateLimited refuses a connection whose client, named by its PROXY
+// header, is over the rate limit of the listener.
+var errRateLimited = errors.New("connection rate limit exceeded")
+
+// trustedProxy reports whether a connection from addr comes from one of the
+// load balancers of accept_proxy.
+func trustedProxy(from []netip.Prefix, addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || len(from) == 0 {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range from {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchProxyHeader closes a connection whose PROXY header has not arrived
+// within proxyHeaderTimeout.
+func (h *ProxyEventHandler) watchProxyHeader(lifetime context.Context, c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+	timer := h.clock().NewTimer(proxyHeaderTimeout)
+	defer timer.Stop()
+	select {
+	case <-lifetime.Done():
+		return
+	case <-timer.C():
+	}
+	ctx.mu.Lock()
+	waiting := ctx.awaitProxy
+	if waiting {
+		ctx.reason = StatusProxyError
+	}
+	ctx.mu.Unlock()
+	if waiting {
+		logging.Warn("[PROXY] no header from %s on %s within %s", c.RemoteAddr(), l.Name, proxyHeaderTimeout)
+		h.safeClose(c, ctx)
+	}
+}
+
+// readProxyHeader consumes the PROXY header a connection from a trusted
+// load balancer starts with, buffering it across reads, and returns the
+// client bytes that follow it. The client address and tags of the header
+// replace those of the connection, which then connects to its backend
+// unless its preamble is still due.
+// It returns proxy.ErrIncomplete until the header is complete, and
+// errRateLimited when the client is over the rate limit. Callers hold ctx.mu.
+func (h *ProxyEventHandler) readProxyHeader(ctx *ConnContext, l *ListenerConfig, data []byte) ([]byte, error) {
+	if ctx.proxyBuf != nil {
+		ctx.proxyBuf = append(ctx.proxyBuf, data...)
+		data = ctx.proxyBuf
+	}
+	hdr, n, err := proxy.ParseHeaderV2(data)
+	if errors.Is(err, proxy.ErrIncomplete) {
+		if ctx.proxyBuf == nil {
+			ctx.proxyBuf = append([]byte(nil), data...)
+		}
+		return nil, err
+	}
+	ctx.proxyBuf = nil
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.awaitProxy = false
+	if !hdr.Local && hdr.Source != nil {
+		ctx.Client = hdr.Source.String()
+		ctx.proxySrc, ctx.proxyDst = hdr.Source, hdr.Destination
+	}
+	ctx.Tags = proxyTags(hdr, l.ProxyTLVs)
+	if v, ok := hdr.TLV(proxy.TLVPeer); ok {
+		if peer, err := proxy.ParsePeer(v); err != nil {
+			logging.Warn("[PROXY] ignoring peer metadata for %s on %s: %v", ctx.Client, l.Name, err)
+		} else {
+			ctx.ConnID, ctx.Tenant, ctx.peerHints = peer.ConnID, peer.Tenant, peer.Hints
+		}
+	}
+	ctx.trace.event(traceInspected, "proxy client=%s local=%v", ctx.Client, hdr.Local)
+
+	// The rate limit counts the client, not the load balancer; a LOCAL
+	// connection of the balancer itself counts against the balancer
+	src := ctx.proxySrc
+	if src == nil {
+		src = ctx.from
+	}
+	if src != nil && !l.limiter.Allow(src, h.clock().Now()) {
+		return nil, errRateLimited
+	}
+	ctx.proceed()
+	return data[n:], nil
+}
+
+// proxyTags names the TLVs of a header picked by accept_proxy.tlvs. The
+// subtype byte of an AWS VPC endpoint ID is dropped; values that are not
+// printable text are kept in hex.
+func proxyTags(hdr *proxy.Header, names map[byte]string) map[string]string {
+	var tags map[string]string
+	for typ, name := range names {
+		v, ok := hdr.TLV(typ)
+		if !ok {
+			continue
+		}
+		if typ == proxy.TLVAWS && len(v) > 0 && v[0] == proxy.AWSVPCEndpointID {
+			v = v[1:]
+		}
+		if tags == nil {
+			tags = make(map[string]string, len(names))
+		}
+		if utf8.Valid(v) && !bytes.ContainsFunc(v, unicode.IsControl) {
+			tags[name] = string(v)
+		} else {
+			tags[name] = hex.EncodeToString(v)
+		}
+	}
+	return tags
+}
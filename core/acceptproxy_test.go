@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"nvelox/config"
+	"nvelox/proxy"
+)
+
+// proxyHeader returns a PROXY v2 header for src -> dst carrying tlvs.
+func proxyHeader(t *testing.T, src, dst net.Addr, tlvs ...proxy.TLV) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if src == nil {
+		err = proxy.WriteLocalHeaderV2(&buf)
+	} else {
+		err = proxy.WriteProxyHeaderV2(&buf, src, dst)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := buf.Bytes()
+	for _, tlv := range tlvs {
+		hdr = append(hdr, tlv.Type, 0, 0)
+		binary.BigEndian.PutUint16(hdr[len(hdr)-2:], uint16(len(tlv.Value)))
+		hdr = append(hdr, tlv.Value...)
+	}
+	binary.BigEndian.PutUint16(hdr[14:16], uint16(len(hdr)-16))
+	return hdr
+}
+
+func TestTrustedProxy(t *testing.T) {
+	from := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::1/128")}
+	for _, c := range []struct {
+		addr net.Addr
+		want bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}, true},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:10.1.2.3"), Port: 1}, true},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, true},
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1}, false},
+		{&net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}, false},
+	} {
+		if got := trustedProxy(from, c.addr); got != c.want {
+			t.Errorf("trustedProxy(%s) = %v, want %v", c.addr, got, c.want)
+		}
+	}
+	if trustedProxy(nil, &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}) {
+		t.Error("connection trusted without accept_proxy")
+	}
+}
+
+func TestHandler_readProxyHeader(t *testing.T) {
+	h := &ProxyEventHandler{}
+	l := &ListenerConfig{Name: "nlb", ListenerOptions: ListenerOptions{
+		ProxyTLVs: map[byte]string{proxy.TLVAWS: "vpce", proxy.TLVUniqueID: "id", proxy.TLVALPN: "alpn"},
+	}}
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}
+	hdr := proxyHeader(t, src, dst,
+		proxy.TLV{Type: proxy.TLVAWS, Value: append([]byte{proxy.AWSVPCEndpointID}, "vpce-0abc"...)},
+		proxy.TLV{Type: proxy.TLVUniqueID, Value: []byte{0x00, 0xff}},
+		proxy.TLV{Type: proxy.TLVNoop, Value: []byte("ignored")},
+	)
+
+	// Fragmented over two reads, followed by client bytes
+	connected := 0
+	ctx := &ConnContext{Client: "10.0.0.2:5000", awaitProxy: true, connect: func() { connected++ }}
+	if _, err := h.readProxyHeader(ctx, l, hdr[:10]); !errors.Is(err, proxy.ErrIncomplete) {
+		t.Fatalf("partial header: err = %v", err)
+	}
+	payload, err := h.readProxyHeader(ctx, l, append(hdr[10:], "hello"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "hello" {
+		t.Errorf("payload = %q", payload)
+	}
+	if ctx.awaitProxy || connected != 1 || ctx.Client != src.String() || ctx.proxyDst.String() != dst.String() {
+		t.Errorf("header not applied: awaitProxy=%v connected=%d client=%s dst=%v", ctx.awaitProxy, connected, ctx.Client, ctx.proxyDst)
+	}
+	want := map[string]string{"vpce": "vpce-0abc", "id": "00ff"}
+	if len(ctx.Tags) != len(want) || ctx.Tags["vpce"] != want["vpce"] || ctx.Tags["id"] != want["id"] {
+		t.Errorf("tags = %v, want %v", ctx.Tags, want)
+	}
+
+	// LOCAL keeps the addresses of the connection
+	ctx = &ConnContext{Client: "10.0.0.2:5000", awaitProxy: true}
+	if _, err := h.readProxyHeader(ctx, l, proxyHeader(t, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Client != "10.0.0.2:5000" || ctx.proxySrc != nil || ctx.Tags != nil {
+		t.Errorf("LOCAL header changed the connection: %+v", ctx)
+	}
+
+	// The rate limit counts the clients behind the balancer, each on its own
+	lb := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5000}
+	limited := &ListenerConfig{Name: "nlb", ListenerOptions: ListenerOptions{
+		limiter: newRateLimiter(config.RateLimitConfig{Connections: 1, Period: "1h"}),
+	}}
+	other := &net.TCPAddr{IP: net.ParseIP("203.0.113.8"), Port: 40000}
+	for i, tc := range []struct {
+		src  net.Addr
+		want error
+	}{{src, nil}, {other, nil}, {src, errRateLimited}, {nil, nil}, {nil, errRateLimited}} {
+		connected = 0
+		ctx = &ConnContext{Client: lb.String(), from: lb, awaitProxy: true, connect: func() { connected++ }}
+		_, err := h.readProxyHeader(ctx, limited, proxyHeader(t, tc.src, tc.src))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("connection %d: err = %v, want %v", i, err, tc.want)
+		}
+		if (connected == 1) != (tc.want == nil) {
+			t.Errorf("connection %d: connected = %d", i, connected)
+		}
+	}
+
+	// Anything else is refused
+	ctx = &ConnContext{awaitProxy: true}
+	if _, err := h.readProxyHeader(ctx, l, []byte("GET / HTTP/1.1\r\n")); !errors.Is(err, proxy.ErrInvalid) {
+		t.Errorf("plain request: err = %v", err)
+	}
+}
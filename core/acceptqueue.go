@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// AcceptQueue reports the kernel accept queue of one bind address of a
+// listener, summed over the sockets bound to it (one per event loop).
+type AcceptQueue struct {
+	Listener string // the configured listener block
+	Name     string
+	Addr     string
+	Sockets  int
+	Queued   int // connections established but not accepted yet
+	Backlog  int // queue length of each socket
+}
+
+// AcceptQueues reports the accept queues of the TCP listeners, and the
+// connections the kernel dropped before nvelox could accept them. Drops are
+// counted since boot for the whole host, as the kernel does not count them
+// per socket; a queue near its backlog shows which listener they hit.
+type AcceptQueues struct {
+	Supported bool  // false where the kernel does not report queues (linux only)
+	Overflows int64 // handshakes dropped for a full accept queue (ListenOverflows)
+	Drops     int64 // all dropped handshakes, overflows included (ListenDrops)
+	Listeners []AcceptQueue
+}
+
+// listenQueue is the accept queue of one listening socket.
+type listenQueue struct {
+	ip      net.IP
+	port    int
+	queued  int
+	backlog int
+}
+
+// AcceptQueues returns the accept queues of the TCP listeners. Sockets of a
+// group being replaced share the address of its replacement and count with
+// it.
+func (e *Engine) AcceptQueues() (AcceptQueues, error) {
+	if !listenSocketSupported {
+		return AcceptQueues{Listeners: []AcceptQueue{}}, nil
+	}
+	overflows, drops, err := listenDrops()
+	if err != nil {
+		return AcceptQueues{}, fmt.Errorf("failed to read listen drops: %w", err)
+	}
+	queues, err := listenQueues()
+	if err != nil {
+		return AcceptQueues{}, fmt.Errorf("failed to read accept queues: %w", err)
+	}
+	e.mu.RLock()
+	listeners := append([]*ListenerConfig(nil), e.Listeners...)
+	e.mu.RUnlock()
+
+	out := AcceptQueues{Supported: true, Overflows: overflows, Drops: drops, Listeners: make([]AcceptQueue, 0, len(listeners))}
+	for _, l := range listeners {
+		if l.Protocol != "tcp" || l.Port == 0 {
+			continue
+		}
+		q := AcceptQueue{Listener: l.Group, Name: l.Name, Addr: l.Addr}
+		host, port := listenMatch(l)
+		for _, s := range queues {
+			if !matchesListen(host, port, s.ip, s.port) {
+				continue
+			}
+			q.Sockets++
+			q.Queued += s.queued
+			q.Backlog = max(q.Backlog, s.backlog)
+		}
+		out.Listeners = append(out.Listeners, q)
+	}
+	return out, nil
+}
+
+// parseNetstat returns the TcpExt counters of /proc/net/netstat, which lists
+// each group as a line of names followed by a line of values.
+func parseNetstat(r io.Reader) (map[string]int64, error) {
+	sc := bufio.NewScanner(r)
+	var names []string
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] != "TcpExt:" {
+			continue
+		}
+		if names == nil {
+			names = fields[1:]
+			continue
+		}
+		if len(fields)-1 != len(names) {
+			return nil, fmt.Errorf("TcpExt has %d values for %d names", len(fields)-1, len(names))
+		}
+		out := make(map[string]int64, len(names))
+		for i, name := range names {
+			v, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("TcpExt %s: %w", name, err)
+			}
+			out[name] = v
+		}
+		return out, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no TcpExt counters")
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package core
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenQueues returns the accept queue of every listening TCP socket of
+// the process. For a listening socket TCP_INFO reports the queue in
+// tcpi_unacked and its length in tcpi_sacked.
+func listenQueues() ([]listenQueue, error) {
+	out := make([]listenQueue, 0)
+	err := eachListenSocket(func(fd int, ip net.IP, port int) error {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return nil // closed since it was listed
+		}
+		out = append(out, listenQueue{ip: ip, port: port, queued: int(info.Unacked), backlog: int(info.Sacked)})
+		return nil
+	})
+	return out, err
+}
+
+// listenDrops returns the ListenOverflows and ListenDrops counters of the
+// host.
+func listenDrops() (overflows, drops int64, err error) {
+	f, err := os.Open("/proc/net/netstat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	counters, err := parseNetstat(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return counters["ListenOverflows"], counters["ListenDrops"], nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package core
+
+func listenQueues() ([]listenQueue, error) {
+	return nil, nil
+}
+
+func listenDrops() (overflows, drops int64, err error) {
+	return 0, 0, nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestParseNetstat(t *testing.T) {
+	in := `TcpExt: SyncookiesSent ListenOverflows ListenDrops
+TcpExt: 0 12 15
+IpExt: InNoRoutes
+IpExt: 3
+`
+	got, err := parseNetstat(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["ListenOverflows"] != 12 || got["ListenDrops"] != 15 {
+		t.Errorf("counters = %v", got)
+	}
+	if _, err := parseNetstat(strings.NewReader("TcpExt: A B\nTcpExt: 1\n")); err == nil {
+		t.Error("expected an error for a short value line")
+	}
+	if _, err := parseNetstat(strings.NewReader("IpExt: A\nIpExt: 1\n")); err == nil {
+		t.Error("expected an error without TcpExt")
+	}
+}
+
+func TestSetBacklog_Queued(t *testing.T) {
+	if !listenSocketSupported {
+		t.Skip("accept queues are only reported on linux")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := setBacklog(ln, 7); err != nil {
+		t.Fatalf("setBacklog: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	for range 2 {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	// Connections the process has not accepted wait in the queue
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		queues, err := listenQueues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var q listenQueue
+		for _, s := range queues {
+			if s.port == port {
+				q = s
+			}
+		}
+		if q.backlog != 7 {
+			t.Fatalf("backlog = %d, want 7", q.backlog)
+		}
+		if q.queued == 2 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want 2", q.queued)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEngine_AcceptQueues(t *testing.T) {
+	if !listenSocketSupported {
+		t.Skip("accept queues are only reported on linux")
+	}
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().(*net.TCPAddr)
+	probe.Close()
+
+	cfg := &config.Config{Server: config.ServerConfig{Engine: config.EngineConfig{NumEventLoops: 2}}}
+	engine := NewEngine(cfg)
+	l := &ListenerConfig{Name: "web", Group: "web", Addr: addr.String(), Protocol: "tcp", Port: addr.Port,
+		ListenerOptions: ListenerOptions{Socket: config.SocketConfig{Backlog: 64}}}
+	g, err := engine.startGroup("web", []*ListenerConfig{l})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.stop()
+	engine.Listeners = []*ListenerConfig{l, {Name: "dns", Group: "dns", Addr: "127.0.0.1:53", Protocol: "udp", Port: 53}}
+
+	got, err := engine.AcceptQueues()
+	if err != nil {
+		t.Fatalf("AcceptQueues: %v", err)
+	}
+	if !got.Supported || len(got.Listeners) != 1 {
+		t.Fatalf("AcceptQueues = %+v, want the tcp listener only", got)
+	}
+	if q := got.Listeners[0]; q.Listener != "web" || q.Sockets != 2 || q.Backlog != 64 {
+		t.Errorf("queue = %+v, want 2 sockets with a backlog of 64", q)
+	}
+}
@@ -0,0 +1,75 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_Timer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewFake(start)
+	timer := f.NewTimer(10 * time.Second)
+
+	f.Advance(9 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case got := <-timer.C():
+		if !got.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("timer fired at %v, want %v", got, start.Add(10*time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if f.Since(start) != 10*time.Second {
+		t.Errorf("Since = %v, want 10s", f.Since(start))
+	}
+}
+
+func TestFake_TimerReset(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	timer := f.NewTimer(5 * time.Second)
+
+	f.Advance(4 * time.Second)
+	timer.Reset(5 * time.Second)
+	f.Advance(4 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("reset timer fired early")
+	default:
+	}
+
+	if timer.Stop() != true {
+		t.Error("Stop on active timer should return true")
+	}
+	f.Advance(time.Minute)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("expected no waiters, got %d", f.Waiters())
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	ticker := f.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 0; i < 3; i++ {
+		f.Advance(time.Second)
+		select {
+		case <-ticker.C():
+		default:
+			t.Fatalf("tick %d missing", i)
+		}
+	}
+}
@@ -79,3 +79,19 @@ func TestGetListenerConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestGetListenerConfig_EphemeralPort(t *testing.T) {
+	handler := &ProxyEventHandler{
+		listenerMap: map[string]*ListenerConfig{
+			"tcp:0": {Name: "ephemeral", Protocol: "tcp"},
+		},
+	}
+	conn := &MockConn{localAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 41234}}
+	if got := handler.getListenerConfig(conn); got == nil || got.Name != "ephemeral" {
+		t.Errorf("getListenerConfig() = %v, want ephemeral", got)
+	}
+	conn = &MockConn{localAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 41234}}
+	if got := handler.getListenerConfig(conn); got != nil {
+		t.Errorf("getListenerConfig() = %v, want nil for udp", got.Name)
+	}
+}
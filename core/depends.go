@@ -0,0 +1,54 @@
+package core
+
+import "fmt"
+
+// healthyServers counts the enabled servers of a backend not reported down
+// by its health checker. Without active checks every server counts as healthy.
+func (e *Engine) healthyServers(name string) int {
+	be, ok := e.backend(name)
+	if !ok {
+		return 0
+	}
+	status := e.HealthStatus(name)
+	n := 0
+	for _, s := range be.Servers {
+		if s.Disabled {
+			continue
+		}
+		if healthy, probed := status[s.Address]; healthy || !probed {
+			n++
+		}
+	}
+	return n
+}
+
+// DependencyDown describes the first unmet dependency of a backend, following
+// dependencies transitively, or returns "" when the backend may serve traffic.
+func (e *Engine) DependencyDown(name string) string {
+	return e.dependencyDown(name, make(map[string]bool))
+}
+
+func (e *Engine) dependencyDown(name string, seen map[string]bool) string {
+	if seen[name] {
+		return ""
+	}
+	seen[name] = true
+
+	be, ok := e.backend(name)
+	if !ok {
+		return ""
+	}
+	for _, d := range be.DependsOn {
+		min := d.MinHealthy
+		if min == 0 {
+			min = 1
+		}
+		if n := e.healthyServers(d.Backend); n < min {
+			return fmt.Sprintf("%s has %d healthy servers, needs %d", d.Backend, n, min)
+		}
+		if reason := e.dependencyDown(d.Backend, seen); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
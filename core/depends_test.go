@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+	"nvelox/core/health"
+)
+
+func TestEngine_DependencyDown(t *testing.T) {
+	cfg := &config.Config{
+		Backends: []config.Backend{
+			{Name: "app", Servers: []config.Server{{Address: "10.0.0.1:80"}}, DependsOn: []config.BackendDependency{{Backend: "db"}}},
+			{Name: "db", Servers: []config.Server{{Address: "10.0.1.1:5432"}, {Address: "10.0.1.2:5432"}}, DependsOn: []config.BackendDependency{{Backend: "redis", MinHealthy: 1}}},
+			{Name: "redis", Servers: []config.Server{{Address: "127.0.0.1:1"}}, HealthCheck: config.HealthCheckConfig{
+				Active: config.ActiveHealthCheck{Type: "tcp", Interval: "1s", Timeout: "100ms"},
+			}},
+		},
+	}
+	e := NewEngine(cfg)
+	for i := range cfg.Backends {
+		e.Backends[cfg.Backends[i].Name] = &cfg.Backends[i]
+	}
+
+	if reason := e.DependencyDown("app"); reason != "" {
+		t.Errorf("expected app available without health data, got %q", reason)
+	}
+
+	// Redis down makes db and, transitively, app unavailable
+	fake := clock.NewFake(time.Now())
+	redis := health.NewChecker(cfg.Backends[2].HealthCheck, &cfg.Backends[2])
+	redis.Clock = fake
+	e.Checkers["redis"] = redis
+	redis.Start()
+	defer redis.Stop()
+	waitFor(t, func() bool { return fake.Waiters() > 0 })
+	fake.Advance(time.Second)
+	waitFor(t, func() bool { _, probed := redis.Status()["127.0.0.1:1"]; return probed })
+
+	if reason := e.DependencyDown("db"); reason == "" {
+		t.Error("expected db down while redis has no healthy servers")
+	}
+	if reason := e.DependencyDown("app"); reason == "" {
+		t.Error("expected app down through db")
+	}
+	if reason := e.DependencyDown("redis"); reason != "" {
+		t.Errorf("redis has no dependencies, got %q", reason)
+	}
+}
+
+func TestEngine_HealthChecked(t *testing.T) {
+	be := config.Backend{Name: "db", Servers: []config.Server{{Address: "127.0.0.1:1"}}, HealthCheck: config.HealthCheckConfig{
+		Active: config.ActiveHealthCheck{Type: "tcp", Interval: "1h", Timeout: "100ms"},
+	}}
+	e := NewEngine(&config.Config{})
+	if err := e.HealthChecked(context.Background()); err != nil {
+		t.Fatalf("HealthChecked without checks = %v", err)
+	}
+
+	fake := clock.NewFake(time.Now())
+	checker := health.NewChecker(be.HealthCheck, &be)
+	checker.Clock = fake
+	e.Checkers["db"] = checker
+	checker.Start()
+	defer checker.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := e.HealthChecked(ctx); err == nil {
+		t.Fatal("HealthChecked returned before the first probe")
+	}
+
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(time.Hour)
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := e.HealthChecked(ctx); err != nil {
+		t.Errorf("HealthChecked after the first probe = %v", err)
+	}
+}
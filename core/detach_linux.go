@@ -0,0 +1,107 @@
+//go:build linux
+
+package core
+
+import (
+	"net"
+	"syscall"
+
+	"nvelox/core/logging"
+
+	"golang.org/x/sys/unix"
+)
+
+// boundSocket is a socket an event loop takes traffic on, by descriptor and
+// inode: the descriptor alone may name another socket once it is closed.
+type boundSocket struct {
+	fd  int
+	ino uint64
+	udp bool
+}
+
+// boundSockets returns the sockets bound to the addresses of listeners,
+// leaving out those of skip (Go listeners, which are closed the usual way).
+func boundSockets(listeners []*ListenerConfig, skip []net.Listener) []boundSocket {
+	skipped := make(map[uint64]bool, len(skip))
+	for _, ln := range skip {
+		if sc, ok := ln.(syscall.Conn); ok {
+			if raw, err := sc.SyscallConn(); err == nil {
+				raw.Control(func(fd uintptr) {
+					var st unix.Stat_t
+					if unix.Fstat(int(fd), &st) == nil {
+						skipped[st.Ino] = true
+					}
+				})
+			}
+		}
+	}
+
+	var sockets []boundSocket
+	eachBoundSocket(func(fd, sotype int, ip net.IP, port int) error {
+		udp := sotype == unix.SOCK_DGRAM
+		for _, l := range listeners {
+			host, lport := listenMatch(l)
+			if (l.Protocol == "udp") != udp || !matchesListen(host, lport, ip, port) {
+				continue
+			}
+			var st unix.Stat_t
+			if unix.Fstat(fd, &st) == nil && !skipped[st.Ino] {
+				sockets = append(sockets, boundSocket{fd: fd, ino: st.Ino, udp: udp})
+			}
+			break
+		}
+		return nil
+	})
+	return sockets
+}
+
+// detachSockets closes sockets from under the event loops polling them.
+// Closing the descriptor would let the loops read or accept on whatever
+// socket reuses it next, so each one is replaced (dup3) by an unnamed local
+// socket that never has anything to read: the loops keep running, and close
+// it when they stop. It returns how many sockets were closed.
+func detachSockets(sockets []boundSocket) int {
+	n := 0
+	for _, s := range sockets {
+		var st unix.Stat_t
+		if unix.Fstat(s.fd, &st) != nil || st.Ino != s.ino {
+			continue // already gone
+		}
+		idle, err := idleSocket(s.udp)
+		if err != nil {
+			logging.Warn("[RELOAD] closing listening socket %d: %v", s.fd, err)
+			continue
+		}
+		err = unix.Dup3(idle, s.fd, unix.O_CLOEXEC)
+		unix.Close(idle)
+		if err != nil {
+			logging.Warn("[RELOAD] closing listening socket %d: %v", s.fd, err)
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// idleSocket opens a nonblocking local socket on which an accept or read
+// fails with EAGAIN, which the event loops ignore. The stream socket listens
+// on an autobound abstract address, as accept on a socket that does not
+// listen is an error that stops the loop.
+func idleSocket(udp bool) (int, error) {
+	if udp {
+		return unix.Socket(unix.AF_UNIX, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	}
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrUnix{}); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	if err := unix.Listen(fd, 1); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
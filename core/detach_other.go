@@ -0,0 +1,18 @@
+//go:build !linux
+
+package core
+
+import "net"
+
+// boundSocket is a socket an event loop takes traffic on.
+type boundSocket struct{}
+
+// boundSockets finds no sockets: without /proc the sockets of the event
+// loops cannot be told apart, and a removed group keeps them until it stops.
+func boundSockets(listeners []*ListenerConfig, skip []net.Listener) []boundSocket {
+	return nil
+}
+
+func detachSockets(sockets []boundSocket) int {
+	return 0
+}
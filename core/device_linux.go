@@ -0,0 +1,25 @@
+//go:build linux
+
+package core
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const bindToDeviceSupported = true
+
+// bindToDevice restricts a socket to the interface iface, if set.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	if iface == "" {
+		return nil
+	}
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.BindToDevice(int(fd), iface)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+const bindToDeviceSupported = false
+
+func bindToDevice(c syscall.RawConn, iface string) error {
+	if iface == "" {
+		return nil
+	}
+	return errors.New("interface is only supported on linux")
+}
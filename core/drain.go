@@ -0,0 +1,279 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"nvelox/core/logging"
+)
+
+var ErrUnknownDrain = errors.New("unknown drain")
+
+// Kinds of ActiveDrain.
+const (
+	DrainBackend = "backend" // connections a swap left on the previous backend
+	DrainServer  = "server"  // connections to a server set to weight 0
+)
+
+// drainPoll is how often WaitDrained re-counts open connections.
+const drainPoll = 100 * time.Millisecond
+
+// Drain puts the engine into draining mode: readiness fails and new TCP
+// connections and UDP sessions are refused, while existing ones continue.
+// Draining cannot be undone; it precedes shutdown.
+func (e *Engine) Drain() {
+	if !e.draining.Swap(true) {
+		logging.Warn("[DRAIN] draining started, refusing new connections")
+	}
+}
+
+// Draining reports whether Drain was called.
+func (e *Engine) Draining() bool {
+	return e.draining.Load()
+}
+
+// drainOnShutdown refuses new connections and waits up to
+// server.drain_timeout for open ones to finish; Stop closes the rest. After
+// HandOff new connections are still served while waiting.
+func (e *Engine) drainOnShutdown() {
+	timeout := e.CurrentConfig().Server.DrainWait()
+	if timeout == 0 || e.ActiveConnections() == 0 {
+		return
+	}
+	if e.handingOff.Load() {
+		logging.Info("[UPGRADE] waiting up to %v for %d open connections", timeout, e.ActiveConnections())
+	} else {
+		e.Drain()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if n := e.WaitDrained(ctx); n > 0 {
+		logging.Warn("[DRAIN] closing %d connections still open after %v", n, timeout)
+	} else {
+		logging.Info("[DRAIN] all connections finished")
+	}
+}
+
+// ActiveConnections returns the open TCP connections and UDP sessions.
+func (e *Engine) ActiveConnections() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	n := 0
+	for _, g := range e.groups {
+		n += g.handler.connCount()
+	}
+	for g := range e.retiring {
+		n += g.handler.connCount()
+	}
+	return n
+}
+
+// WaitDrained blocks until no connections remain or ctx is done, and returns
+// the number still open.
+func (e *Engine) WaitDrained(ctx context.Context) int {
+	ticker := e.Clock.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		n := e.ActiveConnections()
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return n
+		case <-ticker.C():
+		}
+	}
+}
+
+// ActiveDrain reports connections being moved off a backend or server.
+type ActiveDrain struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Listener  string    `json:"listener,omitempty"` // backend drains
+	Backend   string    `json:"backend"`
+	Server    string    `json:"server,omitempty"` // server drains
+	Remaining int       `json:"remaining"`        // open TCP connections
+	Started   time.Time `json:"started"`
+	Deadline  time.Time `json:"deadline"` // remaining connections are closed then; zero lets them finish
+}
+
+// drain tracks one ActiveDrain until its connections are gone.
+type drain struct {
+	ActiveDrain
+	count  func() int
+	close  func() int
+	weight int           // weight of a drained server before it was set to 0
+	done   chan struct{} // closed when the drain ends
+}
+
+func (d *drain) String() string {
+	if d.Kind == DrainServer {
+		return fmt.Sprintf("server %s/%s", d.Backend, d.Server)
+	}
+	return fmt.Sprintf("listener %s on backend %s", d.Listener, d.Backend)
+}
+
+// drainBackend tracks the connections of a group a swap left on backend,
+// closing them once timeout elapses (0 lets them finish).
+func (e *Engine) drainBackend(h *ProxyEventHandler, group, backend string, timeout time.Duration) {
+	e.startDrain(&drain{
+		ActiveDrain: ActiveDrain{Kind: DrainBackend, Listener: group, Backend: backend},
+		count:       func() int { return h.countRouted(group, backend) },
+		close:       func() int { return h.closeRouted(group, backend) },
+	}, timeout)
+}
+
+// drainServer tracks the connections to a server set to weight 0 from
+// weight, on every listener.
+func (e *Engine) drainServer(backend, server string, weight int) {
+	addrs := e.pinned(backend, server)
+	match := func(ctx *ConnContext) bool {
+		return ctx.backendName == backend && slices.Contains(addrs, ctx.server)
+	}
+	e.startDrain(&drain{
+		ActiveDrain: ActiveDrain{Kind: DrainServer, Backend: backend, Server: server},
+		count: func() int {
+			n := 0
+			for _, h := range e.handlers() {
+				n += h.countConns(match)
+			}
+			return n
+		},
+		close: func() int {
+			n := 0
+			for _, h := range e.handlers() {
+				n += h.closeConns(match)
+			}
+			return n
+		},
+		weight: weight,
+	}, 0)
+}
+
+// startDrain registers d and watches it in the background until no
+// connections remain, timeout elapses or it is accelerated or canceled.
+func (e *Engine) startDrain(d *drain, timeout time.Duration) {
+	d.Started = e.Clock.Now()
+	if timeout > 0 {
+		d.Deadline = d.Started.Add(timeout)
+	}
+	d.done = make(chan struct{})
+	e.mu.Lock()
+	e.drainSeq++
+	d.ID = e.drainSeq
+	e.drains[d.ID] = d
+	e.mu.Unlock()
+
+	go func() {
+		defer e.endDrain(d.ID)
+		ticker := e.Clock.NewTicker(drainPoll)
+		defer ticker.Stop()
+		var deadline <-chan time.Time
+		if timeout > 0 {
+			timer := e.Clock.NewTimer(timeout)
+			defer timer.Stop()
+			deadline = timer.C()
+		}
+		for d.count() > 0 {
+			select {
+			case <-ticker.C():
+			case <-deadline:
+				if n := d.close(); n > 0 {
+					logging.Info("[DRAIN] closed %d connections of %s at the deadline", n, d)
+				}
+				return
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// endDrain unregisters a drain and returns it, or nil when it already ended.
+func (e *Engine) endDrain(id int) *drain {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	d, ok := e.drains[id]
+	if !ok {
+		return nil
+	}
+	delete(e.drains, id)
+	close(d.done)
+	return d
+}
+
+// Drains returns the drains in progress, oldest first.
+func (e *Engine) Drains() []ActiveDrain {
+	e.mu.RLock()
+	drains := make([]*drain, 0, len(e.drains))
+	for _, d := range e.drains {
+		drains = append(drains, d)
+	}
+	e.mu.RUnlock()
+	slices.SortFunc(drains, func(a, b *drain) int { return a.ID - b.ID })
+
+	out := make([]ActiveDrain, len(drains))
+	for i, d := range drains {
+		out[i] = d.ActiveDrain
+		out[i].Remaining = d.count()
+	}
+	return out
+}
+
+// AccelerateDrain closes the remaining connections of a drain now and
+// returns how many were closed.
+func (e *Engine) AccelerateDrain(id int) (int, error) {
+	d := e.endDrain(id)
+	if d == nil {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownDrain, id)
+	}
+	n := d.close()
+	logging.Info("[DRAIN] closed %d connections of %s", n, d)
+	return n, nil
+}
+
+// CancelDrain stops a drain. The connections of a backend drain are left
+// to finish on their own; a drained server gets its previous weight back.
+func (e *Engine) CancelDrain(id int) error {
+	e.mu.RLock()
+	d, ok := e.drains[id]
+	e.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownDrain, id)
+	}
+	if d.Kind == DrainServer {
+		return e.SetWeight(d.Backend, d.Server, d.weight, false) // ends the drain
+	}
+	if e.endDrain(id) != nil {
+		logging.Info("[DRAIN] canceled the drain of %s", d)
+	}
+	return nil
+}
+
+// serverDrainLocked returns the drain of a server, if any. Callers hold e.mu.
+func (e *Engine) serverDrainLocked(backend, server string) *drain {
+	for _, d := range e.drains {
+		if d.Kind == DrainServer && d.Backend == backend && d.Server == server {
+			return d
+		}
+	}
+	return nil
+}
+
+// handlers returns the handlers of the running and retiring listener groups.
+func (e *Engine) handlers() []*ProxyEventHandler {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make([]*ProxyEventHandler, 0, len(e.groups)+len(e.retiring))
+	for _, g := range e.groups {
+		out = append(out, g.handler)
+	}
+	for g := range e.retiring {
+		out = append(out, g.handler)
+	}
+	return out
+}
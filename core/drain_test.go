@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+	"nvelox/lb"
+)
+
+func TestEngine_Drain(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	port := freePort(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	cfg := &config.Config{
+		Version:   "2",
+		Backends:  []config.Backend{{Name: "be", Servers: []config.Server{{Address: backend.Addr().String()}}}},
+		Listeners: []config.Listener{{Name: "l", Bind: config.Binds{addr}, Protocol: "tcp", DefaultBackend: "be"}},
+	}
+	engine := startTestEngine(t, cfg)
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	waitFor(t, func() bool { return engine.ActiveConnections() == 1 })
+
+	engine.Drain()
+	if !engine.Draining() {
+		t.Fatal("expected engine to be draining")
+	}
+
+	// New connections are refused while draining
+	refused, err := net.Dial("tcp", addr)
+	if err == nil {
+		refused.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := refused.Read(make([]byte, 1)); err == nil {
+			t.Error("expected new connection to be closed while draining")
+		}
+		refused.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if n := engine.WaitDrained(ctx); n != 1 {
+		t.Errorf("WaitDrained = %d, want 1 connection remaining", n)
+	}
+
+	client.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if n := engine.WaitDrained(ctx); n != 0 {
+		t.Errorf("WaitDrained = %d after client left, want 0", n)
+	}
+}
+
+func TestEngine_DrainOnShutdown(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(c, c)
+		}
+	}()
+
+	for _, c := range []struct {
+		timeout string
+		drained bool // the open connection keeps working after the shutdown signal
+	}{
+		{"", true},
+		{"0", false},
+	} {
+		addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+		cfg := &config.Config{
+			Version:   "2",
+			Server:    config.ServerConfig{DrainTimeout: c.timeout},
+			Backends:  []config.Backend{{Name: "be", Servers: []config.Server{{Address: backend.Addr().String()}}}},
+			Listeners: []config.Listener{{Name: "l", Bind: config.Binds{addr}, Protocol: "tcp", DefaultBackend: "be"}},
+		}
+		engine := NewEngine(cfg)
+		engine.Listeners, _ = ExpandListener(cfg.Listeners[0])
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			engine.Start(ctx)
+			close(done)
+		}()
+
+		var client net.Conn
+		waitFor(t, func() bool {
+			client, err = net.Dial("tcp", addr)
+			return err == nil
+		})
+		waitFor(t, func() bool { return engine.ActiveConnections() == 1 })
+
+		cancel()
+		time.Sleep(200 * time.Millisecond)
+		client.SetDeadline(time.Now().Add(time.Second))
+		client.Write([]byte("ping"))
+		_, err := io.ReadFull(client, make([]byte, 4))
+		if c.drained && (err != nil || !engine.Draining()) {
+			t.Errorf("drain_timeout %q: connection broken while draining: %v", c.timeout, err)
+		}
+		if !c.drained && err == nil {
+			t.Errorf("drain_timeout %q: connection still open after shutdown", c.timeout)
+		}
+		client.Close()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEngine_Drains(t *testing.T) {
+	e := newSwapEngine()
+	clk := clock.NewFake(time.Now())
+	e.Clock = clk
+	e.Balancers["blue"] = lb.NewPool("roundrobin", []lb.Server{{Address: "10.0.0.1:80", Weight: lb.DefaultWeight}})
+	h := &ProxyEventHandler{}
+	e.groups["prod"] = &listenerGroup{name: "prod", handler: h}
+	client, server := net.Pipe()
+	defer server.Close()
+	h.conns.Store(&ConnContext{group: "prod", backendName: "blue", server: "10.0.0.1:80", BackendConn: client}, struct{}{})
+
+	if _, err := e.SwapBackend("prod", "green", time.Minute); err != nil {
+		t.Fatalf("SwapBackend failed: %v", err)
+	}
+	if err := e.SetWeight("blue", "10.0.0.1:80", 0, false); err != nil {
+		t.Fatalf("SetWeight failed: %v", err)
+	}
+	drains := e.Drains()
+	if len(drains) != 2 {
+		t.Fatalf("expected 2 drains, got %+v", drains)
+	}
+	if d := drains[0]; d.Kind != DrainBackend || d.Listener != "prod" || d.Backend != "blue" || d.Remaining != 1 || !d.Deadline.Equal(d.Started.Add(time.Minute)) {
+		t.Errorf("unexpected backend drain: %+v", d)
+	}
+	if d := drains[1]; d.Kind != DrainServer || d.Server != "10.0.0.1:80" || d.Remaining != 1 || !d.Deadline.IsZero() {
+		t.Errorf("unexpected server drain: %+v", d)
+	}
+
+	// Canceling the server drain restores its weight
+	if err := e.CancelDrain(drains[1].ID); err != nil {
+		t.Fatalf("CancelDrain failed: %v", err)
+	}
+	if w := e.ServerWeight("blue", "10.0.0.1:80"); w != lb.DefaultWeight {
+		t.Errorf("weight = %d after cancel, want %d", w, lb.DefaultWeight)
+	}
+
+	if n, err := e.AccelerateDrain(drains[0].ID); err != nil || n != 1 {
+		t.Errorf("AccelerateDrain = %d, %v, want 1 connection closed", n, err)
+	}
+	if d := e.Drains(); len(d) != 0 {
+		t.Errorf("expected no drains left, got %+v", d)
+	}
+	if _, err := e.AccelerateDrain(drains[0].ID); !errors.Is(err, ErrUnknownDrain) {
+		t.Errorf("expected ErrUnknownDrain, got %v", err)
+	}
+}
+
+func TestEngine_DrainDeadline(t *testing.T) {
+	e := newSwapEngine()
+	clk := clock.NewFake(time.Now())
+	e.Clock = clk
+	h := &ProxyEventHandler{}
+	e.groups["prod"] = &listenerGroup{name: "prod", handler: h}
+	client, server := net.Pipe()
+	defer server.Close()
+	ctx := &ConnContext{group: "prod", backendName: "blue", BackendConn: client}
+	h.conns.Store(ctx, struct{}{})
+
+	e.SwapBackend("prod", "green", time.Minute)
+	waitFor(t, func() bool { return clk.Waiters() == 2 })
+	clk.Advance(time.Minute)
+	waitFor(t, func() bool { return len(e.Drains()) == 0 })
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.reason != StatusDrained {
+		t.Errorf("reason = %q, want %q", ctx.reason, StatusDrained)
+	}
+}
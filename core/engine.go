@@ -3,16 +3,34 @@ package core
 import (
 	"context"
 	"fmt"
-	"log"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"nvelox/config"
+	"nvelox/core/clock"
 	"nvelox/core/health"
 	"nvelox/core/logging"
+	"nvelox/core/resolver"
+	"nvelox/core/retry"
+	"nvelox/core/state"
 	"nvelox/lb"
 
 	"github.com/panjf2000/gnet/v2"
 )
 
+const (
+	// groupStopTimeout bounds how long stopping a listener group may take.
+	groupStopTimeout = 5 * time.Second
+	// groupRetireTimeout bounds how long a replaced listener group keeps
+	// serving its open connections after Apply.
+	groupRetireTimeout = 5 * time.Minute
+)
+
 type Engine struct {
 	gnet.BuiltinEventEngine
 	Listeners []*ListenerConfig
@@ -20,15 +38,64 @@ type Engine struct {
 	Balancers map[string]lb.Balancer
 	Backends  map[string]*config.Backend
 	Checkers  map[string]*health.Checker
+	Retries   map[string]*retry.Policy
+	Hosts     *resolver.Hosts
+	Clock     clock.Clock
+	Shedder   *Shedder         // nil when load shedding is disabled
+	Sessions  *SessionNotifier // nil when session_events is unset
+	Store     state.Store      // nil without a state section, admin files are used then
+
+	// Listening runs once every listener group is bound, before Start blocks;
+	// an error stops the engine. Used to drop root privileges.
+	Listening func() error
+
+	// Inherited holds the listening sockets passed by the process this one
+	// replaces, by "tcp://host:port" address; Start serves listener groups on
+	// them instead of binding. See ListenerFiles.
+	Inherited map[string]*os.File
+
+	// mu guards the maps above, Config, Listeners and groups once the engine runs.
+	mu       sync.RWMutex
+	applyMu  sync.Mutex
+	groups   map[string]*listenerGroup
+	retiring map[*listenerGroup]struct{} // replaced groups waiting for their connections
+
+	draining   atomic.Bool
+	handingOff atomic.Bool
+	drains     map[int]*drain // backend and server drains in progress, by ID
+	drainSeq   int
+
+	// nextSource takes the source addresses of backends in turn
+	nextSource atomic.Uint64
+
+	// Runtime server weights (backend -> server -> weight), and the subset persisted
+	weights          map[string]map[string]int
+	persistedWeights map[string]map[string]int
+
+	// Administrative server states set at runtime (backend -> server -> state)
+	states map[string]map[string]string
+
+	cache resolveCache // last resolved addresses of hostname servers
+
+	freezeMu sync.Mutex
+	freeze   freeze // refuses changes while frozen, see SetFrozen
+
+	counters *counters
+	node     string // this instance among those sharing Store
+
+	// Pinned addresses of hostname servers (backend -> server -> addresses)
+	resolved map[string]map[string][]string
 }
 
-type ListenerConfig struct {
-	Name           string
-	Addr           string
-	Protocol       string
-	ZeroCopy       bool
-	DefaultBackend string
-	Port           int
+// listenerGroup is the event loop serving all listeners expanded from one
+// configured listener block, so blocks can be started and stopped independently.
+type listenerGroup struct {
+	name      string
+	listeners []*ListenerConfig
+	handler   *ProxyEventHandler
+	done      chan error
+	parked    *parker  // set instead of an event loop for park_idle blocks
+	adopted   *adopter // set instead of binding when the sockets were inherited
 }
 
 func NewEngine(cfg *config.Config) *Engine {
@@ -38,46 +105,146 @@ func NewEngine(cfg *config.Config) *Engine {
 		Balancers: make(map[string]lb.Balancer),
 		Backends:  make(map[string]*config.Backend),
 		Checkers:  make(map[string]*health.Checker),
+		Retries:   make(map[string]*retry.Policy),
+		Hosts:     resolver.NewHosts(cfg.Hosts),
+		Clock:     clock.Real(),
+		groups:    make(map[string]*listenerGroup),
+		retiring:  make(map[*listenerGroup]struct{}),
+		drains:    make(map[int]*drain),
+
+		weights:          make(map[string]map[string]int),
+		persistedWeights: make(map[string]map[string]int),
+		states:           make(map[string]map[string]string),
+		resolved:         make(map[string]map[string][]string),
+		counters:         newCounters(time.Now()),
+	}
+	if cfg.Shedding.Enabled() {
+		e.Shedder = NewShedder(cfg.Shedding)
+	}
+	if cfg.SessionEvents.Enabled() {
+		e.Sessions = NewSessionNotifier(cfg.SessionEvents)
+	}
+	if cfg.State.Enabled() {
+		store, err := state.New(cfg.State)
+		if err != nil {
+			logging.Error("[STATE] %v, runtime state is not persisted", err)
+			store = state.NewMemory()
+		}
+		e.Store = store
+		e.node = state.Node(cfg.State)
 	}
+	// Validated with the configuration
+	allow, _ := cfg.Egress.Prefixes()
+	e.Hosts.Egress = resolver.NewEgress(allow)
 	return e
 }
 
+// Start initializes backends, starts all listener groups and blocks until ctx
+// is done, at which point everything is stopped again.
 func (e *Engine) Start(ctx context.Context) error {
 	// Initialize Backends & Health Checkers
+	e.mu.Lock()
+	e.loadWeights()
+	e.loadServerStates()
+	e.loadStats()
+	e.loadResolved()
 	for i := range e.Config.Backends {
-		be := &e.Config.Backends[i]
-
-		// Create Balancer
-		balancer := lb.NewBalancer(be.Balance, be.Servers)
-		e.Balancers[be.Name] = balancer
-		e.Backends[be.Name] = be // Populate map for fast access
-		logging.Info("Initialized backend %s with %s balancing", be.Name, be.Balance)
-
-		// Create & Start Health Checker
-		if be.HealthCheck.Active.Interval != "" {
-			// Ensure a balancer exists for this backend
-			balancer, ok := e.Balancers[be.Name]
-			if !ok {
-				log.Printf("Warning: No balancer found for backend %s, health checks will not update balancer status.", be.Name)
-				continue
-			}
+		rt, err := e.newBackendRuntime(&e.Config.Backends[i])
+		if err != nil {
+			e.mu.Unlock()
+			return err
+		}
+		rt.install(e)
+		if rt.checker != nil {
+			rt.checker.Start()
+		}
+	}
+	listeners := e.Listeners
+	e.mu.Unlock()
 
-			checker := health.NewChecker(be.HealthCheck, be) // Pass the backend config directly
-			checker.OnStatusChange = func(server string, healthy bool) {
-				log.Printf("Health status change for backend %s, server %s: healthy=%t", be.Name, server, healthy)
-				balancer.UpdateStatus(server, healthy)
-			}
-			e.Checkers[be.Name] = checker
-			checker.Start()
+	if e.Shedder != nil {
+		e.Shedder.Clock = e.Clock
+		e.Shedder.Start()
+	}
+	if e.Sessions != nil {
+		e.Sessions.Clock = e.Clock
+		e.Sessions.Start()
+	}
+
+	// Start one event loop per listener block
+	for _, name := range groupNames(listeners) {
+		g, err := e.startGroup(name, groupListeners(listeners, name))
+		if err != nil {
+			e.Stop()
+			return err
+		}
+		e.mu.Lock()
+		e.groups[name] = g
+		e.mu.Unlock()
+	}
+	if err := e.serveTunnel(ctx); err != nil {
+		e.Stop()
+		return fmt.Errorf("tunnel: %w", err)
+	}
+	e.closeInherited()
+	if e.Listening != nil {
+		if err := e.Listening(); err != nil {
+			e.Stop()
+			return err
 		}
 	}
 
-	// Shared Event Loop Implementation
-	// 1. Collect all addresses
-	addrs := make([]string, 0, len(e.Listeners))
+	go e.persistStats(ctx)
+	go e.rebalanceLoop(ctx)
+	go e.resolveLoop(ctx)
+
+	<-ctx.Done()
+	e.drainOnShutdown()
+	e.Stop()
+	return ctx.Err()
+}
+
+// Stop shuts down all listener groups and health checkers.
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	groups := e.groups
+	e.groups = make(map[string]*listenerGroup)
+	retiring := e.retiring
+	e.retiring = make(map[*listenerGroup]struct{})
+	checkers := e.Checkers
+	e.Checkers = make(map[string]*health.Checker)
+	e.mu.Unlock()
+
+	for _, g := range groups {
+		g.stop()
+	}
+	for g := range retiring {
+		g.stop()
+	}
+	for _, c := range checkers {
+		c.Stop()
+	}
+	if e.Shedder != nil {
+		e.Shedder.Stop()
+	}
+	if e.Sessions != nil {
+		e.Sessions.Stop()
+	}
+	if err := e.writeStats(); err != nil {
+		logging.Warn("[STATS] %v", err)
+	}
+	if e.Store != nil {
+		e.Store.Close()
+	}
+}
+
+// startGroup binds the given listeners in a new event loop and waits until it
+// has booted or failed.
+func (e *Engine) startGroup(name string, listeners []*ListenerConfig) (*listenerGroup, error) {
+	addrs := make([]string, 0, len(listeners))
 	listenerMap := make(map[string]*ListenerConfig) // Addr -> Config
 
-	for _, l := range e.Listeners {
+	for _, l := range listeners {
 		p := "tcp"
 		if l.Protocol == "udp" {
 			p = "udp"
@@ -91,25 +258,561 @@ func (e *Engine) Start(ctx context.Context) error {
 		// and to handle different bind IPs (0.0.0.0 vs 127.0.0.1) resolving to the same port.
 		key := fmt.Sprintf("%s:%d", l.Protocol, l.Port)
 		listenerMap[key] = l
-		logging.Info("Registering listener %s on %s (Key: %s)", l.Name, fullAddr, key)
+		logging.Info("Registering listener %s on %s (Key: %s, Priority: %s)", l.Name, fullAddr, key, l.Priority)
 	}
 
-	handler := &ProxyEventHandler{
-		engine:      e,
-		listenerMap: listenerMap,
+	if len(listeners) > 0 && listeners[0].Interface != "" && !bindToDeviceSupported {
+		return nil, fmt.Errorf("listener %s: interface is only supported on linux", name)
+	}
+	if len(listeners) > 0 && listeners[0].limiter != nil && listeners[0].limiter.shared {
+		if counter, ok := e.Store.(state.Counter); ok {
+			listeners[0].limiter.share(name, counter)
+		} else {
+			logging.Warn("[RATELIMIT] listener %s: no shared state store, limiting per instance", name)
+		}
+	}
+	tune := slices.ContainsFunc(listeners, tunesListening)
+	for _, l := range listeners {
+		// Tuning only, the listener serves without them
+		if l.Socket.Listening() && !listenSocketSupported {
+			logging.Warn("[SOCKET] listener %s: defer_accept, fastopen and backlog are only supported on linux, ignoring them", name)
+		}
 	}
 
-	logging.Info("Starting Shared Event Loop on %d listeners...", len(addrs))
+	g := &listenerGroup{
+		name:      name,
+		listeners: listeners,
+		handler: &ProxyEventHandler{
+			engine:      e,
+			group:       name,
+			listenerMap: listenerMap,
+			booted:      make(chan struct{}),
+			running:     make(chan struct{}),
+		},
+		done: make(chan error, 1),
+	}
+
+	if sockets := e.inherit(listeners); sockets != nil {
+		a, err := newAdopter(g.handler, listeners, sockets)
+		if err != nil {
+			return nil, fmt.Errorf("listener group %s: %w", name, err)
+		}
+		g.adopted = a
+		logging.Info("[UPGRADE] serving listener group %s on %d inherited sockets", name, len(sockets))
+		return g, nil
+	}
+
+	if parks(listeners) {
+		p, err := newParker(g.handler, listeners)
+		if err != nil {
+			return nil, err
+		}
+		g.parked = p
+		logging.Info("Parked listener group %s on %d addresses until their first connection", name, len(addrs))
+		return g, nil
+	}
+
+	logging.Info("Starting event loop for listener group %s on %d addresses...", name, len(addrs))
+
+	opts := e.gnetOptions(listeners)
+	go func() {
+		g.done <- gnet.Rotate(g.handler, addrs, opts...)
+	}()
 
-	// 2. Start Global Engine
-	// We establish ONE engine for ALL ports.
-	// This invokes Multicore=true so we use NumCPU threads total, regardless of port count.
-	err := gnet.Rotate(handler, addrs, gnet.WithMulticore(true), gnet.WithReusePort(true))
+	select {
+	case <-g.handler.booted:
+	case err := <-g.done:
+		if err == nil {
+			err = fmt.Errorf("event loop exited before boot")
+		}
+		return nil, fmt.Errorf("gnet.Rotate failed: %v", err)
+	}
+	if !tune {
+		return g, nil
+	}
+
+	// The loops bind their sockets after boot
+	select {
+	case <-g.handler.running:
+	case err := <-g.done:
+		if err == nil {
+			err = fmt.Errorf("event loop exited before it ran")
+		}
+		return nil, fmt.Errorf("gnet.Rotate failed: %v", err)
+	}
+	for _, l := range listeners {
+		if !tunesListening(l) {
+			continue
+		}
+		if err := tuneListeners(l); err != nil {
+			g.stop()
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// tuneListeners sets the socket options of a listener on its listening
+// sockets.
+func tuneListeners(l *ListenerConfig) error {
+	n, err := tuneListenSockets(l)
 	if err != nil {
-		return fmt.Errorf("gnet.Rotate failed: %v", err)
+		return fmt.Errorf("listener %s socket: %w", l.Name, err)
+	}
+	logging.Debug("[SOCKET] listener %s: options set on %d listening sockets", l.Name, n)
+	return nil
+}
+
+// stop closes the group's listeners and connections.
+func (g *listenerGroup) stop() {
+	if g.parked != nil {
+		g.parked.stop()
+		return
+	}
+	if g.adopted != nil {
+		g.adopted.stop()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), groupStopTimeout)
+	defer cancel()
+	if err := g.handler.eng.Stop(ctx); err != nil {
+		logging.Warn("Stopping listener group %s: %v", g.name, err)
+	}
+}
+
+// sockets returns the sockets the event loops of g take new connections
+// and datagrams on, for closeListening.
+func (g *listenerGroup) sockets() []boundSocket {
+	var own []net.Listener
+	switch {
+	case g.parked != nil:
+		own = g.parked.listeners()
+	case g.adopted != nil:
+		own = g.adopted.sockets
+	}
+	return boundSockets(g.listeners, own)
+}
+
+// closeListening stops g from taking new connections and datagrams while
+// its open connections carry on: its own sockets are closed, those of its
+// event loops detached (see detachSockets), and its UDP sessions, which only
+// end when idle, closed.
+func (g *listenerGroup) closeListening(sockets []boundSocket) {
+	switch {
+	case g.parked != nil:
+		g.parked.closeSockets()
+	case g.adopted != nil:
+		g.adopted.closeSockets()
+	}
+	detachSockets(sockets)
+	g.handler.closeUDPSessions()
+}
+
+// gnetOptions returns the event loop options of a listener group: the
+// server.engine tuning on top of what the engine relies on.
+func (e *Engine) gnetOptions(listeners []*ListenerConfig) []gnet.Option {
+	// Multicore=true uses NumCPU threads per group, regardless of port count.
+	// ReusePort lets a replacement group bind while the old one still serves.
+	opts := []gnet.Option{gnet.WithMulticore(true), gnet.WithReusePort(true), gnet.WithLogger(logging.Component("gnet"))}
+	if len(listeners) > 0 && listeners[0].Interface != "" {
+		opts = append(opts, gnet.WithBindToDevice(listeners[0].Interface))
 	}
 
+	tuning := e.CurrentConfig().Server.Engine
+	if tuning.NumEventLoops > 0 {
+		opts = append(opts, gnet.WithNumEventLoop(tuning.NumEventLoops))
+	}
+	if tuning.ReadBufferSize > 0 {
+		opts = append(opts, gnet.WithSocketRecvBuffer(tuning.ReadBufferSize))
+	}
+	if tuning.WriteBufferSize > 0 {
+		opts = append(opts, gnet.WithSocketSendBuffer(tuning.WriteBufferSize))
+	}
+	if tuning.LockOSThread {
+		opts = append(opts, gnet.WithLockOSThread(true))
+	}
+	// Edge-triggered reads are only implemented for streams
+	udp := slices.ContainsFunc(listeners, func(l *ListenerConfig) bool { return l.Protocol == "udp" })
+	if tuning.EdgeTriggered && !udp {
+		opts = append(opts, gnet.WithEdgeTriggeredIO(true))
+	}
+	// The first tick tells when the listening sockets exist; later ones
+	// probe the event loops for Heartbeat
+	opts = append(opts, gnet.WithTicker(true))
+	return opts
+}
+
+// retire hands the sockets of a replaced group to the listeners replacing it,
+// so connections still landing there get the new configuration, and stops the
+// group once its open connections have finished or groupRetireTimeout has
+// passed. A removed group (no replacement) first stops listening on sockets,
+// taken before any new group could bind its ports, so that none of its ports
+// takes another connection while the open ones drain.
+func (e *Engine) retire(g *listenerGroup, replacement []*ListenerConfig, sockets []boundSocket) {
+	g.handler.setListeners(replacement)
+	if replacement == nil {
+		g.closeListening(sockets)
+	}
+	if g.handler.idle() {
+		g.stop()
+		return
+	}
+
+	e.mu.Lock()
+	e.retiring[g] = struct{}{}
+	e.mu.Unlock()
+	logging.Info("[RELOAD] listener group %s replaced, waiting for open connections", g.name)
+
+	go func() {
+		deadline := e.Clock.NewTimer(groupRetireTimeout)
+		defer deadline.Stop()
+		ticker := e.Clock.NewTicker(drainPoll)
+		defer ticker.Stop()
+	wait:
+		for !g.handler.idle() {
+			select {
+			case <-deadline.C():
+				logging.Warn("[RELOAD] listener group %s still has open connections after %v, closing them", g.name, groupRetireTimeout)
+				break wait
+			case <-ticker.C():
+			}
+		}
+
+		e.mu.Lock()
+		_, ok := e.retiring[g]
+		delete(e.retiring, g)
+		e.mu.Unlock()
+		if ok { // otherwise Stop already took care of it
+			g.stop()
+		}
+	}()
+}
+
+// siblingSession finds the UDP session of client on another event loop of
+// the same listener block. While a replaced group retires, it shares the
+// ports with its replacement and the kernel may hand the client's datagrams
+// to either one, so they are sent to the upstream the session started with.
+func (e *Engine) siblingSession(h *ProxyEventHandler, group, client string) (net.Conn, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	handlers := make([]*ProxyEventHandler, 0, len(e.retiring)+1)
+	if g, ok := e.groups[group]; ok {
+		handlers = append(handlers, g.handler)
+	}
+	for g := range e.retiring {
+		if g.name == group {
+			handlers = append(handlers, g.handler)
+		}
+	}
+	for _, other := range handlers {
+		if other == h {
+			continue
+		}
+		if v, ok := other.udpSessions.Load(client); ok {
+			return v.(net.Conn), true
+		}
+	}
+	return nil, false
+}
+
+// groupNames returns the distinct group names of the listeners in order of appearance.
+func groupNames(listeners []*ListenerConfig) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, l := range listeners {
+		if !seen[l.Group] {
+			seen[l.Group] = true
+			names = append(names, l.Group)
+		}
+	}
+	return names
+}
+
+func groupListeners(listeners []*ListenerConfig, group string) []*ListenerConfig {
+	out := make([]*ListenerConfig, 0)
+	for _, l := range listeners {
+		if l.Group == group {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// backendRuntime bundles the runtime objects built for one backend.
+type backendRuntime struct {
+	backend  *config.Backend
+	balancer lb.Balancer
+	policy   *retry.Policy
+	checker  *health.Checker     // nil without active health checks
+	resolved map[string][]string // hostname server -> pinned addresses, see resolveServers
+}
+
+func (e *Engine) newBackendRuntime(be *config.Backend) (*backendRuntime, error) {
+	return e.buildRuntime(be, e.resolveServers(be, nil))
+}
+
+// buildRuntime creates the runtime of a backend whose hostname servers
+// resolved to the given addresses.
+func (e *Engine) buildRuntime(be *config.Backend, resolved map[string][]string) (*backendRuntime, error) {
+	be = pinServers(be, resolved)
+
+	// Create Balancer
+	balancer := lb.NewPool(be.Balance, poolServers(be))
+	e.applyWeights(be.Name, balancer, resolved)
+	e.applyStates(be, balancer, resolved)
+	logging.Info("Initialized backend %s with %s balancing", be.Name, be.Balance)
+
+	// Create Retry Policy
+	policy, err := retry.NewPolicy(be.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %w", be.Name, err)
+	}
+	policy.Clock = e.Clock
+
+	rt := &backendRuntime{backend: be, balancer: balancer, policy: policy, resolved: resolved}
+
+	// Create Health Checker; the servers of a tunnel are only reachable by
+	// its peer
+	if be.HealthCheck.Active.Interval != "" && be.Tunnel.Enabled() {
+		logging.Warn("[HEALTH] backend %s is tunneled, skipping its active health checks", be.Name)
+	} else if be.HealthCheck.Active.Interval != "" {
+		checker := health.NewChecker(be.HealthCheck, be) // Pass the backend config directly
+		checker.Hosts = e.Hosts
+		checker.Clock = e.Clock
+		checker.Ports = func() []int { return e.backendPorts(be.Name) }
+		checker.Skip = func(server string) bool { return e.inMaint(be.Name, server) }
+		checker.OnStatusChange = func(server string, healthy bool) {
+			if healthy {
+				logging.Info("[HEALTH] backend %s server %s is up", be.Name, server)
+			} else {
+				logging.Warn("[HEALTH] backend %s server %s is down", be.Name, server)
+			}
+			rt.balancer.UpdateStatus(server, healthy)
+		}
+		rt.checker = checker
+	}
+	return rt, nil
+}
+
+// poolServers translates the server entries of a backend for lb.NewPool.
+func poolServers(be *config.Backend) []lb.Server {
+	weights := be.ServerWeights()
+	out := make([]lb.Server, len(be.Servers))
+	for i, s := range be.Servers {
+		w, ok := weights[s.Address]
+		if !ok {
+			w = lb.DefaultWeight
+		}
+		out[i] = lb.Server{
+			Address:  s.Address,
+			Weight:   w,
+			MaxConns: s.MaxConns,
+			Backup:   s.Backup,
+			Disabled: s.Disabled,
+		}
+	}
+	return out
+}
+
+// install registers the runtime in the engine maps. Callers hold e.mu.
+func (rt *backendRuntime) install(e *Engine) {
+	name := rt.backend.Name
+	e.Balancers[name] = rt.balancer
+	e.Backends[name] = rt.backend // Populate map for fast access
+	e.Retries[name] = rt.policy
+	if rt.resolved != nil {
+		e.resolved[name] = rt.resolved
+	} else {
+		delete(e.resolved, name)
+	}
+	if rt.checker != nil {
+		e.Checkers[name] = rt.checker
+	} else {
+		delete(e.Checkers, name)
+	}
+}
+
+// balancer returns the balancer of a backend.
+func (e *Engine) balancer(name string) (lb.Balancer, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	b, ok := e.Balancers[name]
+	return b, ok
+}
+
+// backend returns the configuration of a backend.
+func (e *Engine) backend(name string) (*config.Backend, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	b, ok := e.Backends[name]
+	return b, ok
+}
+
+// dialOptions returns the local end of the next connection to a backend:
+// its TOS and the next of its source addresses.
+func (e *Engine) dialOptions(backend string) resolver.DialOptions {
+	be, ok := e.backend(backend)
+	if !ok {
+		return resolver.DialOptions{}
+	}
+	o := resolver.DialOptions{TOS: be.TOS}
+	if n := len(be.Source); n > 0 {
+		o.Source = net.ParseIP(be.Source[e.nextSource.Add(1)%uint64(n)])
+	}
+	return o
+}
+
+// retryPolicy returns the retry policy for a backend, falling back to a
+// single attempt.
+func (e *Engine) retryPolicy(backend string) *retry.Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if p, ok := e.Retries[backend]; ok {
+		return p
+	}
+	return &retry.Policy{}
+}
+
+// CurrentConfig returns the configuration currently applied.
+func (e *Engine) CurrentConfig() *config.Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Config
+}
+
+// ListenerCount returns the number of expanded listeners.
+func (e *Engine) ListenerCount() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.Listeners)
+}
+
+// HealthStatus returns the last probe result per server of a backend,
+// or nil when the backend has no active health check.
+func (e *Engine) HealthStatus(backend string) map[string]bool {
+	e.mu.RLock()
+	checker, ok := e.Checkers[backend]
+	e.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return checker.Status()
+}
+
+// HealthChecked waits until the active health check of every backend has
+// probed all servers once, or until ctx is done.
+func (e *Engine) HealthChecked(ctx context.Context) error {
+	e.mu.RLock()
+	checked := make([]<-chan struct{}, 0, len(e.Checkers))
+	for _, c := range e.Checkers {
+		checked = append(checked, c.Checked())
+	}
+	e.mu.RUnlock()
+	for _, ch := range checked {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
-// runListener is deprecated/removed in Shared Loop model
+// PortsDown returns, per server of a backend given without a port, the
+// listener ports its last probe failed on, or nil when the backend has no
+// active health check.
+func (e *Engine) PortsDown(backend string) map[string][]int {
+	e.mu.RLock()
+	checker, ok := e.Checkers[backend]
+	e.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return checker.PortsDown()
+}
+
+// backendPorts returns the ports of the listeners routed to a backend,
+// sorted.
+func (e *Engine) backendPorts(backend string) []int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ports := make([]int, 0)
+	for _, l := range e.Listeners {
+		if l.DefaultBackend == backend && l.Port != 0 && !l.Knock {
+			ports = append(ports, l.Port)
+		}
+	}
+	sort.Ints(ports)
+	return slices.Compact(ports)
+}
+
+// pick returns the next server of a backend for a connection to port,
+// passing over servers whose probe on that port failed. When every server
+// failed there, the balancer's choice stands.
+func (e *Engine) pick(balancer lb.Balancer, backend string, port int) (string, error) {
+	e.mu.RLock()
+	checker := e.Checkers[backend]
+	be := e.Backends[backend]
+	e.mu.RUnlock()
+
+	entry, err := balancer.Next()
+	if err != nil || checker == nil || be == nil {
+		return entry, err
+	}
+	// Hold skipped servers as busy while picking again, so that leastconn
+	// moves on as well.
+	held := make([]string, 0)
+	defer func() {
+		for _, s := range held {
+			balancer.OnDisconnect(s)
+		}
+	}()
+	first := entry
+	for range be.Servers {
+		if !checker.PortDown(entry, port) {
+			return entry, nil
+		}
+		balancer.OnConnect(entry)
+		held = append(held, entry)
+		if entry, err = balancer.Next(); err != nil {
+			break
+		}
+	}
+	return first, nil
+}
+
+// HealthHistory returns the health transitions per probed server of a
+// backend, or nil when the backend has no active health check.
+func (e *Engine) HealthHistory(backend string) map[string]health.History {
+	e.mu.RLock()
+	checker, ok := e.Checkers[backend]
+	e.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return checker.History()
+}
+
+// Connections returns the open TCP connections of all listeners, oldest
+// first.
+func (e *Engine) Connections() []Connection {
+	all := make([]Connection, 0)
+	for _, h := range e.handlers() {
+		all = append(all, h.connections()...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Start.Before(all[j].Start) })
+	return all
+}
+
+// TopMemoryConsumers returns the n connections holding the most buffered bytes.
+func (e *Engine) TopMemoryConsumers(n int) []ConnMemory {
+	all := make([]ConnMemory, 0)
+	for _, h := range e.handlers() {
+		all = append(all, h.topBuffered(0)...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Buffered > all[j].Buffered })
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
@@ -2,8 +2,14 @@ package core
 
 import (
 	"context"
+	"errors"
+	"net"
 	"nvelox/config"
+	"nvelox/core/clock"
 	"testing"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
 )
 
 func TestEngine_StartError(t *testing.T) {
@@ -23,3 +29,232 @@ func TestEngine_StartError(t *testing.T) {
 		t.Error("expected start error for invalid address")
 	}
 }
+
+func TestEngine_Interface(t *testing.T) {
+	if !bindToDeviceSupported {
+		t.Skip("interface is only supported on linux")
+	}
+	engine := NewEngine(&config.Config{})
+	missing := &ListenerConfig{Name: "web", Group: "web", Addr: "127.0.0.1:0", Protocol: "tcp",
+		ListenerOptions: ListenerOptions{Interface: "nvelox-none0"}}
+	if _, err := engine.startGroup("web", []*ListenerConfig{missing}); err == nil {
+		t.Error("expected error binding to a missing interface")
+	}
+
+	lo := &ListenerConfig{Name: "web", Group: "web", Addr: "127.0.0.1:0", Protocol: "tcp",
+		ListenerOptions: ListenerOptions{Interface: "lo"}}
+	g, err := engine.startGroup("web", []*ListenerConfig{lo})
+	if err != nil {
+		t.Skipf("cannot bind to lo here: %v", err)
+	}
+	g.stop()
+}
+
+func TestEngine_Socket(t *testing.T) {
+	if !listenSocketSupported {
+		t.Skip("listening socket options are only supported on linux")
+	}
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().(*net.TCPAddr)
+	probe.Close()
+
+	cfg := &config.Config{Server: config.ServerConfig{Engine: config.EngineConfig{NumEventLoops: 2}}}
+	engine := NewEngine(cfg)
+	l := &ListenerConfig{Name: "web", Group: "web", Addr: addr.String(), Protocol: "tcp", Port: addr.Port,
+		ListenerOptions: ListenerOptions{Socket: config.SocketConfig{DeferAccept: "3s", KeepAlive: "60s"}}}
+	g, err := engine.startGroup("web", []*ListenerConfig{l})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.stop()
+
+	// Both event loops bound a socket, and both are tuned
+	if n, err := tuneListenSockets(l); err != nil || n != 2 {
+		t.Fatalf("tuned %d listening sockets (%v), want 2", n, err)
+	}
+}
+
+func TestEngine_gnetOptions(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{Engine: config.EngineConfig{
+		NumEventLoops: 4, EdgeTriggered: true, ReadBufferSize: 1 << 20, WriteBufferSize: 1 << 21, LockOSThread: true,
+	}}}
+	e := NewEngine(cfg)
+	apply := func(listeners ...*ListenerConfig) gnet.Options {
+		var o gnet.Options
+		for _, opt := range e.gnetOptions(listeners) {
+			opt(&o)
+		}
+		return o
+	}
+
+	o := apply(&ListenerConfig{Protocol: "tcp"})
+	if !o.Multicore || !o.ReusePort || o.NumEventLoop != 4 || !o.EdgeTriggeredIO || !o.LockOSThread ||
+		o.SocketRecvBuffer != 1<<20 || o.SocketSendBuffer != 1<<21 {
+		t.Errorf("server.engine not applied: %+v", o)
+	}
+	if o := apply(&ListenerConfig{Protocol: "tcp"}, &ListenerConfig{Protocol: "udp"}); o.EdgeTriggeredIO {
+		t.Error("edge-triggered I/O enabled for a group with UDP listeners")
+	}
+
+	// Unset keeps the gnet defaults
+	e = NewEngine(&config.Config{})
+	if o := apply(&ListenerConfig{Protocol: "tcp"}); o.NumEventLoop != 0 || o.EdgeTriggeredIO || o.SocketRecvBuffer != 0 {
+		t.Errorf("unexpected tuning without server.engine: %+v", o)
+	}
+}
+
+func TestEngine_ListeningError(t *testing.T) {
+	engine := NewEngine(&config.Config{})
+	engine.Listeners = append(engine.Listeners, &ListenerConfig{
+		Name: "web", Group: "web", Addr: "127.0.0.1:0", Protocol: "tcp",
+	})
+	bound := false
+	engine.Listening = func() error {
+		engine.mu.RLock()
+		bound = engine.groups["web"] != nil
+		engine.mu.RUnlock()
+		return errors.New("no such user")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- engine.Start(context.Background()) }()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "no such user" {
+			t.Errorf("Start returned %v, want the Listening error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start kept serving after Listening failed")
+	}
+	if !bound {
+		t.Error("Listening ran before the listener group was bound")
+	}
+}
+
+func TestEngine_PickSkipsPortDown(t *testing.T) {
+	// Each server listens on one of the two ports only
+	ports := make([]int, 0, 2)
+	for _, host := range []string{"127.0.0.1", "127.0.0.2"} {
+		l, err := net.Listen("tcp", host+":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+
+	be := &config.Backend{
+		Name:    "range",
+		Balance: "roundrobin",
+		Servers: []config.Server{{Address: "127.0.0.1"}, {Address: "127.0.0.2"}},
+		HealthCheck: config.HealthCheckConfig{
+			Active: config.ActiveHealthCheck{Type: "tcp", Interval: "1s", Timeout: "100ms"},
+		},
+	}
+	e := NewEngine(&config.Config{})
+	fake := clock.NewFake(time.Now())
+	e.Clock = fake
+	for _, port := range ports {
+		e.Listeners = append(e.Listeners, &ListenerConfig{Name: "range", Protocol: "tcp", Port: port, DefaultBackend: "range"})
+	}
+	rt, err := e.newBackendRuntime(be)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.install(e)
+	rt.checker.Start()
+	defer rt.checker.Stop()
+	waitFor(t, func() bool { return fake.Waiters() > 0 })
+	fake.Advance(time.Second)
+	waitFor(t, func() bool { return len(e.PortsDown("range")) == 2 })
+
+	// Both servers are up, yet each port goes to the one listening on it
+	for _, status := range e.HealthStatus("range") {
+		if !status {
+			t.Fatalf("expected both servers up, got %v", e.HealthStatus("range"))
+		}
+	}
+	for i, want := range []string{"127.0.0.1", "127.0.0.2"} {
+		for range 4 {
+			server, err := e.pick(rt.balancer, "range", ports[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if server != want {
+				t.Fatalf("expected %s for port %d, got %s", want, ports[i], server)
+			}
+		}
+	}
+
+	// Ports that were not probed leave the balancer's choice alone
+	seen := make(map[string]bool)
+	for range 4 {
+		server, _ := e.pick(rt.balancer, "range", 1)
+		seen[server] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected both servers picked for an unprobed port, got %v", seen)
+	}
+}
+
+func TestEngine_UDPHandover(t *testing.T) {
+	upstream, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	session, err := net.DialUDP("udp", nil, upstream.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	// The replaced group still holds the client's session
+	e := NewEngine(&config.Config{})
+	l := &ListenerConfig{Name: "dns", Group: "dns", Protocol: "udp", Port: 5353, DefaultBackend: "next"}
+	old := &listenerGroup{name: "dns", handler: &ProxyEventHandler{engine: e}}
+	next := &listenerGroup{name: "dns", handler: &ProxyEventHandler{engine: e}}
+	old.handler.udpSessions.Store("1.2.3.4:1234", session)
+	e.groups["dns"] = next
+	e.retiring[old] = struct{}{}
+
+	c := &MockGnetConn{
+		localAddr:  &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5353},
+		remoteAddr: &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234},
+	}
+	next.handler.handleUDP(c, l)
+
+	upstream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 64)
+	n, _, err := upstream.ReadFromUDP(b)
+	if err != nil || string(b[:n]) != "test-data" {
+		t.Fatalf("old upstream got %q, %v", b[:n], err)
+	}
+	if !next.handler.idle() {
+		t.Error("replacement opened a second session for the client")
+	}
+
+	// Unrelated blocks do not share sessions
+	if _, ok := e.siblingSession(next.handler, "web", "1.2.3.4:1234"); ok {
+		t.Error("found a session of another listener block")
+	}
+}
+
+func TestEngine_TopMemoryConsumers(t *testing.T) {
+	e := NewEngine(&config.Config{})
+	old := &listenerGroup{name: "web", handler: &ProxyEventHandler{engine: e}}
+	next := &listenerGroup{name: "web", handler: &ProxyEventHandler{engine: e}}
+	old.handler.conns.Store(&ConnContext{Client: "draining", buffer: make([]byte, 100)}, struct{}{})
+	next.handler.conns.Store(&ConnContext{Client: "new", buffer: make([]byte, 10)}, struct{}{})
+	e.groups["web"] = next
+	e.retiring[old] = struct{}{}
+
+	// Connections of a retiring group are listed like any other
+	top := e.TopMemoryConsumers(0)
+	if len(top) != 2 || top[0].Client != "draining" || top[1].Client != "new" {
+		t.Errorf("unexpected top consumers: %+v", top)
+	}
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"nvelox/config"
+)
+
+func TestEngine_Freeze(t *testing.T) {
+	e := NewEngine(&config.Config{})
+	if err := e.CheckFrozen("reload", "test"); err != nil {
+		t.Fatalf("CheckFrozen before freezing: %v", err)
+	}
+
+	e.SetFrozen(true, "test")
+	frozen, since := e.Frozen()
+	if !frozen || since.IsZero() {
+		t.Errorf("Frozen = %v, %v", frozen, since)
+	}
+	if err := e.CheckFrozen("reload", "test"); !errors.Is(err, ErrFrozen) {
+		t.Errorf("expected ErrFrozen, got %v", err)
+	}
+	// Freezing again keeps the original time
+	e.SetFrozen(true, "test")
+	if _, again := e.Frozen(); !again.Equal(since) {
+		t.Errorf("since moved from %v to %v", since, again)
+	}
+
+	e.SetFrozen(false, "test")
+	if frozen, _ := e.Frozen(); frozen {
+		t.Error("still frozen after thawing")
+	}
+	if err := e.CheckFrozen("reload", "test"); err != nil {
+		t.Errorf("CheckFrozen after thawing: %v", err)
+	}
+}
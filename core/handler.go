@@ -1,44 +1,109 @@
 package core
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"nvelox/config"
+	"nvelox/core/clock"
 	"nvelox/core/logging"
+	"nvelox/core/resolver"
+	"nvelox/lb"
+	"nvelox/preauth"
 	"nvelox/proxy"
+	"nvelox/tlsfp"
 
 	"github.com/panjf2000/gnet/v2"
 )
 
 const (
-	tcpDialTimeout = 5 * time.Second
-	udpReadTimeout = 60 * time.Second
 	copyBufferSize = 32 * 1024 // 32KB
 	udpBufferSize  = 4096      // 4KB
 )
 
+// Access log status codes
+const (
+	StatusOK             = "OK"
+	StatusBackendFail    = "BACKEND_FAIL"
+	StatusError          = "ERR"
+	StatusMemLimit       = "MEM_LIMIT"
+	StatusDrained        = "DRAINED"
+	StatusShed           = "SHED"
+	StatusDraining       = "DRAINING"
+	StatusDependencyDown = "DEP_DOWN"
+	StatusRateLimited    = "RATE_LIMIT"
+	StatusTimeout        = "TIMEOUT"
+	StatusRebalanced     = "REBALANCED"
+	StatusProxyError     = "PROXY_ERR"
+	StatusPreauthFail    = "PREAUTH_FAIL"
+	StatusKnock          = "KNOCK"
+	StatusTLSError       = "TLS_ERR"
+)
+
+// backpressurePoll is how often a backend reader re-checks pending writes
+// while the connection is over its buffer ceiling.
+const backpressurePoll = time.Millisecond
+
+// Directions in which the max_conn_buffer high-water mark trips.
+const (
+	toClient  = "to_client"  // the client reads slower than the backend sends
+	toBackend = "to_backend" // the client sends before the backend is connected
+)
+
+// backpressureLog reports high-water trips as key=value lines.
+var backpressureLog = logging.Component("BACKPRESSURE")
+
 type ProxyEventHandler struct {
 	gnet.BuiltinEventEngine
 	engine      *Engine
+	group       string                     // name of the listener group served
+	mu          sync.RWMutex               // guards listenerMap
 	listenerMap map[string]*ListenerConfig // Addr -> Config
 
+	// eng is the gnet engine serving this handler, set on boot.
+	eng    gnet.Engine
+	booted chan struct{}
+	// running is closed on the first tick, once the event loops and their
+	// listening sockets exist.
+	running chan struct{}
+	runOnce sync.Once
+	// loops holds a *loopProbe per gnet.EventLoop that served a connection;
+	// each tick probes them for Heartbeat (see probeLoops).
+	loops sync.Map
+	// unprobed is set for parked groups, whose promoted loops keep their
+	// ticker quiet and are not watched.
+	unprobed bool
+
 	// UDP Session Table: remoteAddr(string) -> *net.UDPConn (for backend)
 	udpSessions sync.Map
+
+	// Active TCP connections: *ConnContext -> struct{}
+	conns sync.Map
 }
 
 // OnTraffic fires when data is available.
 func (h *ProxyEventHandler) OnTraffic(c gnet.Conn) (action gnet.Action) {
-	// Find listener for this connection
+	// Find listener for this connection; those of a removed listener keep
+	// the one they were accepted on while they drain
 	l := h.getListenerConfig(c)
+	if ctx, ok := c.Context().(*ConnContext); l == nil && ok {
+		l = ctx.listener
+	}
 	if l == nil {
 		logging.Error("Unknown listener for connection on %s", c.LocalAddr())
 		return gnet.Close
 	}
 
 	if l.Protocol == "udp" {
+		h.watchLoop(c)
 		return h.handleUDP(c, l)
 	}
 	return h.handleTCP(c, l)
@@ -46,10 +111,26 @@ func (h *ProxyEventHandler) OnTraffic(c gnet.Conn) (action gnet.Action) {
 
 // OnBoot fires when the engine starts.
 func (h *ProxyEventHandler) OnBoot(eng gnet.Engine) (action gnet.Action) {
-	logging.Info("Shared Server Engine Started")
+	logging.Info("Event loop for listener group %s started", h.group)
+	h.eng = eng
+	if h.booted != nil {
+		close(h.booted)
+	}
 	return gnet.None
 }
 
+// OnTick fires first once the event loops run (see running), then every
+// loopTick to probe them.
+func (h *ProxyEventHandler) OnTick() (time.Duration, gnet.Action) {
+	h.runOnce.Do(func() {
+		if h.running != nil {
+			close(h.running)
+		}
+	})
+	h.probeLoops()
+	return loopTick, gnet.None
+}
+
 // OnOpen fires when a new connection is opened.
 func (h *ProxyEventHandler) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 	l := h.getListenerConfig(c)
@@ -59,19 +140,117 @@ func (h *ProxyEventHandler) OnOpen(c gnet.Conn) (out []byte, action gnet.Action)
 	}
 
 	logging.Info("[CONN] New connection from %s on %s (Listener: %s)", c.RemoteAddr(), c.LocalAddr(), l.Name)
+	h.watchLoop(c)
+	if l.Socket != (config.SocketConfig{}) {
+		if err := applySocket(c, l.Socket); err != nil {
+			logging.Warn("[CONN] socket options on %s: %v", c.RemoteAddr(), err)
+		}
+	}
 
+	lifetime, cancel := context.WithCancel(context.Background())
 	ctx := &ConnContext{
-		StartTime: time.Now(),
+		StartTime: h.clock().Now(),
+		Listener:  l.Name,
+		Client:    c.RemoteAddr().String(),
 		buffer:    make([]byte, 0),
+		from:      c.RemoteAddr(),
+
+		group:       l.Group,
+		listener:    l,
+		backendName: l.DefaultBackend,
+		cancel:      cancel,
 	}
+	ctx.clientActive = ctx.StartTime.UnixNano()
+	ctx.trace = newTrace(l, h.clock(), ctx.StartTime)
+	ctx.trace.event(traceAccepted, "listener=%s client=%s local=%s", l.Name, c.RemoteAddr(), c.LocalAddr())
 	c.SetContext(ctx)
+	h.conns.Store(ctx, struct{}{})
+	if h.engine != nil {
+		h.engine.counters.connOpened()
+	}
 
-	// Initiate connection to backend asynchronously
-	go h.connectBackend(c, ctx, l)
+	if h.engine != nil && h.engine.Draining() {
+		ctx.reason = StatusDraining
+		return nil, h.reject(lifetime, c, ctx, l)
+	}
+	if h.engine != nil && !h.engine.Shedder.Allow(l.Group, l.Priority) {
+		logging.Warn("[SHED] rejecting %s on %s under system pressure", c.RemoteAddr(), l.Name)
+		ctx.reason = StatusShed
+		return nil, h.reject(lifetime, c, ctx, l)
+	}
+	// Behind a trusted load balancer the limit applies to the client its
+	// PROXY header names, see readProxyHeader
+	ctx.awaitProxy = trustedProxy(l.ProxyFrom, c.RemoteAddr())
+	if !ctx.awaitProxy && !l.limiter.Allow(c.RemoteAddr(), ctx.StartTime) {
+		logging.Warn("[RATE] rejecting %s on %s: connection rate limit exceeded", c.RemoteAddr(), l.Name)
+		ctx.reason = StatusRateLimited
+		return nil, h.reject(lifetime, c, ctx, l)
+	}
+
+	// Initiate connection to backend asynchronously; a knock goes no further
+	start := func() { go h.connectBackend(lifetime, c, ctx, l) }
+	if l.Knock {
+		start = func() { h.knock(c, ctx, l) }
+	}
+
+	// Connections from trusted load balancers start once their PROXY
+	// header names the client, those of preauth listeners once their
+	// preamble is verified
+	ctx.awaitAuth = l.preauth.preamble(l)
+	if ctx.awaitProxy {
+		go h.watchProxyHeader(lifetime, c, ctx, l)
+	}
+	if ctx.awaitAuth {
+		go h.watchPreamble(lifetime, c, ctx, l)
+	}
+	if ctx.awaitProxy || ctx.awaitAuth {
+		ctx.connect = start
+		return nil, gnet.None
+	}
+	start()
 
 	return nil, gnet.None
 }
 
+// reject ends a connection refused at accept. With capture_on_reject the
+// connection is held open until its first bytes arrive (see handleTCP) or
+// the capture wait has passed, so the access log can show what it was.
+func (h *ProxyEventHandler) reject(lifetime context.Context, c gnet.Conn, ctx *ConnContext, l *ListenerConfig) gnet.Action {
+	if l.Capture == 0 || l.Protocol == "udp" {
+		return gnet.Close
+	}
+	ctx.rejecting = true
+	go func() {
+		timer := h.clock().NewTimer(l.CaptureWait)
+		defer timer.Stop()
+		select {
+		case <-lifetime.Done():
+		case <-timer.C():
+			h.safeClose(c, ctx)
+		}
+	}()
+	return gnet.None
+}
+
+// rejected reports whether a status means the connection was turned away
+// before it reached a backend.
+func rejected(status string) bool {
+	switch status {
+	case StatusBackendFail, StatusShed, StatusDraining, StatusDependencyDown, StatusRateLimited, StatusProxyError,
+		StatusPreauthFail:
+		return true
+	}
+	return false
+}
+
+// clock returns the engine clock, defaulting to the wall clock.
+func (h *ProxyEventHandler) clock() clock.Clock {
+	if h.engine != nil && h.engine.Clock != nil {
+		return h.engine.Clock
+	}
+	return clock.Real()
+}
+
 func (h *ProxyEventHandler) getListenerConfig(c gnet.Conn) *ListenerConfig {
 	// Address matching logic via "proto:port" key
 	if c.LocalAddr() == nil {
@@ -92,9 +271,15 @@ func (h *ProxyEventHandler) getListenerConfig(c gnet.Conn) *ListenerConfig {
 
 	key := fmt.Sprintf("%s:%s", proto, port)
 
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if l, ok := h.listenerMap[key]; ok {
 		return l
 	}
+	// A listener bound to port 0 is registered before the kernel picks its port
+	if l, ok := h.listenerMap[proto+":0"]; ok {
+		return l
+	}
 
 	return nil
 }
@@ -104,62 +289,345 @@ func (h *ProxyEventHandler) OnClose(c gnet.Conn, err error) (action gnet.Action)
 	duration := time.Duration(0)
 	if val := c.Context(); val != nil {
 		if ctx, ok := val.(*ConnContext); ok {
-			duration = time.Since(ctx.StartTime)
+			duration = h.clock().Since(ctx.StartTime)
+			if ctx.cancel != nil {
+				ctx.cancel() // abort a backend dial still in progress
+			}
 			ctx.mu.Lock()
 			if ctx.BackendConn != nil {
 				ctx.BackendConn.Close()
 			}
 			ctx.closed = true // Mark as closed to stop dialer updates
+			h.conns.Delete(ctx)
+			status := StatusOK
+			if ctx.reason != "" {
+				status = ctx.reason
+			} else if !ctx.connected {
+				status = StatusBackendFail
+			} else if err != nil {
+				status = StatusError
+			}
+			entry := logging.AccessEntry{
+				Time:     ctx.StartTime,
+				Listener: ctx.Listener,
+				Client:   ctx.Client,
+				Backend:  ctx.Backend,
+				Status:   status,
+				BytesIn:  atomic.LoadInt64(&ctx.bytesIn),
+				BytesOut: atomic.LoadInt64(&ctx.bytesOut),
+				Duration: duration,
+				Select:   ctx.selectTime,
+				Dial:     ctx.dialTime,
+				Connect:  ctx.connectTime,
+				JA3:      ctx.JA3,
+				JA4:      ctx.JA4,
+				SNI:      ctx.SNI,
+				Tags:     ctx.Tags,
+				ConnID:   ctx.ConnID,
+				Tenant:   ctx.Tenant,
+			}
+			if rejected(status) && len(ctx.head) > 0 {
+				entry.Head = hex.EncodeToString(ctx.head)
+			}
+			if ctx.hello != nil && h.engine != nil {
+				h.engine.counters.helloFailed(helloIncomplete)
+			}
+			ctx.trace.event(traceClosed, "status=%s in=%d out=%d", status, entry.BytesIn, entry.BytesOut)
+			backendName, connected, sessionID := ctx.backendName, ctx.connected, ctx.SessionID
 			ctx.mu.Unlock()
+			if h.engine != nil && connected {
+				h.engine.counters.connClosed(backendName, entry.BytesIn, entry.BytesOut)
+			}
+			if h.engine != nil && sessionID != "" {
+				h.engine.Sessions.Notify(SessionEvent{
+					Type:     SessionClose,
+					ID:       sessionID,
+					Time:     h.clock().Now(),
+					Listener: entry.Listener,
+					Protocol: "tcp",
+					Client:   entry.Client,
+					Backend:  backendName,
+					Server:   entry.Backend,
+					Status:   status,
+					BytesIn:  entry.BytesIn,
+					BytesOut: entry.BytesOut,
+					Duration: duration.Seconds(),
+				})
+			}
+			logging.LogAccess(entry)
 		}
 	} else if conn, ok := c.Context().(net.Conn); ok {
 		conn.Close()
 	}
 
-	logging.Info("[CONN] Closed connection from %s (Duration: %v, Err: %v)", c.RemoteAddr(), duration, err)
+	logging.Info("[CONN] Closed connection from %s (Duration: %s, Err: %v)", c.RemoteAddr(), logging.FormatDuration(duration), err)
 	return gnet.None
 }
 
 type ConnContext struct {
 	BackendConn net.Conn
 	StartTime   time.Time
+	Listener    string
+	Client      string
+	Backend     string // Selected backend server address
+	SessionID   string // Set once the session is announced to session_events
+	JA3         string // TLS ClientHello fingerprints, if enabled on the listener
+	JA4         string
+	SNI         string            // TLS server name, with capture_on_reject
+	Tags        map[string]string // PROXY TLVs named by accept_proxy
+	ConnID      string            // correlates the tiers of nvelox peers, see peerMetadata
+	Tenant      string            // from the peer metadata or the listener
 
 	mu        sync.Mutex
 	buffer    []byte
 	connected bool
 	closed    bool
+	reason    string // Access log status override set when we terminate the connection
+	rejecting bool   // rejected at accept, held open for capture_on_reject
+	head      []byte // first bytes from the client, with capture_on_reject
+
+	hello         []byte    // ClientHello fragments buffered for inspection
+	helloDeadline time.Time // when an incomplete ClientHello is given up on
+
+	from       net.Addr // where the connection came from, the load balancer behind accept_proxy
+	awaitProxy bool     // the PROXY header of a trusted load balancer is still due
+	proxyBuf   []byte   // PROXY header fragments
+	proxySrc   net.Addr // client and destination addresses of the PROXY header
+	proxyDst   net.Addr
+	peerHints  map[string]string // routing hints of the peer metadata of the PROXY header
+	awaitAuth  bool              // the preamble of a preauth listener is still due
+	authBuf    []byte            // preamble fragments
+	connect    func()            // starts the connection once no header is due, see proceed
+
+	group       string          // Listener group the connection arrived on
+	listener    *ListenerConfig // the listener at accept, for when it is removed
+	backendName string          // Backend pool the connection is routed to
+	server      string          // Pool entry the connection was balanced to, set once connected
+
+	selectTime  time.Duration // picking servers, summed over dial attempts
+	dialTime    time.Duration // dialing servers, summed over dial attempts
+	connectTime time.Duration // from accept until the backend was connected
+
+	cancel context.CancelFunc // ends the connection lifetime passed to connectBackend
+	trace  *connTrace         // nil unless the connection is traced
+
+	bytesIn  int64 // client -> backend
+	bytesOut int64 // backend -> client
+	pending  int64 // backend -> client bytes queued in AsyncWrite
+
+	clientActive int64 // UnixNano of the last client read, for client_idle
+	serverActive int64 // UnixNano of the last backend read, 0 until connected
+
+	firstSent int64 // UnixNano of the first write to the backend, for TTFB
+
+	stalled bool // the backend reader paused for the client once, see highWater
+}
+
+// proceed starts a connection that waited for its PROXY header or preamble
+// once neither is due anymore. Callers hold ctx.mu.
+func (ctx *ConnContext) proceed() {
+	if ctx.awaitProxy || ctx.awaitAuth || ctx.connect == nil {
+		return
+	}
+	connect := ctx.connect
+	ctx.connect = nil
+	connect()
+}
+
+// markSent records the time of the first write to the backend.
+func (ctx *ConnContext) markSent(clk clock.Clock) {
+	atomic.CompareAndSwapInt64(&ctx.firstSent, 0, clk.Now().UnixNano())
+}
+
+// ConnMemory reports the buffered bytes held by a connection.
+type ConnMemory struct {
+	Listener string `json:"listener"`
+	Client   string `json:"client"`
+	Buffered int64  `json:"buffered"`
+}
+
+// buffered returns the pre-connect buffer plus pending async writes.
+func (ctx *ConnContext) buffered() int64 {
+	ctx.mu.Lock()
+	n := int64(len(ctx.buffer))
+	ctx.mu.Unlock()
+	return n + atomic.LoadInt64(&ctx.pending)
+}
+
+func (h *ProxyEventHandler) topBuffered(n int) []ConnMemory {
+	var all []ConnMemory
+	h.conns.Range(func(k, _ any) bool {
+		ctx := k.(*ConnContext)
+		all = append(all, ConnMemory{Listener: ctx.Listener, Client: ctx.Client, Buffered: ctx.buffered()})
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i].Buffered > all[j].Buffered })
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// Connection describes an open TCP connection.
+type Connection struct {
+	Listener string    `json:"listener"`
+	Client   string    `json:"client"`
+	Backend  string    `json:"backend"`
+	Server   string    `json:"server,omitempty"` // empty until connected
+	Start    time.Time `json:"start"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
+
+// connections lists the open connections of the handler.
+func (h *ProxyEventHandler) connections() []Connection {
+	var all []Connection
+	h.conns.Range(func(k, _ any) bool {
+		ctx := k.(*ConnContext)
+		ctx.mu.Lock()
+		conn := Connection{
+			Listener: ctx.Listener,
+			Client:   ctx.Client,
+			Backend:  ctx.backendName,
+			Server:   ctx.Backend,
+			Start:    ctx.StartTime,
+		}
+		ctx.mu.Unlock()
+		conn.BytesIn = atomic.LoadInt64(&ctx.bytesIn)
+		conn.BytesOut = atomic.LoadInt64(&ctx.bytesOut)
+		all = append(all, conn)
+		return true
+	})
+	return all
 }
 
-func (h *ProxyEventHandler) connectBackend(c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+// connectBackend dials the backend and copies its responses to the client.
+// lifetime is cancelled when the client connection closes, which aborts a
+// dial or retry backoff still in progress.
+func (h *ProxyEventHandler) connectBackend(lifetime context.Context, c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+	begin := h.clock().Now()
 	backendName := l.DefaultBackend
-	balancer, ok := h.engine.Balancers[backendName]
+	var trace *connTrace
+	if ctx != nil {
+		trace = ctx.trace
+		if routed := h.peerRoute(ctx, l); routed != "" {
+			backendName = routed
+		}
+	}
+	if ctx != nil && !l.preauth.admits(ctx.Client, begin) {
+		logging.Warn("[PREAUTH] rejecting %s on %s: no knock", ctx.Client, l.Name)
+		ctx.mu.Lock()
+		ctx.reason = StatusPreauthFail
+		ctx.mu.Unlock()
+		h.safeClose(c, ctx)
+		return
+	}
+	balancer, ok := h.engine.balancer(backendName)
 	if !ok {
 		logging.Error("[ERR] backend not found: %s", backendName)
 		c.Close()
 		return
 	}
-
-	target, err := balancer.Next()
-	if err != nil {
-		logging.Error("[ERR] failed to pick backend: %v", err)
-		h.safeClose(c, ctx)
+	if reason := h.engine.DependencyDown(backendName); reason != "" {
+		logging.Warn("[DEP] backend %s down: %s", backendName, reason)
+		if ctx != nil {
+			ctx.mu.Lock()
+			ctx.reason = StatusDependencyDown
+			ctx.mu.Unlock()
+		}
+		h.failClose(lifetime, c, ctx, l)
 		return
 	}
 
-	// If target has no port (e.g. "10.0.0.103"), assume 1:1 mapping and append listener port
-	if _, _, err := net.SplitHostPort(target); err != nil {
-		// Verify if it's missing port error or something else
-		// "missing port in address" is the typical error
-		target = fmt.Sprintf("%s:%d", target, l.Port)
+	selectTime := h.clock().Since(begin)
+
+	timeouts := h.engine.timeouts(l, backendName)
+	if ctx != nil {
+		go h.watchTimeouts(lifetime, c, ctx, timeouts)
 	}
 
-	// Blocking dial
-	rc, err := net.DialTimeout("tcp", target, tcpDialTimeout)
+	// Dial with retries; every attempt picks a fresh server from the balancer
+	policy := h.engine.retryPolicy(backendName)
+	var rc net.Conn
+	var picked, server string // balancer entry and the address dialed for it
+	var dialTime time.Duration
+	err := policy.Do(lifetime, func(dialCtx context.Context, attempt int) error {
+		start := h.clock().Now()
+		entry, err := h.engine.pick(balancer, backendName, l.Port)
+		selectTime += h.clock().Since(start)
+		if err != nil {
+			logging.Error("[ERR] failed to pick backend: %v", err)
+			return err
+		}
+		trace.event(traceSelected, "backend=%s server=%s attempt=%d", backendName, entry, attempt+1)
+		// Count the attempt against the server right away, so that
+		// concurrent dials see it for leastconn and max_conns.
+		balancer.OnConnect(entry)
+
+		// If target has no port (e.g. "10.0.0.103"), assume 1:1 mapping and append listener port
+		target := entry
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			// Verify if it's missing port error or something else
+			// "missing port in address" is the typical error
+			target = fmt.Sprintf("%s:%d", target, l.Port)
+		}
+
+		if timeouts.connect > 0 {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithTimeout(dialCtx, timeouts.connect)
+			defer cancel()
+		}
+		start = h.clock().Now()
+		conn, err := h.engine.Hosts.DialWith(dialCtx, "tcp", target, h.engine.dialOptions(backendName))
+		dialTime += h.clock().Since(start)
+		if err != nil {
+			trace.event(traceDialed, "server=%s error=%q", target, err.Error())
+			balancer.OnDisconnect(entry)
+			if errors.Is(err, resolver.ErrEgressDenied) {
+				logging.Warn("[EGRESS] refusing connection from %s to %s: %v", c.RemoteAddr(), backendName, err)
+			}
+			if attempt < policy.MaxRetries && lifetime.Err() == nil {
+				logging.Warn("[RETRY] backend connect to %s failed (attempt %d): %v", target, attempt+1, err)
+			}
+			return err
+		}
+		trace.event(traceDialed, "server=%s local=%s", target, conn.LocalAddr())
+		rc = conn
+		picked, server = entry, target
+		return nil
+	})
 	if err != nil {
+		if lifetime.Err() != nil {
+			if ctx != nil {
+				logging.Debug("[CONN] client %s gone, backend dial abandoned", ctx.Client)
+			}
+			return
+		}
 		logging.Error("[ERR] backend connect failed: %v", err)
-		h.safeClose(c, ctx)
+		if ctx != nil {
+			ctx.mu.Lock()
+			ctx.selectTime, ctx.dialTime = selectTime, dialTime
+			ctx.mu.Unlock()
+		}
+		h.failClose(lifetime, c, ctx, l)
 		return
 	}
+	defer balancer.OnDisconnect(picked)
+
+	// Send PROXY header if configured, before any client payload. The
+	// addresses of an accepted PROXY header are passed on.
+	if be, ok := h.engine.backend(backendName); ok && be.SendsProxyV2() {
+		src, dst := c.RemoteAddr(), c.LocalAddr()
+		if ctx != nil && ctx.proxySrc != nil {
+			src, dst = ctx.proxySrc, ctx.proxyDst
+		}
+		if err := h.writeProxyHeader(rc, be, src, dst, h.peerTLVs(ctx, l, be)...); err != nil {
+			logging.Warn("[PROXY] skipping header for %s on backend %s: %v", c.RemoteAddr(), backendName, err)
+		}
+	}
+	if l.TLS != nil {
+		rc = h.terminateTLS(lifetime, rc, ctx, l)
+	}
 
 	ctx.mu.Lock()
 	if ctx.closed {
@@ -168,7 +636,25 @@ func (h *ProxyEventHandler) connectBackend(c gnet.Conn, ctx *ConnContext, l *Lis
 		return
 	}
 	ctx.BackendConn = rc
+	ctx.Backend = server
+	ctx.server = picked
 	ctx.connected = true
+	ctx.selectTime, ctx.dialTime = selectTime, dialTime
+	ctx.connectTime = h.clock().Since(ctx.StartTime)
+	atomic.StoreInt64(&ctx.serverActive, h.clock().Now().UnixNano())
+	if h.engine.Sessions != nil {
+		ctx.SessionID = newSessionID()
+		h.engine.Sessions.Notify(SessionEvent{
+			Type:     SessionOpen,
+			ID:       ctx.SessionID,
+			Time:     h.clock().Now(),
+			Listener: ctx.Listener,
+			Protocol: "tcp",
+			Client:   ctx.Client,
+			Backend:  backendName,
+			Server:   server,
+		})
+	}
 
 	// Flush buffer
 	if len(ctx.buffer) > 0 {
@@ -181,21 +667,50 @@ func (h *ProxyEventHandler) connectBackend(c gnet.Conn, ctx *ConnContext, l *Lis
 			return
 		}
 		ctx.buffer = nil // Clear buffer to free memory
+		ctx.markSent(h.clock())
 	}
 	ctx.mu.Unlock()
 
+	observer, _ := balancer.(lb.LatencyObserver)
+
 	// Start Copy Backend -> Frontend
 	buf := make([]byte, copyBufferSize)
 	for {
 		n, err := rc.Read(buf)
 
 		if n > 0 {
+			atomic.StoreInt64(&ctx.serverActive, h.clock().Now().UnixNano())
+			if atomic.AddInt64(&ctx.bytesOut, int64(n)) == int64(n) {
+				trace.event(traceFirstByte, "bytes=%d", n)
+				// First response bytes: feed time-to-first-byte to the balancer
+				if sent := atomic.LoadInt64(&ctx.firstSent); sent != 0 && observer != nil {
+					observer.ObserveLatency(picked, h.clock().Since(time.Unix(0, sent)))
+				}
+			}
+
+			// Backpressure: stop reading from the backend while the client
+			// has not drained what we already queued.
+			if limit := int64(l.MaxConnBuffer); limit > 0 && !fits(ctx, int64(n), limit) {
+				if !ctx.stalled {
+					ctx.stalled = true
+					h.highWater(ctx, l, backendName, toClient, atomic.LoadInt64(&ctx.pending)+int64(n))
+				}
+				start := h.clock().Now()
+				drained := h.waitForDrain(lifetime, ctx, int64(n), limit)
+				h.engine.counters.stalled(l.Name, backendName, h.clock().Since(start))
+				if !drained {
+					break
+				}
+			}
+			atomic.AddInt64(&ctx.pending, int64(n))
+
 			// Copy data for safe async usage
 			data := make([]byte, n)
 			copy(data, buf[:n])
 
 			// Safe Write: Execute Write only if Context matches
 			errAsync := c.AsyncWrite(nil, func(c gnet.Conn, err error) error {
+				atomic.AddInt64(&ctx.pending, -int64(len(data)))
 				if c.Context() != ctx {
 					return nil // Stale connection, ignore
 				}
@@ -228,6 +743,58 @@ func (h *ProxyEventHandler) connectBackend(c gnet.Conn, ctx *ConnContext, l *Lis
 	ctx.mu.Unlock()
 }
 
+// writeProxyHeader sends a PROXY v2 header honoring the backend's family mismatch policy.
+func (h *ProxyEventHandler) writeProxyHeader(w io.Writer, be *config.Backend, src, dst net.Addr, tlvs ...proxy.TLV) error {
+	mismatch, err := proxy.ParseFamilyMismatch(be.ProxyV2FamilyMismatch)
+	if err != nil {
+		return err
+	}
+	return proxy.WriteProxyHeaderV2Opts(w, src, dst, proxy.Options{Mismatch: mismatch, TLVs: tlvs})
+}
+
+// waitForDrain blocks until n more pending bytes fit under limit, checking
+// every backpressurePoll of the engine clock. It returns false once the
+// connection lifetime ends or the connection was closed while waiting.
+func (h *ProxyEventHandler) waitForDrain(lifetime context.Context, ctx *ConnContext, n, limit int64) bool {
+	timer := h.clock().NewTimer(backpressurePoll)
+	defer timer.Stop()
+	for {
+		if fits(ctx, n, limit) {
+			return true
+		}
+		ctx.mu.Lock()
+		closed := ctx.closed
+		ctx.mu.Unlock()
+		if closed {
+			return false
+		}
+		select {
+		case <-lifetime.Done():
+			return false
+		case <-timer.C():
+			timer.Reset(backpressurePoll)
+		}
+	}
+}
+
+// fits reports whether n more pending bytes fit under limit. A connection
+// with nothing pending takes any read.
+func fits(ctx *ConnContext, n, limit int64) bool {
+	pending := atomic.LoadInt64(&ctx.pending)
+	return pending == 0 || pending+n <= limit
+}
+
+// highWater reports a connection whose buffered bytes reached the
+// max_conn_buffer of its listener.
+func (h *ProxyEventHandler) highWater(ctx *ConnContext, l *ListenerConfig, backend, direction string, buffered int64) {
+	server := ctx.Backend
+	if server == "" {
+		server = "-"
+	}
+	backpressureLog.Infof("high_water listener=%s backend=%s client=%s server=%s direction=%s buffered=%d limit=%d",
+		l.Name, backend, ctx.Client, server, direction, buffered, l.MaxConnBuffer)
+}
+
 // safeClose closes the connection strictly via AsyncWrite to ensure thread safety and context identity.
 func (h *ProxyEventHandler) safeClose(c gnet.Conn, ctx *ConnContext) {
 	_ = c.AsyncWrite(nil, func(c gnet.Conn, err error) error {
@@ -238,6 +805,31 @@ func (h *ProxyEventHandler) safeClose(c gnet.Conn, ctx *ConnContext) {
 	})
 }
 
+// failClose closes a connection no backend could take, sending the
+// listener's error_response first after its delay.
+func (h *ProxyEventHandler) failClose(lifetime context.Context, c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+	if len(l.ErrorResponse) == 0 {
+		h.safeClose(c, ctx)
+		return
+	}
+	if l.ErrorDelay > 0 {
+		timer := h.clock().NewTimer(l.ErrorDelay)
+		defer timer.Stop()
+		select {
+		case <-lifetime.Done():
+			return
+		case <-timer.C():
+		}
+	}
+	// Pending output is flushed before gnet closes the connection
+	_ = c.AsyncWrite(l.ErrorResponse, func(c gnet.Conn, err error) error {
+		if c.Context() != ctx {
+			return nil // Stale
+		}
+		return c.Close()
+	})
+}
+
 // handleTCP handles TCP traffic.
 func (h *ProxyEventHandler) handleTCP(c gnet.Conn, l *ListenerConfig) gnet.Action {
 	val := c.Context()
@@ -258,20 +850,129 @@ func (h *ProxyEventHandler) handleTCP(c gnet.Conn, l *ListenerConfig) gnet.Actio
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
+	if ctx.awaitProxy {
+		var err error
+		if data, err = h.readProxyHeader(ctx, l, data); errors.Is(err, proxy.ErrIncomplete) {
+			return gnet.None
+		} else if errors.Is(err, errRateLimited) {
+			logging.Warn("[RATE] rejecting %s via %s on %s: connection rate limit exceeded", ctx.Client, c.RemoteAddr(), l.Name)
+			ctx.reason = StatusRateLimited
+			return gnet.Close
+		} else if err != nil {
+			logging.Warn("[PROXY] rejecting %s on %s: %v", c.RemoteAddr(), l.Name, err)
+			ctx.reason = StatusProxyError
+			return gnet.Close
+		}
+		if len(data) == 0 {
+			return gnet.None
+		}
+	}
+	if ctx.awaitAuth {
+		var err error
+		if data, err = h.readPreamble(ctx, l, data); errors.Is(err, preauth.ErrIncomplete) {
+			return gnet.None
+		} else if err != nil {
+			logging.Warn("[PREAUTH] rejecting %s on %s: %v", ctx.Client, l.Name, err)
+			ctx.reason = StatusPreauthFail
+			return gnet.Close
+		}
+		if len(data) == 0 {
+			return gnet.None
+		}
+	}
+	if l != nil && l.Knock {
+		return gnet.None // closing already
+	}
+
+	first := atomic.AddInt64(&ctx.bytesIn, int64(len(data))) == int64(len(data))
+	atomic.StoreInt64(&ctx.clientActive, h.clock().Now().UnixNano())
+
+	if l != nil && (l.TLSFingerprint || l.Capture > 0) && (first || ctx.hello != nil) {
+		h.inspect(c, ctx, l, data)
+	}
+	if l != nil && len(ctx.head) < l.Capture {
+		n := min(len(data), l.Capture-len(ctx.head))
+		ctx.head = append(ctx.head, data[:n]...)
+	}
+	if ctx.rejecting {
+		return gnet.Close // the first bytes were all it was held open for
+	}
+
 	if ctx.connected {
 		// Fast path
 		_, err := ctx.BackendConn.Write(data)
 		if err != nil {
 			return gnet.Close
 		}
+		ctx.markSent(h.clock())
 	} else {
-		// Buffer data
+		// Buffer data until the backend is connected, within the ceiling
+		if l != nil && l.MaxConnBuffer > 0 && len(ctx.buffer)+len(data) > l.MaxConnBuffer {
+			logging.Warn("[CONN] %s exceeded buffer ceiling of %d bytes on %s", ctx.Client, l.MaxConnBuffer, l.Name)
+			ctx.reason = StatusMemLimit
+			h.highWater(ctx, l, ctx.backendName, toBackend, int64(len(ctx.buffer)+len(data)))
+			if h.engine != nil {
+				h.engine.counters.overflowed(l.Name, ctx.backendName)
+			}
+			return gnet.Close
+		}
 		ctx.buffer = append(ctx.buffer, data...)
 	}
 
 	return gnet.None
 }
 
+// inspect parses the ClientHello a connection starts with. One fragmented
+// over several reads is buffered up to the listener's HelloMax bytes and
+// HelloTimeout; inspection gives up on it beyond those, or when it does not
+// parse, and the connection goes on uninspected. Forwarding never waits for
+// it. Callers hold ctx.mu.
+func (h *ProxyEventHandler) inspect(c gnet.Conn, ctx *ConnContext, l *ListenerConfig, data []byte) {
+	now := h.clock().Now()
+	if ctx.hello != nil {
+		if now.After(ctx.helloDeadline) {
+			h.helloFailed(c, ctx, l, helloIncomplete)
+			return
+		}
+		ctx.hello = append(ctx.hello, data...)
+		data = ctx.hello
+	}
+
+	ch, err := tlsfp.ParseClientHello(data)
+	switch {
+	case err == nil:
+		ctx.hello = nil
+		if l.TLSFingerprint {
+			ctx.JA3 = ch.JA3()
+			ctx.JA4 = ch.JA4()
+		}
+		if l.Capture > 0 {
+			ctx.SNI = ch.ServerName
+		}
+		ctx.trace.event(traceInspected, "sni=%q ja4=%s", ch.ServerName, ctx.JA4)
+	case errors.Is(err, tlsfp.ErrTruncated) && len(data) > l.HelloMax:
+		h.helloFailed(c, ctx, l, helloOversized)
+	case errors.Is(err, tlsfp.ErrTruncated):
+		if ctx.hello == nil {
+			ctx.hello = append([]byte(nil), data...)
+			ctx.helloDeadline = now.Add(l.HelloTimeout)
+		}
+	case errors.Is(err, tlsfp.ErrMalformed):
+		h.helloFailed(c, ctx, l, helloMalformed)
+	default:
+		ctx.hello = nil // Not TLS
+	}
+}
+
+// helloFailed ends the inspection of a connection's ClientHello.
+func (h *ProxyEventHandler) helloFailed(c gnet.Conn, ctx *ConnContext, l *ListenerConfig, reason string) {
+	ctx.hello = nil
+	logging.Debug("[TLS] %s ClientHello from %s on %s", reason, c.RemoteAddr(), l.Name)
+	if h.engine != nil {
+		h.engine.counters.helloFailed(reason)
+	}
+}
+
 // handleUDP handles UDP traffic.
 func (h *ProxyEventHandler) handleUDP(c gnet.Conn, l *ListenerConfig) gnet.Action {
 	buf, _ := c.Next(-1)
@@ -282,35 +983,50 @@ func (h *ProxyEventHandler) handleUDP(c gnet.Conn, l *ListenerConfig) gnet.Actio
 	remoteAddr := c.RemoteAddr().String()
 
 	// Lookup session
-	var conn *net.UDPConn
+	var conn net.Conn
 	v, ok := h.udpSessions.Load(remoteAddr)
 
 	isNewSession := false
 	if !ok {
+		// Sessions opened before a reload keep their old upstream socket
+		if old, ok := h.engine.siblingSession(h, l.Group, remoteAddr); ok {
+			old.Write(buf)
+			return gnet.None
+		}
+		if h.engine.Draining() {
+			return gnet.None
+		}
+		if !l.limiter.Allow(c.RemoteAddr(), h.clock().Now()) {
+			logging.Warn("[RATE] dropping datagram from %s on %s: session rate limit exceeded", remoteAddr, l.Name)
+			return gnet.None
+		}
 		isNewSession = true
 		// Resolve Backend
-		balancer, ok := h.engine.Balancers[l.DefaultBackend]
+		balancer, ok := h.engine.balancer(l.DefaultBackend)
 		if !ok {
 			return gnet.None
 		}
 		backendName := l.DefaultBackend
-		bkConf, hasBE := h.engine.Backends[backendName]
-
-		target, err := balancer.Next()
-		if err != nil {
+		bkConf, hasBE := h.engine.backend(backendName)
+		if reason := h.engine.DependencyDown(backendName); reason != "" {
+			logging.Warn("[DEP] backend %s down: %s", backendName, reason)
 			return gnet.None
 		}
 
-		raddr, err := net.ResolveUDPAddr("udp", target)
+		target, err := balancer.Next()
 		if err != nil {
 			return gnet.None
 		}
 
-		// Dial dial UDP to backend (creates connected socket)
-		loc, err := net.DialUDP("udp", nil, raddr)
+		// Dial UDP to backend (creates connected socket)
+		loc, err := h.engine.dialUDP(backendName, bkConf, target)
 		if err != nil {
+			if errors.Is(err, resolver.ErrEgressDenied) {
+				logging.Warn("[EGRESS] refusing session from %s on %s: %v", remoteAddr, l.Name, err)
+			}
 			return gnet.None
 		}
+		balancer.OnConnect(target)
 
 		conn = loc
 		h.udpSessions.Store(remoteAddr, conn)
@@ -318,31 +1034,78 @@ func (h *ProxyEventHandler) handleUDP(c gnet.Conn, l *ListenerConfig) gnet.Actio
 		// Start goroutine to copy back from Backend -> Frontend
 		// Note: UDP is stateless, so "Frontend" is `c`.
 		// gnet `c.Write` sends packet to `c.RemoteAddr`.
+		clk := h.clock()
+		idleTimeout := h.engine.timeouts(l, backendName).serverIdle
+		if idleTimeout <= 0 {
+			idleTimeout = defaultUDPIdleTimeout
+		}
+		session := SessionEvent{
+			Listener: l.Name,
+			Protocol: "udp",
+			Client:   remoteAddr,
+			Backend:  backendName,
+			Server:   target,
+		}
+		if h.engine.Sessions != nil {
+			session.ID = newSessionID()
+			open := session
+			open.Type, open.Time = SessionOpen, clk.Now()
+			h.engine.Sessions.Notify(open)
+		}
 		go func() {
+			defer balancer.OnDisconnect(target)
 			defer conn.Close()
 			defer h.udpSessions.Delete(remoteAddr)
 
-			b := make([]byte, udpBufferSize)
-			// Read timeout for auto-cleanup
-			conn.SetReadDeadline(time.Now().Add(udpReadTimeout))
+			// Idle expiry for auto-cleanup: close the socket once the backend
+			// has been silent for server_idle, which unblocks the read below.
+			idle := clk.NewTimer(idleTimeout)
+			done := make(chan struct{})
+			var expired atomic.Bool
+			defer close(done)
+			go func() {
+				select {
+				case <-idle.C():
+					expired.Store(true)
+					conn.Close()
+				case <-done:
+					idle.Stop()
+				}
+			}()
+			if h.engine.Sessions != nil {
+				start := clk.Now()
+				defer func() {
+					closed := session
+					closed.Type, closed.Time = SessionClose, clk.Now()
+					closed.Duration = clk.Since(start).Seconds()
+					closed.Status = StatusOK
+					if expired.Load() {
+						closed.Status = StatusTimeout
+					}
+					h.engine.Sessions.Notify(closed)
+				}()
+			}
 
+			b := make([]byte, udpBufferSize)
 			for {
-				n, _, err := conn.ReadFromUDP(b)
+				n, err := conn.Read(b)
 				if err != nil {
 					break
 				}
 				// Write back to client
 				c.Write(b[:n])
-				conn.SetReadDeadline(time.Now().Add(udpReadTimeout))
+				idle.Reset(idleTimeout)
 			}
 		}()
 
 		// Send PROXY header if configured
-		if hasBE && bkConf != nil && bkConf.SendProxyV2 && isNewSession {
-			_ = proxy.WriteProxyHeaderV2(conn, c.RemoteAddr(), c.LocalAddr())
+		if hasBE && bkConf != nil && bkConf.SendsProxyV2() && isNewSession {
+			if err := h.writeProxyHeader(conn, bkConf, c.RemoteAddr(), c.LocalAddr(), h.peerTLVs(nil, l, bkConf)...); err != nil {
+				logging.Warn("[PROXY] skipping header for %s on backend %s: %v", remoteAddr, backendName, err)
+			}
 		}
 	} else {
-		conn = v.(*net.UDPConn)
+		conn = v.(net.Conn)
 	}
 
 	// Forward the payload
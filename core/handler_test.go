@@ -1,11 +1,17 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"nvelox/config"
+	"nvelox/core/clock"
 	"nvelox/core/logging"
+	"nvelox/core/retry"
 	"nvelox/lb"
 
 	"github.com/panjf2000/gnet/v2"
@@ -15,6 +21,9 @@ func init() {
 	logging.Init("debug", "", "")
 }
 
+// mockLoop is the event loop of every MockGnetConn.
+var mockLoop = &fakeLoop{}
+
 // MockGnetConn stubs gnet.Conn
 type MockGnetConn struct {
 	gnet.Conn
@@ -28,6 +37,7 @@ func (m *MockGnetConn) Context() interface{}       { return m.ctx }
 func (m *MockGnetConn) SetContext(ctx interface{}) { m.ctx = ctx }
 func (m *MockGnetConn) LocalAddr() net.Addr        { return m.localAddr }
 func (m *MockGnetConn) RemoteAddr() net.Addr       { return m.remoteAddr }
+func (m *MockGnetConn) EventLoop() gnet.EventLoop  { return mockLoop }
 func (m *MockGnetConn) Next(n int) ([]byte, error) {
 	// For testing handleTCP, we assume some data is available
 	return []byte("test-data"), nil
@@ -138,7 +148,7 @@ func TestHandler_connectBackend_Failures(t *testing.T) {
 	conn := &MockGnetConn{} // Should check if it gets closed
 
 	// 1. Backend not found
-	h.connectBackend(conn, nil, l)
+	h.connectBackend(context.Background(), conn, nil, l)
 	// We can't easily assert Close was called MockGnetConn doesn't track it well without mocking Close.
 	// But it shouldn't panic.
 
@@ -156,6 +166,7 @@ type MockBalancerError struct{ lb.Balancer }
 func (m *MockBalancerError) Next() (string, error) { return "", errors.New("fail") }
 
 func (m *MockGnetConn) AsyncWrite(b []byte, cb gnet.AsyncCallback) error {
+	m.outBuf = append(m.outBuf, b...)
 	// execute callback immediately
 	if cb != nil {
 		return cb(m, nil)
@@ -194,3 +205,265 @@ func TestHandler_OnOpen(t *testing.T) {
 		t.Error("OnOpen failed to set context")
 	}
 }
+
+func TestHandler_CaptureOnReject(t *testing.T) {
+	eng := &Engine{Balancers: make(map[string]lb.Balancer)}
+	eng.draining.Store(true)
+	l := &ListenerConfig{Name: "test", Port: 8080, ListenerOptions: ListenerOptions{Capture: 4, CaptureWait: time.Minute}}
+	h := &ProxyEventHandler{engine: eng, listenerMap: map[string]*ListenerConfig{"tcp:8080": l}}
+	conn := &MockGnetConn{
+		localAddr:  &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080},
+		remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234},
+	}
+
+	// Held open for its first bytes instead of closed at once
+	if _, action := h.OnOpen(conn); action != gnet.None {
+		t.Fatalf("OnOpen action = %v, want None while capturing", action)
+	}
+	ctx := conn.ctx.(*ConnContext)
+	defer ctx.cancel()
+	if ctx.reason != StatusDraining || !ctx.rejecting {
+		t.Fatalf("connection not marked rejected: reason %q", ctx.reason)
+	}
+
+	if action := h.handleTCP(conn, l); action != gnet.Close {
+		t.Errorf("handleTCP action = %v, want Close once the bytes are in", action)
+	}
+	if string(ctx.head) != "test" {
+		t.Errorf("captured %q, want the first 4 bytes", ctx.head)
+	}
+	if len(ctx.buffer) != 0 {
+		t.Error("rejected connection data was buffered for a backend")
+	}
+	if !rejected(ctx.reason) || rejected(StatusOK) {
+		t.Error("rejected() misclassifies statuses")
+	}
+
+	// Without capture_on_reject the connection is closed right away
+	l.Capture = 0
+	if _, action := h.OnOpen(&MockGnetConn{localAddr: conn.localAddr, remoteAddr: conn.remoteAddr}); action != gnet.Close {
+		t.Errorf("OnOpen action = %v, want Close", action)
+	}
+}
+
+// clientHello returns a minimal TLS 1.2 ClientHello record with a body of
+// its own: version, random, session id, cipher suites and compression.
+func clientHello(body []byte) []byte {
+	if body == nil {
+		body = append([]byte{0x03, 0x03}, make([]byte, 32)...)
+		body = append(body, 0x00, 0x00, 0x02, 0x13, 0x01, 0x01, 0x00)
+	}
+	hs := append([]byte{0x01, 0x00, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{0x16, 0x03, 0x01, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func TestHandler_inspect(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	eng := NewEngine(&config.Config{})
+	eng.Clock = clk
+	h := &ProxyEventHandler{engine: eng}
+	l := &ListenerConfig{Name: "tls", ListenerOptions: ListenerOptions{TLSFingerprint: true, HelloMax: 64, HelloTimeout: time.Second}}
+	conn := &MockGnetConn{remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234}}
+	hello := clientHello(nil)
+
+	// Fragmented over two reads
+	ctx := &ConnContext{}
+	h.inspect(conn, ctx, l, hello[:20])
+	if ctx.hello == nil || ctx.JA3 != "" {
+		t.Fatal("incomplete ClientHello not buffered")
+	}
+	h.inspect(conn, ctx, l, hello[20:])
+	if ctx.hello != nil || ctx.JA3 == "" || ctx.JA4 == "" {
+		t.Errorf("reassembled ClientHello not fingerprinted: %+v", ctx)
+	}
+
+	// Given up on past the timeout
+	ctx = &ConnContext{}
+	h.inspect(conn, ctx, l, hello[:20])
+	clk.Advance(2 * time.Second)
+	h.inspect(conn, ctx, l, hello[20:])
+	if ctx.hello != nil || ctx.JA3 != "" {
+		t.Error("ClientHello completed after the timeout was inspected")
+	}
+
+	// Larger than max_bytes
+	ctx = &ConnContext{}
+	big := append([]byte{0x16, 0x03, 0x01, 0x01, 0x00, 0x01}, make([]byte, 99)...)
+	h.inspect(conn, ctx, l, big)
+	if ctx.hello != nil {
+		t.Error("oversized ClientHello buffered")
+	}
+
+	h.inspect(conn, &ConnContext{}, l, clientHello([]byte{0x03, 0x03}))
+	h.inspect(conn, &ConnContext{}, l, []byte("GET / HTTP/1.1\r\n"))
+
+	want := HelloStats{Malformed: 1, Oversized: 1, Incomplete: 1}
+	if got := eng.Stats().Hellos; got != want {
+		t.Errorf("hello stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandler_handleTCP_BufferCeiling(t *testing.T) {
+	eng := NewEngine(&config.Config{})
+	h := &ProxyEventHandler{engine: eng}
+	ctx := &ConnContext{
+		buffer:      []byte("0123456789"),
+		backendName: "be",
+	}
+	conn := &MockGnetConn{
+		ctx: ctx,
+	}
+	l := &ListenerConfig{Name: "test", ListenerOptions: ListenerOptions{MaxConnBuffer: 12}}
+
+	// 10 buffered + 9 new bytes exceeds the 12 byte ceiling
+	action := h.handleTCP(conn, l)
+	if action != gnet.Close {
+		t.Errorf("expected Close, got %v", action)
+	}
+	if ctx.reason != StatusMemLimit {
+		t.Errorf("expected reason %s, got %q", StatusMemLimit, ctx.reason)
+	}
+	if got := eng.Stats().Backpressure["test"]["be"]; got.Overflows != 1 {
+		t.Errorf("backpressure = %+v, want 1 overflow", got)
+	}
+}
+
+func TestHandler_topBuffered(t *testing.T) {
+	h := &ProxyEventHandler{}
+	small := &ConnContext{Client: "small", buffer: make([]byte, 10)}
+	large := &ConnContext{Client: "large", buffer: make([]byte, 100), pending: 50}
+	h.conns.Store(small, struct{}{})
+	h.conns.Store(large, struct{}{})
+
+	top := h.topBuffered(1)
+	if len(top) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(top))
+	}
+	if top[0].Client != "large" || top[0].Buffered != 150 {
+		t.Errorf("unexpected top consumer: %+v", top[0])
+	}
+}
+
+func TestHandler_waitForDrain(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	h := &ProxyEventHandler{engine: &Engine{Clock: fake}}
+	ctx := &ConnContext{pending: 10}
+
+	// The wait follows the engine clock until the pending bytes drain
+	done := make(chan bool, 1)
+	go func() { done <- h.waitForDrain(context.Background(), ctx, 5, 12) }()
+	waitFor(t, func() bool { return fake.Waiters() > 0 })
+	atomic.StoreInt64(&ctx.pending, 0)
+	fake.Advance(backpressurePoll)
+	if drained := <-done; !drained {
+		t.Error("expected the wait to end drained")
+	}
+
+	// Closing the connection ends the wait without the clock moving
+	atomic.StoreInt64(&ctx.pending, 10)
+	lifetime, cancel := context.WithCancel(context.Background())
+	go func() { done <- h.waitForDrain(lifetime, ctx, 5, 12) }()
+	waitFor(t, func() bool { return fake.Waiters() > 0 })
+	cancel()
+	select {
+	case drained := <-done:
+		if drained {
+			t.Error("expected the wait to fail on close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not end when the connection closed")
+	}
+}
+
+func TestHandler_connectBackend_ClientGone(t *testing.T) {
+	eng := NewEngine(&config.Config{})
+	eng.Balancers["be"] = lb.NewBalancer("roundrobin", []string{"127.0.0.1:1"})
+	policy, err := retry.NewPolicy(config.RetryConfig{MaxRetries: 5, BaseBackoff: "10s", MaxBackoff: "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Retries["be"] = policy
+	h := &ProxyEventHandler{engine: eng}
+	conn := &MockGnetConn{remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234}}
+
+	lifetime, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.connectBackend(lifetime, conn, &ConnContext{}, &ListenerConfig{DefaultBackend: "be"})
+		close(done)
+	}()
+
+	// The first dial is refused, so connectBackend is now waiting to retry
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("connectBackend kept retrying after the client closed")
+	}
+}
+
+func TestHandler_connectBackend_ErrorResponse(t *testing.T) {
+	eng := NewEngine(&config.Config{})
+	eng.Balancers["be"] = lb.NewBalancer("roundrobin", []string{"127.0.0.1:1"})
+	h := &ProxyEventHandler{engine: eng}
+	ctx := &ConnContext{}
+	conn := &MockGnetConn{ctx: ctx, remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234}}
+	l := &ListenerConfig{DefaultBackend: "be", ListenerOptions: ListenerOptions{ErrorResponse: []byte("421 busy\r\n")}}
+
+	h.connectBackend(context.Background(), conn, ctx, l)
+	if string(conn.outBuf) != "421 busy\r\n" {
+		t.Errorf("client got %q, want the error response", conn.outBuf)
+	}
+
+	// A client gone during the delay gets nothing
+	conn.outBuf = nil
+	l.ErrorDelay = time.Minute
+	lifetime, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.failClose(lifetime, conn, ctx, l)
+	if len(conn.outBuf) != 0 {
+		t.Errorf("closed client got %q", conn.outBuf)
+	}
+}
+
+func TestHandler_connectBackend_Timings(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	eng := NewEngine(&config.Config{})
+	// The first dial is refused, the retry reaches the listener
+	eng.Balancers["be"] = lb.NewBalancer("roundrobin", []string{"127.0.0.1:1", ln.Addr().String()})
+	policy, err := retry.NewPolicy(config.RetryConfig{MaxRetries: 1, BaseBackoff: "20ms", MaxBackoff: "20ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Retries["be"] = policy
+	h := &ProxyEventHandler{engine: eng}
+	conn := &MockGnetConn{remoteAddr: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 1234}}
+	ctx := &ConnContext{StartTime: time.Now()}
+
+	h.connectBackend(context.Background(), conn, ctx, &ListenerConfig{DefaultBackend: "be"})
+
+	if !ctx.connected {
+		t.Fatal("expected the retry to connect")
+	}
+	if ctx.dialTime <= 0 {
+		t.Errorf("dial time = %v, want > 0", ctx.dialTime)
+	}
+	if ctx.connectTime < ctx.selectTime+ctx.dialTime {
+		t.Errorf("connect time %v is shorter than select %v + dial %v", ctx.connectTime, ctx.selectTime, ctx.dialTime)
+	}
+}
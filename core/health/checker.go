@@ -1,13 +1,29 @@
 package health
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"nvelox/config"
+	"nvelox/core/clock"
 	"nvelox/core/logging"
+	"nvelox/core/resolver"
+	"nvelox/proxy"
+)
+
+const (
+	// maxConcurrentProbes bounds the probes in flight, which matters once
+	// port ranges multiply the targets.
+	maxConcurrentProbes = 64
+	// stallSlack is how late a check may report progress beyond the time
+	// its interval and probe timeouts allow before it counts as stuck.
+	stallSlack = 10 * time.Second
 )
 
 // Checker manages health checks for a backend pool.
@@ -16,12 +32,33 @@ type Checker struct {
 	Backend *config.Backend
 
 	// Status map: server_ip -> is_healthy
-	mu     sync.Mutex
-	status map[string]bool
+	mu      sync.Mutex
+	status  map[string]bool
+	history map[string]*record
+	ports   map[string]map[int]bool // server -> port -> healthy, for servers without a port
 
 	OnStatusChange func(server string, healthy bool)
 
-	stopCh chan struct{}
+	// Ports returns the listener ports routed to the backend. A server
+	// given without a port is dialed on the port the client connected to,
+	// so it is probed on each of them; it counts as up while any port is.
+	Ports func() []int
+
+	// Skip reports servers not to probe for now, such as those in
+	// maintenance; nil probes every server that is not disabled.
+	Skip func(server string) bool
+
+	// Hosts overrides name resolution for probes; nil uses DNS.
+	Hosts *resolver.Hosts
+	// Clock drives the check interval; tests may swap in a fake clock.
+	Clock clock.Clock
+
+	stopCh  chan struct{}
+	checked chan struct{}
+	once    sync.Once
+	// due is when the check loop next reports progress, in unix
+	// nanoseconds by Clock, or 0 while it does not run; see Stalled.
+	due atomic.Int64
 }
 
 func NewChecker(cfg config.HealthCheckConfig, backend *config.Backend) *Checker {
@@ -29,18 +66,80 @@ func NewChecker(cfg config.HealthCheckConfig, backend *config.Backend) *Checker
 		Config:  cfg,
 		Backend: backend,
 		status:  make(map[string]bool),
+		history: make(map[string]*record),
+		ports:   make(map[string]map[int]bool),
 		stopCh:  make(chan struct{}),
+		checked: make(chan struct{}),
+		Clock:   clock.Real(),
+	}
+}
+
+// Status returns a snapshot of the last known health of each probed server.
+// Servers that have not been probed yet are absent.
+func (c *Checker) Status() map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]bool, len(c.status))
+	for k, v := range c.status {
+		out[k] = v
+	}
+	return out
+}
+
+// PortDown reports whether the last probe of a server without a port of its
+// own failed on port.
+func (c *Checker) PortDown(server string, port int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	healthy, probed := c.ports[server][port]
+	return probed && !healthy
+}
+
+// PortsDown returns the ports each server without a port of its own failed
+// its last probe on, sorted.
+func (c *Checker) PortsDown() map[string][]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string][]int)
+	for server, ports := range c.ports {
+		for port, healthy := range ports {
+			if !healthy {
+				out[server] = append(out[server], port)
+			}
+		}
+		sort.Ints(out[server])
+	}
+	return out
+}
+
+// History returns the transition history of each probed server.
+func (c *Checker) History() map[string]History {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.Clock.Now()
+	out := make(map[string]History, len(c.history))
+	for k, r := range c.history {
+		out[k] = r.history(now)
 	}
+	return out
+}
+
+// Checked is closed once every server has been probed for the first time,
+// right at Start without active checks.
+func (c *Checker) Checked() <-chan struct{} {
+	return c.checked
 }
 
 func (c *Checker) Start() {
 	if c.Config.Active.Interval == "" {
+		c.once.Do(func() { close(c.checked) })
 		return // No active checks
 	}
 
 	interval, err := time.ParseDuration(c.Config.Active.Interval)
 	if err != nil {
 		logging.Error("[Health] Invalid interval %s: %v", c.Config.Active.Interval, err)
+		c.once.Do(func() { close(c.checked) })
 		return
 	}
 
@@ -51,41 +150,141 @@ func (c *Checker) Stop() {
 	close(c.stopCh)
 }
 
+// Stalled reports whether the active check stopped making progress: a round
+// of probes runs longer than its timeouts allow, or none starts for longer
+// than the interval.
+func (c *Checker) Stalled() bool {
+	due := c.due.Load()
+	return due != 0 && c.Clock.Now().UnixNano() > due
+}
+
+// expect records that the check loop reports progress again within d.
+func (c *Checker) expect(d time.Duration) {
+	c.due.Store(c.Clock.Now().Add(d + stallSlack).UnixNano())
+}
+
 func (c *Checker) loop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
+	ticker := c.Clock.NewTicker(interval)
 	defer ticker.Stop()
+	defer c.due.Store(0)
 
 	logging.Info("[Health] Started active check for %s every %v", c.Backend.Name, interval)
 
+	c.expect(interval)
 	for {
 		select {
 		case <-c.stopCh:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			c.checkAll()
+			c.expect(interval)
+		}
+	}
+}
+
+// target is one address probed for a server.
+type target struct {
+	server string
+	addr   string
+	port   int // the listener port, 0 when the server has its own
+}
+
+// targets lists the addresses to probe: the server itself, or the server on
+// every routed port when it has no port of its own.
+func (c *Checker) targets() []target {
+	var ports []int
+	if c.Ports != nil {
+		ports = c.Ports()
+	}
+	out := make([]target, 0, len(c.Backend.Servers))
+	for _, srv := range c.Backend.Servers {
+		if srv.Disabled || c.Skip != nil && c.Skip(srv.Address) {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(srv.Address); err == nil || len(ports) == 0 {
+			out = append(out, target{server: srv.Address, addr: srv.Address})
+			continue
+		}
+		for _, port := range ports {
+			out = append(out, target{server: srv.Address, addr: fmt.Sprintf("%s:%d", srv.Address, port), port: port})
 		}
 	}
+	return out
 }
 
 func (c *Checker) checkAll() {
+	targets := c.targets()
+	rounds := (len(targets) + maxConcurrentProbes - 1) / maxConcurrentProbes
+	c.expect(time.Duration(rounds) * c.timeout())
+	results := make([]bool, len(targets))
+	sem := make(chan struct{}, maxConcurrentProbes)
 	var wg sync.WaitGroup
-	for _, srv := range c.Backend.Servers {
+	for i, t := range targets {
 		wg.Add(1)
-		go func(addr string) {
+		go func() {
 			defer wg.Done()
-			healthy := c.probe(addr)
-			c.updateStatus(addr, healthy)
-		}(srv)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = c.probe(t.addr)
+		}()
 	}
 	wg.Wait()
+
+	// A server probed per port is up while any of its ports is
+	servers := make([]string, 0, len(targets))
+	up := make(map[string]bool)
+	ports := make(map[string]map[int]bool)
+	for i, t := range targets {
+		if _, seen := up[t.server]; !seen {
+			servers = append(servers, t.server)
+		}
+		up[t.server] = up[t.server] || results[i]
+		if t.port != 0 {
+			if ports[t.server] == nil {
+				ports[t.server] = make(map[int]bool)
+			}
+			ports[t.server][t.port] = results[i]
+		}
+	}
+	c.updatePorts(ports)
+	for _, server := range servers {
+		c.updateStatus(server, up[server])
+	}
+	c.once.Do(func() { close(c.checked) })
 }
 
-func (c *Checker) probe(addr string) bool {
+// updatePorts records the per-port results of a round, logging ports that
+// went down or came back.
+func (c *Checker) updatePorts(ports map[string]map[int]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for server, byPort := range ports {
+		for port, healthy := range byPort {
+			old, known := c.ports[server][port]
+			if known && old == healthy || !known && healthy {
+				continue
+			}
+			statusStr := "DOWN"
+			if healthy {
+				statusStr = "UP"
+			}
+			logging.Info("[Health] Server %s/%s:%d is now %s", c.Backend.Name, server, port, statusStr)
+		}
+	}
+	c.ports = ports
+}
+
+// timeout returns the time a probe may take.
+func (c *Checker) timeout() time.Duration {
 	timeout, _ := time.ParseDuration(c.Config.Active.Timeout)
 	if timeout == 0 {
 		timeout = 1 * time.Second
 	}
+	return timeout
+}
 
+func (c *Checker) probe(addr string) bool {
+	timeout := c.timeout()
 	switch c.Config.Active.Type {
 	case "http":
 		return c.checkHTTP(addr, timeout)
@@ -95,7 +294,9 @@ func (c *Checker) probe(addr string) bool {
 }
 
 func (c *Checker) checkTCP(addr string, timeout time.Duration) bool {
-	conn, err := net.DialTimeout("tcp", addr, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := c.dial(ctx, "tcp", addr)
 	if err != nil {
 		return false
 	}
@@ -103,8 +304,27 @@ func (c *Checker) checkTCP(addr string, timeout time.Duration) bool {
 	return true
 }
 
+// dial connects to a server for a probe. Backends expecting PROXY v2 get a
+// LOCAL header first so strict receivers accept the health check connection.
+func (c *Checker) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := c.Hosts.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.Backend != nil && c.Backend.SendsProxyV2() {
+		if err := proxy.WriteLocalHeaderV2(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
 func (c *Checker) checkHTTP(addr string, timeout time.Duration) bool {
-	client := http.Client{Timeout: timeout}
+	client := http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: c.dial, DisableKeepAlives: true},
+	}
 	// Assuming HTTP for now. Config needs to specify scheme if HTTPS backend.
 	// But our backend list is just "IP:port", usually HTTP.
 	url := "http://" + addr + c.Config.Active.Path
@@ -129,6 +349,11 @@ func (c *Checker) updateStatus(addr string, healthy bool) {
 		}
 		logging.Info("[Health] Server %s/%s is now %s", c.Backend.Name, addr, statusStr)
 		c.status[addr] = healthy
+		if r, ok := c.history[addr]; ok {
+			r.transition(healthy, c.Clock.Now())
+		} else {
+			c.history[addr] = newRecord(healthy, c.Clock.Now())
+		}
 
 		if c.OnStatusChange != nil {
 			c.OnStatusChange(addr, healthy)
@@ -2,12 +2,15 @@ package health
 
 import (
 	"context"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
 	"nvelox/config"
+	"nvelox/core/clock"
 	"nvelox/core/logging"
 )
 
@@ -118,7 +121,7 @@ func TestLifecycle(t *testing.T) {
 
 	backend := &config.Backend{
 		Name:    "test-backend",
-		Servers: []string{addr},
+		Servers: []config.Server{{Address: addr}},
 	}
 
 	chkConfig := config.HealthCheckConfig{
@@ -158,3 +161,198 @@ func TestLifecycle(t *testing.T) {
 		t.Error("expected server to be marked healthy in map")
 	}
 }
+
+func TestLifecycle_FakeClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := mockTCPServer(t, ctx)
+
+	backend := &config.Backend{
+		Name:    "test-backend",
+		Servers: []config.Server{{Address: addr}},
+	}
+	checker := NewChecker(config.HealthCheckConfig{
+		Active: config.ActiveHealthCheck{
+			Type:     "tcp",
+			Interval: "1h",
+			Timeout:  "100ms",
+		},
+	}, backend)
+
+	fake := clock.NewFake(time.Now())
+	checker.Clock = fake
+
+	statusCh := make(chan struct{})
+	checker.OnStatusChange = func(server string, healthy bool) {
+		close(statusCh)
+	}
+
+	checker.Start()
+	defer checker.Stop()
+
+	// Wait for the loop to arm its ticker, then jump a full interval
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-checker.Checked():
+		t.Fatal("Checked closed before the first pass")
+	default:
+	}
+	fake.Advance(time.Hour)
+
+	select {
+	case <-statusCh:
+	case <-time.After(time.Second):
+		t.Fatal("health check did not run after advancing the clock")
+	}
+	select {
+	case <-checker.Checked():
+	case <-time.After(time.Second):
+		t.Fatal("Checked not closed after the first pass")
+	}
+}
+
+func TestStalled(t *testing.T) {
+	backend := &config.Backend{Name: "test-backend", Servers: []config.Server{{Address: "127.0.0.1:1"}}}
+	checker := NewChecker(config.HealthCheckConfig{
+		Active: config.ActiveHealthCheck{Type: "tcp", Interval: "1m", Timeout: "100ms"},
+	}, backend)
+	fake := clock.NewFake(time.Now())
+	checker.Clock = fake
+	// A pass hangs in Skip until released
+	entered, release := make(chan struct{}), make(chan struct{})
+	checker.Skip = func(string) bool {
+		close(entered)
+		<-release
+		return true
+	}
+	if checker.Stalled() {
+		t.Fatal("Stalled before Start")
+	}
+
+	checker.Start()
+	defer checker.Stop()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fake.Advance(time.Minute)
+	<-entered
+	if checker.Stalled() {
+		t.Fatal("Stalled within the interval")
+	}
+	fake.Advance(stallSlack + time.Second)
+	if !checker.Stalled() {
+		t.Fatal("not Stalled with a pass hanging")
+	}
+
+	close(release)
+	select {
+	case <-checker.Checked():
+	case <-time.After(time.Second):
+		t.Fatal("pass did not finish")
+	}
+	for deadline := time.Now().Add(time.Second); checker.Stalled(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("still Stalled after the pass finished")
+		}
+	}
+}
+
+func TestCheckTCP_SendsLocalHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	got := make(chan []byte, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 16)
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := io.ReadFull(c, buf)
+		got <- buf[:n]
+	}()
+
+	send := true
+	checker := NewChecker(config.HealthCheckConfig{}, &config.Backend{Name: "pp", SendProxyV2: &send})
+	if !checker.checkTCP(l.Addr().String(), time.Second) {
+		t.Fatal("checkTCP failed")
+	}
+
+	select {
+	case header := <-got:
+		if len(header) != 16 || header[12] != 0x20 {
+			t.Errorf("expected PROXY v2 LOCAL header, got %x", header)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for header")
+	}
+}
+
+func TestCheckAll_PerPort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, open, _ := net.SplitHostPort(mockTCPServer(t, ctx))
+	openPort, _ := strconv.Atoi(open)
+	closedPort := 1
+
+	backend := &config.Backend{
+		Name:    "range",
+		Servers: []config.Server{{Address: "127.0.0.1"}},
+	}
+	checker := NewChecker(config.HealthCheckConfig{
+		Active: config.ActiveHealthCheck{Type: "tcp", Timeout: "100ms"},
+	}, backend)
+	checker.Ports = func() []int { return []int{closedPort, openPort} }
+	checker.checkAll()
+
+	if !checker.Status()["127.0.0.1"] {
+		t.Error("expected server up while one of its ports is")
+	}
+	if checker.PortDown("127.0.0.1", openPort) {
+		t.Errorf("port %d is open", openPort)
+	}
+	if !checker.PortDown("127.0.0.1", closedPort) {
+		t.Errorf("expected port %d down", closedPort)
+	}
+	if down := checker.PortsDown()["127.0.0.1"]; len(down) != 1 || down[0] != closedPort {
+		t.Errorf("expected ports down [%d], got %v", closedPort, down)
+	}
+
+	// Without routed ports the bare host keeps a single status
+	checker.Ports = func() []int { return nil }
+	checker.checkAll()
+	if checker.PortDown("127.0.0.1", closedPort) {
+		t.Error("expected no per-port status once no ports are routed")
+	}
+}
+
+func TestCheckAll_Skip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := mockTCPServer(t, ctx)
+
+	backend := &config.Backend{
+		Name:    "web",
+		Servers: []config.Server{{Address: addr}, {Address: "127.0.0.1:1"}},
+	}
+	checker := NewChecker(config.HealthCheckConfig{
+		Active: config.ActiveHealthCheck{Type: "tcp", Timeout: "100ms"},
+	}, backend)
+	checker.Skip = func(server string) bool { return server == "127.0.0.1:1" }
+	checker.checkAll()
+
+	status := checker.Status()
+	if !status[addr] {
+		t.Errorf("expected %s up", addr)
+	}
+	if _, probed := status["127.0.0.1:1"]; probed {
+		t.Error("skipped server probed")
+	}
+}
@@ -0,0 +1,74 @@
+package health
+
+import "time"
+
+// History summarizes the health transitions of a server since its first
+// probe, from the proxy's point of view.
+type History struct {
+	Healthy    bool
+	Since      time.Time     // last transition, or the first probe
+	InState    time.Duration // time since Since
+	Failures   int           // transitions to down; a failed first probe counts
+	Recoveries int           // transitions back to up
+	Downtime   time.Duration // total time down, an ongoing outage included
+	Uptime     time.Duration // total time up
+	MTTR       time.Duration // mean length of ended outages, 0 before the first recovery
+	MTBF       time.Duration // uptime per failure, 0 before the first failure
+}
+
+// record accumulates the transitions of one server.
+type record struct {
+	healthy    bool
+	since      time.Time
+	failures   int
+	recoveries int
+	downEnded  time.Duration // length of the outages that ended
+	upEnded    time.Duration // length of the up periods that ended
+}
+
+func newRecord(healthy bool, now time.Time) *record {
+	r := &record{healthy: healthy, since: now}
+	if !healthy {
+		r.failures = 1
+	}
+	return r
+}
+
+func (r *record) transition(healthy bool, now time.Time) {
+	if healthy == r.healthy {
+		return
+	}
+	if healthy {
+		r.downEnded += now.Sub(r.since)
+		r.recoveries++
+	} else {
+		r.upEnded += now.Sub(r.since)
+		r.failures++
+	}
+	r.healthy = healthy
+	r.since = now
+}
+
+func (r *record) history(now time.Time) History {
+	h := History{
+		Healthy:    r.healthy,
+		Since:      r.since,
+		InState:    now.Sub(r.since),
+		Failures:   r.failures,
+		Recoveries: r.recoveries,
+		Downtime:   r.downEnded,
+		Uptime:     r.upEnded,
+	}
+	if r.healthy {
+		h.Uptime += h.InState
+	} else {
+		h.Downtime += h.InState
+	}
+	if r.recoveries > 0 {
+		h.MTTR = r.downEnded / time.Duration(r.recoveries)
+	}
+	if r.failures > 0 {
+		h.MTBF = h.Uptime / time.Duration(r.failures)
+	}
+	return h
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+func TestChecker_History(t *testing.T) {
+	start := time.Unix(1000, 0)
+	fake := clock.NewFake(start)
+	checker := NewChecker(config.HealthCheckConfig{}, &config.Backend{Name: "be"})
+	checker.Clock = fake
+
+	checker.updateStatus("s1", true)
+	fake.Advance(10 * time.Minute)
+	checker.updateStatus("s1", false)
+	fake.Advance(2 * time.Minute)
+	checker.updateStatus("s1", false) // no transition
+	checker.updateStatus("s1", true)
+	fake.Advance(8 * time.Minute)
+	checker.updateStatus("s1", false)
+	fake.Advance(time.Minute)
+
+	h := checker.History()["s1"]
+	want := History{
+		Healthy:    false,
+		Since:      start.Add(20 * time.Minute),
+		InState:    time.Minute,
+		Failures:   2,
+		Recoveries: 1,
+		Downtime:   3 * time.Minute,
+		Uptime:     18 * time.Minute,
+		MTTR:       2 * time.Minute,
+		MTBF:       9 * time.Minute,
+	}
+	if h != want {
+		t.Errorf("history = %+v\nwant %+v", h, want)
+	}
+}
+
+func TestChecker_History_DownFromStart(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1000, 0))
+	checker := NewChecker(config.HealthCheckConfig{}, &config.Backend{Name: "be"})
+	checker.Clock = fake
+
+	checker.updateStatus("s1", false)
+	fake.Advance(time.Minute)
+
+	h := checker.History()["s1"]
+	if h.Failures != 1 || h.Downtime != time.Minute || h.MTTR != 0 || h.MTBF != 0 {
+		t.Errorf("history = %+v", h)
+	}
+	if _, ok := checker.History()["s2"]; ok {
+		t.Error("unprobed server has a history")
+	}
+}
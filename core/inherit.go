@@ -0,0 +1,173 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"nvelox/core/logging"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// adopter serves a listener group on sockets inherited from the process this
+// one replaces. Binding the ports again may not be possible once privileges
+// are dropped, so connections are accepted on the inherited sockets and
+// enrolled into the event loops of a gnet client.
+type adopter struct {
+	client  *gnet.Client
+	sockets []net.Listener
+}
+
+// inherit takes the inherited sockets of a group, which is adopted only when
+// every listener of it is a TCP one with a socket passed for its address.
+func (e *Engine) inherit(listeners []*ListenerConfig) []net.Listener {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, l := range listeners {
+		if l.Protocol == "udp" || e.Inherited[inheritKey(l)] == nil {
+			return nil
+		}
+	}
+	sockets := make([]net.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		f := e.Inherited[inheritKey(l)]
+		delete(e.Inherited, inheritKey(l))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			logging.Warn("[UPGRADE] listener %s: inherited socket: %v", l.Name, err)
+			for _, ln := range sockets {
+				ln.Close()
+			}
+			return nil
+		}
+		sockets = append(sockets, ln)
+	}
+	return sockets
+}
+
+// closeInherited closes the inherited sockets no listener group took.
+func (e *Engine) closeInherited() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for addr, f := range e.Inherited {
+		logging.Info("[UPGRADE] closing inherited socket %s, no listener serves it", addr)
+		f.Close()
+	}
+	e.Inherited = nil
+}
+
+func inheritKey(l *ListenerConfig) string {
+	return "tcp://" + l.Addr
+}
+
+// newAdopter starts the event loops of a group and accepts on its sockets.
+func newAdopter(h *ProxyEventHandler, listeners []*ListenerConfig, sockets []net.Listener) (*adopter, error) {
+	client, err := gnet.NewClient(h, h.engine.gnetOptions(listeners)...)
+	if err == nil {
+		err = client.Start()
+	}
+	if err != nil {
+		for _, ln := range sockets {
+			ln.Close()
+		}
+		return nil, err
+	}
+	a := &adopter{client: client, sockets: sockets}
+	for i, ln := range sockets {
+		go a.serve(listeners[i], ln)
+	}
+	return a, nil
+}
+
+// serve accepts connections on an inherited socket until it is closed.
+func (a *adopter) serve(l *ListenerConfig, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logging.Warn("[UPGRADE] listener %s: %v", l.Name, err)
+			time.Sleep(parkAcceptBackoff)
+			continue
+		}
+		// Enroll hands a duplicate to the loop and closes conn
+		if _, err := a.client.Enroll(conn); err != nil {
+			logging.Error("[UPGRADE] listener %s: dropping %s: %v", l.Name, conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// closeSockets closes the inherited sockets, leaving the event loops to
+// serve the connections already taken.
+func (a *adopter) closeSockets() {
+	for _, ln := range a.sockets {
+		ln.Close()
+	}
+}
+
+// stop closes the inherited sockets and stops the event loops.
+func (a *adopter) stop() {
+	a.closeSockets()
+	if err := a.client.Stop(); err != nil {
+		logging.Warn("[UPGRADE] stopping event loops: %v", err)
+	}
+}
+
+// ListenerFiles duplicates the listening TCP sockets of the running listener
+// groups, by "tcp://host:port" address, to pass them to a process replacing
+// this one. UDP listeners are not passed; the new process binds them again.
+// The caller closes the files.
+func (e *Engine) ListenerFiles() (map[string]*os.File, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	files := make(map[string]*os.File)
+	fail := func(err error) (map[string]*os.File, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	for _, g := range e.groups {
+		var sockets []net.Listener
+		switch {
+		case g.adopted != nil:
+			sockets = g.adopted.sockets
+		case g.parked != nil:
+			sockets = g.parked.sockets
+		}
+		i := 0
+		for _, l := range g.listeners {
+			if l.Protocol == "udp" {
+				continue
+			}
+			var f *os.File
+			var err error
+			if sockets != nil {
+				f, err = sockets[i].(*net.TCPListener).File()
+				i++
+			} else {
+				var fd int
+				if fd, err = g.handler.eng.DupListener("tcp", l.Addr); err == nil {
+					f = os.NewFile(uintptr(fd), inheritKey(l))
+				}
+			}
+			if err != nil {
+				return fail(fmt.Errorf("listener %s: %w", l.Name, err))
+			}
+			files[inheritKey(l)] = f
+		}
+	}
+	return files, nil
+}
+
+// HandOff makes the shutdown that follows wait for open connections without
+// refusing new ones: the process taking over shares the listening sockets,
+// and a connection this one accepts meanwhile is served rather than dropped.
+func (e *Engine) HandOff() {
+	e.handingOff.Store(true)
+}
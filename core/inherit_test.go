@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_Inherited(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(c, c)
+		}
+	}()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	cfg := &config.Config{
+		Version:   "2",
+		Backends:  []config.Backend{{Name: "be", Servers: []config.Server{{Address: backend.Addr().String()}}}},
+		Listeners: []config.Listener{{Name: "l", Bind: config.Binds{addr}, Protocol: "tcp", DefaultBackend: "be"}},
+	}
+	start := func(inherited map[string]*os.File) (*Engine, context.CancelFunc, chan struct{}) {
+		engine := NewEngine(cfg)
+		engine.Listeners, _ = ExpandListener(cfg.Listeners[0])
+		engine.Inherited = inherited
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			engine.Start(ctx)
+			close(done)
+		}()
+		waitFor(t, func() bool { return engine.group("l") != nil })
+		return engine, cancel, done
+	}
+	echo := func() {
+		t.Helper()
+		var client net.Conn
+		waitFor(t, func() bool {
+			client, err = net.Dial("tcp", addr)
+			return err == nil
+		})
+		defer client.Close()
+		client.SetDeadline(time.Now().Add(2 * time.Second))
+		client.Write([]byte("ping"))
+		if _, err := io.ReadFull(client, make([]byte, 4)); err != nil {
+			t.Fatalf("no echo: %v", err)
+		}
+	}
+
+	old, cancel, done := start(nil)
+	echo()
+	files, err := old.ListenerFiles()
+	if err != nil {
+		t.Fatalf("ListenerFiles failed: %v", err)
+	}
+	if len(files) != 1 || files["tcp://"+addr] == nil {
+		t.Fatalf("expected the socket of %s, got %v", addr, files)
+	}
+
+	next, cancelNext, doneNext := start(files)
+	old.HandOff()
+	cancel()
+	<-done
+	if next.group("l").adopted == nil {
+		t.Fatal("listener group bound its own socket instead of the inherited one")
+	}
+	echo()
+
+	// Passed on again by the process that inherited it
+	files, err = next.ListenerFiles()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("ListenerFiles on inherited sockets: %v, %v", files, err)
+	}
+	for _, f := range files {
+		f.Close()
+	}
+	cancelNext()
+	<-doneNext
+}
+
+func (e *Engine) group(name string) *listenerGroup {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.groups[name]
+}
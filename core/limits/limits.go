@@ -0,0 +1,17 @@
+// Package limits reads and raises process resource limits.
+package limits
+
+import "errors"
+
+var ErrUnsupported = errors.New("resource limits not supported on this platform")
+
+// NoFile returns the soft and hard limit of open files (RLIMIT_NOFILE).
+func NoFile() (soft, hard uint64, err error) {
+	return noFile()
+}
+
+// RaiseNoFile raises the soft open files limit to n, and the hard limit too
+// when it is lower, which needs privileges. It never lowers a limit.
+func RaiseNoFile(n uint64) error {
+	return raiseNoFile(n)
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package limits
+
+import "syscall"
+
+func noFile() (uint64, uint64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, 0, err
+	}
+	return limit.Cur, limit.Max, nil
+}
+
+func raiseNoFile(n uint64) error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return err
+	}
+	if limit.Cur >= n {
+		return nil
+	}
+	limit.Cur = n
+	limit.Max = max(limit.Max, n)
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+}
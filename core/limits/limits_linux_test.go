@@ -0,0 +1,23 @@
+//go:build linux
+
+package limits
+
+import "testing"
+
+func TestRaiseNoFile(t *testing.T) {
+	soft, hard, err := NoFile()
+	if err != nil {
+		t.Fatalf("NoFile failed: %v", err)
+	}
+	if soft == 0 || hard < soft {
+		t.Fatalf("implausible limits: soft %d, hard %d", soft, hard)
+	}
+
+	// Never lowers the limit
+	if err := RaiseNoFile(soft / 2); err != nil {
+		t.Fatalf("RaiseNoFile failed: %v", err)
+	}
+	if now, _, _ := NoFile(); now != soft {
+		t.Errorf("soft limit changed from %d to %d", soft, now)
+	}
+}
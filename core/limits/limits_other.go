@@ -0,0 +1,11 @@
+//go:build !linux
+
+package limits
+
+func noFile() (uint64, uint64, error) {
+	return 0, 0, ErrUnsupported
+}
+
+func raiseNoFile(n uint64) error {
+	return ErrUnsupported
+}
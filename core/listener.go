@@ -0,0 +1,230 @@
+package core
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/netip"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/ports"
+)
+
+// ListenerConfig is one bound address of a configured listener block.
+type ListenerConfig struct {
+	Name           string
+	Group          string // Name of the configured listener block this was expanded from
+	Addr           string
+	Protocol       string
+	Port           int
+	DefaultBackend string
+	Knock          bool // the knock listener of a preauth block, admits clients instead of proxying
+
+	ListenerOptions
+}
+
+// ListenerOptions holds the per-listener settings the handler applies to
+// connections. All listeners expanded from one block share the same options,
+// including stateful ones such as the rate limiter; new per-listener features
+// belong here.
+type ListenerOptions struct {
+	ZeroCopy       bool
+	MaxConnBuffer  int
+	TLSFingerprint bool
+	Priority       config.Priority
+	Timeouts       config.TimeoutsConfig // resolved against the backend per connection
+	ParkIdle       bool                  // see parker
+	Interface      string                // SO_BINDTODEVICE, shared by the listener block
+	Capture        int                   // first bytes kept for the access log of rejected connections
+	CaptureWait    time.Duration         // how long a connection rejected at accept is held for them
+	ErrorResponse  []byte                // sent before closing when no backend takes the connection
+	ErrorDelay     time.Duration         // waited before sending ErrorResponse
+	Socket         config.SocketConfig   // TCP options of the listening and accepted sockets
+	HelloMax       int                   // ClientHello bytes buffered for inspection
+	HelloTimeout   time.Duration         // how long an incomplete ClientHello is waited for
+	ProxyFrom      []netip.Prefix        // load balancers whose connections start with a PROXY header
+	ProxyTLVs      map[byte]string       // TLV type -> tag name, for the access log
+	Peer           config.PeerConfig     // metadata for proxy_v2_peer backends
+	TraceSample    float64               // fraction of connections traced, 0 without trace_connections
+	TLS            *tls.Config           // terminates client TLS, nil passes it through
+
+	limiter *rateLimiter // nil without rate_limit
+	preauth *preauthGate // nil without preauth
+}
+
+func newListenerOptions(l config.Listener) ListenerOptions {
+	helloMax, helloTimeout := l.TLSInspect.Limits()
+	proxyFrom, _ := l.AcceptProxy.Prefixes() // checked by Validate
+	var proxyTLVs map[byte]string
+	for name, typ := range l.AcceptProxy.TLVs {
+		if proxyTLVs == nil {
+			proxyTLVs = make(map[byte]string, len(l.AcceptProxy.TLVs))
+		}
+		proxyTLVs[byte(typ)] = name
+	}
+	return ListenerOptions{
+		ZeroCopy:       l.ZeroCopy,
+		MaxConnBuffer:  l.MaxConnBuffer,
+		TLSFingerprint: l.TLSFingerprint,
+		Priority:       l.Priority,
+		Timeouts:       l.Timeouts,
+		ParkIdle:       l.ParkIdle,
+		Interface:      l.Interface,
+		Capture:        l.CaptureOnReject.Bytes,
+		CaptureWait:    captureWait(l.CaptureOnReject),
+		ErrorResponse:  l.ErrorResponse.Bytes(),
+		ErrorDelay:     errorDelay(l.ErrorResponse),
+		Socket:         l.Socket,
+		HelloMax:       helloMax,
+		HelloTimeout:   helloTimeout,
+		ProxyFrom:      proxyFrom,
+		ProxyTLVs:      proxyTLVs,
+		Peer:           l.Peer,
+		TraceSample:    traceSample(l.TraceConnections, l.TraceSample),
+		limiter:        newRateLimiter(l.RateLimit),
+		preauth:        newPreauthGate(l.Preauth),
+	}
+}
+
+// defaultCaptureWait is how long a connection rejected at accept is held
+// for its first bytes without capture_on_reject.wait.
+const defaultCaptureWait = time.Second
+
+func captureWait(c config.CaptureConfig) time.Duration {
+	d, err := time.ParseDuration(c.Wait)
+	if err != nil {
+		return defaultCaptureWait
+	}
+	return d
+}
+
+func errorDelay(r config.ErrorResponseConfig) time.Duration {
+	d, _ := time.ParseDuration(r.Delay)
+	return d
+}
+
+// ExpandListener turns a configured listener block into one ListenerConfig per
+// bind address, protocol and port. Port ranges ("host:start-end") expand to
+// every port in the range; all results share the block name as their Group
+// and its options.
+func ExpandListener(l config.Listener) ([]*ListenerConfig, error) {
+	opts := newListenerOptions(l)
+	if l.TLS.Enabled() {
+		tc, err := terminationConfig(l.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		opts.TLS = tc
+	}
+	expanded := make([]*ListenerConfig, 0)
+	for _, bind := range l.Bind {
+		// Parse bind: "host:port" or "host:start-end" or ":port"
+		host, portStr, err := SplitHostPort(bind)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bind address '%s': %w", bind, err)
+		}
+
+		for _, proto := range l.Protocols() {
+			if strings.Contains(portStr, "-") {
+				// Range
+				parts := strings.Split(portStr, "-")
+				start, _ := strconv.Atoi(parts[0])
+				end, _ := strconv.Atoi(parts[1])
+
+				for p := start; p <= end; p++ {
+					lc := newListenerConfig(l, proto, p, opts)
+					lc.Name = fmt.Sprintf("%s-%d", l.Name, p)
+					lc.Addr = fmt.Sprintf("%s:%d", host, p)
+					expanded = append(expanded, lc)
+				}
+			} else {
+				// Single
+				p, _ := strconv.Atoi(portStr)
+				lc := newListenerConfig(l, proto, p, opts)
+				lc.Addr = bind
+				expanded = append(expanded, lc)
+			}
+		}
+	}
+	if knock := l.Preauth.Knock; knock != "" {
+		_, portStr, _ := SplitHostPort(knock) // checked by Validate
+		p, _ := strconv.Atoi(portStr)
+		lc := newListenerConfig(l, "tcp", p, opts)
+		lc.Name = l.Name + "-knock"
+		lc.Addr = knock
+		lc.Knock = true
+		expanded = append(expanded, lc)
+	}
+	return expanded, nil
+}
+
+func newListenerConfig(l config.Listener, proto string, port int, opts ListenerOptions) *ListenerConfig {
+	return &ListenerConfig{
+		Name:            l.Name,
+		Group:           l.Name,
+		Protocol:        proto,
+		Port:            port,
+		DefaultBackend:  l.DefaultBackend,
+		ListenerOptions: opts,
+	}
+}
+
+// SplitHostPort splits a bind address at its last colon. Unlike
+// net.SplitHostPort it accepts port ranges and keeps IPv6 brackets.
+func SplitHostPort(addr string) (string, string, error) {
+	// Simple split by last colon
+	lastColon := strings.LastIndex(addr, ":")
+	if lastColon == -1 {
+		return "", "", fmt.Errorf("missing port in address")
+	}
+	host := addr[:lastColon]
+	port := addr[lastColon+1:]
+	return host, port, nil
+}
+
+// BindAddrs returns the addresses of listeners with a fixed port, to probe
+// with ports.Check before binding them.
+func BindAddrs(listeners []*ListenerConfig) []ports.Addr {
+	out := make([]ports.Addr, 0, len(listeners))
+	for _, lc := range listeners {
+		if lc.Port == 0 {
+			continue // Ephemeral port, always free
+		}
+		addr := lc.Addr
+		if host, port, err := SplitHostPort(addr); err == nil && host == "*" {
+			addr = ":" + port
+		}
+		out = append(out, ports.Addr{Listener: lc.Group, Network: lc.Protocol, Address: addr})
+	}
+	return out
+}
+
+const (
+	// filesPerConn are the descriptors of one proxied connection or UDP
+	// session: the client side and the backend socket.
+	filesPerConn = 2
+	// filesBase covers log files, the admin API, health checks and the like.
+	filesBase = 64
+)
+
+// FileEstimate is the open files the listeners are expected to need with
+// expected concurrent connections per configured listener block. Every one
+// of the loops event loops (0: one per CPU) binds its own socket per address
+// (SO_REUSEPORT), except on parked ports.
+func FileEstimate(listeners []*ListenerConfig, expected, loops int) int {
+	if loops <= 0 {
+		loops = runtime.NumCPU()
+	}
+	sockets := 0
+	for _, lc := range listeners {
+		if lc.ParkIdle && lc.Protocol != "udp" {
+			sockets++
+		} else {
+			sockets += loops
+		}
+	}
+	return filesBase + sockets + len(groupNames(listeners))*expected*filesPerConn
+}
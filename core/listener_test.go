@@ -0,0 +1,110 @@
+package core
+
+import (
+	"runtime"
+	"testing"
+
+	"nvelox/config"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantHost string
+		wantPort string
+		wantErr  bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1", "8080", false},
+		{":8080", "", "8080", false},
+		{"[::1]:80", "[::1]", "80", false},
+		{"invalid", "", "", true},
+		{"no-port:", "no-port", "", false},
+	}
+
+	for _, tt := range tests {
+		host, port, err := SplitHostPort(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SplitHostPort(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if host != tt.wantHost {
+			t.Errorf("SplitHostPort(%q) host = %q, want %q", tt.input, host, tt.wantHost)
+		}
+		if port != tt.wantPort {
+			t.Errorf("SplitHostPort(%q) port = %q, want %q", tt.input, port, tt.wantPort)
+		}
+	}
+}
+
+func TestExpandListener(t *testing.T) {
+	expanded, err := ExpandListener(config.Listener{
+		Name:           "range",
+		Bind:           config.Binds{"127.0.0.1:3000-3002"},
+		Protocol:       "tcp+udp",
+		DefaultBackend: "be",
+	})
+	if err != nil {
+		t.Fatalf("ExpandListener failed: %v", err)
+	}
+	if len(expanded) != 6 {
+		t.Fatalf("expected 6 listeners, got %d", len(expanded))
+	}
+	first := expanded[0]
+	if first.Name != "range-3000" || first.Addr != "127.0.0.1:3000" || first.Protocol != "tcp" || first.Group != "range" {
+		t.Errorf("unexpected first listener: %+v", first)
+	}
+	if last := expanded[5]; last.Protocol != "udp" || last.Port != 3002 {
+		t.Errorf("unexpected last listener: %+v", last)
+	}
+
+	limited, _ := ExpandListener(config.Listener{
+		Name: "limited", Bind: config.Binds{":4000-4001"}, Protocol: "tcp", MaxConnBuffer: 64,
+		RateLimit: config.RateLimitConfig{Connections: 1},
+	})
+	if limited[0].MaxConnBuffer != 64 || limited[0].limiter == nil || limited[0].limiter != limited[1].limiter {
+		t.Error("expanded listeners do not share the block options")
+	}
+
+	if _, err := ExpandListener(config.Listener{Name: "bad", Bind: config.Binds{"invalid"}}); err == nil {
+		t.Error("expected error for bind without port")
+	}
+}
+
+func TestExpandListener_MultipleBinds(t *testing.T) {
+	expanded, err := ExpandListener(config.Listener{
+		Name:      "web",
+		Bind:      config.Binds{"10.0.0.1:443", "[::1]:443", "10.0.0.2:8443-8444"},
+		Protocol:  "tcp",
+		RateLimit: config.RateLimitConfig{Connections: 1},
+	})
+	if err != nil {
+		t.Fatalf("ExpandListener failed: %v", err)
+	}
+	want := []string{"10.0.0.1:443", "[::1]:443", "10.0.0.2:8443", "10.0.0.2:8444"}
+	if len(expanded) != len(want) {
+		t.Fatalf("expected %d listeners, got %d", len(want), len(expanded))
+	}
+	for i, lc := range expanded {
+		if lc.Addr != want[i] || lc.Group != "web" {
+			t.Errorf("listener %d: addr %q group %q, want %q in web", i, lc.Addr, lc.Group, want[i])
+		}
+		if lc.limiter != expanded[0].limiter {
+			t.Errorf("listener %d does not share the block options", i)
+		}
+	}
+}
+
+func TestFileEstimate(t *testing.T) {
+	ranged, _ := ExpandListener(config.Listener{Name: "r", Bind: config.Binds{":10000-10099"}, Protocol: "tcp"})
+	parked, _ := ExpandListener(config.Listener{Name: "p", Bind: config.Binds{":20000-20099"}, Protocol: "tcp", ParkIdle: true})
+	listeners := append(ranged, parked...)
+
+	want := filesBase + 100*runtime.NumCPU() + 100 + 2*50*filesPerConn
+	if got := FileEstimate(listeners, 50, 0); got != want {
+		t.Errorf("FileEstimate = %d, want %d", got, want)
+	}
+	want = filesBase + 100*4 + 100 + 2*50*filesPerConn
+	if got := FileEstimate(listeners, 50, 4); got != want {
+		t.Errorf("FileEstimate with 4 event loops = %d, want %d", got, want)
+	}
+}
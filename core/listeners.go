@@ -0,0 +1,44 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"nvelox/config"
+)
+
+// ErrListenerExists is returned by AddListener for a name already in use.
+var ErrListenerExists = errors.New("listener already exists")
+
+// AddListener starts listening for l, port ranges included, next to the
+// running listeners. It is Apply with l added to the current listeners, so l
+// is validated against the whole configuration and nothing changes when it
+// fails to bind.
+func (e *Engine) AddListener(l config.Listener) ([]Change, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	current := e.CurrentConfig()
+	for _, cur := range current.Listeners {
+		if cur.Name == l.Name {
+			return nil, fmt.Errorf("%w: %s", ErrListenerExists, l.Name)
+		}
+	}
+	return e.apply(append(slices.Clone(current.Listeners), l), current.Backends)
+}
+
+// RemoveListener stops accepting on a listener and all its ports before it
+// returns. Its open TCP connections continue until they finish and its UDP
+// sessions are closed, as with a listener removed by Apply.
+func (e *Engine) RemoveListener(name string) ([]Change, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	current := e.CurrentConfig()
+	i := slices.IndexFunc(current.Listeners, func(l config.Listener) bool { return l.Name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownListener, name)
+	}
+	return e.apply(slices.Delete(slices.Clone(current.Listeners), i, i+1), current.Backends)
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_AddRemoveListener(t *testing.T) {
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "be", Servers: []config.Server{{Address: echoServer(t)}}}},
+		Listeners: []config.Listener{
+			{Name: "a", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d", freePort(t))}, Protocol: "tcp", DefaultBackend: "be"},
+		},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	// A block of ports, as game servers open them
+	first := freePort(t)
+	block := config.Listener{
+		Name: "block", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d-%d", first, first+2)}, Protocol: "tcp", DefaultBackend: "be",
+	}
+	changes, err := engine.AddListener(block)
+	if err != nil {
+		t.Fatalf("AddListener failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "listener", Name: "block", Action: ChangeAdded}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	for port := first; port <= first+2; port++ {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		if err != nil {
+			t.Fatalf("port %d not accepting: %v", port, err)
+		}
+		conn.Close()
+	}
+	if engine.ListenerCount() != 4 {
+		t.Errorf("ListenerCount = %d, want 4", engine.ListenerCount())
+	}
+
+	if _, err := engine.AddListener(block); !errors.Is(err, ErrListenerExists) {
+		t.Errorf("adding it twice: %v, want ErrListenerExists", err)
+	}
+	bad := config.Listener{Name: "bad", Bind: config.Binds{"127.0.0.1:9"}, DefaultBackend: "missing"}
+	if _, err := engine.AddListener(bad); err == nil {
+		t.Error("expected error for a listener referencing a missing backend")
+	}
+
+	open, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", first), time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer open.Close()
+	roundTrip(t, open, "before")
+
+	changes, err = engine.RemoveListener("block")
+	if err != nil {
+		t.Fatalf("RemoveListener failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "listener", Name: "block", Action: ChangeRemoved}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	// The ports refuse as soon as it returns, while the open connection drains
+	for port := first; port <= first+2; port++ {
+		if conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second); err == nil {
+			conn.Close()
+			t.Errorf("removed port %d still accepting", port)
+		}
+	}
+	roundTrip(t, open, "draining")
+	if got := engine.CurrentConfig().Listeners; len(got) != 1 || got[0].Name != "a" {
+		t.Errorf("listeners after removal: %+v", got)
+	}
+	if _, err := engine.RemoveListener("block"); !errors.Is(err, ErrUnknownListener) {
+		t.Errorf("removing it twice: %v, want ErrUnknownListener", err)
+	}
+
+	// Adding the ports back serves them from the new listener alone
+	if _, err := engine.AddListener(block); err != nil {
+		t.Fatalf("AddListener again failed: %v", err)
+	}
+	for i := 0; i < 8; i++ {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", first+i%3), time.Second)
+		if err != nil {
+			t.Fatalf("re-added port not accepting: %v", err)
+		}
+		roundTrip(t, conn, "again")
+		conn.Close()
+	}
+	roundTrip(t, open, "still")
+}
@@ -0,0 +1,400 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nvelox/config"
+)
+
+const (
+	accessQueueSize = 1024
+	webhookTimeout  = 5 * time.Second
+	// accessReportInterval is how often at most a sink reports the entries
+	// it dropped or failed to write.
+	accessReportInterval = 10 * time.Second
+)
+
+// AccessEntry describes a finished client connection.
+type AccessEntry struct {
+	Time     time.Time         `json:"time"`
+	Listener string            `json:"listener"`
+	Client   string            `json:"client"`
+	Backend  string            `json:"backend"`
+	Status   string            `json:"status"`
+	BytesIn  int64             `json:"bytes_in"`
+	BytesOut int64             `json:"bytes_out"`
+	Duration time.Duration     `json:"duration"`
+	Select   time.Duration     `json:"select,omitempty"`  // picking servers, summed over retries
+	Dial     time.Duration     `json:"dial,omitempty"`    // dialing servers, summed over retries
+	Connect  time.Duration     `json:"connect,omitempty"` // from accept until the backend was connected
+	JA3      string            `json:"ja3,omitempty"`
+	JA4      string            `json:"ja4,omitempty"`
+	SNI      string            `json:"sni,omitempty"`     // with capture_on_reject
+	Head     string            `json:"head,omitempty"`    // first bytes in hex, rejected connections with capture_on_reject
+	Tags     map[string]string `json:"tags,omitempty"`    // from the PROXY TLVs of accept_proxy
+	ConnID   string            `json:"conn_id,omitempty"` // shared by the tiers of nvelox peers
+	Tenant   string            `json:"tenant,omitempty"`
+}
+
+// String renders the entry as a single access log line.
+func (e AccessEntry) String() string {
+	line := fmt.Sprintf("%s %s %s -> %s %s in=%s out=%s dur=%s",
+		e.Time.Format(time.RFC3339), e.Listener, e.Client, e.Backend, e.Status,
+		FormatSize(e.BytesIn), FormatSize(e.BytesOut), FormatDuration(e.Duration))
+	if e.Select > 0 {
+		line += " select=" + FormatDuration(e.Select)
+	}
+	if e.Dial > 0 {
+		line += " dial=" + FormatDuration(e.Dial)
+	}
+	if e.Connect > 0 {
+		line += " connect=" + FormatDuration(e.Connect)
+	}
+	if e.JA3 != "" {
+		line += " ja3=" + e.JA3
+	}
+	if e.JA4 != "" {
+		line += " ja4=" + e.JA4
+	}
+	if e.SNI != "" {
+		line += " sni=" + logSafe(e.SNI)
+	}
+	if e.Head != "" {
+		line += " head=" + e.Head
+	}
+	if e.ConnID != "" {
+		line += " conn_id=" + logSafe(e.ConnID)
+	}
+	if e.Tenant != "" {
+		line += " tenant=" + logSafe(e.Tenant)
+	}
+	names := make([]string, 0, len(e.Tags))
+	for name := range e.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += " tag." + name + "=" + logSafe(e.Tags[name])
+	}
+	return line
+}
+
+// logSafe quotes client supplied text that would break the line format.
+func logSafe(s string) string {
+	if strings.ContainsFunc(s, func(r rune) bool { return r <= ' ' || r > '~' || r == '"' }) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// AccessSink receives access log entries.
+type AccessSink interface {
+	Write(e AccessEntry) error
+	Close() error
+}
+
+type accessRoute struct {
+	filter AccessFilter
+	sink   AccessSink
+}
+
+var (
+	accessMu     sync.RWMutex
+	accessRoutes []accessRoute
+)
+
+// AccessFilter decides whether an entry is delivered to a sink.
+type AccessFilter struct {
+	IncludeListeners []string
+	ExcludeListeners []string
+	IncludeStatus    []string
+	ExcludeStatus    []string
+	MinBytes         int64
+	MaxBytes         int64
+}
+
+// Match reports whether e passes the filter. Total bytes (in + out) are
+// compared against the byte thresholds.
+func (f AccessFilter) Match(e AccessEntry) bool {
+	if len(f.IncludeListeners) > 0 && !contains(f.IncludeListeners, e.Listener) {
+		return false
+	}
+	if contains(f.ExcludeListeners, e.Listener) {
+		return false
+	}
+	if len(f.IncludeStatus) > 0 && !contains(f.IncludeStatus, e.Status) {
+		return false
+	}
+	if contains(f.ExcludeStatus, e.Status) {
+		return false
+	}
+	total := e.BytesIn + e.BytesOut
+	if f.MinBytes > 0 && total < f.MinBytes {
+		return false
+	}
+	if f.MaxBytes > 0 && total > f.MaxBytes {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// InitAccessSinks configures the access log pipeline. When no sinks are
+// configured, entries go to the writer set up by Init (access_log or stdout).
+func InitAccessSinks(cfgs []config.AccessSinkConfig) error {
+	routes := make([]accessRoute, 0, len(cfgs))
+	for _, c := range cfgs {
+		sink, err := newAccessSink(c)
+		if err != nil {
+			for _, r := range routes {
+				r.sink.Close()
+			}
+			return err
+		}
+		routes = append(routes, accessRoute{
+			filter: AccessFilter{
+				IncludeListeners: c.Filter.IncludeListeners,
+				ExcludeListeners: c.Filter.ExcludeListeners,
+				IncludeStatus:    c.Filter.IncludeStatus,
+				ExcludeStatus:    c.Filter.ExcludeStatus,
+				MinBytes:         c.Filter.MinBytes,
+				MaxBytes:         c.Filter.MaxBytes,
+			},
+			sink: sink,
+		})
+	}
+
+	accessMu.Lock()
+	old := accessRoutes
+	accessRoutes = routes
+	accessMu.Unlock()
+
+	for _, r := range old {
+		r.sink.Close()
+	}
+	return nil
+}
+
+// LogAccess queues an entry for every sink whose filter matches; it does not
+// wait for the sinks to write it.
+func LogAccess(e AccessEntry) {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+
+	if len(accessRoutes) == 0 {
+		if accessLog != nil {
+			accessLog.Print(e.String())
+		}
+		return
+	}
+
+	for _, r := range accessRoutes {
+		if !r.filter.Match(e) {
+			continue
+		}
+		if err := r.sink.Write(e); err != nil {
+			Error("[ACCESS] sink write failed: %v", err)
+		}
+	}
+}
+
+func newAccessSink(c config.AccessSinkConfig) (AccessSink, error) {
+	switch c.Type {
+	case "file":
+		sink, err := newFileSink(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		return newQueuedSink("file "+c.Path, sink), nil
+	case "syslog":
+		sink, err := newSyslogSink(c.Network, c.Address, c.Tag)
+		if err != nil {
+			return nil, err
+		}
+		return newQueuedSink("syslog "+c.Address, sink), nil
+	case "webhook":
+		return newQueuedSink("webhook", newWebhookSink(c.URL)), nil
+	default:
+		return nil, fmt.Errorf("unknown access sink type: %s", c.Type)
+	}
+}
+
+// queuedSink writes entries to its sink from a bounded queue, on a goroutine
+// of its own, so a slow disk, syslog daemon or endpoint never blocks
+// connection teardown on the event loop. Entries are dropped when the queue
+// is full. Drops and failed writes are counted and reported at most once per
+// accessReportInterval.
+type queuedSink struct {
+	name  string
+	sink  AccessSink
+	queue chan AccessEntry
+	done  chan struct{}
+
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	lastErr  atomic.Value // error of the latest failed write
+	reported atomic.Int64 // unix nanoseconds of the latest report
+}
+
+func newQueuedSink(name string, sink AccessSink) *queuedSink {
+	s := &queuedSink{
+		name:  name,
+		sink:  sink,
+		queue: make(chan AccessEntry, accessQueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *queuedSink) Write(e AccessEntry) error {
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+		s.report(false)
+	}
+	return nil
+}
+
+func (s *queuedSink) loop() {
+	defer close(s.done)
+	for e := range s.queue {
+		if err := s.sink.Write(e); err != nil {
+			s.failed.Add(1)
+			s.lastErr.Store(err)
+			s.report(false)
+		}
+	}
+}
+
+// report logs the drops and failed writes since the last report, unless it
+// was less than accessReportInterval ago and final is false.
+func (s *queuedSink) report(final bool) {
+	now := time.Now().UnixNano()
+	last := s.reported.Load()
+	if !final && (now-last < int64(accessReportInterval) || !s.reported.CompareAndSwap(last, now)) {
+		return
+	}
+	if n := s.dropped.Swap(0); n > 0 {
+		Error("[ACCESS] %s sink queue full, dropped %d entries", s.name, n)
+	}
+	if n := s.failed.Swap(0); n > 0 {
+		Error("[ACCESS] %s sink failed to write %d entries: %v", s.name, n, s.lastErr.Load())
+	}
+}
+
+// Close writes the queued entries, reports what was lost and closes the sink.
+func (s *queuedSink) Close() error {
+	close(s.queue)
+	<-s.done
+	s.report(true)
+	return s.sink.Close()
+}
+
+// fileSink appends entries as text lines to a file.
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access sink %s: %w", path, err)
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Write(e AccessEntry) error {
+	_, err := io.WriteString(s.f, e.String()+"\n")
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// syslogSink sends RFC 3164 messages to a remote syslog daemon.
+type syslogSink struct {
+	conn net.Conn
+	tag  string
+}
+
+func newSyslogSink(network, address, tag string) (*syslogSink, error) {
+	if network == "" {
+		network = "udp"
+	}
+	if tag == "" {
+		tag = "nvelox"
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog %s: %w", address, err)
+	}
+	return &syslogSink{conn: conn, tag: tag}, nil
+}
+
+func (s *syslogSink) Write(e AccessEntry) error {
+	// Facility local0 (16), severity info (6)
+	const priority = 16*8 + 6
+	hostname, _ := os.Hostname()
+	msg := fmt.Sprintf("<%d>%s %s %s: %s\n", priority, e.Time.Format(time.Stamp), hostname, s.tag, e.String())
+	_, err := io.WriteString(s.conn, msg)
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
+
+// webhookSink POSTs entries as JSON.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string) *webhookSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (s *webhookSink) Write(e AccessEntry) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
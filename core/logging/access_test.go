@@ -0,0 +1,224 @@
+package logging
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestAccessFilter_Match(t *testing.T) {
+	entry := AccessEntry{Listener: "web", Status: "OK", BytesIn: 100, BytesOut: 50}
+
+	tests := []struct {
+		name   string
+		filter AccessFilter
+		want   bool
+	}{
+		{"empty", AccessFilter{}, true},
+		{"include listener", AccessFilter{IncludeListeners: []string{"web"}}, true},
+		{"include other listener", AccessFilter{IncludeListeners: []string{"api"}}, false},
+		{"exclude listener", AccessFilter{ExcludeListeners: []string{"web"}}, false},
+		{"include status", AccessFilter{IncludeStatus: []string{"ok"}}, true},
+		{"exclude status", AccessFilter{ExcludeStatus: []string{"OK"}}, false},
+		{"min bytes met", AccessFilter{MinBytes: 150}, true},
+		{"min bytes not met", AccessFilter{MinBytes: 151}, false},
+		{"max bytes exceeded", AccessFilter{MaxBytes: 149}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(entry); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAccessSinks_File(t *testing.T) {
+	tmpDir := t.TempDir()
+	allPath := filepath.Join(tmpDir, "all.log")
+	filteredPath := filepath.Join(tmpDir, "filtered.log")
+
+	err := InitAccessSinks([]config.AccessSinkConfig{
+		{Type: "file", Path: allPath},
+		{Type: "file", Path: filteredPath, Filter: config.AccessFilterConfig{
+			ExcludeListeners: []string{"health"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("InitAccessSinks failed: %v", err)
+	}
+	defer InitAccessSinks(nil)
+
+	LogAccess(AccessEntry{Time: time.Now(), Listener: "health", Status: "OK"})
+	LogAccess(AccessEntry{Time: time.Now(), Listener: "web", Status: "OK"})
+	InitAccessSinks(nil) // closing the sinks writes out their queues
+
+	all, _ := os.ReadFile(allPath)
+	if !strings.Contains(string(all), "health") || !strings.Contains(string(all), "web") {
+		t.Errorf("unfiltered sink missing entries: %s", all)
+	}
+
+	filtered, _ := os.ReadFile(filteredPath)
+	if strings.Contains(string(filtered), "health") {
+		t.Errorf("filtered sink contains excluded listener: %s", filtered)
+	}
+	if !strings.Contains(string(filtered), "web") {
+		t.Errorf("filtered sink missing entry: %s", filtered)
+	}
+}
+
+func TestAccessSinks_Webhook(t *testing.T) {
+	received := make(chan AccessEntry, 1)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e AccessEntry
+		json.NewDecoder(r.Body).Decode(&e)
+		received <- e
+	})}
+	go server.Serve(l)
+	defer server.Close()
+
+	if err := InitAccessSinks([]config.AccessSinkConfig{
+		{Type: "webhook", URL: "http://" + l.Addr().String()},
+	}); err != nil {
+		t.Fatalf("InitAccessSinks failed: %v", err)
+	}
+	defer InitAccessSinks(nil)
+
+	LogAccess(AccessEntry{Listener: "web", Status: "OK"})
+
+	select {
+	case e := <-received:
+		if e.Listener != "web" {
+			t.Errorf("webhook received listener %q, want web", e.Listener)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for webhook delivery")
+	}
+}
+
+// blockingSink holds its first write until released.
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+	writes  int
+}
+
+func (s *blockingSink) Write(e AccessEntry) error {
+	if s.writes++; s.writes == 1 {
+		close(s.started)
+		<-s.release
+	}
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestQueuedSink_Drops(t *testing.T) {
+	sink := &blockingSink{started: make(chan struct{}), release: make(chan struct{})}
+	s := newQueuedSink("test", sink)
+	s.Write(AccessEntry{})
+	<-sink.started
+
+	// With the sink stuck, writes return at once and the overflow is counted
+	s.reported.Store(time.Now().UnixNano())
+	for i := 0; i < accessQueueSize+5; i++ {
+		if err := s.Write(AccessEntry{}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if n := s.dropped.Load(); n != 5 {
+		t.Errorf("dropped %d entries, want 5", n)
+	}
+
+	close(sink.release)
+	s.Close()
+	if sink.writes != accessQueueSize+1 {
+		t.Errorf("sink wrote %d entries, want %d", sink.writes, accessQueueSize+1)
+	}
+	if n := s.dropped.Load(); n != 0 {
+		t.Errorf("%d drops left unreported after Close", n)
+	}
+}
+
+func TestAccessSinks_UnknownType(t *testing.T) {
+	if err := InitAccessSinks([]config.AccessSinkConfig{{Type: "kafka"}}); err == nil {
+		t.Error("expected error for unknown sink type")
+	}
+}
+
+func TestAccessEntry_String(t *testing.T) {
+	e := AccessEntry{
+		Time: time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC), Listener: "web", Client: "1.1.1.1:1",
+		Backend: "10.0.0.1:80", Status: "OK", BytesIn: 1, BytesOut: 2, Duration: time.Second,
+	}
+	want := "2026-10-15T10:00:00Z web 1.1.1.1:1 -> 10.0.0.1:80 OK in=1 out=2 dur=1000.000ms"
+	if got := e.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	e.Select, e.Dial, e.Connect = 10*time.Microsecond, 2*time.Millisecond, 25*time.Millisecond
+	if got := e.String(); got != want+" select=0.010ms dial=2.000ms connect=25.000ms" {
+		t.Errorf("String() with setup phases = %q", got)
+	}
+
+	// Client supplied names cannot break the line apart
+	e.Select, e.Dial, e.Connect = 0, 0, 0
+	e.SNI, e.Head = "evil.test dur=0s", "16030100"
+	if got := e.String(); got != want+` sni="evil.test dur=0s" head=16030100` {
+		t.Errorf("String() with capture = %q", got)
+	}
+
+	e.SNI, e.Head = "", ""
+	e.Tags = map[string]string{"vpce": "vpce-0abc", "alpn": "h2 x"}
+	if got := e.String(); got != want+` tag.alpn="h2 x" tag.vpce=vpce-0abc` {
+		t.Errorf("String() with tags = %q", got)
+	}
+
+	e.Tags = nil
+	e.ConnID, e.Tenant = "4f2a9c1e5b7d3a60", "acme corp"
+	if got := e.String(); got != want+` conn_id=4f2a9c1e5b7d3a60 tenant="acme corp"` {
+		t.Errorf("String() with peer metadata = %q", got)
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	defer SetUnits(config.LogUnits{})
+
+	for _, c := range []struct {
+		units config.LogUnits
+		d     time.Duration
+		n     int64
+		dur   string
+		size  string
+	}{
+		{config.LogUnits{}, 1500 * time.Microsecond, 512, "1.500ms", "512"},
+		{config.LogUnits{}, 90 * time.Second, 1 << 20, "90000.000ms", "1048576"},
+		{config.LogUnits{Duration: "us", Size: "human"}, 1500 * time.Microsecond, 512, "1500us", "512B"},
+		{config.LogUnits{Duration: "s", Size: "human"}, 1500 * time.Microsecond, 1536, "0.001500s", "1.5KiB"},
+		{config.LogUnits{Size: "human"}, 0, 3 << 30, "0.000ms", "3.0GiB"},
+	} {
+		SetUnits(c.units)
+		if got := FormatDuration(c.d); got != c.dur {
+			t.Errorf("%+v: FormatDuration(%v) = %q, want %q", c.units, c.d, got, c.dur)
+		}
+		if got := FormatSize(c.n); got != c.size {
+			t.Errorf("%+v: FormatSize(%d) = %q, want %q", c.units, c.n, got, c.size)
+		}
+		if n, err := ParseSize(c.size); err != nil || n != c.n {
+			t.Errorf("ParseSize(%q) = %d, %v", c.size, n, err)
+		}
+	}
+	if _, err := ParseSize("1.5KB"); err == nil {
+		t.Error("expected error for a decimal unit")
+	}
+}
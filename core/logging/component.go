@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Logger logs messages tagged with a component name. Its method set matches
+// the logger interface of gnet, so the event loops log through it too.
+type Logger struct {
+	name string
+	tag  string
+}
+
+// Component returns a logger whose messages are prefixed with "[name]".
+// SetLevels can give it a level of its own.
+func Component(name string) *Logger {
+	return &Logger{name: strings.ToLower(name), tag: "[" + name + "] "}
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	if enabledFor(DebugLevel, l.name) {
+		output(DebugLevel, fmt.Sprintf(l.tag+format, args...))
+	}
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	if enabledFor(InfoLevel, l.name) {
+		output(InfoLevel, fmt.Sprintf(l.tag+format, args...))
+	}
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	if enabledFor(WarnLevel, l.name) {
+		output(WarnLevel, fmt.Sprintf(l.tag+format, args...))
+	}
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	if enabledFor(ErrorLevel, l.name) {
+		output(ErrorLevel, fmt.Sprintf(l.tag+format, args...))
+	}
+}
+
+func (l *Logger) Fatalf(format string, args ...any) {
+	if errorLog != nil {
+		errorLog.Output(2, fmt.Sprintf("[FATAL] "+l.tag+format, args...))
+	}
+	os.Exit(1)
+}
+
+// Writer returns an io.Writer logging each line written to it at lvl, tagged
+// with component. It captures output of third-party code that only accepts a
+// writer or a *log.Logger, such as net/http server errors.
+func Writer(component string, lvl Level) io.Writer {
+	return &lineWriter{name: strings.ToLower(component), tag: "[" + component + "] ", level: lvl}
+}
+
+type lineWriter struct {
+	name  string
+	tag   string
+	level Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if !enabledFor(w.level, w.name) {
+		return len(p), nil
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		output(w.level, w.tag+string(line))
+	}
+	return len(p), nil
+}
+
+var levelTags = map[Level]string{
+	DebugLevel: "[DEBUG] ",
+	InfoLevel:  "[INFO] ",
+	WarnLevel:  "[WARN] ",
+	ErrorLevel: "[ERR] ",
+}
+
+// output writes msg to the error log; callers check the level.
+func output(lvl Level, msg string) {
+	if errorLog != nil {
+		errorLog.Output(3, levelTags[lvl]+msg)
+	}
+}
@@ -0,0 +1,196 @@
+package logging
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Inherit, given as a component level to SetLevels, removes the component's
+// own level so it follows the global level again.
+const Inherit Level = -1
+
+var (
+	globalLevel atomic.Int32
+	components  atomic.Pointer[map[string]Level] // copy-on-write, nil when empty
+
+	levelMu     sync.Mutex // guards base and revertTimer
+	base        *LevelState
+	revertTimer *time.Timer
+)
+
+// LevelState is the global level, the per-component levels and, while a
+// temporary change is pending, when it reverts.
+type LevelState struct {
+	Level      Level
+	Components map[string]Level
+	RevertAt   time.Time // zero when nothing reverts
+}
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warning"
+	case ErrorLevel:
+		return "error"
+	case Inherit:
+		return "inherit"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// ParseLevel parses debug, info, warning (or warn) and error.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warning", "warn":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return WarnLevel, fmt.Errorf("unknown log level %q", s)
+}
+
+// Levels returns the levels in effect.
+func Levels() LevelState {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	return currentLevels()
+}
+
+// SetLevels changes the global level, when global is not nil, and the level
+// of each listed component. Components are the lowercased message tags, such
+// as "health" for "[HEALTH]" messages. With revertAfter > 0 the change is
+// undone after that long, restoring the levels from before the first of the
+// pending changes; with 0 it is kept.
+func SetLevels(global *Level, comps map[string]Level, revertAfter time.Duration) LevelState {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+
+	if base == nil && revertAfter > 0 {
+		prev := currentLevels()
+		base = &prev
+	}
+	if revertTimer != nil {
+		revertTimer.Stop()
+		revertTimer = nil
+	}
+
+	if global != nil {
+		globalLevel.Store(int32(*global))
+	}
+	if len(comps) > 0 {
+		next := make(map[string]Level)
+		if m := components.Load(); m != nil {
+			maps.Copy(next, *m)
+		}
+		for name, lvl := range comps {
+			name = strings.ToLower(name)
+			if lvl == Inherit {
+				delete(next, name)
+			} else {
+				next[name] = lvl
+			}
+		}
+		storeComponents(next)
+	}
+
+	if revertAfter > 0 {
+		base.RevertAt = time.Now().Add(revertAfter)
+		revertTimer = time.AfterFunc(revertAfter, func() {
+			if ResetLevels() {
+				Info("[LOGGING] temporary log levels reverted")
+			}
+		})
+	} else {
+		base = nil
+	}
+	return currentLevels()
+}
+
+// ResetLevels undoes a pending temporary change now. It reports whether there
+// was one.
+func ResetLevels() bool {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if base == nil {
+		return false
+	}
+	if revertTimer != nil {
+		revertTimer.Stop()
+		revertTimer = nil
+	}
+	globalLevel.Store(int32(base.Level))
+	storeComponents(base.Components)
+	base = nil
+	return true
+}
+
+// resetLevels sets the global level and drops component levels and any
+// pending revert.
+func resetLevels(lvl Level) {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if revertTimer != nil {
+		revertTimer.Stop()
+		revertTimer = nil
+	}
+	base = nil
+	globalLevel.Store(int32(lvl))
+	components.Store(nil)
+}
+
+func currentLevels() LevelState {
+	st := LevelState{Level: Level(globalLevel.Load()), Components: map[string]Level{}}
+	if m := components.Load(); m != nil {
+		maps.Copy(st.Components, *m)
+	}
+	if base != nil {
+		st.RevertAt = base.RevertAt
+	}
+	return st
+}
+
+func storeComponents(m map[string]Level) {
+	if len(m) == 0 {
+		components.Store(nil)
+		return
+	}
+	m = maps.Clone(m)
+	components.Store(&m)
+}
+
+// enabled reports whether a message at lvl is logged. The component is taken
+// from the leading "[TAG]" of format.
+func enabled(lvl Level, format string) bool {
+	if components.Load() == nil {
+		return lvl >= Level(globalLevel.Load())
+	}
+	name := ""
+	if strings.HasPrefix(format, "[") {
+		if end := strings.IndexByte(format, ']'); end > 0 {
+			name = strings.ToLower(format[1:end])
+		}
+	}
+	return enabledFor(lvl, name)
+}
+
+// enabledFor reports whether a message of component name at lvl is logged.
+func enabledFor(lvl Level, name string) bool {
+	if m := components.Load(); m != nil {
+		if c, ok := (*m)[name]; ok {
+			return lvl >= c
+		}
+	}
+	return lvl >= Level(globalLevel.Load())
+}
@@ -6,7 +6,6 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 )
 
@@ -22,7 +21,6 @@ const (
 var (
 	accessLog *log.Logger
 	errorLog  *log.Logger
-	level     Level
 	mu        sync.Mutex
 )
 
@@ -32,18 +30,11 @@ func Init(logLevel string, accessPath, errorPath string) error {
 	defer mu.Unlock()
 
 	// Parse Level
-	switch strings.ToLower(logLevel) {
-	case "debug":
-		level = DebugLevel
-	case "info":
-		level = InfoLevel
-	case "warning":
-		level = WarnLevel
-	case "error":
-		level = ErrorLevel
-	default:
-		level = WarnLevel
+	lvl, err := ParseLevel(logLevel)
+	if err != nil {
+		lvl = WarnLevel
 	}
+	resetLevels(lvl)
 
 	// Setup Error Log
 	var errWriter io.Writer = os.Stderr
@@ -73,30 +64,35 @@ func Init(logLevel string, accessPath, errorPath string) error {
 	}
 	accessLog = log.New(accessWriter, "", 0) // Raw format
 
+	// Route the standard logger, used by third-party packages, through the
+	// error log so it honors the level and error_log file.
+	log.SetFlags(0)
+	log.SetOutput(Writer("log", InfoLevel))
+
 	return nil
 }
 
 func Debug(format string, v ...interface{}) {
-	if level <= DebugLevel {
-		errorLog.Output(2, fmt.Sprintf("[DEBUG] "+format, v...))
+	if enabled(DebugLevel, format) {
+		output(DebugLevel, fmt.Sprintf(format, v...))
 	}
 }
 
 func Info(format string, v ...interface{}) {
-	if level <= InfoLevel {
-		errorLog.Output(2, fmt.Sprintf("[INFO] "+format, v...))
+	if enabled(InfoLevel, format) {
+		output(InfoLevel, fmt.Sprintf(format, v...))
 	}
 }
 
 func Warn(format string, v ...interface{}) {
-	if level <= WarnLevel {
-		errorLog.Output(2, fmt.Sprintf("[WARN] "+format, v...))
+	if enabled(WarnLevel, format) {
+		output(WarnLevel, fmt.Sprintf(format, v...))
 	}
 }
 
 func Error(format string, v ...interface{}) {
-	if level <= ErrorLevel {
-		errorLog.Output(2, fmt.Sprintf("[ERR] "+format, v...))
+	if enabled(ErrorLevel, format) {
+		output(ErrorLevel, fmt.Sprintf(format, v...))
 	}
 }
 
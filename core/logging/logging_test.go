@@ -1,10 +1,13 @@
 package logging
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestInit(t *testing.T) {
@@ -12,7 +15,7 @@ func TestInit(t *testing.T) {
 	if err := Init("invalid", "", ""); err != nil {
 		t.Fatalf("Init failed: %v", err)
 	}
-	if level != WarnLevel {
+	if level := Levels().Level; level != WarnLevel {
 		t.Errorf("expected default level WarnLevel, got %v", level)
 	}
 
@@ -28,7 +31,7 @@ func TestInit(t *testing.T) {
 		if err := Init(name, "", ""); err != nil {
 			t.Errorf("Init(%s) failed: %v", name, err)
 		}
-		if level != want {
+		if level := Levels().Level; level != want {
 			t.Errorf("Init(%s): expected level %v, got %v", name, want, level)
 		}
 	}
@@ -109,3 +112,106 @@ func TestLogLevelFiltering(t *testing.T) {
 		t.Error("log missing error message")
 	}
 }
+
+func TestComponentAndWriter(t *testing.T) {
+	errorPath := filepath.Join(t.TempDir(), "error.log")
+	if err := Init("info", "", errorPath); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	Component("gnet").Infof("launching %d loops", 4)
+	Component("gnet").Debugf("should not appear")
+	fmt.Fprint(Writer("admin", ErrorLevel), "first line\nsecond line\n")
+	log.Printf("from package log")
+
+	content, err := os.ReadFile(errorPath)
+	if err != nil {
+		t.Fatalf("failed to read error log: %v", err)
+	}
+	s := string(content)
+	for _, want := range []string{
+		"[INFO] [gnet] launching 4 loops",
+		"[ERR] [admin] first line",
+		"[ERR] [admin] second line",
+		"[INFO] [log] from package log",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("error log missing %q:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "should not appear") {
+		t.Error("log contained filtered messages")
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	errorPath := filepath.Join(t.TempDir(), "error.log")
+	if err := Init("warning", "", errorPath); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	debug := DebugLevel
+	st := SetLevels(nil, map[string]Level{"HEALTH": DebugLevel, "gnet": ErrorLevel}, time.Hour)
+	if st.Level != WarnLevel || st.Components["health"] != DebugLevel || st.RevertAt.IsZero() {
+		t.Fatalf("unexpected state after SetLevels: %+v", st)
+	}
+	Debug("[HEALTH] health debug")
+	Debug("[RATE] rate debug")
+	Component("gnet").Warnf("gnet warning")
+
+	// A second change keeps the original levels to revert to.
+	SetLevels(&debug, map[string]Level{"gnet": Inherit}, time.Hour)
+	if _, ok := Levels().Components["gnet"]; ok {
+		t.Error("Inherit did not remove the gnet level")
+	}
+	Component("gnet").Debugf("gnet debug")
+
+	if !ResetLevels() {
+		t.Fatal("ResetLevels found no pending change")
+	}
+	if st := Levels(); st.Level != WarnLevel || len(st.Components) != 0 || !st.RevertAt.IsZero() {
+		t.Errorf("levels not restored: %+v", st)
+	}
+	if ResetLevels() {
+		t.Error("ResetLevels reported a change twice")
+	}
+	Debug("[HEALTH] after reset")
+
+	content, err := os.ReadFile(errorPath)
+	if err != nil {
+		t.Fatalf("failed to read error log: %v", err)
+	}
+	s := string(content)
+	for _, want := range []string{"health debug", "gnet debug"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("error log missing %q:\n%s", want, s)
+		}
+	}
+	for _, unwanted := range []string{"rate debug", "gnet warning", "after reset"} {
+		if strings.Contains(s, unwanted) {
+			t.Errorf("error log contains %q:\n%s", unwanted, s)
+		}
+	}
+}
+
+func TestSetLevels_Revert(t *testing.T) {
+	if err := Init("info", "", ""); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	debug := DebugLevel
+	SetLevels(&debug, nil, 20*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for Levels().Level != InfoLevel {
+		if time.Now().After(deadline) {
+			t.Fatal("level was not reverted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Without a duration the change is kept.
+	SetLevels(&debug, nil, 0)
+	if st := Levels(); st.Level != DebugLevel || !st.RevertAt.IsZero() {
+		t.Errorf("unexpected state: %+v", st)
+	}
+}
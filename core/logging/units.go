@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"nvelox/config"
+)
+
+// units rendered by FormatDuration and FormatSize, the defaults when unset.
+var units atomic.Pointer[config.LogUnits]
+
+// SetUnits selects the units of durations and byte counts in access log
+// lines and connection logs.
+func SetUnits(u config.LogUnits) {
+	units.Store(&u)
+}
+
+func currentUnits() config.LogUnits {
+	if u := units.Load(); u != nil {
+		return *u
+	}
+	return config.LogUnits{}
+}
+
+// FormatDuration renders d with a fixed unit suffix and a plain decimal
+// number: milliseconds with microsecond resolution ("1200.000ms") unless
+// microseconds ("1200000us") or seconds ("1.200000s") are configured. Unlike
+// time.Duration.String the unit never changes with the value.
+func FormatDuration(d time.Duration) string {
+	switch currentUnits().Duration {
+	case config.DurationMicros:
+		return strconv.FormatInt(d.Microseconds(), 10) + "us"
+	case config.DurationSeconds:
+		return strconv.FormatFloat(d.Seconds(), 'f', 6, 64) + "s"
+	default:
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64) + "ms"
+	}
+}
+
+// sizeUnits are the binary prefixes of human sizes.
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// FormatSize renders n bytes as a plain integer, or with size: human as a
+// binary multiple with one decimal ("512B", "1.5KiB", "12.0MiB").
+func FormatSize(n int64) string {
+	if currentUnits().Size != config.SizeHuman {
+		return strconv.FormatInt(n, 10)
+	}
+	if n < 1024 && n > -1024 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	v, unit := float64(n)/1024, sizeUnits[0]
+	for _, u := range sizeUnits[1:] {
+		if v < 1024 && v > -1024 {
+			break
+		}
+		v, unit = v/1024, u
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64) + unit
+}
+
+// ParseSize reads a byte count written by FormatSize in either unit. Human
+// sizes come back rounded to their one decimal.
+func ParseSize(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if n, ok := strings.CutSuffix(s, "B"); ok && !strings.HasSuffix(n, "i") {
+		return strconv.ParseInt(n, 10, 64)
+	}
+	mult := float64(1)
+	for _, u := range sizeUnits {
+		mult *= 1024
+		if v, ok := strings.CutSuffix(s, u); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(f * mult), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid size %q", s)
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"nvelox/core/logging"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const (
+	// parkAcceptBackoff is how long a parked port waits after a failed accept.
+	parkAcceptBackoff = 10 * time.Millisecond
+	// hotLoopTick keeps the ticker of a promoted loop from waking it.
+	hotLoopTick = 24 * time.Hour
+)
+
+// parker serves the ports of a park_idle listener block without event loops
+// of their own. Every port is a plain socket on the Go runtime poller, which
+// all parked ports share and which sleeps until a connection arrives. The
+// first connection on a port promotes it: a single event loop is started on
+// the port next to the parked socket (SO_REUSEPORT) and the connection is
+// handed to it. Connections the kernel still queues on the parked socket are
+// handed over the same way, so a promoted port never refuses one. Promoted
+// ports stay hot until the group is stopped.
+type parker struct {
+	handler *ProxyEventHandler
+
+	mu      sync.Mutex
+	sockets []net.Listener
+	hot     map[*ListenerConfig]*hotLoop
+	closed  bool
+}
+
+// hotLoop is the event loop of a promoted port. It shares the handler, and
+// with it the connections and listener map, of its group.
+type hotLoop struct {
+	*ProxyEventHandler
+	eng     gnet.Engine
+	running chan struct{}
+	once    sync.Once
+	done    chan error
+}
+
+func (l *hotLoop) OnBoot(eng gnet.Engine) gnet.Action {
+	l.eng = eng
+	return gnet.None
+}
+
+// OnTick first runs once the event loops are registered, before which gnet
+// cannot take connections from outside; it is not needed after that. Promoted
+// loops are not probed for Heartbeat, which would wake them every loopTick.
+func (l *hotLoop) OnTick() (time.Duration, gnet.Action) {
+	l.once.Do(func() { close(l.running) })
+	return hotLoopTick, gnet.None
+}
+
+// parks reports whether a listener group is parked instead of started.
+func parks(listeners []*ListenerConfig) bool {
+	for _, l := range listeners {
+		if !l.ParkIdle || l.Protocol == "udp" {
+			return false
+		}
+	}
+	if !reusePortSupported {
+		logging.Warn("[PARK] park_idle is not supported on this platform, starting event loops")
+		return false
+	}
+	return len(listeners) > 0
+}
+
+// newParker binds the parked sockets of a group; on failure none stay bound.
+func newParker(h *ProxyEventHandler, listeners []*ListenerConfig) (*parker, error) {
+	p := &parker{handler: h, hot: make(map[*ListenerConfig]*hotLoop)}
+	h.unprobed = true
+	for _, l := range listeners {
+		lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+			if err := reusePort(network, address, c); err != nil {
+				return err
+			}
+			if err := bindToDevice(c, l.Interface); err != nil {
+				return err
+			}
+			return controlListenSocket(c, l.Socket)
+		}}
+		ln, err := lc.Listen(context.Background(), "tcp", l.Addr)
+		if err != nil {
+			p.stop()
+			return nil, fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+		p.sockets = append(p.sockets, ln)
+		if err := setBacklog(ln, l.Socket.Backlog); err != nil {
+			p.stop()
+			return nil, fmt.Errorf("listener %s socket: %w", l.Name, err)
+		}
+		go p.serve(l, ln)
+	}
+	return p, nil
+}
+
+// serve accepts connections on a parked socket until it is closed.
+func (p *parker) serve(l *ListenerConfig, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logging.Warn("[PARK] listener %s: %v", l.Name, err)
+			time.Sleep(parkAcceptBackoff)
+			continue
+		}
+		loop, err := p.promote(l, ln.Addr())
+		if err == nil {
+			err = loop.enroll(conn)
+		}
+		if err != nil {
+			logging.Error("[PARK] listener %s: dropping %s: %v", l.Name, conn.RemoteAddr(), err)
+			conn.Close()
+		}
+	}
+}
+
+// promote returns the event loop of a port, starting it on the first call.
+func (p *parker) promote(l *ListenerConfig, addr net.Addr) (*hotLoop, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, net.ErrClosed
+	}
+	if loop, ok := p.hot[l]; ok {
+		return loop, nil
+	}
+
+	// Bind the port the parked socket got, which differs from l.Addr for port 0
+	host, _, _ := net.SplitHostPort(l.Addr)
+	_, port, _ := net.SplitHostPort(addr.String())
+	loop := &hotLoop{ProxyEventHandler: p.handler, running: make(chan struct{}), done: make(chan error, 1)}
+	go func() {
+		// A promoted port gets one loop, not one per CPU, so that promotion
+		// keeps the cost of a port low. Connections are enrolled from
+		// outside the loop, which the default round-robin balancing does not
+		// allow
+		opts := append(p.handler.engine.gnetOptions([]*ListenerConfig{l}),
+			gnet.WithMulticore(false), gnet.WithNumEventLoop(1),
+			gnet.WithLoadBalancing(gnet.LeastConnections))
+		loop.done <- gnet.Run(loop, "tcp://"+net.JoinHostPort(host, port), opts...)
+	}()
+	select {
+	case <-loop.running:
+	case err := <-loop.done:
+		if err == nil {
+			err = fmt.Errorf("event loop exited before it ran")
+		}
+		return nil, err
+	}
+	if tunesListening(l) {
+		if err := tuneListeners(l); err != nil {
+			logging.Warn("[PARK] %v", err)
+		}
+	}
+	p.hot[l] = loop
+	logging.Info("[PARK] listener %s promoted to an event loop on its first connection", l.Name)
+	return loop, nil
+}
+
+// enroll hands a connection accepted on the parked socket to the loop.
+func (l *hotLoop) enroll(conn net.Conn) error {
+	res, err := l.eng.Register(gnet.NewNetConnContext(context.Background(), conn))
+	if err != nil {
+		return err
+	}
+	return (<-res).Err
+}
+
+// listeners returns the parked sockets.
+func (p *parker) listeners() []net.Listener {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]net.Listener(nil), p.sockets...)
+}
+
+// closeSockets closes the parked sockets; ports not promoted yet stay cold.
+func (p *parker) closeSockets() {
+	p.mu.Lock()
+	p.closed = true
+	sockets := p.sockets
+	p.mu.Unlock()
+	for _, ln := range sockets {
+		ln.Close()
+	}
+}
+
+// stop closes the parked sockets and stops the promoted event loops.
+func (p *parker) stop() {
+	p.closeSockets()
+	p.mu.Lock()
+	loops := make([]*hotLoop, 0, len(p.hot))
+	for _, loop := range p.hot {
+		loops = append(loops, loop)
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), groupStopTimeout)
+	defer cancel()
+	for _, loop := range loops {
+		if err := loop.eng.Stop(ctx); err != nil {
+			logging.Warn("[PARK] stopping event loop: %v", err)
+		}
+	}
+}
+
+// promoted returns the number of ports running an event loop.
+func (p *parker) promoted() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.hot)
+}
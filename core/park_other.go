@@ -0,0 +1,11 @@
+//go:build !linux
+
+package core
+
+import "syscall"
+
+const reusePortSupported = false
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
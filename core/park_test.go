@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_ParkIdle(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("park_idle needs SO_REUSEPORT")
+	}
+	first, second := freePort(t), freePort(t)
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "echo", Servers: []config.Server{{Address: echoServer(t)}}}},
+		Listeners: []config.Listener{{
+			Name:           "range",
+			Bind:           config.Binds{fmt.Sprintf("127.0.0.1:%d", first), fmt.Sprintf("127.0.0.1:%d", second)},
+			Protocol:       "tcp",
+			DefaultBackend: "echo",
+			ParkIdle:       true,
+		}},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	engine.mu.RLock()
+	p := engine.groups["range"].parked
+	engine.mu.RUnlock()
+	if p == nil {
+		t.Fatal("park_idle group started event loops")
+	}
+	if n := p.promoted(); n != 0 {
+		t.Fatalf("%d ports promoted before any traffic", n)
+	}
+
+	// The first connection promotes its port and is proxied by the new loop
+	for i := 0; i < 3; i++ {
+		c, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", first), time.Second)
+		if err != nil {
+			t.Fatalf("dial %d failed: %v", i, err)
+		}
+		roundTrip(t, c, fmt.Sprintf("hello %d", i))
+		c.Close()
+	}
+	if n := p.promoted(); n != 1 {
+		t.Errorf("promoted = %d, want only the port that saw traffic", n)
+	}
+}
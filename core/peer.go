@@ -0,0 +1,64 @@
+package core
+
+import (
+	"maps"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+	"nvelox/proxy"
+)
+
+// peerRoute returns the backend the "backend" hint of a connection's peer
+// metadata names, on a listener with peer.route; "" to use the default
+// backend.
+func (h *ProxyEventHandler) peerRoute(ctx *ConnContext, l *ListenerConfig) string {
+	if !l.Peer.Route {
+		return ""
+	}
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	name := ctx.peerHints["backend"]
+	if name == "" || name == ctx.backendName {
+		return ""
+	}
+	if _, ok := h.engine.balancer(name); !ok {
+		logging.Warn("[PROXY] peer hint names unknown backend %s for %s on %s", name, ctx.Client, l.Name)
+		return ""
+	}
+	ctx.backendName = name
+	return name
+}
+
+// peerTLVs returns the TLVs carrying the peer metadata of a connection to a
+// proxy_v2_peer backend, none for other backends. The connection keeps the
+// ID and tenant of the metadata it arrived with; otherwise it gets a new ID
+// and the tenant of its listener. Hints from the instance in front win over
+// those of the listener. UDP sessions, without a ctx, get a new ID per
+// session.
+func (h *ProxyEventHandler) peerTLVs(ctx *ConnContext, l *ListenerConfig, be *config.Backend) []proxy.TLV {
+	if !be.ProxyV2Peer {
+		return nil
+	}
+	peer := proxy.Peer{ConnID: newSessionID(), Tenant: l.Peer.Tenant, Hints: maps.Clone(l.Peer.Hints)}
+	if ctx != nil {
+		ctx.mu.Lock()
+		if ctx.ConnID == "" {
+			ctx.ConnID = peer.ConnID
+		}
+		if ctx.Tenant == "" {
+			ctx.Tenant = peer.Tenant
+		}
+		peer.ConnID, peer.Tenant = ctx.ConnID, ctx.Tenant
+		if len(ctx.peerHints) > 0 && peer.Hints == nil {
+			peer.Hints = make(map[string]string, len(ctx.peerHints))
+		}
+		maps.Copy(peer.Hints, ctx.peerHints)
+		ctx.mu.Unlock()
+	}
+	tlv, err := peer.TLV()
+	if err != nil {
+		logging.Warn("[PROXY] dropping peer metadata on backend %s: %v", be.Name, err)
+		return nil
+	}
+	return []proxy.TLV{tlv}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"net"
+	"testing"
+
+	"nvelox/config"
+	"nvelox/lb"
+	"nvelox/proxy"
+)
+
+func TestPeerMetadata(t *testing.T) {
+	engine := NewEngine(&config.Config{Version: "2"})
+	engine.Balancers["eu"] = lb.NewPool("roundrobin", []lb.Server{{Address: "10.0.0.1:80", Weight: lb.DefaultWeight}})
+	h := &ProxyEventHandler{engine: engine}
+	edge := &ListenerConfig{Name: "edge", ListenerOptions: ListenerOptions{
+		Peer: config.PeerConfig{Tenant: "acme", Hints: map[string]string{"region": "eu", "backend": "eu"}},
+	}}
+	regional := &ListenerConfig{Name: "regional", DefaultBackend: "default", ListenerOptions: ListenerOptions{
+		Peer: config.PeerConfig{Route: true},
+	}}
+	peerBackend := &config.Backend{Name: "regional", ProxyV2Peer: true}
+
+	// The edge gives the connection an ID and its tenant
+	edgeCtx := &ConnContext{Client: "203.0.113.7:40000"}
+	if tlvs := h.peerTLVs(edgeCtx, edge, &config.Backend{Name: "plain"}); tlvs != nil {
+		t.Errorf("TLVs for a backend without proxy_v2_peer: %v", tlvs)
+	}
+	tlvs := h.peerTLVs(edgeCtx, edge, peerBackend)
+	if len(tlvs) != 1 || edgeCtx.ConnID == "" || edgeCtx.Tenant != "acme" {
+		t.Fatalf("edge: tlvs %v, conn ID %q, tenant %q", tlvs, edgeCtx.ConnID, edgeCtx.Tenant)
+	}
+
+	// The regional tier takes them from the header and routes by hint
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}
+	ctx := &ConnContext{Client: "10.0.0.2:5000", awaitProxy: true, backendName: "default", connect: func() {}}
+	if _, err := h.readProxyHeader(ctx, regional, proxyHeader(t, src, dst, tlvs...)); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.ConnID != edgeCtx.ConnID || ctx.Tenant != "acme" || ctx.peerHints["region"] != "eu" {
+		t.Errorf("regional: conn ID %q tenant %q hints %v", ctx.ConnID, ctx.Tenant, ctx.peerHints)
+	}
+	if got := h.peerRoute(ctx, regional); got != "eu" || ctx.backendName != "eu" {
+		t.Errorf("peerRoute = %q, backend %q, want eu", got, ctx.backendName)
+	}
+
+	// Passed on unchanged to a further tier, hints from the front winning
+	third := &ListenerConfig{Name: "third", ListenerOptions: ListenerOptions{
+		Peer: config.PeerConfig{Tenant: "other", Hints: map[string]string{"region": "us", "zone": "a"}},
+	}}
+	tlvs = h.peerTLVs(ctx, third, peerBackend)
+	v, _ := (&proxy.Header{TLVs: tlvs}).TLV(proxy.TLVPeer)
+	peer, err := proxy.ParsePeer(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.ConnID != edgeCtx.ConnID || peer.Tenant != "acme" || peer.Hints["region"] != "eu" || peer.Hints["zone"] != "a" {
+		t.Errorf("third tier metadata = %+v", peer)
+	}
+
+	// Unknown backends and listeners without route keep the default
+	ctx = &ConnContext{backendName: "default", peerHints: map[string]string{"backend": "missing"}}
+	if got := h.peerRoute(ctx, regional); got != "" || ctx.backendName != "default" {
+		t.Errorf("unknown backend hint routed to %q", got)
+	}
+	ctx.peerHints["backend"] = "eu"
+	if got := h.peerRoute(ctx, edge); got != "" {
+		t.Errorf("listener without route routed to %q", got)
+	}
+}
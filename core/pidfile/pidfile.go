@@ -0,0 +1,96 @@
+// Package pidfile writes the process id to a file and holds a lock on it, so
+// that a second instance using the same file refuses to start.
+package pidfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrLocked is returned by Acquire when another process holds the file.
+var ErrLocked = errors.New("pid file locked by another process")
+
+// File is an acquired pid file, locked until Release or process exit.
+type File struct {
+	f    *os.File
+	path string
+}
+
+// Acquire creates or opens the file at path, locks it and writes the id of
+// this process. A file left behind by a process that is gone is reused; the
+// lock, not the file's existence, tells whether an instance is running.
+func Acquire(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f); err != nil {
+		defer f.Close()
+		if errors.Is(err, ErrLocked) {
+			if pid := readPID(f); pid > 0 {
+				return nil, fmt.Errorf("%w: pid %d", ErrLocked, pid)
+			}
+		}
+		return nil, err
+	}
+	return Inherit(f, path)
+}
+
+// Inherit takes over a pid file at path that is already locked, such as the
+// one passed by the process this one replaces, and writes the id of this
+// process. The lock belongs to the open file and so moves with it.
+func Inherit(f *os.File, path string) (*File, error) {
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &File{f: f, path: path}, nil
+}
+
+// File returns the locked file, to pass it to the process taking over.
+func (p *File) File() *os.File {
+	return p.f
+}
+
+// Detach closes the file without removing it, once the process it was passed
+// to took over; that process now holds the lock. Release does nothing after.
+func (p *File) Detach() error {
+	f := p.f
+	p.f = nil
+	return f.Close()
+}
+
+// Release removes the file and drops the lock. When the file cannot be
+// removed, for instance after privileges were dropped, it is emptied instead
+// so no stale id is left for init scripts to find.
+func (p *File) Release() error {
+	if p.f == nil {
+		return nil
+	}
+	err := os.Remove(p.path)
+	if err != nil {
+		err = p.f.Truncate(0)
+	}
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readPID(f *os.File) int {
+	b := make([]byte, 32)
+	n, _ := f.ReadAt(b, 0)
+	pid, _ := strconv.Atoi(string(bytes.TrimSpace(b[:n])))
+	return pid
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package pidfile
+
+import "os"
+
+// Without flock the file is written but not locked.
+func lock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nvelox.pid")
+	// Left behind by a process that is gone
+	os.WriteFile(path, []byte("999999\n"), 0o644)
+
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if string(b) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("pid file contains %q", b)
+	}
+
+	if runtime.GOOS != "windows" {
+		if _, err := Acquire(path); !errors.Is(err, ErrLocked) {
+			t.Errorf("second Acquire: expected ErrLocked, got %v", err)
+		}
+	}
+
+	if err := p.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pid file not removed: %v", err)
+	}
+
+	// Free again once released
+	p, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after Release failed: %v", err)
+	}
+	p.Release()
+}
@@ -0,0 +1,54 @@
+//go:build unix
+
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestDetach(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nvelox.pid")
+	p, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	// The copy a replacing process inherits shares the lock
+	fd, err := syscall.Dup(int(p.File().Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed := os.NewFile(uintptr(fd), "pidfile")
+
+	if err := p.Detach(); err != nil {
+		t.Fatalf("Detach failed: %v", err)
+	}
+	if err := p.Release(); err != nil {
+		t.Errorf("Release after Detach: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("pid file removed by Detach: %v", err)
+	}
+	if _, err := Acquire(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("Acquire after Detach: expected ErrLocked, got %v", err)
+	}
+
+	q, err := Inherit(passed, path)
+	if err != nil {
+		t.Fatalf("Inherit failed: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if string(b) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("pid file contains %q", b)
+	}
+	if err := q.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pid file not removed: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package ports finds listener addresses that another socket already holds.
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// Addr is an address a listener binds.
+type Addr struct {
+	Listener string
+	Network  string // "tcp" or "udp"
+	Address  string
+}
+
+// Conflict is an address that could not be bound because it is in use.
+type Conflict struct {
+	Addr
+	PID     int    // owning process, 0 when it is not visible to us
+	Process string // its command name
+}
+
+func (c Conflict) String() string {
+	if c.PID == 0 {
+		return fmt.Sprintf("%s %s is already in use (owner not visible, run as root to see it)", c.Network, c.Address)
+	}
+	if c.Process == "" {
+		return fmt.Sprintf("%s %s is already in use by pid %d", c.Network, c.Address, c.PID)
+	}
+	return fmt.Sprintf("%s %s is already in use by %s (pid %d)", c.Network, c.Address, c.Process, c.PID)
+}
+
+// Ours reports whether the owner runs the same program as this process,
+// typically the running instance a configuration is checked for.
+func (c Conflict) Ours() bool {
+	return c.Process != "" && c.Process == self()
+}
+
+// Check binds every address briefly and returns those already in use, with
+// the owning process where the system reveals it. Other bind errors, such
+// as a privileged port or an address not on this host, are not reported.
+func Check(addrs []Addr) []Conflict {
+	conflicts := make([]Conflict, 0)
+	var owner ownerFunc
+	for _, a := range addrs {
+		if !inUse(a.Network, a.Address) {
+			continue
+		}
+		if owner == nil {
+			owner = owners()
+		}
+		c := Conflict{Addr: a}
+		if _, port, err := net.SplitHostPort(a.Address); err == nil {
+			if n, err := strconv.Atoi(port); err == nil {
+				c.PID, c.Process = owner(a.Network, n)
+			}
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+func inUse(network, address string) bool {
+	var err error
+	if network == "udp" {
+		var pc net.PacketConn
+		if pc, err = net.ListenPacket(network, address); err == nil {
+			pc.Close()
+		}
+	} else {
+		var l net.Listener
+		if l, err = net.Listen(network, address); err == nil {
+			l.Close()
+		}
+	}
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// ownerFunc returns the pid and command name of the process holding a
+// socket bound to port, or 0 and "" when it cannot tell.
+type ownerFunc func(network string, port int) (int, string)
@@ -0,0 +1,102 @@
+//go:build linux
+
+package ports
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the st column of a listening socket in /proc/net/tcp.
+const tcpListen = "0A"
+
+// owners reads which process holds which socket from /proc once. Processes
+// of other users are skipped unless we run as root.
+func owners() ownerFunc {
+	procs := socketProcs("/proc")
+	return func(network string, port int) (int, string) {
+		for _, table := range []string{network, network + "6"} {
+			for _, inode := range boundInodes(filepath.Join("/proc/net", table), network, port) {
+				if pid, ok := procs[inode]; ok {
+					return pid, comm(pid)
+				}
+			}
+		}
+		return 0, ""
+	}
+}
+
+// socketProcs maps socket inodes to the pid holding them.
+func socketProcs(proc string) map[string]int {
+	out := make(map[string]int)
+	entries, _ := os.ReadDir(proc)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(proc, e.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // not ours to look at
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				out[strings.TrimSuffix(inode, "]")] = pid
+			}
+		}
+	}
+	return out
+}
+
+// boundInodes returns the inodes of the sockets in a /proc/net table bound
+// to port; for TCP only listening ones.
+func boundInodes(path, network string, port int) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	out := make([]string, 0)
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseInt(hexPort, 16, 32); err != nil || int(p) != port {
+			continue
+		}
+		if network == "tcp" && fields[3] != tcpListen {
+			continue
+		}
+		out = append(out, fields[9])
+	}
+	return out
+}
+
+func comm(pid int) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func self() string {
+	return comm(os.Getpid())
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package ports
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBoundInodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcp")
+	os.WriteFile(path, []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0050 0100007F:C350 01 00000000:00000000 00:00000000 00000000     0        0 2222 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3333 1 0000000000000000 100 0 0 10 0
+`), 0644)
+
+	if got := boundInodes(path, "tcp", 80); !slices.Equal(got, []string{"1111"}) {
+		t.Errorf("tcp port 80: %v, want the listening socket only", got)
+	}
+	if got := boundInodes(path, "udp", 80); !slices.Equal(got, []string{"1111", "2222"}) {
+		t.Errorf("udp port 80: %v, want every socket", got)
+	}
+	if got := boundInodes(path, "tcp", 8080); !slices.Equal(got, []string{"3333"}) {
+		t.Errorf("tcp port 8080: %v", got)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ports
+
+func owners() ownerFunc {
+	return func(string, int) (int, string) { return 0, "" }
+}
+
+func self() string {
+	return ""
+}
@@ -0,0 +1,41 @@
+package ports
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	free, _ := net.Listen("tcp", "127.0.0.1:0")
+	freeAddr := free.Addr().String()
+	free.Close()
+
+	conflicts := Check([]Addr{
+		{Listener: "web", Network: "tcp", Address: ln.Addr().String()},
+		{Listener: "dns", Network: "udp", Address: pc.LocalAddr().String()},
+		{Listener: "free", Network: "tcp", Address: freeAddr},
+	})
+	if len(conflicts) != 2 || conflicts[0].Listener != "web" || conflicts[1].Listener != "dns" {
+		t.Fatalf("unexpected conflicts: %+v", conflicts)
+	}
+	if runtime.GOOS != "linux" {
+		return
+	}
+	for _, c := range conflicts {
+		if c.PID != os.Getpid() || !c.Ours() {
+			t.Errorf("%s: owner pid %d (%s), want this process %d", c.Listener, c.PID, c.Process, os.Getpid())
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+	"nvelox/preauth"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// preambleTimeout is how long a client of a preauth listener has to send
+// its preamble.
+const preambleTimeout = 5 * time.Second
+
+// preauthGate authenticates the clients of a listener block with preauth.
+// Like the rate limiter it is shared by all listeners expanded from the
+// block, its knock listener included, and starts empty on a reload.
+type preauthGate struct {
+	secret []byte        // nil without a preamble
+	skew   time.Duration // accepted preamble clock difference
+	knocks bool          // clients need a knock first
+	ttl    time.Duration // how long a knock admits its client
+
+	mu      sync.Mutex
+	nonces  map[string]time.Time     // preamble nonces seen, until they expire
+	knocked map[netip.Addr]time.Time // client -> end of its admission
+	sweep   time.Time                // next pruning of both maps
+}
+
+// newPreauthGate returns nil when the listener admits everyone.
+func newPreauthGate(cfg config.PreauthConfig) *preauthGate {
+	if !cfg.Enabled() {
+		return nil
+	}
+	skew, ttl := cfg.Limits()
+	g := &preauthGate{
+		skew:    skew,
+		knocks:  cfg.Knock != "",
+		ttl:     ttl,
+		nonces:  make(map[string]time.Time),
+		knocked: make(map[netip.Addr]time.Time),
+	}
+	if secret := cfg.Secret.Value(); secret != "" {
+		g.secret = []byte(secret)
+	}
+	return g
+}
+
+// preamble reports whether connections on l start with a preamble: those of
+// the knock listener with a knock, all of them without.
+func (g *preauthGate) preamble(l *ListenerConfig) bool {
+	return g != nil && g.secret != nil && (l.Knock || !g.knocks)
+}
+
+// verify checks the preamble data starts with and returns its length. A
+// preamble is good once: a replayed one fails like a forged one.
+func (g *preauthGate) verify(data []byte, now time.Time) (int, error) {
+	nonce, n, err := preauth.Parse(data, g.secret, now, g.skew)
+	if err != nil {
+		return 0, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+	if _, seen := g.nonces[nonce]; seen {
+		return 0, errors.New("preamble replayed")
+	}
+	g.nonces[nonce] = now.Add(2 * g.skew)
+	return n, nil
+}
+
+// knock admits client, an "ip:port" address, for the knock TTL.
+func (g *preauthGate) knock(client string, now time.Time) {
+	ap, err := netip.ParseAddrPort(client)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+	g.knocked[ap.Addr().Unmap()] = now.Add(g.ttl)
+}
+
+// admits reports whether client may connect to the backend: without a knock
+// listener anyone who got this far, with one those who knocked recently.
+func (g *preauthGate) admits(client string, now time.Time) bool {
+	if g == nil || !g.knocks {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(client)
+	if err != nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	until, ok := g.knocked[ap.Addr().Unmap()]
+	return ok && now.Before(until)
+}
+
+// prune drops expired nonces and knocks, at most once per TTL or skew.
+// Callers hold g.mu.
+func (g *preauthGate) prune(now time.Time) {
+	if now.Before(g.sweep) {
+		return
+	}
+	g.sweep = now.Add(min(g.ttl, g.skew))
+	for nonce, until := range g.nonces {
+		if !now.Before(until) {
+			delete(g.nonces, nonce)
+		}
+	}
+	for addr, until := range g.knocked {
+		if !now.Before(until) {
+			delete(g.knocked, addr)
+		}
+	}
+}
+
+// watchPreamble closes a connection whose preamble has not arrived within
+// preambleTimeout.
+func (h *ProxyEventHandler) watchPreamble(lifetime context.Context, c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+	timer := h.clock().NewTimer(preambleTimeout)
+	defer timer.Stop()
+	select {
+	case <-lifetime.Done():
+		return
+	case <-timer.C():
+	}
+	ctx.mu.Lock()
+	waiting := ctx.awaitAuth
+	if waiting {
+		ctx.reason = StatusPreauthFail
+	}
+	ctx.mu.Unlock()
+	if waiting {
+		logging.Warn("[PREAUTH] no preamble from %s on %s within %s", c.RemoteAddr(), l.Name, preambleTimeout)
+		h.safeClose(c, ctx)
+	}
+}
+
+// readPreamble consumes the preamble a connection starts with, after any
+// PROXY header, buffering it across reads, and returns the client bytes
+// that follow it. It returns preauth.ErrIncomplete until the preamble is
+// complete. Callers hold ctx.mu.
+func (h *ProxyEventHandler) readPreamble(ctx *ConnContext, l *ListenerConfig, data []byte) ([]byte, error) {
+	if ctx.authBuf != nil {
+		ctx.authBuf = append(ctx.authBuf, data...)
+		data = ctx.authBuf
+	}
+	n, err := l.preauth.verify(data, h.clock().Now())
+	if errors.Is(err, preauth.ErrIncomplete) {
+		if ctx.authBuf == nil {
+			ctx.authBuf = append([]byte(nil), data...)
+		}
+		return nil, err
+	}
+	ctx.authBuf = nil
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.awaitAuth = false
+	ctx.trace.event(traceInspected, "preauth client=%s", ctx.Client)
+	ctx.proceed()
+	return data[n:], nil
+}
+
+// knock admits the client of a connection to the knock listener of a block
+// and closes the connection.
+func (h *ProxyEventHandler) knock(c gnet.Conn, ctx *ConnContext, l *ListenerConfig) {
+	l.preauth.knock(ctx.Client, h.clock().Now())
+	ctx.reason = StatusKnock
+	logging.Info("[PREAUTH] %s knocked on %s", ctx.Client, l.Name)
+	h.safeClose(c, ctx)
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/preauth"
+)
+
+const testPreauthSecret = "0123456789abcdef"
+
+func TestPreauthGate_Preamble(t *testing.T) {
+	g := newPreauthGate(config.PreauthConfig{Secret: config.Secret{Ref: testPreauthSecret}})
+	h := &ProxyEventHandler{}
+	l := &ListenerConfig{Name: "ssh", ListenerOptions: ListenerOptions{preauth: g}}
+	if !g.preamble(l) || !g.admits("192.0.2.1:5000", time.Now()) {
+		t.Fatal("a preamble listener should want a preamble and no knock")
+	}
+	p, err := preauth.Preamble([]byte(testPreauthSecret), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the PROXY header, fragmented, followed by client bytes
+	connected := 0
+	ctx := &ConnContext{Client: "10.0.0.2:5000", awaitProxy: true, awaitAuth: true, connect: func() { connected++ }}
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	if _, err := h.readProxyHeader(ctx, l, proxyHeader(t, src, src)); err != nil {
+		t.Fatal(err)
+	}
+	if connected != 0 {
+		t.Fatal("connected before the preamble")
+	}
+	if _, err := h.readPreamble(ctx, l, p[:20]); !errors.Is(err, preauth.ErrIncomplete) {
+		t.Fatalf("partial preamble: err = %v", err)
+	}
+	payload, err := h.readPreamble(ctx, l, append(p[20:], "SSH-2.0"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "SSH-2.0" || ctx.awaitAuth || connected != 1 {
+		t.Errorf("payload = %q, awaitAuth = %v, connected = %d", payload, ctx.awaitAuth, connected)
+	}
+
+	// The same preamble again is a replay
+	ctx = &ConnContext{awaitAuth: true}
+	if _, err := h.readPreamble(ctx, l, p); err == nil {
+		t.Error("replayed preamble accepted")
+	}
+	ctx = &ConnContext{awaitAuth: true}
+	if _, err := h.readPreamble(ctx, l, []byte("SSH-2.0-OpenSSH\r\n")); !errors.Is(err, preauth.ErrInvalid) {
+		t.Errorf("no preamble: err = %v", err)
+	}
+}
+
+func TestPreauthGate_Knock(t *testing.T) {
+	g := newPreauthGate(config.PreauthConfig{Knock: ":7000", KnockTTL: "10s"})
+	knock := &ListenerConfig{Name: "ssh-knock", Knock: true, ListenerOptions: ListenerOptions{preauth: g}}
+	ssh := &ListenerConfig{Name: "ssh", ListenerOptions: ListenerOptions{preauth: g}}
+	if g.preamble(knock) || g.preamble(ssh) {
+		t.Error("no preamble without a secret")
+	}
+
+	now := time.Now()
+	if g.admits("192.0.2.1:5000", now) {
+		t.Error("admitted without a knock")
+	}
+	g.knock("[::ffff:192.0.2.1]:4000", now)
+	if !g.admits("192.0.2.1:5001", now.Add(9*time.Second)) {
+		t.Error("not admitted after a knock")
+	}
+	if g.admits("192.0.2.2:5000", now) || g.admits("192.0.2.1:5000", now.Add(10*time.Second)) {
+		t.Error("admitted another client, or after the knock expired")
+	}
+
+	// With a secret the knock carries the preamble, the real connections none
+	g = newPreauthGate(config.PreauthConfig{Secret: config.Secret{Ref: testPreauthSecret}, Knock: ":7000"})
+	knock.preauth, ssh.preauth = g, g
+	if !g.preamble(knock) || g.preamble(ssh) {
+		t.Error("only the knock should want a preamble")
+	}
+	if newPreauthGate(config.PreauthConfig{}) != nil {
+		t.Error("gate without preauth")
+	}
+}
+
+func TestExpandListener_Knock(t *testing.T) {
+	expanded, err := ExpandListener(config.Listener{
+		Name: "ssh", Bind: config.Binds{":2222"}, Protocol: "tcp", DefaultBackend: "ssh",
+		Preauth: config.PreauthConfig{Knock: "127.0.0.1:7000"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expanded) != 2 {
+		t.Fatalf("expanded into %d listeners, want 2", len(expanded))
+	}
+	k := expanded[1]
+	if !k.Knock || k.Name != "ssh-knock" || k.Group != "ssh" || k.Addr != "127.0.0.1:7000" || k.Port != 7000 {
+		t.Errorf("knock listener = %+v", k)
+	}
+	if expanded[0].Knock || expanded[0].preauth != k.preauth {
+		t.Error("the listeners of the block should share one gate")
+	}
+}
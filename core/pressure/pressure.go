@@ -0,0 +1,18 @@
+// Package pressure samples system resource usage for load shedding.
+package pressure
+
+import "errors"
+
+var ErrUnsupported = errors.New("system pressure sampling not supported on this platform")
+
+// Sample is a snapshot of system pressure.
+type Sample struct {
+	CPULoad       float64 `json:"cpu_load"`       // 1-minute load average per CPU
+	MemoryPercent float64 `json:"memory_percent"` // share of system memory in use
+	FDPercent     float64 `json:"fd_percent"`     // open descriptors vs RLIMIT_NOFILE of this process
+}
+
+// Read samples the current system pressure.
+func Read() (Sample, error) {
+	return read()
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package pressure
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func read() (Sample, error) {
+	var s Sample
+	var err error
+	if s.CPULoad, err = cpuLoad("/proc/loadavg"); err != nil {
+		return s, err
+	}
+	if s.MemoryPercent, err = memoryPercent("/proc/meminfo"); err != nil {
+		return s, err
+	}
+	if s.FDPercent, err = fdPercent("/proc/self/fd"); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+func cpuLoad(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("malformed %s", path)
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed %s: %w", path, err)
+	}
+	return load / float64(runtime.NumCPU()), nil
+}
+
+func memoryPercent(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var total, available float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = v
+		case "MemAvailable:":
+			available = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("MemTotal missing from %s", path)
+	}
+	return (total - available) / total * 100, nil
+}
+
+func fdPercent(dir string) (float64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	if limit.Cur == 0 {
+		return 0, nil
+	}
+	return float64(len(entries)) / float64(limit.Cur) * 100, nil
+}
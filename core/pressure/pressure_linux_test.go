@@ -0,0 +1,44 @@
+//go:build linux
+
+package pressure
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	dir := t.TempDir()
+	loadavg := filepath.Join(dir, "loadavg")
+	os.WriteFile(loadavg, []byte("4.00 2.00 1.00 1/100 12345\n"), 0644)
+	meminfo := filepath.Join(dir, "meminfo")
+	os.WriteFile(meminfo, []byte("MemTotal:       1000 kB\nMemFree:         100 kB\nMemAvailable:    250 kB\n"), 0644)
+
+	load, err := cpuLoad(loadavg)
+	if err != nil {
+		t.Fatalf("cpuLoad failed: %v", err)
+	}
+	if want := 4.0 / float64(runtime.NumCPU()); load != want {
+		t.Errorf("cpuLoad = %v, want %v", load, want)
+	}
+
+	mem, err := memoryPercent(meminfo)
+	if err != nil {
+		t.Fatalf("memoryPercent failed: %v", err)
+	}
+	if mem != 75 {
+		t.Errorf("memoryPercent = %v, want 75", mem)
+	}
+}
+
+func TestRead(t *testing.T) {
+	s, err := Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if s.FDPercent <= 0 || s.MemoryPercent <= 0 {
+		t.Errorf("implausible sample: %+v", s)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package pressure
+
+func read() (Sample, error) {
+	return Sample{}, ErrUnsupported
+}
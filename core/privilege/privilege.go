@@ -0,0 +1,17 @@
+// Package privilege switches the process to an unprivileged user once the
+// ports that need root are bound.
+package privilege
+
+import "errors"
+
+var ErrUnsupported = errors.New("dropping privileges not supported on this platform")
+
+// Drop switches the process to the given user and group, names or numeric
+// ids. An empty group selects the primary group of the user, an empty user
+// keeps the current one. Running as them already is not an error.
+func Drop(user, group string) error {
+	if user == "" && group == "" {
+		return nil
+	}
+	return drop(user, group)
+}
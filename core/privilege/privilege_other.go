@@ -0,0 +1,7 @@
+//go:build !unix
+
+package privilege
+
+func drop(user, group string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,89 @@
+//go:build unix
+
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"syscall"
+)
+
+func drop(userName, groupName string) error {
+	uid, gid := os.Getuid(), os.Getgid()
+	var groups []int
+	if userName != "" {
+		u, err := lookupUser(userName)
+		if err != nil {
+			return err
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+		// Supplementary groups, as login would set them
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if n, err := strconv.Atoi(id); err == nil {
+					groups = append(groups, n)
+				}
+			}
+		}
+	}
+	if groupName != "" {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	if !slices.Contains(groups, gid) {
+		groups = append(groups, gid)
+	}
+
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("switching to uid %d gid %d needs root", uid, gid)
+	}
+	// Groups first, setuid takes away the right to change them
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid %d: %w", uid, err)
+	}
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return errors.New("root privileges could be regained after setuid")
+	}
+	return nil
+}
+
+// lookupUser finds a user by name, or by id for numeric names. Numeric ids
+// without a passwd entry are used as they are, in their own group.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err != nil {
+		return user.Lookup(name)
+	}
+	u, err := user.LookupId(name)
+	if errors.As(err, new(user.UnknownUserIdError)) {
+		return &user.User{Uid: name, Gid: name, Username: name}, nil
+	}
+	return u, err
+}
+
+func lookupGroup(name string) (*user.Group, error) {
+	if _, err := strconv.Atoi(name); err != nil {
+		return user.LookupGroup(name)
+	}
+	g, err := user.LookupGroupId(name)
+	if errors.As(err, new(user.UnknownGroupIdError)) {
+		return &user.Group{Gid: name, Name: name}, nil
+	}
+	return g, err
+}
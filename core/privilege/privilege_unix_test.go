@@ -0,0 +1,30 @@
+//go:build unix
+
+package privilege
+
+import (
+	"os/user"
+	"testing"
+)
+
+func TestDrop(t *testing.T) {
+	if err := Drop("", ""); err != nil {
+		t.Errorf("Drop with nothing configured: %v", err)
+	}
+
+	// Already running as the current user
+	u, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	if err := Drop(u.Uid, ""); err != nil {
+		t.Errorf("Drop to the current user: %v", err)
+	}
+
+	if err := Drop("nvelox-no-such-user", ""); err == nil {
+		t.Error("expected error for an unknown user")
+	}
+	if err := Drop("", "nvelox-no-such-group"); err == nil {
+		t.Error("expected error for an unknown group")
+	}
+}
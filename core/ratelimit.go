@@ -0,0 +1,187 @@
+package core
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+	"nvelox/core/state"
+)
+
+const (
+	defaultRatePeriod = time.Second
+	defaultRateSync   = 100 * time.Millisecond
+)
+
+// rateLimiter counts new connections per client key in fixed windows. It is
+// shared by all listeners expanded from one configured listener block.
+type rateLimiter struct {
+	limit  int
+	period time.Duration
+	key    config.ClientKey
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]int
+
+	// Shared limits count in windows aligned across instances. Connections
+	// are counted in pending until a sync adds them to the fleet counters,
+	// whose last known totals are kept in global.
+	shared   bool
+	sync     time.Duration
+	name     string
+	counter  state.Counter // nil until the engine shares the limiter
+	window   int64
+	pending  map[string]int64
+	global   map[string]int64
+	lastSync time.Time
+	syncing  bool
+	failing  bool
+}
+
+// newRateLimiter returns nil when the limit is disabled.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if cfg.Connections <= 0 {
+		return nil
+	}
+	period := defaultRatePeriod
+	if cfg.Period != "" {
+		if d, err := time.ParseDuration(cfg.Period); err == nil && d > 0 {
+			period = d
+		}
+	}
+	r := &rateLimiter{
+		limit:  cfg.Connections,
+		period: period,
+		key:    cfg.Key,
+		counts: make(map[string]int),
+		shared: cfg.Shared,
+	}
+	if cfg.Shared {
+		r.sync = defaultRateSync
+		if d, err := time.ParseDuration(cfg.Sync); err == nil && d > 0 {
+			r.sync = d
+		}
+		r.pending = make(map[string]int64)
+		r.global = make(map[string]int64)
+	}
+	return r
+}
+
+// share makes a shared limiter count the connections of listener name on
+// every instance using counter.
+func (r *rateLimiter) share(name string, counter state.Counter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.name, r.counter = name, counter
+}
+
+// Allow counts a new connection from addr and reports whether it is within
+// the limit. A nil limiter allows everything.
+func (r *rateLimiter) Allow(addr net.Addr, now time.Time) bool {
+	if r == nil {
+		return true
+	}
+	key := ClientKey(addr, r.key)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shared {
+		return r.allowShared(key, now)
+	}
+	if now.Sub(r.start) >= r.period {
+		r.start = now
+		clear(r.counts)
+	}
+	if r.counts[key] >= r.limit {
+		return false
+	}
+	r.counts[key]++
+	return true
+}
+
+// allowShared checks a connection against the fleet total last synced plus
+// the connections not synced yet, and starts a sync when one is due.
+// Callers hold r.mu.
+func (r *rateLimiter) allowShared(key string, now time.Time) bool {
+	if w := now.UnixNano() / int64(r.period); w != r.window {
+		r.window = w
+		clear(r.pending)
+		clear(r.global)
+	}
+	if r.global[key]+r.pending[key] >= int64(r.limit) {
+		return false
+	}
+	r.pending[key]++
+	if r.counter != nil && !r.syncing && now.Sub(r.lastSync) >= r.sync {
+		deltas := r.pending
+		r.pending = make(map[string]int64)
+		for k, d := range deltas {
+			r.global[k] += d
+		}
+		r.syncing, r.lastSync = true, now
+		go r.push(r.window, deltas)
+	}
+	return true
+}
+
+// push adds the connections of a window to the fleet counters. When the
+// store fails they are kept pending, so the limit holds per instance until
+// it is back.
+func (r *rateLimiter) push(window int64, deltas map[string]int64) {
+	prefix := "ratelimit:" + r.name + ":" + strconv.FormatInt(window, 10) + ":"
+	keyed := make(map[string]int64, len(deltas))
+	for k, d := range deltas {
+		keyed[prefix+k] = d
+	}
+	totals, err := r.counter.Add(keyed, 2*r.period)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncing = false
+	if err != nil && !r.failing {
+		logging.Warn("[RATELIMIT] listener %s: sharing counts failed, limiting per instance: %v", r.name, err)
+	} else if err == nil && r.failing {
+		logging.Info("[RATELIMIT] listener %s: sharing counts again", r.name)
+	}
+	r.failing = err != nil
+	if window != r.window {
+		return
+	}
+	for k, d := range deltas {
+		if err != nil {
+			r.global[k] -= d
+			r.pending[k] += d
+		} else {
+			r.global[k] = totals[prefix+k]
+		}
+	}
+}
+
+// ClientKey returns the aggregation key of a client address: the address
+// itself, or its network when a prefix is configured for its family.
+// IPv4-mapped IPv6 addresses count as IPv4.
+func ClientKey(addr net.Addr, k config.ClientKey) string {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	ip := ap.Addr().Unmap()
+
+	bits := k.IPv6Prefix
+	if ip.Is4() {
+		bits = k.IPv4Prefix
+	}
+	if bits == 0 || bits >= ip.BitLen() {
+		return ip.String()
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return ip.String()
+	}
+	return prefix.String()
+}
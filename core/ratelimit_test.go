@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/state"
+)
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		addr string
+		key  config.ClientKey
+		want string
+	}{
+		{"192.0.2.10:4000", config.ClientKey{}, "192.0.2.10"},
+		{"192.0.2.10:4000", config.ClientKey{IPv4Prefix: 24}, "192.0.2.0/24"},
+		{"[::ffff:192.0.2.10]:4000", config.ClientKey{IPv4Prefix: 24}, "192.0.2.0/24"},
+		{"[2001:db8:1:2:3::1]:4000", config.ClientKey{IPv4Prefix: 24}, "2001:db8:1:2:3::1"},
+		{"[2001:db8:1:2:3::1]:4000", config.ClientKey{IPv6Prefix: 64}, "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2ff:3::1]:4000", config.ClientKey{IPv6Prefix: 56}, "2001:db8:1:200::/56"},
+	}
+	for _, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.addr)
+		if err != nil {
+			t.Fatalf("ResolveTCPAddr(%s): %v", tt.addr, err)
+		}
+		if got := ClientKey(addr, tt.key); got != tt.want {
+			t.Errorf("ClientKey(%s, %+v) = %s, want %s", tt.addr, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(config.RateLimitConfig{}) != nil {
+		t.Fatal("expected nil limiter without connections")
+	}
+
+	r := newRateLimiter(config.RateLimitConfig{Connections: 2, Period: "10s", Key: config.ClientKey{IPv4Prefix: 24}})
+	a := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1000}
+	b := &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 1000}
+	other := &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 1000}
+	now := time.Unix(1000, 0)
+
+	if !r.Allow(a, now) || !r.Allow(b, now) {
+		t.Fatal("connections within the limit rejected")
+	}
+	if r.Allow(a, now.Add(time.Second)) {
+		t.Error("third connection from the same /24 allowed")
+	}
+	if !r.Allow(other, now.Add(time.Second)) {
+		t.Error("connection from another network rejected")
+	}
+	if !r.Allow(a, now.Add(10*time.Second)) {
+		t.Error("connection in the next period rejected")
+	}
+}
+
+func TestRateLimiter_Shared(t *testing.T) {
+	store := state.NewMemory()
+	cfg := config.RateLimitConfig{Connections: 3, Period: "1m", Shared: true, Sync: "1ns"}
+	a, b := newRateLimiter(cfg), newRateLimiter(cfg)
+	a.share("web", store)
+	b.share("web", store)
+	client := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1000}
+	now := time.Unix(600, 0)
+
+	for i := range 2 {
+		if !a.Allow(client, now.Add(time.Duration(i)*time.Millisecond)) {
+			t.Fatalf("connection %d rejected", i)
+		}
+		waitSynced(t, a)
+	}
+	// b learns the fleet total with its first connection
+	if !b.Allow(client, now) {
+		t.Fatal("connection within the fleet limit rejected")
+	}
+	waitSynced(t, b)
+	if b.Allow(client, now.Add(time.Second)) {
+		t.Error("connection over the fleet limit allowed")
+	}
+	if !b.Allow(client, now.Add(time.Minute)) {
+		t.Error("connection in the next window rejected")
+	}
+}
+
+func TestRateLimiter_SharedStoreDown(t *testing.T) {
+	r := newRateLimiter(config.RateLimitConfig{Connections: 2, Period: "1m", Shared: true, Sync: "1ns"})
+	r.share("web", failingCounter{})
+	client := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1000}
+	now := time.Unix(600, 0)
+
+	for i := range 2 {
+		if !r.Allow(client, now.Add(time.Duration(i)*time.Millisecond)) {
+			t.Fatalf("connection %d rejected", i)
+		}
+		waitSynced(t, r)
+	}
+	if r.Allow(client, now.Add(time.Second)) {
+		t.Error("limit not kept per instance while the store is down")
+	}
+}
+
+type failingCounter struct{}
+
+func (failingCounter) Add(map[string]int64, time.Duration) (map[string]int64, error) {
+	return nil, errors.New("connection refused")
+}
+
+// waitSynced waits for the sync a connection started to finish.
+func waitSynced(t *testing.T, r *rateLimiter) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		syncing := r.syncing
+		r.mu.Unlock()
+		if !syncing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("sync did not finish")
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+const (
+	defaultRebalanceThreshold = 1.5
+	defaultRebalanceMinConns  = 10
+	defaultRebalanceMaxClose  = 10
+
+	// rebalanceTick is how often the loop checks which backends are due.
+	rebalanceTick = time.Second
+)
+
+// ServerLoad compares the open connections of a server with its share.
+type ServerLoad struct {
+	Server      string
+	Weight      int
+	Connections int
+	Fair        float64 // connections the server would hold if balanced by weight
+	Close       int     // suggested connections to close, 0 unless overloaded
+}
+
+// RebalancePlan is the connection distribution of a backend and the
+// connections to close to even it out. Only enabled, healthy primary servers
+// with a weight take part.
+type RebalancePlan struct {
+	Backend     string
+	Connections int
+	Servers     []ServerLoad
+}
+
+// Overloaded reports whether the plan suggests closing connections.
+func (p RebalancePlan) Overloaded() bool {
+	for _, s := range p.Servers {
+		if s.Close > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RebalancePlan analyzes the open TCP connections of a backend with the
+// thresholds of its rebalance configuration (defaults when unset).
+func (e *Engine) RebalancePlan(backend string) (RebalancePlan, error) {
+	be, ok := e.backend(backend)
+	if !ok {
+		return RebalancePlan{}, fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+	return e.rebalancePlan(be, e.routedConns(backend)), nil
+}
+
+func (e *Engine) rebalancePlan(be *config.Backend, conns map[string][]*ConnContext) RebalancePlan {
+	rc := be.Rebalance
+	threshold := rc.Threshold
+	if threshold == 0 {
+		threshold = defaultRebalanceThreshold
+	}
+	minConns := rc.MinConns
+	if minConns == 0 {
+		minConns = defaultRebalanceMinConns
+	}
+	maxClose := rc.MaxClose
+	if maxClose == 0 {
+		maxClose = defaultRebalanceMaxClose
+	}
+
+	plan := RebalancePlan{Backend: be.Name, Servers: make([]ServerLoad, 0, len(be.Servers))}
+	status := e.HealthStatus(be.Name)
+	totalWeight := 0
+	for _, s := range be.Servers {
+		if s.Disabled || s.Backup {
+			continue
+		}
+		if healthy, probed := status[s.Address]; probed && !healthy {
+			continue
+		}
+		w := e.ServerWeight(be.Name, s.Address)
+		if w <= 0 {
+			continue // draining
+		}
+		load := ServerLoad{Server: s.Address, Weight: w, Connections: len(conns[s.Address])}
+		plan.Servers = append(plan.Servers, load)
+		plan.Connections += load.Connections
+		totalWeight += w
+	}
+	if plan.Connections == 0 {
+		return plan
+	}
+
+	for i := range plan.Servers {
+		s := &plan.Servers[i]
+		s.Fair = float64(plan.Connections) * float64(s.Weight) / float64(totalWeight)
+	}
+	if plan.Connections < minConns {
+		return plan
+	}
+
+	// Close the excess of the most overloaded servers first, within max_close
+	order := make([]*ServerLoad, 0, len(plan.Servers))
+	for i := range plan.Servers {
+		s := &plan.Servers[i]
+		if float64(s.Connections) > threshold*s.Fair {
+			order = append(order, s)
+		}
+	}
+	excess := func(s *ServerLoad) int { return s.Connections - int(math.Ceil(s.Fair)) }
+	sort.SliceStable(order, func(i, j int) bool { return excess(order[i]) > excess(order[j]) })
+	budget := maxClose
+	for _, s := range order {
+		s.Close = min(excess(s), budget)
+		budget -= s.Close
+	}
+	return plan
+}
+
+// routedConns returns the connected TCP connections of a backend per pool
+// entry, leaving out those already being terminated.
+func (e *Engine) routedConns(backend string) map[string][]*ConnContext {
+	e.mu.RLock()
+	handlers := make([]*ProxyEventHandler, 0, len(e.groups)+len(e.retiring))
+	for _, g := range e.groups {
+		handlers = append(handlers, g.handler)
+	}
+	for g := range e.retiring {
+		handlers = append(handlers, g.handler)
+	}
+	e.mu.RUnlock()
+
+	out := make(map[string][]*ConnContext)
+	for _, h := range handlers {
+		h.conns.Range(func(k, _ any) bool {
+			ctx := k.(*ConnContext)
+			ctx.mu.Lock()
+			if ctx.backendName == backend && ctx.connected && !ctx.closed && ctx.reason == "" {
+				out[ctx.server] = append(out[ctx.server], ctx)
+			}
+			ctx.mu.Unlock()
+			return true
+		})
+	}
+	return out
+}
+
+// rebalance analyzes one backend, logs overloaded servers and, with
+// terminate, closes their oldest connections. It returns the number closed.
+func (e *Engine) rebalance(be *config.Backend) int {
+	conns := e.routedConns(be.Name)
+	plan := e.rebalancePlan(be, conns)
+	closed := 0
+	for _, s := range plan.Servers {
+		if s.Close == 0 {
+			continue
+		}
+		if !be.Rebalance.Terminate {
+			logging.Info("[REBALANCE] %s/%s holds %d connections, share %.1f: closing %d would rebalance the pool",
+				be.Name, s.Server, s.Connections, s.Fair, s.Close)
+			continue
+		}
+		oldest := conns[s.Server]
+		sort.Slice(oldest, func(i, j int) bool { return oldest[i].StartTime.Before(oldest[j].StartTime) })
+		n := 0
+		for _, ctx := range oldest {
+			if n == s.Close {
+				break
+			}
+			ctx.mu.Lock()
+			if !ctx.closed && ctx.BackendConn != nil {
+				ctx.reason = StatusRebalanced
+				ctx.BackendConn.Close()
+				n++
+			}
+			ctx.mu.Unlock()
+		}
+		logging.Info("[REBALANCE] %s/%s holds %d connections, share %.1f: closed %d oldest",
+			be.Name, s.Server, s.Connections, s.Fair, n)
+		closed += n
+	}
+	return closed
+}
+
+// rebalanceLoop runs rebalance for every backend with rebalancing enabled,
+// each at its own interval, until ctx is done.
+func (e *Engine) rebalanceLoop(ctx context.Context) {
+	ticker := e.Clock.NewTicker(rebalanceTick)
+	defer ticker.Stop()
+	last := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		now := e.Clock.Now()
+		for _, be := range e.CurrentConfig().Backends {
+			if !be.Rebalance.Enabled() {
+				continue
+			}
+			interval, _ := time.ParseDuration(be.Rebalance.Interval)
+			if t, ok := last[be.Name]; ok && now.Sub(t) < interval {
+				continue
+			}
+			if _, ok := last[be.Name]; ok {
+				if pinned, ok := e.backend(be.Name); ok {
+					e.rebalance(pinned) // servers as balanced, hostnames resolved
+				}
+			}
+			last[be.Name] = now // the first tick only starts the interval
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_Rebalance(t *testing.T) {
+	cfg := &config.Config{Backends: []config.Backend{{
+		Name:    "game",
+		Balance: "leastconn",
+		Servers: []config.Server{
+			{Address: "a:1"}, {Address: "b:1"}, {Address: "c:1"},
+			{Address: "spare:1", Backup: true},
+		},
+		Rebalance: config.RebalanceConfig{Interval: "1m", MaxClose: 3},
+	}}}
+	e := NewEngine(cfg)
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	// "c" just came back: a holds 8, b 4, c none
+	h := &ProxyEventHandler{}
+	e.groups["l"] = &listenerGroup{name: "l", handler: h}
+	start := time.Unix(1000, 0)
+	backends := make(map[*ConnContext]net.Conn)
+	add := func(server string, n int) {
+		for i := 0; i < n; i++ {
+			client, peer := net.Pipe()
+			t.Cleanup(func() { peer.Close() })
+			ctx := &ConnContext{
+				StartTime:   start.Add(time.Duration(len(backends)) * time.Second),
+				backendName: "game",
+				server:      server,
+				connected:   true,
+				BackendConn: client,
+			}
+			backends[ctx] = client
+			h.conns.Store(ctx, struct{}{})
+		}
+	}
+	add("a:1", 8)
+	add("b:1", 4)
+	add("spare:1", 1)
+
+	plan, err := e.RebalancePlan("game")
+	if err != nil {
+		t.Fatalf("RebalancePlan failed: %v", err)
+	}
+	if plan.Connections != 12 || len(plan.Servers) != 3 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	// Fair share is 4 each; only a is over 1.5x of it, its excess of 4 is capped by max_close
+	want := map[string]int{"a:1": 3, "b:1": 0, "c:1": 0}
+	for _, s := range plan.Servers {
+		if s.Fair != 4 || s.Close != want[s.Server] {
+			t.Errorf("%s: fair %.1f close %d, want 4 and %d", s.Server, s.Fair, s.Close, want[s.Server])
+		}
+	}
+
+	// Without terminate only suggestions are logged
+	be, _ := e.backend("game")
+	if n := e.rebalance(be); n != 0 {
+		t.Errorf("closed %d connections without terminate", n)
+	}
+
+	be.Rebalance.Terminate = true
+	if n := e.rebalance(be); n != 3 {
+		t.Errorf("closed %d connections, want 3", n)
+	}
+	closed := 0
+	for ctx, conn := range backends {
+		if ctx.reason != StatusRebalanced {
+			continue
+		}
+		closed++
+		if ctx.server != "a:1" || !ctx.StartTime.Before(start.Add(3*time.Second)) {
+			t.Errorf("closed a connection that is not among the oldest of a: %s at %v", ctx.server, ctx.StartTime)
+		}
+		if _, err := conn.Write([]byte("x")); err == nil {
+			t.Error("expected backend connection to be closed")
+		}
+	}
+	if closed != 3 {
+		t.Errorf("%d connections marked rebalanced, want 3", closed)
+	}
+
+	// Small pools are left alone
+	be.Rebalance.MinConns = 100
+	if plan := e.rebalancePlan(be, e.routedConns("game")); plan.Overloaded() {
+		t.Errorf("pool below min_conns should not be rebalanced: %+v", plan)
+	}
+	if _, err := e.RebalancePlan("missing"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+// Reload applies a freshly loaded configuration to the running engine.
+// Listeners and backends are converged with Apply, so unchanged listeners
+// keep serving and replaced ones finish their open connections. Other
+// sections only take effect on restart; changes to them are logged.
+func (e *Engine) Reload(cfg *config.Config) ([]Change, error) {
+	current := e.CurrentConfig()
+	changes, err := e.Apply(cfg.Listeners, cfg.Backends)
+	if err != nil {
+		return nil, err
+	}
+
+	if pending := restartSections(current, cfg); len(pending) > 0 {
+		logging.Warn("[RELOAD] changes to %s require a restart", strings.Join(pending, ", "))
+	}
+	return changes, nil
+}
+
+// restartSections returns the sections that differ between two configurations
+// but cannot be applied at runtime.
+func restartSections(old, cfg *config.Config) []string {
+	sections := []struct {
+		name     string
+		old, new any
+	}{
+		{"server", old.Server, cfg.Server},
+		{"logging", old.Logging, cfg.Logging},
+		{"admin", old.Admin, cfg.Admin},
+		{"shedding", old.Shedding, cfg.Shedding},
+		{"hosts", old.Hosts, cfg.Hosts},
+		{"egress", old.Egress, cfg.Egress},
+		{"tunnel", old.Tunnel, cfg.Tunnel},
+		{"session_events", old.SessionEvents, cfg.SessionEvents},
+	}
+	out := make([]string, 0)
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.new) {
+			out = append(out, s.name)
+		}
+	}
+	return out
+}
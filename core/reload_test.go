@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+// echoServer accepts TCP connections and echoes them back until closed.
+func echoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func roundTrip(t *testing.T, c net.Conn, msg string) {
+	t.Helper()
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c.Write([]byte(msg)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(buf) != msg {
+		t.Fatalf("got %q, want %q", buf, msg)
+	}
+}
+
+func TestEngine_ReloadKeepsConnections(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	cfg := &config.Config{
+		Version:   "2",
+		Backends:  []config.Backend{{Name: "echo", Servers: []config.Server{{Address: echoServer(t)}}}},
+		Listeners: []config.Listener{{Name: "a", Bind: config.Binds{addr}, Protocol: "tcp", DefaultBackend: "echo"}},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	old, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer old.Close()
+	roundTrip(t, old, "before")
+
+	updated := *cfg
+	updated.Listeners = []config.Listener{cfg.Listeners[0]}
+	updated.Listeners[0].Priority = config.PriorityHigh
+	changes, err := engine.Reload(&updated)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "listener", Name: "a", Action: ChangeUpdated}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+
+	// The connection opened before the reload survives it
+	roundTrip(t, old, "after")
+
+	fresh, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatalf("dial after reload failed: %v", err)
+	}
+	roundTrip(t, fresh, "fresh")
+	fresh.Close()
+
+	// The replaced group stops once its connections are gone
+	old.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		engine.mu.RLock()
+		n := len(engine.retiring)
+		engine.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("replaced listener group not stopped")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRestartSections(t *testing.T) {
+	old := &config.Config{Logging: config.LoggingConfig{Level: "info"}}
+	cfg := &config.Config{Logging: config.LoggingConfig{Level: "debug"}, Hosts: map[string][]string{"db": {"10.0.0.1"}}}
+	got := restartSections(old, cfg)
+	if len(got) != 2 || got[0] != "logging" || got[1] != "hosts" {
+		t.Errorf("restartSections = %v, want [logging hosts]", got)
+	}
+}
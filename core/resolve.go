@@ -0,0 +1,208 @@
+package core
+
+import (
+	"context"
+	"maps"
+	"net"
+	"reflect"
+	"slices"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+const (
+	// resolveTick is how often the loop checks which backends are due.
+	resolveTick = time.Second
+	// resolveTimeout bounds the lookups of one backend.
+	resolveTimeout = 5 * time.Second
+)
+
+// resolveServers looks up the hostname servers of a backend resolved
+// at_start or periodic. The result maps each such server to the sorted
+// addresses it stands for, with the port kept. A server whose lookup fails
+// keeps its previous addresses, else the cached ones of the last run when
+// they are recent enough, or stays a single member dialed by name. It is nil
+// for on_dial backends.
+func (e *Engine) resolveServers(be *config.Backend, previous map[string][]string) map[string][]string {
+	if !be.Resolve.Pinned() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	out := make(map[string][]string)
+	answers := make(map[string][]string)
+	for _, s := range be.Servers {
+		host, port, err := net.SplitHostPort(s.Address)
+		if err != nil {
+			host, port = s.Address, ""
+		}
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := e.Hosts.LookupHost(ctx, host)
+		if err == nil && len(ips) == 0 {
+			err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		if err != nil {
+			if prev, ok := previous[s.Address]; ok {
+				logging.Warn("[RESOLVE] backend %s server %s: %v, keeping %v", be.Name, s.Address, err, prev)
+				out[s.Address] = prev
+			} else if cached, age, maxAge, ok := e.cachedAddrs(be.Name, s.Address); cached != nil {
+				logging.Warn("[RESOLVE] backend %s server %s: %v, serving stale addresses %v resolved %s ago",
+					be.Name, s.Address, err, cached, age)
+				out[s.Address] = cached
+			} else if ok {
+				logging.Warn("[RESOLVE] backend %s server %s: %v, cached addresses are %s old, past %s, dialing by name",
+					be.Name, s.Address, err, age, maxAge)
+			} else {
+				logging.Warn("[RESOLVE] backend %s server %s: %v, dialing by name", be.Name, s.Address, err)
+			}
+			continue
+		}
+		addrs := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			if port == "" {
+				addrs = append(addrs, ip)
+			} else {
+				addrs = append(addrs, net.JoinHostPort(ip, port))
+			}
+		}
+		slices.Sort(addrs)
+		out[s.Address] = slices.Compact(addrs)
+		answers[s.Address] = out[s.Address]
+	}
+	e.cacheResolved(be.Name, answers)
+	return out
+}
+
+// pinServers returns a copy of be with every resolved server replaced by one
+// entry per address, each keeping the settings and weight of the server.
+// Addresses already in the pool are not added twice.
+func pinServers(be *config.Backend, resolved map[string][]string) *config.Backend {
+	if len(resolved) == 0 {
+		return be
+	}
+	weights := be.ServerWeights()
+	pinned := *be
+	pinned.Servers = make([]config.Server, 0, len(be.Servers))
+	pinned.Weights = make(map[string]int, len(weights))
+	seen := make(map[string]bool)
+	for _, s := range be.Servers {
+		for _, addr := range pinnedAddrs(resolved, s.Address) {
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			entry := s
+			entry.Address = addr
+			entry.Weight = nil
+			pinned.Servers = append(pinned.Servers, entry)
+			if w, ok := weights[s.Address]; ok {
+				pinned.Weights[addr] = w
+			}
+		}
+	}
+	return &pinned
+}
+
+// pinnedAddrs returns the pool members standing for a configured server.
+func pinnedAddrs(resolved map[string][]string, server string) []string {
+	if addrs, ok := resolved[server]; ok {
+		return addrs
+	}
+	return []string{server}
+}
+
+// pinned returns the pool members standing for a server of a backend.
+func (e *Engine) pinned(backend, server string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return pinnedAddrs(e.resolved[backend], server)
+}
+
+// ResolvedServers returns the addresses each hostname server of a backend
+// currently stands for; it is empty unless the backend resolves at_start or
+// periodic.
+func (e *Engine) ResolvedServers(backend string) map[string][]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return maps.Clone(e.resolved[backend])
+}
+
+// resolveLoop resolves the servers of every periodic backend again at its
+// own interval until ctx is done.
+func (e *Engine) resolveLoop(ctx context.Context) {
+	ticker := e.Clock.NewTicker(resolveTick)
+	defer ticker.Stop()
+	last := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		now := e.Clock.Now()
+		for _, be := range e.CurrentConfig().Backends {
+			interval := be.Resolve.Every()
+			if interval == 0 {
+				continue
+			}
+			if t, ok := last[be.Name]; ok && now.Sub(t) < interval {
+				continue
+			}
+			if _, ok := last[be.Name]; ok {
+				e.reresolve(&be)
+			}
+			last[be.Name] = now // the first tick only starts the interval
+		}
+	}
+}
+
+// reresolve looks the servers of a backend up again and, when an answer
+// changed, replaces its runtime with one balancing over the new addresses.
+// Open connections keep the runtime they were picked from, as after Apply.
+// It reports whether the backend was replaced.
+func (e *Engine) reresolve(be *config.Backend) bool {
+	e.mu.RLock()
+	previous := e.resolved[be.Name]
+	e.mu.RUnlock()
+
+	resolved := e.resolveServers(be, previous)
+	if maps.EqualFunc(previous, resolved, slices.Equal) {
+		return false
+	}
+
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+	// Apply may have changed the backend during the lookups
+	i := slices.IndexFunc(e.CurrentConfig().Backends, func(b config.Backend) bool { return b.Name == be.Name })
+	if i < 0 || !reflect.DeepEqual(e.CurrentConfig().Backends[i], *be) {
+		return false
+	}
+	rt, err := e.buildRuntime(be, resolved)
+	if err != nil {
+		logging.Warn("[RESOLVE] backend %s: %v", be.Name, err)
+		return false
+	}
+
+	e.mu.Lock()
+	if !maps.EqualFunc(e.resolved[be.Name], previous, slices.Equal) {
+		e.mu.Unlock()
+		return false
+	}
+	replaced := e.Checkers[be.Name]
+	rt.install(e)
+	e.mu.Unlock()
+
+	if replaced != nil {
+		replaced.Stop()
+	}
+	if rt.checker != nil {
+		rt.checker.Start()
+	}
+	logging.Info("[RESOLVE] backend %s now balances over %v", be.Name, rt.backend.Addresses())
+	return true
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+func TestEngine_Resolve(t *testing.T) {
+	cfg := &config.Config{Backends: []config.Backend{{
+		Name:    "db",
+		Servers: []config.Server{{Address: "db.internal:5432"}, {Address: "10.0.0.9:5432"}},
+		Weights: map[string]int{"db.internal:5432": 3},
+		Resolve: config.ResolvePolicy{Mode: config.ResolvePeriodic, Interval: "30s"},
+	}}}
+	e := NewEngine(cfg)
+	answers := []string{"10.0.0.2", "10.0.0.1"}
+	var lookupErr error
+	e.Hosts.Lookup = func(ctx context.Context, host string) ([]string, error) {
+		return answers, lookupErr
+	}
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	members := func() []string {
+		be, _ := e.backend("db")
+		return be.Addresses()
+	}
+	if got, want := members(), []string{"10.0.0.1:5432", "10.0.0.2:5432", "10.0.0.9:5432"}; !slices.Equal(got, want) {
+		t.Fatalf("members = %v, want %v", got, want)
+	}
+	if w := e.ServerWeight("db", "10.0.0.2:5432"); w != 3 {
+		t.Errorf("resolved address weight = %d, want the server's 3", w)
+	}
+
+	if e.reresolve(&cfg.Backends[0]) {
+		t.Error("unchanged answers should keep the runtime")
+	}
+
+	answers = []string{"10.0.0.3", "10.0.0.2"}
+	if !e.reresolve(&cfg.Backends[0]) {
+		t.Fatal("changed answers should replace the runtime")
+	}
+	if got, want := members(), []string{"10.0.0.2:5432", "10.0.0.3:5432", "10.0.0.9:5432"}; !slices.Equal(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+	if got := e.ResolvedServers("db")["db.internal:5432"]; !slices.Equal(got, []string{"10.0.0.2:5432", "10.0.0.3:5432"}) {
+		t.Errorf("ResolvedServers = %v", got)
+	}
+
+	// A weight set on the name applies to every address and survives the next answer
+	if err := e.SetWeight("db", "db.internal:5432", 0, false); err != nil {
+		t.Fatalf("SetWeight failed: %v", err)
+	}
+	answers = []string{"10.0.0.4"}
+	e.reresolve(&cfg.Backends[0])
+	if w := e.ServerWeight("db", "10.0.0.4:5432"); w != 0 {
+		t.Errorf("weight after re-resolving = %d, want 0", w)
+	}
+
+	// A failed lookup keeps the last answer
+	lookupErr = errors.New("SERVFAIL")
+	if e.reresolve(&cfg.Backends[0]) {
+		t.Error("a failed lookup should keep the runtime")
+	}
+	if got, want := members(), []string{"10.0.0.4:5432", "10.0.0.9:5432"}; !slices.Equal(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+}
+
+func TestEngine_ResolveCache(t *testing.T) {
+	cfg := &config.Config{
+		Admin: config.AdminConfig{ResolveCacheFile: filepath.Join(t.TempDir(), "resolved.yaml"), ResolveCacheMaxAge: "1h"},
+		Backends: []config.Backend{{
+			Name:    "db",
+			Servers: []config.Server{{Address: "db.internal:5432"}},
+			Resolve: config.ResolvePolicy{Mode: config.ResolveAtStart},
+		}},
+	}
+	clk := clock.NewFake(time.Now())
+	start := func(lookupErr error) *Engine {
+		e := NewEngine(cfg)
+		e.Clock = clk
+		e.Hosts.Lookup = func(ctx context.Context, host string) ([]string, error) {
+			return []string{"10.0.0.1"}, lookupErr
+		}
+		e.loadResolved()
+		rt, err := e.newBackendRuntime(&cfg.Backends[0])
+		if err != nil {
+			t.Fatalf("newBackendRuntime failed: %v", err)
+		}
+		rt.install(e)
+		return e
+	}
+	members := func(e *Engine) []string {
+		be, _ := e.backend("db")
+		return be.Addresses()
+	}
+
+	start(nil)
+	// A restart during a DNS outage routes to the cached addresses
+	clk.Advance(30 * time.Minute)
+	e := start(errors.New("SERVFAIL"))
+	if got, want := members(e), []string{"10.0.0.1:5432"}; !slices.Equal(got, want) {
+		t.Errorf("members = %v, want the cached %v", got, want)
+	}
+
+	// Past resolve_cache_max_age the name is dialed instead
+	clk.Advance(time.Hour)
+	e = start(errors.New("SERVFAIL"))
+	if got, want := members(e), []string{"db.internal:5432"}; !slices.Equal(got, want) {
+		t.Errorf("members = %v, want %v", got, want)
+	}
+}
+
+func TestEngine_ResolveOnDial(t *testing.T) {
+	cfg := &config.Config{Backends: []config.Backend{{
+		Name:    "db",
+		Servers: []config.Server{{Address: "db.internal:5432"}},
+	}}}
+	e := NewEngine(cfg)
+	e.Hosts.Lookup = func(ctx context.Context, host string) ([]string, error) {
+		t.Errorf("on_dial backends should not be resolved up front, looked up %s", host)
+		return nil, nil
+	}
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	if got := rt.backend.Addresses(); !slices.Equal(got, []string{"db.internal:5432"}) {
+		t.Errorf("members = %v, want the name", got)
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// resolvedKey keeps the resolve cache in a state store.
+	resolvedKey = "resolved"
+	// defaultResolveCacheAge is how old cached addresses may be without
+	// admin.resolve_cache_max_age.
+	defaultResolveCacheAge = 24 * time.Hour
+	// resolveCacheRefresh is how often addresses that did not change are
+	// written again, to keep their age current.
+	resolveCacheRefresh = time.Minute
+)
+
+// resolveCache keeps the last addresses each hostname server resolved to,
+// persisted to admin.resolve_cache_file or the state store. Its settings
+// are copied from the configuration, as lookups run while e.mu is held.
+type resolveCache struct {
+	mu      sync.Mutex
+	enabled bool
+	path    string
+	maxAge  time.Duration
+	entries map[string]map[string]resolvedEntry // backend -> server
+	stale   map[string]map[string]bool          // servers routed to cached addresses
+}
+
+type resolvedEntry struct {
+	Addrs []string  `yaml:"addrs"`
+	At    time.Time `yaml:"at"` // last successful lookup
+}
+
+// configureResolveCache takes the cache settings of a configuration.
+func (e *Engine) configureResolveCache(cfg *config.Config) {
+	e.cache.mu.Lock()
+	defer e.cache.mu.Unlock()
+	e.cache.enabled = e.Store != nil || cfg.Admin.ResolveCacheFile != ""
+	e.cache.path = cfg.Admin.ResolveCacheFile
+	e.cache.maxAge = defaultResolveCacheAge
+	if d, err := time.ParseDuration(cfg.Admin.ResolveCacheMaxAge); err == nil && d > 0 {
+		e.cache.maxAge = d
+	}
+}
+
+// loadResolved reads the resolve cache written before the last restart.
+// Callers hold e.mu.
+func (e *Engine) loadResolved() {
+	e.configureResolveCache(e.Config)
+	path := e.Config.Admin.ResolveCacheFile
+	if e.Store == nil && path == "" {
+		return
+	}
+	data, err := e.readState(resolvedKey, path)
+	if err == nil {
+		if data == nil {
+			return
+		}
+		var entries map[string]map[string]resolvedEntry
+		if err = yaml.Unmarshal(data, &entries); err == nil {
+			e.cache.mu.Lock()
+			e.cache.entries = entries
+			e.cache.mu.Unlock()
+			return
+		}
+	}
+	logging.Warn("[RESOLVE] failed to load %s: %v", e.stateName(resolvedKey, path), err)
+}
+
+// cachedAddrs returns the cached addresses of a server whose lookup failed
+// and how old they are. Addresses past admin.resolve_cache_max_age are not
+// returned; those returned mark the server as routed to stale addresses.
+func (e *Engine) cachedAddrs(backend, server string) (addrs []string, age, maxAge time.Duration, ok bool) {
+	e.cache.mu.Lock()
+	defer e.cache.mu.Unlock()
+	entry, ok := e.cache.entries[backend][server]
+	if !ok {
+		return nil, 0, 0, false
+	}
+	age = e.Clock.Now().Sub(entry.At).Round(time.Second)
+	if age > e.cache.maxAge {
+		return nil, age, e.cache.maxAge, true
+	}
+	if e.cache.stale == nil {
+		e.cache.stale = make(map[string]map[string]bool)
+	}
+	if e.cache.stale[backend] == nil {
+		e.cache.stale[backend] = make(map[string]bool)
+	}
+	e.cache.stale[backend][server] = true
+	return slices.Clone(entry.Addrs), age, e.cache.maxAge, true
+}
+
+// cacheResolved records the answers of successful lookups and persists the
+// cache when one changed or is due for a refresh.
+func (e *Engine) cacheResolved(backend string, answers map[string][]string) {
+	now := e.Clock.Now()
+	e.cache.mu.Lock()
+	for server := range answers {
+		if e.cache.stale[backend][server] {
+			logging.Info("[RESOLVE] backend %s server %s resolves again, no longer serving cached addresses", backend, server)
+			delete(e.cache.stale[backend], server)
+		}
+	}
+	if !e.cache.enabled || len(answers) == 0 {
+		e.cache.mu.Unlock()
+		return
+	}
+	if e.cache.entries == nil {
+		e.cache.entries = make(map[string]map[string]resolvedEntry)
+	}
+	if e.cache.entries[backend] == nil {
+		e.cache.entries[backend] = make(map[string]resolvedEntry)
+	}
+	dirty := false
+	for server, addrs := range answers {
+		old, ok := e.cache.entries[backend][server]
+		if ok && slices.Equal(old.Addrs, addrs) && now.Sub(old.At) < resolveCacheRefresh {
+			continue
+		}
+		e.cache.entries[backend][server] = resolvedEntry{Addrs: addrs, At: now}
+		dirty = true
+	}
+	var data []byte
+	var err error
+	if dirty {
+		data, err = yaml.Marshal(maps.Clone(e.cache.entries))
+	}
+	path := e.cache.path
+	e.cache.mu.Unlock()
+
+	if err == nil && data != nil {
+		err = e.writeState(resolvedKey, path, data)
+	}
+	if err != nil {
+		logging.Warn("[RESOLVE] failed to persist resolved addresses: %v", err)
+	}
+}
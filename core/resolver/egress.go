@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrEgressDenied is returned when dialing an address outside the egress
+// allowlist.
+var ErrEgressDenied = errors.New("destination not allowed by egress policy")
+
+// Egress is an allowlist of destination networks, checked against the
+// resolved address right before each dial so names, hosts overrides and
+// addresses added at runtime cannot reach anything else.
+// A nil *Egress allows every destination.
+type Egress struct {
+	allow []netip.Prefix
+}
+
+// NewEgress builds an allowlist; an empty list returns nil (no restriction).
+func NewEgress(allow []netip.Prefix) *Egress {
+	if len(allow) == 0 {
+		return nil
+	}
+	return &Egress{allow: append([]netip.Prefix(nil), allow...)}
+}
+
+// Allowed reports whether ip may be dialed.
+func (e *Egress) Allowed(ip netip.Addr) bool {
+	if e == nil {
+		return true
+	}
+	ip = ip.Unmap()
+	for _, p := range e.allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// check verifies a resolved "ip:port" dial address.
+func (e *Egress) check(address string) error {
+	if e == nil {
+		return nil
+	}
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrEgressDenied, address)
+	}
+	if !e.Allowed(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrEgressDenied, address)
+	}
+	return nil
+}
+
+// control is a net.Dialer Control hook; it runs after name resolution, once
+// per address tried.
+func (e *Egress) control(network, address string, _ syscall.RawConn) error {
+	return e.check(address)
+}
+
+// dialer returns a dialer enforcing the allowlist.
+func (e *Egress) dialer() *net.Dialer {
+	d := &net.Dialer{}
+	if e != nil {
+		d.Control = e.control
+	}
+	return d
+}
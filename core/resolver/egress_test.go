@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestEgress_Allowed(t *testing.T) {
+	e := NewEgress([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")})
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"fd00::1", true},
+		{"11.0.0.1", false},
+		{"127.0.0.1", false},
+		{"::1", false},
+	}
+	for _, tt := range tests {
+		if got := e.Allowed(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if NewEgress(nil) != nil {
+		t.Error("empty allowlist should not restrict")
+	}
+	var none *Egress
+	if !none.Allowed(netip.MustParseAddr("127.0.0.1")) {
+		t.Error("nil Egress should allow everything")
+	}
+}
+
+func TestHosts_DialEnforcesEgress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// A hosts override (like poisoned discovery) pointing at loopback
+	h := NewHosts(map[string][]string{"backend.test": {"127.0.0.1"}})
+	h.Egress = NewEgress([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, addr := range []string{"backend.test:" + port, "127.0.0.1:" + port, "localhost:" + port} {
+		if conn, err := h.DialContext(ctx, "tcp", addr); !errors.Is(err, ErrEgressDenied) {
+			if conn != nil {
+				conn.Close()
+			}
+			t.Errorf("DialContext(%s) error = %v, want ErrEgressDenied", addr, err)
+		}
+	}
+	if _, err := h.DialUDP("127.0.0.1:"+port, DialOptions{}); !errors.Is(err, ErrEgressDenied) {
+		t.Errorf("DialUDP error = %v, want ErrEgressDenied", err)
+	}
+
+	h.Egress = NewEgress([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+	conn, err := h.DialContext(ctx, "tcp", "backend.test:"+port)
+	if err != nil {
+		t.Fatalf("allowed dial failed: %v", err)
+	}
+	conn.Close()
+}
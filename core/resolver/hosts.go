@@ -0,0 +1,157 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Hosts is a static name -> IPs override table consulted before DNS,
+// similar to /etc/hosts but scoped to backend addresses.
+// A nil *Hosts passes addresses through unchanged.
+type Hosts struct {
+	entries map[string][]string
+
+	// Egress restricts the addresses dialed; nil allows any.
+	Egress *Egress
+
+	// Lookup answers names without an override; nil uses the system resolver.
+	Lookup func(ctx context.Context, host string) ([]string, error)
+}
+
+// NewHosts builds an override table. Names are matched case-insensitively.
+func NewHosts(entries map[string][]string) *Hosts {
+	h := &Hosts{entries: make(map[string][]string, len(entries))}
+	for name, ips := range entries {
+		h.entries[strings.ToLower(name)] = append([]string(nil), ips...)
+	}
+	return h
+}
+
+// Expand returns the candidate addresses for addr ("host" or "host:port").
+// Overridden hosts expand to one address per configured IP, keeping the port;
+// other addresses are returned as-is and left to DNS.
+func (h *Hosts) Expand(addr string) []string {
+	if h == nil || len(h.entries) == 0 {
+		return []string{addr}
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+
+	ips, ok := h.entries[strings.ToLower(host)]
+	if !ok || len(ips) == 0 {
+		return []string{addr}
+	}
+
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if port == "" {
+			out = append(out, ip)
+		} else {
+			out = append(out, net.JoinHostPort(ip, port))
+		}
+	}
+	return out
+}
+
+// LookupHost returns the IPs of host: its overrides when it has any,
+// otherwise the DNS answer. An IP is returned as-is.
+func (h *Hosts) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	if h != nil {
+		if ips, ok := h.entries[strings.ToLower(host)]; ok && len(ips) > 0 {
+			return append([]string(nil), ips...), nil
+		}
+		if h.Lookup != nil {
+			return h.Lookup(ctx, host)
+		}
+	}
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// DialOptions set the local end of dialed connections. The zero value
+// leaves both to the kernel.
+type DialOptions struct {
+	Source net.IP // local address
+	TOS    int    // IP_TOS or IPV6_TCLASS byte
+}
+
+// DialContext dials each candidate address of addr in order and returns the
+// first successful connection.
+func (h *Hosts) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return h.DialWith(ctx, network, addr, DialOptions{})
+}
+
+// DialWith is DialContext with the local end set by o.
+func (h *Hosts) DialWith(ctx context.Context, network, addr string, o DialOptions) (net.Conn, error) {
+	d := h.egress().dialer()
+	if o.Source != nil {
+		d.LocalAddr = &net.TCPAddr{IP: o.Source}
+	}
+	if o.TOS != 0 {
+		check := d.Control
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			if check != nil {
+				if err := check(network, address, c); err != nil {
+					return err
+				}
+			}
+			return setTOS(network, c, o.TOS)
+		}
+	}
+	var errs []error
+	for _, candidate := range h.Expand(addr) {
+		conn, err := d.DialContext(ctx, network, candidate)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DialUDP resolves the first candidate address of addr and opens a connected
+// UDP socket to it, with the local end set by o.
+func (h *Hosts) DialUDP(addr string, o DialOptions) (*net.UDPConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", h.Expand(addr)[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := h.egress().check(raddr.AddrPort().String()); err != nil {
+		return nil, err
+	}
+	if o.Source == nil && o.TOS == 0 {
+		return net.DialUDP("udp", nil, raddr)
+	}
+	d := &net.Dialer{}
+	if o.Source != nil {
+		d.LocalAddr = &net.UDPAddr{IP: o.Source}
+	}
+	if o.TOS != 0 {
+		d.Control = func(network, _ string, c syscall.RawConn) error {
+			return setTOS(network, c, o.TOS)
+		}
+	}
+	conn, err := d.Dial("udp", raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+func (h *Hosts) egress() *Egress {
+	if h == nil {
+		return nil
+	}
+	return h.Egress
+}
@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHosts_Expand(t *testing.T) {
+	h := NewHosts(map[string][]string{
+		"db.internal": {"10.0.0.1", "10.0.0.2"},
+		"v6.internal": {"::1"},
+	})
+
+	tests := []struct {
+		addr string
+		want []string
+	}{
+		{"db.internal:5432", []string{"10.0.0.1:5432", "10.0.0.2:5432"}},
+		{"DB.Internal:5432", []string{"10.0.0.1:5432", "10.0.0.2:5432"}},
+		{"db.internal", []string{"10.0.0.1", "10.0.0.2"}},
+		{"v6.internal:53", []string{"[::1]:53"}},
+		{"other.internal:80", []string{"other.internal:80"}},
+		{"10.0.0.9:80", []string{"10.0.0.9:80"}},
+	}
+
+	for _, tt := range tests {
+		got := h.Expand(tt.addr)
+		if len(got) != len(tt.want) {
+			t.Errorf("Expand(%q) = %v, want %v", tt.addr, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Expand(%q) = %v, want %v", tt.addr, got, tt.want)
+				break
+			}
+		}
+	}
+
+	var nilHosts *Hosts
+	if got := nilHosts.Expand("a:1"); len(got) != 1 || got[0] != "a:1" {
+		t.Errorf("nil Hosts Expand = %v", got)
+	}
+}
+
+func TestHosts_DialContextFallsBack(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// Nothing listens on 127.0.0.2, so the dial must fall back to 127.0.0.1
+	h := NewHosts(map[string][]string{"backend.test": {"127.0.0.2", "127.0.0.1"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := h.DialContext(ctx, "tcp", "backend.test:"+port)
+	if err != nil {
+		t.Fatalf("DialContext failed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestHosts_DialWith(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := (*Hosts)(nil).DialWith(ctx, "tcp", l.Addr().String(), DialOptions{Source: net.ParseIP("127.0.0.1"), TOS: 0x10})
+	if err != nil {
+		t.Fatalf("DialWith failed: %v", err)
+	}
+	defer conn.Close()
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("dialed from %s, want 127.0.0.1", ip)
+	}
+
+	udp, err := (*Hosts)(nil).DialUDP(l.Addr().String(), DialOptions{Source: net.ParseIP("127.0.0.1"), TOS: 0x10})
+	if err != nil {
+		t.Fatalf("DialUDP failed: %v", err)
+	}
+	udp.Close()
+}
+
+func TestHosts_LookupHost(t *testing.T) {
+	h := NewHosts(map[string][]string{"db.internal": {"10.0.0.1"}})
+	h.Lookup = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.0.2.1", "192.0.2.2"}, nil
+	}
+
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"DB.internal", []string{"10.0.0.1"}},
+		{"web.internal", []string{"192.0.2.1", "192.0.2.2"}},
+		{"10.0.0.9", []string{"10.0.0.9"}},
+	}
+	for _, tt := range tests {
+		got, err := h.LookupHost(context.Background(), tt.host)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("LookupHost(%q) = %v, %v; want %v", tt.host, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package resolver
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setTOS(network string, c syscall.RawConn, tos int) error {
+	return errors.New("tos is not supported on this platform")
+}
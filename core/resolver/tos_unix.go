@@ -0,0 +1,25 @@
+//go:build unix
+
+package resolver
+
+import (
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setTOS marks the packets of a socket being dialed with tos.
+func setTOS(network string, c syscall.RawConn, tos int) error {
+	level, opt := unix.IPPROTO_IP, unix.IP_TOS
+	if strings.HasSuffix(network, "6") {
+		level, opt = unix.IPPROTO_IPV6, unix.IPV6_TCLASS
+	}
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), level, opt, tos)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,192 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+const (
+	defaultBaseBackoff = 25 * time.Millisecond
+	defaultMaxBackoff  = 1 * time.Second
+
+	// budgetWindow is the period over which the retry budget ratio is measured.
+	budgetWindow = 10 * time.Second
+	// minRetriesPerWindow always allows a few retries so low-traffic backends can recover.
+	minRetriesPerWindow = 3
+)
+
+var (
+	ErrBudgetExhausted = errors.New("retry budget exhausted")
+)
+
+// Policy describes how failed attempts against a backend are retried.
+// It is shared by TCP connect retries and (future) HTTP request retries.
+type Policy struct {
+	MaxRetries    int
+	PerTryTimeout time.Duration // 0 leaves attempts bounded by the caller only
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+	// Clock drives backoff waits; nil uses the wall clock.
+	Clock clock.Clock
+
+	budget *Budget
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewPolicy builds a Policy from the backend retry configuration.
+func NewPolicy(cfg config.RetryConfig) (*Policy, error) {
+	p := &Policy{
+		MaxRetries:  cfg.MaxRetries,
+		BaseBackoff: defaultBaseBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	var err error
+	if cfg.PerTryTimeout != "" {
+		if p.PerTryTimeout, err = time.ParseDuration(cfg.PerTryTimeout); err != nil {
+			return nil, fmt.Errorf("invalid per_try_timeout: %w", err)
+		}
+	}
+	if cfg.BaseBackoff != "" {
+		if p.BaseBackoff, err = time.ParseDuration(cfg.BaseBackoff); err != nil {
+			return nil, fmt.Errorf("invalid base_backoff: %w", err)
+		}
+	}
+	if cfg.MaxBackoff != "" {
+		if p.MaxBackoff, err = time.ParseDuration(cfg.MaxBackoff); err != nil {
+			return nil, fmt.Errorf("invalid max_backoff: %w", err)
+		}
+	}
+	if cfg.BudgetPercent > 0 {
+		p.budget = NewBudget(cfg.BudgetPercent, budgetWindow)
+	}
+
+	return p, nil
+}
+
+// Backoff returns the delay before the given retry attempt (1-based).
+// It uses exponential backoff capped at MaxBackoff with full jitter.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 || p.BaseBackoff <= 0 {
+		return 0
+	}
+
+	ceiling := p.BaseBackoff
+	for i := 1; i < attempt && ceiling < p.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if p.MaxBackoff > 0 && ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Duration(p.rnd.Int63n(int64(ceiling) + 1))
+}
+
+// Do runs fn until it succeeds, the retries are used up, the budget is exhausted
+// or ctx is done. Each attempt gets its own context bounded by PerTryTimeout,
+// if set. The error of the last attempt is returned.
+func (p *Policy) Do(ctx context.Context, fn func(ctx context.Context, attempt int) error) error {
+	clk := p.Clock
+	if clk == nil {
+		clk = clock.Real()
+	}
+	if p.budget != nil {
+		p.budget.Request(clk.Now())
+	}
+
+	var err error
+	for attempt := 0; attempt <= p.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if p.budget != nil && !p.budget.TryRetry(clk.Now()) {
+				return fmt.Errorf("%w: %v", ErrBudgetExhausted, err)
+			}
+
+			timer := clk.NewTimer(p.Backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C():
+			}
+		}
+
+		var tryCtx context.Context
+		var cancel context.CancelFunc
+		if p.PerTryTimeout > 0 {
+			tryCtx, cancel = context.WithTimeout(ctx, p.PerTryTimeout)
+		} else {
+			tryCtx, cancel = context.WithCancel(ctx)
+		}
+		err = fn(tryCtx, attempt)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Budget caps retries to a percentage of requests seen within a window,
+// so a struggling backend is not overwhelmed by retry storms. Callers pass
+// the time of their clock; the first call opens the window.
+type Budget struct {
+	percent float64
+	window  time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+func NewBudget(percent float64, window time.Duration) *Budget {
+	return &Budget{
+		percent: percent,
+		window:  window,
+	}
+}
+
+// Request records a first attempt made at now.
+func (b *Budget) Request(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(now)
+	b.requests++
+}
+
+// TryRetry reports whether a retry at now is allowed and, if so, records it.
+func (b *Budget) TryRetry(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(now)
+
+	allowed := int(float64(b.requests) * b.percent / 100)
+	if allowed < minRetriesPerWindow {
+		allowed = minRetriesPerWindow
+	}
+	if b.retries >= allowed {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+func (b *Budget) roll(now time.Time) {
+	if b.windowStart.IsZero() || now.Sub(b.windowStart) >= b.window {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
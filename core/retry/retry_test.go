@@ -0,0 +1,119 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy(config.RetryConfig{
+		MaxRetries:    2,
+		PerTryTimeout: "200ms",
+		BaseBackoff:   "10ms",
+		MaxBackoff:    "50ms",
+		BudgetPercent: 20,
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+	if p.MaxRetries != 2 || p.PerTryTimeout != 200*time.Millisecond {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if p.budget == nil {
+		t.Error("expected budget to be configured")
+	}
+
+	if _, err := NewPolicy(config.RetryConfig{BaseBackoff: "bogus"}); err == nil {
+		t.Error("expected error for invalid base_backoff")
+	}
+}
+
+func TestBackoff_Capped(t *testing.T) {
+	p, _ := NewPolicy(config.RetryConfig{BaseBackoff: "10ms", MaxBackoff: "40ms"})
+
+	if d := p.Backoff(0); d != 0 {
+		t.Errorf("Backoff(0) = %v, want 0", d)
+	}
+	for attempt := 1; attempt <= 10; attempt++ {
+		if d := p.Backoff(attempt); d < 0 || d > 40*time.Millisecond {
+			t.Errorf("Backoff(%d) = %v, want within [0, 40ms]", attempt, d)
+		}
+	}
+}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	p, _ := NewPolicy(config.RetryConfig{MaxRetries: 3, BaseBackoff: "1ms"})
+
+	calls := 0
+	err := p.Do(context.Background(), func(ctx context.Context, attempt int) error {
+		calls++
+		if attempt < 2 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Do failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestDo_GivesUp(t *testing.T) {
+	p, _ := NewPolicy(config.RetryConfig{MaxRetries: 1, BaseBackoff: "1ms"})
+
+	calls := 0
+	err := p.Do(context.Background(), func(ctx context.Context, attempt int) error {
+		calls++
+		return errors.New("fail")
+	})
+	if err == nil {
+		t.Error("expected error after retries exhausted")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	b := NewBudget(10, time.Minute)
+	for i := 0; i < 50; i++ {
+		b.Request(fake.Now())
+	}
+
+	// 10% of 50 is 5 retries
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if b.TryRetry(fake.Now()) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("expected 5 retries allowed, got %d", allowed)
+	}
+
+	// The window still runs a second before it ends, then starts over
+	fake.Advance(time.Minute - time.Second)
+	if b.TryRetry(fake.Now()) {
+		t.Error("retry allowed before the window ended")
+	}
+	fake.Advance(time.Second)
+	b.Request(fake.Now())
+	allowed = 0
+	for i := 0; i < 10; i++ {
+		if b.TryRetry(fake.Now()) {
+			allowed++
+		}
+	}
+	// Low traffic still gets the minimum allowance
+	if allowed != minRetriesPerWindow {
+		t.Errorf("expected %d retries allowed in a new window, got %d", minRetriesPerWindow, allowed)
+	}
+}
@@ -0,0 +1,75 @@
+// Package sdnotify reports the service state to systemd over the socket in
+// NOTIFY_SOCKET, as units of Type=notify expect: READY=1 once the service
+// serves, STOPPING=1 when it shuts down and WATCHDOG=1 periodically when the
+// unit sets WatchdogSec. Without NOTIFY_SOCKET nothing is sent.
+package sdnotify
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"nvelox/core/logging"
+)
+
+// Notify sends state, such as "READY=1", to systemd. It reports whether the
+// state was sent, which it is not when the process runs outside systemd.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading "@" is an abstract socket, which net resolves as well
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the time within which systemd expects a
+// WATCHDOG=1, or 0 when the watchdog is off or meant for another process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog sends WATCHDOG=1 at half the watchdog interval until ctx is done,
+// each time after alive returns nil. A process hanging in alive, or stuck in
+// a way alive reports, misses the deadline and systemd restarts it. Without
+// a watchdog it returns at once.
+func Watchdog(ctx context.Context, alive func() error) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logging.Info("[SYSTEMD] answering the watchdog every %v", interval/2)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := alive(); err != nil {
+			logging.Error("[SYSTEMD] not answering the watchdog: %v", err)
+			continue
+		}
+		if _, err := Notify("WATCHDOG=1"); err != nil {
+			logging.Warn("[SYSTEMD] watchdog: %v", err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listen stands in for systemd and returns the datagrams it receives.
+func listen(t *testing.T) <-chan string {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	out := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			out <- string(buf[:n])
+		}
+	}()
+	return out
+}
+
+func receive(t *testing.T, states <-chan string) string {
+	select {
+	case s := <-states:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received")
+		return ""
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify("READY=1"); sent || err != nil {
+		t.Errorf("Notify outside systemd = %v, %v", sent, err)
+	}
+
+	states := listen(t)
+	if sent, err := Notify("READY=1"); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	if s := receive(t, states); s != "READY=1" {
+		t.Errorf("received %q", s)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	states := listen(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d := WatchdogInterval(); d != 20*time.Millisecond {
+		t.Fatalf("WatchdogInterval = %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	alive := make(chan struct{}, 16)
+	go func() {
+		Watchdog(ctx, func() error {
+			alive <- struct{}{}
+			return nil
+		})
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		if s := receive(t, states); s != "WATCHDOG=1" {
+			t.Errorf("received %q", s)
+		}
+	}
+	if len(alive) == 0 {
+		t.Error("alive not called before answering")
+	}
+	cancel()
+	<-done
+	for quiet := false; !quiet; {
+		select {
+		case <-states:
+		case <-time.After(50 * time.Millisecond):
+			quiet = true
+		}
+	}
+
+	// A failing check goes unanswered, so systemd restarts the process
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan struct{})
+	var calls atomic.Int32
+	go func() {
+		Watchdog(ctx, func() error {
+			calls.Add(1)
+			return errors.New("stuck")
+		})
+		close(done)
+	}()
+	select {
+	case s := <-states:
+		t.Errorf("received %q while stuck", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	<-done
+	if calls.Load() == 0 {
+		t.Error("alive not called while stuck")
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if d := WatchdogInterval(); d != 0 {
+		t.Errorf("WatchdogInterval for another process = %v", d)
+	}
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+	"nvelox/core/logging"
+	"nvelox/core/retry"
+)
+
+const (
+	defaultSessionBatchSize     = 100
+	defaultSessionFlushInterval = time.Second
+	defaultSessionQueueSize     = 10000
+	defaultSessionRetries       = 3
+	sessionPostTimeout          = 5 * time.Second
+)
+
+// Session event types
+const (
+	SessionOpen  = "open"
+	SessionClose = "close"
+)
+
+// SessionEvent reports a client session assigned to a backend server (open)
+// or ended (close). Both events of a session carry the same ID.
+type SessionEvent struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Listener string    `json:"listener"`
+	Protocol string    `json:"protocol"` // tcp, udp
+	Client   string    `json:"client"`
+	Backend  string    `json:"backend"` // pool name
+	Server   string    `json:"server"`  // address of the backend server
+
+	// Close events only
+	Status   string  `json:"status,omitempty"`
+	BytesIn  int64   `json:"bytes_in,omitempty"`
+	BytesOut int64   `json:"bytes_out,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+}
+
+// SessionBatch is the body POSTed to session_events.url.
+type SessionBatch struct {
+	Events []SessionEvent `json:"events"`
+}
+
+// SessionNotifier posts session events in batches. Notify never blocks the
+// data path: events are queued and dropped when the queue is full or a batch
+// still fails after its retries. A nil SessionNotifier drops every event.
+type SessionNotifier struct {
+	Config config.SessionEventsConfig
+	Clock  clock.Clock
+	Client *http.Client
+
+	queue   chan SessionEvent
+	dropped atomic.Int64
+
+	started  atomic.Bool
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewSessionNotifier(cfg config.SessionEventsConfig) *SessionNotifier {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultSessionQueueSize
+	}
+	return &SessionNotifier{
+		Config: cfg,
+		Clock:  clock.Real(),
+		Client: &http.Client{Timeout: sessionPostTimeout},
+		queue:  make(chan SessionEvent, size),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start delivers queued events until Stop.
+func (n *SessionNotifier) Start() {
+	if n.started.CompareAndSwap(false, true) {
+		go n.loop()
+	}
+}
+
+// Stop sends the events still queued and waits for the delivery to finish.
+func (n *SessionNotifier) Stop() {
+	n.stopOnce.Do(func() { close(n.stopCh) })
+	if n.started.Load() {
+		<-n.done
+	}
+}
+
+// Notify queues an event.
+func (n *SessionNotifier) Notify(ev SessionEvent) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.queue <- ev:
+	default:
+		if n.dropped.Add(1) == 1 {
+			logging.Warn("[EVENTS] session event queue full, dropping events")
+		}
+	}
+}
+
+// Dropped returns the number of events that were never delivered.
+func (n *SessionNotifier) Dropped() int64 {
+	if n == nil {
+		return 0
+	}
+	return n.dropped.Load()
+}
+
+func (n *SessionNotifier) loop() {
+	defer close(n.done)
+
+	batchSize := n.Config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSessionBatchSize
+	}
+	interval := defaultSessionFlushInterval
+	if n.Config.FlushInterval != "" {
+		if d, err := time.ParseDuration(n.Config.FlushInterval); err == nil {
+			interval = d
+		}
+	}
+	rc := n.Config.Retry
+	if rc == (config.RetryConfig{}) {
+		rc.MaxRetries = defaultSessionRetries
+	}
+	policy, err := retry.NewPolicy(rc) // validated with the configuration
+	if err != nil {
+		policy = &retry.Policy{}
+	}
+	policy.Clock = n.Clock
+
+	batch := make([]SessionEvent, 0, batchSize)
+	var timer clock.Timer
+	var flush <-chan time.Time
+	send := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, flush = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		n.deliver(policy, batch)
+		batch = make([]SessionEvent, 0, batchSize)
+	}
+
+	for {
+		select {
+		case ev := <-n.queue:
+			batch = append(batch, ev)
+			if len(batch) >= batchSize {
+				send()
+			} else if timer == nil {
+				timer = n.Clock.NewTimer(interval)
+				flush = timer.C()
+			}
+		case <-flush:
+			send()
+		case <-n.stopCh:
+			for len(n.queue) > 0 {
+				batch = append(batch, <-n.queue)
+				if len(batch) >= batchSize {
+					send()
+				}
+			}
+			send()
+			return
+		}
+	}
+}
+
+// deliver posts one batch, retrying failures with backoff.
+func (n *SessionNotifier) deliver(policy *retry.Policy, batch []SessionEvent) {
+	body, err := json.Marshal(SessionBatch{Events: batch})
+	if err != nil {
+		return
+	}
+	err = policy.Do(context.Background(), func(ctx context.Context, attempt int) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := n.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		n.dropped.Add(int64(len(batch)))
+		logging.Warn("[EVENTS] dropping %d session events: %v", len(batch), err)
+	}
+}
+
+// newSessionID returns a random identifier for a client session.
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+// sessionCollector records the batches POSTed to it; the first fail
+// requests are answered with 503.
+type sessionCollector struct {
+	mu       sync.Mutex
+	batches  [][]SessionEvent
+	requests atomic.Int32
+	fail     int32
+}
+
+func (s *sessionCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.requests.Add(1) <= s.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var b SessionBatch
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, b.Events)
+	s.mu.Unlock()
+}
+
+func (s *sessionCollector) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]int, 0, len(s.batches))
+	for _, b := range s.batches {
+		out = append(out, len(b))
+	}
+	return out
+}
+
+func TestSessionNotifier_Batches(t *testing.T) {
+	col := &sessionCollector{}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	clk := clock.NewFake(time.Unix(1000, 0))
+	n := NewSessionNotifier(config.SessionEventsConfig{URL: srv.URL, BatchSize: 2, FlushInterval: "1s"})
+	n.Clock = clk
+	n.Start()
+
+	// A full batch is sent right away
+	n.Notify(SessionEvent{Type: SessionOpen, ID: "a"})
+	n.Notify(SessionEvent{Type: SessionOpen, ID: "b"})
+	waitFor(t, func() bool { return len(col.sizes()) == 1 })
+
+	// A partial one once the flush interval passed
+	n.Notify(SessionEvent{Type: SessionClose, ID: "a"})
+	waitFor(t, func() bool { return clk.Waiters() == 1 })
+	clk.Advance(time.Second)
+	waitFor(t, func() bool { return len(col.sizes()) == 2 })
+
+	// Stop sends what is still queued
+	n.Notify(SessionEvent{Type: SessionClose, ID: "b"})
+	n.Stop()
+	sizes := col.sizes()
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 1 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v, want [2 1 1]", sizes)
+	}
+	if col.batches[2][0].ID != "b" || col.batches[2][0].Type != SessionClose {
+		t.Errorf("last event = %+v", col.batches[2][0])
+	}
+	if n.Dropped() != 0 {
+		t.Errorf("dropped = %d, want 0", n.Dropped())
+	}
+}
+
+func TestSessionNotifier_Retry(t *testing.T) {
+	col := &sessionCollector{fail: 2}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	n := NewSessionNotifier(config.SessionEventsConfig{URL: srv.URL, Retry: config.RetryConfig{MaxRetries: 2, BaseBackoff: "1ms"}})
+	n.Start()
+	n.Notify(SessionEvent{Type: SessionOpen, ID: "a"})
+	n.Stop()
+	if got := col.requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+	if sizes := col.sizes(); len(sizes) != 1 {
+		t.Errorf("delivered batches = %v, want one", sizes)
+	}
+
+	// Without retries left the batch is dropped
+	col = &sessionCollector{fail: 10}
+	srv2 := httptest.NewServer(col)
+	defer srv2.Close()
+	n = NewSessionNotifier(config.SessionEventsConfig{URL: srv2.URL, Retry: config.RetryConfig{MaxRetries: 1, BaseBackoff: "1ms"}})
+	n.Start()
+	n.Notify(SessionEvent{Type: SessionOpen, ID: "a"})
+	n.Notify(SessionEvent{Type: SessionClose, ID: "a"})
+	n.Stop()
+	if n.Dropped() != 2 {
+		t.Errorf("dropped = %d, want 2", n.Dropped())
+	}
+}
+
+func TestSessionNotifier_QueueFull(t *testing.T) {
+	n := NewSessionNotifier(config.SessionEventsConfig{URL: "http://127.0.0.1:1", QueueSize: 1})
+	n.Notify(SessionEvent{ID: "a"})
+	n.Notify(SessionEvent{ID: "b"})
+	if n.Dropped() != 1 {
+		t.Errorf("dropped = %d, want 1", n.Dropped())
+	}
+	n.Stop() // never started
+
+	var none *SessionNotifier
+	none.Notify(SessionEvent{ID: "c"})
+}
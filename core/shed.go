@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+	"nvelox/core/logging"
+	"nvelox/core/pressure"
+)
+
+const (
+	defaultShedInterval = time.Second
+	defaultShedFraction = 0.5
+)
+
+// Shedder rejects a fraction of new connections on low-priority listeners
+// while system pressure is above the configured thresholds. High-priority
+// listeners are never shed. A nil Shedder allows everything.
+type Shedder struct {
+	Config config.SheddingConfig
+	// Sample reads system pressure; tests may replace it.
+	Sample func() (pressure.Sample, error)
+	Clock  clock.Clock
+
+	active atomic.Bool
+	total  atomic.Int64
+
+	mu   sync.Mutex
+	last pressure.Sample
+	shed map[string]int64 // listener -> rejected connections
+	rnd  *rand.Rand
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// ShedStats is a snapshot of the shedder state.
+type ShedStats struct {
+	Active   bool
+	Pressure pressure.Sample
+	Shed     map[string]int64
+	Total    int64
+}
+
+func NewShedder(cfg config.SheddingConfig) *Shedder {
+	return &Shedder{
+		Config: cfg,
+		Sample: pressure.Read,
+		Clock:  clock.Real(),
+		shed:   make(map[string]int64),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start samples pressure periodically until Stop.
+func (s *Shedder) Start() {
+	interval := defaultShedInterval
+	if s.Config.Interval != "" {
+		if d, err := time.ParseDuration(s.Config.Interval); err == nil {
+			interval = d
+		}
+	}
+	go s.loop(interval)
+}
+
+func (s *Shedder) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+func (s *Shedder) loop(interval time.Duration) {
+	ticker := s.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Update(); errors.Is(err, pressure.ErrUnsupported) {
+			logging.Warn("[SHED] %v, load shedding disabled", err)
+			return
+		}
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// Update takes a pressure sample and switches shedding on or off.
+func (s *Shedder) Update() error {
+	sample, err := s.Sample()
+	if err != nil {
+		if !errors.Is(err, pressure.ErrUnsupported) {
+			logging.Warn("[SHED] failed to sample system pressure: %v", err)
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	s.last = sample
+	s.mu.Unlock()
+
+	over := s.over(sample)
+	if s.active.Swap(over) != over {
+		if over {
+			logging.Warn("[SHED] system pressure high (cpu_load=%.2f memory=%.1f%% fds=%.1f%%), shedding low priority connections",
+				sample.CPULoad, sample.MemoryPercent, sample.FDPercent)
+		} else {
+			logging.Info("[SHED] system pressure back to normal, shedding stopped")
+		}
+	}
+	return nil
+}
+
+func (s *Shedder) over(p pressure.Sample) bool {
+	c := s.Config
+	return (c.CPULoad > 0 && p.CPULoad >= c.CPULoad) ||
+		(c.MemoryPercent > 0 && p.MemoryPercent >= c.MemoryPercent) ||
+		(c.FDPercent > 0 && p.FDPercent >= c.FDPercent)
+}
+
+// fraction returns the share of new connections shed for a priority class.
+func (s *Shedder) fraction(p config.Priority) float64 {
+	switch p {
+	case config.PriorityHigh:
+		return 0
+	case config.PriorityLow:
+		if s.Config.Fraction == 0 {
+			return defaultShedFraction
+		}
+		return s.Config.Fraction
+	default:
+		return s.Config.NormalFraction
+	}
+}
+
+// Allow reports whether a new connection on the listener may proceed,
+// recording it as shed otherwise.
+func (s *Shedder) Allow(listener string, priority config.Priority) bool {
+	if s == nil || !s.active.Load() {
+		return true
+	}
+
+	fraction := s.fraction(priority)
+	if fraction == 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rnd.Float64() >= fraction {
+		return true
+	}
+	s.shed[listener]++
+	s.total.Add(1)
+	return false
+}
+
+// Stats returns the current shedding state and counters.
+func (s *Shedder) Stats() ShedStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shed := make(map[string]int64, len(s.shed))
+	for k, v := range s.shed {
+		shed[k] = v
+	}
+	return ShedStats{Active: s.active.Load(), Pressure: s.last, Shed: shed, Total: s.total.Load()}
+}
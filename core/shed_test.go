@@ -0,0 +1,60 @@
+package core
+
+import (
+	"testing"
+
+	"nvelox/config"
+	"nvelox/core/pressure"
+)
+
+func TestShedder(t *testing.T) {
+	sample := pressure.Sample{CPULoad: 0.5}
+	s := NewShedder(config.SheddingConfig{CPULoad: 1, Fraction: 1})
+	s.Sample = func() (pressure.Sample, error) { return sample, nil }
+
+	s.Update()
+	if !s.Allow("bulk", config.PriorityLow) {
+		t.Error("expected connections allowed below threshold")
+	}
+
+	sample.CPULoad = 1.5
+	s.Update()
+	if s.Allow("bulk", config.PriorityLow) {
+		t.Error("expected low priority connection to be shed")
+	}
+	if !s.Allow("api", config.PriorityHigh) || !s.Allow("web", "") {
+		t.Error("expected high and normal priority connections allowed")
+	}
+
+	st := s.Stats()
+	if !st.Active || st.Total != 1 || st.Shed["bulk"] != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	sample.CPULoad = 0.2
+	s.Update()
+	if !s.Allow("bulk", config.PriorityLow) {
+		t.Error("expected shedding to stop once pressure drops")
+	}
+
+	var nilShedder *Shedder
+	if !nilShedder.Allow("bulk", config.PriorityLow) {
+		t.Error("nil shedder must allow everything")
+	}
+}
+
+func TestShedder_Fraction(t *testing.T) {
+	s := NewShedder(config.SheddingConfig{MemoryPercent: 80, NormalFraction: 0.5})
+	s.Sample = func() (pressure.Sample, error) { return pressure.Sample{MemoryPercent: 90}, nil }
+	s.Update()
+
+	shed := 0
+	for i := 0; i < 1000; i++ {
+		if !s.Allow("web", config.PriorityNormal) {
+			shed++
+		}
+	}
+	if shed < 400 || shed > 600 {
+		t.Errorf("shed %d of 1000 normal connections, want about half", shed)
+	}
+}
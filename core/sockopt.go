@@ -0,0 +1,97 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"nvelox/config"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// defaultKeepAliveCount is the keepalive_count of listeners without one.
+const defaultKeepAliveCount = 5
+
+// keepAlive returns the keepalive idle time, probe interval and count of s;
+// an idle time of 0 leaves keepalive alone. The interval defaults to a fifth
+// of the idle time, as in gnet, but not below the one second the kernel
+// counts in.
+func keepAlive(s config.SocketConfig) (idle, intvl time.Duration, cnt int) {
+	idle, err := time.ParseDuration(s.KeepAlive)
+	if err != nil {
+		return 0, 0, 0
+	}
+	intvl, err = time.ParseDuration(s.KeepAliveInterval)
+	if err != nil {
+		intvl = max(idle/5, time.Second)
+	}
+	cnt = s.KeepAliveCount
+	if cnt == 0 {
+		cnt = defaultKeepAliveCount
+	}
+	return idle, intvl, cnt
+}
+
+// deferAccept returns the defer_accept of s in whole seconds, 0 without one.
+func deferAccept(s config.SocketConfig) int {
+	d, err := time.ParseDuration(s.DeferAccept)
+	if err != nil {
+		return 0
+	}
+	return int(d / time.Second)
+}
+
+// applySocket sets the socket options of a listener on a connection it
+// accepted. Linux copies most of them from the listening socket, but not
+// all platforms do, and sockets handed over on reload keep the options of
+// the listener they were tuned for.
+func applySocket(c gnet.Conn, s config.SocketConfig) error {
+	if s.NoDelay != nil {
+		if err := c.SetNoDelay(*s.NoDelay); err != nil {
+			return err
+		}
+	}
+	if idle, intvl, cnt := keepAlive(s); idle > 0 {
+		if err := c.SetKeepAlive(true, idle, intvl, cnt); err != nil {
+			return err
+		}
+	}
+	if s.Linger != nil {
+		return c.SetLinger(*s.Linger)
+	}
+	return nil
+}
+
+// tunesListening reports whether a listener has options to set on its
+// listening sockets.
+func tunesListening(l *ListenerConfig) bool {
+	return l.Protocol != "udp" && l.Socket != (config.SocketConfig{})
+}
+
+// listenMatch returns the IP and port of a listener's bind address for
+// picking its listening sockets. Hosts given by name have a nil IP, which
+// takes every socket on the port.
+func listenMatch(l *ListenerConfig) (net.IP, int) {
+	host, _, _ := SplitHostPort(l.Addr)
+	host = strings.Trim(host, "[]")
+	if host == "" || host == "*" {
+		return net.IPv4zero, l.Port
+	}
+	return net.ParseIP(host), l.Port
+}
+
+// matchesListen reports whether a socket bound to ip and port belongs to a
+// listener bound to host (see listenMatch) and port.
+func matchesListen(host net.IP, port int, ip net.IP, sockPort int) bool {
+	if port == 0 || port != sockPort {
+		return false
+	}
+	if host == nil {
+		return true
+	}
+	if host.IsUnspecified() {
+		return ip.IsUnspecified()
+	}
+	return host.Equal(ip)
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package core
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"nvelox/config"
+
+	"golang.org/x/sys/unix"
+)
+
+const listenSocketSupported = true
+
+// setListenSocket sets the socket options of a listener on one of its
+// listening sockets.
+func setListenSocket(fd int, s config.SocketConfig) error {
+	if s.NoDelay != nil {
+		v := 0
+		if *s.NoDelay {
+			v = 1
+		}
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NODELAY, v); err != nil {
+			return os.NewSyscallError("setsockopt TCP_NODELAY", err)
+		}
+	}
+	if idle, intvl, cnt := keepAlive(s); idle > 0 {
+		for _, o := range []struct{ opt, val int }{
+			{unix.TCP_KEEPIDLE, int(idle / time.Second)},
+			{unix.TCP_KEEPINTVL, int(intvl / time.Second)},
+			{unix.TCP_KEEPCNT, cnt},
+		} {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, o.opt, o.val); err != nil {
+				return os.NewSyscallError("setsockopt keepalive", err)
+			}
+		}
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
+			return os.NewSyscallError("setsockopt SO_KEEPALIVE", err)
+		}
+	}
+	if s.Linger != nil {
+		l := &unix.Linger{Onoff: 1, Linger: int32(*s.Linger)}
+		if err := unix.SetsockoptLinger(fd, unix.SOL_SOCKET, unix.SO_LINGER, l); err != nil {
+			return os.NewSyscallError("setsockopt SO_LINGER", err)
+		}
+	}
+	if secs := deferAccept(s); secs > 0 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_DEFER_ACCEPT, secs); err != nil {
+			return os.NewSyscallError("setsockopt TCP_DEFER_ACCEPT", err)
+		}
+	}
+	if s.FastOpen > 0 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, s.FastOpen); err != nil {
+			return os.NewSyscallError("setsockopt TCP_FASTOPEN", err)
+		}
+	}
+	if s.Backlog > 0 {
+		// Listening again on a listening socket resizes its accept queue
+		if err := unix.Listen(fd, s.Backlog); err != nil {
+			return os.NewSyscallError("listen", err)
+		}
+	}
+	return nil
+}
+
+// controlListenSocket sets the socket options of a listener on a socket
+// bound by nvelox itself. It runs before the socket listens, so the backlog
+// is left to setBacklog.
+func controlListenSocket(c syscall.RawConn, s config.SocketConfig) error {
+	s.Backlog = 0
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = setListenSocket(int(fd), s)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// setBacklog resizes the accept queue of a socket listening already; 0
+// leaves it alone.
+func setBacklog(ln net.Listener, backlog int) error {
+	sc, ok := ln.(syscall.Conn)
+	if backlog == 0 || !ok {
+		return nil
+	}
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var lerr error
+	if err := c.Control(func(fd uintptr) {
+		lerr = unix.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return os.NewSyscallError("listen", lerr)
+}
+
+// tuneListenSockets sets the socket options of a listener on all of its
+// listening sockets and returns how many it found. gnet binds one socket
+// per event loop without handing them out, so they are picked from the
+// descriptors of the process by address; this must run once the loops
+// exist. Sockets of a group being replaced share the address and are
+// tuned as well, which is harmless: the replacement takes them over.
+func tuneListenSockets(l *ListenerConfig) (int, error) {
+	host, port := listenMatch(l)
+	n := 0
+	err := eachListenSocket(func(fd int, ip net.IP, sockPort int) error {
+		if !matchesListen(host, port, ip, sockPort) {
+			return nil
+		}
+		if err := setListenSocket(fd, l.Socket); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// eachListenSocket calls fn with every listening TCP socket of the process
+// and the address it is bound to, stopping at the first error.
+func eachListenSocket(fn func(fd int, ip net.IP, port int) error) error {
+	return eachBoundSocket(func(fd, sotype int, ip net.IP, port int) error {
+		if sotype != unix.SOCK_STREAM {
+			return nil
+		}
+		return fn(fd, ip, port)
+	})
+}
+
+// eachBoundSocket calls fn with the descriptor, type and local address of
+// every IP socket of the process taking traffic from any peer: listening TCP
+// sockets and unconnected UDP ones.
+func eachBoundSocket(fn func(fd, sotype int, ip net.IP, port int) error) error {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		sotype, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+		if err != nil {
+			continue
+		}
+		switch sotype {
+		case unix.SOCK_STREAM:
+			if v, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ACCEPTCONN); err != nil || v != 1 {
+				continue
+			}
+		case unix.SOCK_DGRAM:
+			if _, err := unix.Getpeername(fd); err == nil {
+				continue
+			}
+		default:
+			continue
+		}
+		sa, err := unix.Getsockname(fd)
+		if err != nil {
+			continue
+		}
+		switch a := sa.(type) {
+		case *unix.SockaddrInet4:
+			err = fn(fd, sotype, a.Addr[:], a.Port)
+		case *unix.SockaddrInet6:
+			err = fn(fd, sotype, a.Addr[:], a.Port)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package core
+
+import (
+	"net"
+	"syscall"
+
+	"nvelox/config"
+)
+
+const listenSocketSupported = false
+
+// controlListenSocket leaves listening sockets alone; accepted connections
+// still get the options through applySocket.
+func controlListenSocket(c syscall.RawConn, s config.SocketConfig) error {
+	return nil
+}
+
+func tuneListenSockets(l *ListenerConfig) (int, error) {
+	return 0, nil
+}
+
+func setBacklog(ln net.Listener, backlog int) error {
+	return nil
+}
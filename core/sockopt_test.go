@@ -0,0 +1,51 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestKeepAlive(t *testing.T) {
+	if idle, _, _ := keepAlive(config.SocketConfig{}); idle != 0 {
+		t.Errorf("keepalive enabled without a setting: %v", idle)
+	}
+	idle, intvl, cnt := keepAlive(config.SocketConfig{KeepAlive: "60s"})
+	if idle != time.Minute || intvl != 12*time.Second || cnt != defaultKeepAliveCount {
+		t.Errorf("defaults: %v %v %d", idle, intvl, cnt)
+	}
+	if _, intvl, _ := keepAlive(config.SocketConfig{KeepAlive: "2s"}); intvl != time.Second {
+		t.Errorf("interval below 1s: %v", intvl)
+	}
+	if deferAccept(config.SocketConfig{DeferAccept: "2500ms"}) != 2 {
+		t.Error("defer_accept not rounded down to seconds")
+	}
+}
+
+func TestMatchesListen(t *testing.T) {
+	for _, c := range []struct {
+		addr string
+		ip   string
+		port int
+		want bool
+	}{
+		{":443", "0.0.0.0", 443, true},
+		{"*:443", "::", 443, true},
+		{":443", "10.0.0.1", 443, false},
+		{"10.0.0.1:443", "10.0.0.1", 443, true},
+		{"10.0.0.1:443", "0.0.0.0", 443, false},
+		{"[::1]:443", "::1", 443, true},
+		{"10.0.0.1:443", "10.0.0.1", 8443, false},
+		{"example.com:443", "10.0.0.2", 443, true},
+	} {
+		_, port, _ := net.SplitHostPort(c.addr)
+		l := &ListenerConfig{Addr: c.addr}
+		l.Port, _ = net.LookupPort("tcp", port)
+		host, p := listenMatch(l)
+		if got := matchesListen(host, p, net.ParseIP(c.ip), c.port); got != c.want {
+			t.Errorf("%s vs %s:%d: got %v", c.addr, c.ip, c.port, got)
+		}
+	}
+}
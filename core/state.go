@@ -0,0 +1,282 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+
+	"nvelox/config"
+	"nvelox/core/health"
+	"nvelox/core/retry"
+	"nvelox/lb"
+)
+
+// Change actions reported by Apply.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeUpdated = "updated"
+)
+
+// Change describes one object touched by Apply.
+type Change struct {
+	Kind   string `json:"kind"` // listener, backend
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// Apply converges the running engine to the given listeners and backends.
+// The desired state is validated as a whole before anything is touched; on
+// failure the previous state stays in effect. Applying the current state again
+// is a no-op and returns no changes. Replaced listener groups keep their open
+// connections until those finish (see retire). A changed backend keeping its
+// balance algorithm swaps the servers of its pool in place, so servers that
+// stay keep their connection counts and health; otherwise it gets a new one.
+func (e *Engine) Apply(listeners []config.Listener, backends []config.Backend) ([]Change, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+	return e.apply(listeners, backends)
+}
+
+// apply is Apply with e.applyMu held.
+func (e *Engine) apply(listeners []config.Listener, backends []config.Backend) ([]Change, error) {
+	current := e.CurrentConfig()
+	candidate := *current
+	candidate.Listeners = append([]config.Listener(nil), listeners...)
+	candidate.Backends = append([]config.Backend(nil), backends...)
+	candidate.ApplyDefaults()
+	if err := config.Validate(&candidate); err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	// Diff backends and build runtimes for new or changed ones
+	oldBackends := make(map[string]config.Backend)
+	for _, b := range current.Backends {
+		oldBackends[b.Name] = b
+	}
+	runtimes := make([]*backendRuntime, 0)
+	resized := make(map[*lb.Pool]*backendRuntime)
+	for i := range candidate.Backends {
+		be := &candidate.Backends[i]
+		old, ok := oldBackends[be.Name]
+		delete(oldBackends, be.Name)
+		action := ChangeAdded
+		if ok {
+			if reflect.DeepEqual(old, *be) {
+				continue
+			}
+			action = ChangeUpdated
+		}
+		rt, err := e.newBackendRuntime(be)
+		if err != nil {
+			return nil, err
+		}
+		// A backend keeping its algorithm keeps its pool, whose membership
+		// is swapped in place below, so open connections stay counted
+		if b, ok := e.balancer(be.Name); ok && action == ChangeUpdated && old.Balance == be.Balance {
+			if pool, ok := b.(*lb.Pool); ok {
+				rt.balancer = pool
+				resized[pool] = rt
+			}
+		}
+		runtimes = append(runtimes, rt)
+		changes = append(changes, Change{Kind: "backend", Name: be.Name, Action: action})
+	}
+	removedBackends := make([]string, 0)
+	for _, b := range current.Backends {
+		if _, ok := oldBackends[b.Name]; ok {
+			removedBackends = append(removedBackends, b.Name)
+			changes = append(changes, Change{Kind: "backend", Name: b.Name, Action: ChangeRemoved})
+		}
+	}
+
+	// Diff listeners and expand new or changed ones
+	oldListeners := make(map[string]config.Listener)
+	for _, l := range current.Listeners {
+		oldListeners[l.Name] = l
+	}
+	expanded := make(map[string][]*ListenerConfig)
+	for _, l := range candidate.Listeners {
+		old, ok := oldListeners[l.Name]
+		delete(oldListeners, l.Name)
+		action := ChangeAdded
+		if ok {
+			if reflect.DeepEqual(old, l) {
+				continue
+			}
+			action = ChangeUpdated
+		}
+		lcs, err := ExpandListener(l)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+		expanded[l.Name] = lcs
+		changes = append(changes, Change{Kind: "listener", Name: l.Name, Action: action})
+	}
+	removedListeners := make([]string, 0)
+	for _, l := range current.Listeners {
+		if _, ok := oldListeners[l.Name]; ok {
+			removedListeners = append(removedListeners, l.Name)
+			changes = append(changes, Change{Kind: "listener", Name: l.Name, Action: ChangeRemoved})
+		}
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	// Install backends first so new listeners never see a missing backend
+	e.mu.Lock()
+	saved := e.saveBackendsLocked()
+	replaced := make([]*health.Checker, 0)
+	for pool, rt := range resized {
+		pool.SetServers(poolServers(rt.backend))
+		e.applyWeights(rt.backend.Name, pool, rt.resolved)
+		e.applyStates(rt.backend, pool, rt.resolved)
+		if rt.checker == nil {
+			// Without health checks no probe would bring a server back up
+			for _, s := range rt.backend.Servers {
+				pool.UpdateStatus(s.Address, true)
+			}
+		}
+	}
+	for _, rt := range runtimes {
+		if c, ok := e.Checkers[rt.backend.Name]; ok {
+			replaced = append(replaced, c)
+		}
+		rt.install(e)
+	}
+	for _, name := range removedBackends {
+		if c, ok := e.Checkers[name]; ok {
+			replaced = append(replaced, c)
+		}
+		delete(e.Balancers, name)
+		delete(e.Backends, name)
+		delete(e.Retries, name)
+		delete(e.Checkers, name)
+		delete(e.resolved, name)
+	}
+	e.mu.Unlock()
+
+	// Sockets of removed groups, before a new group may bind the same ports
+	detached := make(map[string][]boundSocket)
+	e.mu.RLock()
+	for _, name := range removedListeners {
+		if g, ok := e.groups[name]; ok {
+			detached[name] = g.sockets()
+		}
+	}
+	e.mu.RUnlock()
+
+	// Start replacement groups alongside the old ones (ReusePort)
+	started := make(map[string]*listenerGroup)
+	for _, l := range candidate.Listeners {
+		lcs, ok := expanded[l.Name]
+		if !ok {
+			continue
+		}
+		g, err := e.startGroup(l.Name, lcs)
+		if err != nil {
+			for _, g := range started {
+				g.stop()
+			}
+			e.mu.Lock()
+			for pool, rt := range resized {
+				name := rt.backend.Name
+				pool.SetServers(poolServers(saved.backends[name]))
+				e.applyWeights(name, pool, saved.resolved[name])
+				e.applyStates(saved.backends[name], pool, saved.resolved[name])
+			}
+			saved.restore(e)
+			e.mu.Unlock()
+			return nil, fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+		started[l.Name] = g
+	}
+
+	// Commit
+	e.mu.Lock()
+	retired := make(map[*listenerGroup][]*ListenerConfig)
+	for name, g := range started {
+		if old, ok := e.groups[name]; ok {
+			retired[old] = g.listeners
+		}
+		e.groups[name] = g
+	}
+	for _, name := range removedListeners {
+		if old, ok := e.groups[name]; ok {
+			retired[old] = nil
+			delete(e.groups, name)
+		}
+	}
+	all := make([]*ListenerConfig, 0, len(e.Listeners))
+	for _, l := range candidate.Listeners {
+		if lcs, ok := expanded[l.Name]; ok {
+			all = append(all, lcs...)
+		} else {
+			all = append(all, groupListeners(e.Listeners, l.Name)...)
+		}
+	}
+	e.Listeners = all
+	e.Config = &candidate
+	e.configureResolveCache(e.Config)
+	e.mu.Unlock()
+
+	for g, replacement := range retired {
+		e.retire(g, replacement, detached[g.name])
+	}
+	for _, c := range replaced {
+		c.Stop()
+	}
+	for _, rt := range runtimes {
+		if rt.checker != nil {
+			rt.checker.Start()
+		}
+	}
+
+	return changes, nil
+}
+
+// backendMaps is a copy of the engine backend maps used to roll back Apply.
+type backendMaps struct {
+	balancers map[string]lb.Balancer
+	backends  map[string]*config.Backend
+	checkers  map[string]*health.Checker
+	retries   map[string]*retry.Policy
+	resolved  map[string]map[string][]string
+}
+
+func (e *Engine) saveBackendsLocked() *backendMaps {
+	m := &backendMaps{
+		balancers: make(map[string]lb.Balancer, len(e.Balancers)),
+		backends:  make(map[string]*config.Backend, len(e.Backends)),
+		checkers:  make(map[string]*health.Checker, len(e.Checkers)),
+		retries:   make(map[string]*retry.Policy, len(e.Retries)),
+		resolved:  make(map[string]map[string][]string, len(e.resolved)),
+	}
+	for k, v := range e.Balancers {
+		m.balancers[k] = v
+	}
+	for k, v := range e.Backends {
+		m.backends[k] = v
+	}
+	for k, v := range e.Checkers {
+		m.checkers[k] = v
+	}
+	for k, v := range e.Retries {
+		m.retries[k] = v
+	}
+	for k, v := range e.resolved {
+		m.resolved[k] = v
+	}
+	return m
+}
+
+func (m *backendMaps) restore(e *Engine) {
+	e.Balancers = m.balancers
+	e.Backends = m.backends
+	e.Checkers = m.checkers
+	e.Retries = m.retries
+	e.resolved = m.resolved
+}
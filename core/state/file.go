@@ -0,0 +1,57 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// File is a Store keeping one file per key in a directory, for single
+// nodes that need state to survive restarts without running a server.
+// Writes replace a file atomically.
+type File struct {
+	dir string
+}
+
+// NewFile creates dir if needed and returns a store in it.
+func NewFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) path(key string) string {
+	return filepath.Join(f.dir, url.PathEscape(key))
+}
+
+func (f *File) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (f *File) Put(key string, value []byte) error {
+	path := f.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, value, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *File) Delete(key string) error {
+	err := os.Remove(f.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *File) Close() error {
+	return nil
+}
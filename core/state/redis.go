@@ -0,0 +1,226 @@
+package state
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis is a Store on a redis server, shared by every instance pointing at
+// it. It speaks the RESP protocol over one connection, reconnecting after
+// an error.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func NewRedis(addr, password string, db int, prefix string, timeout time.Duration) *Redis {
+	return &Redis{addr: addr, password: password, db: db, prefix: prefix, timeout: timeout}
+}
+
+func (r *Redis) Get(key string) ([]byte, error) {
+	v, err := r.do("GET", r.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (r *Redis) Put(key string, value []byte) error {
+	_, err := r.do("SET", r.prefix+key, string(value))
+	return err
+}
+
+func (r *Redis) Delete(key string) error {
+	_, err := r.do("DEL", r.prefix+key)
+	return err
+}
+
+// Add runs INCRBY and PEXPIRE for every counter in one pipeline.
+func (r *Redis) Add(deltas map[string]int64, ttl time.Duration) (map[string]int64, error) {
+	keys := make([]string, 0, len(deltas))
+	cmds := make([][]string, 0, 2*len(deltas))
+	ms := strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+	for key, d := range deltas {
+		keys = append(keys, key)
+		cmds = append(cmds,
+			[]string{"INCRBY", r.prefix + key, strconv.FormatInt(d, 10)},
+			[]string{"PEXPIRE", r.prefix + key, ms})
+	}
+	replies, err := r.pipeline(cmds)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(keys))
+	for i, key := range keys {
+		v, err := strconv.ParseInt(string(replies[2*i]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis %s: INCRBY %s: malformed reply %q", r.addr, key, replies[2*i])
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do runs one command and returns its bulk or simple string reply, nil for
+// a nil reply.
+func (r *Redis) do(args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+		}
+	}
+	v, err := r.roundTrip(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		r.conn.Close() // the connection state is unknown
+		r.conn = nil
+		return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	return v, err
+}
+
+// pipeline sends several commands at once and returns their replies, or
+// the first error reply after reading them all.
+func (r *Redis) pipeline(cmds [][]string) ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+		}
+	}
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	var buf []byte
+	for _, args := range cmds {
+		buf = appendCommand(buf, args)
+	}
+	replies := make([][]byte, len(cmds))
+	var replyErr error
+	_, err := r.conn.Write(buf)
+	for i := 0; err == nil && i < len(cmds); i++ {
+		replies[i], err = readReply(r.rd)
+		var e redisError
+		if errors.As(err, &e) {
+			replyErr = cmp.Or(replyErr, err)
+			err = nil
+		}
+	}
+	if err != nil {
+		r.conn.Close() // the connection state is unknown
+		r.conn = nil
+		return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	return replies, replyErr
+}
+
+// connect dials the server, authenticates and selects the database.
+// Callers hold r.mu.
+func (r *Redis) connect() error {
+	conn, err := net.DialTimeout("tcp", r.addr, r.timeout)
+	if err != nil {
+		return err
+	}
+	r.conn, r.rd = conn, bufio.NewReader(conn)
+	setup := make([][]string, 0, 2)
+	if r.password != "" {
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	for _, cmd := range setup {
+		if _, err := r.roundTrip(cmd...); err != nil {
+			conn.Close()
+			r.conn = nil
+			return fmt.Errorf("%s: %w", cmd[0], err)
+		}
+	}
+	return nil
+}
+
+// roundTrip writes a command and reads its reply. Callers hold r.mu.
+func (r *Redis) roundTrip(args ...string) ([]byte, error) {
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := r.conn.Write(appendCommand(nil, args)); err != nil {
+		return nil, err
+	}
+	return readReply(r.rd)
+}
+
+// appendCommand encodes a command as a RESP array of bulk strings.
+func appendCommand(buf []byte, args []string) []byte {
+	buf = fmt.Appendf(buf, "*%d\r\n", len(args))
+	for _, a := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return buf
+}
+
+// readReply reads one RESP reply of the kinds GET, SET, DEL, AUTH, SELECT,
+// INCRBY and PEXPIRE answer with.
+func readReply(rd *bufio.Reader) ([]byte, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+', ':':
+		return []byte(body), nil
+	case '-':
+		return nil, redisError(body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
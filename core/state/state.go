@@ -0,0 +1,134 @@
+// Package state stores runtime state, such as persisted weights and
+// traffic counters, in memory, in files or in a shared redis server.
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"nvelox/config"
+)
+
+// defaultTimeout bounds one command to a remote store.
+const defaultTimeout = 2 * time.Second
+
+// ErrNotFound is returned by Get for a key that was never stored.
+var ErrNotFound = errors.New("state: key not found")
+
+// Store keeps values by key. Implementations are safe for concurrent use.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	Close() error
+}
+
+// Counter is implemented by stores whose counters are shared by every
+// instance using them, for limits that hold across a fleet.
+type Counter interface {
+	// Add adds the deltas to their counters, each expiring ttl after its
+	// last change, and returns the resulting values.
+	Add(deltas map[string]int64, ttl time.Duration) (map[string]int64, error)
+}
+
+// New opens the store a configuration selects. Remote stores connect on
+// first use, so an unreachable server does not prevent startup.
+func New(cfg config.StateConfig) (Store, error) {
+	timeout := defaultTimeout
+	if d, err := time.ParseDuration(cfg.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	switch cfg.Type {
+	case "memory":
+		return NewMemory(), nil
+	case "file":
+		return NewFile(cfg.Path)
+	case "redis":
+		prefix := cfg.Prefix
+		if prefix == "" {
+			prefix = "nvelox:"
+		}
+		return NewRedis(cfg.Address, cfg.Password.Value(), cfg.DB, prefix, timeout), nil
+	default:
+		return nil, fmt.Errorf("state: unknown store type %q", cfg.Type)
+	}
+}
+
+// Node returns the name of this instance among those sharing a store.
+func Node(cfg config.StateConfig) string {
+	if cfg.Node != "" {
+		return cfg.Node
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "default"
+}
+
+// Memory is a Store that lasts as long as the process. Its counters are
+// those of the process alone.
+type Memory struct {
+	mu       sync.Mutex
+	values   map[string][]byte
+	counters map[string]memoryCounter
+}
+
+type memoryCounter struct {
+	value   int64
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string][]byte), counters: make(map[string]memoryCounter)}
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (m *Memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *Memory) Add(deltas map[string]int64, ttl time.Duration) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, c := range m.counters {
+		if !now.Before(c.expires) {
+			delete(m.counters, key)
+		}
+	}
+	out := make(map[string]int64, len(deltas))
+	for key, d := range deltas {
+		c := m.counters[key]
+		c.value += d
+		c.expires = now.Add(ttl)
+		m.counters[key] = c
+		out[key] = c.value
+	}
+	return out, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,224 @@
+package state
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	if _, err := s.Get("weights"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key = %v, want ErrNotFound", err)
+	}
+	if err := s.Put("stats/node-a", []byte("a: 1\n")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put("stats/node-a", []byte("a: 2\n")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if v, err := s.Get("stats/node-a"); err != nil || string(v) != "a: 2\n" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if err := s.Put("empty", nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if v, err := s.Get("empty"); err != nil || len(v) != 0 {
+		t.Fatalf("Get of an empty value = %q, %v", v, err)
+	}
+	if err := s.Delete("stats/node-a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("stats/node-a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("never"); err != nil {
+		t.Fatalf("Delete of a missing key: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+	m := NewMemory()
+	testCounter(t, m, m)
+
+	// Counters restart once expired
+	if got, _ := m.Add(map[string]int64{"rl/c": 1}, time.Nanosecond); got["rl/c"] != 1 {
+		t.Fatalf("Add = %v", got)
+	}
+	time.Sleep(time.Millisecond)
+	if got, _ := m.Add(map[string]int64{"rl/c": 1}, time.Minute); got["rl/c"] != 1 {
+		t.Errorf("Add after expiry = %v, want 1", got)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(config.StateConfig{Type: "file", Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	// Values outlive the store
+	s.Put("weights", []byte("web: {}\n"))
+	s2, _ := NewFile(dir)
+	if v, err := s2.Get("weights"); err != nil || string(v) != "web: {}\n" {
+		t.Errorf("Get from a reopened store = %q, %v", v, err)
+	}
+}
+
+// testCounter checks that counters add up, in two stores sharing them when
+// other is not s.
+func testCounter(t *testing.T, s, other Counter) {
+	t.Helper()
+	got, err := s.Add(map[string]int64{"rl/a": 3, "rl/b": 1}, time.Minute)
+	if err != nil || got["rl/a"] != 3 || got["rl/b"] != 1 {
+		t.Fatalf("Add = %v, %v", got, err)
+	}
+	got, err = other.Add(map[string]int64{"rl/a": 2}, time.Minute)
+	if err != nil || got["rl/a"] != 5 || len(got) != 1 {
+		t.Fatalf("second Add = %v, %v", got, err)
+	}
+}
+
+// fakeRedis serves GET, SET, DEL, AUTH, SELECT, INCRBY and PEXPIRE from a
+// map.
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func startFakeRedis(t *testing.T) (string, *fakeRedis) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	f := &fakeRedis{values: make(map[string]string)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return l.Addr().String(), f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	rd := bufio.NewReader(c)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			hdr, _ := rd.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(hdr[1:]))
+			buf := make([]byte, size+2)
+			io.ReadFull(rd, buf)
+			args[i] = string(buf[:size])
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		var reply string
+		switch args[0] {
+		case "AUTH":
+			reply = "+OK\r\n"
+			if args[1] != "secret" {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT", "SET":
+			reply = "+OK\r\n"
+			if args[0] == "SET" {
+				f.values[args[1]] = args[2]
+			}
+		case "GET":
+			v, ok := f.values[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case "INCRBY":
+			cur, _ := strconv.ParseInt(f.values[args[1]], 10, 64)
+			d, _ := strconv.ParseInt(args[2], 10, 64)
+			f.values[args[1]] = strconv.FormatInt(cur+d, 10)
+			reply = ":" + f.values[args[1]] + "\r\n"
+		case "PEXPIRE":
+			reply = ":1\r\n"
+		case "DEL":
+			reply = ":0\r\n"
+			if _, ok := f.values[args[1]]; ok {
+				delete(f.values, args[1])
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		c.Write([]byte(reply))
+	}
+}
+
+func TestRedis(t *testing.T) {
+	addr, f := startFakeRedis(t)
+	s, err := New(config.StateConfig{Type: "redis", Address: addr, Password: config.Secret{Ref: "secret"}, DB: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	f.mu.Lock()
+	if got := strings.Join(f.commands[:2], " "); got != "AUTH SELECT" {
+		t.Errorf("connection setup = %s, want AUTH SELECT", got)
+	}
+	if _, ok := f.values["nvelox:empty"]; !ok {
+		t.Errorf("expected keys under the default prefix, got %v", f.values)
+	}
+	f.mu.Unlock()
+
+	// Counters are shared by every instance using the server
+	testCounter(t, s.(*Redis), NewRedis(addr, "secret", 2, "nvelox:", time.Second))
+	f.mu.Lock()
+	if f.values["nvelox:rl/a"] != "5" {
+		t.Errorf("counter under the prefix = %q, want 5", f.values["nvelox:rl/a"])
+	}
+	f.mu.Unlock()
+
+	// A wrong password fails every command instead of hanging
+	bad := NewRedis(addr, "wrong", 0, "", time.Second)
+	if _, err := bad.Get("weights"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("expected an AUTH error, got %v", err)
+	}
+}
+
+func TestRedis_Unreachable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewRedis(addr, "", 0, "nvelox:", 100*time.Millisecond)
+	if err := s.Put("weights", []byte("x")); err == nil {
+		t.Error("expected an error without a server")
+	}
+}
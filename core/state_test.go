@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func startTestEngine(t *testing.T, cfg *config.Config) *Engine {
+	engine := NewEngine(cfg)
+	for _, l := range cfg.Listeners {
+		expanded, err := ExpandListener(l)
+		if err != nil {
+			t.Fatalf("ExpandListener failed: %v", err)
+		}
+		engine.Listeners = append(engine.Listeners, expanded...)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		engine.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		engine.mu.RLock()
+		n := len(engine.groups)
+		engine.mu.RUnlock()
+		if n == len(cfg.Listeners) {
+			return engine
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for engine start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEngine_Apply(t *testing.T) {
+	port := freePort(t)
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "be", Servers: []config.Server{{Address: "127.0.0.1:1"}}}},
+		Listeners: []config.Listener{
+			{Name: "a", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d", port)}, Protocol: "tcp", DefaultBackend: "be"},
+		},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	// Same state again: nothing to do
+	changes, err := engine.Apply(cfg.Listeners, cfg.Backends)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	// Add a listener
+	newPort := freePort(t)
+	listeners := append(cfg.Listeners, config.Listener{
+		Name: "b", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d", newPort)}, DefaultBackend: "be",
+	})
+	changes, err = engine.Apply(listeners, cfg.Backends)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "listener", Name: "b", Action: ChangeAdded}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", newPort), time.Second)
+	if err != nil {
+		t.Fatalf("new listener not accepting: %v", err)
+	}
+	conn.Close()
+	if engine.ListenerCount() != 2 {
+		t.Errorf("ListenerCount = %d, want 2", engine.ListenerCount())
+	}
+
+	// Invalid state leaves everything untouched
+	if _, err := engine.Apply(listeners, nil); err == nil {
+		t.Error("expected error for listeners referencing removed backend")
+	}
+	if len(engine.CurrentConfig().Listeners) != 2 {
+		t.Error("failed apply changed the config")
+	}
+
+	// Remove the original listener
+	changes, err = engine.Apply(listeners[1:], cfg.Backends)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "listener", Name: "a", Action: ChangeRemoved}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second); err == nil {
+		conn.Close()
+		t.Error("removed listener still accepting")
+	}
+}
+
+func TestEngine_ApplyKeepsPool(t *testing.T) {
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "be", Balance: "leastconn", Servers: []config.Server{{Address: "127.0.0.1:1", MaxConns: 1}}}},
+		Listeners: []config.Listener{
+			{Name: "a", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d", freePort(t))}, Protocol: "tcp", DefaultBackend: "be"},
+		},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+	pool, _ := engine.balancer("be")
+	pool.OnConnect("127.0.0.1:1") // an open connection
+
+	// Adding a server keeps the pool and its connection count
+	backends := []config.Backend{{Name: "be", Balance: "leastconn", Servers: []config.Server{
+		{Address: "127.0.0.1:1", MaxConns: 1}, {Address: "127.0.0.1:2"},
+	}}}
+	changes, err := engine.Apply(cfg.Listeners, backends)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (Change{Kind: "backend", Name: "be", Action: ChangeUpdated}) {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if b, _ := engine.balancer("be"); b != pool {
+		t.Fatal("expected the pool to be kept")
+	}
+	for i := 0; i < 3; i++ {
+		if s, _ := pool.Next(); s != "127.0.0.1:2" {
+			t.Fatalf("full server picked: %s", s)
+		}
+	}
+
+	// Changing the algorithm builds a new pool
+	backends[0].Balance = "roundrobin"
+	if _, err := engine.Apply(cfg.Listeners, backends); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if b, _ := engine.balancer("be"); b == pool {
+		t.Error("expected a new pool for a new algorithm")
+	}
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"nvelox/core/logging"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultStatsInterval is how often counters are written to admin.stats_file.
+const defaultStatsInterval = time.Minute
+
+// Stats are cumulative traffic counters. With admin.stats_file or a state
+// store they survive restarts.
+type Stats struct {
+	Since       time.Time               `yaml:"since"` // when counting began
+	Connections int64                   `yaml:"connections"`
+	Backends    map[string]BackendStats `yaml:"backends"`
+	Hellos      HelloStats              `yaml:"hellos"`
+	// Backpressure counts max_conn_buffer trips per listener and backend.
+	Backpressure map[string]map[string]BackpressureStats `yaml:"backpressure,omitempty"`
+}
+
+// BackpressureStats counts how often the max_conn_buffer high-water mark of
+// a listener tripped on connections to one backend, in either direction.
+type BackpressureStats struct {
+	Stalls       int64   `yaml:"stalls"`        // backend reads paused for a client slower than the backend
+	StallSeconds float64 `yaml:"stall_seconds"` // time backend reads spent paused
+	Overflows    int64   `yaml:"overflows"`     // connections closed (MEM_LIMIT) buffering for a backend not yet connected
+}
+
+// HelloStats counts the ClientHellos TLS inspection gave up on.
+type HelloStats struct {
+	Malformed  int64 `yaml:"malformed"`  // complete but unparsable
+	Oversized  int64 `yaml:"oversized"`  // larger than tls_inspect.max_bytes
+	Incomplete int64 `yaml:"incomplete"` // cut off by tls_inspect.timeout or the client
+}
+
+// Reasons inspection gives up on a ClientHello, see HelloStats.
+const (
+	helloMalformed  = "malformed"
+	helloOversized  = "oversized"
+	helloIncomplete = "incomplete"
+)
+
+// BackendStats counts the closed connections of one backend pool and the
+// bytes they carried.
+type BackendStats struct {
+	Connections int64 `yaml:"connections"`
+	BytesIn     int64 `yaml:"bytes_in"`  // client -> backend
+	BytesOut    int64 `yaml:"bytes_out"` // backend -> client
+}
+
+// counters accumulates Stats. Connections are counted when accepted, bytes
+// when the connection closes. A nil *counters counts nothing.
+type counters struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func newCounters(now time.Time) *counters {
+	return &counters{stats: Stats{Since: now, Backends: make(map[string]BackendStats)}}
+}
+
+func (c *counters) connOpened() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.stats.Connections++
+	c.mu.Unlock()
+}
+
+func (c *counters) connClosed(backend string, in, out int64) {
+	if c == nil || backend == "" {
+		return
+	}
+	c.mu.Lock()
+	b := c.stats.Backends[backend]
+	b.Connections++
+	b.BytesIn += in
+	b.BytesOut += out
+	c.stats.Backends[backend] = b
+	c.mu.Unlock()
+}
+
+func (c *counters) helloFailed(reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	switch reason {
+	case helloMalformed:
+		c.stats.Hellos.Malformed++
+	case helloOversized:
+		c.stats.Hellos.Oversized++
+	case helloIncomplete:
+		c.stats.Hellos.Incomplete++
+	}
+	c.mu.Unlock()
+}
+
+// stalled counts backend reads of a connection paused for d until its
+// client drained.
+func (c *counters) stalled(listener, backend string, d time.Duration) {
+	c.backpressure(listener, backend, func(b *BackpressureStats) {
+		b.Stalls++
+		b.StallSeconds += d.Seconds()
+	})
+}
+
+// overflowed counts a connection closed for buffering more than
+// max_conn_buffer while its backend connected.
+func (c *counters) overflowed(listener, backend string) {
+	c.backpressure(listener, backend, func(b *BackpressureStats) {
+		b.Overflows++
+	})
+}
+
+func (c *counters) backpressure(listener, backend string, update func(*BackpressureStats)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backpressureLocked(listener, backend, update)
+}
+
+// backpressureLocked updates the backpressure counters of a listener and
+// backend. Callers hold c.mu.
+func (c *counters) backpressureLocked(listener, backend string, update func(*BackpressureStats)) {
+	if c.stats.Backpressure == nil {
+		c.stats.Backpressure = make(map[string]map[string]BackpressureStats)
+	}
+	backends := c.stats.Backpressure[listener]
+	if backends == nil {
+		backends = make(map[string]BackpressureStats)
+		c.stats.Backpressure[listener] = backends
+	}
+	b := backends[backend]
+	update(&b)
+	backends[backend] = b
+}
+
+func (c *counters) snapshot() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Backends = maps.Clone(c.stats.Backends)
+	if c.stats.Backpressure != nil {
+		s.Backpressure = make(map[string]map[string]BackpressureStats, len(c.stats.Backpressure))
+		for listener, backends := range c.stats.Backpressure {
+			s.Backpressure[listener] = maps.Clone(backends)
+		}
+	}
+	return s
+}
+
+// restore adds previously persisted counters.
+func (c *counters) restore(s Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.Since.IsZero() && s.Since.Before(c.stats.Since) {
+		c.stats.Since = s.Since
+	}
+	c.stats.Connections += s.Connections
+	c.stats.Hellos.Malformed += s.Hellos.Malformed
+	c.stats.Hellos.Oversized += s.Hellos.Oversized
+	c.stats.Hellos.Incomplete += s.Hellos.Incomplete
+	for name, b := range s.Backends {
+		cur := c.stats.Backends[name]
+		cur.Connections += b.Connections
+		cur.BytesIn += b.BytesIn
+		cur.BytesOut += b.BytesOut
+		c.stats.Backends[name] = cur
+	}
+	for listener, backends := range s.Backpressure {
+		for backend, b := range backends {
+			c.backpressureLocked(listener, backend, func(cur *BackpressureStats) {
+				cur.Stalls += b.Stalls
+				cur.StallSeconds += b.StallSeconds
+				cur.Overflows += b.Overflows
+			})
+		}
+	}
+}
+
+// Stats returns the cumulative traffic counters.
+func (e *Engine) Stats() Stats {
+	return e.counters.snapshot()
+}
+
+// persistsStats reports whether counters are persisted, to a state store or
+// admin.stats_file.
+func (e *Engine) persistsStats() bool {
+	return e.Store != nil || e.CurrentConfig().Admin.StatsFile != ""
+}
+
+// loadStats restores the counters of this node. Callers hold e.mu.
+func (e *Engine) loadStats() {
+	key, path := statsKey+e.node, e.Config.Admin.StatsFile
+	if e.Store == nil && path == "" {
+		return
+	}
+	data, err := e.readState(key, path)
+	if err == nil {
+		if data == nil {
+			return
+		}
+		var s Stats
+		if err = yaml.Unmarshal(data, &s); err == nil {
+			e.counters.restore(s)
+			return
+		}
+	}
+	logging.Warn("[STATS] failed to load %s: %v", e.stateName(key, path), err)
+}
+
+// persistStats writes the counters every stats_interval until ctx is done.
+// Stop writes them a last time.
+func (e *Engine) persistStats(ctx context.Context) {
+	if !e.persistsStats() {
+		return
+	}
+	interval := defaultStatsInterval
+	if d, err := time.ParseDuration(e.CurrentConfig().Admin.StatsInterval); err == nil && d > 0 {
+		interval = d
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.writeStats(); err != nil {
+				logging.Warn("[STATS] %v", err)
+			}
+		}
+	}
+}
+
+func (e *Engine) writeStats() error {
+	if !e.persistsStats() {
+		return nil
+	}
+	data, err := yaml.Marshal(e.counters.snapshot())
+	if err != nil {
+		return err
+	}
+	if err := e.writeState(statsKey+e.node, e.CurrentConfig().Admin.StatsFile, data); err != nil {
+		return fmt.Errorf("failed to persist stats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_StatsPersistence(t *testing.T) {
+	cfg := &config.Config{
+		Admin: config.AdminConfig{StatsFile: filepath.Join(t.TempDir(), "stats.yaml")},
+	}
+	e := NewEngine(cfg)
+	e.counters.connOpened()
+	e.counters.connOpened()
+	e.counters.connClosed("web", 100, 2000)
+	e.counters.connClosed("", 1, 1) // never reached a backend
+	e.counters.stalled("edge", "web", 1500*time.Millisecond)
+	e.counters.overflowed("edge", "web")
+	if err := e.writeStats(); err != nil {
+		t.Fatalf("writeStats failed: %v", err)
+	}
+
+	// A restarted engine continues from the persisted counters
+	e2 := NewEngine(cfg)
+	e2.loadStats()
+	e2.counters.connOpened()
+	e2.counters.connClosed("web", 10, 20)
+	e2.counters.stalled("edge", "web", 500*time.Millisecond)
+
+	s := e2.Stats()
+	if s.Connections != 3 {
+		t.Errorf("connections = %d, want 3", s.Connections)
+	}
+	want := BackendStats{Connections: 2, BytesIn: 110, BytesOut: 2020}
+	if got := s.Backends["web"]; got != want {
+		t.Errorf("web = %+v, want %+v", got, want)
+	}
+	wantBP := BackpressureStats{Stalls: 2, StallSeconds: 2, Overflows: 1}
+	if got := s.Backpressure["edge"]["web"]; got != wantBP {
+		t.Errorf("edge/web backpressure = %+v, want %+v", got, wantBP)
+	}
+	if first := e.Stats().Since; !s.Since.Equal(first) {
+		t.Errorf("since = %v, want %v", s.Since, first)
+	}
+}
+
+func TestEngine_LoadStats_Missing(t *testing.T) {
+	cfg := &config.Config{
+		Admin: config.AdminConfig{StatsFile: filepath.Join(t.TempDir(), "missing.yaml")},
+	}
+	before := time.Now()
+	e := NewEngine(cfg)
+	e.loadStats()
+	s := e.Stats()
+	if s.Connections != 0 || len(s.Backends) != 0 || s.Since.Before(before) {
+		t.Errorf("unexpected stats from missing file: %+v", s)
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"nvelox/core/state"
+)
+
+// Keys of the runtime state kept in a state store. Weights and server states
+// are shared by the instances using the store; stats are per node.
+const (
+	weightsKey = "weights"
+	statesKey  = "server_states"
+	statsKey   = "stats/"
+)
+
+// readState returns a persisted value from the state store, or from file
+// without one. A value never written is nil.
+func (e *Engine) readState(key, file string) ([]byte, error) {
+	if e.Store != nil {
+		data, err := e.Store.Get(key)
+		if errors.Is(err, state.ErrNotFound) {
+			return nil, nil
+		}
+		return data, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// writeState persists a value to the state store, or atomically to file
+// without one.
+func (e *Engine) writeState(key, file string, data []byte) error {
+	if e.Store != nil {
+		return e.Store.Put(key, data)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// stateName describes where a value is persisted, for messages.
+func (e *Engine) stateName(key, file string) string {
+	if e.Store != nil {
+		return fmt.Sprintf("state %s", key)
+	}
+	return file
+}
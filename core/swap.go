@@ -0,0 +1,232 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+var (
+	ErrUnknownListener = errors.New("unknown listener")
+	ErrUnknownBackend  = errors.New("unknown backend")
+)
+
+// Swap reports a listener whose backend was switched.
+type Swap struct {
+	Listener string `json:"listener"`
+	Previous string `json:"previous"`
+	Backend  string `json:"backend"`
+	Draining int    `json:"draining"` // TCP connections still on the previous backend
+}
+
+// SwapBackend atomically points a listener at another backend. New
+// connections go to the new backend at once; existing ones keep their
+// backend and are closed once drain elapses (0 lets them finish on their own).
+// UDP sessions already established keep their backend until they expire.
+func (e *Engine) SwapBackend(listener, backend string, drain time.Duration) (*Swap, error) {
+	swaps, err := e.swap(map[string]string{listener: backend}, drain)
+	if err != nil {
+		return nil, err
+	}
+	return &swaps[0], nil
+}
+
+// SwapListeners atomically exchanges the backends of two listeners, which for
+// L4 forwarding is the same as swapping their ports between blue and green.
+func (e *Engine) SwapListeners(a, b string, drain time.Duration) ([]Swap, error) {
+	if a == b {
+		return nil, fmt.Errorf("cannot swap listener %s with itself", a)
+	}
+	backends := make(map[string]string, 2)
+	cfg := e.CurrentConfig()
+	for _, name := range []string{a, b} {
+		l, ok := findListener(cfg.Listeners, name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownListener, name)
+		}
+		backends[name] = l.DefaultBackend
+	}
+	return e.swap(map[string]string{a: backends[b], b: backends[a]}, drain)
+}
+
+// swap assigns new default backends to listener groups in one step.
+func (e *Engine) swap(assign map[string]string, drain time.Duration) ([]Swap, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	e.mu.Lock()
+	for name, backend := range assign {
+		if _, ok := findListener(e.Config.Listeners, name); !ok {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrUnknownListener, name)
+		}
+		if _, ok := e.Backends[backend]; !ok {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+		}
+	}
+
+	cfg := *e.Config
+	cfg.Listeners = append([]config.Listener(nil), e.Config.Listeners...)
+	swaps := make([]Swap, 0, len(assign))
+	handlers := make(map[string]*ProxyEventHandler)
+	for i := range cfg.Listeners {
+		l := &cfg.Listeners[i]
+		backend, ok := assign[l.Name]
+		if !ok {
+			continue
+		}
+		swaps = append(swaps, Swap{Listener: l.Name, Previous: l.DefaultBackend, Backend: backend})
+		l.DefaultBackend = backend
+		if g, ok := e.groups[l.Name]; ok {
+			handlers[l.Name] = g.handler
+		}
+	}
+
+	updateListeners(e, assign, func(lc *ListenerConfig, backend string) {
+		lc.DefaultBackend = backend
+	})
+	e.Config = &cfg
+	e.mu.Unlock()
+
+	for i := range swaps {
+		sw := &swaps[i]
+		logging.Info("[SWAP] listener %s: %s -> %s", sw.Listener, sw.Previous, sw.Backend)
+		h, ok := handlers[sw.Listener]
+		if !ok || sw.Previous == sw.Backend {
+			continue
+		}
+		sw.Draining = h.countRouted(sw.Listener, sw.Previous)
+		if sw.Draining > 0 {
+			e.drainBackend(h, sw.Listener, sw.Previous, drain)
+		}
+	}
+	return swaps, nil
+}
+
+// updateListeners applies update to the ListenerConfigs of the groups in
+// values, with the value of their group. ListenerConfigs are shared with live
+// connections, so they are replaced rather than mutated. Callers hold e.mu.
+func updateListeners[V any](e *Engine, values map[string]V, update func(*ListenerConfig, V)) {
+	listeners := make([]*ListenerConfig, 0, len(e.Listeners))
+	for _, lc := range e.Listeners {
+		if v, ok := values[lc.Group]; ok {
+			cp := *lc
+			update(&cp, v)
+			lc = &cp
+		}
+		listeners = append(listeners, lc)
+	}
+	for name, g := range e.groups {
+		if _, ok := values[name]; ok {
+			g.listeners = groupListeners(listeners, name)
+			g.handler.setListeners(g.listeners)
+		}
+	}
+	e.Listeners = listeners
+}
+
+func findListener(listeners []config.Listener, name string) (config.Listener, bool) {
+	for _, l := range listeners {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return config.Listener{}, false
+}
+
+// setListeners replaces the listener lookup table.
+func (h *ProxyEventHandler) setListeners(listeners []*ListenerConfig) {
+	listenerMap := make(map[string]*ListenerConfig, len(listeners))
+	for _, l := range listeners {
+		listenerMap[fmt.Sprintf("%s:%d", l.Protocol, l.Port)] = l
+	}
+	h.mu.Lock()
+	h.listenerMap = listenerMap
+	h.mu.Unlock()
+}
+
+// connCount returns the open TCP connections and UDP sessions.
+func (h *ProxyEventHandler) connCount() int {
+	n := 0
+	h.conns.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	h.udpSessions.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// idle reports whether the handler has no open connections or sessions.
+func (h *ProxyEventHandler) idle() bool {
+	return h.connCount() == 0
+}
+
+// closeUDPSessions closes the upstream sockets of the UDP sessions, which
+// ends them; it returns how many there were.
+func (h *ProxyEventHandler) closeUDPSessions() int {
+	n := 0
+	h.udpSessions.Range(func(_, v any) bool {
+		v.(net.Conn).Close()
+		n++
+		return true
+	})
+	return n
+}
+
+// countRouted returns the open TCP connections of a group routed to backend.
+func (h *ProxyEventHandler) countRouted(group, backend string) int {
+	return h.countConns(routedTo(group, backend))
+}
+
+// closeRouted terminates the TCP connections of a group routed to backend.
+func (h *ProxyEventHandler) closeRouted(group, backend string) int {
+	return h.closeConns(routedTo(group, backend))
+}
+
+func routedTo(group, backend string) func(*ConnContext) bool {
+	return func(ctx *ConnContext) bool {
+		return ctx.group == group && ctx.backendName == backend
+	}
+}
+
+// countConns returns the open TCP connections matching match, which is
+// called with ctx.mu held.
+func (h *ProxyEventHandler) countConns(match func(*ConnContext) bool) int {
+	n := 0
+	h.conns.Range(func(k, _ any) bool {
+		ctx := k.(*ConnContext)
+		ctx.mu.Lock()
+		if !ctx.closed && match(ctx) {
+			n++
+		}
+		ctx.mu.Unlock()
+		return true
+	})
+	return n
+}
+
+// closeConns terminates the connected TCP connections matching match.
+// Closing the backend side ends the copy loop, which closes the client.
+func (h *ProxyEventHandler) closeConns(match func(*ConnContext) bool) int {
+	n := 0
+	h.conns.Range(func(k, _ any) bool {
+		ctx := k.(*ConnContext)
+		ctx.mu.Lock()
+		if !ctx.closed && ctx.BackendConn != nil && match(ctx) {
+			ctx.reason = StatusDrained
+			ctx.BackendConn.Close()
+			n++
+		}
+		ctx.mu.Unlock()
+		return true
+	})
+	return n
+}
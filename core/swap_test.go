@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"nvelox/config"
+)
+
+func newSwapEngine() *Engine {
+	cfg := &config.Config{
+		Version: "2",
+		Backends: []config.Backend{
+			{Name: "blue", Servers: []config.Server{{Address: "10.0.0.1:80"}}},
+			{Name: "green", Servers: []config.Server{{Address: "10.0.0.2:80"}}},
+		},
+		Listeners: []config.Listener{
+			{Name: "prod", Bind: config.Binds{":80"}, Protocol: "tcp", DefaultBackend: "blue"},
+			{Name: "stage", Bind: config.Binds{":81"}, Protocol: "tcp", DefaultBackend: "green"},
+		},
+	}
+	e := NewEngine(cfg)
+	for i := range cfg.Backends {
+		e.Backends[cfg.Backends[i].Name] = &cfg.Backends[i]
+	}
+	for _, l := range cfg.Listeners {
+		lcs, _ := ExpandListener(l)
+		e.Listeners = append(e.Listeners, lcs...)
+	}
+	return e
+}
+
+func TestEngine_SwapBackend(t *testing.T) {
+	e := newSwapEngine()
+	old := e.Listeners[0]
+
+	sw, err := e.SwapBackend("prod", "green", 0)
+	if err != nil {
+		t.Fatalf("SwapBackend failed: %v", err)
+	}
+	if sw.Previous != "blue" || sw.Backend != "green" {
+		t.Errorf("unexpected swap: %+v", sw)
+	}
+	if got := e.CurrentConfig().Listeners[0].DefaultBackend; got != "green" {
+		t.Errorf("config backend = %s, want green", got)
+	}
+	if e.Listeners[0].DefaultBackend != "green" || old.DefaultBackend != "blue" {
+		t.Error("expected listener config to be replaced, not mutated")
+	}
+
+	if _, err := e.SwapBackend("missing", "green", 0); !errors.Is(err, ErrUnknownListener) {
+		t.Errorf("expected ErrUnknownListener, got %v", err)
+	}
+	if _, err := e.SwapBackend("prod", "missing", 0); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("expected ErrUnknownBackend, got %v", err)
+	}
+}
+
+func TestEngine_SwapListeners(t *testing.T) {
+	e := newSwapEngine()
+
+	swaps, err := e.SwapListeners("prod", "stage", 0)
+	if err != nil {
+		t.Fatalf("SwapListeners failed: %v", err)
+	}
+	if len(swaps) != 2 {
+		t.Fatalf("expected 2 swaps, got %+v", swaps)
+	}
+	cfg := e.CurrentConfig()
+	if cfg.Listeners[0].DefaultBackend != "green" || cfg.Listeners[1].DefaultBackend != "blue" {
+		t.Errorf("backends not exchanged: %+v", cfg.Listeners)
+	}
+	if _, err := e.SwapListeners("prod", "prod", 0); err == nil {
+		t.Error("expected error swapping a listener with itself")
+	}
+}
+
+func TestHandler_closeRouted(t *testing.T) {
+	h := &ProxyEventHandler{}
+	client, server := net.Pipe()
+	defer server.Close()
+
+	blue := &ConnContext{group: "prod", backendName: "blue", BackendConn: client}
+	green := &ConnContext{group: "prod", backendName: "green"}
+	h.conns.Store(blue, struct{}{})
+	h.conns.Store(green, struct{}{})
+
+	if n := h.countRouted("prod", "blue"); n != 1 {
+		t.Errorf("countRouted = %d, want 1", n)
+	}
+	if n := h.closeRouted("prod", "blue"); n != 1 {
+		t.Errorf("closeRouted = %d, want 1", n)
+	}
+	if blue.reason != StatusDrained {
+		t.Errorf("reason = %q, want %q", blue.reason, StatusDrained)
+	}
+	if _, err := client.Write([]byte("x")); err == nil {
+		t.Error("expected backend connection to be closed")
+	}
+}
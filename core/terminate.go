@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+)
+
+// tlsHandshakeTimeout is how long a client has to complete the handshake of
+// a listener terminating TLS.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// terminationConfig builds the server side TLS configuration of a listener.
+func terminationConfig(t config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair([]byte(t.Cert.Value()), []byte(t.Key.Value()))
+	if err != nil {
+		return nil, err
+	}
+	min := uint16(tls.VersionTLS12)
+	if t.MinVersion == "1.3" {
+		min = tls.VersionTLS13
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: min}, nil
+}
+
+// terminateTLS puts TLS termination between the client and a dialed backend
+// connection. The handler goes on treating the returned connection as the
+// backend: the encrypted client bytes written to it are decrypted on their
+// way to backend, and reading it yields the encrypted replies. Closing
+// either side tears the other down.
+func (h *ProxyEventHandler) terminateTLS(lifetime context.Context, backend net.Conn, ctx *ConnContext, l *ListenerConfig) net.Conn {
+	front, back := net.Pipe()
+	tc := tls.Server(back, l.TLS)
+	go func() {
+		defer backend.Close()
+		defer tc.Close()
+
+		hctx, cancel := context.WithTimeout(lifetime, tlsHandshakeTimeout)
+		err := tc.HandshakeContext(hctx)
+		cancel()
+		if err != nil {
+			// Unblock a handler writing to front before taking ctx.mu
+			tc.Close()
+			if lifetime.Err() == nil {
+				logging.Warn("[TLS] handshake with %s on %s failed: %v", ctx.Client, l.Name, err)
+				ctx.mu.Lock()
+				ctx.reason = StatusTLSError
+				ctx.mu.Unlock()
+			}
+			return
+		}
+		state := tc.ConnectionState()
+		ctx.trace.event(traceInspected, "tls version=%s sni=%s", tls.VersionName(state.Version), state.ServerName)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			io.Copy(backend, tc)
+			backend.Close()
+		}()
+		io.Copy(tc, backend)
+		tc.Close()
+		<-done
+	}()
+	return front
+}
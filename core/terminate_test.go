@@ -0,0 +1,100 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+// selfSigned returns a PEM certificate and key for localhost.
+func selfSigned(t *testing.T) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestEngine_TerminateTLS(t *testing.T) {
+	cert, key := selfSigned(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "echo", Servers: []config.Server{{Address: echoServer(t)}}}},
+		Listeners: []config.Listener{{
+			Name: "web", Bind: config.Binds{addr}, Protocol: "tcp", DefaultBackend: "echo",
+			TLS: config.TLSConfig{Cert: config.Secret{Ref: cert}, Key: config.Secret{Ref: key}},
+		}},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	terminated, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS handshake with the listener failed: %v", err)
+	}
+	defer terminated.Close()
+	roundTrip(t, terminated, "over tls")
+
+	// A client speaking plain text fails the handshake and is closed
+	bad, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	bad.SetDeadline(time.Now().Add(2 * time.Second))
+	bad.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	if _, err := io.ReadAll(bad); err != nil {
+		t.Errorf("plain text client not closed: %v", err)
+	}
+
+	// Back to passthrough on the same port; the open TLS connection lives on
+	listeners := []config.Listener{cfg.Listeners[0]}
+	listeners[0].TLS = config.TLSConfig{}
+	if _, err := engine.Apply(listeners, cfg.Backends); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	plain, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial after switching to passthrough failed: %v", err)
+	}
+	defer plain.Close()
+	roundTrip(t, plain, "passed through")
+	roundTrip(t, terminated, "still over tls")
+
+	// A bad certificate leaves the listener as it is
+	listeners[0].TLS = config.TLSConfig{Cert: config.Secret{Ref: "not a cert"}, Key: config.Secret{Ref: key}}
+	if _, err := engine.Apply(listeners, cfg.Backends); err == nil {
+		t.Error("expected error for an invalid certificate")
+	}
+}
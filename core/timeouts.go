@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"nvelox/core/logging"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const (
+	defaultConnectTimeout = 5 * time.Second
+	defaultUDPIdleTimeout = 60 * time.Second
+)
+
+// connTimeouts are the parsed timeouts of one connection; 0 disables a limit.
+type connTimeouts struct {
+	connect    time.Duration
+	clientIdle time.Duration
+	serverIdle time.Duration
+	sessionMax time.Duration
+}
+
+// timeouts resolves the timeouts of a listener routed to a backend: the
+// listener's values override the backend's. Durations were validated with
+// the configuration.
+func (e *Engine) timeouts(l *ListenerConfig, backend string) connTimeouts {
+	tc := l.Timeouts
+	if be, ok := e.backend(backend); ok {
+		tc = tc.Or(be.Timeouts)
+	}
+	t := connTimeouts{connect: defaultConnectTimeout}
+	if tc.Connect != "" {
+		t.connect, _ = time.ParseDuration(tc.Connect)
+	}
+	t.clientIdle, _ = time.ParseDuration(tc.ClientIdle)
+	t.serverIdle, _ = time.ParseDuration(tc.ServerIdle)
+	t.sessionMax, _ = time.ParseDuration(tc.SessionMax)
+	return t
+}
+
+// expired returns the limit a connection exceeded at now, or how long until
+// the next one can expire.
+func (t connTimeouts) expired(ctx *ConnContext, now time.Time) (string, time.Duration) {
+	type limit struct {
+		name  string
+		d     time.Duration
+		since int64 // UnixNano of the last activity, 0 while not started
+	}
+	limits := []limit{
+		{"session_max", t.sessionMax, ctx.StartTime.UnixNano()},
+		{"client_idle", t.clientIdle, atomic.LoadInt64(&ctx.clientActive)},
+		{"server_idle", t.serverIdle, atomic.LoadInt64(&ctx.serverActive)},
+	}
+
+	wait := time.Duration(0)
+	for _, l := range limits {
+		if l.d <= 0 || l.since == 0 {
+			continue
+		}
+		left := l.d - now.Sub(time.Unix(0, l.since))
+		if left <= 0 {
+			return l.name, 0
+		}
+		if wait == 0 || left < wait {
+			wait = left
+		}
+	}
+	return "", wait
+}
+
+// watchTimeouts closes a TCP connection once it exceeds an idle or session
+// limit. It returns when lifetime ends.
+func (h *ProxyEventHandler) watchTimeouts(lifetime context.Context, c gnet.Conn, ctx *ConnContext, t connTimeouts) {
+	if t.clientIdle <= 0 && t.serverIdle <= 0 && t.sessionMax <= 0 {
+		return
+	}
+	clk := h.clock()
+	_, wait := t.expired(ctx, clk.Now())
+	if wait <= 0 {
+		wait = t.serverIdle
+	}
+	timer := clk.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-lifetime.Done():
+			return
+		case <-timer.C():
+		}
+		limit, next := t.expired(ctx, clk.Now())
+		if limit != "" {
+			logging.Info("[CONN] closing %s on %s: %s exceeded", ctx.Client, ctx.Listener, limit)
+			ctx.mu.Lock()
+			ctx.reason = StatusTimeout
+			ctx.mu.Unlock()
+			h.safeClose(c, ctx)
+			return
+		}
+		if next <= 0 {
+			// server_idle only starts once the backend is connected
+			next = t.serverIdle
+		}
+		timer.Reset(next)
+	}
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+)
+
+func TestEngine_Timeouts(t *testing.T) {
+	e := NewEngine(&config.Config{})
+	e.Backends["be"] = &config.Backend{Name: "be", Timeouts: config.TimeoutsConfig{Connect: "2s", ServerIdle: "1m"}}
+	l := &ListenerConfig{ListenerOptions: ListenerOptions{Timeouts: config.TimeoutsConfig{ServerIdle: "10s", SessionMax: "1h"}}}
+
+	got := e.timeouts(l, "be")
+	want := connTimeouts{connect: 2 * time.Second, serverIdle: 10 * time.Second, sessionMax: time.Hour}
+	if got != want {
+		t.Errorf("timeouts = %+v, want %+v", got, want)
+	}
+	if got := e.timeouts(&ListenerConfig{}, "missing"); got.connect != defaultConnectTimeout {
+		t.Errorf("default connect = %v", got.connect)
+	}
+}
+
+func TestHandler_watchTimeouts_ClientIdle(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1000, 0))
+	h := &ProxyEventHandler{engine: &Engine{Clock: clk}}
+	ctx := &ConnContext{StartTime: clk.Now(), clientActive: clk.Now().UnixNano()}
+	conn := &MockGnetConn{ctx: ctx, remoteAddr: &net.TCPAddr{}}
+
+	lifetime, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		h.watchTimeouts(lifetime, conn, ctx, connTimeouts{clientIdle: 10 * time.Second, sessionMax: time.Hour})
+		close(done)
+	}()
+
+	waitFor(t, func() bool { return clk.Waiters() > 0 })
+	clk.Advance(5 * time.Second)
+	atomic.StoreInt64(&ctx.clientActive, clk.Now().UnixNano()) // activity postpones the deadline
+	clk.Advance(5 * time.Second)
+	waitFor(t, func() bool { return clk.Waiters() > 0 })
+	clk.Advance(10 * time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+	if ctx.reason != StatusTimeout {
+		t.Errorf("reason = %q, want %q", ctx.reason, StatusTimeout)
+	}
+}
+
+func TestConnTimeouts_Expired(t *testing.T) {
+	start := time.Unix(1000, 0)
+	ctx := &ConnContext{StartTime: start, clientActive: start.UnixNano()}
+	tm := connTimeouts{serverIdle: time.Second, sessionMax: time.Minute}
+
+	// server_idle does not run before the backend is connected
+	if limit, wait := tm.expired(ctx, start.Add(30*time.Second)); limit != "" || wait != 30*time.Second {
+		t.Errorf("got %q, %v", limit, wait)
+	}
+	ctx.serverActive = start.Add(30 * time.Second).UnixNano()
+	if limit, _ := tm.expired(ctx, start.Add(32*time.Second)); limit != "server_idle" {
+		t.Errorf("expected server_idle, got %q", limit)
+	}
+	if limit, _ := (connTimeouts{sessionMax: time.Minute}).expired(ctx, start.Add(time.Minute)); limit != "session_max" {
+		t.Errorf("expected session_max, got %q", limit)
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+	"nvelox/core/logging"
+)
+
+// traceLog logs the state transitions of traced connections. Its lines are
+// at info level, so the "trace" component can be silenced on its own.
+var traceLog = logging.Component("TRACE")
+
+// States of a traced connection, in the order they are reached.
+const (
+	traceAccepted  = "accepted"
+	traceInspected = "inspected"
+	traceSelected  = "backend-selected"
+	traceDialed    = "dialed"
+	traceFirstByte = "first-byte"
+	traceClosed    = "closed"
+)
+
+// traceSample returns the fraction of connections a listener traces.
+func traceSample(enabled bool, sample float64) float64 {
+	switch {
+	case !enabled:
+		return 0
+	case sample == 0:
+		return 1
+	}
+	return sample
+}
+
+// connTrace logs the state transitions of one connection, each with its
+// time and the time since accept. Methods on a nil trace do nothing, so
+// untraced connections cost a nil check.
+type connTrace struct {
+	id    string
+	start time.Time
+	clk   clock.Clock
+}
+
+// newTrace starts tracing a connection accepted at start on l, or returns
+// nil when the connection is not sampled.
+func newTrace(l *ListenerConfig, clk clock.Clock, start time.Time) *connTrace {
+	if l.TraceSample <= 0 || (l.TraceSample < 1 && rand.Float64() >= l.TraceSample) {
+		return nil
+	}
+	return &connTrace{id: newSessionID(), start: start, clk: clk}
+}
+
+// event logs that the connection reached state.
+func (t *connTrace) event(state, format string, args ...any) {
+	if t == nil {
+		return
+	}
+	now := t.clk.Now()
+	traceLog.Infof("%s %s %s +%s %s", t.id, now.Format(time.RFC3339Nano), state,
+		logging.FormatDuration(now.Sub(t.start)), fmt.Sprintf(format, args...))
+}
+
+// Trace reports the connection tracing of a listener.
+type Trace struct {
+	Listener string  `json:"listener"`
+	Enabled  bool    `json:"enabled"`
+	Sample   float64 `json:"sample"` // fraction of connections traced
+}
+
+// SetTrace turns connection tracing of a listener on or off for new
+// connections, until the next reload. A sample of 0 keeps the current one.
+func (e *Engine) SetTrace(listener string, enabled bool, sample float64) (*Trace, error) {
+	if sample < 0 || sample > 1 {
+		return nil, fmt.Errorf("sample must be between 0 and 1")
+	}
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cfg := *e.Config
+	cfg.Listeners = append([]config.Listener(nil), e.Config.Listeners...)
+	var l *config.Listener
+	for i := range cfg.Listeners {
+		if cfg.Listeners[i].Name == listener {
+			l = &cfg.Listeners[i]
+		}
+	}
+	if l == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownListener, listener)
+	}
+	if enabled && l.Protocol == "udp" {
+		return nil, fmt.Errorf("listener %s: trace_connections requires tcp", listener)
+	}
+	l.TraceConnections = enabled
+	if sample > 0 {
+		l.TraceSample = sample
+	}
+
+	effective := traceSample(l.TraceConnections, l.TraceSample)
+	updateListeners(e, map[string]float64{listener: effective}, func(lc *ListenerConfig, s float64) {
+		lc.TraceSample = s
+	})
+	e.Config = &cfg
+	logging.Info("[TRACE] listener %s: tracing %v (sample %g)", listener, enabled, effective)
+	return &Trace{Listener: listener, Enabled: enabled, Sample: traceSample(true, l.TraceSample)}, nil
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nvelox/core/clock"
+)
+
+func TestNewTrace(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	for _, c := range []struct {
+		sample float64
+		want   int
+	}{
+		{0, 0},
+		{1, 1000},
+	} {
+		l := &ListenerConfig{ListenerOptions: ListenerOptions{TraceSample: c.sample}}
+		n := 0
+		for range 1000 {
+			if newTrace(l, clk, clk.Now()) != nil {
+				n++
+			}
+		}
+		if n != c.want {
+			t.Errorf("sample %g: traced %d of 1000, want %d", c.sample, n, c.want)
+		}
+	}
+
+	l := &ListenerConfig{ListenerOptions: ListenerOptions{TraceSample: 0.5}}
+	n := 0
+	for range 1000 {
+		if newTrace(l, clk, clk.Now()) != nil {
+			n++
+		}
+	}
+	if n < 350 || n > 650 {
+		t.Errorf("sample 0.5: traced %d of 1000", n)
+	}
+
+	var untraced *connTrace
+	untraced.event(traceAccepted, "client=%s", "1.2.3.4:5") // must not panic
+}
+
+func TestEngine_SetTrace(t *testing.T) {
+	e := newSwapEngine()
+	old := e.Listeners[0]
+
+	tr, err := e.SetTrace("prod", true, 0)
+	if err != nil {
+		t.Fatalf("SetTrace failed: %v", err)
+	}
+	if !tr.Enabled || tr.Sample != 1 || e.Listeners[0].TraceSample != 1 {
+		t.Errorf("unexpected trace %+v, listener sample %g", tr, e.Listeners[0].TraceSample)
+	}
+	if old.TraceSample != 0 || e.Listeners[1].TraceSample != 0 {
+		t.Error("expected only the listener config of prod to be replaced")
+	}
+
+	// The sample is kept when tracing is turned off and on again
+	e.SetTrace("prod", true, 0.1)
+	if tr, _ := e.SetTrace("prod", false, 0); tr.Sample != 0.1 || e.Listeners[0].TraceSample != 0 {
+		t.Errorf("unexpected trace after turning it off: %+v", tr)
+	}
+	if _, err := e.SetTrace("prod", true, 0); err != nil || e.Listeners[0].TraceSample != 0.1 {
+		t.Errorf("sample not kept: %g, %v", e.Listeners[0].TraceSample, err)
+	}
+
+	if _, err := e.SetTrace("missing", true, 0); !errors.Is(err, ErrUnknownListener) {
+		t.Errorf("expected ErrUnknownListener, got %v", err)
+	}
+}
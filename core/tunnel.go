@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"net"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+	"nvelox/core/resolver"
+	"nvelox/core/tunnel"
+)
+
+// dialUDP opens the upstream socket of a UDP session with a server of
+// backend, through the backend's tunnel when it has one.
+func (e *Engine) dialUDP(backend string, be *config.Backend, target string) (net.Conn, error) {
+	opts := e.dialOptions(backend)
+	if be == nil || !be.Tunnel.Enabled() {
+		return e.Hosts.DialUDP(target, opts)
+	}
+	conn, err := e.Hosts.DialUDP(be.Tunnel.Peer, opts)
+	if err != nil {
+		return nil, err
+	}
+	session, err := tunnel.Dial(conn, []byte(be.Tunnel.Secret.Value()), target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// serveTunnel forwards the datagrams tunneled to tunnel.bind by other
+// instances until ctx is done. Like a listener, the socket shares its port
+// with the process replacing this one on a binary upgrade.
+func (e *Engine) serveTunnel(ctx context.Context) error {
+	cfg := e.Config.Tunnel
+	if cfg.Bind == "" {
+		return nil
+	}
+	srv, err := tunnel.NewServer([]byte(cfg.Secret.Value()), func(dest string) (net.Conn, error) {
+		return e.Hosts.DialUDP(dest, resolver.DialOptions{})
+	})
+	if err != nil {
+		return err
+	}
+	srv.Idle = defaultUDPIdleTimeout
+	srv.MaxSessions = cfg.MaxSessions
+	lc := net.ListenConfig{Control: reusePort}
+	pc, err := lc.ListenPacket(ctx, "udp", cfg.Bind)
+	if err != nil {
+		return err
+	}
+	logging.Info("[TUNNEL] receiving tunneled datagrams on udp://%s", pc.LocalAddr())
+	go func() {
+		<-ctx.Done()
+		pc.Close()
+	}()
+	go func() {
+		if err := srv.Serve(pc); err != nil {
+			logging.Error("[TUNNEL] stopped: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,604 @@
+// Package tunnel carries UDP datagrams to servers behind a remote nvelox
+// peer. Each datagram travels in one UDP packet to the peer,
+//
+//	version (1) | session (8) | counter (8) | sealed
+//
+// where sealed is the AES-256-GCM encryption, authenticating the header, of
+//
+//	time (8) | destination length (1) | destination | payload
+//
+// The peer forwards the payload to the destination, a "host:port" address,
+// from a socket of its own per session and returns the replies the same way
+// with an empty destination.
+//
+// Each session and direction has a key and a nonce prefix of its own,
+// derived with HKDF-SHA256 from the shared secret and the random session id,
+// so no two sessions share a (key, nonce) pair. The counter numbers the
+// packets of a session in each direction and completes the nonce. Receivers
+// drop a packet whose counter they have seen, or which falls behind the last
+// 64 seen, so a captured packet cannot be replayed. A packet opening a session must have been sent, by its
+// Unix time in seconds, within MaxAge, and the peer remembers the sessions of
+// that long ago: a session cannot be replayed once it has closed either.
+package tunnel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nvelox/core/logging"
+)
+
+// Version opens every packet.
+const Version = 3
+
+const (
+	headerSize  = 1 + 8 + 8
+	timeSize    = 8
+	maxPacket   = 65535
+	windowSize  = 64
+	defaultIdle = time.Minute
+	// DefaultMaxAge is how old a packet opening a session may be.
+	DefaultMaxAge = 30 * time.Second
+	// DefaultMaxSessions is how many sessions a peer keeps open at most.
+	DefaultMaxSessions = 4096
+	// keyRate is how many keys of unknown sessions a peer derives per
+	// second at most, so unauthenticated packets cannot keep it busy.
+	keyRate = 1024
+)
+
+// Directions of a packet, which keep the keys of both ends apart.
+const (
+	toPeer   uint32 = 0
+	fromPeer uint32 = 1
+)
+
+var (
+	// ErrInvalid means a packet is not a tunnel packet or fails to
+	// authenticate with the secret.
+	ErrInvalid = errors.New("invalid tunnel packet")
+	// ErrTooLarge means a datagram does not fit in a tunnel packet.
+	ErrTooLarge = errors.New("datagram too large for the tunnel")
+	// ErrExhausted means a session has sent all the packets its counter
+	// can number.
+	ErrExhausted = errors.New("tunnel session exhausted")
+
+	errClosed  = errors.New("packet of a closed session")
+	errKeyRate = errors.New("too many new sessions per second")
+)
+
+// message is the content of a packet.
+type message struct {
+	session uint64
+	counter uint64
+	sent    time.Time
+	dest    string
+	payload []byte
+}
+
+// codec derives the keys of the sessions from the shared secret.
+type codec struct {
+	prk []byte // HKDF pseudorandom key of the secret
+}
+
+func newCodec(secret []byte) (*codec, error) {
+	prk, err := hkdf.Extract(sha256.New, secret, []byte("nvelox tunnel"))
+	if err != nil {
+		return nil, err
+	}
+	return &codec{prk: prk}, nil
+}
+
+// sealer seals and opens the packets of one session in one direction.
+type sealer struct {
+	aead   cipher.AEAD
+	prefix [4]byte // leads every nonce, the counter follows
+}
+
+// sealer derives the key and nonce prefix of session in direction dir.
+func (c *codec) sealer(session uint64, dir uint32) (*sealer, error) {
+	var info [12]byte
+	binary.BigEndian.PutUint64(info[:8], session)
+	binary.BigEndian.PutUint32(info[8:], dir)
+	okm, err := hkdf.Expand(sha256.New, c.prk, "nvelox tunnel v3 "+string(info[:]), 32+4)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(okm[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &sealer{aead: aead}
+	copy(k.prefix[:], okm[32:])
+	return k, nil
+}
+
+// seal seals m in direction dir, deriving the session key.
+func (c *codec) seal(dir uint32, m message) ([]byte, error) {
+	k, err := c.sealer(m.session, dir)
+	if err != nil {
+		return nil, err
+	}
+	return k.seal(m)
+}
+
+// open opens packet in direction dir, deriving the key of the session it
+// names.
+func (c *codec) open(dir uint32, packet []byte) (message, error) {
+	id, ok := sessionOf(packet)
+	if !ok {
+		return message{}, ErrInvalid
+	}
+	k, err := c.sealer(id, dir)
+	if err != nil {
+		return message{}, err
+	}
+	return k.open(packet)
+}
+
+// sessionOf returns the session id in the header of packet.
+func sessionOf(packet []byte) (uint64, bool) {
+	if len(packet) < headerSize || packet[0] != Version {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(packet[1:9]), true
+}
+
+func (k *sealer) nonce(counter uint64) []byte {
+	var n [12]byte
+	copy(n[:4], k.prefix[:])
+	binary.BigEndian.PutUint64(n[4:], counter)
+	return n[:]
+}
+
+func (k *sealer) seal(m message) ([]byte, error) {
+	if len(m.dest) > 255 || headerSize+timeSize+1+len(m.dest)+len(m.payload)+k.aead.Overhead() > maxPacket {
+		return nil, ErrTooLarge
+	}
+	plain := make([]byte, timeSize, timeSize+1+len(m.dest)+len(m.payload))
+	binary.BigEndian.PutUint64(plain, uint64(m.sent.Unix()))
+	plain = append(plain, byte(len(m.dest)))
+	plain = append(plain, m.dest...)
+	plain = append(plain, m.payload...)
+
+	packet := make([]byte, headerSize, headerSize+len(plain)+k.aead.Overhead())
+	packet[0] = Version
+	binary.BigEndian.PutUint64(packet[1:9], m.session)
+	binary.BigEndian.PutUint64(packet[9:headerSize], m.counter)
+	return k.aead.Seal(packet, k.nonce(m.counter), plain, packet), nil
+}
+
+func (k *sealer) open(packet []byte) (message, error) {
+	if len(packet) < headerSize+k.aead.Overhead()+timeSize+1 || packet[0] != Version {
+		return message{}, ErrInvalid
+	}
+	header := packet[:headerSize]
+	counter := binary.BigEndian.Uint64(header[9:])
+	plain, err := k.aead.Open(nil, k.nonce(counter), packet[headerSize:], header)
+	if err != nil || len(plain) < timeSize+1+int(plain[timeSize]) {
+		return message{}, ErrInvalid
+	}
+	n := timeSize + 1 + int(plain[timeSize])
+	return message{
+		session: binary.BigEndian.Uint64(header[1:9]),
+		counter: counter,
+		sent:    time.Unix(int64(binary.BigEndian.Uint64(plain)), 0),
+		dest:    string(plain[timeSize+1 : n]),
+		payload: plain[n:],
+	}, nil
+}
+
+// window is the sliding window of the counters a receiver has seen.
+type window struct {
+	top  uint64 // highest counter seen plus one, 0 before the first
+	bits uint64 // bit i set: counter top-1-i seen
+}
+
+// accept reports whether counter is new, recording it.
+func (w *window) accept(counter uint64) bool {
+	n := counter + 1
+	if n == 0 {
+		return false
+	}
+	if n > w.top {
+		if shift := n - w.top; shift >= windowSize {
+			w.bits = 0
+		} else {
+			w.bits <<= shift
+		}
+		w.bits |= 1
+		w.top = n
+		return true
+	}
+	d := w.top - n
+	if d >= windowSize || w.bits&(1<<d) != 0 {
+		return false
+	}
+	w.bits |= 1 << d
+	return true
+}
+
+// counter hands out the counters of the packets a session sends.
+type counter struct {
+	next atomic.Uint64
+}
+
+func (c *counter) take() (uint64, error) {
+	n := c.next.Add(1) - 1
+	if n == math.MaxUint64 {
+		return 0, ErrExhausted
+	}
+	return n, nil
+}
+
+// Conn is a session with one destination behind a peer. Writes send
+// datagrams to the destination, reads return its replies.
+type Conn struct {
+	net.Conn // the socket to the peer
+	send     *sealer
+	recv     *sealer
+	session  uint64
+	dest     string
+	sent     counter
+	replies  window
+	buf      []byte
+}
+
+// Dial opens a session with dest through the peer behind conn, a connected
+// UDP socket. Closing the session closes conn.
+func Dial(conn net.Conn, secret []byte, dest string) (*Conn, error) {
+	c, err := newCodec(secret)
+	if err != nil {
+		return nil, err
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	session := binary.BigEndian.Uint64(id[:])
+	send, err := c.sealer(session, toPeer)
+	if err != nil {
+		return nil, err
+	}
+	recv, err := c.sealer(session, fromPeer)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		Conn:    conn,
+		send:    send,
+		recv:    recv,
+		session: session,
+		dest:    dest,
+		buf:     make([]byte, maxPacket),
+	}, nil
+}
+
+// Write sends b to the destination as one datagram.
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.sent.take()
+	if err != nil {
+		return 0, err
+	}
+	packet, err := c.send.seal(message{session: c.session, counter: n, sent: time.Now(), dest: c.dest, payload: b})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.Conn.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read returns the next reply of the destination. Packets of other
+// sessions, replayed packets and packets failing to authenticate are
+// dropped. Reads must not run concurrently.
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(c.buf)
+		if err != nil {
+			return 0, err
+		}
+		m, err := c.recv.open(c.buf[:n])
+		if err != nil || m.session != c.session || !c.replies.accept(m.counter) {
+			continue
+		}
+		return copy(b, m.payload), nil
+	}
+}
+
+// Server is the peer end: it forwards the datagrams of tunnel sessions to
+// their destinations and tunnels the replies back.
+type Server struct {
+	// Dial opens the socket of a new session to its destination.
+	Dial func(dest string) (net.Conn, error)
+	// Idle closes a session once its destination has been silent this long,
+	// a minute when unset.
+	Idle time.Duration
+	// MaxAge is how long ago a packet opening a session may have been sent,
+	// DefaultMaxAge when unset. The clocks of both ends must agree to
+	// within it.
+	MaxAge time.Duration
+	// MaxSessions bounds the open sessions, and the closed ones remembered
+	// for MaxAge; DefaultMaxSessions when unset. New sessions beyond it are
+	// refused.
+	MaxSessions int
+
+	codec *codec
+
+	mu        sync.Mutex
+	sessions  map[uint64]*session
+	closed    map[uint64]time.Time // closed sessions, until replays of them are too old
+	stopped   bool                 // Serve returned, sessions still dialing close
+	keys      int                  // keys of unknown sessions derived since keysSince
+	keysSince time.Time
+}
+
+// session is a tunnel session at the peer end. Sessions are known by their
+// id alone: the peer address is where the latest packet came from, so a
+// session follows its client across address changes, as WireGuard does.
+type session struct {
+	dest string
+	recv *sealer
+	send *sealer
+	sent counter
+
+	// upstream is set, under Server.mu, before ready is closed; it stays nil
+	// when the dial failed
+	upstream net.Conn
+	ready    chan struct{}
+
+	// guarded by Server.mu
+	peer    net.Addr
+	seen    window
+	expires time.Time // when its packets are too old to open a session
+}
+
+// write forwards p to the destination; packets arriving while the session
+// is still dialing are dropped, as the network could have.
+func (sess *session) write(p []byte) {
+	select {
+	case <-sess.ready:
+		if sess.upstream != nil {
+			sess.upstream.Write(p)
+		}
+	default:
+	}
+}
+
+// NewServer returns a server for the tunnels keyed with secret, dialing
+// destinations with dial.
+func NewServer(secret []byte, dial func(dest string) (net.Conn, error)) (*Server, error) {
+	c, err := newCodec(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		Dial:     dial,
+		codec:    c,
+		sessions: make(map[uint64]*session),
+		closed:   make(map[uint64]time.Time),
+	}, nil
+}
+
+func (s *Server) maxAge() time.Duration {
+	if s.MaxAge > 0 {
+		return s.MaxAge
+	}
+	return DefaultMaxAge
+}
+
+func (s *Server) maxSessions() int {
+	if s.MaxSessions > 0 {
+		return s.MaxSessions
+	}
+	return DefaultMaxSessions
+}
+
+// Serve handles the packets arriving on pc until it is closed, then closes
+// the open sessions.
+func (s *Server) Serve(pc net.PacketConn) error {
+	defer s.closeSessions()
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if _, ok := from.(*net.UDPAddr); !ok {
+			continue
+		}
+		recv, err := s.sealer(buf[:n])
+		if err != nil {
+			logging.Debug("[TUNNEL] dropping packet from %s: %v", from, err)
+			continue
+		}
+		m, err := recv.open(buf[:n])
+		if err != nil || m.dest == "" {
+			logging.Debug("[TUNNEL] dropping packet from %s: %v", from, ErrInvalid)
+			continue
+		}
+		sess, opened, err := s.session(pc, from, m, recv)
+		if err != nil {
+			logging.Warn("[TUNNEL] refusing session from %s to %s: %v", from, m.dest, err)
+			continue
+		}
+		if sess == nil {
+			logging.Debug("[TUNNEL] dropping replayed packet from %s", from)
+			continue
+		}
+		if !opened {
+			sess.write(m.payload)
+		}
+	}
+}
+
+// sealer returns the sealer opening packet: that of its open session, or
+// one derived for the session it names. Packets of closed sessions are
+// dropped before any key is derived, and at most keyRate keys of unknown
+// sessions are derived per second.
+func (s *Server) sealer(packet []byte) (*sealer, error) {
+	id, ok := sessionOf(packet)
+	if !ok {
+		return nil, ErrInvalid
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if sess := s.sessions[id]; sess != nil {
+		s.mu.Unlock()
+		return sess.recv, nil
+	}
+	if _, ok := s.closed[id]; ok {
+		s.mu.Unlock()
+		return nil, errClosed
+	}
+	if now.Sub(s.keysSince) >= time.Second {
+		s.keys, s.keysSince = 0, now
+	}
+	if s.keys >= keyRate {
+		s.mu.Unlock()
+		return nil, errKeyRate
+	}
+	s.keys++
+	s.mu.Unlock()
+	return s.codec.sealer(id, toPeer)
+}
+
+// session returns the session of m, opened with recv, or nil when m is a
+// replay. On the first packet of a session it reserves the id and dials the
+// destination in the background, which forwards the packet once connected;
+// opened reports that case.
+func (s *Server) session(pc net.PacketConn, from net.Addr, m message, recv *sealer) (sess *session, opened bool, err error) {
+	now := time.Now()
+	maxAge := s.maxAge()
+	expires := now
+	if m.sent.After(now) {
+		expires = m.sent
+	}
+	expires = expires.Add(maxAge)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[m.session]; ok {
+		if sess.dest != m.dest || !sess.seen.accept(m.counter) {
+			return nil, false, nil
+		}
+		sess.peer = from
+		sess.expires = expires
+		return sess, false, nil
+	}
+	if _, ok := s.closed[m.session]; ok {
+		return nil, false, nil
+	}
+	if age := now.Sub(m.sent); age > maxAge || age < -maxAge {
+		return nil, false, nil
+	}
+	for id, until := range s.closed {
+		if now.After(until) {
+			delete(s.closed, id)
+		}
+	}
+	if len(s.sessions)+len(s.closed) >= s.maxSessions() {
+		return nil, false, errors.New("too many sessions")
+	}
+	send, err := s.codec.sealer(m.session, fromPeer)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sess = &session{dest: m.dest, recv: recv, send: send, ready: make(chan struct{}), peer: from, expires: expires}
+	sess.seen.accept(m.counter)
+	s.sessions[m.session] = sess
+	go s.open(pc, m.session, sess, append([]byte(nil), m.payload...))
+	return sess, true, nil
+}
+
+// open dials the destination of a reserved session, forwards its first
+// datagram and relays the replies. A session whose dial fails is closed.
+func (s *Server) open(pc net.PacketConn, id uint64, sess *session, first []byte) {
+	upstream, err := s.Dial(sess.dest)
+	s.mu.Lock()
+	if err == nil && s.stopped {
+		upstream.Close()
+		err = net.ErrClosed
+	}
+	if err != nil {
+		delete(s.sessions, id)
+		s.closed[id] = sess.expires
+		peer := sess.peer
+		s.mu.Unlock()
+		close(sess.ready)
+		logging.Warn("[TUNNEL] refusing session from %s to %s: %v", peer, sess.dest, err)
+		return
+	}
+	sess.upstream = upstream
+	s.mu.Unlock()
+	close(sess.ready)
+
+	upstream.Write(first)
+	s.relay(pc, id, sess)
+}
+
+// relay tunnels the replies of a session's destination back to its peer.
+func (s *Server) relay(pc net.PacketConn, id uint64, sess *session) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.closed[id] = sess.expires
+		s.mu.Unlock()
+		sess.upstream.Close()
+	}()
+	idle := s.Idle
+	if idle <= 0 {
+		idle = defaultIdle
+	}
+	buf := make([]byte, maxPacket)
+	for {
+		sess.upstream.SetReadDeadline(time.Now().Add(idle))
+		n, err := sess.upstream.Read(buf)
+		if err != nil {
+			return
+		}
+		counter, err := sess.sent.take()
+		if err != nil {
+			return
+		}
+		packet, err := sess.send.seal(message{session: id, counter: counter, sent: time.Now(), payload: buf[:n]})
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		peer := sess.peer
+		s.mu.Unlock()
+		if _, err := pc.WriteTo(packet, peer); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) closeSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for _, sess := range s.sessions {
+		if sess.upstream != nil {
+			sess.upstream.Close()
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	c, _ := newCodec([]byte("secret"))
+	sent := time.Unix(1700000000, 0)
+	packet, err := c.seal(toPeer, message{session: 42, counter: 7, sent: sent, dest: "10.0.0.1:53", payload: []byte("query")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := c.open(toPeer, packet)
+	if err != nil || m.session != 42 || m.counter != 7 || !m.sent.Equal(sent) || m.dest != "10.0.0.1:53" || string(m.payload) != "query" {
+		t.Fatalf("open = %+v %v", m, err)
+	}
+
+	other, _ := newCodec([]byte("other"))
+	if _, err := other.open(toPeer, packet); !errors.Is(err, ErrInvalid) {
+		t.Errorf("other secret: err = %v", err)
+	}
+	if _, err := c.open(fromPeer, packet); !errors.Is(err, ErrInvalid) {
+		t.Errorf("other direction: err = %v", err)
+	}
+	packet[1]++ // the session is authenticated
+	if _, err := c.open(toPeer, packet); !errors.Is(err, ErrInvalid) {
+		t.Errorf("altered session: err = %v", err)
+	}
+	packet[1]--
+	packet[9]++ // and so is the counter
+	if _, err := c.open(toPeer, packet); !errors.Is(err, ErrInvalid) {
+		t.Errorf("altered counter: err = %v", err)
+	}
+	if _, err := c.seal(toPeer, message{dest: strings.Repeat("x", 256)}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("long destination: err = %v", err)
+	}
+}
+
+func TestDial_SessionKeys(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// Two sessions under one secret send the same datagram as their first
+	var conns [2]*Conn
+	var sealed [2][]byte
+	buf := make([]byte, 1500)
+	for i := range conns {
+		udp, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := Dial(udp, secret, "10.0.0.1:53")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+		if _, err := conn.Write([]byte("query")); err != nil {
+			t.Fatal(err)
+		}
+		pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := binary.BigEndian.Uint64(buf[9:headerSize]); got != 0 {
+			t.Fatalf("first packet has counter %d", got)
+		}
+		sealed[i] = append([]byte(nil), buf[headerSize:n]...)
+	}
+	if bytes.Equal(sealed[0], sealed[1]) {
+		t.Error("first packets of two sessions have the same ciphertext")
+	}
+	for _, dir := range []struct {
+		name string
+		a, b *sealer
+	}{
+		{"sent", conns[0].send, conns[1].send},
+		{"received", conns[0].recv, conns[1].recv},
+	} {
+		if bytes.Equal(dir.a.nonce(0), dir.b.nonce(0)) {
+			t.Errorf("first %s nonces of two sessions are equal", dir.name)
+		}
+	}
+	if bytes.Equal(conns[0].send.nonce(0), conns[0].recv.nonce(0)) {
+		t.Error("first nonces of both directions are equal")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var w window
+	for _, tc := range []struct {
+		counter uint64
+		want    bool
+	}{
+		{0, true}, {0, false}, {2, true}, {1, true}, {1, false},
+		{100, true}, {37, true}, {36, false}, {99, true}, {99, false}, {2, false},
+		{math.MaxUint64, false},
+	} {
+		if got := w.accept(tc.counter); got != tc.want {
+			t.Errorf("accept(%d) = %v, want %v", tc.counter, got, tc.want)
+		}
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+
+	// The destination echoes in upper case
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo([]byte(strings.ToUpper(string(buf[:n]))), from)
+		}
+	}()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	srv, err := NewServer(secret, func(dest string) (net.Conn, error) { return net.Dial("udp", dest) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(pc)
+
+	dial := func(secret []byte) *Conn {
+		udp, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := Dial(udp, secret, echo.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	conn := dial(secret)
+	buf := make([]byte, 100)
+	for _, msg := range []string{"hello", "again"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil || string(buf[:n]) != strings.ToUpper(msg) {
+			t.Fatalf("reply = %q, %v", buf[:n], err)
+		}
+	}
+
+	// A session with the wrong secret goes nowhere
+	bad := dial([]byte("wrong secret...."))
+	bad.Write([]byte("hello"))
+	bad.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := bad.Read(buf); err == nil {
+		t.Error("reply to a session with the wrong secret")
+	}
+}
+
+func TestServer_Replay(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	dest := upstream.LocalAddr().String()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	var dials atomic.Int32
+	srv, _ := NewServer(secret, func(dest string) (net.Conn, error) {
+		dials.Add(1)
+		return net.Dial("udp", dest)
+	})
+	srv.Idle = 100 * time.Millisecond
+	srv.MaxSessions = 2
+	go srv.Serve(pc)
+
+	c, _ := newCodec(secret)
+	send := func(m message) {
+		t.Helper()
+		conn, err := net.Dial("udp", pc.LocalAddr().String()) // a new source address each time
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		packet, err := c.seal(toPeer, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(packet)
+	}
+	received := func() string {
+		t.Helper()
+		buf := make([]byte, 100)
+		upstream.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := upstream.ReadFrom(buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+
+	first := message{session: 1, counter: 0, sent: time.Now(), dest: dest, payload: []byte("first")}
+	send(first)
+	if got := received(); got != "first" {
+		t.Fatalf("first packet: got %q", got)
+	}
+	// Replayed from elsewhere, while the session is open and after it closed
+	send(first)
+	if got := received(); got != "" {
+		t.Errorf("replay forwarded: %q", got)
+	}
+	time.Sleep(300 * time.Millisecond)
+	send(first)
+	if got := received(); got != "" {
+		t.Errorf("replay of a closed session forwarded: %q", got)
+	}
+
+	// A session may only be opened by a recent packet
+	send(message{session: 2, sent: time.Now().Add(-time.Hour), dest: dest, payload: []byte("old")})
+	if got := received(); got != "" {
+		t.Errorf("stale packet forwarded: %q", got)
+	}
+
+	// Session 1 is still remembered, which leaves room for one more
+	send(message{session: 3, sent: time.Now(), dest: dest, payload: []byte("third")})
+	if got := received(); got != "third" {
+		t.Errorf("third session: got %q", got)
+	}
+	send(message{session: 4, sent: time.Now(), dest: dest, payload: []byte("fourth")})
+	if got := received(); got != "" {
+		t.Errorf("session beyond max_sessions forwarded: %q", got)
+	}
+	if n := dials.Load(); n != 2 {
+		t.Errorf("dialed %d sessions, want 2", n)
+	}
+}
+
+func TestServer_SlowDial(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	dest := upstream.LocalAddr().String()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	release := make(chan struct{})
+	defer close(release)
+	srv, _ := NewServer(secret, func(d string) (net.Conn, error) {
+		if d == "slow.invalid:53" {
+			<-release
+			return nil, errors.New("no such host")
+		}
+		return net.Dial("udp", d)
+	})
+	go srv.Serve(pc)
+
+	c, _ := newCodec(secret)
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(m message) {
+		t.Helper()
+		packet, err := c.seal(toPeer, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(packet)
+	}
+
+	// A session whose destination takes forever to dial does not hold up
+	// the others
+	send(message{session: 1, sent: time.Now(), dest: "slow.invalid:53", payload: []byte("stuck")})
+	send(message{session: 2, sent: time.Now(), dest: dest, payload: []byte("first")})
+	buf := make([]byte, 100)
+	upstream.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := upstream.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "first" {
+		t.Fatalf("other session while dialing: got %q, %v", buf[:n], err)
+	}
+}
+
+func TestServer_KeyRate(t *testing.T) {
+	srv, _ := NewServer([]byte("0123456789abcdef"), nil)
+	packet := make([]byte, headerSize)
+	packet[0] = Version
+	for i := 0; i < keyRate; i++ {
+		binary.BigEndian.PutUint64(packet[1:9], uint64(i))
+		if _, err := srv.sealer(packet); err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+	}
+	binary.BigEndian.PutUint64(packet[1:9], keyRate)
+	if _, err := srv.sealer(packet); !errors.Is(err, errKeyRate) {
+		t.Errorf("key beyond the rate: err = %v", err)
+	}
+
+	// Closed sessions are dropped without deriving a key
+	srv.closed[7] = time.Now().Add(time.Minute)
+	binary.BigEndian.PutUint64(packet[1:9], 7)
+	if _, err := srv.sealer(packet); !errors.Is(err, errClosed) {
+		t.Errorf("closed session: err = %v", err)
+	}
+}
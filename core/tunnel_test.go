@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestEngine_Tunnel(t *testing.T) {
+	secret := config.Secret{Ref: "0123456789abcdef"}
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], from)
+		}
+	}()
+
+	// The peer instance, on a port found free
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := probe.LocalAddr().String()
+	probe.Close()
+	peer := NewEngine(&config.Config{Tunnel: config.TunnelConfig{Bind: bind, Secret: secret}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := peer.serveTunnel(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// This instance, tunneling its backend through the peer
+	e := NewEngine(&config.Config{})
+	be := &config.Backend{Name: "dns", Tunnel: config.BackendTunnel{Peer: bind, Secret: secret}}
+	conn, err := e.dialUDP("dns", be, echo.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 100)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("reply = %q, %v", buf[:n], err)
+	}
+}
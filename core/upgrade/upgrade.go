@@ -0,0 +1,160 @@
+// Package upgrade replaces the running binary without closing its ports: the
+// process starts its successor with the listening sockets as inherited file
+// descriptors and steps back once the successor reports that it serves them.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Env lists the names of the inherited files, comma-separated in the order
+// of their descriptors from 3 on.
+const Env = "NVELOX_INHERIT"
+
+// Names of the inherited files besides the listening sockets, which are
+// named by their "tcp://host:port" address.
+const (
+	// ReadyFile is the pipe through which the successor reports that it took over.
+	ReadyFile = "ready"
+	// PidFile is the locked pid file, see pidfile.Inherit.
+	PidFile = "pidfile"
+)
+
+var errExited = errors.New("exited")
+
+// Child is a successor process started by Start.
+type Child struct {
+	cmd    *exec.Cmd
+	ready  *os.File
+	exited chan error
+}
+
+// Start runs the executable of this process with args and the files under
+// their names. The files stay open in this process; the caller closes them.
+func Start(args []string, files map[string]*os.File) (*Child, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	names := []string{ReadyFile}
+	extra := []*os.File{w}
+	keys := make([]string, 0, len(files))
+	for name := range files {
+		keys = append(keys, name)
+	}
+	slices.Sort(keys)
+	for _, name := range keys {
+		names = append(names, name)
+		extra = append(extra, files[name])
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = extra
+	cmd.Env = append(os.Environ(), Env+"="+strings.Join(names, ","))
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	c := &Child{cmd: cmd, ready: r, exited: make(chan error, 1)}
+	go func() { c.exited <- cmd.Wait() }()
+	return c, nil
+}
+
+// Pid returns the process id of the successor.
+func (c *Child) Pid() int {
+	return c.cmd.Process.Pid
+}
+
+// Wait blocks until the successor reported that it took over. When it exits
+// first or does not report within timeout, it is killed and an error returned.
+func (c *Child) Wait(timeout time.Duration) error {
+	defer c.ready.Close()
+	reported := make(chan error, 1)
+	go func() {
+		_, err := c.ready.Read(make([]byte, 1))
+		reported <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-reported:
+		if err == nil {
+			return nil
+		}
+		// The pipe closes without a report when the successor exits
+	case <-timer.C:
+		c.cmd.Process.Kill()
+		return fmt.Errorf("new process %d not ready after %v", c.Pid(), timeout)
+	}
+	select {
+	case err := <-c.exited:
+		if err == nil {
+			err = errExited
+		}
+		return fmt.Errorf("new process %d: %w before taking over", c.Pid(), err)
+	case <-timer.C:
+		c.cmd.Process.Kill()
+		return fmt.Errorf("new process %d closed %s without taking over", c.Pid(), ReadyFile)
+	}
+}
+
+// Inherited returns the files passed by the process this one replaces, by
+// name, and clears Env so they are not passed on again. It returns nil when
+// the process was started normally.
+func Inherited() (map[string]*os.File, error) {
+	list, ok := os.LookupEnv(Env)
+	if !ok {
+		return nil, nil
+	}
+	os.Unsetenv(Env)
+	files := make(map[string]*os.File)
+	for i, name := range strings.Split(list, ",") {
+		f := os.NewFile(uintptr(3+i), name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: no file descriptor %d for %s", Env, 3+i, name)
+		}
+		files[name] = f
+	}
+	if files[ReadyFile] == nil {
+		return nil, fmt.Errorf("%s: no %s file", Env, ReadyFile)
+	}
+	return files, nil
+}
+
+// Ready reports to the process this one replaces that it took over.
+func Ready(files map[string]*os.File) error {
+	f := files[ReadyFile]
+	delete(files, ReadyFile)
+	_, err := f.Write([]byte{1})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Sockets moves the listening sockets out of the inherited files.
+func Sockets(files map[string]*os.File) map[string]*os.File {
+	sockets := make(map[string]*os.File)
+	for name, f := range files {
+		if strings.HasPrefix(name, "tcp://") {
+			sockets[name] = f
+			delete(files, name)
+		}
+	}
+	return sockets
+}
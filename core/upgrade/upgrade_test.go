@@ -0,0 +1,61 @@
+package upgrade
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChild is the successor started by TestStart.
+func TestChild(t *testing.T) {
+	if os.Getenv(Env) == "" {
+		t.Skip("run by TestStart")
+	}
+	files, err := Inherited()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(Env) != "" {
+		t.Errorf("%s still set", Env)
+	}
+	b, err := io.ReadAll(files["payload"])
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("payload: %q, %v", b, err)
+	}
+	if os.Getenv("UPGRADE_TEST_EXIT") != "" {
+		os.Exit(3)
+	}
+	if err := Ready(files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload")
+	os.WriteFile(path, []byte("hello"), 0o644)
+	start := func() *Child {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		c, err := Start([]string{"-test.run=^TestChild$"}, map[string]*os.File{"payload": f})
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		return c
+	}
+
+	if err := start().Wait(10 * time.Second); err != nil {
+		t.Errorf("Wait failed: %v", err)
+	}
+
+	t.Setenv("UPGRADE_TEST_EXIT", "1")
+	err := start().Wait(10 * time.Second)
+	if err == nil || !strings.Contains(err.Error(), "before taking over") {
+		t.Errorf("expected the exit to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+const (
+	// loopTick is how often the ticker of a listener group probes its event
+	// loops.
+	loopTick = time.Second
+	// loopStall is how long an event loop may leave a probe unanswered
+	// before Heartbeat reports it hung.
+	loopStall = 10 * time.Second
+)
+
+// loopProbe tracks the probes sent to one event loop, in unix nanoseconds.
+// A probe is outstanding while sent is after answered.
+type loopProbe struct {
+	sent     atomic.Int64
+	answered atomic.Int64
+}
+
+// watchLoop has the ticker probe the event loop of c from now on. A loop is
+// known once it serves its first connection; until then it runs nothing of
+// ours that could hang.
+func (h *ProxyEventHandler) watchLoop(c gnet.Conn) {
+	if h.unprobed {
+		return
+	}
+	loop := c.EventLoop()
+	if _, ok := h.loops.Load(loop); !ok {
+		h.loops.LoadOrStore(loop, &loopProbe{})
+	}
+}
+
+// probeLoops runs on every tick: each known event loop without an
+// outstanding probe gets one, which it answers once it gets around to it.
+// Loops whose engine stopped are forgotten.
+func (h *ProxyEventHandler) probeLoops() {
+	clk := h.clock()
+	now := clk.Now().UnixNano()
+	h.loops.Range(func(k, v any) bool {
+		loop, p := k.(gnet.EventLoop), v.(*loopProbe)
+		if p.sent.Load() > p.answered.Load() {
+			return true
+		}
+		p.sent.Store(now)
+		err := loop.Execute(context.Background(), gnet.RunnableFunc(func(context.Context) error {
+			p.answered.Store(max(clk.Now().UnixNano(), now))
+			return nil
+		}))
+		if err != nil {
+			h.loops.Delete(loop)
+		}
+		return true
+	})
+}
+
+// stalled returns an error when an event loop of the handler left a probe
+// unanswered for longer than loopStall.
+func (h *ProxyEventHandler) stalled() error {
+	now := h.clock().Now()
+	var err error
+	h.loops.Range(func(k, v any) bool {
+		loop, p := k.(gnet.EventLoop), v.(*loopProbe)
+		sent := time.Unix(0, p.sent.Load())
+		if p.sent.Load() <= p.answered.Load() || now.Sub(sent) <= loopStall {
+			return true
+		}
+		// The engine of a loop may have stopped since the probe was sent
+		if loop.Execute(context.Background(), gnet.RunnableFunc(func(context.Context) error { return nil })) != nil {
+			h.loops.Delete(loop)
+			return true
+		}
+		err = fmt.Errorf("an event loop has not run for %v", now.Sub(sent).Round(time.Second))
+		return false
+	})
+	return err
+}
+
+// Heartbeat reports whether the engine is alive: its state can be taken,
+// every event loop answers the probes of its ticker and no active health
+// check is stuck. It blocks for as long as the engine is deadlocked, so a
+// watchdog calling it stops answering either way.
+func (e *Engine) Heartbeat() error {
+	e.mu.Lock()
+	e.mu.Unlock()
+
+	var errs []error
+	for _, h := range e.handlers() {
+		if err := h.stalled(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	e.mu.RLock()
+	for name, c := range e.Checkers {
+		if c.Stalled() {
+			errs = append(errs, fmt.Errorf("the health check of backend %s is stuck", name))
+		}
+	}
+	e.mu.RUnlock()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core/clock"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// fakeLoop stands in for a gnet event loop: it runs probes at once unless
+// hung, and refuses them once stopped.
+type fakeLoop struct {
+	gnet.EventLoop
+	hung, stopped bool
+}
+
+func (l *fakeLoop) Execute(ctx context.Context, r gnet.Runnable) error {
+	if l.stopped {
+		return errors.New("engine in shutdown")
+	}
+	if l.hung {
+		return nil
+	}
+	return r.Run(ctx)
+}
+
+func TestProbeLoops(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	h := &ProxyEventHandler{engine: &Engine{Clock: fake}}
+	live, hung := &fakeLoop{}, &fakeLoop{hung: true}
+	h.loops.Store(live, &loopProbe{})
+	h.loops.Store(hung, &loopProbe{})
+
+	h.probeLoops()
+	if err := h.stalled(); err != nil {
+		t.Fatalf("stalled right after a probe: %v", err)
+	}
+	fake.Advance(loopStall + time.Second)
+	h.probeLoops()
+	if err := h.stalled(); err == nil {
+		t.Fatal("a loop leaving its probe unanswered is not reported")
+	}
+
+	// A loop whose engine stopped is forgotten, not hung
+	hung.stopped = true
+	if err := h.stalled(); err != nil {
+		t.Errorf("stalled after the hung loop stopped: %v", err)
+	}
+	if _, ok := h.loops.Load(hung); ok {
+		t.Error("stopped loop still probed")
+	}
+	if _, ok := h.loops.Load(live); !ok {
+		t.Error("live loop forgotten")
+	}
+}
+
+func TestWatchLoop_Parked(t *testing.T) {
+	h := &ProxyEventHandler{}
+	h.watchLoop(&MockGnetConn{})
+	if _, ok := h.loops.Load(mockLoop); !ok {
+		t.Error("loop of a started group not watched")
+	}
+
+	// Promoted loops of a parked group would wake every loopTick
+	parked := &ProxyEventHandler{unprobed: true}
+	parked.watchLoop(&MockGnetConn{})
+	if _, ok := parked.loops.Load(mockLoop); ok {
+		t.Error("loop of a parked group watched")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	cfg := &config.Config{
+		Version:  "2",
+		Backends: []config.Backend{{Name: "be", Servers: []config.Server{{Address: echoServer(t)}}}},
+		Listeners: []config.Listener{
+			{Name: "a", Bind: config.Binds{fmt.Sprintf("127.0.0.1:%d", freePort(t))}, Protocol: "tcp", DefaultBackend: "be"},
+		},
+	}
+	cfg.ApplyDefaults()
+	engine := startTestEngine(t, cfg)
+
+	conn, err := net.DialTimeout("tcp", cfg.Listeners[0].Bind[0], time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn, "ping")
+
+	// The loop serving the connection answers the probes of the ticker
+	h := engine.handlers()[0]
+	for deadline := time.Now().Add(3 * loopTick); ; time.Sleep(10 * time.Millisecond) {
+		answered := false
+		h.loops.Range(func(_, v any) bool {
+			answered = v.(*loopProbe).answered.Load() != 0
+			return !answered
+		})
+		if answered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no event loop answered a probe")
+		}
+	}
+	if err := engine.Heartbeat(); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+
+	// One hung loop fails it
+	p := &loopProbe{}
+	p.sent.Store(1)
+	h.loops.Store(&fakeLoop{hung: true}, p)
+	if err := engine.Heartbeat(); err == nil || !strings.Contains(err.Error(), "event loop") {
+		t.Errorf("Heartbeat with a hung loop = %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package core
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"nvelox/config"
+	"nvelox/core/logging"
+	"nvelox/lb"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNoWeightsFile = errors.New("neither admin.weights_file nor a state store is configured")
+
+// SetWeight changes the administrative weight of a server (0-256) at once.
+// Weight 0 drains the server; a resolved hostname server drains all its
+// addresses. Drains are listed by Drains until the server's connections are
+// gone. The weight outlives backend reconfiguration;
+// with persist it is also written to admin.weights_file or the state store
+// and reapplied on the next start.
+func (e *Engine) SetWeight(backend, server string, weight int, persist bool) error {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	if persist && e.Store == nil && e.CurrentConfig().Admin.WeightsFile == "" {
+		return ErrNoWeightsFile
+	}
+
+	balancer, ok := e.balancer(backend)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+	w, ok := balancer.(lb.Weighter)
+	if !ok {
+		return fmt.Errorf("backend %s balancer does not support weights", backend)
+	}
+	previous := e.ServerWeight(backend, server)
+	for _, addr := range e.pinned(backend, server) {
+		if err := w.SetWeight(addr, weight); err != nil {
+			return err
+		}
+	}
+	logging.Info("[WEIGHT] %s/%s set to %d", backend, server, weight)
+
+	e.mu.Lock()
+	setNested(e.weights, backend, server, weight)
+	if persist {
+		setNested(e.persistedWeights, backend, server, weight)
+	}
+	persisted := e.persistedWeights
+	drain := e.serverDrainLocked(backend, server)
+	e.mu.Unlock()
+
+	switch {
+	case weight == 0 && drain == nil && previous != 0:
+		e.drainServer(backend, server, previous)
+	case weight != 0 && drain != nil:
+		e.endDrain(drain.ID)
+	}
+
+	if persist {
+		return e.writeWeights(persisted)
+	}
+	return nil
+}
+
+// SetHealth marks a server up or down for its balancer at once, as an
+// external controller sees it; a resolved hostname server applies it to all
+// its addresses. An active health check overrides it on its next status
+// change, a reload of the backend marks servers without a check up again.
+func (e *Engine) SetHealth(backend, server string, healthy bool) error {
+	balancer, ok := e.balancer(backend)
+	be, known := e.backend(backend)
+	if !ok || !known {
+		return fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+	if !slices.Contains(be.Addresses(), server) {
+		return fmt.Errorf("%w: %s", lb.ErrUnknownServer, server)
+	}
+	for _, addr := range e.pinned(backend, server) {
+		balancer.UpdateStatus(addr, healthy)
+	}
+	state := "down"
+	if healthy {
+		state = "up"
+	}
+	logging.Debug("[HEALTH] backend %s server %s marked %s", backend, server, state)
+	return nil
+}
+
+// ErrInvalidServerState is returned for a state not in config.ServerStates.
+var ErrInvalidServerState = errors.New("invalid server state")
+
+// SetServerState puts a server in an administrative state at once,
+// overriding its configured one. A draining server gets no new connections
+// but keeps its open ones and stays out whatever its health checks say; a
+// server in maintenance is not health checked either. A resolved hostname
+// server applies it to all its addresses. Like a weight it outlives backend
+// reconfiguration, and with admin.server_states_file or a state store a
+// restart too.
+func (e *Engine) SetServerState(backend, server, state string) error {
+	if !slices.Contains(config.ServerStates, state) {
+		return fmt.Errorf("%w %q, expected one of %s", ErrInvalidServerState, state, strings.Join(config.ServerStates, ", "))
+	}
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	balancer, ok := e.balancer(backend)
+	be, known := e.backend(backend)
+	if !ok || !known {
+		return fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+	if !slices.Contains(be.Addresses(), server) {
+		return fmt.Errorf("%w: %s", lb.ErrUnknownServer, server)
+	}
+	d, ok := balancer.(lb.Disabler)
+	if !ok {
+		return fmt.Errorf("backend %s balancer does not support disabling servers", backend)
+	}
+	for _, addr := range e.pinned(backend, server) {
+		if err := d.SetDisabled(addr, state != config.ServerReady); err != nil {
+			return err
+		}
+	}
+	logging.Info("[ADMIN] backend %s server %s set to %s", backend, server, state)
+
+	configured := config.ServerReady
+	if i := slices.Index(be.Addresses(), server); be.Servers[i].State != "" {
+		configured = be.Servers[i].State
+	}
+	e.mu.Lock()
+	if state != configured {
+		if e.states[backend] == nil {
+			e.states[backend] = make(map[string]string)
+		}
+		e.states[backend][server] = state
+	} else {
+		delete(e.states[backend], server)
+	}
+	states := make(map[string]map[string]string, len(e.states))
+	for b, servers := range e.states {
+		if len(servers) > 0 {
+			states[b] = maps.Clone(servers)
+		}
+	}
+	e.mu.Unlock()
+
+	if err := e.writeServerStates(states); err != nil {
+		logging.Warn("[ADMIN] %v", err)
+	}
+	return nil
+}
+
+// SetDisabled drains a server, or makes it ready again, with SetServerState.
+func (e *Engine) SetDisabled(backend, server string, disabled bool) error {
+	state := config.ServerReady
+	if disabled {
+		state = config.ServerDrain
+	}
+	return e.SetServerState(backend, server, state)
+}
+
+// ServerState returns the administrative state of a server: the one set
+// with SetServerState, else the configured one.
+func (e *Engine) ServerState(backend, server string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if state, ok := e.states[backend][server]; ok {
+		return state
+	}
+	if be, ok := e.Backends[backend]; ok {
+		for _, s := range be.Servers {
+			if s.Address == server && s.State != "" {
+				return s.State
+			}
+		}
+	}
+	return config.ServerReady
+}
+
+// ServerDisabled reports whether a server is out of rotation for its
+// administrative state.
+func (e *Engine) ServerDisabled(backend, server string) bool {
+	return e.ServerState(backend, server) != config.ServerReady
+}
+
+// inMaint reports whether the pool member addr of a backend stands for a
+// server in maintenance, which health checks skip.
+func (e *Engine) inMaint(backend, addr string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	be, ok := e.Backends[backend]
+	if !ok {
+		return false
+	}
+	owners := memberOwners(e.resolved[backend])
+	for _, s := range be.Servers {
+		if s.Address == addr {
+			return e.memberState(be.Name, s, owners) == config.ServerMaint
+		}
+	}
+	return false
+}
+
+// memberState returns the administrative state of a pool member, owners
+// mapping resolved addresses to their hostname server. Callers hold e.mu or
+// e.applyMu.
+func (e *Engine) memberState(backend string, s config.Server, owners map[string]string) string {
+	server := cmp.Or(owners[s.Address], s.Address)
+	return cmp.Or(e.states[backend][server], s.State, config.ServerReady)
+}
+
+// memberOwners maps the addresses hostname servers resolved to back to them.
+func memberOwners(resolved map[string][]string) map[string]string {
+	owners := make(map[string]string)
+	for server, addrs := range resolved {
+		for _, addr := range addrs {
+			owners[addr] = server
+		}
+	}
+	return owners
+}
+
+// ServerWeight returns the current weight of a server, lb.DefaultWeight for
+// balancers without weights. A resolved hostname server reports the weight of
+// its first address.
+func (e *Engine) ServerWeight(backend, server string) int {
+	if b, ok := e.balancer(backend); ok {
+		if w, ok := b.(lb.Weighter); ok {
+			return w.Weight(e.pinned(backend, server)[0])
+		}
+	}
+	return lb.DefaultWeight
+}
+
+// applyWeights sets runtime weights on a new balancer, overriding the
+// configured ones. The weight of a resolved hostname server goes to each of
+// its addresses. Callers hold e.mu or e.applyMu.
+func (e *Engine) applyWeights(name string, b lb.Balancer, resolved map[string][]string) {
+	w, ok := b.(lb.Weighter)
+	if !ok {
+		return
+	}
+	for server, weight := range e.weights[name] {
+		for _, addr := range pinnedAddrs(resolved, server) {
+			if err := w.SetWeight(addr, weight); err != nil {
+				logging.Warn("[WEIGHT] ignoring weight of %s/%s: %v", name, addr, err)
+			}
+		}
+	}
+}
+
+// applyStates takes the servers of a new or updated balancer out of
+// rotation, or puts them back, for their administrative state. be is the
+// backend with its hostname servers pinned. Callers hold e.mu or e.applyMu.
+func (e *Engine) applyStates(be *config.Backend, b lb.Balancer, resolved map[string][]string) {
+	d, ok := b.(lb.Disabler)
+	if !ok {
+		return
+	}
+	owners := memberOwners(resolved)
+	for _, s := range be.Servers {
+		if s.Disabled {
+			continue
+		}
+		d.SetDisabled(s.Address, e.memberState(be.Name, s, owners) != config.ServerReady)
+	}
+}
+
+// loadWeights reads persisted weights from admin.weights_file or the state
+// store.
+func (e *Engine) loadWeights() {
+	path := e.Config.Admin.WeightsFile
+	if e.Store == nil && path == "" {
+		return
+	}
+	data, err := e.readState(weightsKey, path)
+	if err == nil {
+		if data == nil {
+			return
+		}
+		var weights map[string]map[string]int
+		if err = yaml.Unmarshal(data, &weights); err == nil {
+			for backend, servers := range weights {
+				for server, w := range servers {
+					setNested(e.weights, backend, server, w)
+					setNested(e.persistedWeights, backend, server, w)
+				}
+			}
+			return
+		}
+	}
+	logging.Warn("[WEIGHT] failed to load %s: %v", e.stateName(weightsKey, path), err)
+}
+
+func (e *Engine) writeWeights(weights map[string]map[string]int) error {
+	data, err := yaml.Marshal(weights)
+	if err != nil {
+		return err
+	}
+	if err := e.writeState(weightsKey, e.CurrentConfig().Admin.WeightsFile, data); err != nil {
+		return fmt.Errorf("failed to persist weights: %w", err)
+	}
+	return nil
+}
+
+// loadServerStates reads the server states set before the last restart from
+// admin.server_states_file or the state store. Callers hold e.mu.
+func (e *Engine) loadServerStates() {
+	path := e.Config.Admin.ServerStatesFile
+	if e.Store == nil && path == "" {
+		return
+	}
+	data, err := e.readState(statesKey, path)
+	if err == nil {
+		if data == nil {
+			return
+		}
+		var states map[string]map[string]string
+		if err = yaml.Unmarshal(data, &states); err == nil {
+			for backend, servers := range states {
+				for server, state := range servers {
+					if !slices.Contains(config.ServerStates, state) {
+						continue
+					}
+					if e.states[backend] == nil {
+						e.states[backend] = make(map[string]string)
+					}
+					e.states[backend][server] = state
+				}
+			}
+			return
+		}
+	}
+	logging.Warn("[ADMIN] failed to load %s: %v", e.stateName(statesKey, path), err)
+}
+
+// writeServerStates persists the server states set at runtime, if
+// admin.server_states_file or a state store is configured.
+func (e *Engine) writeServerStates(states map[string]map[string]string) error {
+	path := e.CurrentConfig().Admin.ServerStatesFile
+	if e.Store == nil && path == "" {
+		return nil
+	}
+	data, err := yaml.Marshal(states)
+	if err != nil {
+		return err
+	}
+	if err := e.writeState(statesKey, path, data); err != nil {
+		return fmt.Errorf("failed to persist server states: %w", err)
+	}
+	return nil
+}
+
+func setNested(m map[string]map[string]int, outer, inner string, v int) {
+	if m[outer] == nil {
+		m[outer] = make(map[string]int)
+	}
+	m[outer][inner] = v
+}
@@ -0,0 +1,264 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"nvelox/config"
+	"nvelox/lb"
+)
+
+func TestEngine_SetWeight(t *testing.T) {
+	cfg := &config.Config{
+		Admin:    config.AdminConfig{WeightsFile: filepath.Join(t.TempDir(), "weights.yaml")},
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1"}, {Address: "s2"}}, Weights: map[string]int{"s2": 5}}},
+	}
+	e := NewEngine(cfg)
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	if w := e.ServerWeight("web", "s2"); w != 5 {
+		t.Errorf("configured weight = %d, want 5", w)
+	}
+
+	if err := e.SetWeight("web", "s1", 0, true); err != nil {
+		t.Fatalf("SetWeight failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if s, _ := e.Balancers["web"].Next(); s != "s2" {
+			t.Fatalf("drained server s1 picked")
+		}
+	}
+	if err := e.SetWeight("web", "s3", 1, false); !errors.Is(err, lb.ErrUnknownServer) {
+		t.Errorf("expected ErrUnknownServer, got %v", err)
+	}
+	if err := e.SetWeight("api", "s1", 1, false); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("expected ErrUnknownBackend, got %v", err)
+	}
+
+	// A new engine picks the persisted weight up again
+	e2 := NewEngine(cfg)
+	e2.loadWeights()
+	rt, _ = e2.newBackendRuntime(&cfg.Backends[0])
+	if w := rt.balancer.(lb.Weighter).Weight("s1"); w != 0 {
+		t.Errorf("persisted weight = %d, want 0", w)
+	}
+}
+
+func TestEngine_SetWeight_NoWeightsFile(t *testing.T) {
+	e := NewEngine(&config.Config{})
+	if err := e.SetWeight("web", "s1", 1, true); !errors.Is(err, ErrNoWeightsFile) {
+		t.Errorf("expected ErrNoWeightsFile, got %v", err)
+	}
+}
+
+func TestEngine_SetWeight_StateStore(t *testing.T) {
+	cfg := &config.Config{
+		State:    config.StateConfig{Type: "file", Path: t.TempDir(), Node: "node-a"},
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1"}, {Address: "s2"}}}},
+	}
+	e := NewEngine(cfg)
+	rt, _ := e.newBackendRuntime(&cfg.Backends[0])
+	rt.install(e)
+	if err := e.SetWeight("web", "s1", 7, true); err != nil {
+		t.Fatalf("SetWeight without a weights file: %v", err)
+	}
+	e.counters.connOpened()
+	if err := e.writeStats(); err != nil {
+		t.Fatalf("writeStats: %v", err)
+	}
+
+	// Another node on the same store shares the weights, not the counters
+	other := *cfg
+	other.State.Node = "node-b"
+	e2 := NewEngine(&other)
+	e2.loadWeights()
+	e2.loadStats()
+	rt, _ = e2.newBackendRuntime(&cfg.Backends[0])
+	if w := rt.balancer.(lb.Weighter).Weight("s1"); w != 7 {
+		t.Errorf("shared weight = %d, want 7", w)
+	}
+	if n := e2.Stats().Connections; n != 0 {
+		t.Errorf("node-b restored %d connections of node-a", n)
+	}
+}
+
+func TestEngine_SetHealth(t *testing.T) {
+	cfg := &config.Config{
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1"}, {Address: "s2"}}}},
+	}
+	e := NewEngine(cfg)
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	if err := e.SetHealth("web", "s1", false); err != nil {
+		t.Fatalf("SetHealth failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if s, _ := e.Balancers["web"].Next(); s != "s2" {
+			t.Fatalf("server s1 marked down picked")
+		}
+	}
+	if err := e.SetHealth("web", "s1", true); err != nil {
+		t.Fatalf("SetHealth failed: %v", err)
+	}
+	picked := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		s, _ := e.Balancers["web"].Next()
+		picked[s] = true
+	}
+	if !picked["s1"] {
+		t.Errorf("server s1 marked up never picked")
+	}
+	if err := e.SetHealth("web", "s3", true); !errors.Is(err, lb.ErrUnknownServer) {
+		t.Errorf("expected ErrUnknownServer, got %v", err)
+	}
+	if err := e.SetHealth("api", "s1", true); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("expected ErrUnknownBackend, got %v", err)
+	}
+}
+
+func TestEngine_SetDisabled(t *testing.T) {
+	cfg := &config.Config{
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1"}, {Address: "s2"}}}},
+	}
+	e := NewEngine(cfg)
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	if err := e.SetDisabled("web", "s1", true); err != nil {
+		t.Fatalf("SetDisabled failed: %v", err)
+	}
+	// Health checks do not bring it back
+	e.SetHealth("web", "s1", true)
+	for i := 0; i < 5; i++ {
+		if s, _ := e.Balancers["web"].Next(); s != "s2" {
+			t.Fatalf("disabled server s1 picked")
+		}
+	}
+	if !e.ServerDisabled("web", "s1") {
+		t.Error("s1 not reported disabled")
+	}
+
+	// A rebuilt backend keeps it disabled
+	rt, _ = e.newBackendRuntime(&cfg.Backends[0])
+	rt.install(e)
+	if s, _ := e.Balancers["web"].Next(); s != "s2" {
+		t.Fatalf("disabled server s1 picked after reconfiguration")
+	}
+
+	if err := e.SetDisabled("web", "s1", false); err != nil {
+		t.Fatalf("SetDisabled failed: %v", err)
+	}
+	picked := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		s, _ := e.Balancers["web"].Next()
+		picked[s] = true
+	}
+	if !picked["s1"] || e.ServerDisabled("web", "s1") {
+		t.Errorf("server s1 enabled again never picked")
+	}
+	if err := e.SetDisabled("web", "s3", true); !errors.Is(err, lb.ErrUnknownServer) {
+		t.Errorf("expected ErrUnknownServer, got %v", err)
+	}
+}
+
+func TestEngine_SetServerState(t *testing.T) {
+	cfg := &config.Config{
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1", State: config.ServerDrain}, {Address: "s2"}}}},
+	}
+	e := NewEngine(cfg)
+	rt, err := e.newBackendRuntime(&cfg.Backends[0])
+	if err != nil {
+		t.Fatalf("newBackendRuntime failed: %v", err)
+	}
+	rt.install(e)
+
+	// Drained in the configuration
+	for i := 0; i < 4; i++ {
+		if s, _ := e.Balancers["web"].Next(); s != "s2" {
+			t.Fatalf("draining server s1 picked")
+		}
+	}
+	if got := e.ServerState("web", "s1"); got != config.ServerDrain {
+		t.Errorf("ServerState = %s, want drain", got)
+	}
+
+	if err := e.SetServerState("web", "s1", config.ServerReady); err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+	picked := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		s, _ := e.Balancers["web"].Next()
+		picked[s] = true
+	}
+	if !picked["s1"] {
+		t.Error("ready server s1 never picked")
+	}
+
+	if err := e.SetServerState("web", "s2", config.ServerMaint); err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+	if !e.inMaint("web", "s2") || e.inMaint("web", "s1") {
+		t.Error("maintenance not reported for health checks")
+	}
+	// Runtime states outlive a rebuilt backend
+	rt, _ = e.newBackendRuntime(&cfg.Backends[0])
+	rt.install(e)
+	if s, _ := e.Balancers["web"].Next(); s != "s1" {
+		t.Fatalf("server s2 in maintenance picked after reconfiguration")
+	}
+
+	if err := e.SetServerState("web", "s1", "down"); !errors.Is(err, ErrInvalidServerState) {
+		t.Errorf("expected ErrInvalidServerState, got %v", err)
+	}
+	if err := e.SetServerState("web", "s3", config.ServerDrain); !errors.Is(err, lb.ErrUnknownServer) {
+		t.Errorf("expected ErrUnknownServer, got %v", err)
+	}
+}
+
+func TestEngine_SetServerState_Persist(t *testing.T) {
+	cfg := &config.Config{
+		Admin:    config.AdminConfig{ServerStatesFile: filepath.Join(t.TempDir(), "states.yaml")},
+		Backends: []config.Backend{{Name: "web", Servers: []config.Server{{Address: "s1"}, {Address: "s2"}, {Address: "s3"}}}},
+	}
+	e := NewEngine(cfg)
+	rt, _ := e.newBackendRuntime(&cfg.Backends[0])
+	rt.install(e)
+	if err := e.SetServerState("web", "s1", config.ServerDrain); err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+	if err := e.SetServerState("web", "s2", config.ServerMaint); err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+	if err := e.SetServerState("web", "s2", config.ServerReady); err != nil {
+		t.Fatalf("SetServerState failed: %v", err)
+	}
+
+	// A restarted engine keeps s1 draining and s2 back to ready
+	e2 := NewEngine(cfg)
+	e2.loadServerStates()
+	rt, _ = e2.newBackendRuntime(&cfg.Backends[0])
+	rt.install(e2)
+	if got := e2.ServerState("web", "s1"); got != config.ServerDrain {
+		t.Errorf("restored state of s1 = %s, want drain", got)
+	}
+	if got := e2.ServerState("web", "s2"); got != config.ServerReady {
+		t.Errorf("restored state of s2 = %s, want ready", got)
+	}
+	for i := 0; i < 4; i++ {
+		if s, _ := e2.Balancers["web"].Next(); s == "s1" {
+			t.Fatalf("restored draining server s1 picked")
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nvelox/config"
+	"nvelox/core"
+	"nvelox/core/ports"
+)
+
+// resolveTimeout bounds each backend host lookup.
+const resolveTimeout = 2 * time.Second
+
+// LookupFunc resolves a host name, like net.Resolver.LookupHost.
+type LookupFunc func(ctx context.Context, host string) ([]string, error)
+
+// RunCheck implements `nvelox check`.
+func RunCheck(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlagSet("check", out)
+	var configFiles config.ConfigFiles
+	fs.Var(&configFiles, "config", "Path to configuration file; repeat to layer further files over it (default \"nvelox.yaml\")")
+	strictConfig := fs.Bool("strict-config", false, "Reject unknown configuration keys and a missing version")
+	allowUnknown := fs.String("allow-unknown", "", "Comma-separated keys tolerated by -strict-config (\"prefix*\" allowed)")
+	var overrides config.Overrides
+	fs.Var(&overrides, "set", "Override a configuration value, e.g. listeners[web].bind=:9090 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	configPath, layers := configFiles.Split()
+	opts := config.LoadOptions{Strict: *strictConfig, Layers: layers, Overrides: overrides}
+	if *allowUnknown != "" {
+		opts.AllowUnknown = strings.Split(*allowUnknown, ",")
+	}
+	return Check(ctx, configPath, opts, out)
+}
+
+// Check loads the configuration at path and writes every problem found by
+// validation and CheckConfig to out, along with listener ports already in use
+// on this host. It fails when there is any problem.
+func Check(ctx context.Context, path string, opts config.LoadOptions, out io.Writer) error {
+	res := checkFile(ctx, path, opts)
+	if res.loadErr != nil {
+		return fmt.Errorf("check: %w", res.loadErr)
+	}
+	warnings, problems := checkPortsInUse(res.cfg.Listeners)
+	res.Warnings = append(res.Warnings, warnings...)
+	res.Errors = append(res.Errors, problems...)
+	for _, w := range res.Warnings {
+		fmt.Fprintf(out, "warning: %s\n", w)
+	}
+	for _, p := range res.Errors {
+		fmt.Fprintf(out, "error: %s\n", p)
+	}
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("check: %d problems found in %s", len(res.Errors), path)
+	}
+	fmt.Fprintf(out, "configuration file %s is ok\n", path)
+	return nil
+}
+
+// FileResult is the outcome of checking one configuration file.
+type FileResult struct {
+	Path     string   `json:"path"`
+	OK       bool     `json:"ok"`
+	Warnings []string `json:"warnings,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+
+	loadErr error          // the file could not be read or parsed
+	cfg     *config.Config // the configuration loaded, if it could be
+}
+
+func checkFile(ctx context.Context, path string, opts config.LoadOptions) FileResult {
+	res := FileResult{Path: path}
+	opts.SkipValidation = true
+	cfg, err := config.LoadWithOptions(path, opts)
+	if err != nil {
+		res.loadErr = err
+		res.Errors = []string{err.Error()}
+		return res
+	}
+	res.cfg = cfg
+	res.Warnings = cfg.Warnings
+
+	if err := config.Validate(cfg); err != nil {
+		res.Errors = append(res.Errors, err.Error())
+	}
+	res.Errors = append(res.Errors, CheckConfig(ctx, cfg, nil)...)
+	res.OK = len(res.Errors) == 0
+	return res
+}
+
+// CheckConfig runs checks that need more than the configuration itself:
+// listener binds that are invalid or collide with another listener, backend
+// hosts that do not resolve and unusable health check settings. lookup
+// resolves host names; nil uses the system resolver.
+func CheckConfig(ctx context.Context, cfg *config.Config, lookup LookupFunc) []string {
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+	problems := checkBinds(cfg.Listeners)
+	for _, b := range cfg.Backends {
+		problems = append(problems, checkHealth(b)...)
+	}
+	return append(problems, checkHosts(ctx, cfg, lookup)...)
+}
+
+// bound is one protocol and port claimed by a listener.
+type bound struct {
+	listener string
+	host     string
+}
+
+// overlap collects the ports two listeners both bind.
+type overlap struct {
+	a, b  string
+	proto string
+	ports []int
+}
+
+func checkBinds(listeners []config.Listener) []string {
+	problems := make([]string, 0)
+	claimed := make(map[string][]bound) // "proto:port" -> listeners
+	overlaps := make(map[string]*overlap)
+	order := make([]string, 0)
+
+	for _, l := range listeners {
+		if err := checkPorts(l.Bind); err != nil {
+			problems = append(problems, fmt.Sprintf("listener %s: %v", l.Name, err))
+			continue
+		}
+		expanded, err := core.ExpandListener(l)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("listener %s: %v", l.Name, err))
+			continue
+		}
+		for _, lc := range expanded {
+			if lc.Port == 0 {
+				continue // Ephemeral port, cannot collide
+			}
+			host, _, _ := core.SplitHostPort(lc.Addr)
+			host = strings.Trim(host, "[]")
+			key := fmt.Sprintf("%s:%d", lc.Protocol, lc.Port)
+			for _, other := range claimed[key] {
+				if other.listener == l.Name || !hostsOverlap(other.host, host) {
+					continue
+				}
+				id := other.listener + "\x00" + l.Name + "\x00" + lc.Protocol
+				o, ok := overlaps[id]
+				if !ok {
+					o = &overlap{a: other.listener, b: l.Name, proto: lc.Protocol}
+					overlaps[id] = o
+					order = append(order, id)
+				}
+				o.ports = append(o.ports, lc.Port)
+			}
+			claimed[key] = append(claimed[key], bound{listener: l.Name, host: host})
+		}
+	}
+
+	for _, id := range order {
+		o := overlaps[id]
+		problems = append(problems, fmt.Sprintf("listeners %s and %s both bind %s %s", o.a, o.b, o.proto, portList(o.ports)))
+	}
+	return problems
+}
+
+// checkPortsInUse probes the listener ports on this host. A port held by
+// another program is a problem; one held by nvelox itself, usually the
+// instance the configuration is meant for, or by a process we may not
+// inspect only warrants a warning.
+func checkPortsInUse(listeners []config.Listener) (warnings, problems []string) {
+	expanded := make([]*core.ListenerConfig, 0)
+	for _, l := range listeners {
+		lcs, err := core.ExpandListener(l)
+		if err != nil {
+			continue // reported by checkBinds
+		}
+		expanded = append(expanded, lcs...)
+	}
+	for _, c := range ports.Check(core.BindAddrs(expanded)) {
+		msg := fmt.Sprintf("listener %s: %s", c.Listener, c)
+		if c.PID == 0 || c.Ours() {
+			warnings = append(warnings, msg)
+		} else {
+			problems = append(problems, msg)
+		}
+	}
+	return warnings, problems
+}
+
+// checkPorts validates the ports or port ranges of bind addresses.
+func checkPorts(binds []string) error {
+	for _, bind := range binds {
+		if err := checkBindPorts(bind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkBindPorts(bind string) error {
+	_, portStr, err := core.SplitHostPort(bind)
+	if err != nil {
+		return fmt.Errorf("invalid bind address %q: %w", bind, err)
+	}
+	parts := strings.Split(portStr, "-")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid port range %q", portStr)
+	}
+	ports := make([]int, 0, 2)
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q in bind %q", p, bind)
+		}
+		ports = append(ports, n)
+	}
+	if len(ports) == 2 && ports[0] > ports[1] {
+		return fmt.Errorf("port range %q is reversed", portStr)
+	}
+	return nil
+}
+
+// hostsOverlap reports whether two bind hosts can receive the same traffic.
+func hostsOverlap(a, b string) bool {
+	return isWildcard(a) || isWildcard(b) || a == b
+}
+
+func isWildcard(host string) bool {
+	switch host {
+	case "", "*", "0.0.0.0", "::":
+		return true
+	}
+	return false
+}
+
+// portList formats ports as "port 80" or "ports 1000-1010 (11 ports)".
+func portList(ports []int) string {
+	sort.Ints(ports)
+	if len(ports) == 1 {
+		return fmt.Sprintf("port %d", ports[0])
+	}
+	if ports[len(ports)-1]-ports[0] == len(ports)-1 {
+		return fmt.Sprintf("ports %d-%d (%d ports)", ports[0], ports[len(ports)-1], len(ports))
+	}
+	return fmt.Sprintf("%d ports between %d and %d", len(ports), ports[0], ports[len(ports)-1])
+}
+
+func checkHealth(b config.Backend) []string {
+	active := b.HealthCheck.Active
+	if active == (config.ActiveHealthCheck{}) {
+		return nil
+	}
+	problems := make([]string, 0)
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("backend %s: health_check: "+format, append([]any{b.Name}, args...)...))
+	}
+
+	switch active.Type {
+	case "", "tcp":
+	case "http":
+		if active.Path == "" {
+			add("http check requires a path")
+		}
+	default:
+		add("unknown type %q", active.Type)
+	}
+
+	interval, ok := positiveDuration(active.Interval)
+	switch {
+	case active.Interval == "":
+		add("no interval set, active checks are disabled")
+	case !ok:
+		add("invalid interval %q", active.Interval)
+	}
+	timeout, tok := positiveDuration(active.Timeout)
+	switch {
+	case active.Timeout == "":
+		add("no timeout set, every check would time out immediately")
+	case !tok:
+		add("invalid timeout %q", active.Timeout)
+	case ok && timeout > interval:
+		add("timeout %s is longer than interval %s", active.Timeout, active.Interval)
+	}
+	return problems
+}
+
+func positiveDuration(s string) (time.Duration, bool) {
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+func checkHosts(ctx context.Context, cfg *config.Config, lookup LookupFunc) []string {
+	problems := make([]string, 0)
+	overridden := make(map[string]bool, len(cfg.Hosts))
+	for name := range cfg.Hosts {
+		overridden[strings.ToLower(name)] = true
+	}
+	resolved := make(map[string]error)
+	for _, b := range cfg.Backends {
+		for _, server := range b.Addresses() {
+			host := server
+			if h, port, err := net.SplitHostPort(server); err == nil {
+				host = h
+				if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+					problems = append(problems, fmt.Sprintf("backend %s: server %s has an invalid port", b.Name, server))
+					continue
+				}
+			}
+			if net.ParseIP(host) != nil || overridden[strings.ToLower(host)] {
+				continue
+			}
+			err, seen := resolved[host]
+			if !seen {
+				lctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+				_, err = lookup(lctx, host)
+				cancel()
+				resolved[host] = err
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("backend %s: server %s does not resolve: %v", b.Name, server, err))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,111 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nvelox/config"
+)
+
+func TestCheckConfig(t *testing.T) {
+	cfg := &config.Config{
+		Hosts: map[string][]string{"db.internal": {"10.0.0.5"}},
+		Listeners: []config.Listener{
+			{Name: "range", Bind: config.Binds{":1000-1010"}, Protocol: "tcp"},
+			{Name: "single", Bind: config.Binds{"127.0.0.1:1005"}, Protocol: "tcp+udp"},
+			{Name: "other-ip", Bind: config.Binds{"127.0.0.2:2000"}, Protocol: "tcp"},
+			{Name: "same-ip", Bind: config.Binds{"127.0.0.2:2000"}, Protocol: "tcp"},
+			{Name: "elsewhere", Bind: config.Binds{"127.0.0.3:2000"}, Protocol: "tcp"},
+			{Name: "reversed", Bind: config.Binds{":3000-2000"}, Protocol: "tcp"},
+		},
+		Backends: []config.Backend{
+			{Name: "web", Servers: []config.Server{{Address: "10.0.0.1:80"}, {Address: "db.internal:5432"}, {Address: "app.example:80"}, {Address: "missing.example:80"}}},
+			{Name: "checked", Servers: []config.Server{{Address: "10.0.0.2"}}, HealthCheck: config.HealthCheckConfig{
+				Active: config.ActiveHealthCheck{Type: "http", Interval: "1s", Timeout: "5s"},
+			}},
+		},
+	}
+	lookup := func(_ context.Context, host string) ([]string, error) {
+		if host == "app.example" {
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	got := CheckConfig(context.Background(), cfg, lookup)
+	want := []string{
+		`listener reversed: port range "3000-2000" is reversed`,
+		"listeners range and single both bind tcp port 1005",
+		"listeners other-ip and same-ip both bind tcp port 2000",
+		"backend checked: health_check: http check requires a path",
+		"backend checked: health_check: timeout 5s is longer than interval 1s",
+		"backend web: server missing.example:80 does not resolve: no such host",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CheckConfig problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPortList(t *testing.T) {
+	if got := portList([]int{1003, 1001, 1002}); got != "ports 1001-1003 (3 ports)" {
+		t.Errorf("portList = %q", got)
+	}
+	if got := portList([]int{1, 5}); got != "2 ports between 1 and 5" {
+		t.Errorf("portList = %q", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvelox.yaml")
+	os.WriteFile(path, []byte(`
+version: '2'
+listeners:
+  - name: a
+    bind: "127.0.0.1:8080"
+    default_backend: missing
+  - name: b
+    bind: "127.0.0.1:8080"
+`), 0644)
+
+	var out bytes.Buffer
+	err := Check(context.Background(), path, config.LoadOptions{}, &out)
+	if err == nil {
+		t.Fatal("expected check to fail")
+	}
+	// Validation and deep checks are both reported
+	if !strings.Contains(out.String(), "unknown backend: missing") || !strings.Contains(out.String(), "listeners a and b both bind tcp port 8080") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	os.WriteFile(path, []byte("version: '2'\nlisteners:\n  - name: a\n    bind: \"127.0.0.1:8080\"\n"), 0644)
+	out.Reset()
+	if err := Check(context.Background(), path, config.LoadOptions{}, &out); err != nil {
+		t.Fatalf("expected valid config to pass: %v\n%s", err, out.String())
+	}
+}
+
+func TestCheck_PortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	path := filepath.Join(t.TempDir(), "nvelox.yaml")
+	os.WriteFile(path, []byte("version: '2'\nlisteners:\n  - name: web\n    bind: \""+ln.Addr().String()+"\"\n"), 0644)
+
+	// The port is held by this very program, as with a running instance
+	var out bytes.Buffer
+	if err := Check(context.Background(), path, config.LoadOptions{}, &out); err != nil {
+		t.Fatalf("expected a port held by ourselves to pass: %v\n%s", err, out.String())
+	}
+	if want := "warning: listener web: tcp " + ln.Addr().String() + " is already in use"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected %q in output:\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,94 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"nvelox/preauth"
+)
+
+// knockWait bounds how long a knock waits for the knock listener to close
+// the connection, which it does once the knock is recorded.
+const knockWait = 5 * time.Second
+
+func runConnect(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlagSet("connect", out)
+	knock := fs.String("knock", "", "Knock listener to connect to first")
+	secretEnv := fs.String("secret-env", "NVELOX_PREAUTH_SECRET", "Environment variable holding the preauth secret")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: nvelox ctl connect [-knock addr] host:port")
+	}
+
+	conn, err := DialPreauth(ctx, fs.Arg(0), *knock, []byte(os.Getenv(*secretEnv)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(out, conn)
+	return err
+}
+
+// DialPreauth connects to a listener with preauth. With knock, it knocks
+// there first, sending the preamble on the knock if secret is set;
+// otherwise the preamble opens the connection itself. The returned
+// connection is ready for the proxied protocol.
+func DialPreauth(ctx context.Context, addr, knock string, secret []byte) (net.Conn, error) {
+	var d net.Dialer
+	if knock != "" {
+		k, err := d.DialContext(ctx, "tcp", knock)
+		if err != nil {
+			return nil, fmt.Errorf("knock: %w", err)
+		}
+		err = sendPreamble(k, secret)
+		if err == nil {
+			// Closed by the listener once it admitted us
+			k.SetReadDeadline(time.Now().Add(knockWait))
+			_, err = k.Read(make([]byte, 1))
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+		}
+		k.Close()
+		if err != nil {
+			return nil, fmt.Errorf("knock: %w", err)
+		}
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if knock == "" {
+		if err := sendPreamble(conn, secret); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func sendPreamble(conn net.Conn, secret []byte) error {
+	if len(secret) == 0 {
+		return nil
+	}
+	p, err := preauth.Preamble(secret, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(p)
+	return err
+}
@@ -0,0 +1,58 @@
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"nvelox/preauth"
+)
+
+func TestDialPreauth(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(c).ReadString('\n')
+			lines <- line
+			c.Close()
+		}
+	}()
+	check := func(line string) {
+		t.Helper()
+		if _, _, err := preauth.Parse([]byte(line), secret, time.Now(), time.Minute); err != nil {
+			t.Errorf("bad preamble %q: %v", line, err)
+		}
+	}
+
+	// The preamble opens the connection
+	conn, err := DialPreauth(context.Background(), ln.Addr().String(), "", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	check(<-lines)
+
+	// or goes to the knock, which is done once the listener closes it
+	conn, err = DialPreauth(context.Background(), ln.Addr().String(), ln.Addr().String(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(<-lines)
+	conn.Write([]byte("plain\n"))
+	if line := <-lines; line != "plain\n" {
+		t.Errorf("connection after the knock sent %q", line)
+	}
+	conn.Close()
+}
@@ -0,0 +1,35 @@
+// Package ctl implements the `nvelox ctl` operator commands.
+package ctl
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+)
+
+const defaultAdminURL = "http://127.0.0.1:9000"
+
+// Run executes a ctl subcommand. args excludes the "ctl" word itself.
+func Run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: nvelox ctl <selftest|echo|connect> [flags]")
+	}
+
+	switch args[0] {
+	case "selftest":
+		return runSelftest(ctx, args[1:], out)
+	case "echo":
+		return runEcho(ctx, args[1:], out)
+	case "connect":
+		return runConnect(ctx, args[1:], out)
+	default:
+		return fmt.Errorf("unknown ctl command: %s", args[0])
+	}
+}
+
+func newFlagSet(name string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("nvelox ctl "+name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	return fs
+}
@@ -0,0 +1,107 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"nvelox/config"
+	"nvelox/core"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RunConfig implements `nvelox config <command>`.
+func RunConfig(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "dump":
+			return runDump(args[1:], out)
+		case "migrate":
+			return runMigrate(args[1:], out)
+		}
+	}
+	return fmt.Errorf("usage: nvelox config dump [-config file] [-set path=value] | migrate [-o file] <file>")
+}
+
+func runDump(args []string, out io.Writer) error {
+	fs := newFlagSet("config dump", out)
+	var configFiles config.ConfigFiles
+	fs.Var(&configFiles, "config", "Path to configuration file; repeat to layer further files over it (default \"nvelox.yaml\")")
+	strictConfig := fs.Bool("strict-config", false, "Reject unknown configuration keys and a missing version")
+	allowUnknown := fs.String("allow-unknown", "", "Comma-separated keys tolerated by -strict-config (\"prefix*\" allowed)")
+	var overrides config.Overrides
+	fs.Var(&overrides, "set", "Override a configuration value, e.g. listeners[web].bind=:9090 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	configPath, layers := configFiles.Split()
+	opts := config.LoadOptions{Strict: *strictConfig, Layers: layers, Overrides: overrides}
+	if *allowUnknown != "" {
+		opts.AllowUnknown = strings.Split(*allowUnknown, ",")
+	}
+	cfg, err := config.LoadWithOptions(configPath, opts)
+	if err != nil {
+		return fmt.Errorf("config dump: %w", err)
+	}
+	return Dump(cfg, out)
+}
+
+// Dump writes the effective configuration as YAML: includes and layers
+// merged, defaults and environment variables applied, and port ranges
+// expanded to one bind per port, in the layout of the configuration's version. Load warnings
+// precede it as comments, so the output loads as is.
+func Dump(cfg *config.Config, out io.Writer) error {
+	effective := *cfg
+	effective.Include = nil    // already merged
+	effective.ConfigDirs = nil // likewise
+	effective.Listeners = make([]config.Listener, len(cfg.Listeners))
+	for i, l := range cfg.Listeners {
+		l.Bind = expandBinds(l)
+		effective.Listeners[i] = l
+	}
+
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(out, "# warning: %s\n", w)
+	}
+	v3 := cfg.Version == "3"
+	if v3 {
+		effective.Version = "2" // the layout of Config
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&effective); err != nil {
+		return fmt.Errorf("config dump: %w", err)
+	}
+	enc.Close()
+	data := buf.Bytes()
+	if v3 {
+		var err error
+		if data, _, err = config.MigrateV3("dump.yaml", data); err != nil {
+			return fmt.Errorf("config dump: %w", err)
+		}
+	}
+	_, err := out.Write(data)
+	return err
+}
+
+// expandBinds returns the addresses a listener binds, one per port, in the
+// order the engine binds them.
+func expandBinds(l config.Listener) config.Binds {
+	expanded, err := core.ExpandListener(l)
+	if err != nil {
+		return l.Bind
+	}
+	binds := make(config.Binds, 0, len(expanded))
+	for _, lc := range expanded {
+		if !slices.Contains(binds, lc.Addr) {
+			binds = append(binds, lc.Addr)
+		}
+	}
+	return binds
+}
@@ -0,0 +1,112 @@
+package ctl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nvelox/config"
+)
+
+func TestDump(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "nvelox.yaml")
+	os.WriteFile(main, []byte(`version: 2
+include: `+filepath.Join(dir, "conf.d")+`
+defaults:
+  balance: leastconn
+listeners:
+  - name: game
+    bind: "*:7000-7002"
+    protocol: tcp
+    default_backend: game
+backends:
+  - name: game
+    servers:
+      - address: "10.0.0.1"
+`), 0o644)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0o755)
+	os.WriteFile(filepath.Join(dir, "conf.d", "web.yaml"), []byte(`listeners:
+  - name: web
+    bind: ":8080"
+    protocol: tcp
+    default_backend: web
+backends:
+  - name: web
+    servers:
+      - address: "10.0.1.1:80"
+`), 0o644)
+
+	var out bytes.Buffer
+	if err := runDump([]string{"-config", main, "-set", "backends[web].balance=random"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	dump := out.String()
+	for _, want := range []string{"'*:7000'", "'*:7002'", "name: web", "balance: leastconn", "balance: random"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump lacks %q:\n%s", want, dump)
+		}
+	}
+	if strings.Contains(dump, "include") || strings.Contains(dump, "7000-7002") {
+		t.Errorf("expected includes merged and ranges expanded:\n%s", dump)
+	}
+
+	// The dump is a configuration of its own, equivalent to the original
+	dumped := filepath.Join(dir, "dumped.yaml")
+	os.WriteFile(dumped, out.Bytes(), 0o644)
+	cfg, err := config.LoadWithOptions(dumped, config.LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("dump does not load: %v", err)
+	}
+	if len(cfg.Listeners) != 2 || len(cfg.Listeners[0].Bind) != 3 || len(cfg.Backends) != 2 {
+		t.Errorf("unexpected reloaded config: %+v", cfg)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	v2 := filepath.Join(dir, "nvelox.yaml")
+	os.WriteFile(v2, []byte(`version: 2
+listeners:
+  - name: web
+    bind: ":8080-8081"
+    zero_copy: true
+    default_backend: web
+backends:
+  - name: web
+    servers: ["10.0.0.1:80", "10.0.0.2:80"]
+    weights: {"10.0.0.2:80": 0}
+`), 0o644)
+	v3 := filepath.Join(dir, "nvelox.v3.yaml")
+
+	var out bytes.Buffer
+	if err := runMigrate([]string{"-o", v3, v2}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "wrote "+v3) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if err := runMigrate([]string{v3}, &out); err == nil {
+		t.Error("expected an error migrating a version 3 file")
+	}
+
+	// A dump of the v3 file stays in its layout and loads again
+	out.Reset()
+	if err := runDump([]string{"-config", v3}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "version: 3") || !strings.Contains(out.String(), "zero_copy: true") {
+		t.Errorf("unexpected dump:\n%s", out.String())
+	}
+	dumped := filepath.Join(dir, "dumped.yaml")
+	os.WriteFile(dumped, out.Bytes(), 0o644)
+	cfg, err := config.LoadWithOptions(dumped, config.LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("v3 dump does not load: %v\n%s", err, out.String())
+	}
+	if w := cfg.Backends[0].Servers[1].Weight; w == nil || *w != 0 {
+		t.Errorf("weight lost in migration: %+v", cfg.Backends[0].Servers)
+	}
+}
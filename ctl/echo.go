@@ -0,0 +1,82 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+func runEcho(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlagSet("echo", out)
+	bind := fs.String("bind", "127.0.0.1:7", "Address to serve TCP and UDP echo on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := ListenEcho(*bind)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "echo responder listening on %s\n", e.Addr())
+	<-ctx.Done()
+	return e.Close()
+}
+
+// Echo is a TCP and UDP echo responder, usable as a selftest probe target.
+type Echo struct {
+	tcp net.Listener
+	udp net.PacketConn
+}
+
+// ListenEcho serves echo on addr over both TCP and UDP.
+func ListenEcho(addr string) (*Echo, error) {
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := net.ListenPacket("udp", tcp.Addr().String())
+	if err != nil {
+		tcp.Close()
+		return nil, err
+	}
+
+	e := &Echo{tcp: tcp, udp: udp}
+	go e.serveTCP()
+	go e.serveUDP()
+	return e, nil
+}
+
+// Addr returns the bound address, shared by TCP and UDP.
+func (e *Echo) Addr() net.Addr {
+	return e.tcp.Addr()
+}
+
+func (e *Echo) Close() error {
+	return errors.Join(e.tcp.Close(), e.udp.Close())
+}
+
+func (e *Echo) serveTCP() {
+	for {
+		c, err := e.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			io.Copy(c, c)
+		}()
+	}
+}
+
+func (e *Echo) serveUDP() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := e.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		e.udp.WriteTo(buf[:n], addr)
+	}
+}
@@ -0,0 +1,111 @@
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nvelox/config"
+)
+
+// runMigrate implements `nvelox config migrate`: it converts a version 2
+// file to version 3 and checks that both load to the same configuration.
+// The original is left alone, so both can be deployed side by side while
+// instances are upgraded.
+func runMigrate(args []string, out io.Writer) error {
+	fs := newFlagSet("config migrate", out)
+	output := fs.String("o", "", "Write the version 3 file here instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: nvelox config migrate [-o file] <file>")
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config migrate: %w", err)
+	}
+	converted, notes, err := config.MigrateV3(path, data)
+	if err != nil {
+		return fmt.Errorf("config migrate: %s: %w", path, err)
+	}
+	if err := sameConfig(path, converted); err != nil {
+		return fmt.Errorf("config migrate: %s: %w", path, err)
+	}
+
+	for _, n := range notes {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, n)
+	}
+	if *output == "" {
+		_, err = out.Write(converted)
+		return err
+	}
+	if err := os.WriteFile(*output, converted, 0644); err != nil {
+		return fmt.Errorf("config migrate: %w", err)
+	}
+	fmt.Fprintf(out, "wrote %s\n", *output)
+	return nil
+}
+
+// sameConfig loads the file at path and its converted form next to it, and
+// fails if they differ beyond the version. Weights are compared per server,
+// as version 3 no longer has a weights map, and settings without effect are
+// left out.
+func sameConfig(path string, converted []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".migrate-*.yaml")
+	if err != nil {
+		tmp, err = os.CreateTemp("", "nvelox-migrate-*.yaml")
+	}
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(converted)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	opts := config.LoadOptions{SkipValidation: true}
+	before, err := config.LoadWithOptions(path, opts)
+	if err != nil {
+		return err
+	}
+	after, err := config.LoadWithOptions(tmp.Name(), opts)
+	if err != nil {
+		return fmt.Errorf("the converted file does not load: %w", err)
+	}
+	normalize := func(cfg *config.Config) {
+		cfg.Version, cfg.Warnings = "", nil
+		for i := range cfg.Backends {
+			b := &cfg.Backends[i]
+			weights := b.ServerWeights()
+			for j := range b.Servers {
+				if w, ok := weights[b.Servers[j].Address]; ok {
+					b.Servers[j].Weight = &w
+				}
+			}
+			b.Weights = nil
+			if !b.SendsProxyV2() {
+				b.ProxyV2FamilyMismatch = "" // without effect
+			}
+		}
+	}
+	normalize(before)
+	normalize(after)
+	var a, b strings.Builder
+	if err := Dump(before, &a); err != nil {
+		return err
+	}
+	if err := Dump(after, &b); err != nil {
+		return err
+	}
+	if a.String() != b.String() {
+		return fmt.Errorf("the converted file loads differently, please report this")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nvelox/adminclient"
+	"nvelox/core"
+)
+
+// Probe outcomes
+const (
+	ResultPass = "PASS"
+	ResultFail = "FAIL"
+)
+
+// ProbeResult is the outcome of probing one listener.
+type ProbeResult struct {
+	Listener string
+	Protocol string
+	Addr     string
+	Result   string
+	Detail   string
+	Latency  time.Duration
+}
+
+func runSelftest(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlagSet("selftest", out)
+	adminURL := fs.String("admin", defaultAdminURL, "Admin API URL of the running instance")
+	tokenEnv := fs.String("token-env", "NVELOX_ADMIN_TOKEN", "Environment variable holding the admin API token")
+	host := fs.String("host", "", "Host to reach wildcard binds on (default: the admin API host)")
+	timeout := fs.Duration("timeout", 2*time.Second, "Per-listener probe timeout")
+	payload := fs.String("payload", "nvelox-selftest", "Probe payload")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *host == "" {
+		u, err := url.Parse(*adminURL)
+		if err != nil {
+			return fmt.Errorf("invalid admin URL: %w", err)
+		}
+		*host = u.Hostname()
+	}
+
+	client := adminclient.New(*adminURL)
+	client.Token = os.Getenv(*tokenEnv)
+	state, err := client.State(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch state: %w", err)
+	}
+
+	results := Selftest(ctx, state, *host, []byte(*payload), *timeout)
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LISTENER\tPROTO\tADDRESS\tRESULT\tLATENCY\tDETAIL")
+	failed := 0
+	for _, r := range results {
+		if r.Result == ResultFail {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\t%s\n", r.Listener, r.Protocol, r.Addr, r.Result, r.Latency.Round(time.Microsecond), r.Detail)
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("selftest: %d of %d listeners failed", failed, len(results))
+	}
+	return nil
+}
+
+// Selftest probes the first address of every listener in state. Wildcard
+// binds are reached on host. A listener passes when its backend echoes the
+// payload, answers with anything, or (TCP only) keeps the connection open
+// without answering; a connection closed by the proxy means the backend was
+// unreachable.
+func Selftest(ctx context.Context, state *adminclient.State, host string, payload []byte, timeout time.Duration) []ProbeResult {
+	results := make([]ProbeResult, 0, len(state.Listeners))
+	for _, l := range state.Listeners {
+		expanded, err := core.ExpandListener(l)
+		if err != nil {
+			results = append(results, ProbeResult{Listener: l.Name, Result: ResultFail, Detail: err.Error()})
+			continue
+		}
+
+		seen := make(map[string]bool)
+		for _, lc := range expanded {
+			if seen[lc.Protocol] {
+				continue // Probe one port per protocol of a range
+			}
+			seen[lc.Protocol] = true
+
+			addr := probeAddr(lc, host)
+			r := probe(ctx, lc.Protocol, addr, payload, timeout)
+			r.Listener = l.Name
+			r.Protocol = lc.Protocol
+			r.Addr = addr
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// probeAddr returns the dialable address of a listener.
+func probeAddr(lc *core.ListenerConfig, host string) string {
+	bindHost, _, _ := core.SplitHostPort(lc.Addr)
+	bindHost = strings.Trim(bindHost, "[]")
+	switch bindHost {
+	case "", "*", "0.0.0.0", "::":
+		bindHost = host
+	}
+	return net.JoinHostPort(bindHost, fmt.Sprint(lc.Port))
+}
+
+func probe(ctx context.Context, network, addr string, payload []byte, timeout time.Duration) ProbeResult {
+	start := time.Now()
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return ProbeResult{Result: ResultFail, Detail: err.Error()}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(payload); err != nil {
+		return ProbeResult{Result: ResultFail, Detail: err.Error(), Latency: time.Since(start)}
+	}
+
+	buf := make([]byte, len(payload))
+	n, err := io.ReadFull(conn, buf)
+	latency := time.Since(start)
+	switch {
+	case err == nil && bytes.Equal(buf, payload):
+		return ProbeResult{Result: ResultPass, Detail: "echo", Latency: latency}
+	case n > 0:
+		return ProbeResult{Result: ResultPass, Detail: "response", Latency: latency}
+	case errors.Is(err, os.ErrDeadlineExceeded) && network == "tcp":
+		return ProbeResult{Result: ResultPass, Detail: "open, no response", Latency: latency}
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return ProbeResult{Result: ResultFail, Detail: "no reply", Latency: latency}
+	default:
+		return ProbeResult{Result: ResultFail, Detail: "closed by proxy: " + err.Error(), Latency: latency}
+	}
+}
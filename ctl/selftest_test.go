@@ -0,0 +1,92 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/admin"
+	"nvelox/adminclient"
+	"nvelox/config"
+	"nvelox/core"
+)
+
+func TestSelftest(t *testing.T) {
+	echo, err := ListenEcho("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenEcho failed: %v", err)
+	}
+	defer echo.Close()
+
+	// A port nobody listens on
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	state := &adminclient.State{Listeners: []config.Listener{
+		{Name: "echo", Bind: config.Binds{echo.Addr().String()}, Protocol: "tcp+udp"},
+		{Name: "down", Bind: config.Binds{closedAddr}, Protocol: "tcp"},
+	}}
+	results := Selftest(context.Background(), state, "127.0.0.1", []byte("ping"), time.Second)
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", results)
+	}
+	for _, r := range results[:2] {
+		if r.Result != ResultPass || r.Detail != "echo" {
+			t.Errorf("%s/%s: expected echo pass, got %+v", r.Listener, r.Protocol, r)
+		}
+	}
+	if results[2].Result != ResultFail {
+		t.Errorf("expected failure for closed port, got %+v", results[2])
+	}
+}
+
+func TestProbeAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8080", "10.0.0.1:8080"},
+		{"0.0.0.0:8080", "10.0.0.1:8080"},
+		{"127.0.0.2:8080", "127.0.0.2:8080"},
+		{"[::1]:8080", "[::1]:8080"},
+	}
+	for _, tt := range tests {
+		lc := &core.ListenerConfig{Addr: tt.addr, Port: 8080}
+		if got := probeAddr(lc, "10.0.0.1"); got != tt.want {
+			t.Errorf("probeAddr(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestRun_Selftest(t *testing.T) {
+	echo, err := ListenEcho("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenEcho failed: %v", err)
+	}
+	defer echo.Close()
+
+	cfg := &config.Config{
+		Version:   "2",
+		Listeners: []config.Listener{{Name: "echo", Bind: config.Binds{echo.Addr().String()}, Protocol: "tcp"}},
+	}
+	ts := httptest.NewServer(admin.NewServer(core.NewEngine(cfg), "v-test").Handler())
+	defer ts.Close()
+
+	var out bytes.Buffer
+	if err := Run(context.Background(), []string{"selftest", "-admin", ts.URL}, &out); err != nil {
+		t.Fatalf("selftest failed: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "PASS") {
+		t.Errorf("expected PASS in output:\n%s", out.String())
+	}
+
+	if err := Run(context.Background(), []string{"bogus"}, &out); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
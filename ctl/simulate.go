@@ -0,0 +1,330 @@
+package ctl
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nvelox/core"
+	"nvelox/core/logging"
+	"nvelox/lb"
+)
+
+// simulateAlgorithms are the balancers `nvelox lb simulate -algo all` compares.
+var simulateAlgorithms = []string{"roundrobin", "leastconn", "random", "latency"}
+
+// TraceConn is one client connection of a trace.
+type TraceConn struct {
+	Start    time.Time
+	Duration time.Duration
+	Backend  string // server the connection went to, if any
+	Bytes    int64  // in + out
+}
+
+// SimServer is the load one server received in a simulation.
+type SimServer struct {
+	Address     string
+	Weight      int
+	Connections int
+	Share       float64 // of all connections
+	Bytes       int64
+	Peak        int // most connections open at once
+}
+
+// SimReport is the outcome of replaying a trace through one balancer.
+type SimReport struct {
+	Algorithm   string
+	Connections int
+	Failed      int // connections the balancer had no server for
+	Servers     []SimServer
+	// Fairness is Jain's index of the connections per unit of weight: 1 when
+	// every server got exactly its share, 1/n when one server got everything.
+	Fairness float64
+	// PeakFairness is the same index over the peak concurrent connections.
+	PeakFairness float64
+}
+
+// RunLB implements `nvelox lb <command>`.
+func RunLB(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "simulate" {
+		return fmt.Errorf("usage: nvelox lb simulate -trace <file> [-algo name|all] [-servers addr[=weight],...]")
+	}
+	return runSimulate(args[1:], out)
+}
+
+func runSimulate(args []string, out io.Writer) error {
+	fs := newFlagSet("lb simulate", out)
+	algo := fs.String("algo", "all", "Balancer to simulate: "+strings.Join(simulateAlgorithms, ", ")+" or all")
+	servers := fs.String("servers", "", "Comma-separated servers, addr or addr=weight (default: the servers found in the trace)")
+	tracePath := fs.String("trace", "", "Access log to replay (text or JSON lines)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tracePath == "" {
+		return fmt.Errorf("lb simulate: -trace is required")
+	}
+
+	f, err := os.Open(*tracePath)
+	if err != nil {
+		return fmt.Errorf("lb simulate: %w", err)
+	}
+	trace, skipped, err := ReadTrace(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("lb simulate: %w", err)
+	}
+	if len(trace) == 0 {
+		return fmt.Errorf("lb simulate: no connections in %s", *tracePath)
+	}
+
+	var pool []lb.Server
+	if *servers != "" {
+		if pool, err = parseSimServers(*servers); err != nil {
+			return fmt.Errorf("lb simulate: %w", err)
+		}
+	} else {
+		pool = traceServers(trace)
+		if len(pool) == 0 {
+			return fmt.Errorf("lb simulate: the trace names no servers, use -servers")
+		}
+	}
+
+	algos := []string{*algo}
+	if *algo == "all" {
+		algos = simulateAlgorithms
+	} else if !slices.Contains(simulateAlgorithms, *algo) {
+		return fmt.Errorf("lb simulate: unknown algorithm %q", *algo)
+	}
+
+	fmt.Fprintf(out, "replaying %d connections over %s through %d servers", len(trace), traceSpan(trace), len(pool))
+	if skipped > 0 {
+		fmt.Fprintf(out, " (%d lines skipped)", skipped)
+	}
+	fmt.Fprintln(out)
+	for _, a := range algos {
+		printSimReport(out, Simulate(a, pool, trace))
+	}
+	return nil
+}
+
+// Simulate replays trace through a fresh balancer: each connection is placed
+// at its start and released after its duration, so leastconn sees the same
+// concurrency production did.
+func Simulate(algorithm string, servers []lb.Server, trace []TraceConn) SimReport {
+	pool := lb.NewPool(algorithm, servers)
+	report := SimReport{Algorithm: algorithm, Connections: len(trace)}
+	index := make(map[string]int, len(servers))
+	for _, s := range servers {
+		index[s.Address] = len(report.Servers)
+		report.Servers = append(report.Servers, SimServer{Address: s.Address, Weight: s.Weight})
+	}
+
+	open := make([]int, len(servers))
+	ends := &endHeap{}
+	for _, c := range trace {
+		for ends.Len() > 0 && !(*ends)[0].at.After(c.Start) {
+			e := heap.Pop(ends).(simEnd)
+			pool.OnDisconnect(e.server)
+			open[index[e.server]]--
+		}
+		server, err := pool.Next()
+		if err != nil {
+			report.Failed++
+			continue
+		}
+		pool.OnConnect(server)
+		i := index[server]
+		open[i]++
+		s := &report.Servers[i]
+		s.Connections++
+		s.Bytes += c.Bytes
+		s.Peak = max(s.Peak, open[i])
+		heap.Push(ends, simEnd{at: c.Start.Add(c.Duration), server: server})
+	}
+
+	conns := make([]float64, 0, len(report.Servers))
+	peaks := make([]float64, 0, len(report.Servers))
+	for i := range report.Servers {
+		s := &report.Servers[i]
+		s.Share = float64(s.Connections) / float64(len(trace))
+		if s.Weight > 0 {
+			conns = append(conns, float64(s.Connections)/float64(s.Weight))
+			peaks = append(peaks, float64(s.Peak)/float64(s.Weight))
+		}
+	}
+	report.Fairness = jain(conns)
+	report.PeakFairness = jain(peaks)
+	return report
+}
+
+// jain returns Jain's fairness index of xs.
+func jain(xs []float64) float64 {
+	var sum, squares float64
+	for _, x := range xs {
+		sum += x
+		squares += x * x
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(xs)) * squares)
+}
+
+func printSimReport(out io.Writer, r SimReport) {
+	fmt.Fprintf(out, "\n%s: fairness %.3f, peak fairness %.3f", r.Algorithm, r.Fairness, r.PeakFairness)
+	if r.Failed > 0 {
+		fmt.Fprintf(out, ", %d connections without a server", r.Failed)
+	}
+	fmt.Fprintln(out)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tWEIGHT\tCONNS\tSHARE\tPEAK\tBYTES")
+	for _, s := range r.Servers {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%d\t%d\n", s.Address, s.Weight, s.Connections, s.Share*100, s.Peak, s.Bytes)
+	}
+	tw.Flush()
+}
+
+// ReadTrace parses an access log, one entry per line in the text format of
+// access_log or as JSON (webhook sink). Entries rejected before a backend
+// was picked are left out; the second result counts the lines skipped. The
+// connections are returned ordered by start.
+func ReadTrace(r io.Reader) ([]TraceConn, int, error) {
+	trace := make([]TraceConn, 0)
+	skipped := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		e, ok := parseAccessLine(line)
+		if !ok || !reachedBalancer(e.Status) {
+			skipped++
+			continue
+		}
+		trace = append(trace, TraceConn{Start: e.Time, Duration: e.Duration, Backend: e.Backend, Bytes: e.BytesIn + e.BytesOut})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(trace, func(i, j int) bool { return trace[i].Start.Before(trace[j].Start) })
+	return trace, skipped, nil
+}
+
+// parseAccessLine reads a line written by logging.AccessEntry.String or its
+// JSON encoding.
+func parseAccessLine(line string) (logging.AccessEntry, bool) {
+	var e logging.AccessEntry
+	if strings.HasPrefix(line, "{") {
+		return e, json.Unmarshal([]byte(line), &e) == nil && !e.Time.IsZero()
+	}
+
+	// time listener client -> backend status in=N out=N dur=D [select=D dial=D connect=D ja3=.. ja4=..]
+	f := strings.Split(line, " ")
+	if len(f) < 9 || f[3] != "->" {
+		return e, false
+	}
+	var err error
+	if e.Time, err = time.Parse(time.RFC3339, f[0]); err != nil {
+		return e, false
+	}
+	e.Listener, e.Client, e.Backend, e.Status = f[1], f[2], f[4], f[5]
+	for _, kv := range f[6:] {
+		k, v, _ := strings.Cut(kv, "=")
+		switch k {
+		case "in":
+			e.BytesIn, err = logging.ParseSize(v)
+		case "out":
+			e.BytesOut, err = logging.ParseSize(v)
+		case "dur":
+			e.Duration, err = time.ParseDuration(v)
+		}
+		if err != nil {
+			return e, false
+		}
+	}
+	return e, true
+}
+
+// reachedBalancer reports whether a connection with status was placed on a
+// server, or would have been but for the failed dial.
+func reachedBalancer(status string) bool {
+	switch status {
+	case core.StatusShed, core.StatusRateLimited, core.StatusDraining, core.StatusDependencyDown, core.StatusProxyError,
+		core.StatusPreauthFail, core.StatusKnock:
+		return false
+	}
+	return true
+}
+
+// traceServers returns the servers named in a trace, each with the default
+// weight.
+func traceServers(trace []TraceConn) []lb.Server {
+	seen := make(map[string]bool)
+	out := make([]lb.Server, 0)
+	for _, c := range trace {
+		if c.Backend == "" || seen[c.Backend] {
+			continue
+		}
+		seen[c.Backend] = true
+		out = append(out, lb.Server{Address: c.Backend, Weight: lb.DefaultWeight})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
+
+// parseSimServers parses "addr,addr=weight,...".
+func parseSimServers(s string) ([]lb.Server, error) {
+	out := make([]lb.Server, 0)
+	for _, part := range strings.Split(s, ",") {
+		addr, weight, hasWeight := strings.Cut(strings.TrimSpace(part), "=")
+		if addr == "" {
+			return nil, fmt.Errorf("empty server in %q", s)
+		}
+		srv := lb.Server{Address: addr, Weight: lb.DefaultWeight}
+		if hasWeight {
+			w, err := strconv.Atoi(weight)
+			if err != nil || w < 0 || w > 256 {
+				return nil, fmt.Errorf("invalid weight %q for %s", weight, addr)
+			}
+			srv.Weight = w
+		}
+		out = append(out, srv)
+	}
+	return out, nil
+}
+
+func traceSpan(trace []TraceConn) time.Duration {
+	return trace[len(trace)-1].Start.Sub(trace[0].Start)
+}
+
+// simEnd is the end of a simulated connection.
+type simEnd struct {
+	at     time.Time
+	server string
+}
+
+// endHeap orders connection ends by time.
+type endHeap []simEnd
+
+func (h endHeap) Len() int           { return len(h) }
+func (h endHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h endHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *endHeap) Push(x any)        { *h = append(*h, x.(simEnd)) }
+func (h *endHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,94 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nvelox/lb"
+)
+
+const testTrace = `2026-10-15T10:00:00Z web 1.1.1.1:1 -> 10.0.0.1:80 OK in=10 out=100 dur=1m0s
+2026-10-15T10:00:02Z web 1.1.1.1:3 -> 10.0.0.1:80 OK in=1 out=2 dur=1.5s select=8µs dial=1ms connect=1.1ms
+2026-10-15T10:00:01Z web 1.1.1.1:2 -> 10.0.0.2:80 TIMEOUT in=5B out=5B dur=1000.000ms ja3=abc
+2026-10-15T10:00:03Z web 1.1.1.1:4 ->  SHED in=0 out=0 dur=102µs
+{"time":"2026-10-15T10:00:04Z","listener":"web","client":"1.1.1.1:5","backend":"10.0.0.2:80","status":"OK","bytes_in":1,"bytes_out":2,"duration":5000000000}
+not an access log line
+`
+
+func TestReadTrace(t *testing.T) {
+	trace, skipped, err := ReadTrace(strings.NewReader(testTrace))
+	if err != nil {
+		t.Fatalf("ReadTrace failed: %v", err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+	if len(trace) != 4 {
+		t.Fatalf("got %d connections, want 4", len(trace))
+	}
+	if c := trace[1]; c.Backend != "10.0.0.2:80" || c.Duration != time.Second || c.Bytes != 10 {
+		t.Errorf("trace not ordered by start or misparsed: %+v", c)
+	}
+	if c := trace[3]; c.Duration != 5*time.Second || c.Bytes != 3 {
+		t.Errorf("JSON entry misparsed: %+v", c)
+	}
+	if servers := traceServers(trace); len(servers) != 2 || servers[0].Address != "10.0.0.1:80" {
+		t.Errorf("traceServers = %+v", servers)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// One long session, then short ones that each end before the next starts
+	start := time.Unix(0, 0)
+	trace := []TraceConn{{Start: start, Duration: time.Hour}}
+	for i := 1; i <= 6; i++ {
+		trace = append(trace, TraceConn{Start: start.Add(time.Duration(i) * time.Minute), Duration: time.Second, Bytes: 1})
+	}
+	servers := []lb.Server{{Address: "a", Weight: 1}, {Address: "b", Weight: 1}}
+
+	rr := Simulate("roundrobin", servers, trace)
+	if rr.Servers[0].Connections != 4 || rr.Servers[1].Connections != 3 {
+		t.Errorf("roundrobin distribution = %+v", rr.Servers)
+	}
+	if rr.Fairness >= 1 || rr.Servers[0].Peak != 2 {
+		t.Errorf("roundrobin fairness %.3f, peak of a %d", rr.Fairness, rr.Servers[0].Peak)
+	}
+
+	// leastconn keeps the short sessions off the busy server
+	lc := Simulate("leastconn", servers, trace)
+	if lc.Servers[0].Connections != 1 || lc.Servers[1].Connections != 6 || lc.PeakFairness != 1 {
+		t.Errorf("leastconn distribution = %+v, peak fairness %.3f", lc.Servers, lc.PeakFairness)
+	}
+
+	weighted := Simulate("roundrobin", []lb.Server{{Address: "a", Weight: 2}, {Address: "b", Weight: 1}}, trace[1:])
+	if weighted.Servers[0].Connections != 4 || weighted.Fairness != 1 {
+		t.Errorf("weighted distribution = %+v, fairness %.3f", weighted.Servers, weighted.Fairness)
+	}
+}
+
+func TestRunLB_Simulate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	os.WriteFile(path, []byte(testTrace), 0644)
+
+	var out bytes.Buffer
+	if err := RunLB(context.Background(), []string{"simulate", "-trace", path, "-algo", "leastconn", "-servers", "10.0.0.1:80=2,10.0.0.3:80"}, &out); err != nil {
+		t.Fatalf("simulate failed: %v", err)
+	}
+	for _, want := range []string{"replaying 4 connections", "(2 lines skipped)", "leastconn: fairness", "10.0.0.3:80"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := RunLB(context.Background(), []string{"simulate", "-trace", path, "-algo", "fastest"}, &out); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+	if err := RunLB(context.Background(), []string{"simulate", "-trace", path, "-servers", "a=300"}, &out); err == nil {
+		t.Error("expected error for invalid weight")
+	}
+}
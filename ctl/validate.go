@@ -0,0 +1,236 @@
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nvelox/config"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// validateDebounce is how long watch mode waits for further changes before
+// validating again, so a checkout touching many files is checked once.
+const validateDebounce = 500 * time.Millisecond
+
+// ValidateReport is the outcome of checking every configuration in a directory.
+type ValidateReport struct {
+	OK        bool         `json:"ok"`
+	CheckedAt time.Time    `json:"checked_at"`
+	Files     []FileResult `json:"files"`
+}
+
+// RunValidate implements `nvelox validate [flags] <dir>`. It checks every
+// configuration file in dir like `nvelox check` and fails if any has a
+// problem. With -watch it keeps running, checks again whenever the directory
+// changes and fails on exit if the last check did; -listen serves the latest
+// report over HTTP.
+func RunValidate(ctx context.Context, args []string, out io.Writer) error {
+	fs := newFlagSet("validate", out)
+	watch := fs.Bool("watch", false, "Keep running and validate again on every change")
+	listen := fs.String("listen", "", "Serve the latest report over HTTP on this address (with -watch)")
+	strictConfig := fs.Bool("strict-config", false, "Reject unknown configuration keys and a missing version")
+	allowUnknown := fs.String("allow-unknown", "", "Comma-separated keys tolerated by -strict-config (\"prefix*\" allowed)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: nvelox validate [-watch] [-listen addr] <dir>")
+	}
+	dir := fs.Arg(0)
+
+	opts := config.LoadOptions{Strict: *strictConfig}
+	if *allowUnknown != "" {
+		opts.AllowUnknown = strings.Split(*allowUnknown, ",")
+	}
+
+	if !*watch {
+		report := ValidateDir(ctx, dir, opts)
+		printReport(out, report)
+		return reportErr(report)
+	}
+
+	v := &validator{}
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+		srv := &http.Server{Handler: v}
+		go srv.Serve(l)
+		defer srv.Close()
+		fmt.Fprintf(out, "serving validation results on http://%s/\n", l.Addr())
+	}
+	return reportErr(v.watch(ctx, dir, opts, out))
+}
+
+// ValidateDir checks the configuration files (.yaml, .yml, .json, .toml) in
+// dir. Files included by another file in dir are checked as part of it
+// rather than on their own.
+func ValidateDir(ctx context.Context, dir string, opts config.LoadOptions) ValidateReport {
+	report := ValidateReport{OK: true, CheckedAt: time.Now(), Files: make([]FileResult, 0)}
+	files, err := configFiles(dir)
+	if err != nil {
+		report.OK = false
+		report.Files = append(report.Files, FileResult{Path: dir, Errors: []string{err.Error()}})
+		return report
+	}
+
+	included := make(map[string]bool)
+	for _, f := range files {
+		lopts := opts
+		lopts.SkipValidation = true
+		cfg, err := config.LoadWithOptions(f, lopts)
+		if err != nil {
+			continue
+		}
+		self, _ := filepath.Abs(f)
+		matches, _ := cfg.Include.Files()
+		for _, m := range matches {
+			if abs, err := filepath.Abs(m); err == nil && abs != self {
+				included[abs] = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil && included[abs] {
+			continue
+		}
+		res := checkFile(ctx, f, opts)
+		report.OK = report.OK && res.OK
+		report.Files = append(report.Files, res)
+	}
+	return report
+}
+
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json", ".toml":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// printReport writes a report in the format of `nvelox check`.
+func printReport(out io.Writer, report ValidateReport) {
+	for _, f := range report.Files {
+		for _, w := range f.Warnings {
+			fmt.Fprintf(out, "%s: warning: %s\n", f.Path, w)
+		}
+		for _, e := range f.Errors {
+			fmt.Fprintf(out, "%s: error: %s\n", f.Path, e)
+		}
+		if f.OK {
+			fmt.Fprintf(out, "%s: ok\n", f.Path)
+		}
+	}
+}
+
+func reportErr(report ValidateReport) error {
+	if report.OK {
+		return nil
+	}
+	failed := 0
+	for _, f := range report.Files {
+		if !f.OK {
+			failed++
+		}
+	}
+	return fmt.Errorf("validate: %d of %d configuration files have problems", failed, len(report.Files))
+}
+
+// validator holds the latest report of watch mode and serves it over HTTP.
+type validator struct {
+	mu     sync.Mutex
+	report *ValidateReport
+}
+
+func (v *validator) set(report ValidateReport) {
+	v.mu.Lock()
+	v.report = &report
+	v.mu.Unlock()
+}
+
+// ServeHTTP answers with the latest report: 200 when every file is valid,
+// 422 when any has a problem and 503 before the first check finished.
+func (v *validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	report := v.report
+	v.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case report == nil:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "validation pending"})
+		return
+	case report.OK:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// watch validates dir, then again after every change, until ctx is done.
+// It returns the last report.
+func (v *validator) watch(ctx context.Context, dir string, opts config.LoadOptions, out io.Writer) ValidateReport {
+	publish := func(report ValidateReport) ValidateReport {
+		printReport(out, report)
+		v.set(report)
+		return report
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer w.Close()
+		err = w.Add(dir)
+	}
+	if err != nil {
+		return publish(ValidateReport{CheckedAt: time.Now(), Files: []FileResult{{Path: dir, Errors: []string{fmt.Sprintf("failed to watch: %v", err)}}}})
+	}
+
+	last := publish(ValidateDir(ctx, dir, opts))
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return last
+		case _, ok := <-w.Events:
+			if !ok {
+				return last
+			}
+			debounce = time.After(validateDebounce)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return last
+			}
+			fmt.Fprintf(out, "%s: watch error: %v\n", dir, err)
+			debounce = time.After(validateDebounce)
+		case <-debounce:
+			debounce = nil
+			last = publish(ValidateDir(ctx, dir, opts))
+		}
+	}
+}
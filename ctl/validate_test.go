@@ -0,0 +1,82 @@
+package ctl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nvelox/config"
+)
+
+func TestValidateDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.yaml"), []byte("version: '2'\ninclude: "+filepath.Join(dir, "part-*.yaml")+"\nlisteners:\n  - name: web\n    bind: '127.0.0.1:8080'\n    default_backend: web\n"), 0644)
+	// Valid only as part of main.yaml, so not checked on its own
+	os.WriteFile(filepath.Join(dir, "part-web.yaml"), []byte("backends:\n  - name: web\n    servers: ['10.0.0.1:80']\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"version": "2", "listeners": [{"name": "a", "bind": "127.0.0.1:81", "default_backend": "missing"}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a config"), 0644)
+
+	report := ValidateDir(context.Background(), dir, config.LoadOptions{})
+	if report.OK || len(report.Files) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if f := report.Files[0]; filepath.Base(f.Path) != "main.yaml" || !f.OK {
+		t.Errorf("main.yaml: %+v", f)
+	}
+	if f := report.Files[1]; filepath.Base(f.Path) != "other.json" || f.OK || len(f.Errors) != 1 {
+		t.Errorf("other.json: %+v", f)
+	}
+	if err := reportErr(report); err == nil || err.Error() != "validate: 1 of 2 configuration files have problems" {
+		t.Errorf("reportErr = %v", err)
+	}
+}
+
+func TestValidator_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvelox.yaml")
+	os.WriteFile(path, []byte("version: '2'\n"), 0644)
+
+	v := &validator{}
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	status := func() int {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(); code != http.StatusServiceUnavailable {
+		t.Errorf("status before first check = %d", code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan ValidateReport)
+	go func() { done <- v.watch(ctx, dir, config.LoadOptions{}, io.Discard) }()
+
+	waitStatus := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for status() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("status never became %d", want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitStatus(http.StatusOK)
+
+	os.WriteFile(path, []byte("version: '4'\n"), 0644)
+	waitStatus(http.StatusUnprocessableEntity)
+
+	cancel()
+	if report := <-done; report.OK {
+		t.Error("expected the last report to fail")
+	}
+}
@@ -2,9 +2,13 @@ package integration
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -82,7 +86,7 @@ func TestEndToEndTCP(t *testing.T) {
 		Backends: []config.Backend{
 			{
 				Name:    "backend1",
-				Servers: []string{backendAddr},
+				Servers: []config.Server{{Address: backendAddr}},
 			},
 		},
 	}
@@ -187,7 +191,7 @@ func TestEndToEndUDP(t *testing.T) {
 		Backends: []config.Backend{
 			{
 				Name:    "backend-udp",
-				Servers: []string{backendAddr},
+				Servers: []config.Server{{Address: backendAddr}},
 			},
 		},
 	}
@@ -239,3 +243,178 @@ func TestEndToEndUDP(t *testing.T) {
 		t.Errorf("Expected %q, got %q", msg, string(buf[:n]))
 	}
 }
+
+// startDualEchoServer echoes TCP and UDP on the same port, like a DNS server.
+func startDualEchoServer(t *testing.T) string {
+	for i := 0; i < 10; i++ {
+		addr := startEchoServer(t)
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			continue // port taken for UDP, try another one
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 2048)
+			for {
+				n, remote, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				conn.WriteTo(buf[:n], remote)
+			}
+		}()
+		return addr
+	}
+	t.Fatalf("failed to start tcp+udp echo server")
+	return ""
+}
+
+func TestEndToEndTCPAndUDP(t *testing.T) {
+	backendAddr := startDualEchoServer(t)
+	proxyPort := getFreePort(t)
+
+	cfg := &config.Config{
+		Backends: []config.Backend{
+			{
+				Name:    "dns",
+				Servers: []config.Server{{Address: backendAddr}},
+			},
+		},
+	}
+
+	listeners, err := core.ExpandListener(config.Listener{
+		Name:           "dns",
+		Bind:           config.Binds{fmt.Sprintf("127.0.0.1:%d", proxyPort)},
+		Protocol:       "tcp+udp",
+		DefaultBackend: "dns",
+	})
+	if err != nil {
+		t.Fatalf("ExpandListener: %v", err)
+	}
+	engine := core.NewEngine(cfg)
+	engine.Listeners = listeners
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		engine.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	waitForPort(t, proxyPort)
+
+	for _, network := range []string{"tcp", "udp"} {
+		conn, err := net.Dial(network, fmt.Sprintf("127.0.0.1:%d", proxyPort))
+		if err != nil {
+			t.Fatalf("Failed to dial proxy over %s: %v", network, err)
+		}
+		defer conn.Close()
+
+		msg := "Hello Nvelox " + network
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatalf("Failed to write over %s: %v", network, err)
+		}
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to read over %s: %v", network, err)
+		}
+		if string(buf[:n]) != msg {
+			t.Errorf("%s: expected %q, got %q", network, msg, string(buf[:n]))
+		}
+	}
+}
+
+func TestEndToEndSessionEvents(t *testing.T) {
+	backendAddr := startEchoServer(t)
+	proxyPort := getFreePort(t)
+
+	var mu sync.Mutex
+	var events []core.SessionEvent
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b core.SessionBatch
+		json.NewDecoder(r.Body).Decode(&b)
+		mu.Lock()
+		events = append(events, b.Events...)
+		mu.Unlock()
+	}))
+	defer broker.Close()
+
+	cfg := &config.Config{
+		SessionEvents: config.SessionEventsConfig{URL: broker.URL, FlushInterval: "10ms"},
+		Backends: []config.Backend{
+			{
+				Name:    "game",
+				Servers: []config.Server{{Address: backendAddr}},
+			},
+		},
+	}
+	engine := core.NewEngine(cfg)
+	engine.Listeners = []*core.ListenerConfig{
+		{
+			Name:           "game-tcp",
+			Protocol:       "tcp",
+			Addr:           fmt.Sprintf("127.0.0.1:%d", proxyPort),
+			Port:           proxyPort,
+			DefaultBackend: "game",
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		engine.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	waitForPort(t, proxyPort)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", proxyPort))
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	conn.Close()
+
+	// waitForPort opened and closed a connection before the backend could be dialed
+	var open, closed *core.SessionEvent
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && closed == nil {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		for i := range events {
+			ev := events[i]
+			if ev.Type == core.SessionClose && ev.BytesIn == 4 {
+				closed = &ev
+			}
+		}
+		if closed != nil {
+			for i := range events {
+				if ev := events[i]; ev.Type == core.SessionOpen && ev.ID == closed.ID {
+					open = &ev
+				}
+			}
+		}
+		mu.Unlock()
+	}
+	if closed == nil || open == nil {
+		t.Fatalf("missing session events: %+v", events)
+	}
+	if open.Listener != "game-tcp" || open.Backend != "game" || open.Server != backendAddr || open.Protocol != "tcp" {
+		t.Errorf("unexpected open event: %+v", open)
+	}
+	if closed.Status == "" || closed.BytesOut != 4 || closed.Client != open.Client {
+		t.Errorf("unexpected close event: %+v", closed)
+	}
+}
@@ -0,0 +1,147 @@
+package lb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyAlpha is the EWMA smoothing factor for observed latencies.
+	latencyAlpha = 0.3
+	// latencyBaseWeight is the effective weight of the fastest server.
+	latencyBaseWeight = 100
+	// minLatencyFactor bounds how far a slow server's weight can drop,
+	// so it keeps receiving enough traffic to recover its score.
+	minLatencyFactor = 0.1
+)
+
+// LatencyObserver is implemented by balancers that adapt to backend latency.
+type LatencyObserver interface {
+	// ObserveLatency records a time-to-first-byte sample for a server.
+	ObserveLatency(server string, d time.Duration)
+}
+
+// LatencyWeighted is a smooth weighted round robin whose effective weights
+// follow the time-to-first-byte EWMA of each server. The fastest server gets
+// the full weight; slower servers are scaled down proportionally, bounded by
+// minLatencyFactor. Servers without samples keep the full weight.
+type LatencyWeighted struct {
+	allServers []string
+	status     map[string]bool
+
+	mu      sync.Mutex
+	healthy []string
+	weights map[string]int     // administrative weights, scaling the latency weight
+	ewma    map[string]float64 // server -> EWMA latency in nanoseconds
+	current map[string]float64 // smooth WRR running weights
+}
+
+func NewLatencyWeighted(servers []string) *LatencyWeighted {
+	all := make([]string, len(servers))
+	copy(all, servers)
+
+	status := make(map[string]bool)
+	for _, s := range all {
+		status[s] = true
+	}
+
+	return &LatencyWeighted{
+		allServers: all,
+		status:     status,
+		healthy:    all,
+		weights:    make(map[string]int),
+		ewma:       make(map[string]float64),
+		current:    make(map[string]float64),
+	}
+}
+
+func (b *LatencyWeighted) Next() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.healthy) == 0 {
+		return "", errors.New("no healthy backends available")
+	}
+
+	best := ""
+	total := 0.0
+	for _, s := range b.healthy {
+		w := b.weightLocked(s) * float64(weightOf(b.weights, s))
+		total += w
+		b.current[s] += w
+		if best == "" || b.current[s] > b.current[best] {
+			best = s
+		}
+	}
+	b.current[best] -= total
+	return best, nil
+}
+
+// EffectiveWeight returns the current latency-adjusted weight of a server.
+func (b *LatencyWeighted) EffectiveWeight(server string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.weightLocked(server)
+}
+
+func (b *LatencyWeighted) weightLocked(server string) float64 {
+	lat, ok := b.ewma[server]
+	if !ok || lat <= 0 {
+		return latencyBaseWeight
+	}
+
+	fastest := lat
+	for _, s := range b.healthy {
+		if v, ok := b.ewma[s]; ok && v > 0 && v < fastest {
+			fastest = v
+		}
+	}
+
+	factor := fastest / lat
+	if factor < minLatencyFactor {
+		factor = minLatencyFactor
+	}
+	return latencyBaseWeight * factor
+}
+
+func (b *LatencyWeighted) ObserveLatency(server string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sample := float64(d)
+	if prev, ok := b.ewma[server]; ok {
+		b.ewma[server] = latencyAlpha*sample + (1-latencyAlpha)*prev
+	} else {
+		b.ewma[server] = sample
+	}
+}
+
+func (b *LatencyWeighted) UpdateStatus(server string, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.status[server] = healthy
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+}
+
+func (b *LatencyWeighted) SetWeight(server string, weight int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := checkWeight(b.status, server, weight); err != nil {
+		return err
+	}
+	b.weights[server] = weight
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+	return nil
+}
+
+func (b *LatencyWeighted) Weight(server string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return weightOf(b.weights, server)
+}
+
+func (b *LatencyWeighted) OnConnect(server string)    {}
+func (b *LatencyWeighted) OnDisconnect(server string) {}
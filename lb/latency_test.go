@@ -0,0 +1,62 @@
+package lb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyWeighted_EvenWithoutSamples(t *testing.T) {
+	b := NewBalancer("latency", []string{"s1", "s2"})
+
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		s, err := b.Next()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts[s]++
+	}
+	if counts["s1"] != 50 || counts["s2"] != 50 {
+		t.Errorf("expected even split, got %v", counts)
+	}
+}
+
+func TestLatencyWeighted_FavoursFastServer(t *testing.T) {
+	b := NewLatencyWeighted([]string{"fast", "slow"})
+	b.ObserveLatency("fast", 10*time.Millisecond)
+	b.ObserveLatency("slow", 40*time.Millisecond)
+
+	if w := b.EffectiveWeight("slow"); w != latencyBaseWeight/4 {
+		t.Errorf("expected slow weight %v, got %v", latencyBaseWeight/4, w)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 125; i++ {
+		s, _ := b.Next()
+		counts[s]++
+	}
+	if counts["fast"] != 100 || counts["slow"] != 25 {
+		t.Errorf("expected 100/25 split, got %v", counts)
+	}
+}
+
+func TestLatencyWeighted_Bounded(t *testing.T) {
+	b := NewLatencyWeighted([]string{"fast", "glacial"})
+	b.ObserveLatency("fast", time.Millisecond)
+	b.ObserveLatency("glacial", time.Second)
+
+	if w := b.EffectiveWeight("glacial"); w != latencyBaseWeight*minLatencyFactor {
+		t.Errorf("expected weight floor %v, got %v", latencyBaseWeight*minLatencyFactor, w)
+	}
+}
+
+func TestLatencyWeighted_EWMA(t *testing.T) {
+	b := NewLatencyWeighted([]string{"s1"})
+	b.ObserveLatency("s1", 100*time.Millisecond)
+	b.ObserveLatency("s1", 200*time.Millisecond)
+
+	want := latencyAlpha*float64(200*time.Millisecond) + (1-latencyAlpha)*float64(100*time.Millisecond)
+	if got := b.ewma["s1"]; got != want {
+		t.Errorf("expected EWMA %v, got %v", want, got)
+	}
+}
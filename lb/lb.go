@@ -32,6 +32,8 @@ func NewBalancer(algorithm string, servers []string) Balancer {
 		return NewLeastConn(servers)
 	case "random":
 		return NewRandom(servers)
+	case "latency":
+		return NewLatencyWeighted(servers)
 	default:
 		return NewRoundRobin(servers)
 	}
@@ -45,6 +47,11 @@ type RoundRobin struct {
 	mu      sync.RWMutex
 	healthy []string // Derived active list
 	current uint64
+	weights map[string]int
+
+	// Smooth weighted round robin state, used once weights differ
+	swrrMu sync.Mutex
+	swrr   map[string]int
 }
 
 func NewRoundRobin(servers []string) *RoundRobin {
@@ -62,6 +69,8 @@ func NewRoundRobin(servers []string) *RoundRobin {
 		allServers: all,
 		status:     status,
 		healthy:    all, // Initial healthy list is full list
+		weights:    make(map[string]int),
+		swrr:       make(map[string]int),
 	}
 }
 
@@ -73,11 +82,34 @@ func (b *RoundRobin) Next() (string, error) {
 		return "", errors.New("no healthy backends available")
 	}
 
+	if !uniformWeights(b.healthy, b.weights) {
+		return b.nextWeighted(), nil
+	}
+
 	next := atomic.AddUint64(&b.current, 1)
 	idx := (next - 1) % uint64(len(b.healthy))
 	return b.healthy[idx], nil
 }
 
+// nextWeighted picks by smooth weighted round robin. Callers hold b.mu.
+func (b *RoundRobin) nextWeighted() string {
+	b.swrrMu.Lock()
+	defer b.swrrMu.Unlock()
+
+	best := ""
+	total := 0
+	for _, s := range b.healthy {
+		w := weightOf(b.weights, s)
+		total += w
+		b.swrr[s] += w
+		if best == "" || b.swrr[s] > b.swrr[best] {
+			best = s
+		}
+	}
+	b.swrr[best] -= total
+	return best
+}
+
 func (b *RoundRobin) UpdateStatus(server string, healthy bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -85,13 +117,25 @@ func (b *RoundRobin) UpdateStatus(server string, healthy bool) {
 	b.status[server] = healthy
 
 	// Rebuild healthy list preserving order
-	active := make([]string, 0, len(b.allServers))
-	for _, s := range b.allServers {
-		if b.status[s] {
-			active = append(active, s)
-		}
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+}
+
+func (b *RoundRobin) SetWeight(server string, weight int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := checkWeight(b.status, server, weight); err != nil {
+		return err
 	}
-	b.healthy = active
+	b.weights[server] = weight
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+	return nil
+}
+
+func (b *RoundRobin) Weight(server string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return weightOf(b.weights, server)
 }
 
 func (b *RoundRobin) OnConnect(server string)    {}
@@ -104,6 +148,7 @@ type Random struct {
 
 	mu      sync.RWMutex
 	healthy []string
+	weights map[string]int
 
 	rnd *rand.Rand
 }
@@ -121,6 +166,7 @@ func NewRandom(servers []string) *Random {
 		allServers: all,
 		status:     status,
 		healthy:    all,
+		weights:    make(map[string]int),
 		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
@@ -132,7 +178,22 @@ func (b *Random) Next() (string, error) {
 	if len(b.healthy) == 0 {
 		return "", errors.New("no healthy backends available")
 	}
-	return b.healthy[b.rnd.Intn(len(b.healthy))], nil
+	if uniformWeights(b.healthy, b.weights) {
+		return b.healthy[b.rnd.Intn(len(b.healthy))], nil
+	}
+
+	total := 0
+	for _, s := range b.healthy {
+		total += weightOf(b.weights, s)
+	}
+	n := b.rnd.Intn(total)
+	for _, s := range b.healthy {
+		n -= weightOf(b.weights, s)
+		if n < 0 {
+			return s, nil
+		}
+	}
+	return b.healthy[len(b.healthy)-1], nil
 }
 
 func (b *Random) UpdateStatus(server string, healthy bool) {
@@ -140,14 +201,25 @@ func (b *Random) UpdateStatus(server string, healthy bool) {
 	defer b.mu.Unlock()
 
 	b.status[server] = healthy
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+}
 
-	active := make([]string, 0, len(b.allServers))
-	for _, s := range b.allServers {
-		if b.status[s] {
-			active = append(active, s)
-		}
+func (b *Random) SetWeight(server string, weight int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := checkWeight(b.status, server, weight); err != nil {
+		return err
 	}
-	b.healthy = active
+	b.weights[server] = weight
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+	return nil
+}
+
+func (b *Random) Weight(server string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return weightOf(b.weights, server)
 }
 
 func (r *Random) OnConnect(server string)    {}
@@ -160,6 +232,7 @@ type LeastConn struct {
 
 	mu      sync.RWMutex
 	healthy []string
+	weights map[string]int
 
 	conns map[string]int64 // map[server_addr]count
 }
@@ -179,6 +252,7 @@ func NewLeastConn(servers []string) *LeastConn {
 		allServers: all,
 		status:     status,
 		healthy:    all,
+		weights:    make(map[string]int),
 		conns:      conns,
 	}
 }
@@ -196,7 +270,8 @@ func (b *LeastConn) Next() (string, error) {
 
 	for _, s := range b.healthy[1:] {
 		c := b.conns[s]
-		if c < min {
+		// Compare connections per unit of weight: c/w < min/w(best)
+		if c*int64(weightOf(b.weights, best)) < min*int64(weightOf(b.weights, s)) {
 			best = s
 			min = c
 		}
@@ -215,14 +290,25 @@ func (b *LeastConn) UpdateStatus(server string, healthy bool) {
 	defer b.mu.Unlock()
 
 	b.status[server] = healthy
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+}
 
-	active := make([]string, 0, len(b.allServers))
-	for _, s := range b.allServers {
-		if b.status[s] {
-			active = append(active, s)
-		}
+func (b *LeastConn) SetWeight(server string, weight int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := checkWeight(b.status, server, weight); err != nil {
+		return err
 	}
-	b.healthy = active
+	b.weights[server] = weight
+	b.healthy = activeServers(b.allServers, b.status, b.weights)
+	return nil
+}
+
+func (b *LeastConn) Weight(server string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return weightOf(b.weights, server)
 }
 
 func (b *LeastConn) OnConnect(server string) {
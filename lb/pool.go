@@ -0,0 +1,212 @@
+package lb
+
+import (
+	"sync"
+	"time"
+)
+
+// Server is a pool member with its configured settings.
+type Server struct {
+	Address  string
+	Weight   int  // initial weight, 0-MaxWeight
+	MaxConns int  // open connections ceiling, 0 = unlimited
+	Backup   bool // selected only while no primary server is available
+	Disabled bool // never selected
+}
+
+// Pool balances over primary servers and falls back to backup servers while
+// no primary is available. Servers at their MaxConns ceiling are taken out
+// of rotation until a connection closes; OnConnect and OnDisconnect must be
+// called around every backend connection for the ceiling to hold.
+type Pool struct {
+	algorithm string
+
+	mu      sync.Mutex
+	primary Balancer
+	backup  Balancer // nil without backup servers
+	members map[string]*member
+}
+
+type member struct {
+	balancer Balancer // primary or backup
+	maxConns int
+	conns    int
+	healthy  bool
+	disabled bool // taken out of rotation at runtime, see SetDisabled
+}
+
+// NewPool creates a pool balancing with the given algorithm. Disabled
+// servers are left out.
+func NewPool(algorithm string, servers []Server) *Pool {
+	p := &Pool{algorithm: algorithm, members: make(map[string]*member)}
+	p.SetServers(servers)
+	return p
+}
+
+// SetServers replaces the members of the pool in place. Servers that stay
+// keep their open connection count, health status and runtime disabling, so
+// connections picked before the change still release their server on close;
+// removed servers are forgotten. Weights are reset to the given ones and latency
+// observations start over.
+func (p *Pool) SetServers(servers []Server) {
+	var primary, backup []string
+	for _, s := range servers {
+		switch {
+		case s.Disabled:
+		case s.Backup:
+			backup = append(backup, s.Address)
+		default:
+			primary = append(primary, s.Address)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.primary = NewBalancer(p.algorithm, primary)
+	p.backup = nil
+	if len(backup) > 0 {
+		p.backup = NewBalancer(p.algorithm, backup)
+	}
+	members := make(map[string]*member, len(servers))
+	for _, s := range servers {
+		if s.Disabled {
+			continue
+		}
+		b := p.primary
+		if s.Backup {
+			b = p.backup
+		}
+		m, ok := p.members[s.Address]
+		if !ok {
+			m = &member{healthy: true}
+		}
+		m.balancer = b
+		m.maxConns = s.MaxConns
+		members[s.Address] = m
+		if s.Weight != DefaultWeight {
+			if w, ok := b.(Weighter); ok {
+				w.SetWeight(s.Address, s.Weight)
+			}
+		}
+		for range m.conns {
+			b.OnConnect(s.Address)
+		}
+		if !m.available() {
+			b.UpdateStatus(s.Address, false)
+		}
+	}
+	p.members = members
+}
+
+func (p *Pool) Next() (string, error) {
+	p.mu.Lock()
+	primary, backup := p.primary, p.backup
+	p.mu.Unlock()
+	s, err := primary.Next()
+	if err != nil && backup != nil {
+		return backup.Next()
+	}
+	return s, err
+}
+
+func (p *Pool) UpdateStatus(server string, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[server]
+	if !ok {
+		return
+	}
+	m.healthy = healthy
+	m.balancer.UpdateStatus(server, m.available())
+}
+
+func (p *Pool) OnConnect(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[server]
+	if !ok {
+		return
+	}
+	m.conns++
+	m.balancer.OnConnect(server)
+	if m.maxConns > 0 && m.conns == m.maxConns {
+		m.balancer.UpdateStatus(server, false)
+	}
+}
+
+func (p *Pool) OnDisconnect(server string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[server]
+	if !ok || m.conns == 0 {
+		return
+	}
+	m.conns--
+	m.balancer.OnDisconnect(server)
+	if m.maxConns > 0 && m.conns == m.maxConns-1 {
+		m.balancer.UpdateStatus(server, m.available())
+	}
+}
+
+// available reports whether the member may take new connections.
+func (m *member) available() bool {
+	return m.healthy && !m.disabled && (m.maxConns == 0 || m.conns < m.maxConns)
+}
+
+// SetDisabled takes a server out of rotation, or puts it back. Its open
+// connections are left alone.
+func (p *Pool) SetDisabled(server string, disabled bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[server]
+	if !ok {
+		return ErrUnknownServer
+	}
+	m.disabled = disabled
+	m.balancer.UpdateStatus(server, m.available())
+	return nil
+}
+
+func (p *Pool) Disabled(server string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[server]
+	return ok && m.disabled
+}
+
+func (p *Pool) SetWeight(server string, weight int) error {
+	p.mu.Lock()
+	b := p.primary
+	if m, ok := p.members[server]; ok {
+		b = m.balancer
+	}
+	p.mu.Unlock()
+	w, ok := b.(Weighter)
+	if !ok {
+		return ErrUnknownServer
+	}
+	return w.SetWeight(server, weight)
+}
+
+func (p *Pool) Weight(server string) int {
+	p.mu.Lock()
+	m, ok := p.members[server]
+	p.mu.Unlock()
+	if ok {
+		if w, ok := m.balancer.(Weighter); ok {
+			return w.Weight(server)
+		}
+	}
+	return DefaultWeight
+}
+
+func (p *Pool) ObserveLatency(server string, d time.Duration) {
+	p.mu.Lock()
+	m, ok := p.members[server]
+	p.mu.Unlock()
+	if ok {
+		if o, ok := m.balancer.(LatencyObserver); ok {
+			o.ObserveLatency(server, d)
+		}
+	}
+}
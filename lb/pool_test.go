@@ -0,0 +1,138 @@
+package lb
+
+import "testing"
+
+func TestPool_Backup(t *testing.T) {
+	p := NewPool("roundrobin", []Server{
+		{Address: "s1", Weight: DefaultWeight},
+		{Address: "b1", Weight: DefaultWeight, Backup: true},
+		{Address: "off", Weight: DefaultWeight, Disabled: true},
+	})
+
+	for i := 0; i < 4; i++ {
+		if s, _ := p.Next(); s != "s1" {
+			t.Fatalf("expected primary, got %s", s)
+		}
+	}
+
+	p.UpdateStatus("s1", false)
+	if s, err := p.Next(); err != nil || s != "b1" {
+		t.Fatalf("expected backup while primary is down, got %s (%v)", s, err)
+	}
+
+	p.UpdateStatus("s1", true)
+	if s, _ := p.Next(); s != "s1" {
+		t.Errorf("expected primary after recovery, got %s", s)
+	}
+	if err := p.SetWeight("off", 1); err == nil {
+		t.Error("expected error for disabled server")
+	}
+}
+
+func TestPool_MaxConns(t *testing.T) {
+	p := NewPool("leastconn", []Server{
+		{Address: "s1", Weight: DefaultWeight, MaxConns: 1},
+		{Address: "s2", Weight: DefaultWeight, MaxConns: 1},
+	})
+
+	first, _ := p.Next()
+	p.OnConnect(first)
+	second, _ := p.Next()
+	p.OnConnect(second)
+	if first == second {
+		t.Fatalf("server %s picked beyond max_conns", first)
+	}
+	if _, err := p.Next(); err == nil {
+		t.Error("expected error with every server at max_conns")
+	}
+
+	p.OnDisconnect(second)
+	if s, err := p.Next(); err != nil || s != second {
+		t.Errorf("expected %s after a close, got %s (%v)", second, s, err)
+	}
+
+	// A server coming back healthy stays out while it is full
+	p.UpdateStatus(first, false)
+	p.UpdateStatus(first, true)
+	p.OnConnect(second)
+	if _, err := p.Next(); err == nil {
+		t.Error("full server returned to rotation by a health update")
+	}
+}
+
+func TestPool_Weights(t *testing.T) {
+	p := NewPool("roundrobin", []Server{
+		{Address: "s1", Weight: 0},
+		{Address: "s2", Weight: 3},
+	})
+	if w := p.Weight("s2"); w != 3 {
+		t.Errorf("weight = %d, want 3", w)
+	}
+	for i := 0; i < 5; i++ {
+		if s, _ := p.Next(); s != "s2" {
+			t.Fatalf("server with weight 0 picked")
+		}
+	}
+}
+
+func TestPool_SetServers(t *testing.T) {
+	p := NewPool("leastconn", []Server{
+		{Address: "s1", Weight: DefaultWeight, MaxConns: 1},
+		{Address: "s2", Weight: DefaultWeight},
+	})
+	p.OnConnect("s1")
+	p.UpdateStatus("s2", false)
+
+	// s1 stays full and s2 down; s3 is new
+	p.SetServers([]Server{
+		{Address: "s1", Weight: DefaultWeight, MaxConns: 1},
+		{Address: "s2", Weight: DefaultWeight},
+		{Address: "s3", Weight: DefaultWeight},
+	})
+	for i := 0; i < 3; i++ {
+		if s, err := p.Next(); err != nil || s != "s3" {
+			t.Fatalf("expected s3, got %s (%v)", s, err)
+		}
+	}
+
+	// The connection picked before the change still releases s1
+	p.OnDisconnect("s1")
+	p.SetServers([]Server{{Address: "s1", Weight: DefaultWeight, MaxConns: 1}})
+	if s, err := p.Next(); err != nil || s != "s1" {
+		t.Errorf("expected s1 after its connection closed, got %s (%v)", s, err)
+	}
+	p.OnDisconnect("s3") // removed servers are ignored
+}
+
+func TestPool_SetDisabled(t *testing.T) {
+	p := NewPool("roundrobin", []Server{
+		{Address: "s1", Weight: DefaultWeight},
+		{Address: "s2", Weight: DefaultWeight},
+	})
+	if err := p.SetDisabled("s1", true); err != nil {
+		t.Fatal(err)
+	}
+	// A recovering health check does not bring it back
+	p.UpdateStatus("s1", true)
+	for i := 0; i < 4; i++ {
+		if s, _ := p.Next(); s != "s2" {
+			t.Fatalf("expected s2 while s1 is disabled, got %s", s)
+		}
+	}
+	if !p.Disabled("s1") || p.Disabled("s2") {
+		t.Error("Disabled reports the wrong servers")
+	}
+
+	p.SetDisabled("s1", false)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		s, _ := p.Next()
+		seen[s] = true
+	}
+	if !seen["s1"] {
+		t.Error("s1 not selected after enabling it")
+	}
+	if err := p.SetDisabled("nope", true); err != ErrUnknownServer {
+		t.Errorf("err = %v, want ErrUnknownServer", err)
+	}
+}
@@ -0,0 +1,73 @@
+package lb
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultWeight is the weight of servers nobody adjusted.
+	DefaultWeight = 1
+	// MaxWeight is the highest administrative weight, as in HAProxy.
+	MaxWeight = 256
+)
+
+var (
+	ErrUnknownServer = errors.New("unknown server")
+	ErrInvalidWeight = fmt.Errorf("weight must be between 0 and %d", MaxWeight)
+)
+
+// Weighter is implemented by balancers supporting administrative weights.
+// A weight of 0 drains the server: it gets no new connections but keeps
+// its existing ones.
+type Weighter interface {
+	SetWeight(server string, weight int) error
+	Weight(server string) int
+}
+
+// Disabler is implemented by balancers whose servers can be taken out of
+// rotation at runtime. Unlike a health status, a disabled server stays out
+// whatever its health checks say until it is enabled again.
+type Disabler interface {
+	SetDisabled(server string, disabled bool) error
+	Disabled(server string) bool
+}
+
+// weightOf returns the weight of a server, DefaultWeight if unset.
+func weightOf(weights map[string]int, server string) int {
+	if w, ok := weights[server]; ok {
+		return w
+	}
+	return DefaultWeight
+}
+
+// activeServers returns the healthy servers with a non-zero weight, in order.
+func activeServers(all []string, status map[string]bool, weights map[string]int) []string {
+	active := make([]string, 0, len(all))
+	for _, s := range all {
+		if status[s] && weightOf(weights, s) > 0 {
+			active = append(active, s)
+		}
+	}
+	return active
+}
+
+// uniformWeights reports whether all servers share the same weight.
+func uniformWeights(servers []string, weights map[string]int) bool {
+	for _, s := range servers {
+		if weightOf(weights, s) != weightOf(weights, servers[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkWeight(status map[string]bool, server string, weight int) error {
+	if _, ok := status[server]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownServer, server)
+	}
+	if weight < 0 || weight > MaxWeight {
+		return ErrInvalidWeight
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package lb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetWeight_Distribution(t *testing.T) {
+	for _, algo := range []string{"roundrobin", "random", "latency"} {
+		b := NewBalancer(algo, []string{"s1", "s2"})
+		w := b.(Weighter)
+		if err := w.SetWeight("s1", 3); err != nil {
+			t.Fatalf("%s: SetWeight failed: %v", algo, err)
+		}
+
+		counts := make(map[string]int)
+		for i := 0; i < 4000; i++ {
+			s, _ := b.Next()
+			counts[s]++
+		}
+		if ratio := float64(counts["s1"]) / float64(counts["s2"]); ratio < 2.5 || ratio > 3.5 {
+			t.Errorf("%s: expected about 3:1, got %v", algo, counts)
+		}
+	}
+}
+
+func TestSetWeight_ZeroDrains(t *testing.T) {
+	for _, algo := range []string{"roundrobin", "random", "leastconn", "latency"} {
+		b := NewBalancer(algo, []string{"s1", "s2"})
+		b.(Weighter).SetWeight("s1", 0)
+		for i := 0; i < 10; i++ {
+			if s, _ := b.Next(); s != "s2" {
+				t.Fatalf("%s: drained server picked", algo)
+			}
+		}
+
+		// Health changes must not resurrect a drained server
+		b.UpdateStatus("s1", true)
+		if s, _ := b.Next(); s != "s2" {
+			t.Errorf("%s: drained server picked after status update", algo)
+		}
+	}
+}
+
+func TestSetWeight_Errors(t *testing.T) {
+	b := NewRoundRobin([]string{"s1"})
+	if err := b.SetWeight("s9", 1); !errors.Is(err, ErrUnknownServer) {
+		t.Errorf("expected ErrUnknownServer, got %v", err)
+	}
+	if err := b.SetWeight("s1", MaxWeight+1); !errors.Is(err, ErrInvalidWeight) {
+		t.Errorf("expected ErrInvalidWeight, got %v", err)
+	}
+	if w := b.Weight("s1"); w != DefaultWeight {
+		t.Errorf("Weight = %d, want %d", w, DefaultWeight)
+	}
+}
+
+func TestLeastConn_Weighted(t *testing.T) {
+	b := NewLeastConn([]string{"s1", "s2"})
+	b.SetWeight("s1", 2)
+	b.OnConnect("s1")
+	b.OnConnect("s2")
+	b.OnConnect("s1")
+
+	// s1: 2 conns / weight 2, s2: 1 conn / weight 1 -> tie, first wins
+	if s, _ := b.Next(); s != "s1" {
+		t.Errorf("expected s1, got %s", s)
+	}
+}
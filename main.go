@@ -2,18 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"nvelox/admin"
 	"nvelox/config"
 	"nvelox/core"
+	"nvelox/core/limits"
 	"nvelox/core/logging"
+	"nvelox/core/pidfile"
+	"nvelox/core/ports"
+	"nvelox/core/privilege"
+	"nvelox/core/sdnotify"
+	"nvelox/core/upgrade"
+	"nvelox/ctl"
 )
 
 var (
@@ -25,6 +34,15 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Started by the windows service manager, which also stops it
+	if isService, err := serviceMain(os.Args); isService || err != nil {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := run(os.Args, ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -32,9 +50,38 @@ func main() {
 }
 
 func run(args []string, ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(args) > 1 && args[1] == "ctl" {
+		return ctl.Run(ctx, args[2:], os.Stdout)
+	}
+	if len(args) > 1 && args[1] == "check" {
+		return ctl.RunCheck(ctx, args[2:], os.Stdout)
+	}
+	if len(args) > 1 && args[1] == "validate" {
+		return ctl.RunValidate(ctx, args[2:], os.Stdout)
+	}
+	if len(args) > 1 && args[1] == "lb" {
+		return ctl.RunLB(ctx, args[2:], os.Stdout)
+	}
+	if len(args) > 1 && args[1] == "config" {
+		return ctl.RunConfig(ctx, args[2:], os.Stdout)
+	}
+	if len(args) > 1 && args[1] == "service" {
+		return runService(ctx, args[2:])
+	}
+
 	fs := flag.NewFlagSet("nvelox", flag.ContinueOnError)
 	versionFlag := fs.Bool("version", false, "Print version and exit")
-	configPath := fs.String("config", "nvelox.yaml", "Path to configuration file")
+	var configFiles config.ConfigFiles
+	fs.Var(&configFiles, "config", "Path to configuration file; repeat to layer further files over it (default \"nvelox.yaml\")")
+	strictConfig := fs.Bool("strict-config", false, "Reject unknown configuration keys and a missing version")
+	allowUnknown := fs.String("allow-unknown", "", "Comma-separated keys tolerated by -strict-config (\"prefix*\" allowed)")
+	var overrides config.Overrides
+	fs.Var(&overrides, "set", "Override a configuration value, e.g. listeners[web].bind=:9090 (repeatable)")
+	testConfig := fs.Bool("t", false, "Check the configuration and exit (same as `nvelox check`)")
+	freeze := fs.Bool("freeze", false, "Start with the configuration frozen: admin changes and reloads are refused until thawed through the admin API")
 
 	if err := fs.Parse(args[1:]); err != nil {
 		return err
@@ -45,7 +92,15 @@ func run(args []string, ctx context.Context) error {
 		return nil
 	}
 
-	cfg, err := config.Load(*configPath)
+	configPath, layers := configFiles.Split()
+	opts := config.LoadOptions{Strict: *strictConfig, Layers: layers, Overrides: overrides}
+	if *allowUnknown != "" {
+		opts.AllowUnknown = strings.Split(*allowUnknown, ",")
+	}
+	if *testConfig {
+		return ctl.Check(ctx, configPath, opts, os.Stdout)
+	}
+	cfg, err := config.LoadWithOptions(configPath, opts)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
@@ -54,52 +109,184 @@ func run(args []string, ctx context.Context) error {
 	if err := logging.Init(cfg.Logging.Level, cfg.Logging.AccessLog, cfg.Logging.ErrorLog); err != nil {
 		return fmt.Errorf("failed to init logger: %v", err)
 	}
+	logging.SetUnits(cfg.Logging.Units)
+	if err := logging.InitAccessSinks(cfg.Logging.AccessSinks); err != nil {
+		return fmt.Errorf("failed to init access log sinks: %v", err)
+	}
 	logging.Info("Nvelox Server %s starting...", Version)
-	logging.Info("Loaded configuration from %s", *configPath)
+	logging.Info("Loaded configuration from %s", configPath)
+	for _, w := range cfg.Warnings {
+		logging.Warn("[CONFIG] %s", w)
+	}
+	if cfg.Version == "2" {
+		logging.Warn("[CONFIG] configuration version 2 is deprecated, `nvelox config migrate %s` converts it to version 3", configPath)
+	}
+
+	// Set when started by SIGUSR2 in the process this one replaces
+	inherited, err := upgrade.Inherited()
+	if err != nil {
+		return fmt.Errorf("failed to take over: %v", err)
+	}
+	sockets := upgrade.Sockets(inherited)
+
+	// One instance per pid file, released again on shutdown. A replacing
+	// process takes over the locked one of the previous process instead.
+	var pid atomic.Pointer[pidfile.File]
+	if cfg.Server.PidFile != "" && inherited[upgrade.PidFile] == nil {
+		p, err := pidfile.Acquire(cfg.Server.PidFile)
+		if err != nil {
+			return fmt.Errorf("failed to acquire pid file %s: %v", cfg.Server.PidFile, err)
+		}
+		pid.Store(p)
+	}
+	defer func() {
+		if p := pid.Load(); p != nil {
+			if err := p.Release(); err != nil {
+				logging.Warn("[PID] removing %s: %v", cfg.Server.PidFile, err)
+			}
+		}
+	}()
 
 	// Expand port ranges in listeners
 	expandedListeners := make([]*core.ListenerConfig, 0)
 
 	for _, l := range cfg.Listeners {
-		// Parse Bind: "host:port" or "host:start-end" or ":port"
-		host, portStr, err := splitHostPort(l.Bind)
+		expanded, err := core.ExpandListener(l)
 		if err != nil {
-			log.Printf("Invalid bind address '%s': %v", l.Bind, err)
+			logging.Error("[CONFIG] skipping listener %s: %v", l.Name, err)
 			continue
 		}
+		expandedListeners = append(expandedListeners, expanded...)
+	}
 
-		if strings.Contains(portStr, "-") {
-			// Range
-			parts := strings.Split(portStr, "-")
-			start, _ := strconv.Atoi(parts[0])
-			end, _ := strconv.Atoi(parts[1])
-
-			for p := start; p <= end; p++ {
-				expandedListeners = append(expandedListeners, &core.ListenerConfig{
-					Name:           fmt.Sprintf("%s-%d", l.Name, p),
-					Addr:           fmt.Sprintf("%s:%d", host, p),
-					Protocol:       l.Protocol,
-					ZeroCopy:       l.ZeroCopy,
-					DefaultBackend: l.DefaultBackend,
-					Port:           p,
-				})
-			}
-		} else {
-			// Single
-			p, _ := strconv.Atoi(portStr)
-			expandedListeners = append(expandedListeners, &core.ListenerConfig{
-				Name:           l.Name,
-				Addr:           l.Bind,
-				Protocol:       l.Protocol,
-				ZeroCopy:       l.ZeroCopy,
-				DefaultBackend: l.DefaultBackend,
-				Port:           p,
-			})
+	// Name whoever holds a port before the engine fails to bind it; the
+	// previous process still does while this one takes over
+	if inherited == nil {
+		for _, c := range ports.Check(core.BindAddrs(expandedListeners)) {
+			logging.Error("[PORTS] listener %s: %s", c.Listener, c)
 		}
 	}
+	checkOpenFiles(cfg.Server, expandedListeners)
 
 	engine := core.NewEngine(cfg)
 	engine.Listeners = expandedListeners
+	if *freeze {
+		engine.SetFrozen(true, "-freeze")
+	}
+	// The admin servers take their inherited sockets before the engine
+	// starts, which closes those no listener took
+	engine.Inherited = sockets
+	engine.Listening = func() error {
+		if err := dropPrivileges(cfg.Server); err != nil {
+			return err
+		}
+		if inherited != nil {
+			p, err := takeOver(inherited, cfg.Server.PidFile)
+			pid.Store(p)
+			if err != nil {
+				return err
+			}
+		}
+		go notifyReady(ctx, engine)
+		return nil
+	}
+
+	adminSrv := admin.NewServer(engine, Version)
+	adminSrv.Inherited = sockets
+	adminSrv.Reload = func() ([]core.Change, error) { return reload(engine, configPath, opts, "gRPC Reload") }
+	// Monitoring starts before and stops after everything else, so health
+	// and stats stay visible while the datapath starts, drains or fails
+	if cfg.Admin.MonitorBind != "" {
+		if _, err := adminSrv.StartMonitor(cfg.Admin.MonitorBind); err != nil {
+			return fmt.Errorf("failed to start monitoring: %v", err)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			adminSrv.ShutdownMonitor(shutdownCtx)
+		}()
+	}
+
+	if cfg.Admin.Bind != "" {
+		adminSrv.Token = cfg.Admin.Token.Value()
+		if _, err := adminSrv.Start(cfg.Admin.Bind); err != nil {
+			return fmt.Errorf("failed to start admin API: %v", err)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			adminSrv.Shutdown(shutdownCtx)
+		}()
+	}
+
+	if cfg.Admin.Socket != "" {
+		if err := adminSrv.StartSocket(cfg.Admin.Socket); err != nil {
+			return fmt.Errorf("failed to start control socket: %v", err)
+		}
+		defer adminSrv.ShutdownSocket()
+	}
+
+	if cfg.Admin.GRPC.Bind != "" {
+		if _, err := adminSrv.StartGRPC(cfg.Admin.GRPC); err != nil {
+			return fmt.Errorf("failed to start gRPC API: %v", err)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			adminSrv.ShutdownGRPC(shutdownCtx)
+		}()
+	}
+
+	// SIGHUP reloads the configuration file, SIGUSR2 upgrades the binary
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	usr2 := make(chan os.Signal, 1)
+	if upgradeSignal != nil {
+		signal.Notify(usr2, upgradeSignal)
+		defer signal.Stop(usr2)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reload(engine, configPath, opts, "SIGHUP")
+			case <-usr2:
+				if err := upgradeBinary(engine, adminSrv, pid.Load()); err != nil {
+					logging.Error("[UPGRADE] keeping this process: %v", err)
+					continue
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if cfg.WatchConfig {
+		go func() {
+			err := config.Watch(ctx, configPath, cfg, opts, func(next *config.Config, err error) {
+				if err != nil {
+					logging.Error("[RELOAD] keeping current configuration: %v", err)
+					return
+				}
+				logging.Info("[RELOAD] %s changed", configPath)
+				if engine.CheckFrozen("reload of "+configPath, "watch_config") != nil {
+					return
+				}
+				applyConfig(engine, next)
+			})
+			if err != nil {
+				logging.Error("[RELOAD] not watching configuration: %v", err)
+			}
+		}()
+	}
+
+	// The watchdog keeps being answered while shutdown drains connections
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go sdnotify.Watchdog(watchdogCtx, engine.Heartbeat)
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -111,26 +298,101 @@ func run(args []string, ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
-		log.Println("Shutting down...")
+		logging.Info("Shutting down...")
+		sdnotify.Notify("STOPPING=1")
+		<-errCh    // the engine stops its listeners before monitoring goes away
 		return nil // Success exit (cancelled by context)
 	case err := <-errCh:
 		if err == context.Canceled {
 			return nil
 		}
 		if err != nil {
+			logging.Error("[ENGINE] stopped: %v", err)
 			return fmt.Errorf("engine stopped: %v", err)
 		}
 		return nil
 	}
 }
 
-func splitHostPort(addr string) (string, string, error) {
-	// Simple split by last colon
-	lastColon := strings.LastIndex(addr, ":")
-	if lastColon == -1 {
-		return "", "", fmt.Errorf("missing port in address")
+// checkOpenFiles raises the open files limit to server.max_open_files and
+// warns when the listeners are expected to need more than the limit.
+func checkOpenFiles(s config.ServerConfig, listeners []*core.ListenerConfig) {
+	soft, hard, err := limits.NoFile()
+	if errors.Is(err, limits.ErrUnsupported) {
+		return
+	}
+	if err != nil {
+		logging.Warn("[LIMITS] reading the open files limit: %v", err)
+		return
+	}
+	if want := uint64(s.MaxOpenFiles); want > soft {
+		err := limits.RaiseNoFile(want)
+		if err != nil && want > hard {
+			logging.Warn("[LIMITS] max_open_files %d is above the hard limit of %d: %v", want, hard, err)
+			err = limits.RaiseNoFile(hard)
+		}
+		if err != nil {
+			logging.Warn("[LIMITS] raising the open files limit: %v", err)
+		}
+		soft, _, _ = limits.NoFile()
+		logging.Info("[LIMITS] open files limit is %d", soft)
+	}
+
+	need := core.FileEstimate(listeners, s.ExpectedConns(), s.Engine.NumEventLoops)
+	if uint64(need) > soft {
+		logging.Warn("[LIMITS] %d listener addresses at %d connections per listener are expected to need about %d open files, the limit is %d; raise server.max_open_files",
+			len(listeners), s.ExpectedConns(), need, soft)
+	}
+}
+
+// dropPrivileges switches to server.user and server.group once the listeners
+// are bound. Platforms that cannot switch users only get a warning.
+func dropPrivileges(s config.ServerConfig) error {
+	if s.User == "" && s.Group == "" {
+		return nil
+	}
+	err := privilege.Drop(s.User, s.Group)
+	if errors.Is(err, privilege.ErrUnsupported) {
+		logging.Warn("[PRIVS] %v, keeping the current user", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("dropping privileges to user %q group %q: %w", s.User, s.Group, err)
+	}
+	logging.Info("[PRIVS] running as uid %d gid %d", os.Getuid(), os.Getgid())
+	return nil
+}
+
+// reload re-reads the configuration file and applies it to the engine. An
+// invalid file is logged and the running configuration kept; while frozen
+// nothing is read. by names what asked, for the audit log.
+func reload(engine *core.Engine, path string, opts config.LoadOptions, by string) ([]core.Change, error) {
+	if err := engine.CheckFrozen("reload of "+path, by); err != nil {
+		return nil, err
+	}
+	logging.Info("[RELOAD] reloading configuration from %s", path)
+	cfg, err := config.LoadWithOptions(path, opts)
+	if err != nil {
+		logging.Error("[RELOAD] keeping current configuration: %v", err)
+		return nil, err
+	}
+	return applyConfig(engine, cfg)
+}
+
+// applyConfig applies a loaded configuration to the engine.
+func applyConfig(engine *core.Engine, cfg *config.Config) ([]core.Change, error) {
+	for _, w := range cfg.Warnings {
+		logging.Warn("[CONFIG] %s", w)
+	}
+
+	changes, err := engine.Reload(cfg)
+	if err != nil {
+		logging.Error("[RELOAD] keeping current configuration: %v", err)
+		return nil, err
+	}
+	for _, c := range changes {
+		logging.Info("[RELOAD] %s %s %s", c.Kind, c.Name, c.Action)
 	}
-	host := addr[:lastColon]
-	port := addr[lastColon+1:]
-	return host, port, nil
+	logging.Info("[RELOAD] configuration applied, %d changes", len(changes))
+	return changes, nil
 }
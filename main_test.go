@@ -2,40 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
-)
 
-func TestSplitHostPort(t *testing.T) {
-	tests := []struct {
-		input    string
-		wantHost string
-		wantPort string
-		wantErr  bool
-	}{
-		{"127.0.0.1:8080", "127.0.0.1", "8080", false},
-		{":8080", "", "8080", false},
-		{"[::1]:80", "[::1]", "80", false},
-		{"invalid", "", "", true},
-		{"no-port:", "no-port", "", false},
-	}
-
-	for _, tt := range tests {
-		host, port, err := splitHostPort(tt.input)
-		if (err != nil) != tt.wantErr {
-			t.Errorf("splitHostPort(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
-			continue
-		}
-		if host != tt.wantHost {
-			t.Errorf("splitHostPort(%q) host = %q, want %q", tt.input, host, tt.wantHost)
-		}
-		if port != tt.wantPort {
-			t.Errorf("splitHostPort(%q) port = %q, want %q", tt.input, port, tt.wantPort)
-		}
-	}
-}
+	"nvelox/config"
+	"nvelox/core"
+)
 
 func TestRun_Version(t *testing.T) {
 	err := run([]string{"cmd", "-version"}, context.Background())
@@ -94,6 +71,52 @@ logging:
 	}
 }
 
+func TestRun_PidFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	pidPath := filepath.Join(tmpDir, "nvelox.pid")
+	configPath := filepath.Join(tmpDir, "pid.yaml")
+	os.WriteFile(configPath, []byte(`
+version: '2'
+server:
+  pid_file: "`+pidPath+`"
+listeners:
+  - name: test-listener
+    bind: "127.0.0.1:0"
+    default_backend: backend1
+backends:
+  - name: backend1
+    servers: ["127.0.0.1:9090"]
+`), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run([]string{"cmd", "-config", configPath}, ctx) }()
+
+	// Written at startup, and a second instance is refused meanwhile
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if b, _ := os.ReadFile(pidPath); strings.TrimSpace(string(b)) == strconv.Itoa(os.Getpid()) {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("pid file not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := run([]string{"cmd", "-config", configPath}, context.Background()); err == nil {
+		t.Error("second instance started with the same pid file")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run failed: %v", err)
+	}
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Errorf("pid file not removed on shutdown: %v", err)
+	}
+}
+
 func TestRun_Range(t *testing.T) {
 	// Test range expansion
 	tmpDir := t.TempDir()
@@ -125,11 +148,11 @@ func TestRun_InvalidBind(t *testing.T) {
 	// Test invalid bind address skipping
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, "invalid.yaml")
+	// No server.port: it would complete the port-less bind
 	configContent := `
 version: '2'
 server:
   host: "127.0.0.1"
-  port: 8080
 listeners:
   - name: invalid-listener
     bind: "invalid"
@@ -172,3 +195,67 @@ listeners:
 		t.Error("run should fail due to engine start error")
 	}
 }
+
+func TestRun_StrictConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "typo.yaml")
+	configContent := `
+version: '2'
+listeners:
+  - name: typo-listener
+    bind: "127.0.0.1:0"
+    defualt_backend: web
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to create config: %v", err)
+	}
+
+	err := run([]string{"cmd", "-strict-config", "-config", configPath}, context.Background())
+	if err == nil {
+		t.Error("run with -strict-config should reject unknown keys")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = run([]string{"cmd", "-strict-config", "-allow-unknown", "defualt_*", "-config", configPath}, ctx)
+	if err != nil {
+		t.Errorf("run with allowlisted key failed: %v", err)
+	}
+}
+
+func TestReload_Frozen(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "nvelox.yaml")
+	if err := os.WriteFile(configPath, []byte("version: '2'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := core.NewEngine(&config.Config{Version: "2"})
+	engine.SetFrozen(true, "test")
+	if _, err := reload(engine, configPath, config.LoadOptions{}, "test"); !errors.Is(err, core.ErrFrozen) {
+		t.Errorf("reload while frozen: %v, want ErrFrozen", err)
+	}
+	engine.SetFrozen(false, "test")
+	if _, err := reload(engine, configPath, config.LoadOptions{}, "test"); err != nil {
+		t.Errorf("reload after thawing: %v", err)
+	}
+}
+
+func TestParseServiceCommand(t *testing.T) {
+	cmd, err := parseServiceCommand([]string{"install", "-name", "edge", "--", "-config", "nvelox.yaml", "-config=extra.yaml", "-strict-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	want := []string{"-config", filepath.Join(wd, "nvelox.yaml"), "-config=" + filepath.Join(wd, "extra.yaml"), "-strict-config"}
+	if cmd.action != "install" || cmd.name != "edge" || strings.Join(cmd.args, " ") != strings.Join(want, " ") {
+		t.Errorf("parsed %+v, want args %v", cmd, want)
+	}
+
+	if cmd, _ := parseServiceCommand([]string{"stop"}); cmd.name != defaultServiceName {
+		t.Errorf("default name = %q", cmd.name)
+	}
+	for _, args := range [][]string{{}, {"restart"}, {"stop", "--", "-config", "x.yaml"}} {
+		if _, err := parseServiceCommand(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package preauth implements the authentication preamble of listeners with
+// preauth: one line a client sends ahead of its own protocol,
+//
+//	NVX1 <unix time> <nonce> <hmac>\n
+//
+// where the nonce is 16 random hex digits and the HMAC is the hex
+// HMAC-SHA256, keyed with the shared secret, of the line up to the nonce.
+package preauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version opens every preamble.
+const Version = "NVX1"
+
+// MaxLength is the longest preamble accepted.
+const MaxLength = 128
+
+var (
+	// ErrIncomplete means more bytes are needed to parse the preamble.
+	ErrIncomplete = errors.New("incomplete preamble")
+	// ErrInvalid means the bytes are not a preamble.
+	ErrInvalid = errors.New("invalid preamble")
+	// ErrSignature means the preamble was not made with the secret.
+	ErrSignature = errors.New("preamble signature mismatch")
+	// ErrExpired means the preamble time is too far from the current time.
+	ErrExpired = errors.New("preamble expired")
+)
+
+// Preamble returns a preamble for now, with a fresh nonce.
+func Preamble(secret []byte, now time.Time) ([]byte, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	signed := fmt.Sprintf("%s %d %s", Version, now.Unix(), hex.EncodeToString(nonce[:]))
+	return []byte(signed + " " + sign(secret, signed) + "\n"), nil
+}
+
+// Parse checks the preamble data starts with against secret, accepting a
+// time up to maxSkew away from now. It returns the nonce, for rejecting
+// replays, and the length of the preamble in bytes.
+func Parse(data, secret []byte, now time.Time, maxSkew time.Duration) (string, int, error) {
+	n := min(len(data), len(Version))
+	if !bytes.Equal(data[:n], []byte(Version[:n])) {
+		return "", 0, ErrInvalid
+	}
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		if len(data) >= MaxLength {
+			return "", 0, ErrInvalid
+		}
+		return "", 0, ErrIncomplete
+	}
+	fields := strings.Fields(string(data[:end]))
+	if end >= MaxLength || len(fields) != 4 || len(fields[2]) != 16 {
+		return "", 0, ErrInvalid
+	}
+	ts, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalid
+	}
+	signed := strings.Join(fields[:3], " ")
+	if !hmac.Equal([]byte(fields[3]), []byte(sign(secret, signed))) {
+		return "", 0, ErrSignature
+	}
+	if skew := now.Sub(time.Unix(ts, 0)).Abs(); skew > maxSkew {
+		return "", 0, fmt.Errorf("%w: %s off", ErrExpired, skew.Round(time.Second))
+	}
+	return fields[2], end + 1, nil
+}
+
+func sign(secret []byte, signed string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,50 @@
+package preauth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	now := time.Unix(1_800_000_000, 0)
+	p, err := Preamble(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Partial, then complete with client bytes after it
+	if _, _, err := Parse(p[:10], secret, now, time.Minute); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("partial preamble: err = %v", err)
+	}
+	data := append(append([]byte(nil), p...), "SSH-2.0"...)
+	nonce, n, err := Parse(data, secret, now.Add(20*time.Second), 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(p) || len(nonce) != 16 {
+		t.Errorf("n = %d, nonce = %q, want %d bytes and 16 digits", n, nonce, len(p))
+	}
+	if again, _ := Preamble(secret, now); string(again) == string(p) {
+		t.Error("two preambles share a nonce")
+	}
+
+	for _, c := range []struct {
+		name   string
+		data   []byte
+		secret string
+		now    time.Time
+		want   error
+	}{
+		{"other secret", p, "fedcba9876543210", now, ErrSignature},
+		{"stale", p, string(secret), now.Add(-time.Minute), ErrExpired},
+		{"other protocol", []byte("SSH-2.0-OpenSSH\r\n"), string(secret), now, ErrInvalid},
+		{"malformed", []byte("NVX1 soon abc def\n"), string(secret), now, ErrInvalid},
+		{"endless", append([]byte("NVX1 "), make([]byte, MaxLength)...), string(secret), now, ErrInvalid},
+	} {
+		if _, _, err := Parse(c.data, []byte(c.secret), c.now, 30*time.Second); !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
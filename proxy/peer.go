@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// peerVersion opens the value of a TLVPeer.
+const peerVersion = 1
+
+// Fields of a TLVPeer value, each type (1) | length (1) | value.
+const (
+	peerConnID = 0x01
+	peerTenant = 0x02
+	peerHint   = 0x03 // "key=value", repeated
+)
+
+// ErrPeer means a TLVPeer value is malformed.
+var ErrPeer = errors.New("invalid peer metadata")
+
+// Peer is the metadata one nvelox instance passes to the next in the
+// TLVPeer of its PROXY header: a connection ID correlating the logs of both
+// tiers, the tenant of the connection and hints for routing it. Every field
+// is at most 255 bytes, a hint key and value together.
+type Peer struct {
+	ConnID string
+	Tenant string
+	Hints  map[string]string
+}
+
+// TLV encodes the metadata as a TLVPeer.
+func (p Peer) TLV() (TLV, error) {
+	v := []byte{peerVersion}
+	add := func(typ byte, s string) error {
+		if len(s) > 255 {
+			return fmt.Errorf("peer metadata field too long: %.16q...", s)
+		}
+		v = append(v, typ, byte(len(s)))
+		v = append(v, s...)
+		return nil
+	}
+	if p.ConnID != "" {
+		if err := add(peerConnID, p.ConnID); err != nil {
+			return TLV{}, err
+		}
+	}
+	if p.Tenant != "" {
+		if err := add(peerTenant, p.Tenant); err != nil {
+			return TLV{}, err
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(p.Hints)) {
+		if err := add(peerHint, k+"="+p.Hints[k]); err != nil {
+			return TLV{}, err
+		}
+	}
+	return TLV{Type: TLVPeer, Value: v}, nil
+}
+
+// ParsePeer decodes the value of a TLVPeer. Fields of unknown types are
+// skipped, so newer peers can add some.
+func ParsePeer(v []byte) (Peer, error) {
+	var p Peer
+	if len(v) == 0 || v[0] != peerVersion {
+		return p, ErrPeer
+	}
+	v = v[1:]
+	for len(v) > 0 {
+		if len(v) < 2 || len(v) < 2+int(v[1]) {
+			return Peer{}, ErrPeer
+		}
+		typ, s := v[0], string(v[2:2+int(v[1])])
+		v = v[2+int(v[1]):]
+		switch typ {
+		case peerConnID:
+			p.ConnID = s
+		case peerTenant:
+			p.Tenant = s
+		case peerHint:
+			k, val, ok := strings.Cut(s, "=")
+			if !ok || k == "" {
+				return Peer{}, ErrPeer
+			}
+			if p.Hints == nil {
+				p.Hints = make(map[string]string)
+			}
+			p.Hints[k] = val
+		}
+	}
+	return p, nil
+}
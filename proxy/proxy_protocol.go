@@ -1,7 +1,9 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,18 +14,58 @@ var (
 )
 
 const (
+	v2CmdLocal = 0
 	v2CmdProxy = 1
 	v2Ver      = 2
 
-	v2FamIPv4  = 0x10
-	v2FamIPv6  = 0x20
-	v2ProtoTCP = 1
-	v2ProtoUDP = 2
+	v2FamUnspec = 0x00
+	v2FamIPv4   = 0x10
+	v2FamIPv6   = 0x20
+	v2ProtoTCP  = 1
+	v2ProtoUDP  = 2
 )
 
+// FamilyMismatch selects what to emit when the source and destination
+// addresses belong to different IP families.
+type FamilyMismatch int
+
+const (
+	// MismatchError fails the write, so no header is sent.
+	MismatchError FamilyMismatch = iota
+	// MismatchUnknown emits an UNSPEC family header without addresses.
+	MismatchUnknown
+	// MismatchMap converts the IPv4 side to an IPv4-mapped IPv6 address.
+	MismatchMap
+)
+
+// ParseFamilyMismatch maps a config value ("skip", "unknown", "map") to a FamilyMismatch.
+func ParseFamilyMismatch(s string) (FamilyMismatch, error) {
+	switch s {
+	case "", "skip":
+		return MismatchError, nil
+	case "unknown":
+		return MismatchUnknown, nil
+	case "map":
+		return MismatchMap, nil
+	default:
+		return MismatchError, fmt.Errorf("unknown family mismatch mode: %s", s)
+	}
+}
+
+// Options tunes header generation.
+type Options struct {
+	Mismatch FamilyMismatch
+	TLVs     []TLV // appended after the addresses
+}
+
 // WriteProxyHeaderV2 writes the PROXY Protocol v2 header to the writer.
 // It supports IPv4 and IPv6 over TCP and UDP.
 func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
+	return WriteProxyHeaderV2Opts(w, src, dst, Options{})
+}
+
+// WriteProxyHeaderV2Opts is WriteProxyHeaderV2 with explicit options.
+func WriteProxyHeaderV2Opts(w io.Writer, src, dst net.Addr, opts Options) error {
 	header := make([]byte, 16, 108) // Min 16 bytes for header + 0 addr
 	copy(header, sigV2)
 
@@ -58,6 +100,18 @@ func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
 	sIP4 := srcIP.To4()
 	dIP4 := dstIP.To4()
 
+	if (sIP4 == nil) != (dIP4 == nil) {
+		switch opts.Mismatch {
+		case MismatchUnknown:
+			// UNSPEC family, no address block; receivers use the real connection addresses
+			header[13] = v2FamUnspec
+			return writeWithTLVs(w, header, opts.TLVs)
+		case MismatchMap:
+			// Force both sides to IPv6 (IPv4 becomes ::ffff:a.b.c.d)
+			sIP4, dIP4 = nil, nil
+		}
+	}
+
 	if sIP4 != nil && dIP4 != nil {
 		// IPv4
 		header[13] = v2FamIPv4
@@ -100,6 +154,165 @@ func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
 		return fmt.Errorf("IP family mismatch or unsupported")
 	}
 
+	return writeWithTLVs(w, header, opts.TLVs)
+}
+
+// writeWithTLVs appends tlvs to a header and writes it, counting them in its
+// length.
+func writeWithTLVs(w io.Writer, header []byte, tlvs []TLV) error {
+	for _, t := range tlvs {
+		if len(t.Value) > 0xFFFF {
+			return fmt.Errorf("TLV 0x%02X too long", t.Type)
+		}
+		header = append(header, t.Type)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(t.Value)))
+		header = append(header, t.Value...)
+	}
+	if len(header)-16 > 0xFFFF {
+		return fmt.Errorf("PROXY header too long")
+	}
+	binary.BigEndian.PutUint16(header[14:], uint16(len(header)-16))
+	_, err := w.Write(header)
+	return err
+}
+
+// WriteLocalHeaderV2 writes a PROXY Protocol v2 header with the LOCAL command.
+// It is used for connections initiated by the proxy itself (health checks,
+// pre-warmed connections) which carry no client addresses; receivers must
+// use the real connection endpoints.
+func WriteLocalHeaderV2(w io.Writer) error {
+	header := make([]byte, 16)
+	copy(header, sigV2)
+	header[12] = (v2Ver << 4) | v2CmdLocal
+	header[13] = v2FamUnspec
+	// Length 0: no address block
 	_, err := w.Write(header)
 	return err
 }
+
+var (
+	// ErrIncomplete means more bytes are needed to parse the header.
+	ErrIncomplete = errors.New("incomplete PROXY header")
+	// ErrInvalid means the bytes are not a valid PROXY protocol v2 header.
+	ErrInvalid = errors.New("invalid PROXY header")
+)
+
+// TLV types defined by the PROXY protocol specification, the one AWS uses
+// for the VPC endpoint of a connection and the one of nvelox peers, both in
+// the range the specification leaves to custom use.
+const (
+	TLVALPN      = 0x01
+	TLVAuthority = 0x02
+	TLVCRC32C    = 0x03
+	TLVNoop      = 0x04
+	TLVUniqueID  = 0x05
+	TLVSSL       = 0x20
+	TLVNetNS     = 0x30
+	TLVAWS       = 0xEA
+	TLVPeer      = 0xE7 // nvelox peer metadata, see Peer
+)
+
+// AWSVPCEndpointID is the subtype byte leading an AWS TLV that carries the
+// VPC endpoint ID of the connection.
+const AWSVPCEndpointID = 0x01
+
+// TLV is a type-length-value field following the addresses of a header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header is a parsed PROXY protocol v2 header. Source and Destination are
+// nil for the LOCAL command and for address families without addresses.
+type Header struct {
+	Local       bool // LOCAL command: the connection is from the sender itself
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV
+}
+
+// ParseHeaderV2 parses the PROXY protocol v2 header data starts with and
+// returns it with its length in bytes.
+func ParseHeaderV2(data []byte) (*Header, int, error) {
+	n := min(len(data), len(sigV2))
+	if !bytes.Equal(data[:n], sigV2[:n]) {
+		return nil, 0, ErrInvalid
+	}
+	if len(data) < 16 {
+		return nil, 0, ErrIncomplete
+	}
+	if data[12]>>4 != v2Ver {
+		return nil, 0, ErrInvalid
+	}
+	length := 16 + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < length {
+		return nil, 0, ErrIncomplete
+	}
+	body := data[16:length]
+
+	h := &Header{}
+	switch data[12] & 0x0F {
+	case v2CmdLocal:
+		h.Local = true
+	case v2CmdProxy:
+	default:
+		return nil, 0, ErrInvalid
+	}
+
+	var addrLen int
+	switch data[13] & 0xF0 {
+	case v2FamIPv4:
+		addrLen = 12
+	case v2FamIPv6:
+		addrLen = 36
+	case v2FamUnspec:
+	default:
+		addrLen = -1 // AF_UNIX: 216 bytes of paths, no IP addresses
+	}
+	if addrLen < 0 {
+		if len(body) < 216 {
+			return nil, 0, ErrInvalid
+		}
+		body = body[216:]
+	} else {
+		if len(body) < addrLen {
+			return nil, 0, ErrInvalid
+		}
+		if addrLen > 0 && !h.Local {
+			ipLen := (addrLen - 4) / 2
+			src := net.IP(bytes.Clone(body[:ipLen]))
+			dst := net.IP(bytes.Clone(body[ipLen : 2*ipLen]))
+			srcPort := int(binary.BigEndian.Uint16(body[2*ipLen:]))
+			dstPort := int(binary.BigEndian.Uint16(body[2*ipLen+2:]))
+			if data[13]&0x0F == v2ProtoUDP {
+				h.Source, h.Destination = &net.UDPAddr{IP: src, Port: srcPort}, &net.UDPAddr{IP: dst, Port: dstPort}
+			} else {
+				h.Source, h.Destination = &net.TCPAddr{IP: src, Port: srcPort}, &net.TCPAddr{IP: dst, Port: dstPort}
+			}
+		}
+		body = body[addrLen:]
+	}
+
+	for len(body) > 0 {
+		if len(body) < 3 {
+			return nil, 0, ErrInvalid
+		}
+		l := 3 + int(binary.BigEndian.Uint16(body[1:3]))
+		if len(body) < l {
+			return nil, 0, ErrInvalid
+		}
+		h.TLVs = append(h.TLVs, TLV{Type: body[0], Value: bytes.Clone(body[3:l])})
+		body = body[l:]
+	}
+	return h, length, nil
+}
+
+// TLV returns the value of the first TLV of a type.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, t := range h.TLVs {
+		if t.Type == typ {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +119,168 @@ func TestWriteProxyHeaderV2_Mismatch(t *testing.T) {
 		t.Fatal("Expected error for mismatched address families, got nil")
 	}
 }
+
+func TestWriteProxyHeaderV2_FamilyMismatch(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}
+
+	// Default: error, nothing written
+	var buf bytes.Buffer
+	if err := WriteProxyHeaderV2(&buf, src, dst); err == nil {
+		t.Error("expected error for family mismatch")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written, got %d bytes", buf.Len())
+	}
+
+	// Unknown: UNSPEC family, empty address block
+	buf.Reset()
+	if err := WriteProxyHeaderV2Opts(&buf, src, dst, Options{Mismatch: MismatchUnknown}); err != nil {
+		t.Fatalf("unknown mode failed: %v", err)
+	}
+	data := buf.Bytes()
+	if len(data) != 16 || data[13] != 0x00 || binary.BigEndian.Uint16(data[14:16]) != 0 {
+		t.Errorf("unexpected UNSPEC header: %x", data)
+	}
+
+	// Map: IPv4 destination becomes ::ffff:10.0.0.1
+	buf.Reset()
+	if err := WriteProxyHeaderV2Opts(&buf, src, dst, Options{Mismatch: MismatchMap}); err != nil {
+		t.Fatalf("map mode failed: %v", err)
+	}
+	data = buf.Bytes()
+	if data[13] != 0x21 {
+		t.Errorf("Expected Fam/Proto 0x21, got 0x%X", data[13])
+	}
+	if !bytes.Equal(data[32:48], net.ParseIP("10.0.0.1").To16()) {
+		t.Errorf("Dst IP not mapped: %x", data[32:48])
+	}
+}
+
+func TestParseFamilyMismatch(t *testing.T) {
+	for in, want := range map[string]FamilyMismatch{"": MismatchError, "skip": MismatchError, "unknown": MismatchUnknown, "map": MismatchMap} {
+		got, err := ParseFamilyMismatch(in)
+		if err != nil || got != want {
+			t.Errorf("ParseFamilyMismatch(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseFamilyMismatch("bogus"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestWriteLocalHeaderV2(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteLocalHeaderV2(&buf); err != nil {
+		t.Fatalf("WriteLocalHeaderV2 failed: %v", err)
+	}
+	data := buf.Bytes()
+	if len(data) != 16 {
+		t.Fatalf("expected 16 bytes, got %d", len(data))
+	}
+	if !bytes.Equal(data[:12], sigV2) {
+		t.Errorf("Invalid signature")
+	}
+	// Version 2, Command LOCAL
+	if data[12] != 0x20 {
+		t.Errorf("Expected Ver/Cmd 0x20, got 0x%X", data[12])
+	}
+	if data[13] != 0x00 || binary.BigEndian.Uint16(data[14:16]) != 0 {
+		t.Errorf("Expected UNSPEC family with no addresses, got %x", data[13:16])
+	}
+}
+
+func TestParseHeaderV2(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 12345}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}
+	var buf bytes.Buffer
+	if err := WriteProxyHeaderV2(&buf, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	// Append an AWS VPC endpoint TLV and a custom one, and fix up the length
+	data := buf.Bytes()
+	data = append(data, TLVAWS, 0x00, 0x0A, 0x01)
+	data = append(data, "vpce-1234"...)
+	data = append(data, 0xE0, 0x00, 0x02, 'a', 'b')
+	binary.BigEndian.PutUint16(data[14:], uint16(len(data)-16))
+	payload := append(bytes.Clone(data), "GET /"...)
+
+	for i := 0; i < len(data); i++ {
+		if _, _, err := ParseHeaderV2(payload[:i]); err != ErrIncomplete {
+			t.Fatalf("ParseHeaderV2 of %d bytes: %v, want ErrIncomplete", i, err)
+		}
+	}
+	h, n, err := ParseHeaderV2(payload)
+	if err != nil {
+		t.Fatalf("ParseHeaderV2 failed: %v", err)
+	}
+	if n != len(data) || h.Local {
+		t.Errorf("length %d, local %v", n, h.Local)
+	}
+	if h.Source.String() != src.String() || h.Destination.String() != dst.String() {
+		t.Errorf("addresses %s -> %s", h.Source, h.Destination)
+	}
+	if v, ok := h.TLV(TLVAWS); !ok || string(v) != "\x01vpce-1234" {
+		t.Errorf("AWS TLV = %q", v)
+	}
+	if v, ok := h.TLV(0xE0); !ok || string(v) != "ab" {
+		t.Errorf("custom TLV = %q", v)
+	}
+
+	buf.Reset()
+	WriteLocalHeaderV2(&buf)
+	if h, _, err := ParseHeaderV2(buf.Bytes()); err != nil || !h.Local || h.Source != nil {
+		t.Errorf("LOCAL header parsed as %+v, %v", h, err)
+	}
+
+	if _, _, err := ParseHeaderV2([]byte("GET / HTTP/1.1\r\n")); err != ErrInvalid {
+		t.Errorf("plain request: %v, want ErrInvalid", err)
+	}
+	bad := bytes.Clone(data)
+	binary.BigEndian.PutUint16(bad[14:], 13) // Cuts the address block short of a TLV
+	if _, _, err := ParseHeaderV2(bad); err != ErrInvalid {
+		t.Errorf("truncated TLV: %v, want ErrInvalid", err)
+	}
+}
+
+func TestPeer(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 12345}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}
+	peer := Peer{ConnID: "4f2a9c1e", Tenant: "acme", Hints: map[string]string{"backend": "eu-game", "region": "eu"}}
+	tlv, err := peer.TLV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteProxyHeaderV2Opts(&buf, src, dst, Options{TLVs: []TLV{tlv}}); err != nil {
+		t.Fatal(err)
+	}
+	h, n, err := ParseHeaderV2(buf.Bytes())
+	if err != nil || n != buf.Len() {
+		t.Fatalf("ParseHeaderV2: %d bytes, %v", n, err)
+	}
+	v, ok := h.TLV(TLVPeer)
+	if !ok {
+		t.Fatal("no peer TLV")
+	}
+	got, err := ParsePeer(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ConnID != peer.ConnID || got.Tenant != peer.Tenant || len(got.Hints) != 2 || got.Hints["backend"] != "eu-game" {
+		t.Errorf("ParsePeer = %+v, want %+v", got, peer)
+	}
+
+	// Unknown fields are skipped, malformed ones rejected
+	if p, err := ParsePeer(append(bytes.Clone(v), 0x7F, 1, 'x')); err != nil || p.Tenant != "acme" {
+		t.Errorf("unknown field: %+v, %v", p, err)
+	}
+	for _, bad := range [][]byte{nil, {2}, {1, peerTenant, 5, 'a'}, {1, peerHint, 1, 'x'}} {
+		if _, err := ParsePeer(bad); err != ErrPeer {
+			t.Errorf("ParsePeer(%q) = %v, want ErrPeer", bad, err)
+		}
+	}
+	if _, err := (Peer{Tenant: strings.Repeat("x", 256)}).TLV(); err == nil {
+		t.Error("expected an error for a field over 255 bytes")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// defaultServiceName is the name nvelox registers as a windows service.
+const defaultServiceName = "nvelox"
+
+// serviceCommand is a parsed `nvelox service` command line.
+type serviceCommand struct {
+	action string
+	name   string
+	args   []string // nvelox flags the service starts with, install only
+}
+
+// parseServiceCommand parses `nvelox service <action> [-name name] [-- flags]`.
+func parseServiceCommand(args []string) (serviceCommand, error) {
+	if len(args) == 0 {
+		return serviceCommand{}, fmt.Errorf("usage: nvelox service install|uninstall|start|stop [-name name] [-- nvelox flags]")
+	}
+	cmd := serviceCommand{action: args[0]}
+	switch cmd.action {
+	case "install", "uninstall", "start", "stop":
+	default:
+		return cmd, fmt.Errorf("unknown service action %q, want install, uninstall, start or stop", cmd.action)
+	}
+	fs := flag.NewFlagSet("nvelox service "+cmd.action, flag.ContinueOnError)
+	fs.StringVar(&cmd.name, "name", defaultServiceName, "Service name")
+	if err := fs.Parse(args[1:]); err != nil {
+		return cmd, err
+	}
+	if fs.NArg() > 0 && cmd.action != "install" {
+		return cmd, fmt.Errorf("service %s takes no nvelox flags", cmd.action)
+	}
+	var err error
+	cmd.args, err = absConfigArgs(fs.Args())
+	return cmd, err
+}
+
+// absConfigArgs makes the -config paths among nvelox flags absolute, since a
+// service does not start in the directory it was installed from.
+func absConfigArgs(args []string) ([]string, error) {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i := 0; i < len(out); i++ {
+		name, value, inline := strings.Cut(strings.TrimLeft(out[i], "-"), "=")
+		if name != "config" || !strings.HasPrefix(out[i], "-") {
+			continue
+		}
+		if !inline {
+			i++
+			if i == len(out) {
+				break
+			}
+			value = out[i]
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, err
+		}
+		if inline {
+			out[i] = out[i][:strings.Index(out[i], "=")+1] + abs
+		} else {
+			out[i] = abs
+		}
+	}
+	return out, nil
+}
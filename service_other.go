@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// serviceMain reports that the process was not started as a windows service.
+func serviceMain(args []string) (bool, error) {
+	return false, nil
+}
+
+func runService(ctx context.Context, args []string) error {
+	if _, err := parseServiceCommand(args); err != nil {
+		return err
+	}
+	return errors.New("service: windows services are only supported on windows, use a systemd unit here")
+}
@@ -0,0 +1,152 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStopTimeout bounds how long `nvelox service stop` waits; shutdown
+// itself waits up to server.drain_timeout for open connections.
+const serviceStopTimeout = 2 * time.Minute
+
+// serviceMain runs nvelox under the service control manager when the process
+// was started by it, reporting whether it was.
+func serviceMain(args []string) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	return true, svc.Run(defaultServiceName, &serviceHandler{args: args})
+}
+
+// serviceHandler runs nvelox as the service, stopping it like SIGTERM.
+type serviceHandler struct {
+	args []string
+}
+
+func (h *serviceHandler) Execute(svcArgs []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- run(h.args, ctx)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				// Failures before the log files are open are lost otherwise;
+				// the event source is named after the service
+				if elog, lerr := eventlog.Open(svcArgs[0]); lerr == nil {
+					elog.Error(1, err.Error())
+					elog.Close()
+				}
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// runService installs, uninstalls, starts or stops the windows service.
+func runService(ctx context.Context, args []string) error {
+	cmd, err := parseServiceCommand(args)
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service: connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if cmd.action == "install" {
+		return installService(m, cmd)
+	}
+	s, err := m.OpenService(cmd.name)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", cmd.name, err)
+	}
+	defer s.Close()
+	switch cmd.action {
+	case "start":
+		return s.Start()
+	case "stop":
+		return stopService(ctx, s)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("service %s: %w", cmd.name, err)
+	}
+	eventlog.Remove(cmd.name)
+	fmt.Printf("service %s removed\n", cmd.name)
+	return nil
+}
+
+func installService(m *mgr.Mgr, cmd serviceCommand) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if s, err := m.OpenService(cmd.name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", cmd.name)
+	}
+	s, err := m.CreateService(cmd.name, exe, mgr.Config{
+		DisplayName: "Nvelox load balancer",
+		Description: "TCP/UDP load balancer and proxy",
+		StartType:   mgr.StartAutomatic,
+	}, cmd.args...)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", cmd.name, err)
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(cmd.name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("service %s: event log source: %w", cmd.name, err)
+	}
+	fmt.Printf("service %s installed, start it with `nvelox service start -name %s`\n", cmd.name, cmd.name)
+	return nil
+}
+
+// stopService asks the service to stop and waits until it has.
+func stopService(ctx context.Context, s *mgr.Service) error {
+	st, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(serviceStopTimeout)
+	for st.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.New("service did not stop in time")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(300 * time.Millisecond):
+		}
+		if st, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"nvelox/core"
+	"nvelox/core/logging"
+	"nvelox/core/sdnotify"
+)
+
+// notifyReady reports readiness to systemd once the health checks of every
+// backend have probed their servers, so that units ordered after a Type=notify
+// unit start against a balancer that knows which servers are up.
+func notifyReady(ctx context.Context, engine *core.Engine) {
+	if engine.HealthChecked(ctx) != nil {
+		return
+	}
+	sent, err := sdnotify.Notify("READY=1")
+	switch {
+	case err != nil:
+		logging.Warn("[SYSTEMD] reporting readiness: %v", err)
+	case sent:
+		logging.Info("[SYSTEMD] reported ready")
+	}
+}
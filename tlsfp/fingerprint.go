@@ -0,0 +1,349 @@
+// Package tlsfp computes JA3 and JA4 fingerprints from a TLS ClientHello.
+package tlsfp
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNotClientHello = errors.New("not a TLS ClientHello")
+	ErrTruncated      = errors.New("truncated ClientHello")
+	ErrMalformed      = errors.New("malformed ClientHello")
+)
+
+const (
+	recordTypeHandshake  = 0x16
+	handshakeClientHello = 0x01
+
+	extServerName          = 0x0000
+	extSupportedGroups     = 0x000a
+	extECPointFormats      = 0x000b
+	extSignatureAlgorithms = 0x000d
+	extALPN                = 0x0010
+	extSupportedVersions   = 0x002b
+)
+
+// ClientHello holds the fields used by JA3/JA4.
+type ClientHello struct {
+	Version             uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SupportedGroups     []uint16
+	ECPointFormats      []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ALPN                []string
+	ServerName          string
+}
+
+// ParseClientHello parses a ClientHello from the first bytes of a TLS stream.
+// The ClientHello may be fragmented over several TLS records. ErrTruncated
+// means more bytes are needed; ErrMalformed that the ClientHello is complete
+// but cannot be parsed.
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	msg, err := handshakeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	r := reader(msg[4:])
+
+	ch := &ClientHello{}
+	var ok bool
+	if ch.Version, ok = r.u16(); !ok {
+		return nil, ErrMalformed
+	}
+	if _, ok = r.bytes(32); !ok { // random
+		return nil, ErrMalformed
+	}
+	if _, ok = r.vec8(); !ok { // session id
+		return nil, ErrMalformed
+	}
+	suites, ok := r.vec16()
+	if !ok {
+		return nil, ErrMalformed
+	}
+	ch.CipherSuites = suites.u16s()
+	if _, ok = r.vec8(); !ok { // compression methods
+		return nil, ErrMalformed
+	}
+	if len(r) == 0 {
+		return ch, nil // No extensions
+	}
+
+	exts, ok := r.vec16()
+	if !ok {
+		return nil, ErrMalformed
+	}
+	for len(exts) > 0 {
+		typ, ok1 := exts.u16()
+		body, ok2 := exts.vec16()
+		if !ok1 || !ok2 {
+			return nil, ErrMalformed
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		ch.parseExtension(typ, body)
+	}
+	return ch, nil
+}
+
+// handshakeMessage reassembles the first handshake message of a TLS stream
+// from the records it spans and checks that it is a ClientHello.
+func handshakeMessage(data []byte) ([]byte, error) {
+	var msg []byte
+	for {
+		if len(data) > 0 && data[0] != recordTypeHandshake {
+			return nil, ErrNotClientHello
+		}
+		if len(data) < 5 {
+			return nil, ErrTruncated
+		}
+		recLen := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data)-5 < recLen {
+			return nil, ErrTruncated
+		}
+		msg = append(msg, data[5:5+recLen]...)
+		data = data[5+recLen:]
+
+		if len(msg) > 0 && msg[0] != handshakeClientHello {
+			return nil, ErrNotClientHello
+		}
+		if len(msg) < 4 {
+			continue
+		}
+		hsLen := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+		if len(msg)-4 >= hsLen {
+			return msg[:4+hsLen], nil
+		}
+	}
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, body reader) {
+	switch typ {
+	case extServerName:
+		list, _ := body.vec16()
+		for len(list) > 0 {
+			nameType, ok1 := list.u8()
+			name, ok2 := list.vec16()
+			if !ok1 || !ok2 {
+				return
+			}
+			if nameType == 0 {
+				ch.ServerName = string(name)
+				return
+			}
+		}
+	case extSupportedGroups:
+		list, _ := body.vec16()
+		ch.SupportedGroups = list.u16s()
+	case extECPointFormats:
+		list, _ := body.vec8()
+		ch.ECPointFormats = []uint8(list)
+	case extSignatureAlgorithms:
+		list, _ := body.vec16()
+		ch.SignatureAlgorithms = list.u16s()
+	case extALPN:
+		list, _ := body.vec16()
+		for len(list) > 0 {
+			proto, ok := list.vec8()
+			if !ok {
+				return
+			}
+			ch.ALPN = append(ch.ALPN, string(proto))
+		}
+	case extSupportedVersions:
+		list, _ := body.vec8()
+		ch.SupportedVersions = list.u16s()
+	}
+}
+
+// JA3String returns the raw JA3 string:
+// SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+func (ch *ClientHello) JA3String() string {
+	formats := make([]uint16, len(ch.ECPointFormats))
+	for i, f := range ch.ECPointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.Version)),
+		joinDecimal(ch.CipherSuites),
+		joinDecimal(ch.Extensions),
+		joinDecimal(ch.SupportedGroups),
+		joinDecimal(formats),
+	}, ",")
+}
+
+// JA3 returns the MD5 hash of the JA3 string.
+func (ch *ClientHello) JA3() string {
+	sum := md5.Sum([]byte(ch.JA3String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint for a ClientHello received over TCP.
+func (ch *ClientHello) JA4() string {
+	ciphers := withoutGrease(ch.CipherSuites)
+	exts := withoutGrease(ch.Extensions)
+
+	sni := "i"
+	if ch.ServerName != "" {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if len(ch.ALPN) > 0 && ch.ALPN[0] != "" {
+		first := ch.ALPN[0]
+		alpn = string(first[0]) + string(first[len(first)-1])
+	}
+
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(ch), sni, min(len(ciphers), 99), min(len(exts), 99), alpn)
+
+	b := truncatedHash(sortedHex(ciphers))
+
+	hashedExts := make([]uint16, 0, len(exts))
+	for _, e := range exts {
+		if e != extServerName && e != extALPN {
+			hashedExts = append(hashedExts, e)
+		}
+	}
+	c := sortedHex(hashedExts)
+	if sigs := withoutGrease(ch.SignatureAlgorithms); len(sigs) > 0 && c != "" {
+		c += "_" + joinHex(sigs)
+	}
+
+	return a + "_" + b + "_" + truncatedHash(c)
+}
+
+func ja4Version(ch *ClientHello) string {
+	// Highest supported_versions entry wins over the legacy version field
+	v := ch.Version
+	if versions := withoutGrease(ch.SupportedVersions); len(versions) > 0 {
+		v = 0
+		for _, sv := range versions {
+			v = max(v, sv)
+		}
+	}
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+// isGrease reports whether v is a GREASE value (RFC 8701).
+func isGrease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGrease(in []uint16) []uint16 {
+	out := make([]uint16, 0, len(in))
+	for _, v := range in {
+		if !isGrease(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinDecimal(vals []uint16) string {
+	parts := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if isGrease(v) {
+			continue
+		}
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(vals []uint16) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortedHex(vals []uint16) string {
+	sorted := append([]uint16(nil), vals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return joinHex(sorted)
+}
+
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// reader is a minimal TLS wire-format cursor.
+type reader []byte
+
+func (r *reader) u8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) bytes(n int) (reader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+func (r *reader) vec8() (reader, bool) {
+	n, ok := r.u8()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) vec16() (reader, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r reader) u16s() []uint16 {
+	out := make([]uint16, 0, len(r)/2)
+	for len(r) >= 2 {
+		out = append(out, binary.BigEndian.Uint16(r))
+		r = r[2:]
+	}
+	return out
+}
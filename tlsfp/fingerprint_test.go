@@ -0,0 +1,119 @@
+package tlsfp
+
+import (
+	"crypto/tls"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureClientHello returns the first bytes a Go TLS client sends.
+func captureClientHello(t *testing.T, cfg *tls.Config) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		defer client.Close()
+		tls.Client(client, cfg).Handshake()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read ClientHello: %v", err)
+	}
+	return buf[:n]
+}
+
+func TestParseClientHello(t *testing.T) {
+	data := captureClientHello(t, &tls.Config{
+		ServerName: "example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+
+	ch, err := ParseClientHello(data)
+	if err != nil {
+		t.Fatalf("ParseClientHello failed: %v", err)
+	}
+	if ch.ServerName != "example.com" {
+		t.Errorf("ServerName = %q, want example.com", ch.ServerName)
+	}
+	if len(ch.ALPN) != 2 || ch.ALPN[0] != "h2" {
+		t.Errorf("ALPN = %v, want [h2 http/1.1]", ch.ALPN)
+	}
+	if len(ch.CipherSuites) == 0 || len(ch.Extensions) == 0 {
+		t.Errorf("expected cipher suites and extensions, got %+v", ch)
+	}
+
+	if ok, _ := regexp.MatchString(`^[0-9a-f]{32}$`, ch.JA3()); !ok {
+		t.Errorf("JA3 = %q, want 32 hex chars", ch.JA3())
+	}
+	if parts := strings.Split(ch.JA3String(), ","); len(parts) != 5 || parts[0] != "771" {
+		t.Errorf("JA3String = %q, want 5 fields starting with 771", ch.JA3String())
+	}
+
+	ja4 := ch.JA4()
+	if ok, _ := regexp.MatchString(`^t13d\d{4}h2_[0-9a-f]{12}_[0-9a-f]{12}$`, ja4); !ok {
+		t.Errorf("JA4 = %q, unexpected format", ja4)
+	}
+}
+
+func TestParseClientHello_Errors(t *testing.T) {
+	if _, err := ParseClientHello([]byte("GET / HTTP/1.1\r\n")); err != ErrNotClientHello {
+		t.Errorf("expected ErrNotClientHello, got %v", err)
+	}
+
+	data := captureClientHello(t, &tls.Config{ServerName: "example.com"})
+	if _, err := ParseClientHello(data[:len(data)/2]); err != ErrTruncated {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+
+	// A complete handshake message that does not parse
+	bad := []byte{0x16, 0x03, 0x01, 0x00, 0x06, 0x01, 0x00, 0x00, 0x02, 0x03, 0x03}
+	if _, err := ParseClientHello(bad); err != ErrMalformed {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestParseClientHello_Fragmented(t *testing.T) {
+	data := captureClientHello(t, &tls.Config{ServerName: "example.com"})
+
+	// Split the record payload into records of 100 bytes each
+	var fragmented []byte
+	for msg := data[5:]; len(msg) > 0; {
+		n := min(len(msg), 100)
+		fragmented = append(fragmented, 0x16, data[1], data[2], byte(n>>8), byte(n))
+		fragmented = append(fragmented, msg[:n]...)
+		msg = msg[n:]
+	}
+	if _, err := ParseClientHello(fragmented[:len(fragmented)-1]); err != ErrTruncated {
+		t.Errorf("expected ErrTruncated before the last fragment, got %v", err)
+	}
+	ch, err := ParseClientHello(fragmented)
+	if err != nil {
+		t.Fatalf("ParseClientHello failed: %v", err)
+	}
+	if ch.ServerName != "example.com" {
+		t.Errorf("ServerName = %q, want example.com", ch.ServerName)
+	}
+}
+
+func TestGreaseIgnored(t *testing.T) {
+	ch := &ClientHello{
+		Version:      0x0303,
+		CipherSuites: []uint16{0x0a0a, 0x1301, 0x1302},
+		Extensions:   []uint16{0x1a1a, 0x0000, 0x000a},
+	}
+	if got := ch.JA3String(); got != "771,4865-4866,0-10,," {
+		t.Errorf("JA3String = %q", got)
+	}
+	if got := ch.JA4(); !strings.HasPrefix(got, "t12i020200_") {
+		t.Errorf("JA4 = %q, want prefix t12i020200_", got)
+	}
+	if !isGrease(0xfafa) || isGrease(0x0a1a) {
+		t.Error("isGrease misclassified values")
+	}
+}
@@ -0,0 +1,183 @@
+// Command configgen writes a regression corpus for the config loader and
+// listener expansion: randomized but valid configurations, spread over a main
+// file and included ones, each with the golden listing of the listeners it
+// expands to.
+//
+//	go run ./tools/configgen -out tools/configgen/testdata/corpus -cases 16 -seed 1
+//
+// Every case is a directory holding nvelox.yaml, its conf.d includes and
+// expanded.golden. The same seed always writes the same corpus.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"nvelox/config"
+	"nvelox/core"
+)
+
+const (
+	mainFile   = "nvelox.yaml"
+	includeDir = "conf.d"
+	goldenFile = "expanded.golden"
+)
+
+func main() {
+	out := flag.String("out", "testdata/corpus", "directory the cases are written to")
+	cases := flag.Int("cases", 16, "number of cases")
+	seed := flag.Uint64("seed", 1, "random seed")
+	flag.Parse()
+
+	for i := range *cases {
+		dir := filepath.Join(*out, fmt.Sprintf("case-%03d", i))
+		if err := writeCase(dir, *seed, uint64(i)); err != nil {
+			log.Fatalf("case %d: %v", i, err)
+		}
+	}
+	log.Printf("Wrote %d cases to %s", *cases, *out)
+}
+
+// writeCase generates case n of seed into dir and records its golden output.
+func writeCase(dir string, seed, n uint64) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	files := generate(rand.New(rand.NewPCG(seed, n)))
+	for name, doc := range files {
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+	}
+	golden, err := expand(dir)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, goldenFile), golden, 0o644)
+}
+
+var (
+	protocols = []string{"tcp", "tcp", "udp", "tcp+udp"}
+	hosts     = []string{"", "*", "0.0.0.0", "127.0.0.1", "[::1]"}
+	balances  = []string{"roundrobin", "leastconn", "random"}
+)
+
+// generate returns the files of one case by path relative to its directory.
+// Listener ports are handed out in increasing order, so binds never overlap.
+func generate(r *rand.Rand) map[string]any {
+	backends := make([]map[string]any, 1+r.IntN(3))
+	for i := range backends {
+		servers := make([]string, 1+r.IntN(3))
+		for j := range servers {
+			servers[j] = fmt.Sprintf("10.0.%d.%d:%d", i, j+1, 8000+r.IntN(1000))
+		}
+		backends[i] = map[string]any{
+			"name":    fmt.Sprintf("pool-%d", i),
+			"balance": balances[r.IntN(len(balances))],
+			"servers": servers,
+		}
+	}
+
+	port := 10000 + r.IntN(40000)
+	listeners := make([]map[string]any, 1+r.IntN(12))
+	for i := range listeners {
+		binds := make([]string, 1+r.IntN(3))
+		for j := range binds {
+			host := hosts[r.IntN(len(hosts))]
+			if r.IntN(2) == 0 {
+				binds[j] = fmt.Sprintf("%s:%d", host, port)
+				port++
+				continue
+			}
+			end := port + 1 + r.IntN(24)
+			binds[j] = fmt.Sprintf("%s:%d-%d", host, port, end)
+			port = end + 1
+		}
+		l := map[string]any{
+			"name":            fmt.Sprintf("listener-%d", i),
+			"protocol":        protocols[r.IntN(len(protocols))],
+			"default_backend": backends[r.IntN(len(backends))]["name"],
+		}
+		if len(binds) == 1 && r.IntN(2) == 0 {
+			l["bind"] = binds[0]
+		} else {
+			l["bind"] = binds
+		}
+		listeners[i] = l
+	}
+
+	// Spread listeners and backends over the main file and up to three
+	// includes; backends may be defined after the listeners using them
+	includes := r.IntN(4)
+	parts := make([]map[string]any, 1+includes)
+	for i := range parts {
+		parts[i] = map[string]any{}
+	}
+	appendTo := func(key string, v map[string]any) {
+		p := parts[r.IntN(len(parts))]
+		list, _ := p[key].([]map[string]any)
+		p[key] = append(list, v)
+	}
+	for _, l := range listeners {
+		appendTo("listeners", l)
+	}
+	for _, b := range backends {
+		appendTo("backends", b)
+	}
+
+	parts[0]["version"] = "2"
+	files := map[string]any{mainFile: parts[0]}
+	if includes > 0 {
+		parts[0]["include"] = includeDir + "/*.yaml"
+		for i, p := range parts[1:] {
+			files[filepath.Join(includeDir, fmt.Sprintf("%02d.yaml", i))] = p
+		}
+	}
+	return files
+}
+
+// expand loads the case in dir and lists the listeners it expands to, one
+// per line: group, name, protocol, address, port and default backend.
+// Includes are relative to dir, which is made the working directory for the
+// load.
+func expand(dir string) ([]byte, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, err
+	}
+	defer os.Chdir(wd)
+
+	cfg, err := config.Load(mainFile)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, l := range cfg.Listeners {
+		lcs, err := core.ExpandListener(l)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+		for _, lc := range lcs {
+			fmt.Fprintf(&b, "%s %s %s %s %d %s\n", lc.Group, lc.Name, lc.Protocol, lc.Addr, lc.Port, lc.DefaultBackend)
+		}
+	}
+	return []byte(b.String()), nil
+}
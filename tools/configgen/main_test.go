@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the corpus")
+
+const corpusDir = "testdata/corpus"
+
+// TestCorpus loads every case of the corpus and compares the listeners it
+// expands to with its golden file.
+// Regenerate after an intended change with: go test ./tools/configgen -update
+func TestCorpus(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join(corpusDir, "case-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no cases in %s", corpusDir)
+	}
+	for _, dir := range cases {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			got, err := expand(dir)
+			if err != nil {
+				t.Fatalf("expand: %v", err)
+			}
+			golden := filepath.Join(dir, goldenFile)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("expanded listeners differ from %s; regenerate with -update if intended\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestWriteCase(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for i := range uint64(64) {
+		if err := writeCase(a, 7, i); err != nil {
+			t.Fatalf("case %d does not load: %v", i, err)
+		}
+	}
+
+	// The same seed writes the same case
+	if err := writeCase(b, 7, 63); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{mainFile, goldenFile} {
+		x, _ := os.ReadFile(filepath.Join(a, name))
+		y, _ := os.ReadFile(filepath.Join(b, name))
+		if len(x) == 0 || !bytes.Equal(x, y) {
+			t.Errorf("%s differs between runs of the same seed", name)
+		}
+	}
+}
@@ -2,23 +2,33 @@ package main
 
 import (
 	"context"
+	"flag"
 	"io"
 	"log"
 	"net"
-	"os"
 )
 
 func main() {
+	scriptPath := flag.String("script", "", "scenario script played on every connection (see step)")
+	flag.Parse()
+
 	addr := ":8081"
-	if len(os.Args) > 1 {
-		addr = os.Args[1]
+	if flag.NArg() > 0 {
+		addr = flag.Arg(0)
+	}
+	var script []step
+	if *scriptPath != "" {
+		var err error
+		if script, err = loadScript(*scriptPath); err != nil {
+			log.Fatal(err)
+		}
 	}
-	if err := run(addr, context.Background()); err != nil {
+	if err := run(addr, context.Background(), script); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run(addr string, ctx context.Context) error {
+func run(addr string, ctx context.Context, script []step) error {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
@@ -42,14 +52,22 @@ func run(addr string, ctx context.Context) error {
 				continue
 			}
 		}
-		go handle(conn)
+		go handle(conn, script)
 	}
 }
 
-func handle(c net.Conn) {
+func handle(c net.Conn, script []step) {
 	defer c.Close()
 	log.Printf("Backend accepted: %s", c.RemoteAddr())
 
+	if more, err := play(c, script); !more {
+		if err != nil && err != io.EOF {
+			log.Printf("Backend script error: %v", err)
+		}
+		log.Printf("Backend connection closed: %s", c.RemoteAddr())
+		return
+	}
+
 	buf := make([]byte, 1024)
 	for {
 		n, err := c.Read(buf)
@@ -17,7 +17,7 @@ func TestRun(t *testing.T) {
 	defer cancel()
 
 	go func() {
-		if err := run(addr, ctx); err != nil {
+		if err := run(addr, ctx, nil); err != nil {
 			// ignore close error
 		}
 	}()
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// step is one line of a scenario script:
+//
+//	read 16                 # read exactly 16 bytes
+//	expect "PING\r\n"       # read these bytes, closing on anything else
+//	write "PONG\r\n"        # send bytes; hex:0d0a00 for binary data
+//	delay 250ms             # wait before the next step
+//	close                   # close the connection
+//
+// Strings use Go quoting. Once the steps run out, the connection is read
+// and logged until the client closes it, as without a script.
+type step struct {
+	op    string
+	n     int
+	data  []byte
+	delay time.Duration
+}
+
+// loadScript reads a scenario script from a file.
+func loadScript(path string) ([]step, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseScript(f)
+}
+
+// parseScript parses the steps of a scenario script, one per line. Blank
+// lines and # comments are skipped.
+func parseScript(r io.Reader) ([]step, error) {
+	var steps []step
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		op, arg, _ := strings.Cut(text, " ")
+		arg = strings.TrimSpace(arg)
+		s := step{op: op}
+		var err error
+		switch op {
+		case "read":
+			if s.n, err = strconv.Atoi(arg); err == nil && s.n <= 0 {
+				err = fmt.Errorf("count must be positive")
+			}
+		case "expect", "write":
+			s.data, err = parseBytes(arg)
+		case "delay":
+			s.delay, err = time.ParseDuration(arg)
+		case "close":
+			if arg != "" {
+				err = fmt.Errorf("close takes no argument")
+			}
+		default:
+			err = fmt.Errorf("unknown step %q", op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		steps = append(steps, s)
+	}
+	return steps, sc.Err()
+}
+
+// parseBytes reads a Go quoted string or hex: followed by hex digits,
+// ignoring a trailing # comment after the quotes.
+func parseBytes(arg string) ([]byte, error) {
+	if h, ok := strings.CutPrefix(arg, "hex:"); ok {
+		h, _, _ = strings.Cut(h, " ")
+		return hex.DecodeString(h)
+	}
+	quoted, err := strconv.QuotedPrefix(arg)
+	if err != nil {
+		return nil, fmt.Errorf("expected a quoted string or hex:, got %s", arg)
+	}
+	if rest := strings.TrimSpace(arg[len(quoted):]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("unexpected %q after string", rest)
+	}
+	s, err := strconv.Unquote(quoted)
+	return []byte(s), err
+}
+
+// play runs the steps of a script on a connection. It returns false once
+// the connection should be closed.
+func play(c net.Conn, steps []step) (bool, error) {
+	for _, s := range steps {
+		switch s.op {
+		case "read":
+			buf := make([]byte, s.n)
+			if _, err := io.ReadFull(c, buf); err != nil {
+				return false, err
+			}
+			log.Printf("Backend read %d bytes: %q", s.n, buf)
+		case "expect":
+			buf := make([]byte, len(s.data))
+			if _, err := io.ReadFull(c, buf); err != nil {
+				return false, err
+			}
+			if !bytes.Equal(buf, s.data) {
+				return false, fmt.Errorf("expected %q, got %q", s.data, buf)
+			}
+		case "write":
+			if _, err := c.Write(s.data); err != nil {
+				return false, err
+			}
+		case "delay":
+			time.Sleep(s.delay)
+		case "close":
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	steps, err := parseScript(strings.NewReader(`
+# PROXY header, then a ping
+expect "\r\n\r\n\x00\r\nQUIT\n"
+read 4
+write "PONG\r\n" # reply
+write hex:00ff
+delay 20ms
+close
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"expect", "read", "write", "write", "delay", "close"}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(steps), len(want))
+	}
+	for i, op := range want {
+		if steps[i].op != op {
+			t.Errorf("step %d = %s, want %s", i, steps[i].op, op)
+		}
+	}
+	if string(steps[2].data) != "PONG\r\n" || string(steps[3].data) != "\x00\xff" || steps[4].delay != 20*time.Millisecond {
+		t.Errorf("unexpected arguments: %+v", steps)
+	}
+
+	for _, bad := range []string{"read", "read -1", "write PONG", `write "a" b`, "write hex:zz", "delay soon", "close now", "send 1"} {
+		if _, err := parseScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRun_Script(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	script, err := parseScript(strings.NewReader("expect \"PING\"\nwrite \"PONG\"\nclose\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go run(addr, ctx, script)
+	time.Sleep(100 * time.Millisecond)
+
+	for _, c := range []struct {
+		send, want string
+	}{
+		{"PING", "PONG"},
+		{"PANG", ""}, // closed on unexpected bytes
+	} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Connection failed: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		conn.Write([]byte(c.send))
+		got, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.send, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: got %q, want %q", c.send, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"nvelox/admin"
+	"nvelox/core"
+	"nvelox/core/logging"
+	"nvelox/core/pidfile"
+	"nvelox/core/upgrade"
+)
+
+// upgradeTimeout bounds how long a new binary may take to take over.
+const upgradeTimeout = 30 * time.Second
+
+// upgradeBinary starts the executable, typically replaced on disk, with the
+// arguments of this process and passes it the listening sockets and the pid
+// file. Once the new process serves them, the engine hands off and this
+// process may shut down; on error it keeps serving.
+func upgradeBinary(engine *core.Engine, adminSrv *admin.Server, pid *pidfile.File) error {
+	files, err := engine.ListenerFiles()
+	if err != nil {
+		return err
+	}
+	adminFiles, err := adminSrv.ListenerFiles()
+	if err != nil {
+		closeFiles(files)
+		return err
+	}
+	for name, f := range adminFiles {
+		files[name] = f
+	}
+	// Closed here once passed; the new process has its own copies
+	defer closeFiles(files)
+
+	passed := make(map[string]*os.File, len(files)+1)
+	for name, f := range files {
+		passed[name] = f
+	}
+	if pid != nil {
+		passed[upgrade.PidFile] = pid.File()
+	}
+	child, err := upgrade.Start(os.Args[1:], passed)
+	if err != nil {
+		return err
+	}
+	logging.Info("[UPGRADE] started pid %d with %d listening sockets", child.Pid(), len(files))
+	if err := child.Wait(upgradeTimeout); err != nil {
+		return err
+	}
+
+	logging.Info("[UPGRADE] pid %d took over, shutting down", child.Pid())
+	engine.HandOff()
+	if pid != nil {
+		if err := pid.Detach(); err != nil {
+			logging.Warn("[PID] %v", err)
+		}
+	}
+	return nil
+}
+
+// takeOver finishes the start of a process that replaces another: it takes
+// the pid file, expected at pidPath, and reports to the previous process
+// that it can shut down.
+func takeOver(inherited map[string]*os.File, pidPath string) (*pidfile.File, error) {
+	var pid *pidfile.File
+	if f := inherited[upgrade.PidFile]; f != nil {
+		delete(inherited, upgrade.PidFile)
+		var err error
+		if pid, err = pidfile.Inherit(f, pidPath); err != nil {
+			logging.Warn("[PID] %v", err)
+		}
+	}
+	if err := upgrade.Ready(inherited); err != nil {
+		return pid, err
+	}
+	closeFiles(inherited) // unknown to this version
+	logging.Info("[UPGRADE] took over from the previous process")
+	return pid, nil
+}
+
+func closeFiles(files map[string]*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
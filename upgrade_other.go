@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Without passing file descriptors to a new process there is no upgrade signal.
+var upgradeSignal os.Signal
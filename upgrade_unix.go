@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignal starts a new binary that takes over the listening sockets.
+var upgradeSignal os.Signal = syscall.SIGUSR2